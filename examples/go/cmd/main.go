@@ -1,23 +1,62 @@
 // Package main provides a comprehensive Go web API example using Gin framework
 package main
 
+// The OpenAPI spec in docs is generated from the swagger annotations; run
+// go generate after changing them
+//go:generate go run github.com/swaggo/swag/cmd/swag init --dir ./,../internal/handlers --generalInfo main.go --output ../docs --outputTypes go,json --parseDependency --parseInternal
+
 import (
 	"context"
-	"log"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"flag"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"golang.org/x/crypto/acme/autocert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
 
+	"github.com/cbwinslow/template2/examples/go/docs"
+	"github.com/cbwinslow/template2/examples/go/internal/avatar"
+	"github.com/cbwinslow/template2/examples/go/internal/gateway"
+	"github.com/cbwinslow/template2/examples/go/internal/grpcserver"
 	"github.com/cbwinslow/template2/examples/go/internal/handlers"
+	"github.com/cbwinslow/template2/examples/go/internal/logging"
+	"github.com/cbwinslow/template2/examples/go/internal/metrics"
 	"github.com/cbwinslow/template2/examples/go/internal/middleware"
 	"github.com/cbwinslow/template2/examples/go/internal/models"
+	"github.com/cbwinslow/template2/examples/go/internal/models/postgres"
+	"github.com/cbwinslow/template2/examples/go/internal/outbound"
+	"github.com/cbwinslow/template2/examples/go/internal/selftest"
+	"github.com/cbwinslow/template2/examples/go/internal/server"
+	"github.com/cbwinslow/template2/examples/go/internal/tracing"
+	"github.com/cbwinslow/template2/examples/go/internal/ws"
+	"github.com/cbwinslow/template2/examples/go/pkg/audit"
 	"github.com/cbwinslow/template2/examples/go/pkg/auth"
+	"github.com/cbwinslow/template2/examples/go/pkg/auth/apikey"
+	"github.com/cbwinslow/template2/examples/go/pkg/auth/websession"
+	"github.com/cbwinslow/template2/examples/go/pkg/broker"
+	"github.com/cbwinslow/template2/examples/go/pkg/config"
+	"github.com/cbwinslow/template2/examples/go/pkg/events"
+	"github.com/cbwinslow/template2/examples/go/pkg/flags"
+	"github.com/cbwinslow/template2/examples/go/pkg/jobs"
+	"github.com/cbwinslow/template2/examples/go/pkg/lifecycle"
+	"github.com/cbwinslow/template2/examples/go/pkg/mailer"
+	"github.com/cbwinslow/template2/examples/go/pkg/scheduler"
+	"github.com/cbwinslow/template2/examples/go/pkg/storage"
+	"github.com/cbwinslow/template2/examples/go/pkg/webhooks"
 )
 
 // @title Template2 Go Example API
@@ -32,20 +71,74 @@ import (
 // @license.name MIT
 // @license.url https://opensource.org/licenses/MIT
 
-// @host localhost:8080
 // @BasePath /api/v1
 
 // @securityDefinitions.apikey ApiKeyAuth
 // @in header
 // @name Authorization
 func main() {
+	// Bootstrap logger for failures before the real logger exists
+	bootLogger := logging.Bootstrap()
+
+	// "migrate up|down|status" manages the schema instead of serving
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		err := runMigrate(os.Args[2:], os.Stdout)
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		if err != nil {
+			bootLogger.Fatal("Migration failed", zap.Error(err))
+		}
+		return
+	}
+
+	// Load configuration: profile, file, environment, then flags
+	cfg, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		bootLogger.Fatal("Failed to load configuration", zap.Error(err))
+	}
+
 	// Initialize logger
-	logger := initLogger()
+	logger, logLevel, err := logging.New(logging.Config{
+		Level:              cfg.Logging.Level,
+		Development:        gin.Mode() == gin.DebugMode,
+		SamplingInitial:    cfg.Logging.SamplingInitial,
+		SamplingThereafter: cfg.Logging.SamplingThereafter,
+		File: logging.AuditFile{
+			Path:       cfg.Logging.File,
+			MaxSizeMB:  cfg.Logging.FileMaxSizeMB,
+			MaxBackups: cfg.Logging.FileMaxBackups,
+			MaxAgeDays: cfg.Logging.FileMaxAgeDays,
+		},
+	})
+	if err != nil {
+		bootLogger.Fatal("Failed to initialize logger", zap.Error(err))
+	}
 	defer logger.Sync()
 
+	// Components register how to release what they hold; they are stopped
+	// in reverse order after the server drains
+	lc := lifecycle.New(lifecycle.WithLogger(logger))
+
+	// Initialize tracing
+	if cfg.Tracing.Endpoint != "" {
+		shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+			Endpoint:    cfg.Tracing.Endpoint,
+			ServiceName: cfg.Tracing.ServiceName,
+			SampleRatio: cfg.Tracing.SampleRatio,
+		})
+		if err != nil {
+			logger.Fatal("Failed to initialize tracing", zap.Error(err))
+		}
+		lc.Append(lifecycle.Hook{Name: "tracing", Stop: shutdownTracing})
+	}
+
 	// Initialize Gin with custom logger
-	gin.DefaultWriter = zapcore.AddSync(logger.Core())
-	
+	gin.DefaultWriter = zap.NewStdLog(logger).Writer()
+
 	// Set Gin mode
 	if os.Getenv("GIN_MODE") == "" {
 		gin.SetMode(gin.ReleaseMode)
@@ -53,43 +146,666 @@ func main() {
 
 	// Initialize router
 	router := gin.New()
+	if err := middleware.TrustProxies(router, cfg.Server.TrustedProxies); err != nil {
+		logger.Fatal("Invalid TRUSTED_PROXIES", zap.Error(err))
+	}
 
 	// Add middleware
-	router.Use(middleware.Logger(logger))
+	metricsRegistry := metrics.NewRegistry()
+	router.Use(middleware.Metrics(metricsRegistry))
+	if cfg.Tracing.Endpoint != "" {
+		router.Use(otelgin.Middleware(cfg.Tracing.ServiceName, otelgin.WithFilter(func(r *http.Request) bool {
+			return r.URL.Path != "/metrics"
+		})))
+	}
+	router.Use(middleware.RequestID(cfg.Server.RequestIDReuseWindow))
+	var loggerOptions []middleware.LoggerOption
+	if cfg.Logging.AccessLogFormat == "combined" {
+		accessLog := os.Stdout
+		if cfg.Logging.AccessLogFile != "" {
+			accessLog, err = os.OpenFile(cfg.Logging.AccessLogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+			if err != nil {
+				logger.Fatal("Failed to open access log", zap.Error(err))
+			}
+			lc.Append(lifecycle.Hook{Name: "access log", Stop: func(context.Context) error { return accessLog.Close() }})
+		}
+		loggerOptions = append(loggerOptions, middleware.WithCombinedLog(accessLog))
+	}
+	if cfg.Logging.Bodies {
+		loggerOptions = append(loggerOptions, middleware.WithBodyCapture(cfg.Logging.BodyMaxBytes, cfg.Logging.RedactFields...))
+	}
+	router.Use(middleware.Logger(logger, loggerOptions...))
+	// Ahead of recovery, so the problem for a panic is encoded too
+	if cfg.Server.Compression {
+		router.Use(middleware.Compress(middleware.WithCompressMinSize(cfg.Server.CompressionMinSize),
+			middleware.WithCompressExcludedTypes(cfg.Server.CompressionExcludedTypes...)))
+		if cfg.Logging.Bodies {
+			router.Use(middleware.CaptureResponseBody())
+		}
+	}
 	router.Use(middleware.Recovery(logger))
-	router.Use(middleware.CORS())
-	router.Use(middleware.RateLimit())
+	var corsOptions []middleware.CORSOption
+	if cfg.CORS.AllowCredentials {
+		corsOptions = append(corsOptions, middleware.WithCORSCredentials())
+	}
+	corsOptions = append(corsOptions, middleware.WithCORSMaxAge(cfg.CORS.MaxAge))
+	router.Use(middleware.CORS(cfg.CORS.AllowedOrigins, corsOptions...))
+	if cfg.Server.SecurityHeaders {
+		router.Use(middleware.SecurityHeaders(
+			middleware.WithContentSecurityPolicy(cfg.Server.ContentSecurityPolicy),
+			middleware.WithHSTSMaxAge(cfg.Server.HSTSMaxAge),
+			middleware.WithFrameOptions(cfg.Server.FrameOptions),
+			middleware.WithReferrerPolicy(cfg.Server.ReferrerPolicy)))
+	}
+	if cfg.Server.PrettyJSON {
+		router.Use(middleware.PrettyJSON())
+	}
+	var rateLimitOptions []middleware.RateLimitOption
+	if cfg.RateLimit.FailOpen {
+		rateLimitOptions = append(rateLimitOptions, middleware.WithFailOpen(logger))
+	}
+	// One Redis connection pool serves every feature configured to use it
+	var redisClient *redis.Client
+	connectRedis := func(url string) *redis.Client {
+		if redisClient == nil {
+			redisOptions, err := redis.ParseURL(url)
+			if err != nil {
+				logger.Fatal("Invalid REDIS_URL", zap.Error(err))
+			}
+			redisClient = redis.NewClient(redisOptions)
+			lc.Append(lifecycle.Hook{Name: "redis", Stop: func(context.Context) error { return redisClient.Close() }})
+		}
+		return redisClient
+	}
+	var rateLimitStore middleware.RateLimitStore = middleware.NewMemoryRateLimitStore()
+	if cfg.RateLimit.Backend == "redis" {
+		rateLimitStore = middleware.NewFallbackRateLimitStore(
+			middleware.NewRedisRateLimitStore(connectRedis(cfg.RateLimit.RedisURL), "ratelimit:"), rateLimitStore, logger)
+	}
+	router.Use(middleware.RateLimit(rateLimitStore, cfg.RateLimit.Requests, cfg.RateLimit.Window, rateLimitOptions...))
+	// limitGroup applies the group's configured budget on top of the global one
+	limitGroup := func(group *gin.RouterGroup, name string) {
+		if rule, ok := cfg.RateLimit.Groups[name]; ok {
+			group.Use(middleware.RateLimit(rateLimitStore, rule.Requests, rule.Window,
+				append(rateLimitOptions, middleware.WithRateLimitScope(name))...))
+		}
+	}
+	// The event stream stays open for as long as the client listens,
+	// unless a timeout is configured for it
+	routeTimeouts := map[string]time.Duration{"GET " + handlers.EventStreamPath: 0}
+	for route, timeout := range cfg.Server.RouteTimeouts {
+		routeTimeouts[route] = timeout
+	}
+	router.Use(middleware.Timeout(cfg.Server.RequestTimeout, routeTimeouts))
+	routeBodyLimits := make(map[string]int64, len(cfg.Server.RouteMaxBody))
+	for route, maxBody := range cfg.Server.RouteMaxBody {
+		routeBodyLimits[route] = int64(maxBody)
+	}
+	router.Use(middleware.BodyLimit(int64(cfg.Server.MaxBody), middleware.WithRouteBodyLimits(routeBodyLimits)))
+	router.Use(middleware.DecompressBody(int64(cfg.Server.MaxDecompressedBody)))
 
 	// Initialize services
-	userService := models.NewUserService()
-	authService := auth.NewAuthService()
-	userHandler := handlers.NewUserHandler(userService, logger)
-	authHandler := handlers.NewAuthHandler(authService, logger)
-	healthHandler := handlers.NewHealthHandler(logger)
+	userOptions := []models.UserServiceOption{
+		models.WithDefaults(models.UserDefaults{
+			Role:   cfg.Users.DefaultRole,
+			Active: cfg.Users.DefaultActive,
+		}),
+		models.WithMaxUsers(cfg.Users.MaxUsers),
+		models.WithStatementTimeout(cfg.Users.StatementTimeout),
+	}
+	if cfg.Users.AdminEmailDomain != "" {
+		userOptions = append(userOptions, models.WithInvariants(models.AdminEmailDomain(cfg.Users.AdminEmailDomain)))
+	}
+	// Readiness checks each dependency that is configured, each within its
+	// own timeout
+	var healthChecks []handlers.Checker
+	addHealthCheck := func(check handlers.Checker) {
+		healthChecks = append(healthChecks, handlers.NewTimeoutChecker(check, cfg.Health.CheckTimeout))
+	}
+	var db *sql.DB
+	if cfg.Database.Backend == "postgres" {
+		connectCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		var err error
+		db, err = postgres.Open(connectCtx, cfg.Database.URL, postgres.PoolConfig{
+			MaxOpenConns:    cfg.Database.MaxOpenConns,
+			MaxIdleConns:    cfg.Database.MaxIdleConns,
+			ConnMaxLifetime: cfg.Database.ConnMaxLifetime,
+		})
+		if err != nil {
+			cancel()
+			logger.Fatal("Failed to connect to database", zap.Error(err))
+		}
+		lc.Append(lifecycle.Hook{Name: "database", Stop: func(context.Context) error { return db.Close() }})
+
+		repo := postgres.NewUserRepository(db)
+		if cfg.Database.AutoMigrate {
+			if err := repo.Migrate(connectCtx); err != nil {
+				cancel()
+				logger.Fatal("Failed to migrate database", zap.Error(err))
+			}
+		}
+		cancel()
+		userOptions = append(userOptions, models.WithRepository(repo))
+
+		migrator, err := postgres.NewMigrator(db)
+		if err != nil {
+			logger.Fatal("Failed to load migrations", zap.Error(err))
+		}
+		addHealthCheck(handlers.NewPingChecker("database", db.PingContext))
+		addHealthCheck(handlers.NewMigrationChecker(migrator.Pending))
+	}
+	authOptions := []auth.Option{
+		auth.WithTokenTTL(cfg.Auth.TokenTTL),
+		auth.WithRefreshTTL(cfg.Auth.RefreshTTL),
+		auth.WithRefreshGrace(cfg.Auth.RefreshGrace),
+		auth.WithStoreRetry(cfg.Auth.StoreMaxAttempts, cfg.Auth.StoreRetryBackoff),
+		auth.WithVerificationTTL(cfg.Auth.VerificationTTL),
+		auth.WithResetTTL(cfg.Auth.PasswordReset.TTL),
+		auth.WithTOTPIssuer(cfg.Auth.TwoFactor.Issuer),
+		auth.WithChallengeTTL(cfg.Auth.TwoFactor.ChallengeTTL),
+	}
+	if cfg.Auth.JWTSecret != "" {
+		authOptions = append(authOptions, auth.WithSecret([]byte(cfg.Auth.JWTSecret)))
+	} else {
+		logger.Warn("JWT_SECRET not set; using a random signing key")
+	}
+	// The services publish domain events on the bus; webhooks, the audit
+	// log and metrics subscribe to them once they are set up
+	eventBus := events.NewBus(logger)
+	authOptions = append(authOptions, auth.WithEvents(eventBus))
+	userOptions = append(userOptions, models.WithEvents(eventBus))
+	authService := auth.NewAuthService(authOptions...)
+	apiKeys := apikey.NewService(apikey.NewMemoryStore())
+	// Audit records go to the rotated file and to the store the admin API
+	// serves, the database or else the in-memory trail, whichever are
+	// enabled
+	var auditCores []zapcore.Core
+	var auditStore audit.Store
+	if cfg.Logging.AuditLogFile != "" {
+		auditCores = append(auditCores, logging.NewAudit(logging.AuditFile{
+			Path:       cfg.Logging.AuditLogFile,
+			MaxSizeMB:  cfg.Logging.AuditLogMaxSizeMB,
+			MaxBackups: cfg.Logging.AuditLogMaxBackups,
+			MaxAgeDays: cfg.Logging.AuditLogMaxAgeDays,
+		}).Core())
+	}
+	switch {
+	case cfg.Logging.AuditStore == "postgres":
+		auditStore = audit.NewPostgresStore(db)
+		auditCores = append(auditCores, audit.Core(auditStore))
+	case cfg.Logging.AuditTrailSize > 0:
+		auditTrail := logging.NewAuditTrail(cfg.Logging.AuditTrailSize)
+		auditStore = auditTrail
+		auditCores = append(auditCores, auditTrail.Core())
+	}
+	auditLogger := zap.New(zapcore.NewTee(auditCores...))
+	lc.Append(lifecycle.Hook{Name: "audit log", Stop: func(context.Context) error { return auditLogger.Sync() }})
+	mergeHooks := handlers.MergeHooks(authService, apiKeys)
+	if auditStore != nil {
+		mergeHooks = append(mergeHooks, handlers.AuditMergeHook(auditStore))
+	}
+	userOptions = append(userOptions, models.WithMergeHooks(mergeHooks...))
+	userService := models.NewUserService(userOptions...)
+	if cfg.Server.SelfTest {
+		if err := selftest.Run(context.Background(), userService, authService); err != nil {
+			logger.Fatal("Startup self-test failed", zap.Error(err))
+		}
+		logger.Info("Startup self-test passed")
+	}
+	defaultSort, err := models.ParseUserSort(cfg.Users.DefaultSort)
+	if err != nil {
+		logger.Fatal("Invalid USERS_DEFAULT_SORT", zap.String("sort", cfg.Users.DefaultSort))
+	}
+	userHandlerOptions := []handlers.UserHandlerOption{
+		handlers.WithFieldPolicy(models.FieldPolicy(cfg.Users.OptionalFields)),
+		handlers.WithDefaultSort(defaultSort),
+		handlers.WithPageSize(cfg.Users.DefaultPageSize, cfg.Users.MaxPageSize),
+		handlers.WithKeyRevoker(apiKeys),
+	}
+	userHandlerOptions = append(userHandlerOptions, handlers.WithAuditLogger(auditLogger))
+	// Feature flags ship in the flags file; admins override them in the
+	// flag store at runtime
+	flagProviders := []flags.Provider{}
+	if cfg.Flags.File != "" {
+		fileFlags, err := flags.LoadFile(cfg.Flags.File)
+		if err != nil {
+			logger.Fatal("Failed to load feature flags", zap.Error(err))
+		}
+		flagProviders = append(flagProviders, fileFlags)
+	}
+	var flagStore flags.Store
+	switch cfg.Flags.Store {
+	case "redis":
+		flagStore = flags.NewRedisStore(connectRedis(cfg.Flags.RedisURL), "flags")
+	case "postgres":
+		flagStore = flags.NewPostgresStore(db)
+	default:
+		flagStore = flags.NewMemoryStore()
+	}
+	featureFlags := flags.New(append(flagProviders, flagStore), flags.WithLogger(logger))
+	adminHandlerOptions := []handlers.AdminHandlerOption{
+		handlers.WithAdminAudit(auditLogger, auditStore),
+		handlers.WithAdminKeyRevoker(apiKeys),
+		handlers.WithLogLevel(logLevel),
+		handlers.WithFeatureFlags(featureFlags, flagStore),
+	}
+	authHandlerOptions := []handlers.AuthHandlerOption{handlers.WithAuthKeyRevoker(apiKeys)}
+	// Handlers writing users purge the response cache, which the users
+	// group serves its GETs from
+	var responseCache middleware.CacheStore
+	if cfg.Cache.TTL > 0 {
+		responseCache = middleware.NewMemoryCacheStore(cfg.Cache.MaxEntries)
+		if cfg.Cache.Backend == "redis" {
+			responseCache = middleware.NewRedisCacheStore(connectRedis(cfg.Cache.RedisURL), "cache:")
+		}
+		userHandlerOptions = append(userHandlerOptions, handlers.WithCacheInvalidator(responseCache))
+		authHandlerOptions = append(authHandlerOptions, handlers.WithAuthCacheInvalidator(responseCache))
+		adminHandlerOptions = append(adminHandlerOptions, handlers.WithAdminCacheInvalidator(responseCache))
+	}
+	// Writes retried with an Idempotency-Key replay their first response.
+	// A claim is held for as long as a request may run, so a duplicate
+	// only runs again once the first has certainly given up.
+	idempotent := func(c *gin.Context) { c.Next() }
+	if cfg.Idempotency.TTL > 0 {
+		var idempotencyStore middleware.IdempotencyStore = middleware.NewMemoryIdempotencyStore()
+		if cfg.Idempotency.Backend == "redis" {
+			idempotencyStore = middleware.NewRedisIdempotencyStore(connectRedis(cfg.Idempotency.RedisURL), "idempotency:")
+		}
+		idempotencyOptions := []middleware.IdempotencyOption{middleware.WithIdempotencyLogger(logger)}
+		if cfg.Server.RequestTimeout > 0 {
+			idempotencyOptions = append(idempotencyOptions, middleware.WithIdempotencyLock(cfg.Server.RequestTimeout))
+		}
+		idempotent = middleware.Idempotency(idempotencyStore, cfg.Idempotency.TTL, idempotencyOptions...)
+	}
+	var jobStore jobs.Store = jobs.NewMemoryStore()
+	if cfg.Jobs.Backend == "redis" {
+		jobStore = jobs.NewRedisStore(connectRedis(cfg.Jobs.RedisURL), "jobs:")
+	}
+	jobQueue := jobs.New(jobStore, logger,
+		jobs.WithWorkers(cfg.Jobs.Workers),
+		jobs.WithRetry(cfg.Jobs.MaxAttempts, cfg.Jobs.RetryBackoff, cfg.Jobs.MaxBackoff),
+		jobs.WithJobTimeout(cfg.Jobs.Timeout))
+	authHandlerOptions = append(authHandlerOptions, handlers.WithJobQueue(jobQueue))
+	lc.Append(lifecycle.Hook{Name: "job workers", Start: jobQueue.Start, Stop: jobQueue.Stop, Timeout: cfg.Server.ShutdownTimeout})
+	// Webhook deliveries are sent and retried by the job workers, so the
+	// client makes one attempt per job run
+	webhookService := webhooks.NewService(webhooks.NewMemoryStore(), jobQueue, outbound.NewClient(logger, 1, 0))
+	for _, name := range webhooks.Events {
+		eventBus.Subscribe(name, webhookService.Forward)
+	}
+	eventBus.Subscribe(events.All, metrics.CountEvents(metricsRegistry))
+	eventBus.SubscribeAsync(events.All, logging.AuditEvents(auditLogger))
+	// The stream replays the last events to clients that reconnect
+	eventFeed := events.NewFeed(1000)
+	eventBus.Subscribe(events.All, eventFeed.Handle)
+	// WebSocket clients are sent the events their users may see
+	wsHub := ws.NewHub(logger, ws.WithAllowedOrigins(cfg.CORS.AllowedOrigins))
+	eventBus.Subscribe(events.All, wsHub.Forward)
+	if cfg.Broker.Backend != "" {
+		publisher, err := newBrokerPublisher(cfg.Broker)
+		if err != nil {
+			logger.Fatal("Failed to set up the event broker", zap.Error(err))
+		}
+		forwarder, err := broker.NewForwarder(publisher, cfg.Broker.TopicPrefix, cfg.Broker.Encoding)
+		if err != nil {
+			logger.Fatal("Failed to set up the event broker", zap.Error(err))
+		}
+		eventBus.SubscribeAsync(events.All, forwarder.Forward)
+		lc.Append(lifecycle.Hook{Name: "event broker", Stop: func(context.Context) error { return publisher.Close() }})
+	}
+	// Stopped before the job workers, the audit log and the broker its
+	// handlers use
+	lc.Append(lifecycle.Hook{Name: "event bus", Stop: eventBus.Stop, Timeout: cfg.Server.ShutdownTimeout})
+	// The server does not drain the connections it hands over to the hub,
+	// so the hub closes them once the server has drained
+	lc.Append(lifecycle.Hook{Name: "websocket hub", Stop: wsHub.Drain, Timeout: cfg.Server.ShutdownTimeout})
+	userHandler := handlers.NewUserHandler(userService, authService, logger, userHandlerOptions...)
+	authMiddlewareOptions := []middleware.AuthOption{middleware.WithSessionDenylist(authService.SessionRevoked)}
+	if cfg.Auth.Cookie.Enabled {
+		authHandlerOptions = append(authHandlerOptions, handlers.WithLoginCookie(handlers.TokenCookie{
+			Name:   cfg.Auth.Cookie.Name,
+			Domain: cfg.Auth.Cookie.Domain,
+			Secure: cfg.Auth.Cookie.Secure,
+		}))
+		authMiddlewareOptions = append(authMiddlewareOptions, middleware.WithTokenCookie(cfg.Auth.Cookie.Name))
+	}
+	// Browser apps may instead hold an opaque session cookie, its tokens
+	// kept and refreshed on the server
+	if sessionsCfg := cfg.Auth.Sessions; sessionsCfg.Enabled {
+		var sessionStore websession.Store = websession.NewMemoryStore()
+		if sessionsCfg.Backend == "redis" {
+			sessionStore = websession.NewRedisStore(connectRedis(sessionsCfg.RedisURL), "session:")
+		}
+		sessions := websession.NewService(sessionStore, authService, authService.RefreshTTL())
+		authHandlerOptions = append(authHandlerOptions, handlers.WithWebSessions(sessions, handlers.TokenCookie{
+			Name:   sessionsCfg.Name,
+			Domain: sessionsCfg.Domain,
+			Secure: sessionsCfg.Secure,
+		}))
+		authMiddlewareOptions = append(authMiddlewareOptions, middleware.WithSessionCookie(sessionsCfg.Name,
+			func(c *gin.Context, id string) (string, error) {
+				return sessions.AccessToken(c.Request.Context(), id, auth.WithSessionClient(c.ClientIP(), c.Request.UserAgent()))
+			}))
+	}
+	certPrincipal := handlers.CertPrincipal(userService)
+	if cfg.TLS.ClientCAFile != "" {
+		authMiddlewareOptions = append(authMiddlewareOptions, middleware.WithVerifiedClientCert(certPrincipal))
+	}
+	if cfg.Auth.ClientCert.Header != "" {
+		authMiddlewareOptions = append(authMiddlewareOptions, middleware.WithClientCert(
+			cfg.Auth.ClientCert.Header, cfg.Auth.ClientCert.TrustedProxies, certPrincipal))
+	}
+	if stuffing := cfg.Auth.Stuffing; stuffing.MaxAccounts > 0 {
+		authHandlerOptions = append(authHandlerOptions, handlers.WithStuffingDetector(
+			auth.NewStuffingDetector(stuffing.MaxAccounts, stuffing.Window, stuffing.Block)))
+	}
+	if len(cfg.Auth.OIDC) > 0 {
+		providers, err := oidcProviders(cfg.Auth.OIDC)
+		if err != nil {
+			logger.Fatal("Failed to set up identity providers", zap.Error(err))
+		}
+		authHandlerOptions = append(authHandlerOptions, handlers.WithOIDC(auth.NewOIDCClient(providers...)))
+	}
+	var mail mailer.Mailer
+	var mailTemplates *mailer.Templates
+	if cfg.Auth.EmailVerification || cfg.Auth.PasswordReset.Enabled {
+		if mail, err = newMailer(cfg.Mail, logger); err != nil {
+			logger.Fatal("Failed to set up the mailer", zap.Error(err))
+		}
+		if cfg.Mail.TemplatesDir != "" {
+			if mailTemplates, err = mailer.ParseTemplates(os.DirFS(cfg.Mail.TemplatesDir)); err != nil {
+				logger.Fatal("Failed to load the mail templates", zap.Error(err))
+			}
+			for _, name := range []string{"verify_email", "reset_password", "admin_reset_password"} {
+				if !mailTemplates.Has(name) {
+					logger.Fatal("Mail template missing", zap.String("dir", cfg.Mail.TemplatesDir), zap.String("template", name))
+				}
+			}
+		}
+	}
+	if cfg.Auth.EmailVerification {
+		authHandlerOptions = append(authHandlerOptions, handlers.WithEmailVerification(handlers.EmailVerification{
+			Mailer:    mail,
+			URL:       cfg.Auth.VerificationURL,
+			Templates: mailTemplates,
+		}))
+		authMiddlewareOptions = append(authMiddlewareOptions, middleware.WithVerifiedEmail(
+			func(ctx context.Context, userID int) (bool, error) {
+				user, err := userService.Get(ctx, userID)
+				if errors.Is(err, models.ErrUserNotFound) {
+					return false, nil
+				}
+				return user.EmailVerified, err
+			}))
+	}
+	if cfg.Auth.PasswordReset.Enabled {
+		reset := handlers.PasswordReset{Mailer: mail, URL: cfg.Auth.PasswordReset.URL, Templates: mailTemplates}
+		authHandlerOptions = append(authHandlerOptions, handlers.WithPasswordReset(reset))
+		adminHandlerOptions = append(adminHandlerOptions, handlers.WithAdminPasswordReset(reset))
+	}
+	if cfg.Auth.TwoFactor.Enabled {
+		authHandlerOptions = append(authHandlerOptions, handlers.WithTwoFactor())
+	}
+	tasks := scheduler.New(logger)
+	// cleanupTask schedules a task deleting expired entries through prune
+	cleanupTask := func(name string, interval time.Duration, prune func(context.Context) (int, error)) {
+		if interval <= 0 {
+			return
+		}
+		tasks.Add(scheduler.Task{Name: name, Interval: interval, Jitter: cfg.Scheduler.Jitter, Run: func(ctx context.Context) error {
+			removed, err := prune(ctx)
+			if removed > 0 {
+				logger.Info("Deleted expired entries", zap.String("task", name), zap.Int("removed", removed))
+			}
+			return err
+		}})
+	}
+	cleanupTask("token cleanup", cfg.Scheduler.TokenCleanupInterval, authService.DeleteExpiredTokens)
+	cleanupTask("session expiry", cfg.Scheduler.SessionCleanupInterval, authService.DeleteExpiredSessions)
+	if auditStore != nil && cfg.Logging.AuditRetention > 0 {
+		cleanupTask("audit retention", cfg.Scheduler.AuditPruneInterval, func(ctx context.Context) (int, error) {
+			return auditStore.Prune(ctx, time.Now().Add(-cfg.Logging.AuditRetention))
+		})
+	}
+	lc.Append(lifecycle.Hook{Name: "scheduler", Start: tasks.Start, Stop: tasks.Stop, Timeout: cfg.Server.ShutdownTimeout})
+	authHandler := handlers.NewAuthHandler(authService, userService, logger, authHandlerOptions...)
+	adminHandler := handlers.NewAdminHandler(userService, authService, logger, adminHandlerOptions...)
+	if redisClient != nil {
+		addHealthCheck(handlers.NewPingChecker("redis", func(ctx context.Context) error {
+			return redisClient.Ping(ctx).Err()
+		}))
+	}
+	if cfg.Health.MaxGoroutines > 0 {
+		healthChecks = append(healthChecks, handlers.NewGoroutineChecker(cfg.Health.MaxGoroutines))
+	}
+	healthHandler := handlers.NewHealthHandler(logger, healthChecks...)
+	apiKeyHandler := handlers.NewAPIKeyHandler(apiKeys, logger)
+	webhookHandler := handlers.NewWebhookHandler(webhookService, logger)
+	eventStreamHandler := handlers.NewEventStreamHandler(eventFeed, logger)
+	graphqlHandler := handlers.NewGraphQLHandler(userHandler, authHandler)
+	var fileStore storage.Store
+	if cfg.Files.Enabled || cfg.Avatars.Enabled {
+		if fileStore, err = newFileStore(cfg.Files); err != nil {
+			logger.Fatal("Failed to set up file storage", zap.Error(err))
+		}
+	}
+	var fileHandler *handlers.FileHandler
+	if cfg.Files.Enabled {
+		secret := []byte(cfg.Files.SigningSecret)
+		if len(secret) == 0 {
+			logger.Warn("FILES_SIGNING_SECRET not set; download URLs stop working on restart")
+			secret = make([]byte, 32)
+			if _, err := rand.Read(secret); err != nil {
+				logger.Fatal("Failed to generate a URL signing key", zap.Error(err))
+			}
+		}
+		fileHandler = handlers.NewFileHandler(fileStore, storage.NewURLSigner(secret), logger,
+			handlers.WithFileLimits(int64(cfg.Files.MaxSize), cfg.Files.AllowedTypes),
+			handlers.WithURLTTL(cfg.Files.URLTTL))
+	}
+	var avatars *avatar.Service
+	var avatarHandler *handlers.AvatarHandler
+	if cfg.Avatars.Enabled {
+		avatars = avatar.NewService(fileStore, logger,
+			avatar.WithLimits(int64(cfg.Avatars.MaxSize), cfg.Avatars.MinSide, cfg.Avatars.MaxSide),
+			avatar.WithWorkers(cfg.Avatars.Workers))
+		avatarHandler = handlers.NewAvatarHandler(avatars, userService, logger)
+		lc.Append(lifecycle.Hook{Name: "avatar workers", Stop: avatars.Close, Timeout: cfg.Server.ShutdownTimeout})
+	}
 
 	// API routes
 	api := router.Group("/api/v1")
+	api.Use(middleware.AcceptRoutes(
+		[]string{"application/json", "text/csv", "application/x-ndjson", "text/event-stream"},
+		map[string][]string{"GET /api/v1/users/:id/avatar": {"image/png", "image/jpeg", "image/gif"}}))
+	api.Use(middleware.Experiments(experiments(cfg.Experiments)))
+	api.Use(middleware.FeatureFlags(featureFlags))
+	if sessionsCfg := cfg.Auth.Sessions; sessionsCfg.Enabled {
+		api.Use(middleware.CSRF(sessionsCfg.Name,
+			middleware.WithCSRFCookie(sessionsCfg.CSRFCookie, sessionsCfg.Domain, sessionsCfg.Secure)))
+	}
+	if cfg.Server.OpenAPIValidation {
+		var opts []middleware.OpenAPIOption
+		if cfg.Server.OpenAPIResponseValidation && gin.Mode() == gin.DebugMode {
+			opts = append(opts, middleware.WithResponseValidation(logger))
+		}
+		validate, err := middleware.OpenAPI([]byte(docs.SwaggerInfo.ReadDoc()), opts...)
+		if err != nil {
+			logger.Fatal("Failed to load the OpenAPI spec", zap.Error(err))
+		}
+		api.Use(validate)
+	}
 	{
 		// Public routes
 		api.GET("/health", healthHandler.HealthCheck)
-		api.POST("/auth/login", authHandler.Login)
-		api.POST("/auth/register", authHandler.Register)
+		authRoutes := api.Group("/auth")
+		limitGroup(authRoutes, "auth")
+		{
+			authRoutes.POST("/login", authHandler.Login)
+			authRoutes.POST("/register", authHandler.Register)
+			authRoutes.POST("/refresh", authHandler.Refresh)
+			authRoutes.POST("/logout", authHandler.Logout)
+			if cfg.Auth.EmailVerification {
+				authRoutes.GET("/verify", authHandler.VerifyEmail)
+			}
+			if reset := cfg.Auth.PasswordReset; reset.Enabled {
+				// Each request may mail an account, so it gets its own
+				// budget on top of the auth group's
+				authRoutes.POST("/forgot-password", middleware.RateLimit(rateLimitStore, reset.Limit.Requests, reset.Limit.Window,
+					append(rateLimitOptions, middleware.WithRateLimitScope("forgot-password"))...), authHandler.ForgotPassword)
+				authRoutes.POST("/reset-password", authHandler.ResetPassword)
+			}
+			if cfg.Auth.TwoFactor.Enabled {
+				// Enrollment needs a full session; verify takes the
+				// challenge token Login hands out instead
+				enroll := middleware.AuthRequired(authService, authMiddlewareOptions...)
+				authRoutes.POST("/2fa/setup", enroll, authHandler.SetupTwoFactor)
+				authRoutes.POST("/2fa/enable", enroll, authHandler.EnableTwoFactor)
+				authRoutes.POST("/2fa/verify", authHandler.VerifyTwoFactor)
+			}
+			if len(cfg.Auth.OIDC) > 0 {
+				authRoutes.GET("/oidc/login", authHandler.OIDCLogin)
+				authRoutes.GET("/oidc/callback", authHandler.OIDCCallback)
+			}
+		}
 
-		// User routes
+		// User routes: any authenticated user may read, writes need the
+		// permissions the admin role grants
+		requireAuth := middleware.AuthRequired(authService, authMiddlewareOptions...)
+		// Writes whose handlers do not audit themselves are audited by route
+		auditWrites := middleware.AuditWrites(auditLogger)
+		read := middleware.RequirePermission(models.PermUsersRead)
+		write := middleware.RequirePermission(models.PermUsersWrite)
 		users := api.Group("/users")
+		limitGroup(users, "users")
+		users.Use(middleware.QueryLimits(cfg.Users.MaxQueryParams, cfg.Users.MaxQueryLength))
+		users.Use(requireAuth, idempotent, auditWrites)
+		// Avatars are registered ahead of the response cache: their bytes
+		// are not worth caching and variants change without a purge
+		if avatarHandler != nil {
+			users.PUT("/:id/avatar", avatarHandler.UploadAvatar)
+			users.GET("/:id/avatar", read, avatarHandler.GetAvatar)
+		}
+		if responseCache != nil {
+			users.Use(middleware.Cache(cfg.Cache.TTL, middleware.WithCacheStore(responseCache),
+				middleware.WithCacheMetrics(metricsRegistry), middleware.WithCacheLogger(logger)))
+		}
 		{
-			users.GET("", userHandler.GetUsers)
-			users.POST("", userHandler.CreateUser)
-			users.GET("/:id", userHandler.GetUser)
-			users.PUT("/:id", userHandler.UpdateUser)
-			users.DELETE("/:id", userHandler.DeleteUser)
+			users.GET("", read, userHandler.GetUsers)
+			users.POST("", write, userHandler.CreateUser)
+			users.POST("/batch", write, userHandler.BatchCreateUsers)
+			users.POST("/bulk", write, userHandler.BulkUsers)
+			users.POST("/roles", write, userHandler.AssignRoles)
+			users.GET("/:id", read, userHandler.GetUser)
+			users.PUT("/:id", write, userHandler.UpdateUser)
+			users.PATCH("/:id", write, userHandler.UpdateUser)
+			users.DELETE("/:id", middleware.RequirePermission(models.PermUsersDelete), userHandler.DeleteUser)
+			users.POST("/:id/merge", write, userHandler.MergeUser)
+			users.POST("/:id/revoke-tokens", middleware.RequirePermission(models.PermTokensRevoke), userHandler.RevokeTokens)
 		}
 
-		// Protected routes
+		// Served at handlers.EventStreamPath, which has no request timeout
+		api.GET("/events/stream", requireAuth, eventStreamHandler.StreamEvents)
+		api.GET("/ws", requireAuth, wsHub.Handle)
+
+		// GraphQL reads the same bearer token, but lets anonymous callers
+		// through for login; resolvers check the permissions the REST
+		// routes would require
+		graphqlRoutes := api.Group("/graphql")
+		limitGroup(graphqlRoutes, "graphql")
+		graphqlRoutes.POST("", middleware.AuthRequired(authService, append(authMiddlewareOptions, middleware.AllowAnonymous())...), idempotent, graphqlHandler.GraphQL)
+		if gin.Mode() == gin.DebugMode {
+			graphqlRoutes.GET("", graphqlHandler.Playground)
+		}
+
+		// Protected routes also accept an X-API-Key header for machine callers
 		protected := api.Group("/protected")
-		protected.Use(middleware.AuthRequired(authService))
+		protected.Use(middleware.AuthRequired(authService, append(authMiddlewareOptions, middleware.WithAPIKeys(
+			func(ctx context.Context, plaintext string) (*auth.Claims, error) {
+				key, err := apiKeys.Authenticate(ctx, plaintext)
+				if err != nil {
+					return nil, err
+				}
+				user, err := userService.Get(ctx, key.UserID)
+				if err != nil {
+					return nil, err
+				}
+				return &auth.Claims{UserID: user.ID, Email: user.Email, Role: user.Role}, nil
+			}))...), idempotent, auditWrites)
 		{
 			protected.GET("/profile", authHandler.GetProfile)
+			protected.GET("/sessions", authHandler.ListSessions)
+			protected.DELETE("/sessions/:id", authHandler.RevokeSession)
+			// A leaked key must not be able to mint more keys
+			keys := protected.Group("/api-keys", middleware.DenyAPIKeys())
+			keys.GET("", apiKeyHandler.ListAPIKeys)
+			keys.POST("", apiKeyHandler.CreateAPIKey)
+			keys.DELETE("/:key_id", apiKeyHandler.RevokeAPIKey)
+			hooks := protected.Group("/webhooks", middleware.RequirePermission(models.PermWebhooks))
+			hooks.GET("", webhookHandler.ListWebhooks)
+			hooks.POST("", webhookHandler.CreateWebhook)
+			hooks.GET("/deliveries", webhookHandler.ListWebhookDeliveries)
+			hooks.DELETE("/:webhook_id", webhookHandler.DeleteWebhook)
+			if fileHandler != nil {
+				protected.POST("/files", middleware.MultipartMemory(int64(cfg.Server.MultipartMemory)), fileHandler.UploadFile)
+				protected.GET("/files/:id", fileHandler.GetFile)
+				protected.DELETE("/files/:id", fileHandler.DeleteFile)
+			}
+		}
+
+		// Admin routes: the group admits the admin role only, and each
+		// route still checks the permission its action needs
+		admin := api.Group("/admin")
+		limitGroup(admin, "admin")
+		admin.Use(requireAuth, middleware.RequireRole(models.RoleAdmin), idempotent, auditWrites)
+		{
+			lock := middleware.RequirePermission(models.PermUsersLock)
+			admin.GET("/users", read, adminHandler.SearchUsers)
+			admin.GET("/users/export", middleware.RequirePermission(models.PermUsersExport), userHandler.ExportUsers)
+			admin.POST("/users/:id/lock", lock, adminHandler.LockUser)
+			admin.POST("/users/:id/unlock", lock, adminHandler.UnlockUser)
+			if cfg.Auth.PasswordReset.Enabled {
+				admin.POST("/users/:id/password-reset", write, adminHandler.ForcePasswordReset)
+			}
+			logs := middleware.RequirePermission(models.PermLogsManage)
+			admin.GET("/loglevel", logs, adminHandler.GetLogLevel)
+			admin.PUT("/loglevel", logs, adminHandler.SetLogLevel)
+			flagsManage := middleware.RequirePermission(models.PermFlagsManage)
+			admin.GET("/flags", flagsManage, adminHandler.ListFlags)
+			admin.PUT("/flags/:name", flagsManage, adminHandler.SetFlag)
+			admin.DELETE("/flags/:name", flagsManage, adminHandler.DeleteFlag)
+			if auditStore != nil {
+				admin.GET("/audit", middleware.RequirePermission(models.PermAuditRead), adminHandler.GetAuditLog)
+			}
+		}
+	}
+
+	// Probe routes for orchestrators (/livez, /healthz, /readyz by default)
+	handlers.RegisterHealthRoutes(router, healthHandler, handlers.HealthPaths{
+		Liveness:  cfg.Health.LivenessPaths,
+		Readiness: cfg.Health.ReadinessPaths,
+	})
+
+	// Signed file downloads carry their own authorization and may be
+	// fetched by browsers sending any Accept header
+	if fileHandler != nil {
+		router.GET(handlers.FileDownloadPath+"/:owner/:id", fileHandler.DownloadFile)
+	}
+
+	// Metrics endpoint (Prometheus text or OpenMetrics via Accept)
+	router.GET("/metrics", gin.WrapH(metrics.Handler(metricsRegistry)))
+
+	// API docs: open in debug mode, behind the SWAGGER_AUTH credentials in
+	// release mode and not served at all without them
+	if cfg.Server.Swagger {
+		switch {
+		case gin.Mode() == gin.DebugMode:
+			handlers.RegisterDocsRoutes(router)
+		case cfg.Server.SwaggerAuth != "":
+			user, password, _ := strings.Cut(cfg.Server.SwaggerAuth, ":")
+			handlers.RegisterDocsRoutes(router, gin.BasicAuthForRealm(gin.Accounts{user: password}, "API docs"))
+		default:
+			logger.Warn("API docs are not served in release mode without SWAGGER_AUTH")
 		}
 	}
 
@@ -98,30 +814,201 @@ func main() {
 		c.JSON(http.StatusOK, gin.H{
 			"message": "Welcome to Template2 Go Example API",
 			"docs":    "/swagger/index.html",
+			"openapi": handlers.OpenAPIPath,
 			"health":  "/api/v1/health",
-			"version": "1.0.0",
+			"version": handlers.Version,
 		})
 	})
 
 	// Setup server
 	srv := &http.Server{
-		Addr:         ":8080",
+		Addr:         cfg.Server.Addr,
 		Handler:      router,
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
-		IdleTimeout:  60 * time.Second,
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
+		IdleTimeout:  cfg.Server.IdleTimeout,
 	}
+	srv.SetKeepAlivesEnabled(cfg.Server.KeepAlives)
+	// Event streams never finish on their own, so end them when draining
+	// starts rather than waiting them out
+	srv.RegisterOnShutdown(eventStreamHandler.Close)
 
-	// Start server in a goroutine
-	go func() {
-		logger.Info("🚀 Server starting on port 8080")
-		logger.Info("📚 Environment: " + gin.Mode())
-		logger.Info("🏥 Health check: http://localhost:8080/api/v1/health")
-		
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			logger.Fatal("Failed to start server", zap.Error(err))
+	if cfg.GRPC.Enabled {
+		grpcOptions := []grpcserver.Option{
+			grpcserver.WithRegisterer(metricsRegistry),
+			grpcserver.WithSessionDenylist(authService.SessionRevoked),
+			grpcserver.WithAuditLogger(auditLogger),
 		}
-	}()
+		if responseCache != nil {
+			grpcOptions = append(grpcOptions, grpcserver.WithCacheInvalidator(responseCache))
+		}
+		if cfg.Auth.TwoFactor.Enabled {
+			grpcOptions = append(grpcOptions, grpcserver.WithTwoFactor())
+		}
+		grpcSrv := grpcserver.New(userService, authService, logger, grpcOptions...)
+		lc.Append(lifecycle.Hook{
+			Name: "grpc server",
+			Start: func(context.Context) error {
+				ln, err := net.Listen("tcp", cfg.GRPC.Addr)
+				if err != nil {
+					return err
+				}
+				go func() {
+					if err := grpcSrv.Serve(ln); err != nil {
+						logger.Fatal("gRPC server failed", zap.Error(err))
+					}
+				}()
+				logger.Info("gRPC server listening on " + cfg.GRPC.Addr)
+				return nil
+			},
+			// Let calls in flight finish, cutting them off when the
+			// timeout runs out
+			Stop: func(ctx context.Context) error {
+				stopped := make(chan struct{})
+				go func() {
+					grpcSrv.GracefulStop()
+					close(stopped)
+				}()
+				select {
+				case <-stopped:
+					return nil
+				case <-ctx.Done():
+					grpcSrv.Stop()
+					return ctx.Err()
+				}
+			},
+			Timeout: cfg.Server.ShutdownTimeout,
+		})
+
+		if cfg.GRPC.Gateway {
+			// The gateway calls the gRPC server over the loopback, so calls
+			// through it go through the same interceptors as any other.
+			// Dialing connects lazily, once the server above is up.
+			conn, err := grpc.Dial(cfg.GRPC.Addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+			if err != nil {
+				logger.Fatal("Failed to dial the gRPC server", zap.Error(err))
+			}
+			var gatewayOptions []gateway.Option
+			if cfg.GRPC.GatewayCompat {
+				gatewayOptions = append(gatewayOptions, gateway.WithCompatPaths())
+			}
+			gatewayHandler, err := gateway.New(conn, gatewayOptions...)
+			if err != nil {
+				logger.Fatal("Failed to create the gRPC gateway", zap.Error(err))
+			}
+			gatewaySrv := &http.Server{
+				Addr:         cfg.GRPC.GatewayAddr,
+				Handler:      gatewayHandler,
+				ReadTimeout:  cfg.Server.ReadTimeout,
+				WriteTimeout: cfg.Server.WriteTimeout,
+				IdleTimeout:  cfg.Server.IdleTimeout,
+			}
+			lc.Append(lifecycle.Hook{
+				Name: "grpc gateway",
+				Start: func(context.Context) error {
+					ln, err := net.Listen("tcp", gatewaySrv.Addr)
+					if err != nil {
+						return err
+					}
+					go func() {
+						if err := gatewaySrv.Serve(ln); err != nil && err != http.ErrServerClosed {
+							logger.Fatal("gRPC gateway failed", zap.Error(err))
+						}
+					}()
+					logger.Info("gRPC gateway listening on " + gatewaySrv.Addr)
+					return nil
+				},
+				Stop: func(ctx context.Context) error {
+					err := gatewaySrv.Shutdown(ctx)
+					conn.Close()
+					return err
+				},
+				Timeout: cfg.Server.ShutdownTimeout,
+			})
+		}
+	}
+
+	// With TLS the server speaks HTTPS only; plain HTTP clients are sent
+	// over by the redirect listener, which also answers ACME challenges
+	var autocertManager *autocert.Manager
+	if len(cfg.TLS.AutocertDomains) > 0 {
+		autocertManager = server.NewAutocert(cfg.TLS.AutocertDomains, cfg.TLS.AutocertCacheDir, cfg.TLS.AutocertEmail)
+	}
+	if cfg.TLS.Enabled() {
+		srv.TLSConfig = server.TLSConfig(autocertManager)
+		if cfg.TLS.ClientCAFile != "" {
+			if err := server.RequireClientCerts(srv.TLSConfig, cfg.TLS.ClientCAFile, cfg.TLS.ClientAuth == "optional"); err != nil {
+				logger.Fatal("Failed to load client CAs", zap.Error(err))
+			}
+		}
+	}
+	if cfg.TLS.RedirectAddr != "" {
+		var redirect http.Handler = server.RedirectHTTPS(srv.Addr)
+		if autocertManager != nil {
+			redirect = autocertManager.HTTPHandler(redirect)
+		}
+		redirectSrv := &http.Server{
+			Addr:         cfg.TLS.RedirectAddr,
+			Handler:      redirect,
+			ReadTimeout:  cfg.Server.ReadTimeout,
+			WriteTimeout: cfg.Server.WriteTimeout,
+			IdleTimeout:  cfg.Server.IdleTimeout,
+		}
+		lc.Append(lifecycle.Hook{
+			Name: "https redirect",
+			Start: func(context.Context) error {
+				ln, err := net.Listen("tcp", redirectSrv.Addr)
+				if err != nil {
+					return err
+				}
+				go func() {
+					if err := redirectSrv.Serve(ln); err != nil && err != http.ErrServerClosed {
+						logger.Fatal("HTTPS redirect failed", zap.Error(err))
+					}
+				}()
+				logger.Info("Redirecting HTTP on " + redirectSrv.Addr + " to HTTPS")
+				return nil
+			},
+			Stop:    redirectSrv.Shutdown,
+			Timeout: cfg.Server.ShutdownTimeout,
+		})
+	}
+
+	// The server is started last and so drains first, while everything its
+	// requests use is still up. Binding the port happens in Start, so a
+	// taken address stops the components started before it.
+	lc.Append(lifecycle.Hook{
+		Name: "http server",
+		Start: func(context.Context) error {
+			ln, err := net.Listen("tcp", srv.Addr)
+			if err != nil {
+				return err
+			}
+			go func() {
+				var err error
+				if cfg.TLS.Enabled() {
+					// Without files the certificates come from TLSConfig
+					err = srv.ServeTLS(server.NewListener(ln, logger), cfg.TLS.CertFile, cfg.TLS.KeyFile)
+				} else {
+					err = srv.Serve(server.NewListener(ln, logger))
+				}
+				if err != nil && err != http.ErrServerClosed {
+					logger.Fatal("Server failed", zap.Error(err))
+				}
+			}()
+			return nil
+		},
+		// Give outstanding requests time to complete
+		Stop:    func(ctx context.Context) error { return server.Drain(ctx, srv) },
+		Timeout: cfg.Server.ShutdownTimeout,
+	})
+
+	logger.Info("🚀 Server starting on "+srv.Addr, zap.Bool("tls", cfg.TLS.Enabled()))
+	logger.Info("📚 Environment: "+cfg.Env, zap.String("gin_mode", gin.Mode()))
+	logger.Info("🏥 Health check: /api/v1/health")
+	if err := lc.Start(context.Background()); err != nil {
+		logger.Fatal("Failed to start server", zap.Error(err))
+	}
 
 	// Wait for interrupt signal to gracefully shutdown the server
 	quit := make(chan os.Signal, 1)
@@ -129,33 +1016,91 @@ func main() {
 	<-quit
 	logger.Info("Shutting down server...")
 
-	// Give outstanding requests 5 seconds to complete
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	if err := srv.Shutdown(ctx); err != nil {
-		logger.Fatal("Server forced to shutdown", zap.Error(err))
+	if err := lc.Stop(context.Background()); err != nil {
+		logger.Error("Shutdown did not complete cleanly", zap.Error(err))
 	}
 
 	logger.Info("Server exited")
 }
 
-func initLogger() *zap.Logger {
-	config := zap.NewProductionConfig()
-	config.Level = zap.NewAtomicLevelAt(zap.InfoLevel)
-	config.EncoderConfig.TimeKey = "timestamp"
-	config.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
-	config.EncoderConfig.StacktraceKey = ""
+func experiments(configs []config.ExperimentConfig) []middleware.Experiment {
+	experiments := make([]middleware.Experiment, 0, len(configs))
+	for _, cfg := range configs {
+		exp := middleware.Experiment{Name: cfg.Name}
+		for _, variant := range cfg.Variants {
+			exp.Variants = append(exp.Variants, middleware.Variant{Name: variant.Name, Percent: variant.Percent})
+		}
+		experiments = append(experiments, exp)
+	}
+	return experiments
+}
+
+// oidcProviders builds the configured identity providers, running OIDC
+// discovery for every issuer
+func oidcProviders(configs []config.OIDCProviderConfig) ([]*auth.Provider, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 
-	if gin.Mode() == gin.DebugMode {
-		config = zap.NewDevelopmentConfig()
-		config.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
+	providers := make([]*auth.Provider, 0, len(configs))
+	for _, cfg := range configs {
+		providerConfig := auth.ProviderConfig{
+			Name:         cfg.Name,
+			Issuer:       cfg.Issuer,
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+		}
+		if cfg.Name == "github" && cfg.Issuer == "" {
+			providers = append(providers, auth.NewGitHubProvider(providerConfig, "https://api.github.com"))
+			continue
+		}
+		if cfg.Name == "google" && cfg.Issuer == "" {
+			providerConfig.Issuer = auth.GoogleIssuer
+		}
+		provider, err := auth.NewOIDCProvider(ctx, providerConfig)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, provider)
 	}
+	return providers, nil
+}
 
-	logger, err := config.Build()
-	if err != nil {
-		log.Fatal("Failed to initialize logger:", err)
+// newMailer returns an SMTP mailer for the configured relay, or one that
+// only logs messages when no relay is set
+func newMailer(cfg config.MailConfig, logger *zap.Logger) (mailer.Mailer, error) {
+	if cfg.APIURL != "" {
+		return mailer.NewHTTPMailer(cfg.APIURL, cfg.APIKey, cfg.From, &http.Client{Timeout: 30 * time.Second})
+	}
+	if cfg.SMTPAddr == "" {
+		logger.Warn("Neither SMTP_ADDR nor MAIL_API_URL set; emails are logged instead of sent")
+		return mailer.NewLogMailer(logger), nil
+	}
+	var opts []mailer.SMTPOption
+	if cfg.Username != "" {
+		opts = append(opts, mailer.WithSMTPAuth(cfg.Username, cfg.Password))
 	}
+	return mailer.NewSMTPMailer(cfg.SMTPAddr, cfg.From, opts...)
+}
 
-	return logger
-}
\ No newline at end of file
+// newBrokerPublisher returns the publisher for the configured message broker
+func newBrokerPublisher(cfg config.BrokerConfig) (broker.Publisher, error) {
+	if cfg.Backend == "kafka" {
+		return broker.NewKafkaPublisher(strings.Split(cfg.URL, ","), cfg.Timeout)
+	}
+	return broker.NewNATSPublisher(cfg.URL, cfg.Timeout)
+}
+
+// newFileStore returns the object store uploads are kept in
+func newFileStore(cfg config.FilesConfig) (storage.Store, error) {
+	if cfg.Backend == "s3" {
+		return storage.NewS3Store(storage.S3Config{
+			Endpoint:        cfg.S3.Endpoint,
+			Region:          cfg.S3.Region,
+			Bucket:          cfg.S3.Bucket,
+			AccessKeyID:     cfg.S3.AccessKeyID,
+			SecretAccessKey: cfg.S3.SecretAccessKey,
+		}, &http.Client{Timeout: time.Minute})
+	}
+	return storage.NewLocalStore(cfg.Dir)
+}
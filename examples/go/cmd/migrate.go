@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cbwinslow/template2/examples/go/internal/models/postgres"
+	"github.com/cbwinslow/template2/examples/go/pkg/config"
+)
+
+const migrateUsage = "usage: api migrate up|down|status [flags]"
+
+// runMigrate implements the "migrate" subcommand: up applies pending
+// migrations, down rolls back the latest one and status lists them. The
+// flags after the command are the server's, so the same config file and
+// environment select the database.
+func runMigrate(args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+	command := args[0]
+
+	cfg, err := config.Load(args[1:])
+	if err != nil {
+		return err
+	}
+	if cfg.Database.Backend != "postgres" {
+		return errors.New("migrate: USER_STORE_BACKEND must be postgres")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	db, err := postgres.Open(ctx, cfg.Database.URL, postgres.PoolConfig{MaxOpenConns: 1})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	migrator, err := postgres.NewMigrator(db)
+	if err != nil {
+		return err
+	}
+
+	switch command {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Applied %d migration(s)\n", applied)
+	case "down":
+		if err := migrator.Down(ctx); err != nil {
+			return err
+		}
+		fmt.Fprintln(out, "Rolled back 1 migration")
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.Applied {
+				appliedAt = status.AppliedAt.UTC().Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+		}
+		return w.Flush()
+	default:
+		return fmt.Errorf("migrate: unknown command %q; %s", command, migrateUsage)
+	}
+	return nil
+}
@@ -0,0 +1,266 @@
+// Package avatar stores user avatars and renders their resized variants in
+// the background
+package avatar
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // registers the GIF decoder
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"strconv"
+	"sync"
+
+	"go.uber.org/zap"
+
+	"github.com/cbwinslow/template2/examples/go/pkg/storage"
+)
+
+// Original names the avatar as uploaded
+const Original = "original"
+
+var (
+	// ErrTooLarge is returned for uploads over the size limit
+	ErrTooLarge = errors.New("avatar: image is too large")
+	// ErrUnsupportedFormat is returned for uploads that are not a JPEG, PNG
+	// or GIF image
+	ErrUnsupportedFormat = errors.New("avatar: unsupported image format")
+	// ErrUnknownVariant is returned when asking for a size that is not
+	// rendered
+	ErrUnknownVariant = errors.New("avatar: unknown size")
+	// ErrNotFound is returned for users without an avatar
+	ErrNotFound = errors.New("avatar: not found")
+)
+
+// DimensionError reports an image whose width or height is outside the
+// allowed range
+type DimensionError struct {
+	Width, Height int
+	Min, Max      int
+}
+
+func (e *DimensionError) Error() string {
+	return fmt.Sprintf("avatar: image is %dx%d; sides must be between %d and %d pixels", e.Width, e.Height, e.Min, e.Max)
+}
+
+// Variant is a square rendering of an avatar Size pixels a side
+type Variant struct {
+	Name string
+	Size int
+}
+
+// DefaultVariants are rendered for every avatar unless WithVariants says
+// otherwise
+var DefaultVariants = []Variant{{Name: "thumbnail", Size: 64}, {Name: "medium", Size: 256}}
+
+// lockStripes serializes the rendering of one user's avatar, so a render of
+// a replaced upload always finishes before that of its successor starts
+const lockStripes = 64
+
+// Service stores avatars and renders their variants on a pool of workers
+type Service struct {
+	store    storage.Store
+	logger   *zap.Logger
+	variants []Variant
+	maxBytes int64
+	minSide  int
+	maxSide  int
+	workers  int
+
+	queue chan int
+	wg    sync.WaitGroup
+	locks [lockStripes]sync.Mutex
+}
+
+// Option configures a Service
+type Option func(*Service)
+
+// WithVariants sets the sizes rendered for every avatar
+func WithVariants(variants ...Variant) Option {
+	return func(s *Service) {
+		s.variants = variants
+	}
+}
+
+// WithLimits sets the largest upload accepted in bytes and the range its
+// sides must fall in, in pixels
+func WithLimits(maxBytes int64, minSide, maxSide int) Option {
+	return func(s *Service) {
+		s.maxBytes = maxBytes
+		s.minSide = minSide
+		s.maxSide = maxSide
+	}
+}
+
+// WithWorkers sets how many avatars are rendered at once
+func WithWorkers(n int) Option {
+	return func(s *Service) {
+		s.workers = n
+	}
+}
+
+// NewService creates a service keeping avatars in store and starts its
+// workers; Close stops them
+func NewService(store storage.Store, logger *zap.Logger, opts ...Option) *Service {
+	s := &Service{
+		store:    store,
+		logger:   logger,
+		variants: DefaultVariants,
+		maxBytes: 5 << 20,
+		minSide:  32,
+		maxSide:  4096,
+		workers:  2,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	s.queue = make(chan int, 100)
+	for i := 0; i < s.workers; i++ {
+		s.wg.Add(1)
+		go s.work()
+	}
+	return s
+}
+
+// Sizes names the sizes Open serves, the original first
+func (s *Service) Sizes() []string {
+	sizes := []string{Original}
+	for _, v := range s.variants {
+		sizes = append(sizes, v.Name)
+	}
+	return sizes
+}
+
+// Upload validates the image read from r and stores it as the user's
+// avatar, replacing any earlier one, then queues its variants for
+// rendering. Only the header is decoded here, so an image with huge
+// dimensions is rejected before its pixels are allocated.
+func (s *Service) Upload(ctx context.Context, userID int, r io.Reader) error {
+	data, err := io.ReadAll(io.LimitReader(r, s.maxBytes+1))
+	if err != nil {
+		return err
+	}
+	if int64(len(data)) > s.maxBytes {
+		return ErrTooLarge
+	}
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return ErrUnsupportedFormat
+	}
+	if cfg.Width < s.minSide || cfg.Height < s.minSide || cfg.Width > s.maxSide || cfg.Height > s.maxSide {
+		return &DimensionError{Width: cfg.Width, Height: cfg.Height, Min: s.minSide, Max: s.maxSide}
+	}
+
+	// Variants of the previous avatar must not be served for the new one
+	for _, v := range s.variants {
+		if err := s.store.Delete(ctx, key(userID, v.Name)); err != nil {
+			return err
+		}
+	}
+	if err := s.store.Put(ctx, key(userID, Original), bytes.NewReader(data), int64(len(data)), "image/"+format); err != nil {
+		return err
+	}
+
+	select {
+	case s.queue <- userID:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Open returns the user's avatar in the named size and a reader over it,
+// which the caller must close. Until a variant has been rendered the
+// original is served in its place.
+func (s *Service) Open(ctx context.Context, userID int, size string) (io.ReadSeekCloser, storage.Object, error) {
+	if size != Original && !s.hasVariant(size) {
+		return nil, storage.Object{}, ErrUnknownVariant
+	}
+	r, obj, err := s.store.Open(ctx, key(userID, size))
+	if errors.Is(err, storage.ErrNotFound) && size != Original {
+		r, obj, err = s.store.Open(ctx, key(userID, Original))
+	}
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, storage.Object{}, ErrNotFound
+	}
+	return r, obj, err
+}
+
+// Close stops accepting work and waits until the queued avatars have been
+// rendered or ctx is done. Upload must not be called after Close.
+func (s *Service) Close(ctx context.Context) error {
+	close(s.queue)
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *Service) hasVariant(name string) bool {
+	for _, v := range s.variants {
+		if v.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Service) work() {
+	defer s.wg.Done()
+	for userID := range s.queue {
+		if err := s.render(context.Background(), userID); err != nil {
+			s.logger.Error("Failed to render avatar variants", zap.Int("user_id", userID), zap.Error(err))
+		}
+	}
+}
+
+// render writes every variant of the user's current original. It reads the
+// original itself rather than taking the uploaded bytes, so a render
+// queued for a replaced upload produces the variants of its replacement.
+func (s *Service) render(ctx context.Context, userID int) error {
+	lock := &s.locks[userID%lockStripes]
+	lock.Lock()
+	defer lock.Unlock()
+
+	r, _, err := s.store.Open(ctx, key(userID, Original))
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	img, _, err := image.Decode(r)
+	r.Close()
+	if err != nil {
+		return err
+	}
+
+	for _, v := range s.variants {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, Resize(img, v.Size)); err != nil {
+			return err
+		}
+		if err := s.store.Put(ctx, key(userID, v.Name), &buf, int64(buf.Len()), "image/png"); err != nil {
+			return err
+		}
+	}
+	s.logger.Debug("Avatar variants rendered", zap.Int("user_id", userID))
+	return nil
+}
+
+// key is the storage key of the user's avatar in the named size
+func key(userID int, size string) string {
+	return "avatars/" + strconv.Itoa(userID) + "/" + size
+}
@@ -0,0 +1,143 @@
+package avatar
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/cbwinslow/template2/examples/go/pkg/storage"
+)
+
+func encodePNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func newService(t *testing.T, opts ...Option) (*Service, storage.Store) {
+	t.Helper()
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocalStore: %v", err)
+	}
+	return NewService(store, zap.NewNop(), opts...), store
+}
+
+func TestUploadRendersVariants(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newService(t)
+
+	if err := svc.Upload(ctx, 7, bytes.NewReader(encodePNG(t, 400, 300))); err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+	if err := svc.Close(ctx); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	for _, v := range DefaultVariants {
+		r, obj, err := svc.Open(ctx, 7, v.Name)
+		if err != nil {
+			t.Fatalf("Open(%s): %v", v.Name, err)
+		}
+		img, err := png.Decode(r)
+		r.Close()
+		if err != nil || obj.ContentType != "image/png" {
+			t.Fatalf("%s: content type %q, decode error %v", v.Name, obj.ContentType, err)
+		}
+		if b := img.Bounds(); b.Dx() != v.Size || b.Dy() != v.Size {
+			t.Errorf("%s is %dx%d, want %d square", v.Name, b.Dx(), b.Dy(), v.Size)
+		}
+	}
+}
+
+func TestOpenFallsBackToOriginalUntilRendered(t *testing.T) {
+	ctx := context.Background()
+	// No workers, so variants are never rendered
+	svc, _ := newService(t, WithWorkers(0))
+	original := encodePNG(t, 100, 100)
+	svc.Upload(ctx, 7, bytes.NewReader(original))
+
+	r, _, err := svc.Open(ctx, 7, "thumbnail")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer r.Close()
+	if got, _ := io.ReadAll(r); !bytes.Equal(got, original) {
+		t.Error("thumbnail before rendering is not the original")
+	}
+
+	if _, _, err := svc.Open(ctx, 7, "huge"); !errors.Is(err, ErrUnknownVariant) {
+		t.Errorf("unknown size: err = %v, want ErrUnknownVariant", err)
+	}
+	if _, _, err := svc.Open(ctx, 8, Original); !errors.Is(err, ErrNotFound) {
+		t.Errorf("no avatar: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestUploadValidatesImage(t *testing.T) {
+	ctx := context.Background()
+	svc, store := newService(t, WithLimits(1<<20, 32, 512), WithWorkers(0))
+
+	var dimErr *DimensionError
+	if err := svc.Upload(ctx, 7, bytes.NewReader(encodePNG(t, 16, 64))); !errors.As(err, &dimErr) || dimErr.Width != 16 {
+		t.Errorf("too narrow: err = %v, want a DimensionError", err)
+	}
+	if err := svc.Upload(ctx, 7, bytes.NewReader(encodePNG(t, 600, 64))); !errors.As(err, &dimErr) {
+		t.Errorf("too wide: err = %v, want a DimensionError", err)
+	}
+	if err := svc.Upload(ctx, 7, strings.NewReader("<svg/>")); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("svg: err = %v, want ErrUnsupportedFormat", err)
+	}
+	if err := svc.Upload(ctx, 7, bytes.NewReader(make([]byte, 1<<20+1))); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("oversized: err = %v, want ErrTooLarge", err)
+	}
+	if _, err := store.Stat(ctx, key(7, Original)); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("rejected upload was stored: err = %v", err)
+	}
+}
+
+func TestResizeAveragesAndCrops(t *testing.T) {
+	// Left half black, right half white, with a red border that the
+	// square crop removes
+	src := image.NewRGBA(image.Rect(0, 0, 6, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 6; x++ {
+			c := color.RGBA{255, 0, 0, 255}
+			if x >= 1 && x < 3 {
+				c = color.RGBA{0, 0, 0, 255}
+			} else if x >= 3 && x < 5 {
+				c = color.RGBA{255, 255, 255, 255}
+			}
+			src.Set(x, y, c)
+		}
+	}
+
+	dst := Resize(src, 2)
+	if dst.Bounds().Dx() != 2 || dst.Bounds().Dy() != 2 {
+		t.Fatalf("bounds = %v", dst.Bounds())
+	}
+	if got := dst.RGBAAt(0, 0); got != (color.RGBA{0, 0, 0, 255}) {
+		t.Errorf("left = %v, want black", got)
+	}
+	if got := dst.RGBAAt(1, 1); got != (color.RGBA{255, 255, 255, 255}) {
+		t.Errorf("right = %v, want white", got)
+	}
+	if b := Resize(src, 64).Bounds(); b.Dx() != 4 {
+		t.Errorf("small image was enlarged to %v", b)
+	}
+}
@@ -0,0 +1,43 @@
+package avatar
+
+import (
+	"image"
+	"image/draw"
+)
+
+// Resize crops img to a centered square and scales it down to size pixels a
+// side, averaging the source pixels each target pixel covers. Images
+// smaller than size are cropped but not enlarged.
+func Resize(img image.Image, size int) *image.RGBA {
+	b := img.Bounds()
+	side := min(b.Dx(), b.Dy())
+	offset := image.Pt(b.Min.X+(b.Dx()-side)/2, b.Min.Y+(b.Dy()-side)/2)
+	src := image.NewRGBA(image.Rect(0, 0, side, side))
+	draw.Draw(src, src.Bounds(), img, offset, draw.Src)
+	if size >= side {
+		return src
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		y0, y1 := y*side/size, (y+1)*side/size
+		for x := 0; x < size; x++ {
+			x0, x1 := x*side/size, (x+1)*side/size
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					for i, v := range row[sx*4 : sx*4+4] {
+						sum[i] += int(v)
+					}
+				}
+			}
+			n := (y1 - y0) * (x1 - x0)
+			pixel := dst.Pix[y*dst.Stride+x*4:]
+			for i, v := range sum {
+				pixel[i] = uint8(v / n)
+			}
+		}
+	}
+	return dst
+}
@@ -0,0 +1,229 @@
+// Package gateway serves the gRPC API as JSON over HTTP with grpc-gateway,
+// at the google.api.http bindings declared in proto/. The REST surface is
+// generated from the same definitions as the gRPC one, and answers in the
+// shapes of the HTTP API: JSON field names as in the protos, 201 and 204
+// where the HTTP API answers with them, and RFC 7807 problem details
+// carrying the same error codes for failed calls.
+package gateway
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/textproto"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/cbwinslow/template2/examples/go/internal/middleware"
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+	"github.com/cbwinslow/template2/examples/go/pkg/apierror"
+	template2v1 "github.com/cbwinslow/template2/examples/go/pkg/pb/template2/v1"
+)
+
+// requestIDMetadata is the call metadata grpcserver reads and answers
+// request IDs in
+const requestIDMetadata = "x-request-id"
+
+// compatPrefix is the prefix of the HTTP API's paths, which are those of
+// the bindings in proto/ under /api
+const compatPrefix = "/api"
+
+type options struct {
+	compat bool
+}
+
+// Option configures the gateway
+type Option func(*options)
+
+// WithCompatPaths also serves every binding under /api, at the paths of the
+// HTTP API, so that its clients can be pointed at the gateway unchanged
+func WithCompatPaths() Option {
+	return func(o *options) {
+		o.compat = true
+	}
+}
+
+// New returns a handler serving UserService and AuthService by calling them
+// over conn
+func New(conn *grpc.ClientConn, opts ...Option) (http.Handler, error) {
+	o := options{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	mux := runtime.NewServeMux(
+		runtime.WithMarshalerOption(runtime.MIMEWildcard, &runtime.JSONPb{
+			MarshalOptions:   protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true},
+			UnmarshalOptions: protojson.UnmarshalOptions{DiscardUnknown: true},
+		}),
+		runtime.WithIncomingHeaderMatcher(incomingHeader),
+		runtime.WithOutgoingHeaderMatcher(outgoingHeader),
+		runtime.WithForwardResponseOption(responseStatus),
+		runtime.WithErrorHandler(writeError),
+		runtime.WithRoutingErrorHandler(routingError),
+	)
+	ctx := context.Background()
+	if err := template2v1.RegisterUserServiceHandler(ctx, mux, conn); err != nil {
+		return nil, err
+	}
+	if err := template2v1.RegisterAuthServiceHandler(ctx, mux, conn); err != nil {
+		return nil, err
+	}
+	var handler http.Handler = mux
+	if o.compat {
+		paths := http.NewServeMux()
+		paths.Handle("/", mux)
+		paths.Handle(compatPrefix+"/", http.StripPrefix(compatPrefix, mux))
+		handler = paths
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(&bodylessWriter{ResponseWriter: w}, r)
+	}), nil
+}
+
+// incomingHeader forwards the request ID header besides the headers
+// grpc-gateway forwards by default, such as Authorization
+func incomingHeader(key string) (string, bool) {
+	if textproto.CanonicalMIMEHeaderKey(key) == textproto.CanonicalMIMEHeaderKey(middleware.RequestIDHeader) {
+		return requestIDMetadata, true
+	}
+	return runtime.DefaultHeaderMatcher(key)
+}
+
+// outgoingHeader answers the request ID the call ran under in the same
+// header the HTTP API uses
+func outgoingHeader(key string) (string, bool) {
+	if key == requestIDMetadata {
+		return middleware.RequestIDHeader, true
+	}
+	return runtime.DefaultHeaderMatcher(key)
+}
+
+// responseStatus answers a created user with 201 and calls returning
+// nothing with 204, as the HTTP API does
+func responseStatus(ctx context.Context, w http.ResponseWriter, resp proto.Message) error {
+	if _, ok := resp.(*emptypb.Empty); ok {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	if method, _ := runtime.RPCMethod(ctx); method == template2v1.UserService_CreateUser_FullMethodName {
+		w.WriteHeader(http.StatusCreated)
+	}
+	return nil
+}
+
+// bodylessWriter drops the body of a 204, which the gateway writes as "{}"
+// for an Empty response
+type bodylessWriter struct {
+	http.ResponseWriter
+	noContent bool
+}
+
+func (w *bodylessWriter) WriteHeader(code int) {
+	w.noContent = code == http.StatusNoContent
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *bodylessWriter) Write(b []byte) (int, error) {
+	if w.noContent {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// codeStatuses are the statuses of error codes the HTTP API answers with a
+// different status than grpc-gateway maps their gRPC code to
+var codeStatuses = map[models.ErrorCode]int{
+	models.CodePreconditionFailed: http.StatusPreconditionFailed,
+	models.CodeInvariantViolation: http.StatusUnprocessableEntity,
+	models.CodeStorageFull:        http.StatusInsufficientStorage,
+}
+
+// writeError answers a failed call with a problem document. The ErrorInfo
+// reason grpcserver attaches is the error code, when in the catalog, and
+// its metadata the details; BadRequest field violations become the invalid fields, without
+// the rule, which the call does not carry.
+func writeError(ctx context.Context, _ *runtime.ServeMux, _ runtime.Marshaler, w http.ResponseWriter, r *http.Request, err error) {
+	st := status.Convert(err)
+	apiErr := callError(st)
+	for _, detail := range st.Details() {
+		switch detail := detail.(type) {
+		case *errdetails.ErrorInfo:
+			if code := models.ErrorCode(detail.GetReason()); models.KnownErrorCode(code) {
+				apiErr.Code = string(code)
+			}
+			for key, value := range detail.GetMetadata() {
+				if apiErr.Details == nil {
+					apiErr.Details = map[string]interface{}{}
+				}
+				apiErr.Details[key] = value
+			}
+		case *errdetails.BadRequest:
+			for _, v := range detail.GetFieldViolations() {
+				apiErr.Fields = append(apiErr.Fields, apierror.FieldError{Field: v.GetField(), Message: v.GetDescription()})
+			}
+		}
+	}
+	if s, ok := codeStatuses[models.ErrorCode(apiErr.Code)]; ok {
+		apiErr.Status = s
+	}
+	if len(apiErr.Fields) > 0 {
+		apiErr.Status = http.StatusUnprocessableEntity
+	}
+	var httpErr *runtime.HTTPStatusError
+	if errors.As(err, &httpErr) {
+		apiErr.Status = httpErr.HTTPStatus
+	}
+
+	problem := apiErr.Problem()
+	problem.Instance = r.URL.Path
+	if md, ok := runtime.ServerMetadataFromContext(ctx); ok {
+		if ids := md.HeaderMD.Get(requestIDMetadata); len(ids) > 0 {
+			w.Header().Set(middleware.RequestIDHeader, ids[0])
+			problem.RequestID = ids[0]
+		}
+	}
+	_ = apierror.Write(w, problem)
+}
+
+// routingError answers a request no binding matches with 404, as the HTTP
+// API does whether or not the path exists under another method
+func routingError(ctx context.Context, mux *runtime.ServeMux, marshaler runtime.Marshaler, w http.ResponseWriter, r *http.Request, httpStatus int) {
+	if httpStatus == http.StatusMethodNotAllowed {
+		httpStatus = http.StatusNotFound
+	}
+	runtime.DefaultRoutingErrorHandler(ctx, mux, marshaler, w, r, httpStatus)
+}
+
+// callError is the error of a failed call before its details are read,
+// with the code of its gRPC status. That is the code of a call failing
+// without an ErrorInfo, such as one grpc-gateway failed itself for a
+// malformed request.
+func callError(st *status.Status) *apierror.Error {
+	httpStatus, message := runtime.HTTPStatusFromCode(st.Code()), st.Message()
+	switch st.Code() {
+	case codes.InvalidArgument:
+		return models.NewError(httpStatus, models.CodeValidationFailed, message)
+	case codes.NotFound:
+		return models.NewError(httpStatus, models.CodeNotFound, message)
+	case codes.Unauthenticated:
+		return models.NewError(httpStatus, models.CodeUnauthorized, message)
+	case codes.PermissionDenied:
+		return models.NewError(httpStatus, models.CodeForbidden, message)
+	case codes.ResourceExhausted:
+		return models.NewError(httpStatus, models.CodeRateLimited, message)
+	case codes.DeadlineExceeded, codes.Canceled:
+		return models.NewError(httpStatus, models.CodeRequestTimeout, message)
+	case codes.Unavailable:
+		return models.NewError(httpStatus, models.CodeUnavailable, message)
+	default:
+		return models.NewError(httpStatus, models.CodeInternal, message)
+	}
+}
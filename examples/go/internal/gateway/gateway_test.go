@@ -0,0 +1,158 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/cbwinslow/template2/examples/go/internal/grpcserver"
+	"github.com/cbwinslow/template2/examples/go/internal/middleware"
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+	"github.com/cbwinslow/template2/examples/go/pkg/apierror"
+	"github.com/cbwinslow/template2/examples/go/pkg/auth"
+)
+
+// newGateway serves a gateway to a gRPC server on the sample users, admin
+// alice@example.com (1) and bob@example.com (2), and returns it with a
+// token of Alice's
+func newGateway(t *testing.T, opts ...Option) (http.Handler, string) {
+	t.Helper()
+	authService := auth.NewAuthService()
+	server := grpcserver.New(models.NewUserService(), authService, zap.NewNop(),
+		grpcserver.WithRegisterer(prometheus.NewRegistry()))
+	ln := bufconn.Listen(1 << 20)
+	go func() { _ = server.Serve(ln) }()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return ln.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	handler, err := New(conn, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := authService.GenerateToken(context.Background(), 1, "alice@example.com", models.RoleAdmin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return handler, token
+}
+
+func call(handler http.Handler, method, path, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	req.Header.Set(middleware.RequestIDHeader, "req-1")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+func decodeProblem(t *testing.T, w *httptest.ResponseRecorder) apierror.Problem {
+	t.Helper()
+	if ct := w.Header().Get("Content-Type"); ct != apierror.ContentType {
+		t.Fatalf("Content-Type = %q, body %s", ct, w.Body)
+	}
+	var problem apierror.Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+		t.Fatal(err)
+	}
+	return problem
+}
+
+func TestGatewayServesUsersInTheHTTPAPIShape(t *testing.T) {
+	handler, token := newGateway(t)
+
+	w := call(handler, http.MethodGet, "/v1/users/2", token, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET = %d: %s", w.Code, w.Body)
+	}
+	var user map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &user); err != nil {
+		t.Fatal(err)
+	}
+	if user["id"] != float64(2) || user["email"] != "bob@example.com" || user["active"] != true {
+		t.Errorf("user = %v", user)
+	}
+	if _, ok := user["locked_at"]; ok {
+		t.Errorf("user = %v, want no locked_at", user)
+	}
+	if id := w.Header().Get(middleware.RequestIDHeader); id != "req-1" {
+		t.Errorf("request ID = %q", id)
+	}
+
+	w = call(handler, http.MethodPost, "/v1/users", token, `{"name": "Hana", "email": "hana@example.com", "age": 30}`)
+	if w.Code != http.StatusCreated || !strings.Contains(w.Body.String(), `"age":30`) {
+		t.Fatalf("POST = %d: %s", w.Code, w.Body)
+	}
+	w = call(handler, http.MethodPatch, "/v1/users/3", token, `{"name": "Hana K"}`)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"name":"Hana K"`) {
+		t.Fatalf("PATCH = %d: %s", w.Code, w.Body)
+	}
+	w = call(handler, http.MethodDelete, "/v1/users/3", token, "")
+	if w.Code != http.StatusNoContent || w.Body.Len() != 0 {
+		t.Fatalf("DELETE = %d: %q", w.Code, w.Body)
+	}
+}
+
+func TestGatewayAnswersProblems(t *testing.T) {
+	handler, token := newGateway(t)
+
+	w := call(handler, http.MethodGet, "/v1/users/2", "", "")
+	if problem := decodeProblem(t, w); w.Code != http.StatusUnauthorized || problem.Code != string(models.CodeUnauthorized) {
+		t.Errorf("without a token: %d %+v", w.Code, problem)
+	}
+
+	w = call(handler, http.MethodGet, "/v1/users/99", token, "")
+	problem := decodeProblem(t, w)
+	if w.Code != http.StatusNotFound || problem.Code != string(models.CodeUserNotFound) || problem.Instance != "/v1/users/99" {
+		t.Errorf("missing user: %d %+v", w.Code, problem)
+	}
+	if problem.RequestID != "req-1" {
+		t.Errorf("request ID = %q", problem.RequestID)
+	}
+
+	w = call(handler, http.MethodPost, "/v1/users", token, `{"name": "-bad-", "email": "hana@example.com"}`)
+	problem = decodeProblem(t, w)
+	if w.Code != http.StatusUnprocessableEntity || len(problem.Errors) != 1 || problem.Errors[0].Field != "name" {
+		t.Errorf("invalid user: %d %+v", w.Code, problem)
+	}
+
+	w = call(handler, http.MethodPost, "/v1/users/2", token, "")
+	if problem := decodeProblem(t, w); w.Code != http.StatusNotFound || problem.Code != string(models.CodeNotFound) {
+		t.Errorf("unrouted: %d %+v", w.Code, problem)
+	}
+}
+
+func TestGatewayCompatPaths(t *testing.T) {
+	handler, token := newGateway(t)
+	if w := call(handler, http.MethodGet, "/api/v1/users/2", token, ""); w.Code != http.StatusNotFound {
+		t.Errorf("GET /api/v1/users/2 without compat paths = %d", w.Code)
+	}
+
+	handler, token = newGateway(t, WithCompatPaths())
+	for _, path := range []string{"/api/v1/users/2", "/v1/users/2"} {
+		if w := call(handler, http.MethodGet, path, token, ""); w.Code != http.StatusOK {
+			t.Errorf("GET %s = %d: %s", path, w.Code, w.Body)
+		}
+	}
+	w := call(handler, http.MethodPost, "/api/v1/auth/refresh", "", `{"refresh_token": "garbage"}`)
+	if problem := decodeProblem(t, w); w.Code != http.StatusUnauthorized || problem.Code != string(models.CodeTokenInvalid) {
+		t.Errorf("refresh: %d %+v", w.Code, problem)
+	}
+}
@@ -0,0 +1,6 @@
+// Package graph is the GraphQL schema of the API and the executor gqlgen
+// generates for it. The resolvers live with the REST handlers, whose
+// services and helpers they share.
+package graph
+
+//go:generate go run github.com/99designs/gqlgen generate --config gqlgen.yml
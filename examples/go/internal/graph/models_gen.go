@@ -0,0 +1,58 @@
+// Code generated by github.com/99designs/gqlgen, DO NOT EDIT.
+
+package graph
+
+import (
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+)
+
+type CreateUserInput struct {
+	Name   string  `json:"name"`
+	Email  string  `json:"email"`
+	Age    *int    `json:"age,omitempty"`
+	Role   *string `json:"role,omitempty"`
+	Active *bool   `json:"active,omitempty"`
+}
+
+// Tokens, or for accounts with two-factor authentication a challenge to pass to verifyTwoFactor
+type LoginPayload struct {
+	Tokens    *TokenPair          `json:"tokens,omitempty"`
+	Challenge *TwoFactorChallenge `json:"challenge,omitempty"`
+}
+
+type Mutation struct {
+}
+
+type Query struct {
+}
+
+type TokenPair struct {
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken"`
+	TokenType    string `json:"tokenType"`
+	// Seconds until the access token expires
+	ExpiresIn int `json:"expiresIn"`
+}
+
+type TwoFactorChallenge struct {
+	ChallengeToken string `json:"challengeToken"`
+	ExpiresIn      int    `json:"expiresIn"`
+}
+
+// The fields to change; those left out keep their value
+type UpdateUserInput struct {
+	Name  *string `json:"name,omitempty"`
+	Email *string `json:"email,omitempty"`
+	Age   *int    `json:"age,omitempty"`
+	// Changing the role revokes the user's tokens
+	Role   *string `json:"role,omitempty"`
+	Active *bool   `json:"active,omitempty"`
+}
+
+// A page of users ordered by ID
+type UserConnection struct {
+	Nodes []models.User `json:"nodes"`
+	// Pass as after to get the next page
+	EndCursor   *string `json:"endCursor,omitempty"`
+	HasNextPage bool    `json:"hasNextPage"`
+}
@@ -0,0 +1,164 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+	"github.com/cbwinslow/template2/examples/go/pkg/auth"
+	template2v1 "github.com/cbwinslow/template2/examples/go/pkg/pb/template2/v1"
+)
+
+// authServer serves AuthService on the auth and user services
+type authServer struct {
+	template2v1.UnimplementedAuthServiceServer
+	auth      *auth.AuthService
+	users     *models.UserService
+	logger    *zap.Logger
+	twoFactor bool
+}
+
+func (s *authServer) Login(ctx context.Context, req *template2v1.LoginRequest) (*template2v1.LoginResponse, error) {
+	if req.GetEmail() == "" || req.GetPassword() == "" {
+		return nil, newError(codes.InvalidArgument, models.CodeValidationFailed, "email and password are required", nil)
+	}
+
+	user, err := s.users.GetByEmail(ctx, req.GetEmail())
+	switch {
+	case err == nil:
+		err = s.auth.CheckPassword(ctx, user.ID, req.GetPassword())
+	case errors.Is(err, models.ErrUserNotFound):
+		err = s.auth.RejectPassword(ctx, req.GetPassword())
+	}
+	if err != nil {
+		if !errors.Is(err, models.ErrUserNotFound) && !errors.Is(err, auth.ErrInvalidCredentials) {
+			return nil, serviceError(err)
+		}
+		contextLogger(ctx, s.logger).Info("Login failed", zap.String("ip", peerIP(ctx)))
+		return nil, newError(codes.Unauthenticated, models.CodeInvalidCredentials, "Invalid email or password", nil)
+	}
+	if user.LockedAt != nil {
+		return nil, newError(codes.PermissionDenied, models.CodeAccountLocked, "This account is locked; contact an administrator", nil)
+	}
+	if s.twoFactor {
+		enabled, err := s.auth.TwoFactorEnabled(ctx, user.ID)
+		if err != nil {
+			return nil, serviceError(err)
+		}
+		if enabled {
+			challenge, err := s.auth.IssueChallengeToken(ctx, user.ID)
+			if err != nil {
+				return nil, serviceError(err)
+			}
+			contextLogger(ctx, s.logger).Info("Two-factor challenge issued", zap.Int("user_id", user.ID))
+			return &template2v1.LoginResponse{Result: &template2v1.LoginResponse_Challenge{Challenge: &template2v1.TwoFactorChallenge{
+				ChallengeToken: challenge,
+				ExpiresIn:      int32(s.auth.ChallengeTTL().Seconds()),
+			}}}, nil
+		}
+	}
+
+	pair, err := s.auth.IssueTokenPair(ctx, user.ID, user.Email, user.Role, sessionClient(ctx))
+	if err != nil {
+		return nil, serviceError(err)
+	}
+	contextLogger(ctx, s.logger).Info("User logged in", zap.Int("user_id", user.ID))
+	return &template2v1.LoginResponse{Result: &template2v1.LoginResponse_Tokens{Tokens: tokenPair(pair)}}, nil
+}
+
+func (s *authServer) VerifyTwoFactor(ctx context.Context, req *template2v1.VerifyTwoFactorRequest) (*template2v1.TokenPair, error) {
+	if req.GetChallengeToken() == "" || req.GetCode() == "" {
+		return nil, newError(codes.InvalidArgument, models.CodeValidationFailed, "challenge_token and code are required", nil)
+	}
+
+	logger := contextLogger(ctx, s.logger)
+	userID, recovery, err := s.auth.VerifyChallenge(ctx, req.GetChallengeToken(), req.GetCode())
+	switch {
+	case isTokenError(err):
+		return nil, newError(codes.Unauthenticated, models.CodeTokenInvalid, "Invalid or expired challenge token", nil)
+	case errors.Is(err, auth.ErrInvalidCode):
+		logger.Info("Two-factor code rejected", zap.String("ip", peerIP(ctx)))
+		return nil, newError(codes.Unauthenticated, models.CodeTwoFactorInvalid, "Invalid two-factor code", nil)
+	case errors.Is(err, auth.ErrTooManyAttempts):
+		logger.Warn("Two-factor attempts exhausted", zap.String("ip", peerIP(ctx)))
+		return nil, newError(codes.ResourceExhausted, models.CodeRateLimited, "Too many invalid two-factor codes; sign in again later", nil)
+	case err != nil:
+		return nil, serviceError(err)
+	}
+
+	user, err := s.users.Get(ctx, userID)
+	if err != nil {
+		return nil, serviceError(err)
+	}
+	pair, err := s.auth.IssueTokenPair(ctx, user.ID, user.Email, user.Role, sessionClient(ctx))
+	if err != nil {
+		return nil, serviceError(err)
+	}
+	logger.Info("User logged in", zap.Int("user_id", user.ID), zap.Bool("recovery_code", recovery))
+	return tokenPair(pair), nil
+}
+
+func (s *authServer) Refresh(ctx context.Context, req *template2v1.RefreshRequest) (*template2v1.TokenPair, error) {
+	if req.GetRefreshToken() == "" {
+		return nil, newError(codes.InvalidArgument, models.CodeValidationFailed, "refresh_token is required", nil)
+	}
+
+	pair, err := s.auth.Refresh(ctx, req.GetRefreshToken(), sessionClient(ctx))
+	if err != nil {
+		if errors.Is(err, auth.ErrRefreshReused) {
+			contextLogger(ctx, s.logger).Warn("Refresh token reused; session revoked",
+				zap.String("event", "refresh_token_reused"),
+				zap.String("ip", peerIP(ctx)))
+		}
+		if isTokenError(err) {
+			return nil, newError(codes.Unauthenticated, models.CodeTokenInvalid, "Invalid or expired refresh token", nil)
+		}
+		return nil, serviceError(err)
+	}
+	return tokenPair(pair), nil
+}
+
+func (s *authServer) Logout(ctx context.Context, req *template2v1.LogoutRequest) (*emptypb.Empty, error) {
+	if req.GetRefreshToken() == "" {
+		return nil, newError(codes.InvalidArgument, models.CodeValidationFailed, "refresh_token is required", nil)
+	}
+	if err := s.auth.RevokeRefreshToken(ctx, req.GetRefreshToken()); err != nil {
+		return nil, serviceError(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *authServer) GetProfile(ctx context.Context, _ *emptypb.Empty) (*template2v1.User, error) {
+	claims, ok := ClaimsFromContext(ctx)
+	if !ok {
+		return nil, newError(codes.Unauthenticated, models.CodeUnauthorized, "Authentication required", nil)
+	}
+	user, err := s.users.Get(ctx, claims.UserID)
+	if err != nil {
+		return nil, serviceError(err)
+	}
+	return userMessage(user), nil
+}
+
+// sessionClient records the caller's address and user agent on the session
+// a token pair is issued in
+func sessionClient(ctx context.Context) auth.SessionOption {
+	return auth.WithSessionClient(peerIP(ctx), firstMetadata(ctx, "user-agent"))
+}
+
+func tokenPair(pair auth.TokenPair) *template2v1.TokenPair {
+	return &template2v1.TokenPair{
+		AccessToken:  pair.AccessToken,
+		RefreshToken: pair.RefreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int32(pair.ExpiresIn.Seconds()),
+	}
+}
+
+func isTokenError(err error) bool {
+	return errors.Is(err, auth.ErrInvalidToken) || errors.Is(err, auth.ErrTokenRevoked) || errors.Is(err, auth.ErrRefreshReused)
+}
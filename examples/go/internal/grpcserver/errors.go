@@ -0,0 +1,101 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+	"github.com/cbwinslow/template2/examples/go/pkg/apierror"
+)
+
+// errorDomain names the API in the ErrorInfo attached to failed calls
+const errorDomain = "template2"
+
+// callError is a failed call: the status sent to the client and the cause,
+// which is logged but never sent
+type callError struct {
+	status *status.Status
+	cause  error
+}
+
+func (e *callError) Error() string {
+	if e.cause == nil {
+		return e.status.Message()
+	}
+	return e.status.Message() + ": " + e.cause.Error()
+}
+
+func (e *callError) Unwrap() error {
+	return e.cause
+}
+
+// GRPCStatus is the status grpc sends for the error
+func (e *callError) GRPCStatus() *status.Status {
+	return e.status
+}
+
+// newError returns a call failing with c and message. The ErrorInfo reason
+// carries the same error code the HTTP API answers with, and metadata the
+// values of its problem details.
+func newError(c codes.Code, code models.ErrorCode, message string, metadata map[string]string) *callError {
+	st, err := status.New(c, message).WithDetails(&errdetails.ErrorInfo{Reason: string(code), Domain: errorDomain, Metadata: metadata})
+	if err != nil {
+		st = status.New(c, message)
+	}
+	return &callError{status: st}
+}
+
+// wrap records cause on e
+func (e *callError) wrap(cause error) *callError {
+	e.cause = cause
+	return e
+}
+
+// invalidArgument fails a call whose request broke validation rules,
+// listing every invalid field
+func invalidArgument(fields []apierror.FieldError) *callError {
+	violations := make([]*errdetails.BadRequest_FieldViolation, len(fields))
+	for i, f := range fields {
+		violations[i] = &errdetails.BadRequest_FieldViolation{Field: f.Field, Description: f.Message}
+	}
+	st, err := status.New(codes.InvalidArgument, "The request failed validation").WithDetails(
+		&errdetails.ErrorInfo{Reason: string(models.CodeValidationFailed), Domain: errorDomain},
+		&errdetails.BadRequest{FieldViolations: violations},
+	)
+	if err != nil {
+		st = status.New(codes.InvalidArgument, "The request failed validation")
+	}
+	return &callError{status: st}
+}
+
+// serviceError maps an error returned by a service to the error the call
+// fails with, as handlers.serviceError does for HTTP
+func serviceError(err error) *callError {
+	var invErr *models.InvariantError
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return newError(codes.DeadlineExceeded, models.CodeRequestTimeout, "The request did not complete in time", nil).wrap(err)
+	case errors.Is(err, context.Canceled):
+		return newError(codes.Canceled, models.CodeRequestTimeout, "The request was canceled", nil).wrap(err)
+	case errors.Is(err, models.ErrUserNotFound):
+		return newError(codes.NotFound, models.CodeUserNotFound, "User not found", nil).wrap(err)
+	case errors.Is(err, models.ErrEmailTaken):
+		return newError(codes.AlreadyExists, models.CodeEmailTaken, "Email is already in use", nil).wrap(err)
+	case errors.Is(err, models.ErrInvalidRole):
+		return newError(codes.InvalidArgument, models.CodeInvalidRole, "Role is not valid", nil).wrap(err)
+	case errors.Is(err, models.ErrPreconditionFailed):
+		return newError(codes.FailedPrecondition, models.CodePreconditionFailed, "The user has changed since it was read", nil).wrap(err)
+	case errors.Is(err, models.ErrTxConflict):
+		return newError(codes.Aborted, models.CodeTxConflict, "Another change to the users landed first; retry the request", nil).wrap(err)
+	case errors.Is(err, models.ErrStoreFull):
+		return newError(codes.ResourceExhausted, models.CodeStorageFull, "The user store has reached its capacity", nil).wrap(err)
+	case errors.As(err, &invErr):
+		return newError(codes.FailedPrecondition, models.CodeInvariantViolation, invErr.Message, map[string]string{"rule": invErr.Rule}).wrap(err)
+	default:
+		return newError(codes.Internal, models.CodeInternal, "Internal server error", nil).wrap(err)
+	}
+}
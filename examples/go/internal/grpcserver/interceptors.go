@@ -0,0 +1,204 @@
+package grpcserver
+
+import (
+	"context"
+	"net"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/cbwinslow/template2/examples/go/internal/middleware"
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+	"github.com/cbwinslow/template2/examples/go/pkg/auth"
+)
+
+// requestIDMetadata carries the request ID on calls and in response headers,
+// as the X-Request-ID header does over HTTP
+const requestIDMetadata = "x-request-id"
+
+// claimsContextKey stores the claims of an authenticated call
+type claimsContextKey struct{}
+
+// ClaimsFromContext returns the claims of the authenticated call's token
+func ClaimsFromContext(ctx context.Context) (*auth.Claims, bool) {
+	claims, ok := ctx.Value(claimsContextKey{}).(*auth.Claims)
+	return claims, ok
+}
+
+// UnaryRequestLogger assigns every call a request ID, reusing a well-formed
+// x-request-id the client sent, echoes it in the response headers and
+// writes one log entry per call, as middleware.RequestID and
+// middleware.Logger do for HTTP requests
+func UnaryRequestLogger(logger *zap.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		ctx, id := middleware.ContextWithRequestID(ctx, firstMetadata(ctx, requestIDMetadata))
+		_ = grpc.SetHeader(ctx, metadata.Pairs(requestIDMetadata, id))
+
+		resp, err := handler(ctx, req)
+
+		code := status.Code(err)
+		fields := []zap.Field{
+			zap.String("code", code.String()),
+			zap.String("method", info.FullMethod),
+			zap.String("ip", peerIP(ctx)),
+			zap.String("user_agent", firstMetadata(ctx, "user-agent")),
+			zap.Duration("latency", time.Since(start)),
+			zap.String("request_id", id),
+		}
+
+		switch {
+		case code == codes.OK:
+			logger.Info("Call completed", fields...)
+		case serverFault(code):
+			logger.Error("Call completed", append(fields, zap.Error(err))...)
+		default:
+			logger.Warn("Call completed", fields...)
+		}
+		return resp, err
+	}
+}
+
+// serverFault reports whether calls failing with code failed through no
+// fault of the client, the counterpart of a 5xx status
+func serverFault(code codes.Code) bool {
+	switch code {
+	case codes.Unknown, codes.Internal, codes.Unavailable, codes.DataLoss, codes.DeadlineExceeded, codes.Unimplemented:
+		return true
+	}
+	return false
+}
+
+// UnaryRecovery turns handler panics into a logged Internal error
+func UnaryRecovery(logger *zap.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			logger.Error("Panic recovered",
+				zap.Any("error", rec),
+				zap.String("method", info.FullMethod),
+				zap.String("request_id", middleware.RequestIDFromContext(ctx)),
+				zap.ByteString("stack", debug.Stack()))
+			resp, err = nil, newError(codes.Internal, models.CodeInternal, "Internal server error", nil)
+		}()
+
+		return handler(ctx, req)
+	}
+}
+
+// UnaryMetrics records the count and duration of every call labeled by
+// method and code, plus a gauge of the calls in flight, and registers the
+// collectors with registerer. Unknown methods never reach interceptors, so
+// the method label only takes registered values.
+func UnaryMetrics(registerer prometheus.Registerer) grpc.UnaryServerInterceptor {
+	labels := []string{"method", "code"}
+	handled := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "grpc_server_handled_total",
+		Help: "gRPC calls completed, by method and code.",
+	}, labels)
+	duration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "grpc_server_handling_seconds",
+		Help:    "gRPC call latency, by method and code.",
+		Buckets: prometheus.DefBuckets,
+	}, labels)
+	inFlight := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "grpc_server_in_flight",
+		Help: "gRPC calls currently being served.",
+	})
+	registerer.MustRegister(handled, duration, inFlight)
+
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		resp, err := handler(ctx, req)
+
+		values := []string{info.FullMethod, status.Code(err).String()}
+		handled.WithLabelValues(values...).Inc()
+		duration.WithLabelValues(values...).Observe(time.Since(start).Seconds())
+		return resp, err
+	}
+}
+
+// UnaryAuth authenticates calls with the bearer token in their
+// authorization metadata, like middleware.AuthRequired, and checks the
+// permission methods map to, like middleware.RequirePermission. Methods in
+// public are served without a token; every other one requires one.
+// Tokens whose session has been revoked are rejected when denied is set.
+func UnaryAuth(tokens middleware.TokenValidator, denied middleware.SessionDeniedFunc, public map[string]bool, permissions map[string]string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if public[info.FullMethod] {
+			return handler(ctx, req)
+		}
+
+		token, ok := bearerToken(ctx)
+		if !ok {
+			return nil, newError(codes.Unauthenticated, models.CodeUnauthorized, "Authentication required", nil)
+		}
+		claims, err := tokens.ValidateToken(ctx, token)
+		if err != nil {
+			return nil, newError(codes.Unauthenticated, models.CodeTokenInvalid, "Invalid or expired token", nil)
+		}
+		if denied != nil && claims.SessionID != "" {
+			revoked, err := denied(ctx, claims.SessionID)
+			if err != nil {
+				return nil, newError(codes.Internal, models.CodeInternal, "Could not check token revocation", nil).wrap(err)
+			}
+			if revoked {
+				return nil, newError(codes.Unauthenticated, models.CodeTokenInvalid, "Session has been signed out", nil)
+			}
+		}
+		if permission, ok := permissions[info.FullMethod]; ok && !models.RoleHasPermission(claims.Role, permission) {
+			return nil, newError(codes.PermissionDenied, models.CodeForbidden, "Insufficient permissions for this method",
+				map[string]string{"required_permission": permission})
+		}
+
+		return handler(context.WithValue(ctx, claimsContextKey{}, claims), req)
+	}
+}
+
+// bearerToken returns the token of an authorization metadata entry of the
+// form "Bearer <token>"
+func bearerToken(ctx context.Context) (string, bool) {
+	scheme, token, found := strings.Cut(firstMetadata(ctx, "authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
+// firstMetadata returns the first value of the incoming metadata key
+func firstMetadata(ctx context.Context, key string) string {
+	if values := metadata.ValueFromIncomingContext(ctx, key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// peerIP returns the IP address the call came from
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	if addr, ok := p.Addr.(*net.TCPAddr); ok {
+		return addr.IP.String()
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
@@ -0,0 +1,83 @@
+package grpcserver
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/cbwinslow/template2/examples/go/internal/middleware"
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+)
+
+var getUserInfo = &grpc.UnaryServerInfo{FullMethod: "/template2.v1.UserService/GetUser"}
+
+func TestUnaryRecoveryLogsPanics(t *testing.T) {
+	core, logs := observer.New(zapcore.ErrorLevel)
+	recovery := UnaryRecovery(zap.New(core))
+
+	_, err := recovery(context.Background(), nil, getUserInfo, func(context.Context, interface{}) (interface{}, error) {
+		panic("boom")
+	})
+	wantError(t, err, codes.Internal, models.CodeInternal)
+	if entries := logs.FilterMessage("Panic recovered").All(); len(entries) != 1 || entries[0].ContextMap()["method"] != getUserInfo.FullMethod {
+		t.Errorf("logged %v", entries)
+	}
+}
+
+func TestUnaryRequestLoggerReusesRequestIDs(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	logger := UnaryRequestLogger(zap.New(core))
+	var seen string
+	handler := func(ctx context.Context, _ interface{}) (interface{}, error) {
+		seen = middleware.RequestIDFromContext(ctx)
+		return nil, status.Error(codes.NotFound, "User not found")
+	}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-request-id", "client-id-1"))
+	_, _ = logger(ctx, nil, getUserInfo, handler)
+	if seen != "client-id-1" {
+		t.Errorf("request ID = %q, want the client's", seen)
+	}
+	ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-request-id", strings.Repeat("x", 200)))
+	_, _ = logger(ctx, nil, getUserInfo, handler)
+	if seen == "" || len(seen) > 128 {
+		t.Errorf("request ID = %q, want a new one", seen)
+	}
+
+	entries := logs.FilterMessage("Call completed").All()
+	if len(entries) != 2 || entries[0].Level != zapcore.WarnLevel || entries[0].ContextMap()["code"] != "NotFound" {
+		t.Errorf("logged %v", entries)
+	}
+}
+
+func TestUnaryMetricsCountsCalls(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	metrics := UnaryMetrics(registry)
+	ok := func(context.Context, interface{}) (interface{}, error) { return nil, nil }
+	denied := func(context.Context, interface{}) (interface{}, error) {
+		return nil, status.Error(codes.PermissionDenied, "no")
+	}
+	_, _ = metrics(context.Background(), nil, getUserInfo, ok)
+	_, _ = metrics(context.Background(), nil, getUserInfo, ok)
+	_, _ = metrics(context.Background(), nil, getUserInfo, denied)
+
+	want := `
+# HELP grpc_server_handled_total gRPC calls completed, by method and code.
+# TYPE grpc_server_handled_total counter
+grpc_server_handled_total{code="OK",method="/template2.v1.UserService/GetUser"} 2
+grpc_server_handled_total{code="PermissionDenied",method="/template2.v1.UserService/GetUser"} 1
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(want), "grpc_server_handled_total"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,154 @@
+// Package grpcserver serves the UserService and AuthService defined under
+// proto/ over gRPC, on the same services as the HTTP API. Interceptors
+// mirror the HTTP middleware: request IDs and access logging, metrics,
+// panic recovery and bearer token authentication.
+package grpcserver
+
+import (
+	"context"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+
+	"github.com/cbwinslow/template2/examples/go/internal/middleware"
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+	"github.com/cbwinslow/template2/examples/go/pkg/auth"
+	template2v1 "github.com/cbwinslow/template2/examples/go/pkg/pb/template2/v1"
+	"github.com/cbwinslow/template2/examples/go/pkg/validation"
+)
+
+// TokenRevoker invalidates the outstanding tokens of a user
+type TokenRevoker interface {
+	RevokeUserTokens(ctx context.Context, userID int) error
+}
+
+// CacheInvalidator drops cached HTTP responses that a write may have made
+// stale, such as a middleware.CacheStore
+type CacheInvalidator interface {
+	Purge(ctx context.Context) error
+}
+
+// publicMethods are served without a token
+var publicMethods = map[string]bool{
+	template2v1.AuthService_Login_FullMethodName:           true,
+	template2v1.AuthService_VerifyTwoFactor_FullMethodName: true,
+	template2v1.AuthService_Refresh_FullMethodName:         true,
+	template2v1.AuthService_Logout_FullMethodName:          true,
+	healthpb.Health_Check_FullMethodName:                   true,
+}
+
+// methodPermissions are the permissions methods require, as the matching
+// HTTP routes do
+var methodPermissions = map[string]string{
+	template2v1.UserService_GetUser_FullMethodName:    models.PermUsersRead,
+	template2v1.UserService_ListUsers_FullMethodName:  models.PermUsersRead,
+	template2v1.UserService_CreateUser_FullMethodName: models.PermUsersWrite,
+	template2v1.UserService_UpdateUser_FullMethodName: models.PermUsersWrite,
+	template2v1.UserService_DeleteUser_FullMethodName: models.PermUsersDelete,
+}
+
+type options struct {
+	registerer prometheus.Registerer
+	denied     middleware.SessionDeniedFunc
+	twoFactor  bool
+	audit      *zap.Logger
+	cache      CacheInvalidator
+	serverOpts []grpc.ServerOption
+}
+
+// Option configures the server
+type Option func(*options)
+
+// WithRegisterer registers the call metrics with registerer instead of the
+// default Prometheus registry
+func WithRegisterer(registerer prometheus.Registerer) Option {
+	return func(o *options) {
+		o.registerer = registerer
+	}
+}
+
+// WithSessionDenylist rejects tokens whose session has been revoked, as
+// middleware.WithSessionDenylist does for HTTP
+func WithSessionDenylist(denied middleware.SessionDeniedFunc) Option {
+	return func(o *options) {
+		o.denied = denied
+	}
+}
+
+// WithTwoFactor makes Login answer accounts with two-factor authentication
+// enabled with a challenge instead of tokens
+func WithTwoFactor() Option {
+	return func(o *options) {
+		o.twoFactor = true
+	}
+}
+
+// WithAuditLogger records every successful user change to audit
+func WithAuditLogger(audit *zap.Logger) Option {
+	return func(o *options) {
+		o.audit = audit
+	}
+}
+
+// WithCacheInvalidator purges cache after every write to users, so the HTTP
+// API does not serve users changed over gRPC from its response cache
+func WithCacheInvalidator(cache CacheInvalidator) Option {
+	return func(o *options) {
+		o.cache = cache
+	}
+}
+
+// WithServerOptions passes opts to grpc.NewServer, e.g. for TLS credentials
+// or keepalive settings
+func WithServerOptions(opts ...grpc.ServerOption) Option {
+	return func(o *options) {
+		o.serverOpts = append(o.serverOpts, opts...)
+	}
+}
+
+// New creates a gRPC server serving UserService and AuthService on users
+// and authService, plus the standard health and reflection services
+func New(users *models.UserService, authService *auth.AuthService, logger *zap.Logger, opts ...Option) *grpc.Server {
+	o := options{registerer: prometheus.DefaultRegisterer, audit: zap.NewNop()}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	server := grpc.NewServer(append(o.serverOpts, grpc.ChainUnaryInterceptor(
+		UnaryRequestLogger(logger),
+		UnaryMetrics(o.registerer),
+		UnaryRecovery(logger),
+		UnaryAuth(authService, o.denied, publicMethods, methodPermissions),
+	))...)
+
+	template2v1.RegisterUserServiceServer(server, &userServer{
+		users:    users,
+		tokens:   authService,
+		logger:   logger,
+		audit:    o.audit,
+		cache:    o.cache,
+		validate: newValidator(),
+	})
+	template2v1.RegisterAuthServiceServer(server, &authServer{
+		auth:      authService,
+		users:     users,
+		logger:    logger,
+		twoFactor: o.twoFactor,
+	})
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	reflection.Register(server)
+	return server
+}
+
+// newValidator returns a validator of the binding rules on the models'
+// request types, which gin checks for the HTTP API
+func newValidator() *validator.Validate {
+	v := validation.New()
+	v.SetTagName("binding")
+	return v
+}
@@ -0,0 +1,275 @@
+package grpcserver
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+	"github.com/cbwinslow/template2/examples/go/pkg/auth"
+	template2v1 "github.com/cbwinslow/template2/examples/go/pkg/pb/template2/v1"
+)
+
+// fixture is a server on an in-memory listener. Besides the sample users,
+// admin alice@example.com (1) and bob@example.com (2), it holds user
+// hana@example.com (3) whose password is "s3cret-pass".
+type fixture struct {
+	users  template2v1.UserServiceClient
+	auth   template2v1.AuthServiceClient
+	tokens *auth.AuthService
+	store  *models.UserService
+}
+
+func newFixture(t *testing.T, opts ...Option) *fixture {
+	t.Helper()
+	ctx := context.Background()
+	authService := auth.NewAuthService()
+	users := models.NewUserService()
+	hana, err := users.Create(ctx, models.CreateUserRequest{Name: "Hana", Email: "hana@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := authService.SetPassword(ctx, hana.ID, "s3cret-pass"); err != nil {
+		t.Fatal(err)
+	}
+
+	opts = append([]Option{WithRegisterer(prometheus.NewRegistry())}, opts...)
+	server := New(users, authService, zap.NewNop(), opts...)
+	ln := bufconn.Listen(1 << 20)
+	go func() { _ = server.Serve(ln) }()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return ln.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &fixture{
+		users:  template2v1.NewUserServiceClient(conn),
+		auth:   template2v1.NewAuthServiceClient(conn),
+		tokens: authService,
+		store:  users,
+	}
+}
+
+// as returns ctx carrying token as a bearer token
+func as(ctx context.Context, token string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+}
+
+// wantError fails the test unless err is a status with code c and the
+// error code reason
+func wantError(t *testing.T, err error, c codes.Code, reason models.ErrorCode) *status.Status {
+	t.Helper()
+	st, _ := status.FromError(err)
+	if st.Code() != c {
+		t.Fatalf("code = %v (%v), want %v", st.Code(), err, c)
+	}
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok && info.Reason == string(reason) {
+			return st
+		}
+	}
+	t.Fatalf("%v: no ErrorInfo with reason %s", err, reason)
+	return nil
+}
+
+func TestLoginAuthenticatesProfile(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+
+	_, err := f.auth.Login(ctx, &template2v1.LoginRequest{Email: "hana@example.com", Password: "wrong-pass1"})
+	wantError(t, err, codes.Unauthenticated, models.CodeInvalidCredentials)
+
+	resp, err := f.auth.Login(ctx, &template2v1.LoginRequest{Email: "hana@example.com", Password: "s3cret-pass"})
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	tokens := resp.GetTokens()
+	if tokens.GetAccessToken() == "" || tokens.GetRefreshToken() == "" || tokens.GetTokenType() != "Bearer" {
+		t.Fatalf("tokens = %v", tokens)
+	}
+
+	_, err = f.auth.GetProfile(ctx, &emptypb.Empty{})
+	wantError(t, err, codes.Unauthenticated, models.CodeUnauthorized)
+	var header metadata.MD
+	profile, err := f.auth.GetProfile(as(ctx, tokens.GetAccessToken()), &emptypb.Empty{}, grpc.Header(&header))
+	if err != nil {
+		t.Fatalf("GetProfile: %v", err)
+	}
+	if profile.GetEmail() != "hana@example.com" || profile.GetCreatedAt() == nil {
+		t.Errorf("profile = %v", profile)
+	}
+	if ids := header.Get(requestIDMetadata); len(ids) != 1 || ids[0] == "" {
+		t.Errorf("request ID header = %v", ids)
+	}
+
+	// Signing out rejects the session's access token from the next call
+	if _, err := f.auth.Logout(ctx, &template2v1.LogoutRequest{RefreshToken: tokens.GetRefreshToken()}); err != nil {
+		t.Fatalf("Logout: %v", err)
+	}
+	_, err = f.auth.Refresh(ctx, &template2v1.RefreshRequest{RefreshToken: tokens.GetRefreshToken()})
+	wantError(t, err, codes.Unauthenticated, models.CodeTokenInvalid)
+}
+
+func TestSessionDenylist(t *testing.T) {
+	var f *fixture
+	f = newFixture(t, WithSessionDenylist(func(ctx context.Context, sessionID string) (bool, error) {
+		return f.tokens.SessionRevoked(ctx, sessionID)
+	}))
+	ctx := context.Background()
+	resp, err := f.auth.Login(ctx, &template2v1.LoginRequest{Email: "hana@example.com", Password: "s3cret-pass"})
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	tokens := resp.GetTokens()
+	if _, err := f.auth.Logout(ctx, &template2v1.LogoutRequest{RefreshToken: tokens.GetRefreshToken()}); err != nil {
+		t.Fatalf("Logout: %v", err)
+	}
+	_, err = f.auth.GetProfile(as(ctx, tokens.GetAccessToken()), &emptypb.Empty{})
+	wantError(t, err, codes.Unauthenticated, models.CodeTokenInvalid)
+}
+
+func TestUserServiceChecksPermissions(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+	userToken, _ := f.tokens.GenerateToken(ctx, 3, "hana@example.com", models.RoleUser)
+	adminToken, _ := f.tokens.GenerateToken(ctx, 1, "alice@example.com", models.RoleAdmin)
+
+	if user, err := f.users.GetUser(as(ctx, userToken), &template2v1.GetUserRequest{Id: 1}); err != nil || user.GetRole() != models.RoleAdmin {
+		t.Errorf("GetUser = %v, %v", user, err)
+	}
+	_, err := f.users.DeleteUser(as(ctx, userToken), &template2v1.DeleteUserRequest{Id: 1})
+	st := wantError(t, err, codes.PermissionDenied, models.CodeForbidden)
+	if st.Message() == "" {
+		t.Error("PermissionDenied without a message")
+	}
+
+	if _, err := f.users.DeleteUser(as(ctx, adminToken), &template2v1.DeleteUserRequest{Id: 3}); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	_, err = f.users.GetUser(as(ctx, adminToken), &template2v1.GetUserRequest{Id: 3})
+	wantError(t, err, codes.NotFound, models.CodeUserNotFound)
+	// Deleting Hana revoked her tokens
+	_, err = f.users.GetUser(as(ctx, userToken), &template2v1.GetUserRequest{Id: 1})
+	wantError(t, err, codes.Unauthenticated, models.CodeTokenInvalid)
+}
+
+func TestCreateAndUpdateUser(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+	adminToken, _ := f.tokens.GenerateToken(ctx, 1, "alice@example.com", models.RoleAdmin)
+	ctx = as(ctx, adminToken)
+
+	_, err := f.users.CreateUser(ctx, &template2v1.CreateUserRequest{Name: "-bad-", Email: "not an email"})
+	st := wantError(t, err, codes.InvalidArgument, models.CodeValidationFailed)
+	var fields []string
+	for _, detail := range st.Details() {
+		if badRequest, ok := detail.(*errdetails.BadRequest); ok {
+			for _, v := range badRequest.GetFieldViolations() {
+				fields = append(fields, v.GetField())
+			}
+		}
+	}
+	if len(fields) != 2 || fields[0] != "name" || fields[1] != "email" {
+		t.Errorf("field violations = %v", fields)
+	}
+
+	_, err = f.users.CreateUser(ctx, &template2v1.CreateUserRequest{Name: "Hana", Email: "hana@example.com"})
+	wantError(t, err, codes.AlreadyExists, models.CodeEmailTaken)
+
+	inactive := false
+	user, err := f.users.CreateUser(ctx, &template2v1.CreateUserRequest{Name: "Ben", Email: "ben@example.com", Active: &inactive})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if user.GetActive() || user.GetRole() != models.RoleUser {
+		t.Errorf("created %v", user)
+	}
+
+	age := int32(40)
+	updated, err := f.users.UpdateUser(ctx, &template2v1.UpdateUserRequest{Id: user.GetId(), Age: &age})
+	if err != nil {
+		t.Fatalf("UpdateUser: %v", err)
+	}
+	if updated.GetAge() != 40 || updated.GetName() != "Ben" {
+		t.Errorf("updated %v", updated)
+	}
+	_, err = f.users.UpdateUser(ctx, &template2v1.UpdateUserRequest{Id: 0})
+	wantError(t, err, codes.InvalidArgument, models.CodeInvalidID)
+}
+
+func TestListUsersPages(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+	for _, email := range []string{"ben@example.com", "cho@example.com", "dee@example.com"} {
+		if _, err := f.store.Create(ctx, models.CreateUserRequest{Name: "User", Email: email}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	token, _ := f.tokens.GenerateToken(ctx, 1, "alice@example.com", models.RoleAdmin)
+	ctx = as(ctx, token)
+
+	var emails []string
+	req := &template2v1.ListUsersRequest{PageSize: 2}
+	for pages := 0; ; pages++ {
+		if pages == 4 {
+			t.Fatal("pagination did not end")
+		}
+		resp, err := f.users.ListUsers(ctx, req)
+		if err != nil {
+			t.Fatalf("ListUsers: %v", err)
+		}
+		for _, user := range resp.GetUsers() {
+			emails = append(emails, user.GetEmail())
+		}
+		if resp.GetNextPageToken() == "" {
+			break
+		}
+		req.PageToken = resp.GetNextPageToken()
+	}
+	if len(emails) != 6 || emails[0] != "alice@example.com" || emails[5] != "dee@example.com" {
+		t.Errorf("listed %v", emails)
+	}
+
+	_, err := f.users.ListUsers(ctx, &template2v1.ListUsersRequest{PageToken: "garbage"})
+	wantError(t, err, codes.InvalidArgument, models.CodeInvalidPage)
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	f := newFixture(t, WithTwoFactor())
+	ctx := context.Background()
+	setup, err := f.tokens.SetupTwoFactor(ctx, 3, "hana@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := auth.GenerateTOTPCode(setup.Secret, time.Now())
+	if _, err := f.tokens.EnableTwoFactor(ctx, 3, code); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := f.auth.Login(ctx, &template2v1.LoginRequest{Email: "hana@example.com", Password: "s3cret-pass"})
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	challenge := resp.GetChallenge()
+	if challenge.GetChallengeToken() == "" || resp.GetTokens() != nil {
+		t.Fatalf("Login = %v, want a challenge", resp)
+	}
+	_, err = f.auth.VerifyTwoFactor(ctx, &template2v1.VerifyTwoFactorRequest{ChallengeToken: challenge.GetChallengeToken(), Code: "000000"})
+	wantError(t, err, codes.Unauthenticated, models.CodeTwoFactorInvalid)
+}
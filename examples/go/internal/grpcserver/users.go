@@ -0,0 +1,266 @@
+package grpcserver
+
+import (
+	"context"
+	"encoding/base64"
+	"strconv"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/cbwinslow/template2/examples/go/internal/middleware"
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+	"github.com/cbwinslow/template2/examples/go/pkg/apierror"
+	template2v1 "github.com/cbwinslow/template2/examples/go/pkg/pb/template2/v1"
+)
+
+// ListUsers page sizes, matching those of GET /api/v1/users
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// userServer serves UserService on the user service
+type userServer struct {
+	template2v1.UnimplementedUserServiceServer
+	users    *models.UserService
+	tokens   TokenRevoker
+	logger   *zap.Logger
+	audit    *zap.Logger
+	cache    CacheInvalidator
+	validate *validator.Validate
+}
+
+func (s *userServer) GetUser(ctx context.Context, req *template2v1.GetUserRequest) (*template2v1.User, error) {
+	id, err := userID(req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.users.Get(ctx, id)
+	if err != nil {
+		return nil, serviceError(err)
+	}
+	return userMessage(user), nil
+}
+
+func (s *userServer) ListUsers(ctx context.Context, req *template2v1.ListUsersRequest) (*template2v1.ListUsersResponse, error) {
+	size := int(req.GetPageSize())
+	switch {
+	case size < 0:
+		return nil, newError(codes.InvalidArgument, models.CodeInvalidPage, "page_size must not be negative", nil)
+	case size == 0:
+		size = defaultPageSize
+	case size > maxPageSize:
+		size = maxPageSize
+	}
+	afterID, err := decodePageToken(req.GetPageToken())
+	if err != nil {
+		return nil, err
+	}
+
+	// One more than a page tells whether another follows
+	users, err := s.users.Page(ctx, afterID, size+1)
+	if err != nil {
+		return nil, serviceError(err)
+	}
+	resp := &template2v1.ListUsersResponse{}
+	if len(users) > size {
+		users = users[:size]
+		resp.NextPageToken = encodePageToken(users[size-1].ID)
+	}
+	resp.Users = make([]*template2v1.User, len(users))
+	for i, user := range users {
+		resp.Users[i] = userMessage(user)
+	}
+	return resp, nil
+}
+
+func (s *userServer) CreateUser(ctx context.Context, req *template2v1.CreateUserRequest) (*template2v1.User, error) {
+	create := models.CreateUserRequest{
+		Name:   req.GetName(),
+		Email:  req.GetEmail(),
+		Age:    int(req.GetAge()),
+		Role:   req.GetRole(),
+		Active: req.Active,
+	}
+	if err := s.validate.Struct(create); err != nil {
+		return nil, validationError(err)
+	}
+
+	user, err := s.users.Create(ctx, create)
+	if err != nil {
+		return nil, serviceError(err)
+	}
+	s.requestLogger(ctx).Info("User created", zap.Int("user_id", user.ID))
+	s.recordAudit(ctx, "user.create", user.ID)
+	s.invalidateCache(ctx)
+	return userMessage(user), nil
+}
+
+func (s *userServer) UpdateUser(ctx context.Context, req *template2v1.UpdateUserRequest) (*template2v1.User, error) {
+	id, err := userID(req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	update := models.UpdateUserRequest{
+		Name:   req.Name,
+		Email:  req.Email,
+		Role:   req.Role,
+		Active: req.Active,
+	}
+	if req.Age != nil {
+		age := int(req.GetAge())
+		update.Age = &age
+	}
+	if err := s.validate.Struct(update); err != nil {
+		return nil, validationError(err)
+	}
+
+	previous, user, err := s.users.UpdateWithPrevious(ctx, id, update)
+	if err != nil {
+		return nil, serviceError(err)
+	}
+	if user.Role != previous.Role {
+		s.revokeTokens(ctx, user.ID, "role change")
+	}
+	s.requestLogger(ctx).Info("User updated", zap.Int("user_id", user.ID))
+	s.recordAudit(ctx, "user.update", user.ID)
+	s.invalidateCache(ctx)
+	return userMessage(user), nil
+}
+
+func (s *userServer) DeleteUser(ctx context.Context, req *template2v1.DeleteUserRequest) (*emptypb.Empty, error) {
+	id, err := userID(req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	if err := s.users.Delete(ctx, id); err != nil {
+		return nil, serviceError(err)
+	}
+	s.revokeTokens(ctx, id, "deletion")
+	s.requestLogger(ctx).Info("User deleted", zap.Int("user_id", id), zap.Bool("hard", false))
+	s.recordAudit(ctx, "user.delete", id)
+	s.invalidateCache(ctx)
+	return &emptypb.Empty{}, nil
+}
+
+// revokeTokens revokes the tokens of a user whose access changed. A failure
+// is logged rather than failing a change that has already been made.
+func (s *userServer) revokeTokens(ctx context.Context, userID int, reason string) {
+	if err := s.tokens.RevokeUserTokens(ctx, userID); err != nil {
+		s.requestLogger(ctx).Error("Failed to revoke tokens after "+reason,
+			zap.Int("user_id", userID), zap.Error(err))
+	}
+}
+
+// recordAudit writes an audit record of action applied to the user targetID
+// by the caller
+func (s *userServer) recordAudit(ctx context.Context, action string, targetID int) {
+	fields := []zap.Field{
+		zap.String("action", action),
+		zap.Int("target_id", targetID),
+		zap.String("ip", peerIP(ctx)),
+		zap.String("request_id", middleware.RequestIDFromContext(ctx)),
+	}
+	if claims, ok := ClaimsFromContext(ctx); ok {
+		fields = append(fields, zap.Int("actor_id", claims.UserID))
+	}
+	s.audit.Info("Audit", fields...)
+}
+
+// invalidateCache purges the HTTP response cache after a write, when set
+func (s *userServer) invalidateCache(ctx context.Context) {
+	if s.cache == nil {
+		return
+	}
+	if err := s.cache.Purge(ctx); err != nil {
+		s.requestLogger(ctx).Warn("Failed to invalidate the response cache", zap.Error(err))
+	}
+}
+
+func (s *userServer) requestLogger(ctx context.Context) *zap.Logger {
+	return contextLogger(ctx, s.logger)
+}
+
+// contextLogger returns logger annotated with the call's request ID
+func contextLogger(ctx context.Context, logger *zap.Logger) *zap.Logger {
+	if id := middleware.RequestIDFromContext(ctx); id != "" {
+		return logger.With(zap.String("request_id", id))
+	}
+	return logger
+}
+
+// userID checks a user ID from a request
+func userID(id int32) (int, error) {
+	if id <= 0 {
+		return 0, newError(codes.InvalidArgument, models.CodeInvalidID, "id must be a positive integer", map[string]string{"field": "id"})
+	}
+	return int(id), nil
+}
+
+// validationError fails a call whose request broke the rules of the model
+// it was converted to
+func validationError(err error) error {
+	if fields := apierror.ValidationFields(err); fields != nil {
+		return invalidArgument(fields)
+	}
+	return newError(codes.InvalidArgument, models.CodeValidationFailed, err.Error(), nil)
+}
+
+// encodePageToken returns the token of the page after the user with lastID
+func encodePageToken(lastID int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(lastID)))
+}
+
+// decodePageToken returns the ID of the user a page token follows, 0 for
+// the first page
+func decodePageToken(token string) (int, error) {
+	if token == "" {
+		return 0, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err == nil {
+		if id, err := strconv.Atoi(string(raw)); err == nil && id > 0 {
+			return id, nil
+		}
+	}
+	return 0, newError(codes.InvalidArgument, models.CodeInvalidPage, "Invalid page_token", map[string]string{"field": "page_token"})
+}
+
+// userMessage converts a user to its protobuf message
+func userMessage(user models.User) *template2v1.User {
+	msg := &template2v1.User{
+		Id:            int32(user.ID),
+		Name:          user.Name,
+		Email:         user.Email,
+		Role:          user.Role,
+		Active:        user.Active,
+		EmailVerified: user.EmailVerified,
+		CreatedAt:     timestamp(user.CreatedAt),
+		UpdatedAt:     timestamp(user.UpdatedAt),
+		LockedAt:      optionalTimestamp(user.LockedAt),
+	}
+	if user.Age != 0 {
+		age := int32(user.Age)
+		msg.Age = &age
+	}
+	return msg
+}
+
+func timestamp(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
+
+func optionalTimestamp(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
@@ -0,0 +1,293 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/cbwinslow/template2/examples/go/internal/middleware"
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+	"github.com/cbwinslow/template2/examples/go/pkg/audit"
+	"github.com/cbwinslow/template2/examples/go/pkg/auth"
+	"github.com/cbwinslow/template2/examples/go/pkg/flags"
+	"github.com/cbwinslow/template2/examples/go/pkg/pagination"
+)
+
+// maxAuditRecords caps the records one GetAuditLog call returns
+const maxAuditRecords = 500
+
+// AdminHandler serves the moderation endpoints of the admin API. Routes are
+// expected behind role and permission middleware; the handler itself only
+// guards against admins locking themselves out.
+type AdminHandler struct {
+	users  *models.UserService
+	auth   *auth.AuthService
+	logger *zap.Logger
+	audit  *zap.Logger
+	// records serves GetAuditLog when set
+	records audit.Store
+	// reset is set when ForcePasswordReset may mail reset links
+	reset *PasswordReset
+	// cache is purged after locks and unlocks when set
+	cache CacheInvalidator
+	// keys are revoked when an account is locked or its password reset
+	keys KeyRevoker
+	// level is the application log level GetLogLevel and SetLogLevel
+	// serve, when set
+	level *zap.AtomicLevel
+	// flags and flagStore serve the feature flag endpoints when set
+	flags     *flags.Client
+	flagStore flags.Store
+}
+
+// AdminHandlerOption configures an AdminHandler
+type AdminHandlerOption func(*AdminHandler)
+
+// WithAdminAudit records every moderation action to auditLogger and serves
+// the records kept in records, which may be nil
+func WithAdminAudit(auditLogger *zap.Logger, records audit.Store) AdminHandlerOption {
+	return func(h *AdminHandler) {
+		h.audit = auditLogger
+		h.records = records
+	}
+}
+
+// WithAdminPasswordReset enables ForcePasswordReset, which mails the reset
+// link as ForgotPassword does
+func WithAdminPasswordReset(reset PasswordReset) AdminHandlerOption {
+	return func(h *AdminHandler) {
+		h.reset = &reset
+	}
+}
+
+// NewAdminHandler creates an admin handler
+func NewAdminHandler(users *models.UserService, authService *auth.AuthService, logger *zap.Logger, opts ...AdminHandlerOption) *AdminHandler {
+	h := &AdminHandler{users: users, auth: authService, logger: logger, audit: zap.NewNop()}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// SearchUsers godoc
+// @Summary Search users
+// @Description Lists full user records, including locked and, on request, soft-deleted accounts. q matches a substring of the name or email; filter, sort and paging work as on GET /users.
+// @Tags admin
+// @Produce json
+// @Param q query string false "Text to find in the name or email"
+// @Param sort query string false "id, name, email or created_at; prefix with - for descending"
+// @Param filter query []string false "field:value on name, email, role or active; repeat to combine" collectionFormat(multi)
+// @Param page query int false "Page number, from 1"
+// @Param limit query int false "Users per page"
+// @Param include_deleted query bool false "Also list soft-deleted users"
+// @Success 200 {array} models.User
+// @Failure 400 {object} apierror.Problem
+// @Failure 403 {object} apierror.Problem
+// @Security ApiKeyAuth
+// @Router /admin/users [get]
+func (h *AdminHandler) SearchUsers(c *gin.Context) {
+	q, page, ok := parseUserQuery(c, models.UserSort{Field: "id"}, 20, 100)
+	if !ok {
+		return
+	}
+	q.Search = c.Query("q")
+
+	users, total, err := h.users.Query(c.Request.Context(), q)
+	if err != nil {
+		respondServiceError(c, err)
+		return
+	}
+
+	pagination.NewMeta(c.Request.URL, page, total).SetHeaders(c.Writer.Header())
+	rendered := make([]interface{}, len(users))
+	for i, user := range users {
+		rendered[i] = user.Render(models.FieldsAlways)
+	}
+	c.JSON(http.StatusOK, rendered)
+}
+
+// LockUser godoc
+// @Summary Lock an account
+// @Description Refuses the account's logins until it is unlocked, signs out every session and deletes its API keys. Locking a locked account changes nothing. Admins cannot lock their own account.
+// @Tags admin
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} models.User
+// @Failure 403 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 422 {object} apierror.Problem
+// @Security ApiKeyAuth
+// @Router /admin/users/{id}/lock [post]
+func (h *AdminHandler) LockUser(c *gin.Context) {
+	id, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+	if callerID, _ := middleware.GetUserID(c); callerID == id {
+		respondError(c, http.StatusUnprocessableEntity, models.CodeValidationFailed, "Admins cannot lock their own account")
+		return
+	}
+
+	user, err := h.users.SetLocked(c.Request.Context(), id, true)
+	if err != nil {
+		respondServiceError(c, err)
+		return
+	}
+	if err := h.auth.RevokeUserTokens(c.Request.Context(), id); err != nil {
+		respondServiceError(c, err)
+		return
+	}
+	revokeAPIKeys(c, h.keys, h.logger, id, "account lock")
+
+	middleware.RequestLogger(c, h.logger).Info("User locked", zap.Int("user_id", id))
+	writeAudit(c, h.audit, "user.lock", id)
+	invalidateCache(c, h.cache, h.logger)
+	c.JSON(http.StatusOK, user.Render(models.FieldsAlways))
+}
+
+// UnlockUser godoc
+// @Summary Unlock an account
+// @Description Lets the account log in again. Its earlier sessions and API keys stay revoked.
+// @Tags admin
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} models.User
+// @Failure 403 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Security ApiKeyAuth
+// @Router /admin/users/{id}/unlock [post]
+func (h *AdminHandler) UnlockUser(c *gin.Context) {
+	id, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+
+	user, err := h.users.SetLocked(c.Request.Context(), id, false)
+	if err != nil {
+		respondServiceError(c, err)
+		return
+	}
+
+	middleware.RequestLogger(c, h.logger).Info("User unlocked", zap.Int("user_id", id))
+	writeAudit(c, h.audit, "user.unlock", id)
+	invalidateCache(c, h.cache, h.logger)
+	c.JSON(http.StatusOK, user.Render(models.FieldsAlways))
+}
+
+// ForcePasswordReset godoc
+// @Summary Force a password reset
+// @Description Voids the account's password, signs out every session, deletes its API keys and mails the owner a reset link; the account is unusable until the link is followed.
+// @Tags admin
+// @Param id path int true "User ID"
+// @Success 202
+// @Failure 403 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Security ApiKeyAuth
+// @Router /admin/users/{id}/password-reset [post]
+func (h *AdminHandler) ForcePasswordReset(c *gin.Context) {
+	if h.reset == nil {
+		respondError(c, http.StatusNotFound, models.CodeNotFound, "Password reset is not enabled")
+		return
+	}
+	id, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	user, err := h.users.Get(ctx, id)
+	if err != nil {
+		respondServiceError(c, err)
+		return
+	}
+	token, err := h.auth.ForcePasswordReset(ctx, id)
+	if err != nil {
+		respondServiceError(c, err)
+		return
+	}
+	revokeAPIKeys(c, h.keys, h.logger, id, "forced password reset")
+
+	link, err := tokenLink(h.reset.URL, token)
+	if err == nil {
+		err = sendLinkMail(ctx, h.reset.Mailer, h.reset.Templates, "admin_reset_password", user, link)
+	}
+	if err != nil {
+		// The password is already void; retrying sends a fresh link
+		respondServiceError(c, err)
+		return
+	}
+
+	middleware.RequestLogger(c, h.logger).Info("Password reset forced", zap.Int("user_id", id))
+	writeAudit(c, h.audit, "user.force_password_reset", id)
+	c.Status(http.StatusAccepted)
+}
+
+// GetAuditLog godoc
+// @Summary Search audit records
+// @Description Returns audit records newest first: who did what to which resource, from which IP and in which request, with the fields an update changed.
+// @Description Records are kept in the database for the configured retention or, without one, the most recent are kept in memory; older records are then only in the audit log file.
+// @Tags admin
+// @Produce json
+// @Param action query string false "Only records of this action, e.g. user.lock"
+// @Param actor_id query int false "Only records of changes made by this user"
+// @Param target_id query int false "Only records of changes made to this user"
+// @Param since query string false "Only records from this RFC 3339 time on"
+// @Param until query string false "Only records before this RFC 3339 time"
+// @Param limit query int false "Records to return, at most 500"
+// @Success 200 {array} audit.Record
+// @Failure 400 {object} apierror.Problem
+// @Failure 403 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Security ApiKeyAuth
+// @Router /admin/audit [get]
+func (h *AdminHandler) GetAuditLog(c *gin.Context) {
+	if h.records == nil {
+		respondError(c, http.StatusNotFound, models.CodeNotFound, "The audit trail is not enabled")
+		return
+	}
+
+	q := audit.Query{Action: c.Query("action"), Limit: 100}
+	for _, param := range []struct {
+		name string
+		dest *int
+	}{{"actor_id", &q.ActorID}, {"target_id", &q.TargetID}, {"limit", &q.Limit}} {
+		name, dest := param.name, param.dest
+		raw := c.Query(name)
+		if raw == "" {
+			continue
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 || (name == "limit" && n > maxAuditRecords) {
+			middleware.AbortWithError(c, models.NewError(http.StatusBadRequest, models.CodeValidationFailed, "Invalid "+name).
+				WithDetails(map[string]interface{}{"parameter": name, "max_limit": maxAuditRecords}))
+			return
+		}
+		*dest = n
+	}
+	for _, param := range []struct {
+		name string
+		dest *time.Time
+	}{{"since", &q.Since}, {"until", &q.Until}} {
+		raw := c.Query(param.name)
+		if raw == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			middleware.AbortWithError(c, models.NewError(http.StatusBadRequest, models.CodeValidationFailed, "Invalid "+param.name).
+				WithDetails(map[string]interface{}{"parameter": param.name, "format": "RFC 3339"}))
+			return
+		}
+		*param.dest = t
+	}
+
+	records, err := h.records.Query(c.Request.Context(), q)
+	if err != nil {
+		respondServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, records)
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/cbwinslow/template2/examples/go/internal/logging"
+	"github.com/cbwinslow/template2/examples/go/internal/middleware"
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+)
+
+func TestAdminModeration(t *testing.T) {
+	ctx := context.Background()
+	authService, users := newAuthFixture(t)
+	hana, _ := users.GetByEmail(ctx, "hana@example.com")
+	adminToken, _ := authService.GenerateToken(ctx, 1, "alice@example.com", models.RoleAdmin)
+	hanaToken, _ := authService.GenerateToken(ctx, hana.ID, hana.Email, models.RoleUser)
+	mail := &recordingMailer{}
+	trail := logging.NewAuditTrail(10)
+
+	h := NewAdminHandler(users, authService, zap.NewNop(),
+		WithAdminAudit(zap.New(trail.Core()), trail),
+		WithAdminPasswordReset(PasswordReset{Mailer: mail, URL: "https://app.example.com/reset"}))
+	router := gin.New()
+	router.POST("/auth/login", NewAuthHandler(authService, users, zap.NewNop()).Login)
+	admin := router.Group("/admin", middleware.AuthRequired(authService), middleware.RequireRole(models.RoleAdmin))
+	admin.GET("/users", h.SearchUsers)
+	admin.POST("/users/:id/lock", middleware.RequirePermission(models.PermUsersLock), h.LockUser)
+	admin.POST("/users/:id/unlock", middleware.RequirePermission(models.PermUsersLock), h.UnlockUser)
+	admin.POST("/users/:id/password-reset", middleware.RequirePermission(models.PermUsersWrite), h.ForcePasswordReset)
+	admin.GET("/audit", middleware.RequirePermission(models.PermAuditRead), h.GetAuditLog)
+	do := func(method, path, token string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		router.ServeHTTP(w, req)
+		return w
+	}
+	hanaLogin := `{"email":"hana@example.com","password":"s3cret-pass"}`
+
+	if w := do(http.MethodPost, "/admin/users/1/lock", hanaToken); w.Code != http.StatusForbidden {
+		t.Errorf("lock as a user: status = %d, want 403", w.Code)
+	}
+	if w := do(http.MethodPost, "/admin/users/1/lock", adminToken); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("lock self: status = %d, want 422", w.Code)
+	}
+
+	w := do(http.MethodGet, "/admin/users?q=HANA", adminToken)
+	var found []models.User
+	if err := json.Unmarshal(w.Body.Bytes(), &found); err != nil || len(found) != 1 || found[0].ID != hana.ID {
+		t.Fatalf("search hana: %d %s", w.Code, w.Body.String())
+	}
+
+	if w := do(http.MethodPost, "/admin/users/3/lock", adminToken); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"locked_at":"`) {
+		t.Fatalf("lock: %d %s", w.Code, w.Body.String())
+	}
+	if w := login(router, hanaLogin); w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), string(models.CodeAccountLocked)) {
+		t.Errorf("login while locked: %d %s", w.Code, w.Body.String())
+	}
+	if _, err := authService.ValidateToken(ctx, hanaToken); err == nil {
+		t.Error("token issued before the lock still validates")
+	}
+	if w := do(http.MethodPost, "/admin/users/3/unlock", adminToken); w.Code != http.StatusOK {
+		t.Fatalf("unlock: %d %s", w.Code, w.Body.String())
+	}
+	if w := login(router, hanaLogin); w.Code != http.StatusOK {
+		t.Errorf("login after unlock: status = %d, want 200", w.Code)
+	}
+
+	if w := do(http.MethodPost, "/admin/users/3/password-reset", adminToken); w.Code != http.StatusAccepted {
+		t.Fatalf("force reset: %d %s", w.Code, w.Body.String())
+	}
+	if len(mail.sent) != 1 || mail.sent[0].To != "hana@example.com" || !strings.Contains(mail.sent[0].Body, "https://app.example.com/reset?token=") {
+		t.Errorf("sent %+v, want a reset link to hana@example.com", mail.sent)
+	}
+	if w := login(router, hanaLogin); w.Code != http.StatusUnauthorized {
+		t.Errorf("old password after forced reset: status = %d, want 401", w.Code)
+	}
+
+	w = do(http.MethodGet, "/admin/audit?target_id=3&limit=2", adminToken)
+	var records []logging.AuditRecord
+	if err := json.Unmarshal(w.Body.Bytes(), &records); err != nil || len(records) != 2 {
+		t.Fatalf("audit: %d %s", w.Code, w.Body.String())
+	}
+	if records[0].Action != "user.force_password_reset" || records[1].Action != "user.unlock" || records[0].ActorID != 1 {
+		t.Errorf("audit records = %+v", records)
+	}
+	if w := do(http.MethodGet, "/admin/audit?limit=5000", adminToken); w.Code != http.StatusBadRequest {
+		t.Errorf("audit limit over the cap: status = %d, want 400", w.Code)
+	}
+	if w := do(http.MethodGet, "/admin/audit?until=2000-01-01T00:00:00Z", adminToken); w.Code != http.StatusOK || w.Body.String() != "[]" {
+		t.Errorf("audit before 2000: %d %s, want no records", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodGet, "/admin/audit?since=yesterday", adminToken); w.Code != http.StatusBadRequest {
+		t.Errorf("audit since an invalid time: status = %d, want 400", w.Code)
+	}
+}
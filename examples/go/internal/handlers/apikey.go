@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/cbwinslow/template2/examples/go/internal/middleware"
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+	"github.com/cbwinslow/template2/examples/go/pkg/auth/apikey"
+)
+
+// APIKeyManager is the part of the API key service the handlers use
+type APIKeyManager interface {
+	Create(ctx context.Context, userID int, name string) (apikey.Key, string, error)
+	List(ctx context.Context, userID int) ([]apikey.Key, error)
+	Revoke(ctx context.Context, userID int, id string) error
+}
+
+// KeyRevoker deletes every API key of a user, such as an apikey.Service
+type KeyRevoker interface {
+	RevokeAll(ctx context.Context, userID int) error
+}
+
+// WithKeyRevoker deletes a user's API keys along with their tokens on
+// RevokeTokens and DeleteUser
+func WithKeyRevoker(keys KeyRevoker) UserHandlerOption {
+	return func(h *UserHandler) {
+		h.keys = keys
+	}
+}
+
+// WithAuthKeyRevoker deletes a user's API keys when they reset their
+// password
+func WithAuthKeyRevoker(keys KeyRevoker) AuthHandlerOption {
+	return func(h *AuthHandler) {
+		h.keys = keys
+	}
+}
+
+// WithAdminKeyRevoker deletes a user's API keys when an admin locks their
+// account or forces a password reset
+func WithAdminKeyRevoker(keys KeyRevoker) AdminHandlerOption {
+	return func(h *AdminHandler) {
+		h.keys = keys
+	}
+}
+
+// revokeAPIKeys deletes the user's API keys after their credentials were
+// revoked. The change that called for it has already been made, so a
+// failure is logged rather than failing the request.
+func revokeAPIKeys(c *gin.Context, keys KeyRevoker, logger *zap.Logger, userID int, reason string) {
+	if keys == nil {
+		return
+	}
+	if err := keys.RevokeAll(c.Request.Context(), userID); err != nil {
+		middleware.RequestLogger(c, logger).Error("Failed to revoke API keys after "+reason,
+			zap.Int("user_id", userID), zap.Error(err))
+	}
+}
+
+// CreateAPIKeyRequest names a new API key
+type CreateAPIKeyRequest struct {
+	Name string `json:"name" binding:"required,max=100"`
+}
+
+// CreateAPIKeyResponse returns a new key together with its plaintext, which
+// is not shown again
+type CreateAPIKeyResponse struct {
+	apikey.Key
+	Secret string `json:"key"`
+}
+
+// APIKeyHandler serves the API key management endpoints for the
+// authenticated user
+type APIKeyHandler struct {
+	keys   APIKeyManager
+	logger *zap.Logger
+}
+
+// NewAPIKeyHandler creates an API key handler
+func NewAPIKeyHandler(keys APIKeyManager, logger *zap.Logger) *APIKeyHandler {
+	return &APIKeyHandler{keys: keys, logger: logger}
+}
+
+// CreateAPIKey godoc
+// @Summary Create an API key
+// @Description The key is returned once; send it in the X-API-Key header instead of a bearer token. Keys are managed with a bearer token only, so a key cannot mint further keys.
+// @Tags api-keys
+// @Accept json
+// @Produce json
+// @Param key body CreateAPIKeyRequest true "Key"
+// @Success 201 {object} CreateAPIKeyResponse
+// @Failure 400 {object} apierror.Problem
+// @Failure 422 {object} apierror.Problem
+// @Router /protected/api-keys [post]
+func (h *APIKeyHandler) CreateAPIKey(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		respondError(c, http.StatusUnauthorized, models.CodeUnauthorized, "Authentication required")
+		return
+	}
+	var req CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	key, secret, err := h.keys.Create(c.Request.Context(), userID, req.Name)
+	if err != nil {
+		respondServiceError(c, err)
+		return
+	}
+
+	middleware.RequestLogger(c, h.logger).Info("API key created", zap.Int("user_id", userID), zap.String("key_id", key.ID))
+	c.JSON(http.StatusCreated, CreateAPIKeyResponse{Key: key, Secret: secret})
+}
+
+// ListAPIKeys godoc
+// @Summary List API keys
+// @Tags api-keys
+// @Produce json
+// @Success 200 {array} apikey.Key
+// @Router /protected/api-keys [get]
+func (h *APIKeyHandler) ListAPIKeys(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		respondError(c, http.StatusUnauthorized, models.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	keys, err := h.keys.List(c.Request.Context(), userID)
+	if err != nil {
+		respondServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, keys)
+}
+
+// RevokeAPIKey godoc
+// @Summary Revoke an API key
+// @Tags api-keys
+// @Param key_id path string true "Key ID"
+// @Success 204
+// @Failure 404 {object} apierror.Problem
+// @Router /protected/api-keys/{key_id} [delete]
+func (h *APIKeyHandler) RevokeAPIKey(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		respondError(c, http.StatusUnauthorized, models.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	err := h.keys.Revoke(c.Request.Context(), userID, c.Param("key_id"))
+	if errors.Is(err, apikey.ErrKeyNotFound) {
+		respondError(c, http.StatusNotFound, models.CodeNotFound, "API key not found")
+		return
+	}
+	if err != nil {
+		respondServiceError(c, err)
+		return
+	}
+
+	middleware.RequestLogger(c, h.logger).Info("API key revoked", zap.Int("user_id", userID), zap.String("key_id", c.Param("key_id")))
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/cbwinslow/template2/examples/go/internal/middleware"
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+	"github.com/cbwinslow/template2/examples/go/pkg/auth"
+	"github.com/cbwinslow/template2/examples/go/pkg/auth/apikey"
+)
+
+func TestAPIKeyHandlerLifecycle(t *testing.T) {
+	authService := auth.NewAuthService()
+	token, _ := authService.GenerateToken(context.Background(), 2, "bob@example.com", models.RoleUser)
+	h := NewAPIKeyHandler(apikey.NewService(apikey.NewMemoryStore()), zap.NewNop())
+	router := gin.New()
+	router.Use(middleware.AuthRequired(authService))
+	router.POST("/api-keys", h.CreateAPIKey)
+	router.GET("/api-keys", h.ListAPIKeys)
+	router.DELETE("/api-keys/:key_id", h.RevokeAPIKey)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api-keys", strings.NewReader(`{"name":"ci"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: status = %d: %s", w.Code, w.Body.String())
+	}
+	var created CreateAPIKeyResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil || created.Secret == "" || created.UserID != 2 {
+		t.Fatalf("create body = %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/api-keys", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	router.ServeHTTP(w, req)
+	if strings.Contains(w.Body.String(), created.Secret) {
+		t.Error("listing exposes the key secret")
+	}
+	var keys []apikey.Key
+	if err := json.Unmarshal(w.Body.Bytes(), &keys); err != nil || len(keys) != 1 || keys[0].ID != created.ID {
+		t.Fatalf("list body = %s", w.Body.String())
+	}
+
+	for _, want := range []int{http.StatusNoContent, http.StatusNotFound} {
+		w = httptest.NewRecorder()
+		req = httptest.NewRequest(http.MethodDelete, "/api-keys/"+created.ID, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		router.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Errorf("revoke: status = %d, want %d", w.Code, want)
+		}
+	}
+}
+
+func TestCredentialRevocationDeletesAPIKeys(t *testing.T) {
+	for _, tt := range []struct {
+		method, path string
+	}{
+		{http.MethodPost, "/users/2/revoke-tokens"},
+		{http.MethodDelete, "/users/2"},
+	} {
+		ctx := context.Background()
+		keys := apikey.NewService(apikey.NewMemoryStore())
+		_, plaintext, _ := keys.Create(ctx, 2, "ci")
+		h := NewUserHandler(models.NewUserService(), &recordingRevoker{}, zap.NewNop(), WithKeyRevoker(keys))
+		router := gin.New()
+		router.POST("/users/:id/revoke-tokens", h.RevokeTokens)
+		router.DELETE("/users/:id", h.DeleteUser)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("%s %s: status = %d: %s", tt.method, tt.path, w.Code, w.Body.String())
+		}
+		if _, err := keys.Authenticate(ctx, plaintext); !errors.Is(err, apikey.ErrInvalidKey) {
+			t.Errorf("%s %s: key still works: err = %v", tt.method, tt.path, err)
+		}
+	}
+}
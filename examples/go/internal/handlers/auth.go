@@ -0,0 +1,463 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"go.uber.org/zap"
+
+	"github.com/cbwinslow/template2/examples/go/internal/middleware"
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+	"github.com/cbwinslow/template2/examples/go/pkg/apierror"
+	"github.com/cbwinslow/template2/examples/go/pkg/auth"
+	"github.com/cbwinslow/template2/examples/go/pkg/auth/websession"
+	"github.com/cbwinslow/template2/examples/go/pkg/jobs"
+)
+
+// LoginRequest is the payload accepted by Login
+type LoginRequest struct {
+	Email    string `json:"email" form:"email" binding:"required,email"`
+	Password string `json:"password" form:"password" binding:"required"`
+}
+
+// RegisterRequest is the payload accepted by Register
+type RegisterRequest struct {
+	Name     string `json:"name" binding:"required,max=100,username"`
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required,password"`
+	Age      int    `json:"age" binding:"omitempty,gt=0,lte=150"`
+}
+
+// RefreshRequest is the payload accepted by Refresh and Logout
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" form:"refresh_token" binding:"required"`
+}
+
+// TokenResponse is returned on successful login and refresh
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+// TokenCookie describes the cookie Login sets when cookie auth is enabled
+type TokenCookie struct {
+	Name   string
+	Domain string
+	Secure bool
+}
+
+// AuthHandler serves the authentication endpoints
+type AuthHandler struct {
+	auth     *auth.AuthService
+	users    *models.UserService
+	logger   *zap.Logger
+	cookie   *TokenCookie
+	stuffing *auth.StuffingDetector
+	// sessions is set when logins start cookie sessions instead of
+	// returning tokens
+	sessions      *websession.Service
+	sessionCookie TokenCookie
+	oidc          OIDCFlow
+	// verification is set when new users must verify their email
+	verification *EmailVerification
+	// reset is set when users may reset a forgotten password
+	reset *PasswordReset
+	// twoFactor is set when users may enroll in two-factor authentication
+	twoFactor bool
+	// cache is purged after flows that create or change users when set
+	cache CacheInvalidator
+	// keys are revoked on ResetPassword when set
+	keys KeyRevoker
+	// jobs sends registration and reset mail after responding when set
+	jobs *jobs.Queue
+	// resets counts the ForgotPassword requests still being handled in the
+	// background without a job queue
+	resets sync.WaitGroup
+}
+
+// AuthHandlerOption configures an AuthHandler
+type AuthHandlerOption func(*AuthHandler)
+
+// WithLoginCookie makes Login also set the access token as an HttpOnly cookie
+func WithLoginCookie(cookie TokenCookie) AuthHandlerOption {
+	return func(h *AuthHandler) {
+		h.cookie = &cookie
+	}
+}
+
+// WithWebSessions makes logins start a server-side session named by an
+// HttpOnly cookie instead of returning tokens, for browser apps
+func WithWebSessions(sessions *websession.Service, cookie TokenCookie) AuthHandlerOption {
+	return func(h *AuthHandler) {
+		h.sessions = sessions
+		h.sessionCookie = cookie
+	}
+}
+
+// WithStuffingDetector throttles client IPs that fail logins for many
+// different accounts
+func WithStuffingDetector(detector *auth.StuffingDetector) AuthHandlerOption {
+	return func(h *AuthHandler) {
+		h.stuffing = detector
+	}
+}
+
+// NewAuthHandler creates an auth handler
+func NewAuthHandler(authService *auth.AuthService, users *models.UserService, logger *zap.Logger, opts ...AuthHandlerOption) *AuthHandler {
+	h := &AuthHandler{auth: authService, users: users, logger: logger}
+	for _, opt := range opts {
+		opt(h)
+	}
+	if h.jobs != nil {
+		h.registerJobs()
+	}
+	return h
+}
+
+// Login godoc
+// @Summary Log in
+// @Description Exchanges email and password for an access token and a refresh token. Credentials may be posted as JSON or as a form, as OAuth-style clients do. When cookie auth is enabled the token is also set as an HttpOnly cookie. With cookie sessions the tokens stay on the server and the response is 204 with a session cookie. Accounts with two-factor authentication get 202 with a challenge token to send to /auth/2fa/verify instead. Accounts locked by an admin get 403 once the password checks out.
+// @Tags auth
+// @Accept json,x-www-form-urlencoded
+// @Produce json
+// @Param credentials body LoginRequest true "Credentials"
+// @Success 200 {object} TokenResponse
+// @Success 202 {object} TwoFactorChallengeResponse
+// @Success 204 "Cookie session started"
+// @Failure 400 {object} apierror.Problem
+// @Failure 401 {object} apierror.Problem
+// @Failure 403 {object} apierror.Problem
+// @Failure 415 {object} apierror.Problem
+// @Failure 422 {object} apierror.Problem
+// @Failure 429 {object} apierror.Problem
+// @Router /auth/login [post]
+func (h *AuthHandler) Login(c *gin.Context) {
+	if apiErr := h.loginBlocked(c); apiErr != nil {
+		middleware.AbortWithError(c, apiErr)
+		return
+	}
+
+	var req LoginRequest
+	if !bindJSONOrForm(c, &req) {
+		return
+	}
+
+	user, apiErr := h.checkCredentials(c, req)
+	if apiErr != nil {
+		middleware.AbortWithError(c, apiErr)
+		return
+	}
+	if h.twoFactor {
+		enabled, err := h.auth.TwoFactorEnabled(c.Request.Context(), user.ID)
+		if err != nil {
+			respondServiceError(c, err)
+			return
+		}
+		if enabled {
+			h.respondChallenge(c, user.ID)
+			return
+		}
+	}
+
+	pair, err := h.auth.IssueTokenPair(c.Request.Context(), user.ID, user.Email, user.Role, sessionClient(c))
+	if err != nil {
+		respondServiceError(c, err)
+		return
+	}
+
+	middleware.RequestLogger(c, h.logger).Info("User logged in", zap.Int("user_id", user.ID))
+	h.respondTokens(c, pair)
+}
+
+// loginBlocked returns the error a login from a client IP the stuffing
+// detector throttles fails with, setting Retry-After, and nil otherwise
+func (h *AuthHandler) loginBlocked(c *gin.Context) *apierror.Error {
+	if h.stuffing == nil {
+		return nil
+	}
+	retry, blocked := h.stuffing.Blocked(c.ClientIP())
+	if !blocked {
+		return nil
+	}
+	retryAfter := int(math.Ceil(retry.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	return models.NewError(http.StatusTooManyRequests, models.CodeRateLimited, "Too many failed logins from this address").
+		WithDetails(map[string]interface{}{"retry_after_seconds": retryAfter})
+}
+
+// checkCredentials returns the user req signs in as, or the error the login
+// fails with. A wrong email or password counts towards the stuffing
+// detector, and the account must not be locked. An unknown email still costs
+// a bcrypt compare, so it takes as long to fail as a wrong password.
+func (h *AuthHandler) checkCredentials(c *gin.Context, req LoginRequest) (models.User, *apierror.Error) {
+	user, err := h.users.GetByEmail(c.Request.Context(), req.Email)
+	switch {
+	case err == nil:
+		err = h.auth.CheckPassword(c.Request.Context(), user.ID, req.Password)
+	case errors.Is(err, models.ErrUserNotFound):
+		err = h.auth.RejectPassword(c.Request.Context(), req.Password)
+	}
+	if err != nil {
+		if !errors.Is(err, models.ErrUserNotFound) && !errors.Is(err, auth.ErrInvalidCredentials) {
+			return models.User{}, serviceError(err)
+		}
+		middleware.RequestLogger(c, h.logger).Info("Login failed", zap.String("ip", c.ClientIP()))
+		h.recordLoginFailure(c, req.Email)
+		return models.User{}, models.NewError(http.StatusUnauthorized, models.CodeInvalidCredentials, "Invalid email or password")
+	}
+	if user.LockedAt != nil {
+		return models.User{}, accountLockedError()
+	}
+	return user, nil
+}
+
+// Refresh godoc
+// @Summary Refresh an access token
+// @Description Exchanges a refresh token for a new access token and refresh token. The presented refresh token is retired; presenting it again after a short grace window revokes the whole session.
+// @Tags auth
+// @Accept json,x-www-form-urlencoded
+// @Produce json
+// @Param token body RefreshRequest true "Refresh token"
+// @Success 200 {object} TokenResponse
+// @Failure 400 {object} apierror.Problem
+// @Failure 401 {object} apierror.Problem
+// @Failure 422 {object} apierror.Problem
+// @Router /auth/refresh [post]
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var req RefreshRequest
+	if !bindJSONOrForm(c, &req) {
+		return
+	}
+
+	pair, err := h.auth.Refresh(c.Request.Context(), req.RefreshToken, sessionClient(c))
+	if err != nil {
+		if errors.Is(err, auth.ErrRefreshReused) {
+			middleware.RequestLogger(c, h.logger).Warn("Refresh token reused; session revoked",
+				zap.String("event", "refresh_token_reused"),
+				zap.String("ip", c.ClientIP()))
+		}
+		if isTokenError(err) {
+			respondError(c, http.StatusUnauthorized, models.CodeTokenInvalid, "Invalid or expired refresh token")
+			return
+		}
+		respondServiceError(c, err)
+		return
+	}
+
+	h.respondTokens(c, pair)
+}
+
+// Logout godoc
+// @Summary Log out
+// @Description Revokes the refresh token and every token rotated from it, ending the session. Access tokens issued in the session are rejected from the next request. With cookie sessions the session cookie is signed out instead and no body is needed.
+// @Tags auth
+// @Accept json,x-www-form-urlencoded
+// @Param token body RefreshRequest false "Refresh token"
+// @Success 204
+// @Failure 400 {object} apierror.Problem
+// @Failure 422 {object} apierror.Problem
+// @Router /auth/logout [post]
+func (h *AuthHandler) Logout(c *gin.Context) {
+	if h.sessions != nil {
+		if id, err := c.Cookie(h.sessionCookie.Name); err == nil && id != "" {
+			if err := h.sessions.End(c.Request.Context(), id); err != nil {
+				respondServiceError(c, err)
+				return
+			}
+			c.SetCookie(h.sessionCookie.Name, "", -1, "/", h.sessionCookie.Domain, h.sessionCookie.Secure, true)
+			c.Status(http.StatusNoContent)
+			return
+		}
+	}
+
+	var req RefreshRequest
+	if !bindJSONOrForm(c, &req) {
+		return
+	}
+
+	if err := h.auth.RevokeRefreshToken(c.Request.Context(), req.RefreshToken); err != nil {
+		respondServiceError(c, err)
+		return
+	}
+
+	if h.cookie != nil {
+		c.SetCookie(h.cookie.Name, "", -1, "/", h.cookie.Domain, h.cookie.Secure, true)
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// respondTokens writes a token pair, also setting the access token cookie
+// when cookie auth is enabled. With cookie sessions the pair is kept in a
+// new session instead, and only its cookie is sent.
+func (h *AuthHandler) respondTokens(c *gin.Context, pair auth.TokenPair) {
+	if h.sessions != nil {
+		id, err := h.sessions.Start(c.Request.Context(), pair)
+		if err != nil {
+			respondServiceError(c, err)
+			return
+		}
+		// Lax rather than Strict, so following a link into the app keeps
+		// the user signed in; CSRF guards the requests Lax still allows
+		c.SetSameSite(http.SameSiteLaxMode)
+		c.SetCookie(h.sessionCookie.Name, id, int(h.auth.RefreshTTL().Seconds()), "/", h.sessionCookie.Domain, h.sessionCookie.Secure, true)
+		c.Status(http.StatusNoContent)
+		return
+	}
+	if h.cookie != nil {
+		c.SetSameSite(http.SameSiteStrictMode)
+		c.SetCookie(h.cookie.Name, pair.AccessToken, int(pair.ExpiresIn.Seconds()), "/", h.cookie.Domain, h.cookie.Secure, true)
+	}
+
+	c.JSON(http.StatusOK, TokenResponse{
+		AccessToken:  pair.AccessToken,
+		RefreshToken: pair.RefreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(pair.ExpiresIn.Seconds()),
+	})
+}
+
+// bindJSONOrForm binds a JSON or URL-encoded form body into obj, responding
+// with 415, 400 or 422 and returning false when it cannot. ShouldBind picks the
+// binding from Content-Type; this limits it to the two documented formats
+// rather than everything gin can decode.
+func bindJSONOrForm(c *gin.Context, obj interface{}) bool {
+	var err error
+	switch c.ContentType() {
+	case binding.MIMEJSON, binding.MIMEPOSTForm:
+		err = c.ShouldBind(obj)
+	case "":
+		// Bodies without a Content-Type have always been read as JSON
+		err = c.ShouldBindJSON(obj)
+	default:
+		respondError(c, http.StatusUnsupportedMediaType, models.CodeUnsupportedMedia,
+			"Expected application/json or application/x-www-form-urlencoded")
+		return false
+	}
+	if err != nil {
+		respondBindError(c, err)
+		return false
+	}
+	return true
+}
+
+func isTokenError(err error) bool {
+	return errors.Is(err, auth.ErrInvalidToken) || errors.Is(err, auth.ErrTokenRevoked) || errors.Is(err, auth.ErrRefreshReused)
+}
+
+// Register godoc
+// @Summary Register an account
+// @Description When email verification is enabled the account starts unverified and a verification link is mailed to it, in the background when a job queue runs; protected routes answer 403 until the link is opened.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param account body RegisterRequest true "Account"
+// @Success 201 {object} models.User
+// @Failure 400 {object} apierror.Problem
+// @Failure 409 {object} apierror.Problem
+// @Failure 422 {object} apierror.Problem
+// @Router /auth/register [post]
+func (h *AuthHandler) Register(c *gin.Context) {
+	var req RegisterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	ctx := c.Request.Context()
+	verified := h.verification == nil
+	user, err := h.users.Create(ctx, models.CreateUserRequest{Name: req.Name, Email: req.Email, Age: req.Age, EmailVerified: &verified})
+	if err != nil {
+		respondServiceError(c, err)
+		return
+	}
+
+	if err := h.auth.SetPassword(c.Request.Context(), user.ID, req.Password); err != nil {
+		_ = h.users.HardDelete(ctx, user.ID)
+		respondServiceError(c, err)
+		return
+	}
+	if !verified {
+		if err := h.queueVerification(ctx, user); err != nil {
+			// Without the mail the account could never be verified, so
+			// undo it and let the user register again
+			middleware.RequestLogger(c, h.logger).Error("Failed to send verification email", zap.Int("user_id", user.ID), zap.Error(err))
+			_ = h.users.HardDelete(ctx, user.ID)
+			respondServiceError(c, err)
+			return
+		}
+	}
+
+	middleware.RequestLogger(c, h.logger).Info("User registered", zap.Int("user_id", user.ID))
+	invalidateCache(c, h.cache, h.logger)
+	c.JSON(http.StatusCreated, user)
+}
+
+// GetProfile godoc
+// @Summary Get the authenticated user's profile
+// @Tags auth
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} models.User
+// @Failure 401 {object} apierror.Problem
+// @Router /protected/profile [get]
+func (h *AuthHandler) GetProfile(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		respondError(c, http.StatusUnauthorized, models.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	user, err := h.users.Get(c.Request.Context(), userID)
+	if err != nil {
+		respondServiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// respondAccountLocked aborts a login to an account an admin has locked
+func respondAccountLocked(c *gin.Context) {
+	middleware.AbortWithError(c, accountLockedError())
+}
+
+// accountLockedError is the error a login to a locked account fails with
+// CertPrincipal resolves client certificates, which are issued with the
+// account email as their CN, to the account's claims. A locked account is
+// refused with 403, as its logins are.
+func CertPrincipal(users *models.UserService) middleware.CertPrincipalResolver {
+	return func(ctx context.Context, cn string) (*auth.Claims, error) {
+		user, err := users.GetByEmail(ctx, cn)
+		if err != nil {
+			return nil, err
+		}
+		if user.LockedAt != nil {
+			return nil, accountLockedError()
+		}
+		return &auth.Claims{UserID: user.ID, Email: user.Email, Role: user.Role}, nil
+	}
+}
+
+func accountLockedError() *apierror.Error {
+	return models.NewError(http.StatusForbidden, models.CodeAccountLocked, "This account is locked; contact an administrator")
+}
+
+func (h *AuthHandler) recordLoginFailure(c *gin.Context, email string) {
+	if h.stuffing == nil {
+		return
+	}
+	if accounts, blocked := h.stuffing.RecordFailure(c.ClientIP(), email); blocked {
+		middleware.RequestLogger(c, h.logger).Warn("Credential stuffing suspected",
+			zap.String("event", "credential_stuffing_suspected"),
+			zap.String("ip", c.ClientIP()),
+			zap.Int("accounts", accounts))
+	}
+}
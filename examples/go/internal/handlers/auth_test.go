@@ -0,0 +1,368 @@
+package handlers
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/cbwinslow/template2/examples/go/internal/middleware"
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+	"github.com/cbwinslow/template2/examples/go/pkg/apierror"
+	"github.com/cbwinslow/template2/examples/go/pkg/auth"
+	"github.com/cbwinslow/template2/examples/go/pkg/auth/websession"
+)
+
+// newAuthFixture returns services with a registered user hana@example.com
+// whose password is "s3cret-pass"
+func newAuthFixture(t *testing.T) (*auth.AuthService, *models.UserService) {
+	t.Helper()
+	authService := auth.NewAuthService()
+	users := models.NewUserService()
+
+	user, err := users.Create(context.Background(), models.CreateUserRequest{Name: "Hana", Email: "hana@example.com"})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := authService.SetPassword(context.Background(), user.ID, "s3cret-pass"); err != nil {
+		t.Fatalf("SetPassword: %v", err)
+	}
+	return authService, users
+}
+
+func newAuthRouter(authService *auth.AuthService, users *models.UserService, cookie *TokenCookie) *gin.Engine {
+	var opts []AuthHandlerOption
+	var authOpts []middleware.AuthOption
+	if cookie != nil {
+		opts = append(opts, WithLoginCookie(*cookie))
+		authOpts = append(authOpts, middleware.WithTokenCookie(cookie.Name))
+	}
+	h := NewAuthHandler(authService, users, zap.NewNop(), opts...)
+
+	router := gin.New()
+	router.POST("/auth/login", h.Login)
+	router.POST("/auth/refresh", h.Refresh)
+	router.POST("/auth/logout", h.Logout)
+	router.GET("/protected/profile", middleware.AuthRequired(authService, authOpts...), h.GetProfile)
+	return router
+}
+
+func login(router *gin.Engine, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/auth/login", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestLoginWithCookieAuthenticatesProfile(t *testing.T) {
+	authService, users := newAuthFixture(t)
+	router := newAuthRouter(authService, users, &TokenCookie{Name: "access_token", Secure: true})
+
+	w := login(router, `{"email":"hana@example.com","password":"s3cret-pass"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("login status = %d: %s", w.Code, w.Body.String())
+	}
+
+	var cookie *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name == "access_token" {
+			cookie = c
+		}
+	}
+	if cookie == nil || !cookie.HttpOnly || !cookie.Secure {
+		t.Fatalf("login cookie = %+v, want a secure HttpOnly access_token cookie", cookie)
+	}
+
+	profile := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/protected/profile", nil)
+	req.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+	router.ServeHTTP(profile, req)
+
+	if profile.Code != http.StatusOK || !strings.Contains(profile.Body.String(), "hana@example.com") {
+		t.Errorf("profile via cookie: got %d %s", profile.Code, profile.Body.String())
+	}
+}
+
+func TestLoginWithWebSessionUntilLogout(t *testing.T) {
+	authService, users := newAuthFixture(t)
+	sessions := websession.NewService(websession.NewMemoryStore(), authService, authService.RefreshTTL())
+	h := NewAuthHandler(authService, users, zap.NewNop(), WithWebSessions(sessions, TokenCookie{Name: "session", Secure: true}))
+	router := gin.New()
+	router.POST("/auth/login", h.Login)
+	router.POST("/auth/logout", h.Logout)
+	router.GET("/protected/profile", middleware.AuthRequired(authService, middleware.WithSessionCookie("session",
+		func(c *gin.Context, id string) (string, error) { return sessions.AccessToken(c.Request.Context(), id) })), h.GetProfile)
+
+	w := login(router, `{"email":"hana@example.com","password":"s3cret-pass"}`)
+	if w.Code != http.StatusNoContent || w.Body.Len() != 0 {
+		t.Fatalf("login: got %d %s, want 204 without tokens", w.Code, w.Body.String())
+	}
+	var cookie *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name == "session" {
+			cookie = c
+		}
+	}
+	if cookie == nil || !cookie.HttpOnly || !cookie.Secure || cookie.SameSite != http.SameSiteLaxMode {
+		t.Fatalf("session cookie = %+v, want a secure HttpOnly SameSite=Lax cookie", cookie)
+	}
+
+	profile := func() int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/protected/profile", nil)
+		req.AddCookie(&http.Cookie{Name: "session", Value: cookie.Value})
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	if status := profile(); status != http.StatusOK {
+		t.Fatalf("profile via session: status %d", status)
+	}
+
+	logout := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/auth/logout", nil)
+	req.AddCookie(&http.Cookie{Name: "session", Value: cookie.Value})
+	router.ServeHTTP(logout, req)
+	if logout.Code != http.StatusNoContent {
+		t.Fatalf("logout: got %d %s", logout.Code, logout.Body.String())
+	}
+	if status := profile(); status != http.StatusUnauthorized {
+		t.Errorf("profile after logout: status %d, want 401", status)
+	}
+}
+
+func TestLoginWithHeaderAuthenticatesProfile(t *testing.T) {
+	authService, users := newAuthFixture(t)
+	router := newAuthRouter(authService, users, nil)
+
+	w := login(router, `{"email":"hana@example.com","password":"s3cret-pass"}`)
+	if len(w.Result().Cookies()) != 0 {
+		t.Error("login set a cookie although cookie auth is disabled")
+	}
+	var tokens TokenResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &tokens); err != nil || tokens.AccessToken == "" {
+		t.Fatalf("login body = %s", w.Body.String())
+	}
+
+	profile := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/protected/profile", nil)
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+	router.ServeHTTP(profile, req)
+
+	if profile.Code != http.StatusOK {
+		t.Errorf("profile via header: got %d %s", profile.Code, profile.Body.String())
+	}
+}
+
+func TestLoginRejectsWrongPassword(t *testing.T) {
+	authService, users := newAuthFixture(t)
+
+	w := login(newAuthRouter(authService, users, nil), `{"email":"hana@example.com","password":"nope"}`)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want 401", w.Code)
+	}
+}
+
+func TestLoginAcceptsJSONAndFormBodies(t *testing.T) {
+	authService, users := newAuthFixture(t)
+	router := newAuthRouter(authService, users, nil)
+
+	bodies := map[string]string{
+		"application/json":                  `{"email":"hana@example.com","password":"s3cret-pass"}`,
+		"application/x-www-form-urlencoded": "email=hana%40example.com&password=s3cret-pass",
+		"":                                  `{"email":"hana@example.com","password":"s3cret-pass"}`,
+	}
+	for contentType, body := range bodies {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/auth/login", strings.NewReader(body))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		router.ServeHTTP(w, req)
+
+		var resp TokenResponse
+		if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &resp) != nil || resp.AccessToken == "" {
+			t.Errorf("Content-Type %q: got %d %s, want a token", contentType, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestLoginRejectsUnsupportedContentType(t *testing.T) {
+	authService, users := newAuthFixture(t)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/auth/login",
+		strings.NewReader(`<login><email>hana@example.com</email></login>`))
+	req.Header.Set("Content-Type", "application/xml")
+	newAuthRouter(authService, users, nil).ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("status = %d, want 415", w.Code)
+	}
+}
+
+func TestLoginThrottlesCredentialStuffing(t *testing.T) {
+	authService, users := newAuthFixture(t)
+	core, logs := observer.New(zap.WarnLevel)
+	h := NewAuthHandler(authService, users, zap.New(core),
+		WithStuffingDetector(auth.NewStuffingDetector(3, time.Minute, time.Minute)))
+	router := gin.New()
+	router.POST("/auth/login", h.Login)
+
+	for i := 0; i < 3; i++ {
+		w := login(router, fmt.Sprintf(`{"email":"victim%d@example.com","password":"guess"}`, i))
+		if w.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: status = %d, want 401", i+1, w.Code)
+		}
+	}
+
+	// Even valid credentials are refused from the throttled address
+	w := login(router, `{"email":"hana@example.com","password":"s3cret-pass"}`)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("status = %d, Retry-After = %q; want 429 with Retry-After", w.Code, w.Header().Get("Retry-After"))
+	}
+	if logs.FilterField(zap.String("event", "credential_stuffing_suspected")).Len() != 1 {
+		t.Errorf("security events = %d, want 1", logs.Len())
+	}
+}
+
+func TestLoginThrottleIgnoresSpoofedForwardedFor(t *testing.T) {
+	authService, users := newAuthFixture(t)
+	h := NewAuthHandler(authService, users, zap.NewNop(),
+		WithStuffingDetector(auth.NewStuffingDetector(3, time.Minute, time.Minute)))
+	router := gin.New()
+	if err := middleware.TrustProxies(router, nil); err != nil {
+		t.Fatal(err)
+	}
+	router.POST("/auth/login", h.Login)
+
+	var w *httptest.ResponseRecorder
+	for i := 0; i < 4; i++ {
+		w = httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/auth/login",
+			strings.NewReader(fmt.Sprintf(`{"email":"victim%d@example.com","password":"guess"}`, i)))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Forwarded-For", fmt.Sprintf("203.0.113.%d", i+1))
+		req.Header.Set("X-Real-IP", fmt.Sprintf("198.51.100.%d", i+1))
+		router.ServeHTTP(w, req)
+	}
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("fourth attempt from a fresh forwarded address: status = %d, want 429", w.Code)
+	}
+}
+
+func postRefreshToken(router *gin.Engine, path, token string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(fmt.Sprintf(`{"refresh_token":%q}`, token)))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestRefreshRotatesTokens(t *testing.T) {
+	authService, users := newAuthFixture(t)
+	router := newAuthRouter(authService, users, nil)
+
+	var first TokenResponse
+	w := login(router, `{"email":"hana@example.com","password":"s3cret-pass"}`)
+	if err := json.Unmarshal(w.Body.Bytes(), &first); err != nil || first.RefreshToken == "" {
+		t.Fatalf("login: %d %s", w.Code, w.Body.String())
+	}
+
+	w = postRefreshToken(router, "/auth/refresh", first.RefreshToken)
+	var second TokenResponse
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &second) != nil {
+		t.Fatalf("refresh: %d %s", w.Code, w.Body.String())
+	}
+	if second.RefreshToken == first.RefreshToken {
+		t.Error("refresh token was not rotated")
+	}
+
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/protected/profile", nil)
+	req.Header.Set("Authorization", "Bearer "+second.AccessToken)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("profile with refreshed token: status = %d", w.Code)
+	}
+
+	if w := postRefreshToken(router, "/auth/refresh", "not-a-token"); w.Code != http.StatusUnauthorized {
+		t.Errorf("unknown refresh token: status = %d, want 401", w.Code)
+	}
+}
+
+func TestLogoutRevokesRefreshToken(t *testing.T) {
+	authService, users := newAuthFixture(t)
+	router := newAuthRouter(authService, users, nil)
+
+	var tokens TokenResponse
+	w := login(router, `{"email":"hana@example.com","password":"s3cret-pass"}`)
+	if err := json.Unmarshal(w.Body.Bytes(), &tokens); err != nil {
+		t.Fatalf("login: %d %s", w.Code, w.Body.String())
+	}
+
+	if w := postRefreshToken(router, "/auth/logout", tokens.RefreshToken); w.Code != http.StatusNoContent {
+		t.Fatalf("logout: status = %d, want 204", w.Code)
+	}
+	w = postRefreshToken(router, "/auth/refresh", tokens.RefreshToken)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("refresh after logout: status = %d, want 401", w.Code)
+	}
+
+	var body apierror.Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Code != string(models.CodeTokenInvalid) {
+		t.Errorf("body = %s, want code %s", w.Body.String(), models.CodeTokenInvalid)
+	}
+}
+
+func TestCertPrincipalRefusesLockedAccounts(t *testing.T) {
+	authService, users := newAuthFixture(t)
+	hana, _ := users.GetByEmail(context.Background(), "hana@example.com")
+	resolve := CertPrincipal(users)
+	router := gin.New()
+	router.GET("/verified", middleware.AuthRequired(authService, middleware.WithVerifiedClientCert(resolve)), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	router.GET("/forwarded", middleware.AuthRequired(authService, middleware.WithClientCert("X-Client-Cert-CN",
+		[]netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}, resolve)), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	call := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: "hana@example.com"}}}}}
+		req.RemoteAddr = "10.1.2.3:4000"
+		req.Header.Set("X-Client-Cert-CN", "hana@example.com")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	for _, path := range []string{"/verified", "/forwarded"} {
+		if w := call(path); w.Code != http.StatusNoContent {
+			t.Fatalf("%s before locking: status = %d", path, w.Code)
+		}
+	}
+	if _, err := users.SetLocked(context.Background(), hana.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"/verified", "/forwarded"} {
+		w := call(path)
+		var problem apierror.Problem
+		_ = json.Unmarshal(w.Body.Bytes(), &problem)
+		if w.Code != http.StatusForbidden || problem.Code != string(models.CodeAccountLocked) {
+			t.Errorf("%s after locking: got %d %s, want 403 %s", path, w.Code, problem.Code, models.CodeAccountLocked)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/cbwinslow/template2/examples/go/internal/avatar"
+	"github.com/cbwinslow/template2/examples/go/internal/middleware"
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+)
+
+// AvatarHandler serves user avatar uploads and downloads
+type AvatarHandler struct {
+	avatars *avatar.Service
+	users   *models.UserService
+	logger  *zap.Logger
+}
+
+// NewAvatarHandler creates an avatar handler
+func NewAvatarHandler(avatars *avatar.Service, users *models.UserService, logger *zap.Logger) *AvatarHandler {
+	return &AvatarHandler{avatars: avatars, users: users, logger: logger}
+}
+
+// UploadAvatar godoc
+// @Summary Set a user's avatar
+// @Description Takes the image as the raw request body. Users may set their own avatar; setting another user's needs the users:write permission.
+// @Description The thumbnail and medium sizes are rendered in the background; until they are ready the original is served for them.
+// @Tags users
+// @Accept image/jpeg,image/png,image/gif
+// @Param id path int true "User ID"
+// @Success 202
+// @Failure 403 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 413 {object} apierror.Problem
+// @Failure 415 {object} apierror.Problem
+// @Failure 422 {object} apierror.Problem
+// @Security ApiKeyAuth
+// @Router /users/{id}/avatar [put]
+func (h *AvatarHandler) UploadAvatar(c *gin.Context) {
+	id, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+	if callerID, _ := middleware.GetUserID(c); callerID != id && !models.RoleHasPermission(middleware.GetRole(c), models.PermUsersWrite) {
+		respondError(c, http.StatusForbidden, models.CodeForbidden, "Users may only set their own avatar")
+		return
+	}
+	if _, err := h.users.Get(c.Request.Context(), id); err != nil {
+		respondServiceError(c, err)
+		return
+	}
+
+	err := h.avatars.Upload(c.Request.Context(), id, c.Request.Body)
+	var dimErr *avatar.DimensionError
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.Is(err, avatar.ErrTooLarge), errors.As(err, &tooLarge):
+		respondError(c, http.StatusRequestEntityTooLarge, models.CodePayloadTooLarge, "Image is too large")
+		return
+	case errors.Is(err, avatar.ErrUnsupportedFormat):
+		middleware.AbortWithError(c, models.NewError(http.StatusUnsupportedMediaType, models.CodeUnsupportedMedia, "Avatars must be JPEG, PNG or GIF images").
+			WithDetails(map[string]interface{}{"supported": []string{"image/jpeg", "image/png", "image/gif"}}))
+		return
+	case errors.As(err, &dimErr):
+		middleware.AbortWithError(c, models.NewError(http.StatusUnprocessableEntity, models.CodeValidationFailed, "Image dimensions are out of range").
+			WithDetails(map[string]interface{}{"width": dimErr.Width, "height": dimErr.Height, "min": dimErr.Min, "max": dimErr.Max}))
+		return
+	case err != nil:
+		respondServiceError(c, err)
+		return
+	}
+
+	middleware.RequestLogger(c, h.logger).Info("Avatar uploaded", zap.Int("user_id", id))
+	c.Header("Location", c.Request.URL.Path)
+	c.Status(http.StatusAccepted)
+}
+
+// GetAvatar godoc
+// @Summary Get a user's avatar
+// @Description Serves the avatar in the requested size, medium by default. Last-Modified is honored, and Range requests are answered with 206 Partial Content.
+// @Tags users
+// @Produce image/png,image/jpeg,image/gif
+// @Param id path int true "User ID"
+// @Param size query string false "thumbnail, medium or original"
+// @Success 200
+// @Success 206
+// @Failure 400 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Security ApiKeyAuth
+// @Router /users/{id}/avatar [get]
+func (h *AvatarHandler) GetAvatar(c *gin.Context) {
+	id, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+
+	size := c.Query("size")
+	if size == "" {
+		size = "medium"
+	}
+	r, obj, err := h.avatars.Open(c.Request.Context(), id, size)
+	switch {
+	case errors.Is(err, avatar.ErrUnknownVariant):
+		middleware.AbortWithError(c, models.NewError(http.StatusBadRequest, models.CodeValidationFailed, "Unknown avatar size").
+			WithDetails(map[string]interface{}{"supported": h.avatars.Sizes()}))
+		return
+	case errors.Is(err, avatar.ErrNotFound):
+		respondError(c, http.StatusNotFound, models.CodeNotFound, "The user has no avatar")
+		return
+	case err != nil:
+		respondServiceError(c, err)
+		return
+	}
+	defer r.Close()
+
+	c.Header("Cache-Control", "private, no-cache")
+	serveObject(c, obj, r)
+}
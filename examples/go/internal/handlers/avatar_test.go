@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/cbwinslow/template2/examples/go/internal/avatar"
+	"github.com/cbwinslow/template2/examples/go/internal/middleware"
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+	"github.com/cbwinslow/template2/examples/go/pkg/auth"
+	"github.com/cbwinslow/template2/examples/go/pkg/storage"
+)
+
+func TestAvatarUploadAndSizes(t *testing.T) {
+	ctx := context.Background()
+	store, _ := storage.NewLocalStore(t.TempDir())
+	avatars := avatar.NewService(store, zap.NewNop())
+	authService := auth.NewAuthService()
+	userToken, _ := authService.GenerateToken(ctx, 2, "bob@example.com", models.RoleUser)
+	h := NewAvatarHandler(avatars, models.NewUserService(), zap.NewNop())
+	router := gin.New()
+	router.Use(middleware.AuthRequired(authService))
+	router.PUT("/users/:id/avatar", h.UploadAvatar)
+	router.GET("/users/:id/avatar", h.GetAvatar)
+
+	var img bytes.Buffer
+	png.Encode(&img, image.NewRGBA(image.Rect(0, 0, 300, 300)))
+	put := func(id string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPut, "/users/"+id+"/avatar", bytes.NewReader(img.Bytes()))
+		req.Header.Set("Content-Type", "image/png")
+		req.Header.Set("Authorization", "Bearer "+userToken)
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	if code := put("1"); code != http.StatusForbidden {
+		t.Errorf("other user's avatar: status = %d, want 403", code)
+	}
+	if code := put("2"); code != http.StatusAccepted {
+		t.Fatalf("own avatar: status = %d, want 202", code)
+	}
+	avatars.Close(ctx)
+
+	for size, want := range map[string]int{"thumbnail": 64, "": 256, "original": 300} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/users/2/avatar?size="+size, nil)
+		req.Header.Set("Authorization", "Bearer "+userToken)
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("size %q: status = %d", size, w.Code)
+		}
+		got, err := png.DecodeConfig(w.Body)
+		if err != nil || got.Width != want {
+			t.Errorf("size %q: width %d (err %v), want %d", size, got.Width, err, want)
+		}
+	}
+
+	// The first bytes of the original are the PNG signature
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/users/2/avatar?size=original", nil)
+	req.Header.Set("Authorization", "Bearer "+userToken)
+	req.Header.Set("Accept", "image/png")
+	req.Header.Set("Range", "bytes=0-7")
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusPartialContent || w.Body.String() != "\x89PNG\r\n\x1a\n" {
+		t.Errorf("ranged original: status = %d, body = %q, want 206 with the PNG signature", w.Code, w.Body.String())
+	}
+	if got, want := w.Header().Get("Content-Range"), fmt.Sprintf("bytes 0-7/%d", img.Len()); got != want {
+		t.Errorf("Content-Range = %q, want %q", got, want)
+	}
+	if got := w.Header().Get("Content-Type"); got != "image/png" {
+		t.Errorf("Content-Type = %q, want image/png", got)
+	}
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/users/2/avatar?size=huge", nil)
+	req.Header.Set("Authorization", "Bearer "+userToken)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("unknown size: status = %d, want 400", w.Code)
+	}
+}
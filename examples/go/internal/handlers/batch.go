@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"go.uber.org/zap"
+
+	"github.com/cbwinslow/template2/examples/go/internal/middleware"
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+)
+
+// MaxBatchCreate caps the number of users in one BatchCreateUsers call
+const MaxBatchCreate = 100
+
+// maxNameLength mirrors the max=100 binding on CreateUserRequest.Name
+const maxNameLength = 100
+
+// Warning codes reported in BatchWarning.Code
+const (
+	WarningFieldTruncated = "FIELD_TRUNCATED"
+)
+
+// BatchWarning describes a non-fatal issue with one batch item. The item was
+// still processed, possibly with an adjusted value; hard failures are
+// reported in the item's result instead.
+type BatchWarning struct {
+	Index   int    `json:"index"`
+	Field   string `json:"field,omitempty"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// BatchResponse is the body returned by batch endpoints: one result per item
+// in request order, plus any warnings raised while processing them
+type BatchResponse struct {
+	Results  interface{}    `json:"results"`
+	Warnings []BatchWarning `json:"warnings"`
+}
+
+// respondBatch writes a BatchResponse, always encoding warnings as an array
+func respondBatch(c *gin.Context, results interface{}, warnings []BatchWarning) {
+	if warnings == nil {
+		warnings = []BatchWarning{}
+	}
+	c.JSON(http.StatusOK, BatchResponse{Results: results, Warnings: warnings})
+}
+
+// BatchCreateUsersRequest is the payload accepted by BatchCreateUsers. Items
+// are validated individually so one bad item does not reject the batch.
+type BatchCreateUsersRequest struct {
+	Users []models.CreateUserRequest `json:"users" binding:"required,min=1"`
+}
+
+// BatchCreateResult reports the outcome of one item of a batch create
+type BatchCreateResult struct {
+	Index  int              `json:"index"`
+	Status string           `json:"status"`
+	User   interface{}      `json:"user,omitempty"`
+	Error  *models.APIError `json:"error,omitempty"`
+}
+
+// BatchCreateUsers godoc
+// @Summary Create several users
+// @Description Creates each user independently. Failures are reported per item; non-fatal adjustments, such as a name truncated to 100 characters, are reported as warnings.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param users body BatchCreateUsersRequest true "Users"
+// @Success 200 {object} BatchResponse{results=[]BatchCreateResult}
+// @Failure 400 {object} apierror.Problem
+// @Failure 413 {object} apierror.Problem
+// @Failure 422 {object} apierror.Problem
+// @Router /users/batch [post]
+func (h *UserHandler) BatchCreateUsers(c *gin.Context) {
+	var req BatchCreateUsersRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	if len(req.Users) > MaxBatchCreate {
+		respondError(c, http.StatusRequestEntityTooLarge, models.CodeBatchTooLarge,
+			fmt.Sprintf("At most %d users are allowed per request", MaxBatchCreate))
+		return
+	}
+
+	results := make([]BatchCreateResult, 0, len(req.Users))
+	var warnings []BatchWarning
+	for i, item := range req.Users {
+		if utf8.RuneCountInString(item.Name) > maxNameLength {
+			item.Name = string([]rune(item.Name)[:maxNameLength])
+			warnings = append(warnings, BatchWarning{
+				Index:   i,
+				Field:   "name",
+				Code:    WarningFieldTruncated,
+				Message: fmt.Sprintf("Name truncated to %d characters", maxNameLength),
+			})
+		}
+		results = append(results, h.batchCreate(c, i, item))
+	}
+
+	for _, result := range results {
+		if result.Status == "created" {
+			invalidateCache(c, h.cache, h.logger)
+			break
+		}
+	}
+	respondBatch(c, results, warnings)
+}
+
+func (h *UserHandler) batchCreate(c *gin.Context, index int, item models.CreateUserRequest) BatchCreateResult {
+	result := BatchCreateResult{Index: index}
+
+	if err := binding.Validator.ValidateStruct(&item); err != nil {
+		result.Status = "failed"
+		result.Error = &models.APIError{Code: models.CodeValidationFailed, Message: err.Error()}
+		return result
+	}
+
+	user, err := h.users.Create(c.Request.Context(), item)
+	if err != nil {
+		result.Status = "failed"
+		result.Error = itemError(err)
+		return result
+	}
+
+	middleware.RequestLogger(c, h.logger).Info("User created", zap.Int("user_id", user.ID))
+	h.recordAudit(c, "user.create", user.ID)
+	result.Status = "created"
+	result.User = user.Render(h.fieldPolicy)
+	return result
+}
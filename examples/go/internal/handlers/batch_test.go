@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+)
+
+func TestBatchCreateSurfacesWarningsWithoutFailing(t *testing.T) {
+	svc := models.NewUserService()
+	h := NewUserHandler(svc, &recordingRevoker{}, zap.NewNop())
+	router := gin.New()
+	router.POST("/users/batch", h.BatchCreateUsers)
+
+	longName := strings.Repeat("n", 120)
+	body := `{"users":[
+		{"name":"` + longName + `","email":"long@example.com"},
+		{"name":"Dup","email":"alice@example.com"},
+		{"name":"Bad","email":"not-an-email"},
+		{"name":"Jo","email":"jo@example.com"}
+	]}`
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/users/batch", strings.NewReader(body)))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Results  []BatchCreateResult `json:"results"`
+		Warnings []BatchWarning      `json:"warnings"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	want := []struct {
+		status string
+		code   models.ErrorCode
+	}{
+		{"created", ""},
+		{"failed", models.CodeEmailTaken},
+		{"failed", models.CodeValidationFailed},
+		{"created", ""},
+	}
+	if len(resp.Results) != len(want) {
+		t.Fatalf("got %d results, want %d", len(resp.Results), len(want))
+	}
+	for i, w := range want {
+		got := resp.Results[i]
+		var code models.ErrorCode
+		if got.Error != nil {
+			code = got.Error.Code
+		}
+		if got.Index != i || got.Status != w.status || code != w.code {
+			t.Errorf("result %d = %d/%s/%s, want %s/%s", i, got.Index, got.Status, code, w.status, w.code)
+		}
+	}
+
+	if len(resp.Warnings) != 1 || resp.Warnings[0].Index != 0 || resp.Warnings[0].Code != WarningFieldTruncated {
+		t.Fatalf("warnings = %+v, want one truncation warning for item 0", resp.Warnings)
+	}
+	created, err := svc.GetByEmail(context.Background(), "long@example.com")
+	if err != nil || len(created.Name) != maxNameLength {
+		t.Errorf("stored name length = %d (err %v), want %d", len(created.Name), err, maxNameLength)
+	}
+}
+
+func TestAssignRolesReturnsEmptyWarnings(t *testing.T) {
+	router := newUserRouter(models.NewUserService(), &recordingRevoker{})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/users/roles",
+		strings.NewReader(`{"assignments":[{"user_id":2,"role":"admin"}]}`)))
+
+	if !strings.Contains(w.Body.String(), `"warnings":[]`) {
+		t.Errorf("body = %s, want an empty warnings array", w.Body.String())
+	}
+}
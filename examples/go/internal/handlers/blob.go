@@ -0,0 +1,21 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/cbwinslow/template2/examples/go/pkg/storage"
+)
+
+// serveObject writes a stored object with http.ServeContent, which answers
+// a satisfiable Range with 206 Partial Content so interrupted downloads can
+// resume, and honors If-Modified-Since and If-Range against the object's
+// modification time
+func serveObject(c *gin.Context, obj storage.Object, content io.ReadSeeker) {
+	if obj.ContentType != "" {
+		c.Header("Content-Type", obj.ContentType)
+	}
+	http.ServeContent(c.Writer, c.Request, "", obj.ModTime, content)
+}
@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"go.uber.org/zap"
+
+	"github.com/cbwinslow/template2/examples/go/internal/middleware"
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+	"github.com/cbwinslow/template2/examples/go/pkg/audit"
+)
+
+// MaxBulkOperations caps the number of operations in one BulkUsers call
+const MaxBulkOperations = 100
+
+// Operations accepted by BulkUsers
+const (
+	bulkCreate = "create"
+	bulkUpdate = "update"
+	bulkDelete = "delete"
+)
+
+// Statuses reported in BulkResult.Status
+const (
+	bulkCreated = "created"
+	bulkUpdated = "updated"
+	bulkDeleted = "deleted"
+	bulkFailed  = "failed"
+	// bulkRolledBack marks an operation that succeeded but was undone
+	// because a later one in the same transaction failed
+	bulkRolledBack = "rolled_back"
+	// bulkSkipped marks an operation not attempted because an earlier one
+	// in the same transaction failed
+	bulkSkipped = "skipped"
+)
+
+// BulkOperation is one item of a BulkUsers call. Data holds a
+// models.CreateUserRequest for create and a models.UpdateUserRequest for
+// update; delete takes none.
+type BulkOperation struct {
+	Op string `json:"op" binding:"required,oneof=create update delete"`
+	// ID is the user to update or delete
+	ID   int             `json:"id" binding:"required_unless=Op create,gte=0"`
+	Data json.RawMessage `json:"data" swaggertype:"object"`
+}
+
+// BulkUsersRequest is the payload accepted by BulkUsers
+type BulkUsersRequest struct {
+	Operations []BulkOperation `json:"operations" binding:"required,min=1,dive"`
+}
+
+// BulkResult reports the outcome of one operation of a BulkUsers call
+type BulkResult struct {
+	Index  int              `json:"index"`
+	Op     string           `json:"op"`
+	Status string           `json:"status"`
+	User   interface{}      `json:"user,omitempty"`
+	Error  *models.APIError `json:"error,omitempty"`
+	// roleChanged marks an update that changed the user's role, and
+	// previous holds the user before it
+	roleChanged bool
+	previous    models.User
+}
+
+// BulkResponse is the body returned by BulkUsers. Atomic tells whether the
+// operations ran in one transaction, in which case either all of them took
+// effect or none did.
+type BulkResponse struct {
+	Atomic  bool         `json:"atomic"`
+	Results []BulkResult `json:"results"`
+}
+
+// errBulkAborted rolls back the transaction of a bulk call whose operation
+// failed; the failure itself is reported in the operation's result
+var errBulkAborted = errors.New("bulk operation failed")
+
+// BulkUsers godoc
+// @Summary Create, update and delete several users
+// @Description Applies the operations in order. When the user store supports transactions they run atomically: the first failure stops the call and undoes every earlier operation, which is reported as rolled_back, and the rest are skipped.
+// @Description Otherwise each operation is applied independently, and atomic is false in the response.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param operations body BulkUsersRequest true "Operations"
+// @Success 200 {object} BulkResponse
+// @Failure 400 {object} apierror.Problem
+// @Failure 403 {object} apierror.Problem
+// @Failure 409 {object} apierror.Problem
+// @Failure 413 {object} apierror.Problem
+// @Failure 422 {object} apierror.Problem
+// @Router /users/bulk [post]
+func (h *UserHandler) BulkUsers(c *gin.Context) {
+	var req BulkUsersRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	if len(req.Operations) > MaxBulkOperations {
+		respondError(c, http.StatusRequestEntityTooLarge, models.CodeBatchTooLarge,
+			fmt.Sprintf("At most %d operations are allowed per request", MaxBulkOperations))
+		return
+	}
+	// The route needs the write permission; deletes also need the one
+	// DeleteUser requires
+	for _, op := range req.Operations {
+		if op.Op == bulkDelete && !models.RoleHasPermission(middleware.GetRole(c), models.PermUsersDelete) {
+			middleware.AbortWithError(c, models.NewError(http.StatusForbidden, models.CodeForbidden, "Insufficient permissions for delete operations").
+				WithDetails(map[string]interface{}{"required_permission": models.PermUsersDelete}))
+			return
+		}
+	}
+
+	results := make([]BulkResult, len(req.Operations))
+	for i, op := range req.Operations {
+		results[i] = BulkResult{Index: i, Op: op.Op, Status: bulkSkipped}
+	}
+
+	atomic := h.users.Transactional()
+	if atomic {
+		err := h.users.InTx(c.Request.Context(), func(tx *models.UserService) error {
+			for i, op := range req.Operations {
+				if results[i] = h.bulkApply(c, tx, i, op); results[i].Status == bulkFailed {
+					return errBulkAborted
+				}
+			}
+			return nil
+		})
+		if errors.Is(err, errBulkAborted) {
+			for i := range results {
+				if results[i].Status != bulkFailed && results[i].Status != bulkSkipped {
+					results[i].Status = bulkRolledBack
+					results[i].User = nil
+				}
+			}
+		} else if err != nil {
+			respondServiceError(c, err)
+			return
+		}
+	} else {
+		for i, op := range req.Operations {
+			results[i] = h.bulkApply(c, h.users, i, op)
+		}
+	}
+
+	// Only operations that took effect are logged and audited
+	logger := middleware.RequestLogger(c, h.logger)
+	changed := false
+	for _, result := range results {
+		id := req.Operations[result.Index].ID
+		switch result.Status {
+		case bulkCreated:
+			id = result.User.(models.User).ID
+			logger.Info("User created", zap.Int("user_id", id))
+			h.recordAudit(c, "user.create", id)
+		case bulkUpdated:
+			if result.roleChanged {
+				h.revokeTokens(c, id, "role change")
+			}
+			logger.Info("User updated", zap.Int("user_id", id))
+			h.recordAudit(c, "user.update", id, audit.Changes(result.previous, result.User))
+		case bulkDeleted:
+			h.revokeTokens(c, id, "deletion")
+			revokeAPIKeys(c, h.keys, h.logger, id, "deletion")
+			logger.Info("User deleted", zap.Int("user_id", id), zap.Bool("hard", false))
+			h.recordAudit(c, "user.delete", id)
+		default:
+			continue
+		}
+		changed = true
+	}
+	if changed {
+		invalidateCache(c, h.cache, h.logger)
+	}
+
+	for i := range results {
+		if user, ok := results[i].User.(models.User); ok {
+			results[i].User = user.Render(h.fieldPolicy)
+		}
+	}
+	c.JSON(http.StatusOK, BulkResponse{Atomic: atomic, Results: results})
+}
+
+// bulkApply runs one operation against users, which is the transaction's
+// service in an atomic call. Created and updated users are returned
+// unrendered in the result's User.
+func (h *UserHandler) bulkApply(c *gin.Context, users *models.UserService, index int, op BulkOperation) BulkResult {
+	result := BulkResult{Index: index, Op: op.Op}
+	fail := func(err error) BulkResult {
+		result.Status = bulkFailed
+		result.Error = itemError(err)
+		return result
+	}
+	invalid := func(err error) BulkResult {
+		result.Status = bulkFailed
+		result.Error = &models.APIError{Code: models.CodeValidationFailed, Message: err.Error()}
+		return result
+	}
+
+	ctx := c.Request.Context()
+	switch op.Op {
+	case bulkCreate:
+		var item models.CreateUserRequest
+		if err := decodeBulkData(op.Data, &item); err != nil {
+			return invalid(err)
+		}
+		user, err := users.Create(ctx, item)
+		if err != nil {
+			return fail(err)
+		}
+		result.Status, result.User = bulkCreated, user
+	case bulkUpdate:
+		var item models.UpdateUserRequest
+		if err := decodeBulkData(op.Data, &item); err != nil {
+			return invalid(err)
+		}
+		previous, user, err := users.UpdateWithPrevious(ctx, op.ID, item)
+		if err != nil {
+			return fail(err)
+		}
+		result.Status, result.User = bulkUpdated, user
+		result.previous = previous
+		result.roleChanged = user.Role != previous.Role
+	case bulkDelete:
+		if err := users.Delete(ctx, op.ID); err != nil {
+			return fail(err)
+		}
+		result.Status = bulkDeleted
+	}
+	return result
+}
+
+// decodeBulkData decodes and validates the data of a create or update
+func decodeBulkData(data json.RawMessage, obj interface{}) error {
+	if len(data) == 0 {
+		return errors.New("data is required")
+	}
+	if err := json.Unmarshal(data, obj); err != nil {
+		return err
+	}
+	return binding.Validator.ValidateStruct(obj)
+}
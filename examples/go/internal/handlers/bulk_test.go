@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/cbwinslow/template2/examples/go/internal/middleware"
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+	"github.com/cbwinslow/template2/examples/go/pkg/auth"
+)
+
+func newBulkRouter(svc *models.UserService) (*gin.Engine, func(role string) string) {
+	authService := auth.NewAuthService()
+	h := NewUserHandler(svc, &recordingRevoker{}, zap.NewNop())
+	router := gin.New()
+	router.Use(middleware.AuthRequired(authService))
+	router.POST("/users/bulk", h.BulkUsers)
+	token := func(role string) string {
+		token, _ := authService.GenerateToken(context.Background(), 1, "alice@example.com", role)
+		return token
+	}
+	return router, token
+}
+
+func sendBulk(t *testing.T, router *gin.Engine, token, body string) (int, BulkResponse) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/users/bulk", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	router.ServeHTTP(w, req)
+	var resp BulkResponse
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+	}
+	return w.Code, resp
+}
+
+func TestBulkUsersAppliesEveryOperation(t *testing.T) {
+	svc := models.NewUserService()
+	router, token := newBulkRouter(svc)
+
+	status, resp := sendBulk(t, router, token(models.RoleAdmin), `{"operations":[
+		{"op":"create","data":{"name":"Carol","email":"carol@example.com"}},
+		{"op":"update","id":1,"data":{"name":"Alice Smith"}},
+		{"op":"delete","id":2}
+	]}`)
+	if status != http.StatusOK {
+		t.Fatalf("status = %d", status)
+	}
+	if !resp.Atomic {
+		t.Error("atomic = false, want true for the memory store")
+	}
+	for i, want := range []string{bulkCreated, bulkUpdated, bulkDeleted} {
+		if got := resp.Results[i].Status; got != want {
+			t.Errorf("result %d: status = %q, want %q", i, got, want)
+		}
+	}
+
+	ctx := context.Background()
+	if _, err := svc.GetByEmail(ctx, "carol@example.com"); err != nil {
+		t.Errorf("created user: %v", err)
+	}
+	if user, _ := svc.Get(ctx, 1); user.Name != "Alice Smith" {
+		t.Errorf("updated name = %q", user.Name)
+	}
+	if _, err := svc.Get(ctx, 2); !errors.Is(err, models.ErrUserNotFound) {
+		t.Errorf("deleted user: err = %v, want ErrUserNotFound", err)
+	}
+}
+
+func TestBulkUsersRollsBackOnFailure(t *testing.T) {
+	svc := models.NewUserService()
+	router, token := newBulkRouter(svc)
+
+	status, resp := sendBulk(t, router, token(models.RoleAdmin), `{"operations":[
+		{"op":"create","data":{"name":"Carol","email":"carol@example.com"}},
+		{"op":"delete","id":2},
+		{"op":"create","data":{"name":"Dup","email":"alice@example.com"}},
+		{"op":"update","id":1,"data":{"name":"Alice Smith"}}
+	]}`)
+	if status != http.StatusOK {
+		t.Fatalf("status = %d", status)
+	}
+	want := []struct {
+		status string
+		code   models.ErrorCode
+	}{
+		{bulkRolledBack, ""},
+		{bulkRolledBack, ""},
+		{bulkFailed, models.CodeEmailTaken},
+		{bulkSkipped, ""},
+	}
+	for i, w := range want {
+		got := resp.Results[i]
+		var code models.ErrorCode
+		if got.Error != nil {
+			code = got.Error.Code
+		}
+		if got.Status != w.status || code != w.code {
+			t.Errorf("result %d = %s/%s, want %s/%s", i, got.Status, code, w.status, w.code)
+		}
+		if got.User != nil {
+			t.Errorf("result %d still carries a user", i)
+		}
+	}
+
+	ctx := context.Background()
+	if _, err := svc.GetByEmail(ctx, "carol@example.com"); !errors.Is(err, models.ErrUserNotFound) {
+		t.Errorf("rolled back create: err = %v, want ErrUserNotFound", err)
+	}
+	if _, err := svc.Get(ctx, 2); err != nil {
+		t.Errorf("rolled back delete: %v", err)
+	}
+}
+
+func TestBulkUsersRejectsInvalidRequests(t *testing.T) {
+	svc := models.NewUserService()
+	router, token := newBulkRouter(svc)
+
+	tooMany := `{"operations":[` + strings.Repeat(`{"op":"delete","id":2},`, MaxBulkOperations) + `{"op":"delete","id":2}]}`
+	tests := []struct {
+		name string
+		role string
+		body string
+		want int
+	}{
+		{"empty", models.RoleAdmin, `{"operations":[]}`, http.StatusUnprocessableEntity},
+		{"unknown op", models.RoleAdmin, `{"operations":[{"op":"upsert","id":1}]}`, http.StatusUnprocessableEntity},
+		{"update without id", models.RoleAdmin, `{"operations":[{"op":"update","data":{"name":"X"}}]}`, http.StatusUnprocessableEntity},
+		{"too many", models.RoleAdmin, tooMany, http.StatusRequestEntityTooLarge},
+		{"delete without permission", models.RoleUser, `{"operations":[{"op":"delete","id":2}]}`, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status, _ := sendBulk(t, router, token(tt.role), tt.body); status != tt.want {
+				t.Errorf("status = %d, want %d", status, tt.want)
+			}
+		})
+	}
+	if _, err := svc.Get(context.Background(), 2); err != nil {
+		t.Errorf("user deleted by a rejected request: %v", err)
+	}
+}
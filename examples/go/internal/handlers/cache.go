@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/cbwinslow/template2/examples/go/internal/middleware"
+)
+
+// CacheInvalidator drops cached responses that a write may have made stale,
+// such as a middleware.CacheStore
+type CacheInvalidator interface {
+	Purge(ctx context.Context) error
+}
+
+// WithCacheInvalidator purges cache after every write to users
+func WithCacheInvalidator(cache CacheInvalidator) UserHandlerOption {
+	return func(h *UserHandler) {
+		h.cache = cache
+	}
+}
+
+// WithAuthCacheInvalidator purges cache after Register, VerifyEmail and
+// OIDCCallback create or change users
+func WithAuthCacheInvalidator(cache CacheInvalidator) AuthHandlerOption {
+	return func(h *AuthHandler) {
+		h.cache = cache
+	}
+}
+
+// WithAdminCacheInvalidator purges cache after LockUser and UnlockUser
+func WithAdminCacheInvalidator(cache CacheInvalidator) AdminHandlerOption {
+	return func(h *AdminHandler) {
+		h.cache = cache
+	}
+}
+
+// invalidateCache purges cache after a successful write. A failure only
+// leaves cached responses stale until they expire, so it is logged rather
+// than failing the write.
+func invalidateCache(c *gin.Context, cache CacheInvalidator, logger *zap.Logger) {
+	if cache == nil {
+		return
+	}
+	if err := cache.Purge(c.Request.Context()); err != nil {
+		middleware.RequestLogger(c, logger).Warn("Failed to invalidate the response cache", zap.Error(err))
+	}
+}
@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// entityTags returns the entity tags listed in the request's header lines
+// named header, or nil when the client sent none. "*" is kept as is.
+func entityTags(c *gin.Context, header string) []string {
+	var tags []string
+	for _, value := range c.Request.Header.Values(header) {
+		for _, tag := range strings.Split(value, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
+
+// notModified answers the request with 304 when its If-None-Match names
+// etag or "*", reporting whether it did. The comparison is weak, as RFC 9110
+// requires for If-None-Match, so W/ prefixes are ignored.
+func notModified(c *gin.Context, etag string) bool {
+	for _, tag := range entityTags(c, "If-None-Match") {
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			c.Status(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,2 @@
+// Package handlers contains the HTTP handlers for the API
+package handlers
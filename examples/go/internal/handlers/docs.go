@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	swaggerFiles "github.com/swaggo/files"
+	ginSwagger "github.com/swaggo/gin-swagger"
+
+	"github.com/cbwinslow/template2/examples/go/docs"
+)
+
+// OpenAPIPath is where the generated OpenAPI spec is served
+const OpenAPIPath = "/openapi.json"
+
+// RegisterDocsRoutes serves the OpenAPI spec generated from the handler
+// annotations at OpenAPIPath, and Swagger UI rendering it under /swagger.
+// guards run ahead of both, such as the credentials release mode asks for.
+func RegisterDocsRoutes(router gin.IRoutes, guards ...gin.HandlerFunc) {
+	spec := []byte(docs.SwaggerInfo.ReadDoc())
+	router.GET(OpenAPIPath, append(guards, func(c *gin.Context) {
+		c.Data(http.StatusOK, "application/json", spec)
+	})...)
+	router.GET("/swagger/*any", append(guards, ginSwagger.WrapHandler(swaggerFiles.Handler, ginSwagger.URL(OpenAPIPath)))...)
+}
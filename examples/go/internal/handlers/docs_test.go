@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestDocsRoutesServeSpecAndUI(t *testing.T) {
+	router := gin.New()
+	RegisterDocsRoutes(router)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, OpenAPIPath, nil))
+	var spec struct {
+		BasePath string                     `json:"basePath"`
+		Paths    map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &spec); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("spec: %d %v", w.Code, err)
+	}
+	// Spot checks that the spec was generated from the current handlers
+	for _, path := range []string{"/users/{id}", "/auth/login", "/graphql"} {
+		if _, ok := spec.Paths[path]; !ok {
+			t.Errorf("spec has no %s; run go generate ./cmd", path)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/swagger/index.html", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "swagger-ui") {
+		t.Errorf("UI: %d", w.Code)
+	}
+}
+
+func TestDocsRoutesRunGuards(t *testing.T) {
+	router := gin.New()
+	RegisterDocsRoutes(router, gin.BasicAuth(gin.Accounts{"docs": "s3cret"}))
+
+	for _, path := range []string{OpenAPIPath, "/swagger/index.html"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("%s without credentials: %d, want 401", path, w.Code)
+		}
+
+		w = httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.SetBasicAuth("docs", "s3cret")
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Errorf("%s with credentials: %d, want 200", path, w.Code)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/cbwinslow/template2/examples/go/internal/middleware"
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+	"github.com/cbwinslow/template2/examples/go/pkg/events"
+)
+
+// EventStreamPath is the route StreamEvents is served on, which has no
+// request timeout
+const EventStreamPath = "/api/v1/events/stream"
+
+// Defaults for the event stream
+const (
+	defaultStreamHeartbeat = 15 * time.Second
+	// defaultStreamRetry is the reconnection delay suggested to clients
+	defaultStreamRetry = 3 * time.Second
+	// streamBuffer is how many events a stream may fall behind by before it
+	// is closed, so the client reconnects and catches up from the feed
+	streamBuffer = 64
+)
+
+// EventStreamHandler streams domain events to clients as Server-Sent Events
+type EventStreamHandler struct {
+	feed      *events.Feed
+	logger    *zap.Logger
+	heartbeat time.Duration
+	retry     time.Duration
+	// done is closed by Close to end the open streams
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// EventStreamOption configures an EventStreamHandler
+type EventStreamOption func(*EventStreamHandler)
+
+// WithStreamHeartbeat sets how often an idle stream sends a comment, so
+// proxies do not close it and dead clients are noticed
+func WithStreamHeartbeat(interval time.Duration) EventStreamOption {
+	return func(h *EventStreamHandler) {
+		h.heartbeat = interval
+	}
+}
+
+// NewEventStreamHandler creates a handler streaming the events of feed
+func NewEventStreamHandler(feed *events.Feed, logger *zap.Logger, opts ...EventStreamOption) *EventStreamHandler {
+	h := &EventStreamHandler{feed: feed, logger: logger, heartbeat: defaultStreamHeartbeat, retry: defaultStreamRetry, done: make(chan struct{})}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// StreamEvents godoc
+// @Summary Stream domain events
+// @Description Streams events as text/event-stream; each has the event name as its type, a numeric ID and the event as JSON data. User changes are sent to anyone who may read users; sign-ins, password resets and token revocations only to the user concerned and to those who may read the audit log.
+// @Description A client reconnecting with a Last-Event-ID header is first sent the recent events it missed. Idle streams carry a comment every 15 seconds. The stream ends when the caller's tokens are revoked or their account is deleted.
+// @Tags events
+// @Produce text/event-stream
+// @Param Last-Event-ID header string false "ID of the last event received"
+// @Success 200 {string} string "event stream"
+// @Failure 400 {object} apierror.Problem
+// @Failure 401 {object} apierror.Problem
+// @Security ApiKeyAuth
+// @Router /events/stream [get]
+func (h *EventStreamHandler) StreamEvents(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		respondError(c, http.StatusUnauthorized, models.CodeUnauthorized, "Authentication required")
+		return
+	}
+	role := middleware.GetRole(c)
+	var after uint64
+	if v := c.GetHeader("Last-Event-ID"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			middleware.AbortWithError(c, models.NewError(http.StatusBadRequest, models.CodeValidationFailed, "Invalid Last-Event-ID").
+				WithDetails(map[string]interface{}{"header": "Last-Event-ID"}))
+			return
+		}
+		after = id
+	}
+
+	logger := middleware.RequestLogger(c, h.logger)
+	missed, sub := h.feed.Subscribe(after, streamBuffer)
+	defer sub.Close()
+
+	// The stream outlives the server's write timeout
+	if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{}); err != nil {
+		logger.Debug("Event stream keeps the write timeout", zap.Error(err))
+	}
+	header := c.Writer.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	// Keep nginx from buffering the stream
+	header.Set("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	if _, err := fmt.Fprintf(c.Writer, "retry: %d\n\n", h.retry.Milliseconds()); err != nil {
+		return
+	}
+	for _, record := range missed {
+		if models.CanSeeEvent(role, userID, record.Event) {
+			if err := writeEvent(c.Writer, record); err != nil {
+				return
+			}
+		}
+	}
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(h.heartbeat)
+	defer heartbeat.Stop()
+	ctx := c.Request.Context()
+	for {
+		var err error
+		select {
+		case <-ctx.Done():
+			return
+		case <-h.done:
+			return
+		case record, ok := <-sub.C():
+			if !ok {
+				// The client reconnects with the last ID it got and
+				// catches up from the feed
+				logger.Info("Event stream fell behind; closing it")
+				return
+			}
+			if models.EndsAccess(userID, record.Event) {
+				return
+			}
+			if !models.CanSeeEvent(role, userID, record.Event) {
+				continue
+			}
+			err = writeEvent(c.Writer, record)
+		case <-heartbeat.C:
+			_, err = io.WriteString(c.Writer, ": heartbeat\n\n")
+		}
+		if err != nil {
+			return
+		}
+		c.Writer.Flush()
+	}
+}
+
+// Close ends the open streams, whose clients reconnect to another replica
+// or once the server is back. Streams opened afterwards end at once.
+func (h *EventStreamHandler) Close() {
+	h.closeOnce.Do(func() { close(h.done) })
+}
+
+// writeEvent writes record as one Server-Sent Event
+func writeEvent(w io.Writer, record events.Record) error {
+	data, err := json.Marshal(record.Event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", record.ID, record.Event.EventName(), data)
+	return err
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/cbwinslow/template2/examples/go/internal/middleware"
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+	"github.com/cbwinslow/template2/examples/go/pkg/auth"
+	"github.com/cbwinslow/template2/examples/go/pkg/events"
+)
+
+// openStream connects to the event stream as the holder of token and
+// returns the stream's lines
+func openStream(t *testing.T, url, token, lastEventID string) (*http.Response, *bufio.Scanner) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp, bufio.NewScanner(resp.Body)
+}
+
+// nextEvent reads lines up to the end of the next event and returns its
+// id and type, skipping comments and the retry field
+func nextEvent(t *testing.T, lines *bufio.Scanner) (id, name string) {
+	t.Helper()
+	for lines.Scan() {
+		line := lines.Text()
+		switch {
+		case strings.HasPrefix(line, "id: "):
+			id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			name = strings.TrimPrefix(line, "event: ")
+		case line == "" && name != "":
+			return id, name
+		}
+	}
+	return "", ""
+}
+
+func TestStreamEventsFiltersAndResumes(t *testing.T) {
+	authService := auth.NewAuthService()
+	feed := events.NewFeed(100)
+	h := NewEventStreamHandler(feed, zap.NewNop(), WithStreamHeartbeat(10*time.Millisecond))
+	router := gin.New()
+	router.GET("/events/stream", middleware.AuthRequired(authService), h.StreamEvents)
+	server := httptest.NewServer(router)
+	// Registered first so it runs after the streams are closed
+	t.Cleanup(server.Close)
+
+	ctx := context.Background()
+	adminToken, _ := authService.GenerateToken(ctx, 1, "alice@example.com", models.RoleAdmin)
+	userToken, _ := authService.GenerateToken(ctx, 3, "hana@example.com", models.RoleUser)
+	_ = feed.Handle(ctx, events.UserCreated{UserID: 3})
+	_ = feed.Handle(ctx, events.LoginSucceeded{UserID: 1})
+	_ = feed.Handle(ctx, events.LoginSucceeded{UserID: 3})
+
+	resp, lines := openStream(t, server.URL+"/events/stream", userToken, "")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("status = %d, type = %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	if id, name := nextEvent(t, lines); id != "1" || name != events.NameUserCreated {
+		t.Errorf("first event = %s %s", id, name)
+	}
+	// Alice's sign-in is hidden from Hana
+	if id, name := nextEvent(t, lines); id != "3" || name != events.NameLoginSucceeded {
+		t.Errorf("second event = %s %s", id, name)
+	}
+	_ = feed.Handle(ctx, events.PasswordReset{UserID: 1})
+	_ = feed.Handle(ctx, events.UserDeleted{UserID: 2})
+	if id, name := nextEvent(t, lines); id != "5" || name != events.NameUserDeleted {
+		t.Errorf("live event = %s %s", id, name)
+	}
+
+	_, adminLines := openStream(t, server.URL+"/events/stream", adminToken, "3")
+	if id, name := nextEvent(t, adminLines); id != "4" || name != events.NamePasswordReset {
+		t.Errorf("first event after 3 = %s %s", id, name)
+	}
+
+	// Revoking Hana's tokens ends her stream
+	_ = feed.Handle(ctx, events.TokensRevoked{UserID: 3})
+	if id, name := nextEvent(t, lines); name != "" {
+		t.Errorf("stream continued with %s %s", id, name)
+	}
+
+	if resp, _ := openStream(t, server.URL+"/events/stream", adminToken, "latest"); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("invalid Last-Event-ID: status = %d, want 400", resp.StatusCode)
+	}
+}
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/cbwinslow/template2/examples/go/internal/middleware"
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+)
+
+// lineCounter is a ResponseWriter that discards the body but validates and
+// counts NDJSON lines, so the test itself does not buffer the export
+type lineCounter struct {
+	header  http.Header
+	status  int
+	lines   int
+	lastID  int
+	partial []byte
+	err     error
+}
+
+func (w *lineCounter) Header() http.Header    { return w.header }
+func (w *lineCounter) WriteHeader(status int) { w.status = status }
+func (w *lineCounter) Flush()                 {}
+func (w *lineCounter) Write(p []byte) (int, error) {
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		var user struct {
+			ID int `json:"id"`
+		}
+		if err := json.Unmarshal(w.partial[:i], &user); err != nil && w.err == nil {
+			w.err = err
+		}
+		if user.ID <= w.lastID && w.err == nil {
+			w.err = fmt.Errorf("user %d exported after %d", user.ID, w.lastID)
+		}
+		w.lastID = user.ID
+		w.lines++
+		w.partial = w.partial[i+1:]
+	}
+	return len(p), nil
+}
+
+func TestExportUsersStreamsLargeStore(t *testing.T) {
+	const extra = 10000
+
+	svc := models.NewUserService()
+	for i := 0; i < extra; i++ {
+		if _, err := svc.Create(context.Background(), models.CreateUserRequest{
+			Name:  fmt.Sprintf("User %d", i),
+			Email: fmt.Sprintf("user%d@example.com", i),
+		}); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+	h := NewUserHandler(svc, &recordingRevoker{}, zap.NewNop())
+	router := gin.New()
+	router.GET("/admin/users/export", h.ExportUsers)
+
+	w := &lineCounter{header: http.Header{}}
+	req := httptest.NewRequest(http.MethodGet, "/admin/users/export", nil)
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	router.ServeHTTP(w, req)
+	runtime.ReadMemStats(&after)
+
+	if w.status != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.status)
+	}
+	if w.err != nil {
+		t.Fatalf("invalid stream: %v", w.err)
+	}
+	if want := extra + 2; w.lines != want {
+		t.Errorf("exported %d users, want %d", w.lines, want)
+	}
+	if got := w.header.Get("Content-Type"); got != "application/x-ndjson" {
+		t.Errorf("Content-Type = %q", got)
+	}
+
+	// Paging keeps allocation proportional to one batch plus per-user
+	// encoding; buffering the store or the response would far exceed this.
+	if perUser := (after.TotalAlloc - before.TotalAlloc) / uint64(w.lines); perUser > 2048 {
+		t.Errorf("allocated %d bytes per exported user, want at most 2048", perUser)
+	}
+}
+
+// slowFlusher delays every flush, standing in for a slow client
+type slowFlusher struct {
+	*httptest.ResponseRecorder
+	delay time.Duration
+}
+
+func (s *slowFlusher) Flush() {
+	time.Sleep(s.delay)
+	s.ResponseRecorder.Flush()
+}
+
+func TestExportUsersMarksMidStreamFailure(t *testing.T) {
+	svc := models.NewUserService()
+	for i := 0; i < exportBatchSize; i++ {
+		if _, err := svc.Create(context.Background(), models.CreateUserRequest{
+			Name:  fmt.Sprintf("User %d", i),
+			Email: fmt.Sprintf("user%d@example.com", i),
+		}); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+	h := NewUserHandler(svc, &recordingRevoker{}, zap.NewNop())
+	router := gin.New()
+	router.GET("/admin/users/export", h.ExportUsers)
+
+	// The deadline passes while the first page is being flushed, so the
+	// second page read fails after the 200 has been sent.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	w := &slowFlusher{ResponseRecorder: httptest.NewRecorder(), delay: 40 * time.Millisecond}
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/users/export", nil).WithContext(ctx))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	lines := bytes.Split(bytes.TrimSpace(w.Body.Bytes()), []byte("\n"))
+	if len(lines) != exportBatchSize+1 {
+		t.Fatalf("got %d lines, want one page plus the error record", len(lines))
+	}
+	var last streamErrorRecord
+	if err := json.Unmarshal(lines[len(lines)-1], &last); err != nil || last.Error.Code != models.CodeRequestTimeout {
+		t.Errorf("last line = %s, want an error record with code %s", lines[len(lines)-1], models.CodeRequestTimeout)
+	}
+}
+
+func TestExportUsersAsCSV(t *testing.T) {
+	svc := models.NewUserService()
+	if _, err := svc.Create(context.Background(), models.CreateUserRequest{Name: "Formula", Email: "-x@example.com"}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	h := NewUserHandler(svc, &recordingRevoker{}, zap.NewNop())
+	router := gin.New()
+	router.GET("/admin/users/export", middleware.Accept("application/json", "text/csv", "application/x-ndjson"), h.ExportUsers)
+
+	for _, tc := range []struct {
+		name, query, accept string
+		status              int
+		contentType         string
+	}{
+		{"format parameter", "?format=csv", "", http.StatusOK, "text/csv; charset=utf-8"},
+		{"negotiated", "", "text/csv", http.StatusOK, "text/csv; charset=utf-8"},
+		{"parameter wins", "?format=ndjson", "text/csv", http.StatusOK, "application/x-ndjson"},
+		{"unknown format", "?format=xml", "", http.StatusBadRequest, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/admin/users/export"+tc.query, nil)
+			req.Header.Set("Accept", tc.accept)
+			router.ServeHTTP(w, req)
+			if w.Code != tc.status {
+				t.Fatalf("status = %d, want %d", w.Code, tc.status)
+			}
+			if tc.contentType != "" && w.Header().Get("Content-Type") != tc.contentType {
+				t.Errorf("Content-Type = %q, want %q", w.Header().Get("Content-Type"), tc.contentType)
+			}
+		})
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/users/export?format=csv", nil))
+	if got := w.Header().Get("Content-Disposition"); !strings.Contains(got, "users.csv") {
+		t.Errorf("Content-Disposition = %q, want users.csv", got)
+	}
+	rows, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("invalid CSV: %v", err)
+	}
+	if len(rows) != 4 || strings.Join(rows[0], ",") != strings.Join(csvHeader, ",") {
+		t.Fatalf("rows = %q, want the header and three users", rows)
+	}
+	if last := rows[3]; last[1] != "Formula" || last[2] != "'-x@example.com" {
+		t.Errorf("last row = %q, want the email defused as text", last)
+	}
+}
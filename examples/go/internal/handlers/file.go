@@ -0,0 +1,283 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/cbwinslow/template2/examples/go/internal/middleware"
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+	"github.com/cbwinslow/template2/examples/go/pkg/storage"
+)
+
+// FileDownloadPath is where signed download URLs point; the route is
+// FileDownloadPath + "/:owner/:id" and needs no other authentication
+const FileDownloadPath = "/files"
+
+// sniffLen is how much of an upload is read to detect its media type
+const sniffLen = 512
+
+// FileResponse describes an uploaded file and a signed URL to download it
+type FileResponse struct {
+	ID          string    `json:"id"`
+	Size        int64     `json:"size"`
+	ContentType string    `json:"content_type"`
+	URL         string    `json:"url"`
+	ExpiresAt   time.Time `json:"url_expires_at"`
+}
+
+// FileHandler serves uploads to an object store and signed downloads. Files
+// are kept under "<owner ID>/<file ID>", so users only reach their own.
+type FileHandler struct {
+	store  storage.Store
+	signer *storage.URLSigner
+	logger *zap.Logger
+	// maxSize caps one file; allowed are the media types accepted
+	maxSize int64
+	allowed []string
+	urlTTL  time.Duration
+}
+
+// FileHandlerOption configures a FileHandler
+type FileHandlerOption func(*FileHandler)
+
+// WithFileLimits sets the largest file accepted and the media types uploads
+// may have
+func WithFileLimits(maxSize int64, allowedTypes []string) FileHandlerOption {
+	return func(h *FileHandler) {
+		h.maxSize = maxSize
+		h.allowed = allowedTypes
+	}
+}
+
+// WithURLTTL sets how long signed download URLs work
+func WithURLTTL(ttl time.Duration) FileHandlerOption {
+	return func(h *FileHandler) {
+		h.urlTTL = ttl
+	}
+}
+
+// NewFileHandler creates a file handler keeping files in store
+func NewFileHandler(store storage.Store, signer *storage.URLSigner, logger *zap.Logger, opts ...FileHandlerOption) *FileHandler {
+	h := &FileHandler{
+		store:   store,
+		signer:  signer,
+		logger:  logger,
+		maxSize: 10 << 20,
+		allowed: []string{"image/jpeg", "image/png", "image/gif", "image/webp", "application/pdf", "text/plain"},
+		urlTTL:  15 * time.Minute,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// UploadFile godoc
+// @Summary Upload a file
+// @Description Stores the file part of a multipart form. The media type is detected from the content, not taken from the client, and must be one of the allowed types. The response carries a signed URL that downloads the file without other credentials until it expires.
+// @Tags files
+// @Accept multipart/form-data
+// @Produce json
+// @Param file formData file true "File"
+// @Success 201 {object} FileResponse
+// @Failure 400 {object} apierror.Problem
+// @Failure 413 {object} apierror.Problem
+// @Failure 415 {object} apierror.Problem
+// @Security ApiKeyAuth
+// @Router /protected/files [post]
+func (h *FileHandler) UploadFile(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		respondError(c, http.StatusUnauthorized, models.CodeUnauthorized, "Authentication required")
+		return
+	}
+	header, err := c.FormFile("file")
+	if err != nil {
+		respondError(c, http.StatusBadRequest, models.CodeValidationFailed, "A multipart file part named file is required")
+		return
+	}
+	if header.Size > h.maxSize {
+		middleware.AbortWithError(c, models.NewError(http.StatusRequestEntityTooLarge, models.CodePayloadTooLarge, fmt.Sprintf("File exceeds %d bytes", h.maxSize)).
+			WithDetails(map[string]interface{}{"max_bytes": h.maxSize}))
+		return
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		respondServiceError(c, err)
+		return
+	}
+	defer file.Close()
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		respondServiceError(c, err)
+		return
+	}
+	contentType := http.DetectContentType(head[:n])
+	if !h.allowedType(contentType) {
+		middleware.AbortWithError(c, models.NewError(http.StatusUnsupportedMediaType, models.CodeUnsupportedMedia, "File type is not allowed").
+			WithDetails(map[string]interface{}{"detected": contentType, "supported": h.allowed}))
+		return
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		respondServiceError(c, err)
+		return
+	}
+
+	id, err := newFileID()
+	if err != nil {
+		respondServiceError(c, err)
+		return
+	}
+	key := fileKey(userID, id)
+	if err := h.store.Put(c.Request.Context(), key, file, header.Size, contentType); err != nil {
+		respondServiceError(c, err)
+		return
+	}
+
+	middleware.RequestLogger(c, h.logger).Info("File uploaded",
+		zap.Int("user_id", userID), zap.String("file_id", id), zap.Int64("size", header.Size), zap.String("content_type", contentType))
+	c.JSON(http.StatusCreated, h.response(id, storage.Object{Key: key, Size: header.Size, ContentType: contentType}))
+}
+
+// GetFile godoc
+// @Summary Get a file
+// @Description Describes one of the caller's files with a freshly signed download URL.
+// @Tags files
+// @Produce json
+// @Param id path string true "File ID"
+// @Success 200 {object} FileResponse
+// @Failure 404 {object} apierror.Problem
+// @Security ApiKeyAuth
+// @Router /protected/files/{id} [get]
+func (h *FileHandler) GetFile(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		respondError(c, http.StatusUnauthorized, models.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	obj, err := h.store.Stat(c.Request.Context(), fileKey(userID, c.Param("id")))
+	if err != nil {
+		respondFileError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, h.response(c.Param("id"), obj))
+}
+
+// DeleteFile godoc
+// @Summary Delete a file
+// @Description URLs signed for the file stop working.
+// @Tags files
+// @Param id path string true "File ID"
+// @Success 204
+// @Failure 404 {object} apierror.Problem
+// @Security ApiKeyAuth
+// @Router /protected/files/{id} [delete]
+func (h *FileHandler) DeleteFile(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		respondError(c, http.StatusUnauthorized, models.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	ctx := c.Request.Context()
+	key := fileKey(userID, c.Param("id"))
+	if _, err := h.store.Stat(ctx, key); err != nil {
+		respondFileError(c, err)
+		return
+	}
+	if err := h.store.Delete(ctx, key); err != nil {
+		respondServiceError(c, err)
+		return
+	}
+
+	middleware.RequestLogger(c, h.logger).Info("File deleted", zap.Int("user_id", userID), zap.String("file_id", c.Param("id")))
+	c.Status(http.StatusNoContent)
+}
+
+// DownloadFile godoc
+// @Summary Download a file
+// @Description Serves a file through a URL signed by UploadFile or GetFile; no other credentials are needed. Range requests are answered with 206 Partial Content, so interrupted downloads can resume.
+// @Tags files
+// @Param owner path int true "Owner ID"
+// @Param id path string true "File ID"
+// @Param expires query int true "Expiry as a Unix time"
+// @Param signature query string true "URL signature"
+// @Success 200
+// @Success 206
+// @Failure 403 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Router /files/{owner}/{id} [get]
+func (h *FileHandler) DownloadFile(c *gin.Context) {
+	if err := h.signer.Verify(c.Request.URL.Path, c.Request.URL.Query()); err != nil {
+		respondError(c, http.StatusForbidden, models.CodeForbidden, "Invalid or expired download link")
+		return
+	}
+
+	r, obj, err := h.store.Open(c.Request.Context(), c.Param("owner")+"/"+c.Param("id"))
+	if err != nil {
+		respondFileError(c, err)
+		return
+	}
+	defer r.Close()
+
+	c.Header("X-Content-Type-Options", "nosniff")
+	serveObject(c, obj, r)
+}
+
+// allowedType reports whether the media type of contentType, ignoring its
+// parameters, is allowed
+func (h *FileHandler) allowedType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, allowed := range h.allowed {
+		if mediaType == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// response describes obj with a download URL signed now
+func (h *FileHandler) response(id string, obj storage.Object) FileResponse {
+	url, expires := h.signer.Sign(FileDownloadPath+"/"+obj.Key, h.urlTTL)
+	return FileResponse{ID: id, Size: obj.Size, ContentType: obj.ContentType, URL: url, ExpiresAt: expires}
+}
+
+// respondFileError aborts a request for a file that could not be found or
+// read
+func respondFileError(c *gin.Context, err error) {
+	if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrInvalidKey) {
+		respondError(c, http.StatusNotFound, models.CodeNotFound, "File not found")
+		return
+	}
+	respondServiceError(c, err)
+}
+
+// fileKey is the storage key of the user's file
+func fileKey(userID int, id string) string {
+	return strconv.Itoa(userID) + "/" + id
+}
+
+// newFileID returns a random, unguessable file ID
+func newFileID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/cbwinslow/template2/examples/go/internal/middleware"
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+	"github.com/cbwinslow/template2/examples/go/pkg/auth"
+	"github.com/cbwinslow/template2/examples/go/pkg/storage"
+)
+
+func newFileRouter(t *testing.T, opts ...FileHandlerOption) (*gin.Engine, string) {
+	t.Helper()
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocalStore: %v", err)
+	}
+	authService := auth.NewAuthService()
+	token, _ := authService.GenerateToken(context.Background(), 2, "bob@example.com", models.RoleUser)
+	h := NewFileHandler(store, storage.NewURLSigner([]byte("secret")), zap.NewNop(), opts...)
+
+	router := gin.New()
+	router.Use(middleware.MultipartMemory(1 << 20))
+	files := router.Group("/protected/files", middleware.AuthRequired(authService))
+	files.POST("", h.UploadFile)
+	files.GET("/:id", h.GetFile)
+	files.DELETE("/:id", h.DeleteFile)
+	router.GET(FileDownloadPath+"/:owner/:id", h.DownloadFile)
+	return router, token
+}
+
+func uploadRequest(t *testing.T, token string, content []byte) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, _ := form.CreateFormFile("file", "upload.bin")
+	part.Write(content)
+	form.Close()
+	req := httptest.NewRequest(http.MethodPost, "/protected/files", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
+
+func TestUploadAndDownloadFile(t *testing.T) {
+	router, token := newFileRouter(t)
+	content := []byte("plain text content for a range request")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, uploadRequest(t, token, content))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("upload: status = %d: %s", w.Code, w.Body.String())
+	}
+	var file FileResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &file); err != nil || file.ContentType != "text/plain; charset=utf-8" || file.Size != int64(len(content)) {
+		t.Fatalf("upload body = %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, file.URL, nil)
+	req.Header.Set("Range", "bytes=6-9")
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusPartialContent || w.Body.String() != "text" {
+		t.Errorf("ranged download: status = %d, body = %q", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, file.URL+"x", nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("tampered URL: status = %d, want 403", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodDelete, "/protected/files/"+file.ID, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("delete: status = %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, file.URL, nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("download after delete: status = %d, want 404", w.Code)
+	}
+}
+
+func TestUploadFileValidatesSizeAndType(t *testing.T) {
+	router, token := newFileRouter(t, WithFileLimits(16, []string{"image/png"}))
+
+	for _, tt := range []struct {
+		name    string
+		content []byte
+		want    int
+	}{
+		{"too large", bytes.Repeat([]byte("a"), 17), http.StatusRequestEntityTooLarge},
+		{"disallowed type", []byte("just some text"), http.StatusUnsupportedMediaType},
+		{"allowed type", []byte("\x89PNG\r\n\x1a\n"), http.StatusCreated},
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, uploadRequest(t, token, tt.content))
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d: %s", tt.name, w.Code, tt.want, w.Body.String())
+		}
+	}
+}
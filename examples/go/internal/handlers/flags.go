@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/cbwinslow/template2/examples/go/internal/middleware"
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+	"github.com/cbwinslow/template2/examples/go/pkg/audit"
+	"github.com/cbwinslow/template2/examples/go/pkg/flags"
+)
+
+// FlagUpdate turns a feature flag on or off
+type FlagUpdate struct {
+	Enabled bool `json:"enabled" example:"true"`
+	// Percent of users the flag is on for; it defaults to 100, every caller
+	Percent *int `json:"percent" binding:"omitempty,min=0,max=100" example:"25"`
+	// Description is kept from the current flag when omitted
+	Description *string `json:"description" binding:"omitempty,max=200" example:"CSV export v2"`
+}
+
+// WithFeatureFlags lets admins list the flags client resolves and change
+// them in store, whose flags take precedence over the flags file
+func WithFeatureFlags(client *flags.Client, store flags.Store) AdminHandlerOption {
+	return func(h *AdminHandler) {
+		h.flags = client
+		h.flagStore = store
+	}
+}
+
+// ListFlags godoc
+// @Summary List feature flags
+// @Description Returns every feature flag as currently resolved: runtime changes made through this API override the flags file shipped with the release.
+// @Tags admin
+// @Produce json
+// @Success 200 {array} flags.Flag
+// @Failure 403 {object} apierror.Problem
+// @Security ApiKeyAuth
+// @Router /admin/flags [get]
+func (h *AdminHandler) ListFlags(c *gin.Context) {
+	list, err := h.flags.Flags(c.Request.Context())
+	if err != nil {
+		respondServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// SetFlag godoc
+// @Summary Change a feature flag
+// @Description Creates or replaces the runtime setting of a flag, which takes effect on every replica sharing the flag store. An enabled flag below 100 percent is on for a stable share of signed-in users and off for anonymous callers. The change is audited.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param name path string true "Flag name"
+// @Param flag body FlagUpdate true "New setting"
+// @Success 200 {object} flags.Flag
+// @Failure 400 {object} apierror.Problem
+// @Failure 403 {object} apierror.Problem
+// @Failure 422 {object} apierror.Problem
+// @Security ApiKeyAuth
+// @Router /admin/flags/{name} [put]
+func (h *AdminHandler) SetFlag(c *gin.Context) {
+	name := c.Param("name")
+	if !flags.ValidName(name) {
+		respondError(c, http.StatusBadRequest, models.CodeValidationFailed, "Invalid flag name")
+		return
+	}
+	var req FlagUpdate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	ctx := c.Request.Context()
+	previous, _, err := h.flags.Lookup(ctx, name)
+	if err != nil {
+		respondServiceError(c, err)
+		return
+	}
+
+	flag := flags.Flag{Name: name, Description: previous.Description, Enabled: req.Enabled, Percent: 100}
+	if req.Percent != nil {
+		flag.Percent = *req.Percent
+	}
+	if req.Description != nil {
+		flag.Description = *req.Description
+	}
+	if err := h.flagStore.Set(ctx, flag); err != nil {
+		respondServiceError(c, err)
+		return
+	}
+
+	middleware.RequestLogger(c, h.logger).Info("Feature flag changed", zap.String("flag", name),
+		zap.Bool("enabled", flag.Enabled), zap.Int("percent", flag.Percent))
+	writeAudit(c, h.audit, "flag.set", 0, zap.String("target", name), audit.Changes(previous, flag))
+	c.JSON(http.StatusOK, flag)
+}
+
+// DeleteFlag godoc
+// @Summary Reset a feature flag
+// @Description Removes the runtime setting of a flag, so it reverts to the flags file or, if the file does not define it, to off. The change is audited.
+// @Tags admin
+// @Param name path string true "Flag name"
+// @Success 204
+// @Failure 403 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Security ApiKeyAuth
+// @Router /admin/flags/{name} [delete]
+func (h *AdminHandler) DeleteFlag(c *gin.Context) {
+	name := c.Param("name")
+	err := h.flagStore.Delete(c.Request.Context(), name)
+	if errors.Is(err, flags.ErrUnknownFlag) {
+		respondError(c, http.StatusNotFound, models.CodeNotFound, "The flag has no runtime setting")
+		return
+	}
+	if err != nil {
+		respondServiceError(c, err)
+		return
+	}
+
+	middleware.RequestLogger(c, h.logger).Info("Feature flag reset", zap.String("flag", name))
+	writeAudit(c, h.audit, "flag.delete", 0, zap.String("target", name))
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/cbwinslow/template2/examples/go/internal/logging"
+	"github.com/cbwinslow/template2/examples/go/internal/middleware"
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+	"github.com/cbwinslow/template2/examples/go/pkg/flags"
+)
+
+func TestFeatureFlagAdmin(t *testing.T) {
+	authService, users := newAuthFixture(t)
+	adminToken, _ := authService.GenerateToken(context.Background(), 1, "alice@example.com", models.RoleAdmin)
+	userToken, _ := authService.GenerateToken(context.Background(), 2, "hana@example.com", models.RoleUser)
+	store := flags.NewMemoryStore()
+	client := flags.New([]flags.Provider{flags.NewStatic(flags.Flag{Name: "new_export", Description: "CSV v2", Percent: 100}), store})
+	trail := logging.NewAuditTrail(10)
+
+	h := NewAdminHandler(users, authService, zap.NewNop(), WithFeatureFlags(client, store), WithAdminAudit(zap.New(trail.Core()), trail))
+	router := gin.New()
+	router.Use(middleware.FeatureFlags(client))
+	router.GET("/export", middleware.AuthRequired(authService), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"v2": flags.Enabled(c.Request.Context(), "new_export")})
+	})
+	admin := router.Group("/admin/flags", middleware.AuthRequired(authService), middleware.RequirePermission(models.PermFlagsManage))
+	admin.GET("", h.ListFlags)
+	admin.PUT("/:name", h.SetFlag)
+	admin.DELETE("/:name", h.DeleteFlag)
+	do := func(method, path, body, token string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do(http.MethodGet, "/export", "", userToken); w.Body.String() != `{"v2":false}` {
+		t.Errorf("before the change: %s", w.Body.String())
+	}
+	if w := do(http.MethodPut, "/admin/flags/new_export", `{"enabled":true}`, userToken); w.Code != http.StatusForbidden {
+		t.Errorf("as a user: status = %d, want 403", w.Code)
+	}
+	if w := do(http.MethodPut, "/admin/flags/New%20Export", `{"enabled":true}`, adminToken); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid name: status = %d, want 400", w.Code)
+	}
+	if w := do(http.MethodPut, "/admin/flags/new_export", `{"enabled":true,"percent":101}`, adminToken); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("percent over 100: status = %d, want 422", w.Code)
+	}
+	w := do(http.MethodPut, "/admin/flags/new_export", `{"enabled":true}`, adminToken)
+	if w.Code != http.StatusOK || w.Body.String() != `{"name":"new_export","description":"CSV v2","enabled":true,"percent":100}` {
+		t.Fatalf("enable: %d %s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodGet, "/export", "", userToken); w.Body.String() != `{"v2":true}` {
+		t.Errorf("after the change: %s", w.Body.String())
+	}
+
+	var list []flags.Flag
+	if err := json.Unmarshal(do(http.MethodGet, "/admin/flags", "", adminToken).Body.Bytes(), &list); err != nil || len(list) != 1 || !list[0].Enabled {
+		t.Errorf("list = %+v, %v", list, err)
+	}
+	records := trail.Records(logging.AuditQuery{Action: "flag.set"})
+	if len(records) != 1 || records[0].Target != "new_export" || records[0].Changes["enabled"].After != true {
+		t.Errorf("audit records = %+v", records)
+	}
+
+	if w := do(http.MethodDelete, "/admin/flags/new_export", "", adminToken); w.Code != http.StatusNoContent {
+		t.Fatalf("reset: %d %s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodGet, "/export", "", userToken); w.Body.String() != `{"v2":false}` {
+		t.Errorf("after the reset: %s", w.Body.String())
+	}
+	if w := do(http.MethodDelete, "/admin/flags/new_export", "", adminToken); w.Code != http.StatusNotFound {
+		t.Errorf("second reset: status = %d, want 404", w.Code)
+	}
+}
@@ -0,0 +1,516 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	gqlgen "github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/executor"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/99designs/gqlgen/graphql/playground"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"github.com/vikstrous/dataloadgen"
+	"go.uber.org/zap"
+
+	"github.com/cbwinslow/template2/examples/go/internal/graph"
+	"github.com/cbwinslow/template2/examples/go/internal/middleware"
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+	"github.com/cbwinslow/template2/examples/go/pkg/apierror"
+	"github.com/cbwinslow/template2/examples/go/pkg/audit"
+	"github.com/cbwinslow/template2/examples/go/pkg/auth"
+)
+
+// GraphQLRequest is the payload accepted by GraphQL
+type GraphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// GraphQLResponse is the result GraphQL answers with
+type GraphQLResponse struct {
+	Data   map[string]interface{} `json:"data" extensions:"x-nullable"`
+	Errors []GraphQLError         `json:"errors,omitempty"`
+}
+
+// GraphQLError is a failed field, or a request that failed validation
+type GraphQLError struct {
+	Message   string            `json:"message"`
+	Locations []GraphQLLocation `json:"locations,omitempty"`
+	Path      []interface{}     `json:"path,omitempty"`
+	// Code, status and, where the REST API has them, details and fields of
+	// the error
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+// GraphQLLocation is a position in the query
+type GraphQLLocation struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// userLoadWait is how long the user loader collects IDs before fetching
+// them in one GetMany. gqlgen resolves the fields of a selection
+// concurrently, so lookups of the same depth arrive well within it.
+const userLoadWait = 2 * time.Millisecond
+
+// GraphQLHandler serves the GraphQL endpoint with the executor gqlgen
+// generates from internal/graph/schema.graphqls. Its resolvers call the
+// same services as the user and auth handlers, with their configuration:
+// page sizes, audit log, cache purging, token and API key revocation,
+// stuffing detection and two-factor login all apply alike.
+type GraphQLHandler struct {
+	users    *UserHandler
+	auth     *AuthHandler
+	executor *executor.Executor
+}
+
+// NewGraphQLHandler creates a GraphQL handler over the services of users
+// and auth
+func NewGraphQLHandler(users *UserHandler, auth *AuthHandler) *GraphQLHandler {
+	h := &GraphQLHandler{users: users, auth: auth}
+	h.executor = executor.New(graph.NewExecutableSchema(graph.Config{Resolvers: graphqlResolvers{h}}))
+	h.executor.Use(extension.Introspection{})
+	h.executor.SetErrorPresenter(h.presentError)
+	h.executor.SetRecoverFunc(h.recoverResolver)
+	return h
+}
+
+// graphqlRequest is what resolvers need of the HTTP request they serve
+type graphqlRequest struct {
+	c *gin.Context
+	// users batches the user lookups of one depth into one GetMany and
+	// caches them for the rest of the request
+	users *dataloadgen.Loader[int, *models.User]
+}
+
+type graphqlRequestKey struct{}
+
+func requestFrom(ctx context.Context) *graphqlRequest {
+	return ctx.Value(graphqlRequestKey{}).(*graphqlRequest)
+}
+
+// GraphQL godoc
+// @Summary Run a GraphQL query or mutation
+// @Description Queries me, user(id) and users(first, after); mutations login, verifyTwoFactor, refresh, logout, createUser, updateUser and deleteUser.
+// @Description Operations needing a user read the bearer token as the REST routes do, and fields the caller may not see fail with an error whose extensions carry the same code and status the REST API answers with.
+// @Description Failed fields, and queries that do not validate against the schema, are reported in errors with 200; a body that is not a GraphQL request gets 400.
+// @Tags graphql
+// @Accept json
+// @Produce json
+// @Param request body GraphQLRequest true "Query, operation name and variables"
+// @Success 200 {object} GraphQLResponse
+// @Failure 400 {object} apierror.Problem
+// @Failure 401 {object} apierror.Problem
+// @Router /graphql [post]
+func (h *GraphQLHandler) GraphQL(c *gin.Context) {
+	start := gqlgen.Now()
+	if ct := c.ContentType(); ct != binding.MIMEJSON && ct != "" {
+		respondError(c, http.StatusUnsupportedMediaType, models.CodeUnsupportedMedia, "Expected application/json")
+		return
+	}
+	var req GraphQLRequest
+	decoder := json.NewDecoder(c.Request.Body)
+	decoder.UseNumber()
+	if err := decoder.Decode(&req); err != nil {
+		respondError(c, http.StatusBadRequest, models.CodeValidationFailed, "The body is not a GraphQL request: "+err.Error())
+		return
+	}
+	if req.Query == "" {
+		respondError(c, http.StatusBadRequest, models.CodeValidationFailed, "A query is required")
+		return
+	}
+
+	ctx := context.WithValue(c.Request.Context(), graphqlRequestKey{}, &graphqlRequest{
+		c:     c,
+		users: dataloadgen.NewLoader(h.fetchUsers, dataloadgen.WithWait(userLoadWait)),
+	})
+	ctx = gqlgen.StartOperationTrace(ctx)
+	operation, errs := h.executor.CreateOperationContext(ctx, &gqlgen.RawParams{
+		Query:         req.Query,
+		OperationName: req.OperationName,
+		Variables:     req.Variables,
+		Headers:       c.Request.Header,
+		ReadTime:      gqlgen.TraceTiming{Start: start, End: gqlgen.Now()},
+	})
+	if errs != nil {
+		c.JSON(http.StatusOK, h.executor.DispatchError(gqlgen.WithOperationContext(ctx, operation), errs))
+		return
+	}
+	responses, ctx := h.executor.DispatchOperation(ctx, operation)
+	c.JSON(http.StatusOK, responses(ctx))
+}
+
+// fetchUsers loads the users with the given IDs for the user loader, nil
+// for those that do not exist
+func (h *GraphQLHandler) fetchUsers(ctx context.Context, ids []int) ([]*models.User, []error) {
+	users, err := h.users.users.GetMany(ctx, ids)
+	if err != nil {
+		return nil, []error{err}
+	}
+	found := make(map[int]*models.User, len(users))
+	for i := range users {
+		found[users[i].ID] = &users[i]
+	}
+	result := make([]*models.User, len(ids))
+	for i, id := range ids {
+		result[i] = found[id]
+	}
+	return result, nil
+}
+
+// presentError describes a resolver error by the error the REST API would
+// answer with, its code and status in the extensions. Errors gqlgen raises
+// for the request itself, such as an argument of the wrong type, keep
+// their message.
+func (h *GraphQLHandler) presentError(ctx context.Context, err error) *gqlerror.Error {
+	presented := gqlgen.DefaultErrorPresenter(ctx, err)
+	var apiErr *apierror.Error
+	if !errors.As(err, &apiErr) {
+		var gqlErr *gqlerror.Error
+		if errors.As(err, &gqlErr) {
+			return presented
+		}
+		apiErr = serviceError(err)
+	}
+	if apiErr.Status >= http.StatusInternalServerError {
+		middleware.RequestLogger(requestFrom(ctx).c, h.users.logger).Error("GraphQL field failed", zap.Error(err))
+	}
+	presented.Message = apiErr.Detail
+	presented.Extensions = map[string]interface{}{"code": apiErr.Code, "status": apiErr.Status}
+	if len(apiErr.Details) > 0 {
+		presented.Extensions["details"] = apiErr.Details
+	}
+	if len(apiErr.Fields) > 0 {
+		presented.Extensions["fields"] = apiErr.Fields
+	}
+	return presented
+}
+
+// recoverResolver turns a resolver panic into an internal error of the
+// field, so the rest of the query still resolves
+func (h *GraphQLHandler) recoverResolver(ctx context.Context, recovered interface{}) error {
+	err := fmt.Errorf("panic: %v", recovered)
+	middleware.RequestLogger(requestFrom(ctx).c, h.users.logger).Error("GraphQL resolver panicked", zap.Error(err), zap.Stack("stack"))
+	return models.NewError(http.StatusInternalServerError, models.CodeInternal, "Internal server error").Wrap(err)
+}
+
+// authorize returns the error a caller without a user, or without
+// permission when set, fails with
+func authorize(c *gin.Context, permission string) error {
+	if _, ok := middleware.GetClaims(c); !ok {
+		return models.NewError(http.StatusUnauthorized, models.CodeUnauthorized, "Authentication required")
+	}
+	if permission != "" && !models.RoleHasPermission(middleware.GetRole(c), permission) {
+		return models.NewError(http.StatusForbidden, models.CodeForbidden, "Insufficient permissions for this resource").
+			WithDetails(map[string]interface{}{"required_permission": permission})
+	}
+	return nil
+}
+
+// graphqlID reads an ID argument as a user ID
+func graphqlID(value string) (int, error) {
+	id, err := strconv.Atoi(value)
+	if err != nil || id <= 0 {
+		return 0, models.NewError(http.StatusBadRequest, models.CodeInvalidID, "Invalid id")
+	}
+	return id, nil
+}
+
+// encodeCursor and decodeCursor convert the ID of the last user of a page
+// to the opaque cursor of the page after it and back
+func encodeCursor(lastID int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("user:" + strconv.Itoa(lastID)))
+}
+
+func decodeCursor(cursor string) (int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err == nil && len(raw) > len("user:") && string(raw[:len("user:")]) == "user:" {
+		if id, err := strconv.Atoi(string(raw[len("user:"):])); err == nil && id >= 0 {
+			return id, nil
+		}
+	}
+	return 0, models.NewError(http.StatusBadRequest, models.CodeInvalidPage, "Invalid cursor")
+}
+
+func formatTime(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	formatted := t.Format(time.RFC3339Nano)
+	return &formatted
+}
+
+func tokenPair(pair auth.TokenPair) *graph.TokenPair {
+	return &graph.TokenPair{
+		AccessToken:  pair.AccessToken,
+		RefreshToken: pair.RefreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(pair.ExpiresIn.Seconds()),
+	}
+}
+
+// graphqlResolvers implements the resolvers of the schema
+type graphqlResolvers struct{ *GraphQLHandler }
+
+func (r graphqlResolvers) Query() graph.QueryResolver       { return queryResolver(r) }
+func (r graphqlResolvers) Mutation() graph.MutationResolver { return mutationResolver(r) }
+func (r graphqlResolvers) User() graph.UserResolver         { return userResolver(r) }
+
+type userResolver graphqlResolvers
+
+func (userResolver) Age(_ context.Context, u *models.User) (*int, error) {
+	if u.Age == 0 {
+		return nil, nil
+	}
+	return &u.Age, nil
+}
+
+func (userResolver) CreatedAt(_ context.Context, u *models.User) (string, error) {
+	return *formatTime(&u.CreatedAt), nil
+}
+
+func (userResolver) UpdatedAt(_ context.Context, u *models.User) (string, error) {
+	return *formatTime(&u.UpdatedAt), nil
+}
+
+func (userResolver) LockedAt(_ context.Context, u *models.User) (*string, error) {
+	return formatTime(u.LockedAt), nil
+}
+
+type queryResolver graphqlResolvers
+
+func (queryResolver) Me(ctx context.Context) (*models.User, error) {
+	req := requestFrom(ctx)
+	if err := authorize(req.c, ""); err != nil {
+		return nil, err
+	}
+	userID, _ := middleware.GetUserID(req.c)
+	user, err := req.users.Load(ctx, userID)
+	if err == nil && user == nil {
+		err = models.ErrUserNotFound
+	}
+	return user, err
+}
+
+func (queryResolver) User(ctx context.Context, id string) (*models.User, error) {
+	req := requestFrom(ctx)
+	if err := authorize(req.c, models.PermUsersRead); err != nil {
+		return nil, err
+	}
+	userID, err := graphqlID(id)
+	if err != nil {
+		return nil, err
+	}
+	return req.users.Load(ctx, userID)
+}
+
+func (r queryResolver) Users(ctx context.Context, first *int, after *string) (*graph.UserConnection, error) {
+	req := requestFrom(ctx)
+	if err := authorize(req.c, models.PermUsersRead); err != nil {
+		return nil, err
+	}
+	limit := r.users.defaultLimit
+	if first != nil {
+		limit = *first
+	}
+	if limit < 1 || limit > r.users.maxLimit {
+		return nil, models.NewError(http.StatusBadRequest, models.CodeInvalidPage, "Invalid page size").
+			WithDetails(map[string]interface{}{"max_limit": r.users.maxLimit})
+	}
+	afterID := 0
+	if after != nil {
+		var err error
+		if afterID, err = decodeCursor(*after); err != nil {
+			return nil, err
+		}
+	}
+
+	users, err := r.users.users.Page(ctx, afterID, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	page := &graph.UserConnection{HasNextPage: len(users) > limit}
+	if page.HasNextPage {
+		users = users[:limit]
+	}
+	page.Nodes = users
+	if len(users) > 0 {
+		endCursor := encodeCursor(users[len(users)-1].ID)
+		page.EndCursor = &endCursor
+	}
+	return page, nil
+}
+
+type mutationResolver graphqlResolvers
+
+func (r mutationResolver) Login(ctx context.Context, email, password string) (*graph.LoginPayload, error) {
+	c := requestFrom(ctx).c
+	if apiErr := r.auth.loginBlocked(c); apiErr != nil {
+		return nil, apiErr
+	}
+	req := LoginRequest{Email: email, Password: password}
+	if err := binding.Validator.ValidateStruct(&req); err != nil {
+		return nil, bindError(err)
+	}
+	user, apiErr := r.auth.checkCredentials(c, req)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	if r.auth.twoFactor {
+		enabled, err := r.auth.auth.TwoFactorEnabled(ctx, user.ID)
+		if err != nil {
+			return nil, err
+		}
+		if enabled {
+			challenge, err := r.auth.auth.IssueChallengeToken(ctx, user.ID)
+			if err != nil {
+				return nil, err
+			}
+			middleware.RequestLogger(c, r.auth.logger).Info("Two-factor challenge issued", zap.Int("user_id", user.ID))
+			return &graph.LoginPayload{Challenge: &graph.TwoFactorChallenge{
+				ChallengeToken: challenge,
+				ExpiresIn:      int(r.auth.auth.ChallengeTTL().Seconds()),
+			}}, nil
+		}
+	}
+
+	pair, err := r.auth.auth.IssueTokenPair(ctx, user.ID, user.Email, user.Role, sessionClient(c))
+	if err != nil {
+		return nil, err
+	}
+	middleware.RequestLogger(c, r.auth.logger).Info("User logged in", zap.Int("user_id", user.ID))
+	return &graph.LoginPayload{Tokens: tokenPair(pair)}, nil
+}
+
+func (r mutationResolver) VerifyTwoFactor(ctx context.Context, challengeToken, code string) (*graph.TokenPair, error) {
+	c := requestFrom(ctx).c
+	user, recovery, apiErr := r.auth.verifyChallenge(c, TwoFactorVerifyRequest{ChallengeToken: challengeToken, Code: code})
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	pair, err := r.auth.auth.IssueTokenPair(ctx, user.ID, user.Email, user.Role, sessionClient(c))
+	if err != nil {
+		return nil, err
+	}
+	middleware.RequestLogger(c, r.auth.logger).Info("User logged in", zap.Int("user_id", user.ID), zap.Bool("recovery_code", recovery))
+	return tokenPair(pair), nil
+}
+
+func (r mutationResolver) Refresh(ctx context.Context, refreshToken string) (*graph.TokenPair, error) {
+	c := requestFrom(ctx).c
+	pair, err := r.auth.auth.Refresh(ctx, refreshToken, sessionClient(c))
+	if err != nil {
+		if errors.Is(err, auth.ErrRefreshReused) {
+			middleware.RequestLogger(c, r.auth.logger).Warn("Refresh token reused; session revoked",
+				zap.String("event", "refresh_token_reused"),
+				zap.String("ip", c.ClientIP()))
+		}
+		if isTokenError(err) {
+			return nil, models.NewError(http.StatusUnauthorized, models.CodeTokenInvalid, "Invalid or expired refresh token")
+		}
+		return nil, err
+	}
+	return tokenPair(pair), nil
+}
+
+func (r mutationResolver) Logout(ctx context.Context, refreshToken string) (bool, error) {
+	if err := r.auth.auth.RevokeRefreshToken(ctx, refreshToken); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (r mutationResolver) CreateUser(ctx context.Context, input graph.CreateUserInput) (*models.User, error) {
+	c := requestFrom(ctx).c
+	if err := authorize(c, models.PermUsersWrite); err != nil {
+		return nil, err
+	}
+	req := models.CreateUserRequest{Name: input.Name, Email: input.Email, Active: input.Active}
+	if input.Age != nil {
+		req.Age = *input.Age
+	}
+	if input.Role != nil {
+		req.Role = *input.Role
+	}
+	if err := binding.Validator.ValidateStruct(&req); err != nil {
+		return nil, bindError(err)
+	}
+
+	user, err := r.users.users.Create(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	middleware.RequestLogger(c, r.users.logger).Info("User created", zap.Int("user_id", user.ID))
+	r.users.recordAudit(c, "user.create", user.ID)
+	invalidateCache(c, r.users.cache, r.users.logger)
+	return &user, nil
+}
+
+func (r mutationResolver) UpdateUser(ctx context.Context, id string, input graph.UpdateUserInput) (*models.User, error) {
+	c := requestFrom(ctx).c
+	if err := authorize(c, models.PermUsersWrite); err != nil {
+		return nil, err
+	}
+	userID, err := graphqlID(id)
+	if err != nil {
+		return nil, err
+	}
+	req := models.UpdateUserRequest{
+		Name:   input.Name,
+		Email:  input.Email,
+		Age:    input.Age,
+		Role:   input.Role,
+		Active: input.Active,
+	}
+	if err := binding.Validator.ValidateStruct(&req); err != nil {
+		return nil, bindError(err)
+	}
+
+	previous, user, err := r.users.users.UpdateWithPrevious(ctx, userID, req)
+	if err != nil {
+		return nil, err
+	}
+	if user.Role != previous.Role {
+		r.users.revokeTokens(c, user.ID, "role change")
+	}
+	middleware.RequestLogger(c, r.users.logger).Info("User updated", zap.Int("user_id", user.ID))
+	r.users.recordAudit(c, "user.update", user.ID, audit.Changes(previous, user))
+	invalidateCache(c, r.users.cache, r.users.logger)
+	return &user, nil
+}
+
+func (r mutationResolver) DeleteUser(ctx context.Context, id string) (bool, error) {
+	c := requestFrom(ctx).c
+	if err := authorize(c, models.PermUsersDelete); err != nil {
+		return false, err
+	}
+	userID, err := graphqlID(id)
+	if err != nil {
+		return false, err
+	}
+	if err := r.users.users.Delete(ctx, userID); err != nil {
+		return false, err
+	}
+	r.users.revokeTokens(c, userID, "deletion")
+	revokeAPIKeys(c, r.users.keys, r.users.logger, userID, "deletion")
+
+	middleware.RequestLogger(c, r.users.logger).Info("User deleted", zap.Int("user_id", userID), zap.Bool("hard", false))
+	r.users.recordAudit(c, "user.delete", userID)
+	invalidateCache(c, r.users.cache, r.users.logger)
+	return true, nil
+}
+
+// Playground serves GraphiQL for trying queries against the endpoint at
+// the same path. It is only routed in debug mode.
+func (h *GraphQLHandler) Playground(c *gin.Context) {
+	playground.Handler("GraphQL", c.Request.URL.Path).ServeHTTP(c.Writer, c.Request)
+}
@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/cbwinslow/template2/examples/go/internal/middleware"
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+	"github.com/cbwinslow/template2/examples/go/pkg/auth"
+)
+
+// batchCountingRepository counts the GetMany calls reaching the store
+type batchCountingRepository struct {
+	*models.MemoryUserRepository
+	batches [][]int
+}
+
+func (r *batchCountingRepository) GetMany(ctx context.Context, ids []int) ([]models.User, error) {
+	r.batches = append(r.batches, ids)
+	return r.MemoryUserRepository.GetMany(ctx, ids)
+}
+
+func newGraphQLRouter(t *testing.T) (*gin.Engine, *auth.AuthService, *batchCountingRepository) {
+	t.Helper()
+	repo := &batchCountingRepository{MemoryUserRepository: models.NewMemoryUserRepository(0)}
+	users := models.NewUserService(models.WithRepository(repo))
+	authService := auth.NewAuthService()
+	if err := authService.SetPassword(context.Background(), 1, "s3cret-pass"); err != nil {
+		t.Fatalf("SetPassword: %v", err)
+	}
+
+	h := NewGraphQLHandler(NewUserHandler(users, authService, zap.NewNop()), NewAuthHandler(authService, users, zap.NewNop()))
+	router := gin.New()
+	router.POST("/graphql", middleware.AuthRequired(authService, middleware.AllowAnonymous()), h.GraphQL)
+	return router, authService, repo
+}
+
+type graphqlResponse struct {
+	Data   map[string]json.RawMessage `json:"data"`
+	Errors []struct {
+		Message    string                 `json:"message"`
+		Path       []interface{}          `json:"path"`
+		Extensions map[string]interface{} `json:"extensions"`
+	} `json:"errors"`
+}
+
+func postGraphQL(t *testing.T, router *gin.Engine, token, query string, variables map[string]interface{}) graphqlResponse {
+	t.Helper()
+	body, _ := json.Marshal(GraphQLRequest{Query: query, Variables: variables})
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(string(body)))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	var resp graphqlResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("body = %s: %v", w.Body.String(), err)
+	}
+	return resp
+}
+
+func TestGraphQLLoginThenQueriesAsTheUser(t *testing.T) {
+	router, _, _ := newGraphQLRouter(t)
+
+	resp := postGraphQL(t, router, "", `mutation($email: String!, $password: String!) {
+		login(email: $email, password: $password) { tokens { accessToken tokenType } challenge { challengeToken } }
+	}`, map[string]interface{}{"email": "alice@example.com", "password": "s3cret-pass"})
+	if len(resp.Errors) > 0 {
+		t.Fatalf("login errors: %+v", resp.Errors)
+	}
+	var login struct {
+		Tokens struct {
+			AccessToken string `json:"accessToken"`
+			TokenType   string `json:"tokenType"`
+		} `json:"tokens"`
+		Challenge *struct{} `json:"challenge"`
+	}
+	if err := json.Unmarshal(resp.Data["login"], &login); err != nil || login.Tokens.AccessToken == "" || login.Challenge != nil {
+		t.Fatalf("login = %s", resp.Data["login"])
+	}
+
+	resp = postGraphQL(t, router, login.Tokens.AccessToken, `{ me { id email role } }`, nil)
+	if len(resp.Errors) > 0 || string(resp.Data["me"]) != `{"id":"1","email":"alice@example.com","role":"admin"}` {
+		t.Errorf("me = %s, errors %+v", resp.Data["me"], resp.Errors)
+	}
+}
+
+func TestGraphQLLoginRejectsWrongPassword(t *testing.T) {
+	router, _, _ := newGraphQLRouter(t)
+
+	resp := postGraphQL(t, router, "", `mutation { login(email: "alice@example.com", password: "nope") { tokens { accessToken } } }`, nil)
+	if len(resp.Errors) != 1 || resp.Errors[0].Extensions["status"] != float64(http.StatusUnauthorized) {
+		t.Fatalf("errors = %+v, want one 401", resp.Errors)
+	}
+	if string(resp.Data["login"]) != "" {
+		t.Errorf("data = %v, want null", resp.Data)
+	}
+}
+
+func TestGraphQLBatchesUserLookups(t *testing.T) {
+	router, authService, repo := newGraphQLRouter(t)
+	token, _ := authService.GenerateToken(context.Background(), 1, "alice@example.com", models.RoleAdmin)
+
+	resp := postGraphQL(t, router, token, `{
+		a: user(id: "1") { name }
+		b: user(id: "2") { name }
+		c: user(id: "1") { email }
+		missing: user(id: "99") { name }
+	}`, nil)
+	if len(resp.Errors) > 0 {
+		t.Fatalf("errors: %+v", resp.Errors)
+	}
+	if string(resp.Data["a"]) != `{"name":"Alice Johnson"}` || string(resp.Data["b"]) != `{"name":"Bob Smith"}` ||
+		string(resp.Data["missing"]) != "null" {
+		t.Errorf("data = %v", resp.Data)
+	}
+	if len(repo.batches) != 1 || len(repo.batches[0]) != 3 {
+		t.Errorf("GetMany batches = %v, want one of 3 IDs", repo.batches)
+	}
+}
+
+func TestGraphQLEnforcesPermissions(t *testing.T) {
+	router, authService, _ := newGraphQLRouter(t)
+	token, _ := authService.GenerateToken(context.Background(), 2, "bob@example.com", models.RoleUser)
+
+	resp := postGraphQL(t, router, "", `{ users { nodes { id } } }`, nil)
+	if len(resp.Errors) != 1 || resp.Errors[0].Extensions["code"] != string(models.CodeUnauthorized) {
+		t.Errorf("anonymous errors = %+v, want unauthorized", resp.Errors)
+	}
+
+	resp = postGraphQL(t, router, token, `mutation { deleteUser(id: "1") }`, nil)
+	if len(resp.Errors) != 1 || resp.Errors[0].Extensions["code"] != string(models.CodeForbidden) {
+		t.Errorf("user errors = %+v, want forbidden", resp.Errors)
+	}
+}
+
+func TestGraphQLCreatesAndPagesUsers(t *testing.T) {
+	router, authService, _ := newGraphQLRouter(t)
+	token, _ := authService.GenerateToken(context.Background(), 1, "alice@example.com", models.RoleAdmin)
+
+	resp := postGraphQL(t, router, token, `mutation($input: CreateUserInput!) { createUser(input: $input) { id age } }`,
+		map[string]interface{}{"input": map[string]interface{}{"name": "Carol", "email": "not-an-email"}})
+	if len(resp.Errors) != 1 || resp.Errors[0].Extensions["status"] != float64(http.StatusUnprocessableEntity) ||
+		resp.Errors[0].Extensions["fields"] == nil {
+		t.Fatalf("invalid input errors = %+v, want 422 with fields", resp.Errors)
+	}
+
+	resp = postGraphQL(t, router, token, `mutation { createUser(input: {name: "Carol", email: "carol@example.com"}) { id age } }`, nil)
+	if len(resp.Errors) > 0 || string(resp.Data["createUser"]) != `{"id":"3","age":null}` {
+		t.Fatalf("createUser = %s, errors %+v", resp.Data["createUser"], resp.Errors)
+	}
+
+	var page struct {
+		Nodes       []struct{ ID string } `json:"nodes"`
+		EndCursor   string                `json:"endCursor"`
+		HasNextPage bool                  `json:"hasNextPage"`
+	}
+	resp = postGraphQL(t, router, token, `{ users(first: 2) { nodes { id } endCursor hasNextPage } }`, nil)
+	if err := json.Unmarshal(resp.Data["users"], &page); err != nil || len(page.Nodes) != 2 || !page.HasNextPage {
+		t.Fatalf("first page = %s, errors %+v", resp.Data["users"], resp.Errors)
+	}
+	resp = postGraphQL(t, router, token, `query($after: String) { users(first: 2, after: $after) { nodes { id } hasNextPage } }`,
+		map[string]interface{}{"after": page.EndCursor})
+	if string(resp.Data["users"]) != `{"nodes":[{"id":"3"}],"hasNextPage":false}` {
+		t.Errorf("second page = %s, errors %+v", resp.Data["users"], resp.Errors)
+	}
+
+	resp = postGraphQL(t, router, token, `{ users(after: "bogus") { hasNextPage } }`, nil)
+	if len(resp.Errors) != 1 || resp.Errors[0].Extensions["code"] != string(models.CodeInvalidPage) {
+		t.Errorf("bad cursor errors = %+v", resp.Errors)
+	}
+}
+
+func TestGraphQLRejectsMalformedRequests(t *testing.T) {
+	router, _, _ := newGraphQLRouter(t)
+
+	for name, body := range map[string]string{
+		"not json":      `query { me { id } }`,
+		"missing query": `{"variables":{}}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want 400", w.Code)
+			}
+		})
+	}
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(`{"query":"{ me { id } }"}`))
+	req.Header.Set("Authorization", "Bearer not-a-token")
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("invalid token status = %d, want 401", w.Code)
+	}
+}
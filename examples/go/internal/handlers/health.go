@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/cbwinslow/template2/examples/go/internal/middleware"
+)
+
+// Health statuses reported by HealthCheck
+const (
+	StatusHealthy  = "healthy"
+	StatusDegraded = "degraded"
+)
+
+// Version is the API version reported by the health endpoint
+const Version = "1.0.0"
+
+// CheckResult is the outcome of a single health check
+type CheckResult struct {
+	Healthy bool                   `json:"healthy"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// Checker is a named health check
+type Checker interface {
+	Name() string
+	Check(ctx context.Context) CheckResult
+}
+
+// HealthResponse is the body returned by HealthCheck
+type HealthResponse struct {
+	Status    string                 `json:"status"`
+	Version   string                 `json:"version"`
+	Timestamp time.Time              `json:"timestamp"`
+	Checks    map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// HealthHandler serves the health endpoint
+type HealthHandler struct {
+	logger *zap.Logger
+	checks []Checker
+}
+
+// NewHealthHandler creates a health handler running the given checks
+func NewHealthHandler(logger *zap.Logger, checks ...Checker) *HealthHandler {
+	return &HealthHandler{logger: logger, checks: checks}
+}
+
+// HealthCheck godoc
+// @Summary Health check
+// @Description Reports service health, running every dependency check at once and listing each one's result. Returns 503 when any check is degraded.
+// @Tags health
+// @Produce json
+// @Success 200 {object} HealthResponse
+// @Failure 503 {object} HealthResponse
+// @Router /health [get]
+func (h *HealthHandler) HealthCheck(c *gin.Context) {
+	resp := HealthResponse{
+		Status:    StatusHealthy,
+		Version:   Version,
+		Timestamp: time.Now().UTC(),
+	}
+
+	// Checks run concurrently, so a slow dependency costs its own timeout
+	// rather than adding to every other check's
+	results := make([]CheckResult, len(h.checks))
+	var wg sync.WaitGroup
+	for i, check := range h.checks {
+		wg.Add(1)
+		go func(i int, check Checker) {
+			defer wg.Done()
+			results[i] = check.Check(c.Request.Context())
+		}(i, check)
+	}
+	wg.Wait()
+
+	if len(h.checks) > 0 {
+		resp.Checks = make(map[string]CheckResult, len(h.checks))
+	}
+	for i, check := range h.checks {
+		result := results[i]
+		resp.Checks[check.Name()] = result
+		if !result.Healthy {
+			resp.Status = StatusDegraded
+			middleware.RequestLogger(c, h.logger).Warn("Health check failed", zap.String("check", check.Name()), zap.Any("details", result.Details))
+		}
+	}
+
+	status := http.StatusOK
+	if resp.Status != StatusHealthy {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, resp)
+}
+
+// Liveness godoc
+// @Summary Liveness probe
+// @Description Reports that the process is running without evaluating dependency checks.
+// @Tags health
+// @Produce json
+// @Success 200 {object} HealthResponse
+// @Router /livez [get]
+func (h *HealthHandler) Liveness(c *gin.Context) {
+	c.JSON(http.StatusOK, HealthResponse{
+		Status:    StatusHealthy,
+		Version:   Version,
+		Timestamp: time.Now().UTC(),
+	})
+}
+
+// HealthPaths lists the routes the probes are served on
+type HealthPaths struct {
+	Liveness  []string
+	Readiness []string
+}
+
+// RegisterHealthRoutes serves Liveness on every liveness path and
+// HealthCheck, which runs the dependency checks, on every readiness path
+func RegisterHealthRoutes(router gin.IRoutes, h *HealthHandler, paths HealthPaths) {
+	for _, path := range paths.Liveness {
+		router.GET(path, h.Liveness)
+	}
+	for _, path := range paths.Readiness {
+		router.GET(path, h.HealthCheck)
+	}
+}
+
+// GoroutineChecker reports degraded when the number of goroutines exceeds
+// Threshold, which helps surface goroutine leaks in long-running deployments
+type GoroutineChecker struct {
+	Threshold int
+	count     func() int
+}
+
+// NewGoroutineChecker creates a goroutine count check
+func NewGoroutineChecker(threshold int) *GoroutineChecker {
+	return &GoroutineChecker{Threshold: threshold, count: runtime.NumGoroutine}
+}
+
+// Name implements Checker
+func (g *GoroutineChecker) Name() string {
+	return "goroutines"
+}
+
+// Check implements Checker
+func (g *GoroutineChecker) Check(ctx context.Context) CheckResult {
+	count := g.count()
+	return CheckResult{
+		Healthy: count <= g.Threshold,
+		Details: map[string]interface{}{
+			"count":     count,
+			"threshold": g.Threshold,
+		},
+	}
+}
+
+// timeoutChecker bounds the check it wraps; see NewTimeoutChecker
+type timeoutChecker struct {
+	Checker
+	timeout time.Duration
+}
+
+// NewTimeoutChecker bounds check to timeout. The check's context is
+// cancelled when the timeout passes, and a check still running then is
+// reported unhealthy without waiting for it to return.
+func NewTimeoutChecker(check Checker, timeout time.Duration) Checker {
+	return &timeoutChecker{Checker: check, timeout: timeout}
+}
+
+// Check implements Checker
+func (t *timeoutChecker) Check(ctx context.Context) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+
+	done := make(chan CheckResult, 1)
+	go func() { done <- t.Checker.Check(ctx) }()
+	select {
+	case result := <-done:
+		return result
+	case <-ctx.Done():
+		return CheckResult{Details: map[string]interface{}{"error": "timed out after " + t.timeout.String()}}
+	}
+}
+
+// PingChecker reports whether a dependency such as a database or Redis
+// answers a ping, and how long it took
+type PingChecker struct {
+	name string
+	ping func(ctx context.Context) error
+}
+
+// NewPingChecker creates a check named name that calls ping
+func NewPingChecker(name string, ping func(ctx context.Context) error) *PingChecker {
+	return &PingChecker{name: name, ping: ping}
+}
+
+// Name implements Checker
+func (p *PingChecker) Name() string {
+	return p.name
+}
+
+// Check implements Checker
+func (p *PingChecker) Check(ctx context.Context) CheckResult {
+	start := time.Now()
+	if err := p.ping(ctx); err != nil {
+		return CheckResult{Details: map[string]interface{}{"error": err.Error()}}
+	}
+	return CheckResult{Healthy: true, Details: map[string]interface{}{"latency_ms": time.Since(start).Milliseconds()}}
+}
+
+// MigrationChecker reports degraded while the database schema has
+// migrations left to apply, so a replica does not take traffic against a
+// schema older than its code
+type MigrationChecker struct {
+	pending func(ctx context.Context) ([]string, error)
+}
+
+// NewMigrationChecker creates a migration check; pending lists the
+// migrations not yet applied
+func NewMigrationChecker(pending func(ctx context.Context) ([]string, error)) *MigrationChecker {
+	return &MigrationChecker{pending: pending}
+}
+
+// Name implements Checker
+func (m *MigrationChecker) Name() string {
+	return "migrations"
+}
+
+// Check implements Checker
+func (m *MigrationChecker) Check(ctx context.Context) CheckResult {
+	pending, err := m.pending(ctx)
+	if err != nil {
+		return CheckResult{Details: map[string]interface{}{"error": err.Error()}}
+	}
+	if len(pending) > 0 {
+		return CheckResult{Details: map[string]interface{}{"pending": pending}}
+	}
+	return CheckResult{Healthy: true}
+}
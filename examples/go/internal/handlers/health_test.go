@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+func serveHealth(t *testing.T, h *HealthHandler) (int, HealthResponse) {
+	t.Helper()
+	router := gin.New()
+	router.GET("/health", h.HealthCheck)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+	var resp HealthResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return w.Code, resp
+}
+
+func TestHealthCheckDegradedWhenGoroutinesExceedThreshold(t *testing.T) {
+	checker := NewGoroutineChecker(1)
+	checker.count = func() int { return 5 }
+
+	status, resp := serveHealth(t, NewHealthHandler(zap.NewNop(), checker))
+
+	if status != http.StatusServiceUnavailable || resp.Status != StatusDegraded {
+		t.Fatalf("got %d %q, want 503 %q", status, resp.Status, StatusDegraded)
+	}
+	result := resp.Checks["goroutines"]
+	if result.Healthy {
+		t.Error("goroutine check reported healthy")
+	}
+	if result.Details["count"] != float64(5) {
+		t.Errorf("count = %v, want 5", result.Details["count"])
+	}
+}
+
+func TestHealthCheckHealthyWithinThreshold(t *testing.T) {
+	status, resp := serveHealth(t, NewHealthHandler(zap.NewNop(), NewGoroutineChecker(100000)))
+
+	if status != http.StatusOK || resp.Status != StatusHealthy {
+		t.Errorf("got %d %q, want 200 %q", status, resp.Status, StatusHealthy)
+	}
+	if _, ok := resp.Checks["goroutines"].Details["count"]; !ok {
+		t.Error("expected the current goroutine count in the response")
+	}
+}
+
+func TestRegisterHealthRoutesServesDefaultAndCustomPaths(t *testing.T) {
+	h := NewHealthHandler(zap.NewNop())
+	router := gin.New()
+	RegisterHealthRoutes(router, h, HealthPaths{
+		Liveness:  []string{"/livez", "/healthz", "/ops/alive"},
+		Readiness: []string{"/readyz", "/ops/ready"},
+	})
+
+	for _, path := range []string{"/livez", "/healthz", "/ops/alive", "/readyz", "/ops/ready"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("GET %s = %d, want 200", path, w.Code)
+		}
+	}
+}
+
+func TestReadinessRunsChecksButLivenessDoesNot(t *testing.T) {
+	checker := NewGoroutineChecker(1)
+	checker.count = func() int { return 5 }
+	router := gin.New()
+	RegisterHealthRoutes(router, NewHealthHandler(zap.NewNop(), checker), HealthPaths{
+		Liveness:  []string{"/livez"},
+		Readiness: []string{"/readyz"},
+	})
+
+	for path, want := range map[string]int{"/livez": http.StatusOK, "/readyz": http.StatusServiceUnavailable} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != want {
+			t.Errorf("GET %s = %d, want %d", path, w.Code, want)
+		}
+	}
+}
+
+func TestReadinessReportsEachDependency(t *testing.T) {
+	slow := NewTimeoutChecker(NewPingChecker("redis", func(ctx context.Context) error {
+		<-ctx.Done()
+		time.Sleep(time.Second) // ignores cancellation for a while
+		return ctx.Err()
+	}), 20*time.Millisecond)
+	db := NewPingChecker("database", func(context.Context) error { return nil })
+	migrations := NewMigrationChecker(func(context.Context) ([]string, error) {
+		return []string{"00003_add_locked_at.sql"}, nil
+	})
+
+	start := time.Now()
+	status, resp := serveHealth(t, NewHealthHandler(zap.NewNop(), slow, db, migrations))
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("readiness took %v; the timed-out check was waited for", elapsed)
+	}
+
+	if status != http.StatusServiceUnavailable || resp.Status != StatusDegraded {
+		t.Fatalf("got %d %q, want 503 %q", status, resp.Status, StatusDegraded)
+	}
+	if r := resp.Checks["redis"]; r.Healthy || r.Details["error"] != "timed out after 20ms" {
+		t.Errorf("redis = %+v, want a timeout", r)
+	}
+	if r := resp.Checks["database"]; !r.Healthy {
+		t.Errorf("database = %+v, want healthy", r)
+	}
+	if r := resp.Checks["migrations"]; r.Healthy || len(r.Details["pending"].([]interface{})) != 1 {
+		t.Errorf("migrations = %+v, want one pending", r)
+	}
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"go.uber.org/zap"
+
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+	"github.com/cbwinslow/template2/examples/go/pkg/jobs"
+	"github.com/cbwinslow/template2/examples/go/pkg/mailer"
+)
+
+// Job types the auth handler enqueues
+const (
+	JobVerificationMail  = "mail.verification"
+	JobPasswordResetMail = "mail.password_reset"
+)
+
+// verificationMailJob is the payload of a JobVerificationMail job
+type verificationMailJob struct {
+	UserID int `json:"user_id"`
+}
+
+// resetMailJob is the payload of a JobPasswordResetMail job
+type resetMailJob struct {
+	Email string `json:"email"`
+}
+
+// WithJobQueue makes Register and ForgotPassword send their mail through
+// queue, which retries it when the relay fails, instead of while the
+// request waits. The handler registers its job types on queue.
+func WithJobQueue(queue *jobs.Queue) AuthHandlerOption {
+	return func(h *AuthHandler) {
+		h.jobs = queue
+	}
+}
+
+// registerJobs registers the handlers of the jobs h enqueues
+func (h *AuthHandler) registerJobs() {
+	if h.verification != nil {
+		h.jobs.Register(JobVerificationMail, h.runVerificationMail)
+	}
+	if h.reset != nil {
+		h.jobs.Register(JobPasswordResetMail, h.runResetMail)
+	}
+}
+
+// queueVerification mails user a verification link, through the job queue
+// if there is one
+func (h *AuthHandler) queueVerification(ctx context.Context, user models.User) error {
+	if h.jobs == nil {
+		return h.sendVerification(ctx, user)
+	}
+	_, err := h.jobs.Enqueue(ctx, JobVerificationMail, verificationMailJob{UserID: user.ID})
+	return err
+}
+
+func (h *AuthHandler) runVerificationMail(ctx context.Context, payload json.RawMessage) error {
+	var job verificationMailJob
+	if err := json.Unmarshal(payload, &job); err != nil {
+		return jobs.Permanent(err)
+	}
+
+	user, err := h.users.Get(ctx, job.UserID)
+	switch {
+	case errors.Is(err, models.ErrUserNotFound):
+		// The account was deleted before its mail went out
+		return jobs.Permanent(err)
+	case err != nil:
+		return err
+	case user.EmailVerified:
+		return nil
+	}
+	if err := h.sendVerification(ctx, user); err != nil {
+		return mailJobError(err)
+	}
+	h.logger.Info("Verification email sent", zap.Int("user_id", user.ID))
+	return nil
+}
+
+func (h *AuthHandler) runResetMail(ctx context.Context, payload json.RawMessage) error {
+	var job resetMailJob
+	if err := json.Unmarshal(payload, &job); err != nil {
+		return jobs.Permanent(err)
+	}
+	return mailJobError(h.requestReset(ctx, h.logger, job.Email))
+}
+
+// mailJobError keeps the queue from retrying mail the relay or API refused
+func mailJobError(err error) error {
+	if mailer.Permanent(err) {
+		return jobs.Permanent(err)
+	}
+	return err
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+	"github.com/cbwinslow/template2/examples/go/pkg/auth"
+	"github.com/cbwinslow/template2/examples/go/pkg/jobs"
+	"github.com/cbwinslow/template2/examples/go/pkg/mailer"
+)
+
+// flakyMailer fails its first failures sends; it is safe to use from the
+// queue's workers
+type flakyMailer struct {
+	mu       sync.Mutex
+	failures int
+	sent     []mailer.Message
+}
+
+func (m *flakyMailer) Send(_ context.Context, msg mailer.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.failures > 0 {
+		m.failures--
+		return errors.New("relay unavailable")
+	}
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func (m *flakyMailer) messages() []mailer.Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]mailer.Message(nil), m.sent...)
+}
+
+func TestRegisterQueuesVerificationMail(t *testing.T) {
+	mail := &flakyMailer{failures: 1}
+	queue := jobs.New(jobs.NewMemoryStore(), zap.NewNop(),
+		jobs.WithPollInterval(5*time.Millisecond), jobs.WithRetry(3, time.Millisecond, time.Millisecond))
+	h := NewAuthHandler(auth.NewAuthService(), models.NewUserService(), zap.NewNop(),
+		WithEmailVerification(EmailVerification{Mailer: mail, URL: "https://app.example.com/verify"}),
+		WithJobQueue(queue))
+	router := gin.New()
+	router.POST("/auth/register", h.Register)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/auth/register",
+		strings.NewReader(`{"name":"Ivy","email":"ivy@example.com","password":"s3cret-pass"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("register: %d %s", w.Code, w.Body.String())
+	}
+	if sent := mail.messages(); len(sent) != 0 {
+		t.Fatalf("sent %+v before the queue ran", sent)
+	}
+
+	// The first send fails and is retried
+	_ = queue.Start(context.Background())
+	defer queue.Stop(context.Background())
+	deadline := time.Now().Add(2 * time.Second)
+	for len(mail.messages()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(2 * time.Millisecond)
+	}
+	if sent := mail.messages(); len(sent) != 1 || sent[0].To != "ivy@example.com" || !strings.Contains(sent[0].Body, "https://app.example.com/verify?token=") {
+		t.Errorf("sent %+v, want one verification link to ivy@example.com", sent)
+	}
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// PatchOperation is a single RFC 6902 JSON Patch operation
+type PatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value"`
+}
+
+// MarshalJSON omits value for remove operations only, so that zero values
+// such as false or 0 are still sent for add and replace
+func (o PatchOperation) MarshalJSON() ([]byte, error) {
+	if o.Op == "remove" {
+		return json.Marshal(struct {
+			Op   string `json:"op"`
+			Path string `json:"path"`
+		}{o.Op, o.Path})
+	}
+	type operation PatchOperation
+	return json.Marshal(operation(o))
+}
+
+// jsonPatchDiff returns the operations that turn the JSON encoding of
+// before into that of after. Only top-level members are compared, which
+// matches the flat user resource; nested values are replaced wholesale.
+func jsonPatchDiff(before, after interface{}) ([]PatchOperation, error) {
+	from, err := toJSONObject(before)
+	if err != nil {
+		return nil, err
+	}
+	to, err := toJSONObject(after)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(from)+len(to))
+	for key := range from {
+		keys = append(keys, key)
+	}
+	for key := range to {
+		if _, ok := from[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	ops := []PatchOperation{}
+	for _, key := range keys {
+		oldValue, hadOld := from[key]
+		newValue, hasNew := to[key]
+		path := "/" + escapeJSONPointer(key)
+
+		switch {
+		case hadOld && !hasNew:
+			ops = append(ops, PatchOperation{Op: "remove", Path: path})
+		case !hadOld && hasNew:
+			ops = append(ops, PatchOperation{Op: "add", Path: path, Value: newValue})
+		case !reflect.DeepEqual(oldValue, newValue):
+			ops = append(ops, PatchOperation{Op: "replace", Path: path, Value: newValue})
+		}
+	}
+
+	return ops, nil
+}
+
+func toJSONObject(v interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var obj map[string]interface{}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// escapeJSONPointer escapes a member name for use in an RFC 6901 pointer
+func escapeJSONPointer(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "~", "~0"), "/", "~1")
+}
+
+// jsonPatchRender writes operations with the application/json-patch+json
+// media type
+type jsonPatchRender struct {
+	ops []PatchOperation
+}
+
+func (r jsonPatchRender) Render(w http.ResponseWriter) error {
+	r.WriteContentType(w)
+	return json.NewEncoder(w).Encode(r.ops)
+}
+
+func (r jsonPatchRender) WriteContentType(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json-patch+json")
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+)
+
+func TestUpdateUserReturnDiff(t *testing.T) {
+	h := NewUserHandler(models.NewUserService(), &recordingRevoker{}, zap.NewNop())
+	router := gin.New()
+	router.PATCH("/api/v1/users/:id", h.UpdateUser)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPatch, "/api/v1/users/2", strings.NewReader(`{"name":"Robert","active":false}`))
+	req.Header.Set("Prefer", "return=diff")
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Content-Type"); got != "application/json-patch+json" {
+		t.Errorf("Content-Type = %q", got)
+	}
+	if got := w.Header().Get("Preference-Applied"); got != "return=diff" {
+		t.Errorf("Preference-Applied = %q", got)
+	}
+
+	var ops []map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &ops); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	byPath := map[string]map[string]interface{}{}
+	for _, op := range ops {
+		byPath[op["path"].(string)] = op
+	}
+
+	want := map[string]interface{}{"/name": "Robert", "/active": false}
+	for path, value := range want {
+		op, ok := byPath[path]
+		if !ok {
+			t.Errorf("missing operation for %s in %v", path, ops)
+			continue
+		}
+		if op["op"] != "replace" || op["value"] != value {
+			t.Errorf("%s: got %v, want replace with %v", path, op, value)
+		}
+	}
+	if _, ok := byPath["/updated_at"]; !ok {
+		t.Error("expected updated_at to be reported as changed")
+	}
+	for _, unchanged := range []string{"/email", "/role", "/id"} {
+		if _, ok := byPath[unchanged]; ok {
+			t.Errorf("unchanged field %s reported in patch", unchanged)
+		}
+	}
+}
+
+func TestJSONPatchDiffAddAndRemove(t *testing.T) {
+	ops, err := jsonPatchDiff(
+		map[string]interface{}{"a/b": 1, "gone": true},
+		map[string]interface{}{"a/b": 1, "new": 0},
+	)
+	if err != nil {
+		t.Fatalf("jsonPatchDiff: %v", err)
+	}
+
+	data, _ := json.Marshal(ops)
+	want := `[{"op":"remove","path":"/gone"},{"op":"add","path":"/new","value":0}]`
+	if string(data) != want {
+		t.Errorf("patch = %s, want %s", data, want)
+	}
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/cbwinslow/template2/examples/go/internal/middleware"
+	"github.com/cbwinslow/template2/examples/go/pkg/audit"
+)
+
+// LogLevel is the minimum level of the application log
+type LogLevel struct {
+	Level string `json:"level" binding:"required,oneof=debug info warn error" example:"debug"`
+}
+
+// WithLogLevel lets admins read and change level, the level of the
+// application logger, at runtime
+func WithLogLevel(level zap.AtomicLevel) AdminHandlerOption {
+	return func(h *AdminHandler) {
+		h.level = &level
+	}
+}
+
+// GetLogLevel godoc
+// @Summary Get the log level
+// @Description Returns the minimum level the application currently logs at.
+// @Tags admin
+// @Produce json
+// @Success 200 {object} LogLevel
+// @Failure 403 {object} apierror.Problem
+// @Security ApiKeyAuth
+// @Router /admin/loglevel [get]
+func (h *AdminHandler) GetLogLevel(c *gin.Context) {
+	c.JSON(http.StatusOK, LogLevel{Level: h.level.Level().String()})
+}
+
+// SetLogLevel godoc
+// @Summary Change the log level
+// @Description Sets the minimum level the application logs at until the next change or restart, e.g. debug while investigating an incident. The change is audited.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param level body LogLevel true "New level"
+// @Success 200 {object} LogLevel
+// @Failure 400 {object} apierror.Problem
+// @Failure 403 {object} apierror.Problem
+// @Failure 422 {object} apierror.Problem
+// @Security ApiKeyAuth
+// @Router /admin/loglevel [put]
+func (h *AdminHandler) SetLogLevel(c *gin.Context) {
+	var req LogLevel
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	previous := LogLevel{Level: h.level.Level().String()}
+	if err := h.level.UnmarshalText([]byte(req.Level)); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	middleware.RequestLogger(c, h.logger).Warn("Log level changed", zap.String("from", previous.Level), zap.String("to", req.Level))
+	writeAudit(c, h.audit, "log.set_level", 0, audit.Changes(previous, req))
+	c.JSON(http.StatusOK, req)
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/cbwinslow/template2/examples/go/internal/logging"
+	"github.com/cbwinslow/template2/examples/go/internal/middleware"
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+)
+
+func TestSetLogLevel(t *testing.T) {
+	authService, users := newAuthFixture(t)
+	adminToken, _ := authService.GenerateToken(context.Background(), 1, "alice@example.com", models.RoleAdmin)
+	userToken, _ := authService.GenerateToken(context.Background(), 2, "hana@example.com", models.RoleUser)
+	level := zap.NewAtomicLevelAt(zap.InfoLevel)
+	trail := logging.NewAuditTrail(10)
+
+	h := NewAdminHandler(users, authService, zap.NewNop(), WithLogLevel(level), WithAdminAudit(zap.New(trail.Core()), trail))
+	router := gin.New()
+	logs := router.Group("/admin/loglevel", middleware.AuthRequired(authService), middleware.RequirePermission(models.PermLogsManage))
+	logs.GET("", h.GetLogLevel)
+	logs.PUT("", h.SetLogLevel)
+	do := func(method, body, token string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, "/admin/loglevel", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do(http.MethodPut, `{"level":"debug"}`, userToken); w.Code != http.StatusForbidden {
+		t.Errorf("as a user: status = %d, want 403", w.Code)
+	}
+	if w := do(http.MethodPut, `{"level":"trace"}`, adminToken); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("unknown level: status = %d, want 422", w.Code)
+	}
+	if w := do(http.MethodPut, `{"level":"debug"}`, adminToken); w.Code != http.StatusOK {
+		t.Fatalf("set debug: %d %s", w.Code, w.Body.String())
+	}
+	if level.Level() != zapcore.DebugLevel {
+		t.Errorf("level = %v, want debug", level.Level())
+	}
+	if w := do(http.MethodGet, "", adminToken); w.Body.String() != `{"level":"debug"}` {
+		t.Errorf("get: %s", w.Body.String())
+	}
+
+	records := trail.Records(logging.AuditQuery{Action: "log.set_level"})
+	if len(records) != 1 || records[0].ActorID != 1 || records[0].Changes["level"].After != "debug" {
+		t.Errorf("audit records = %+v", records)
+	}
+}
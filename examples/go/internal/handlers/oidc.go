@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/cbwinslow/template2/examples/go/internal/middleware"
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+	"github.com/cbwinslow/template2/examples/go/pkg/auth"
+)
+
+// oidcStateCookie binds a provider login to the browser that started it
+const oidcStateCookie = "oidc_state"
+
+// OIDCFlow runs logins through external identity providers
+type OIDCFlow interface {
+	Begin(provider string) (state, redirectURL string, err error)
+	Complete(ctx context.Context, state, code string) (auth.ExternalIdentity, error)
+}
+
+// WithOIDC enables signing in through external identity providers
+func WithOIDC(flow OIDCFlow) AuthHandlerOption {
+	return func(h *AuthHandler) {
+		h.oidc = flow
+	}
+}
+
+// OIDCLogin godoc
+// @Summary Start an identity provider login
+// @Description Redirects the browser to the provider's consent page. The provider sends it back to /auth/oidc/callback.
+// @Tags auth
+// @Param provider query string true "Configured provider name, e.g. google or github"
+// @Success 302
+// @Failure 400 {object} apierror.Problem
+// @Router /auth/oidc/login [get]
+func (h *AuthHandler) OIDCLogin(c *gin.Context) {
+	if h.oidc == nil {
+		respondError(c, http.StatusNotFound, models.CodeNotFound, "Identity provider login is not enabled")
+		return
+	}
+
+	state, redirect, err := h.oidc.Begin(c.Query("provider"))
+	if err != nil {
+		if errors.Is(err, auth.ErrUnknownProvider) {
+			respondError(c, http.StatusBadRequest, models.CodeValidationFailed, "Unknown identity provider")
+			return
+		}
+		respondServiceError(c, err)
+		return
+	}
+
+	// Lax so the cookie comes back on the provider's top-level redirect
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, state, 600, "/", "", isHTTPS(c), true)
+	c.Redirect(http.StatusFound, redirect)
+}
+
+// OIDCCallback godoc
+// @Summary Finish an identity provider login
+// @Description Exchanges the provider's code for the user's identity, signs in the local account with the same verified email (creating it on first login) and issues the app's tokens. Accounts with two-factor authentication get a challenge to complete at /auth/2fa/verify instead, as with a password login.
+// @Tags auth
+// @Produce json
+// @Param state query string true "State from the login redirect"
+// @Param code query string true "Authorization code"
+// @Success 200 {object} TokenResponse
+// @Success 202 {object} TwoFactorChallengeResponse
+// @Failure 400 {object} apierror.Problem
+// @Failure 401 {object} apierror.Problem
+// @Failure 403 {object} apierror.Problem
+// @Router /auth/oidc/callback [get]
+func (h *AuthHandler) OIDCCallback(c *gin.Context) {
+	if h.oidc == nil {
+		respondError(c, http.StatusNotFound, models.CodeNotFound, "Identity provider login is not enabled")
+		return
+	}
+
+	if reason := c.Query("error"); reason != "" {
+		respondError(c, http.StatusUnauthorized, models.CodeUnauthorized, "Identity provider denied the login: "+reason)
+		return
+	}
+	state := c.Query("state")
+	cookie, err := c.Cookie(oidcStateCookie)
+	if err != nil || state == "" || cookie != state {
+		respondError(c, http.StatusBadRequest, models.CodeValidationFailed, "Login state does not match this browser")
+		return
+	}
+	c.SetCookie(oidcStateCookie, "", -1, "/", "", isHTTPS(c), true)
+
+	ctx := c.Request.Context()
+	identity, err := h.oidc.Complete(ctx, state, c.Query("code"))
+	switch {
+	case errors.Is(err, auth.ErrInvalidState):
+		respondError(c, http.StatusBadRequest, models.CodeValidationFailed, "Login expired; please start again")
+		return
+	case errors.Is(err, auth.ErrEmailUnverified):
+		respondError(c, http.StatusForbidden, models.CodeForbidden, "The identity provider has not verified your email address")
+		return
+	case err != nil:
+		middleware.RequestLogger(c, h.logger).Warn("Identity provider login failed", zap.Error(err))
+		respondError(c, http.StatusUnauthorized, models.CodeUnauthorized, "Identity provider login failed")
+		return
+	}
+
+	user, err := h.users.GetByEmail(ctx, identity.Email)
+	if errors.Is(err, models.ErrUserNotFound) {
+		name := identity.Name
+		if name == "" {
+			name, _, _ = strings.Cut(identity.Email, "@")
+		}
+		user, err = h.users.Create(ctx, models.CreateUserRequest{Name: name, Email: identity.Email})
+		if err == nil {
+			middleware.RequestLogger(c, h.logger).Info("User registered via identity provider",
+				zap.Int("user_id", user.ID), zap.String("provider", identity.Provider))
+			invalidateCache(c, h.cache, h.logger)
+		}
+	}
+	if err != nil {
+		respondServiceError(c, err)
+		return
+	}
+	if user.LockedAt != nil {
+		respondAccountLocked(c)
+		return
+	}
+	if h.twoFactor {
+		enabled, err := h.auth.TwoFactorEnabled(ctx, user.ID)
+		if err != nil {
+			respondServiceError(c, err)
+			return
+		}
+		if enabled {
+			h.respondChallenge(c, user.ID)
+			return
+		}
+	}
+
+	pair, err := h.auth.IssueTokenPair(c.Request.Context(), user.ID, user.Email, user.Role, sessionClient(c))
+	if err != nil {
+		respondServiceError(c, err)
+		return
+	}
+
+	middleware.RequestLogger(c, h.logger).Info("User logged in", zap.Int("user_id", user.ID), zap.String("provider", identity.Provider))
+	h.respondTokens(c, pair)
+}
+
+func isHTTPS(c *gin.Context) bool {
+	return c.Request.TLS != nil || strings.EqualFold(c.GetHeader("X-Forwarded-Proto"), "https")
+}
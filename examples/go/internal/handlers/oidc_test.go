@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+	"github.com/cbwinslow/template2/examples/go/pkg/auth"
+)
+
+// fakeOIDC completes every login begun with it as identity
+type fakeOIDC struct {
+	identity auth.ExternalIdentity
+	state    string
+}
+
+func (f *fakeOIDC) Begin(provider string) (string, string, error) {
+	if provider != "corp" {
+		return "", "", auth.ErrUnknownProvider
+	}
+	f.state = "state-1"
+	return f.state, "https://idp.example.com/authorize?state=" + f.state, nil
+}
+
+func (f *fakeOIDC) Complete(_ context.Context, state, code string) (auth.ExternalIdentity, error) {
+	if state != f.state || code != "code-1" {
+		return auth.ExternalIdentity{}, auth.ErrInvalidState
+	}
+	return f.identity, nil
+}
+
+func newOIDCRouter(flow OIDCFlow, users *models.UserService) *gin.Engine {
+	h := NewAuthHandler(auth.NewAuthService(), users, zap.NewNop(), WithOIDC(flow))
+	router := gin.New()
+	router.GET("/auth/oidc/login", h.OIDCLogin)
+	router.GET("/auth/oidc/callback", h.OIDCCallback)
+	return router
+}
+
+func oidcRoundTrip(t *testing.T, router *gin.Engine) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/auth/oidc/login?provider=corp", nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("login: status = %d, want 302", w.Code)
+	}
+	cookies := w.Result().Cookies()
+
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/auth/oidc/callback?state=state-1&code=code-1", nil)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestOIDCCallbackCreatesAndSignsInUser(t *testing.T) {
+	users := models.NewUserService()
+	flow := &fakeOIDC{identity: auth.ExternalIdentity{Provider: "corp", Subject: "1", Email: "zoe@example.com", Name: "Zoe"}}
+	router := newOIDCRouter(flow, users)
+
+	w := oidcRoundTrip(t, router)
+	var tokens TokenResponse
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &tokens) != nil || tokens.AccessToken == "" {
+		t.Fatalf("callback: %d %s", w.Code, w.Body.String())
+	}
+	user, err := users.GetByEmail(context.Background(), "zoe@example.com")
+	if err != nil || user.Name != "Zoe" {
+		t.Fatalf("local user = %+v, %v", user, err)
+	}
+
+	// A second login reuses the account
+	before, _ := users.List(context.Background())
+	if w := oidcRoundTrip(t, router); w.Code != http.StatusOK {
+		t.Fatalf("second callback: %d %s", w.Code, w.Body.String())
+	}
+	if after, _ := users.List(context.Background()); len(after) != len(before) {
+		t.Errorf("second login created another user")
+	}
+}
+
+func TestOIDCCallbackChallengesTwoFactorAccounts(t *testing.T) {
+	ctx := context.Background()
+	authService := auth.NewAuthService()
+	setup, _ := authService.SetupTwoFactor(ctx, 1, "alice@example.com")
+	code, _ := auth.GenerateTOTPCode(setup.Secret, time.Now())
+	if _, err := authService.EnableTwoFactor(ctx, 1, code); err != nil {
+		t.Fatalf("EnableTwoFactor: %v", err)
+	}
+
+	flow := &fakeOIDC{identity: auth.ExternalIdentity{Provider: "corp", Subject: "1", Email: "alice@example.com"}}
+	h := NewAuthHandler(authService, models.NewUserService(), zap.NewNop(), WithOIDC(flow), WithTwoFactor())
+	router := gin.New()
+	router.GET("/auth/oidc/login", h.OIDCLogin)
+	router.GET("/auth/oidc/callback", h.OIDCCallback)
+
+	w := oidcRoundTrip(t, router)
+	var challenge TwoFactorChallengeResponse
+	if w.Code != http.StatusAccepted || json.Unmarshal(w.Body.Bytes(), &challenge) != nil || challenge.ChallengeToken == "" {
+		t.Fatalf("callback: %d %s, want a two-factor challenge", w.Code, w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "access_token") {
+		t.Error("callback issued tokens before the second factor")
+	}
+}
+
+func TestOIDCCallbackRejectsStateFromAnotherBrowser(t *testing.T) {
+	flow := &fakeOIDC{identity: auth.ExternalIdentity{Email: "zoe@example.com"}}
+	router := newOIDCRouter(flow, models.NewUserService())
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/auth/oidc/login?provider=corp", nil))
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/auth/oidc/callback?state=state-1&code=code-1", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("callback without state cookie: status = %d, want 400", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/auth/oidc/login?provider=other", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("unknown provider: status = %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Values of the RFC 7240 "return" preference
+const (
+	returnMinimal        = "minimal"
+	returnRepresentation = "representation"
+	// returnDiff is a non-standard value asking for an RFC 6902 JSON Patch
+	// describing the applied change instead of the resource
+	returnDiff = "diff"
+)
+
+// preference returns the value of the named preference in the request's
+// Prefer headers, or an empty string if the client did not express it
+func preference(c *gin.Context, name string) string {
+	for _, header := range c.Request.Header.Values("Prefer") {
+		for _, pref := range strings.Split(header, ",") {
+			token, _, _ := strings.Cut(pref, ";")
+			key, value, _ := strings.Cut(strings.TrimSpace(token), "=")
+			if strings.EqualFold(key, name) {
+				return strings.ToLower(strings.Trim(value, `"`))
+			}
+		}
+	}
+	return ""
+}
+
+// respondResource writes a created or updated resource honoring the
+// "return" preference. With return=minimal only the Location header is sent
+// with 204 No Content; otherwise body is written with status.
+func respondResource(c *gin.Context, status int, location string, body interface{}) {
+	c.Header("Location", location)
+
+	switch preference(c, "return") {
+	case returnMinimal:
+		c.Header("Preference-Applied", "return="+returnMinimal)
+		c.Status(http.StatusNoContent)
+	case returnRepresentation:
+		c.Header("Preference-Applied", "return="+returnRepresentation)
+		c.JSON(status, body)
+	default:
+		c.JSON(status, body)
+	}
+}
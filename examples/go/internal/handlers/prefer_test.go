@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+)
+
+func newPreferRouter() *gin.Engine {
+	h := NewUserHandler(models.NewUserService(), &recordingRevoker{}, zap.NewNop())
+	router := gin.New()
+	router.POST("/api/v1/users", h.CreateUser)
+	router.PUT("/api/v1/users/:id", h.UpdateUser)
+	return router
+}
+
+func TestCreateUserReturnMinimal(t *testing.T) {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/users",
+		strings.NewReader(`{"name":"Carol","email":"carol@example.com"}`))
+	req.Header.Set("Prefer", "return=minimal")
+	newPreferRouter().ServeHTTP(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want 204", w.Code)
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("body = %q, want empty", w.Body.String())
+	}
+	if got := w.Header().Get("Location"); got != "/api/v1/users/3" {
+		t.Errorf("Location = %q, want /api/v1/users/3", got)
+	}
+	if got := w.Header().Get("Preference-Applied"); got != "return=minimal" {
+		t.Errorf("Preference-Applied = %q, want return=minimal", got)
+	}
+}
+
+func TestUpdateUserReturnRepresentation(t *testing.T) {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/users/2", strings.NewReader(`{"name":"Robert"}`))
+	req.Header.Set("Prefer", "return=representation")
+	newPreferRouter().ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	var user models.User
+	if err := json.Unmarshal(w.Body.Bytes(), &user); err != nil || user.Name != "Robert" {
+		t.Errorf("body = %s, want updated user", w.Body.String())
+	}
+	if got := w.Header().Get("Preference-Applied"); got != "return=representation" {
+		t.Errorf("Preference-Applied = %q, want return=representation", got)
+	}
+	if got := w.Header().Get("Location"); got != "/api/v1/users/2" {
+		t.Errorf("Location = %q, want /api/v1/users/2", got)
+	}
+}
+
+func TestCreateUserDefaultsToRepresentation(t *testing.T) {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/users",
+		strings.NewReader(`{"name":"Carol","email":"carol@example.com"}`))
+	newPreferRouter().ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated || w.Body.Len() == 0 {
+		t.Errorf("got %d with %d byte body, want 201 with body", w.Code, w.Body.Len())
+	}
+	if w.Header().Get("Preference-Applied") != "" {
+		t.Error("Preference-Applied should be absent without a Prefer header")
+	}
+}
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/cbwinslow/template2/examples/go/internal/middleware"
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+	"github.com/cbwinslow/template2/examples/go/pkg/auth"
+	"github.com/cbwinslow/template2/examples/go/pkg/mailer"
+)
+
+// resetTimeout bounds the background lookup and mail of a ForgotPassword
+// request
+const resetTimeout = 30 * time.Second
+
+// ForgotPasswordRequest is the payload accepted by ForgotPassword
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ResetPasswordRequest is the payload accepted by ResetPassword
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,password"`
+}
+
+// PasswordReset describes the reset mail ForgotPassword sends
+type PasswordReset struct {
+	Mailer mailer.Mailer
+	// URL is the page the mailed link points at, which collects the new
+	// password; the token is added as its token query parameter
+	URL string
+	// Templates renders the reset_password and admin_reset_password mails;
+	// nil uses the built-in ones
+	Templates *mailer.Templates
+}
+
+// WithPasswordReset enables ForgotPassword and ResetPassword
+func WithPasswordReset(reset PasswordReset) AuthHandlerOption {
+	return func(h *AuthHandler) {
+		h.reset = &reset
+	}
+}
+
+// ForgotPassword godoc
+// @Summary Request a password reset
+// @Description Mails a single-use reset link to the account owning the email. The response is the same whether or not such an account exists and is sent before the account is looked up, so neither its content nor its timing reveals accounts.
+// @Tags auth
+// @Accept json
+// @Param request body ForgotPasswordRequest true "Account email"
+// @Success 202
+// @Failure 400 {object} apierror.Problem
+// @Failure 422 {object} apierror.Problem
+// @Failure 429 {object} apierror.Problem
+// @Router /auth/forgot-password [post]
+func (h *AuthHandler) ForgotPassword(c *gin.Context) {
+	var req ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	// The lookup and mail run after responding, so the response takes as
+	// long for an unknown email as for an account
+	logger := middleware.RequestLogger(c, h.logger)
+	if h.jobs != nil {
+		if _, err := h.jobs.Enqueue(c.Request.Context(), JobPasswordResetMail, resetMailJob{Email: req.Email}); err != nil {
+			logger.Error("Failed to queue password reset email", zap.Error(err))
+		}
+		c.Status(http.StatusAccepted)
+		return
+	}
+	ctx := context.WithoutCancel(c.Request.Context())
+	h.resets.Add(1)
+	go func() {
+		defer h.resets.Done()
+		ctx, cancel := context.WithTimeout(ctx, resetTimeout)
+		defer cancel()
+		if err := h.requestReset(ctx, logger, req.Email); err != nil {
+			logger.Error("Failed to send password reset email", zap.Error(err))
+		}
+	}()
+	c.Status(http.StatusAccepted)
+}
+
+// Wait blocks until the reset mails ForgotPassword sends without a job
+// queue have been sent, so shutdown does not drop them
+func (h *AuthHandler) Wait() {
+	h.resets.Wait()
+}
+
+// requestReset mails a reset link to the account owning email, if any
+func (h *AuthHandler) requestReset(ctx context.Context, logger *zap.Logger, email string) error {
+	user, err := h.users.GetByEmail(ctx, email)
+	if errors.Is(err, models.ErrUserNotFound) {
+		logger.Info("Password reset requested for unknown email")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("look up account: %w", err)
+	}
+	if err := h.sendReset(ctx, user); err != nil {
+		return fmt.Errorf("mail user %d: %w", user.ID, err)
+	}
+	logger.Info("Password reset requested", zap.Int("user_id", user.ID))
+	return nil
+}
+
+// ResetPassword godoc
+// @Summary Reset a password
+// @Description Sets a new password using the token from a reset link. The token works once, every session of the account is signed out and its API keys are deleted.
+// @Tags auth
+// @Accept json
+// @Param request body ResetPasswordRequest true "Token and new password"
+// @Success 204
+// @Failure 400 {object} apierror.Problem
+// @Failure 422 {object} apierror.Problem
+// @Router /auth/reset-password [post]
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	userID, err := h.auth.ResetPassword(c.Request.Context(), req.Token, req.Password)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidToken) || errors.Is(err, auth.ErrTokenRevoked) {
+			respondError(c, http.StatusBadRequest, models.CodeTokenInvalid, "Invalid or expired reset link")
+			return
+		}
+		respondServiceError(c, err)
+		return
+	}
+
+	revokeAPIKeys(c, h.keys, h.logger, userID, "password reset")
+	middleware.RequestLogger(c, h.logger).Info("Password reset", zap.Int("user_id", userID))
+	c.Status(http.StatusNoContent)
+}
+
+// sendReset mails user a link to choose a new password
+func (h *AuthHandler) sendReset(ctx context.Context, user models.User) error {
+	token, err := h.auth.IssueResetToken(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	link, err := tokenLink(h.reset.URL, token)
+	if err != nil {
+		return err
+	}
+
+	return sendLinkMail(ctx, h.reset.Mailer, h.reset.Templates, "reset_password", user, link)
+}
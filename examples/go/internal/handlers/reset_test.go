@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/cbwinslow/template2/examples/go/pkg/auth/apikey"
+	"github.com/cbwinslow/template2/examples/go/pkg/mailer"
+)
+
+func TestPasswordResetFlow(t *testing.T) {
+	authService, users := newAuthFixture(t)
+	mail := &recordingMailer{}
+	keys := apikey.NewService(apikey.NewMemoryStore())
+	hana, _ := users.GetByEmail(context.Background(), "hana@example.com")
+	_, plaintext, _ := keys.Create(context.Background(), hana.ID, "ci")
+	h := NewAuthHandler(authService, users, zap.NewNop(), WithPasswordReset(PasswordReset{
+		Mailer: mail,
+		URL:    "https://app.example.com/reset",
+	}), WithAuthKeyRevoker(keys))
+	router := gin.New()
+	router.POST("/auth/login", h.Login)
+	router.POST("/auth/refresh", h.Refresh)
+	router.POST("/auth/forgot-password", h.ForgotPassword)
+	router.POST("/auth/reset-password", h.ResetPassword)
+	post := func(path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	var session TokenResponse
+	w := login(router, `{"email":"hana@example.com","password":"s3cret-pass"}`)
+	if err := json.Unmarshal(w.Body.Bytes(), &session); err != nil || session.RefreshToken == "" {
+		t.Fatalf("login: %d %s", w.Code, w.Body.String())
+	}
+
+	for _, email := range []string{"nobody@example.com", "hana@example.com"} {
+		if w := post("/auth/forgot-password", `{"email":"`+email+`"}`); w.Code != http.StatusAccepted {
+			t.Errorf("forgot %s: status = %d, want 202", email, w.Code)
+		}
+	}
+	h.Wait()
+	if len(mail.sent) != 1 || mail.sent[0].To != "hana@example.com" {
+		t.Fatalf("sent %+v, want one mail to hana@example.com", mail.sent)
+	}
+	link := mail.sent[0].Body[strings.Index(mail.sent[0].Body, "https://"):]
+	parsed, _ := url.Parse(link[:strings.IndexByte(link, '\n')])
+	token := parsed.Query().Get("token")
+
+	body := `{"token":"` + token + `","password":"brand-new-pass"}`
+	if w := post("/auth/reset-password", body); w.Code != http.StatusNoContent {
+		t.Fatalf("reset: %d %s", w.Code, w.Body.String())
+	}
+	if w := post("/auth/reset-password", body); w.Code != http.StatusBadRequest {
+		t.Errorf("reusing the reset token: status = %d, want 400", w.Code)
+	}
+	if w := login(router, `{"email":"hana@example.com","password":"s3cret-pass"}`); w.Code != http.StatusUnauthorized {
+		t.Errorf("old password: status = %d, want 401", w.Code)
+	}
+	if w := login(router, `{"email":"hana@example.com","password":"brand-new-pass"}`); w.Code != http.StatusOK {
+		t.Errorf("new password: status = %d, want 200", w.Code)
+	}
+	if w := postRefreshToken(router, "/auth/refresh", session.RefreshToken); w.Code != http.StatusUnauthorized {
+		t.Errorf("refresh with a pre-reset session: status = %d, want 401", w.Code)
+	}
+	if _, err := keys.Authenticate(context.Background(), plaintext); !errors.Is(err, apikey.ErrInvalidKey) {
+		t.Errorf("API key after reset: err = %v, want ErrInvalidKey", err)
+	}
+}
+
+// blockingMailer holds every Send until release is closed
+type blockingMailer struct {
+	release chan struct{}
+}
+
+func (m *blockingMailer) Send(ctx context.Context, _ mailer.Message) error {
+	select {
+	case <-m.release:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func TestForgotPasswordAnswersBeforeMailing(t *testing.T) {
+	authService, users := newAuthFixture(t)
+	mail := &blockingMailer{release: make(chan struct{})}
+	h := NewAuthHandler(authService, users, zap.NewNop(), WithPasswordReset(PasswordReset{
+		Mailer: mail,
+		URL:    "https://app.example.com/reset",
+	}))
+	router := gin.New()
+	router.POST("/auth/forgot-password", h.ForgotPassword)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/auth/forgot-password", strings.NewReader(`{"email":"hana@example.com"}`)))
+	if w.Code != http.StatusAccepted {
+		t.Errorf("status = %d while the mail is pending, want 202", w.Code)
+	}
+	close(mail.release)
+	h.Wait()
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+
+	"github.com/cbwinslow/template2/examples/go/internal/middleware"
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+	"github.com/cbwinslow/template2/examples/go/pkg/apierror"
+	"github.com/cbwinslow/template2/examples/go/pkg/validation"
+)
+
+func init() {
+	// Bound payloads are checked against the custom rules too
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		if err := validation.Register(v); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// respondError aborts the request with a problem details document
+func respondError(c *gin.Context, status int, code models.ErrorCode, message string) {
+	middleware.AbortWithError(c, models.NewError(status, code, message))
+}
+
+// respondBindError aborts a request whose body or query failed to bind. A
+// payload that broke validation rules is answered with 422 listing every
+// invalid field, and one that could not be decoded at all with 400.
+func respondBindError(c *gin.Context, err error) {
+	middleware.AbortWithError(c, bindError(err))
+}
+
+// bindError is the error a request whose input failed to bind or validate
+// fails with, as respondBindError answers it
+func bindError(err error) *apierror.Error {
+	if fields := apierror.ValidationFields(err); fields != nil {
+		apiErr := models.NewError(http.StatusUnprocessableEntity, models.CodeValidationFailed, "The request failed validation")
+		apiErr.Fields = fields
+		return apiErr
+	}
+	return models.NewError(http.StatusBadRequest, models.CodeValidationFailed, err.Error())
+}
+
+// serviceError maps an error returned by a service to the error the request
+// fails with
+func serviceError(err error) *apierror.Error {
+	var invErr *models.InvariantError
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return models.NewError(http.StatusGatewayTimeout, models.CodeRequestTimeout, "The request did not complete in time").Wrap(err)
+	case errors.Is(err, models.ErrUserNotFound):
+		return models.NewError(http.StatusNotFound, models.CodeUserNotFound, "User not found").Wrap(err)
+	case errors.Is(err, models.ErrEmailTaken):
+		return models.NewError(http.StatusConflict, models.CodeEmailTaken, "Email is already in use").Wrap(err)
+	case errors.Is(err, models.ErrInvalidRole):
+		return models.NewError(http.StatusBadRequest, models.CodeInvalidRole, "Role is not valid").Wrap(err)
+	case errors.Is(err, models.ErrSelfMerge):
+		return models.NewError(http.StatusBadRequest, models.CodeInvalidMerge, "A user cannot be merged into itself").Wrap(err)
+	case errors.Is(err, models.ErrPreconditionFailed):
+		return models.NewError(http.StatusPreconditionFailed, models.CodePreconditionFailed, "The user has changed since it was read").Wrap(err)
+	case errors.Is(err, models.ErrTxConflict):
+		return models.NewError(http.StatusConflict, models.CodeTxConflict, "Another change to the users landed first; retry the request").Wrap(err)
+	case errors.Is(err, models.ErrStoreFull):
+		return models.NewError(http.StatusInsufficientStorage, models.CodeStorageFull, "The user store has reached its capacity").Wrap(err)
+	case errors.As(err, &invErr):
+		return models.NewError(http.StatusUnprocessableEntity, models.CodeInvariantViolation, invErr.Message).
+			WithDetails(map[string]interface{}{"rule": invErr.Rule}).Wrap(err)
+	default:
+		return models.NewError(http.StatusInternalServerError, models.CodeInternal, "Internal server error").Wrap(err)
+	}
+}
+
+// itemError describes err as the failure of one item of a response, such as
+// a batch entry
+func itemError(err error) *models.APIError {
+	apiErr := serviceError(err)
+	code := models.ErrorCode(apiErr.Code)
+	return &models.APIError{Code: code, Message: apiErr.Detail, Details: apiErr.Details}
+}
+
+// respondServiceError aborts the request with the error mapped from err
+func respondServiceError(c *gin.Context, err error) {
+	middleware.AbortWithError(c, serviceError(err))
+}
+
+// parseID reads a positive integer path parameter, writing a 400 if invalid
+func parseID(c *gin.Context, name string) (int, bool) {
+	id, err := strconv.Atoi(c.Param(name))
+	if err != nil || id <= 0 {
+		respondError(c, http.StatusBadRequest, models.CodeInvalidID, "Invalid "+name)
+		return 0, false
+	}
+	return id, true
+}
+
+// parseFlag reads the boolean query parameter name. A bare ?name counts as
+// true and an absent one as false; anything strconv.ParseBool rejects is
+// answered with 400 and ok is false.
+func parseFlag(c *gin.Context, name string) (value, ok bool) {
+	raw, present := c.GetQuery(name)
+	if !present {
+		return false, true
+	}
+	if raw == "" {
+		return true, true
+	}
+	value, err := strconv.ParseBool(raw)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, models.CodeValidationFailed, "Invalid "+name)
+		return false, false
+	}
+	return value, true
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/cbwinslow/template2/examples/go/internal/middleware"
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+	"github.com/cbwinslow/template2/examples/go/pkg/auth"
+)
+
+// SessionResponse describes one signed-in device
+type SessionResponse struct {
+	ID        string    `json:"id"`
+	UserAgent string    `json:"user_agent"`
+	IP        string    `json:"ip"`
+	CreatedAt time.Time `json:"created_at"`
+	LastSeen  time.Time `json:"last_seen"`
+	// Current marks the session the request was made from
+	Current bool `json:"current"`
+}
+
+// ListSessions godoc
+// @Summary List active sessions
+// @Description Lists the devices signed in to the authenticated account, most recently seen first. A session is seen when it logs in or refreshes its tokens.
+// @Tags auth
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {array} SessionResponse
+// @Failure 401 {object} apierror.Problem
+// @Router /protected/sessions [get]
+func (h *AuthHandler) ListSessions(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		respondError(c, http.StatusUnauthorized, models.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	sessions, err := h.auth.Sessions(c.Request.Context(), userID)
+	if err != nil {
+		respondServiceError(c, err)
+		return
+	}
+
+	var current string
+	if claims, ok := middleware.GetClaims(c); ok {
+		current = claims.SessionID
+	}
+	resp := make([]SessionResponse, len(sessions))
+	for i, session := range sessions {
+		resp[i] = SessionResponse{
+			ID:        session.ID,
+			UserAgent: session.UserAgent,
+			IP:        session.IP,
+			CreatedAt: session.CreatedAt,
+			LastSeen:  session.LastSeen,
+			Current:   session.ID == current,
+		}
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// RevokeSession godoc
+// @Summary Revoke a session
+// @Description Signs one of the authenticated account's devices out. Its refresh token stops working and its access token is rejected from the next request.
+// @Tags auth
+// @Security ApiKeyAuth
+// @Param id path string true "Session ID"
+// @Success 204
+// @Failure 401 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Router /protected/sessions/{id} [delete]
+func (h *AuthHandler) RevokeSession(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		respondError(c, http.StatusUnauthorized, models.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	if err := h.auth.RevokeSession(c.Request.Context(), userID, c.Param("id")); err != nil {
+		if errors.Is(err, auth.ErrSessionNotFound) {
+			respondError(c, http.StatusNotFound, models.CodeNotFound, "Session not found")
+			return
+		}
+		respondServiceError(c, err)
+		return
+	}
+
+	middleware.RequestLogger(c, h.logger).Info("Session revoked", zap.Int("user_id", userID))
+	c.Status(http.StatusNoContent)
+}
+
+// sessionClient describes the client of the request for the session it
+// logs in to or refreshes
+func sessionClient(c *gin.Context) auth.SessionOption {
+	return auth.WithSessionClient(c.ClientIP(), c.Request.UserAgent())
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/cbwinslow/template2/examples/go/internal/middleware"
+)
+
+func TestRevokeSessionSignsOtherDeviceOut(t *testing.T) {
+	authService, users := newAuthFixture(t)
+	h := NewAuthHandler(authService, users, zap.NewNop())
+	router := gin.New()
+	requireAuth := middleware.AuthRequired(authService, middleware.WithSessionDenylist(authService.SessionRevoked))
+	router.POST("/auth/login", h.Login)
+	router.GET("/protected/profile", requireAuth, h.GetProfile)
+	router.GET("/protected/sessions", requireAuth, h.ListSessions)
+	router.DELETE("/protected/sessions/:id", requireAuth, h.RevokeSession)
+	send := func(method, path, token string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	signIn := func(userAgent string) TokenResponse {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/auth/login", strings.NewReader(`{"email":"hana@example.com","password":"s3cret-pass"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", userAgent)
+		router.ServeHTTP(w, req)
+		var tokens TokenResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &tokens); err != nil || tokens.AccessToken == "" {
+			t.Fatalf("login from %s: %d %s", userAgent, w.Code, w.Body.String())
+		}
+		return tokens
+	}
+	laptop := signIn("laptop")
+	phone := signIn("phone")
+
+	var sessions []SessionResponse
+	w := send(http.MethodGet, "/protected/sessions", laptop.AccessToken)
+	if err := json.Unmarshal(w.Body.Bytes(), &sessions); err != nil || len(sessions) != 2 {
+		t.Fatalf("sessions: %d %s", w.Code, w.Body.String())
+	}
+	var phoneID string
+	for _, session := range sessions {
+		if session.Current != (session.UserAgent == "laptop") {
+			t.Errorf("session %+v: current flag does not match the caller", session)
+		}
+		if session.UserAgent == "phone" {
+			phoneID = session.ID
+		}
+	}
+
+	if w := send(http.MethodDelete, "/protected/sessions/"+phoneID, laptop.AccessToken); w.Code != http.StatusNoContent {
+		t.Fatalf("revoke: %d %s", w.Code, w.Body.String())
+	}
+	if w := send(http.MethodGet, "/protected/profile", phone.AccessToken); w.Code != http.StatusUnauthorized {
+		t.Errorf("revoked session: status = %d, want 401", w.Code)
+	}
+	if w := send(http.MethodGet, "/protected/profile", laptop.AccessToken); w.Code != http.StatusOK {
+		t.Errorf("remaining session: status = %d, want 200", w.Code)
+	}
+	if w := send(http.MethodDelete, "/protected/sessions/"+phoneID, laptop.AccessToken); w.Code != http.StatusNotFound {
+		t.Errorf("revoking twice: status = %d, want 404", w.Code)
+	}
+}
@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/cbwinslow/template2/examples/go/internal/middleware"
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+	"github.com/cbwinslow/template2/examples/go/pkg/apierror"
+	"github.com/cbwinslow/template2/examples/go/pkg/auth"
+)
+
+// TwoFactorSetupResponse is returned by SetupTwoFactor
+type TwoFactorSetupResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// TwoFactorCodeRequest is the payload accepted by EnableTwoFactor
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// RecoveryCodesResponse is returned once two-factor authentication is enabled
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// TwoFactorChallengeResponse is returned by Login instead of a token pair
+// when the account has two-factor authentication enabled
+type TwoFactorChallengeResponse struct {
+	ChallengeToken string `json:"challenge_token"`
+	ExpiresIn      int    `json:"expires_in"`
+}
+
+// TwoFactorVerifyRequest is the payload accepted by VerifyTwoFactor
+type TwoFactorVerifyRequest struct {
+	ChallengeToken string `json:"challenge_token" form:"challenge_token" binding:"required"`
+	// Code is a code from the authenticator app or a recovery code
+	Code string `json:"code" form:"code" binding:"required"`
+}
+
+// WithTwoFactor enables two-factor enrollment and makes Login answer
+// accounts that enrolled with a challenge instead of tokens
+func WithTwoFactor() AuthHandlerOption {
+	return func(h *AuthHandler) {
+		h.twoFactor = true
+	}
+}
+
+// SetupTwoFactor godoc
+// @Summary Start two-factor enrollment
+// @Description Generates a TOTP secret for the authenticated user and returns it with an otpauth:// provisioning URI to show as a QR code. Two-factor authentication stays off until a code from it is sent to /auth/2fa/enable.
+// @Tags auth
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} TwoFactorSetupResponse
+// @Failure 401 {object} apierror.Problem
+// @Failure 409 {object} apierror.Problem
+// @Router /auth/2fa/setup [post]
+func (h *AuthHandler) SetupTwoFactor(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		respondError(c, http.StatusUnauthorized, models.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	user, err := h.users.Get(c.Request.Context(), userID)
+	if err != nil {
+		respondServiceError(c, err)
+		return
+	}
+	setup, err := h.auth.SetupTwoFactor(c.Request.Context(), user.ID, user.Email)
+	if err != nil {
+		if errors.Is(err, auth.ErrTwoFactorEnabled) {
+			respondError(c, http.StatusConflict, models.CodeTwoFactorEnabled, "Two-factor authentication is already enabled")
+			return
+		}
+		respondServiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, TwoFactorSetupResponse{Secret: setup.Secret, ProvisioningURI: setup.URI})
+}
+
+// EnableTwoFactor godoc
+// @Summary Finish two-factor enrollment
+// @Description Turns on two-factor authentication once a code from the secret returned by /auth/2fa/setup is confirmed. The recovery codes in the response are shown only once; each one can stand in for a code a single time.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param request body TwoFactorCodeRequest true "Authenticator code"
+// @Success 200 {object} RecoveryCodesResponse
+// @Failure 400 {object} apierror.Problem
+// @Failure 401 {object} apierror.Problem
+// @Failure 409 {object} apierror.Problem
+// @Failure 422 {object} apierror.Problem
+// @Router /auth/2fa/enable [post]
+func (h *AuthHandler) EnableTwoFactor(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		respondError(c, http.StatusUnauthorized, models.CodeUnauthorized, "Authentication required")
+		return
+	}
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	codes, err := h.auth.EnableTwoFactor(c.Request.Context(), userID, req.Code)
+	switch {
+	case errors.Is(err, auth.ErrInvalidCode):
+		respondError(c, http.StatusBadRequest, models.CodeTwoFactorInvalid, "Invalid two-factor code")
+		return
+	case errors.Is(err, auth.ErrTwoFactorNotSetUp):
+		respondError(c, http.StatusBadRequest, models.CodeValidationFailed, "Two-factor setup has not been started")
+		return
+	case errors.Is(err, auth.ErrTwoFactorEnabled):
+		respondError(c, http.StatusConflict, models.CodeTwoFactorEnabled, "Two-factor authentication is already enabled")
+		return
+	case err != nil:
+		respondServiceError(c, err)
+		return
+	}
+
+	middleware.RequestLogger(c, h.logger).Info("Two-factor authentication enabled", zap.Int("user_id", userID))
+	c.JSON(http.StatusOK, RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// VerifyTwoFactor godoc
+// @Summary Complete a two-factor login
+// @Description Exchanges the challenge token from Login and a code from the authenticator app, or an unused recovery code, for an access token and a refresh token. A challenge takes 5 wrong codes, and 10 in a row lock the user's second factor for 15 minutes.
+// @Tags auth
+// @Accept json,x-www-form-urlencoded
+// @Produce json
+// @Param request body TwoFactorVerifyRequest true "Challenge and code"
+// @Success 200 {object} TokenResponse
+// @Failure 400 {object} apierror.Problem
+// @Failure 401 {object} apierror.Problem
+// @Failure 422 {object} apierror.Problem
+// @Failure 429 {object} apierror.Problem
+// @Router /auth/2fa/verify [post]
+func (h *AuthHandler) VerifyTwoFactor(c *gin.Context) {
+	var req TwoFactorVerifyRequest
+	if !bindJSONOrForm(c, &req) {
+		return
+	}
+
+	user, recovery, apiErr := h.verifyChallenge(c, req)
+	if apiErr != nil {
+		middleware.AbortWithError(c, apiErr)
+		return
+	}
+
+	pair, err := h.auth.IssueTokenPair(c.Request.Context(), user.ID, user.Email, user.Role, sessionClient(c))
+	if err != nil {
+		respondServiceError(c, err)
+		return
+	}
+
+	middleware.RequestLogger(c, h.logger).Info("User logged in", zap.Int("user_id", user.ID), zap.Bool("recovery_code", recovery))
+	h.respondTokens(c, pair)
+}
+
+// verifyChallenge returns the user a challenge token and second factor
+// sign in as, and whether the factor was a recovery code, or the error the
+// verification fails with
+func (h *AuthHandler) verifyChallenge(c *gin.Context, req TwoFactorVerifyRequest) (models.User, bool, *apierror.Error) {
+	logger := middleware.RequestLogger(c, h.logger)
+	userID, recovery, err := h.auth.VerifyChallenge(c.Request.Context(), req.ChallengeToken, req.Code)
+	switch {
+	case isTokenError(err):
+		return models.User{}, false, models.NewError(http.StatusUnauthorized, models.CodeTokenInvalid, "Invalid or expired challenge token")
+	case errors.Is(err, auth.ErrInvalidCode):
+		logger.Info("Two-factor code rejected", zap.String("ip", c.ClientIP()))
+		return models.User{}, false, models.NewError(http.StatusUnauthorized, models.CodeTwoFactorInvalid, "Invalid two-factor code")
+	case errors.Is(err, auth.ErrTooManyAttempts):
+		logger.Warn("Two-factor attempts exhausted", zap.String("ip", c.ClientIP()))
+		return models.User{}, false, models.NewError(http.StatusTooManyRequests, models.CodeRateLimited, "Too many invalid two-factor codes; sign in again later")
+	case err != nil:
+		return models.User{}, false, serviceError(err)
+	}
+
+	user, err := h.users.Get(c.Request.Context(), userID)
+	if err != nil {
+		return models.User{}, false, serviceError(err)
+	}
+	return user, recovery, nil
+}
+
+// respondChallenge answers a login that still owes a second factor
+func (h *AuthHandler) respondChallenge(c *gin.Context, userID int) {
+	challenge, err := h.auth.IssueChallengeToken(c.Request.Context(), userID)
+	if err != nil {
+		respondServiceError(c, err)
+		return
+	}
+
+	middleware.RequestLogger(c, h.logger).Info("Two-factor challenge issued", zap.Int("user_id", userID))
+	c.JSON(http.StatusAccepted, TwoFactorChallengeResponse{
+		ChallengeToken: challenge,
+		ExpiresIn:      int(h.auth.ChallengeTTL().Seconds()),
+	})
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/cbwinslow/template2/examples/go/internal/middleware"
+	"github.com/cbwinslow/template2/examples/go/pkg/auth"
+)
+
+func TestTwoFactorLoginFlow(t *testing.T) {
+	authService, users := newAuthFixture(t)
+	h := NewAuthHandler(authService, users, zap.NewNop(), WithTwoFactor())
+	router := gin.New()
+	requireAuth := middleware.AuthRequired(authService)
+	router.POST("/auth/login", h.Login)
+	router.POST("/auth/2fa/setup", requireAuth, h.SetupTwoFactor)
+	router.POST("/auth/2fa/enable", requireAuth, h.EnableTwoFactor)
+	router.POST("/auth/2fa/verify", h.VerifyTwoFactor)
+	post := func(path, token, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+	const credentials = `{"email":"hana@example.com","password":"s3cret-pass"}`
+
+	var session TokenResponse
+	w := login(router, credentials)
+	if err := json.Unmarshal(w.Body.Bytes(), &session); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("login before enrolling: %d %s", w.Code, w.Body.String())
+	}
+
+	var setup TwoFactorSetupResponse
+	w = post("/auth/2fa/setup", session.AccessToken, "")
+	if err := json.Unmarshal(w.Body.Bytes(), &setup); err != nil || !strings.HasPrefix(setup.ProvisioningURI, "otpauth://totp/") {
+		t.Fatalf("setup: %d %s", w.Code, w.Body.String())
+	}
+	if w := login(router, credentials); w.Code != http.StatusOK {
+		t.Errorf("login before confirming a code: status = %d, want 200", w.Code)
+	}
+
+	code, _ := auth.GenerateTOTPCode(setup.Secret, time.Now())
+	var recovery RecoveryCodesResponse
+	w = post("/auth/2fa/enable", session.AccessToken, `{"code":"`+code+`"}`)
+	if err := json.Unmarshal(w.Body.Bytes(), &recovery); err != nil || len(recovery.RecoveryCodes) == 0 {
+		t.Fatalf("enable: %d %s", w.Code, w.Body.String())
+	}
+
+	var challenge TwoFactorChallengeResponse
+	w = login(router, credentials)
+	if err := json.Unmarshal(w.Body.Bytes(), &challenge); err != nil || w.Code != http.StatusAccepted || challenge.ChallengeToken == "" {
+		t.Fatalf("login after enrolling: %d %s", w.Code, w.Body.String())
+	}
+	if w := post("/auth/2fa/setup", challenge.ChallengeToken, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("challenge token as bearer: status = %d, want 401", w.Code)
+	}
+
+	verify := func(code string) *httptest.ResponseRecorder {
+		return post("/auth/2fa/verify", "", `{"challenge_token":"`+challenge.ChallengeToken+`","code":"`+code+`"}`)
+	}
+	if w := verify("000000"); w.Code != http.StatusUnauthorized {
+		t.Errorf("wrong code: status = %d, want 401", w.Code)
+	}
+	var tokens TokenResponse
+	w = verify(recovery.RecoveryCodes[0])
+	if err := json.Unmarshal(w.Body.Bytes(), &tokens); err != nil || tokens.AccessToken == "" {
+		t.Fatalf("verify with a recovery code: %d %s", w.Code, w.Body.String())
+	}
+	if w := verify(recovery.RecoveryCodes[0]); w.Code != http.StatusUnauthorized {
+		t.Errorf("reused recovery code: status = %d, want 401", w.Code)
+	}
+}
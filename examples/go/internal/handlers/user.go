@@ -0,0 +1,588 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/cbwinslow/template2/examples/go/internal/middleware"
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+	"github.com/cbwinslow/template2/examples/go/pkg/audit"
+	"github.com/cbwinslow/template2/examples/go/pkg/auth"
+	"github.com/cbwinslow/template2/examples/go/pkg/auth/apikey"
+	"github.com/cbwinslow/template2/examples/go/pkg/pagination"
+)
+
+// MaxRoleAssignments caps the number of assignments in one AssignRoles call
+const MaxRoleAssignments = 100
+
+// TokenRevoker invalidates the outstanding tokens of a user
+type TokenRevoker interface {
+	RevokeUserTokens(ctx context.Context, userID int) error
+}
+
+// UserHandler serves the user management endpoints
+type UserHandler struct {
+	users       *models.UserService
+	tokens      TokenRevoker
+	logger      *zap.Logger
+	audit       *zap.Logger
+	fieldPolicy models.FieldPolicy
+	defaultSort models.UserSort
+	// defaultLimit and maxLimit bound the GetUsers page size
+	defaultLimit int
+	maxLimit     int
+	// cache is purged after every write when set
+	cache CacheInvalidator
+	// keys are revoked along with tokens on RevokeTokens and DeleteUser
+	// when set
+	keys KeyRevoker
+}
+
+// UserHandlerOption configures a UserHandler
+type UserHandlerOption func(*UserHandler)
+
+// WithFieldPolicy sets how empty optional user fields are rendered
+func WithFieldPolicy(policy models.FieldPolicy) UserHandlerOption {
+	return func(h *UserHandler) {
+		h.fieldPolicy = policy
+	}
+}
+
+// WithDefaultSort sets the order of GetUsers when no sort is requested
+func WithDefaultSort(sort models.UserSort) UserHandlerOption {
+	return func(h *UserHandler) {
+		h.defaultSort = sort
+	}
+}
+
+// WithPageSize sets the GetUsers page size used when no limit is requested
+// and the largest limit accepted
+func WithPageSize(defaultLimit, maxLimit int) UserHandlerOption {
+	return func(h *UserHandler) {
+		h.defaultLimit = defaultLimit
+		h.maxLimit = maxLimit
+	}
+}
+
+// WithAuditLogger records every successful user change to audit
+func WithAuditLogger(audit *zap.Logger) UserHandlerOption {
+	return func(h *UserHandler) {
+		h.audit = audit
+	}
+}
+
+// NewUserHandler creates a user handler
+func NewUserHandler(users *models.UserService, tokens TokenRevoker, logger *zap.Logger, opts ...UserHandlerOption) *UserHandler {
+	h := &UserHandler{
+		users:        users,
+		tokens:       tokens,
+		logger:       logger,
+		audit:        zap.NewNop(),
+		fieldPolicy:  models.FieldsOmitEmpty,
+		defaultSort:  models.UserSort{Field: "id"},
+		defaultLimit: 20,
+		maxLimit:     100,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// GetUsers godoc
+// @Summary List users
+// @Description Returns lightweight summaries; use GET /users/{id} for the full user.
+// @Description Users with equal sort values are ordered by ID, so the order is stable across requests.
+// @Description The X-Total-Count header carries the number of matching users and the Link header the next and prev pages.
+// @Tags users
+// @Produce json
+// @Param sort query string false "id, name, email or created_at; prefix with - for descending"
+// @Param filter query []string false "field:value on name, email, role or active; repeat to combine" collectionFormat(multi)
+// @Param page query int false "Page number, from 1"
+// @Param limit query int false "Users per page"
+// @Param include_deleted query bool false "Also list soft-deleted users; admins only"
+// @Success 200 {array} models.UserSummary
+// @Failure 400 {object} apierror.Problem
+// @Failure 403 {object} apierror.Problem
+// @Router /users [get]
+func (h *UserHandler) GetUsers(c *gin.Context) {
+	q, page, ok := parseUserQuery(c, h.defaultSort, h.defaultLimit, h.maxLimit)
+	if !ok {
+		return
+	}
+	users, total, err := h.users.Query(c.Request.Context(), q)
+	if err != nil {
+		respondServiceError(c, err)
+		return
+	}
+
+	pagination.NewMeta(c.Request.URL, page, total).SetHeaders(c.Writer.Header())
+	summaries := make([]models.UserSummary, len(users))
+	for i, user := range users {
+		summaries[i] = user.Summary()
+	}
+
+	c.JSON(http.StatusOK, summaries)
+}
+
+// parseUserQuery reads the page, filter, sort and include_deleted
+// parameters of a user listing, answering the request itself when one is
+// invalid
+func parseUserQuery(c *gin.Context, defaultSort models.UserSort, defaultLimit, maxLimit int) (models.UserQuery, pagination.Params, bool) {
+	page, err := pagination.Parse(c.Request.URL.Query(), defaultLimit, maxLimit)
+	if err != nil {
+		middleware.AbortWithError(c, models.NewError(http.StatusBadRequest, models.CodeInvalidPage, "Invalid page or limit").
+			WithDetails(map[string]interface{}{"max_limit": maxLimit}))
+		return models.UserQuery{}, page, false
+	}
+	filter, err := models.ParseUserFilter(c.QueryArray("filter"))
+	if err != nil {
+		middleware.AbortWithError(c, models.NewError(http.StatusBadRequest, models.CodeInvalidFilter, "Filters must be field:value").
+			WithDetails(map[string]interface{}{"supported": models.FilterableUserFields()}))
+		return models.UserQuery{}, page, false
+	}
+
+	includeDeleted, ok := parseFlag(c, "include_deleted")
+	if !ok || (includeDeleted && !requireAdmin(c, "include_deleted")) {
+		return models.UserQuery{}, page, false
+	}
+
+	sort := defaultSort
+	if spec := c.Query("sort"); spec != "" {
+		if sort, err = models.ParseUserSort(spec); err != nil {
+			middleware.AbortWithError(c, models.NewError(http.StatusBadRequest, models.CodeInvalidSort, fmt.Sprintf("Cannot sort by %q", spec)).
+				WithDetails(map[string]interface{}{"supported": models.SortableUserFields()}))
+			return models.UserQuery{}, page, false
+		}
+	}
+
+	return models.UserQuery{
+		Filter:         filter,
+		Sort:           sort,
+		Offset:         page.Offset(),
+		Limit:          page.Limit,
+		IncludeDeleted: includeDeleted,
+	}, page, true
+}
+
+// GetUser godoc
+// @Summary Get a user
+// @Description The response carries the user's ETag. Sending it back in If-None-Match answers with 304 while the user is unchanged.
+// @Tags users
+// @Produce json
+// @Param id path int true "User ID"
+// @Param If-None-Match header string false "ETag of a copy the client already has"
+// @Success 200 {object} models.User
+// @Success 304 "Not modified"
+// @Failure 404 {object} apierror.Problem
+// @Router /users/{id} [get]
+func (h *UserHandler) GetUser(c *gin.Context) {
+	id, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+
+	user, err := h.users.Get(c.Request.Context(), id)
+	if err != nil {
+		respondServiceError(c, err)
+		return
+	}
+
+	etag := user.ETag()
+	c.Header("ETag", etag)
+	if notModified(c, etag) {
+		return
+	}
+	c.JSON(http.StatusOK, user.Render(h.fieldPolicy))
+}
+
+// CreateUser godoc
+// @Summary Create a user
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param user body models.CreateUserRequest true "User"
+// @Param Prefer header string false "return=minimal or return=representation"
+// @Success 201 {object} models.User
+// @Success 204 "Created; returned for Prefer: return=minimal"
+// @Failure 400 {object} apierror.Problem
+// @Failure 409 {object} apierror.Problem
+// @Failure 422 {object} apierror.Problem
+// @Failure 507 {object} apierror.Problem
+// @Router /users [post]
+func (h *UserHandler) CreateUser(c *gin.Context) {
+	var req models.CreateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	user, err := h.users.Create(c.Request.Context(), req)
+	if err != nil {
+		respondServiceError(c, err)
+		return
+	}
+
+	middleware.RequestLogger(c, h.logger).Info("User created", zap.Int("user_id", user.ID))
+	h.recordAudit(c, "user.create", user.ID)
+	invalidateCache(c, h.cache, h.logger)
+	respondResource(c, http.StatusCreated, fmt.Sprintf("%s/%d", c.Request.URL.Path, user.ID), user.Render(h.fieldPolicy))
+}
+
+// UpdateUser godoc
+// @Summary Update a user
+// @Description Applies the fields present in the body. With Prefer: return=diff the response is an RFC 6902 JSON Patch of the applied changes.
+// @Description With If-Match the update is only applied while the user's ETag is one of those listed, and fails with 412 otherwise.
+// @Description Changing the role revokes the user's tokens.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param user body models.UpdateUserRequest true "Fields to update"
+// @Param Prefer header string false "return=minimal, return=representation or return=diff"
+// @Param If-Match header string false "ETag the user must still have"
+// @Success 200 {object} models.User
+// @Success 204 "Updated; returned for Prefer: return=minimal"
+// @Failure 400 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 412 {object} apierror.Problem
+// @Failure 422 {object} apierror.Problem
+// @Router /users/{id} [put]
+// @Router /users/{id} [patch]
+func (h *UserHandler) UpdateUser(c *gin.Context) {
+	id, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+
+	var req models.UpdateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	var opts []models.UpdateOption
+	if tags := entityTags(c, "If-Match"); tags != nil {
+		opts = append(opts, models.IfMatch(tags...))
+	}
+	previous, user, err := h.users.UpdateWithPrevious(c.Request.Context(), id, req, opts...)
+	if err != nil {
+		respondServiceError(c, err)
+		return
+	}
+	c.Header("ETag", user.ETag())
+	if user.Role != previous.Role {
+		h.revokeTokens(c, user.ID, "role change")
+	}
+
+	middleware.RequestLogger(c, h.logger).Info("User updated", zap.Int("user_id", user.ID))
+	h.recordAudit(c, "user.update", user.ID, audit.Changes(previous, user))
+	invalidateCache(c, h.cache, h.logger)
+
+	if preference(c, "return") == returnDiff {
+		patch, err := jsonPatchDiff(previous.Render(h.fieldPolicy), user.Render(h.fieldPolicy))
+		if err != nil {
+			respondServiceError(c, err)
+			return
+		}
+		c.Header("Location", c.Request.URL.Path)
+		c.Header("Preference-Applied", "return="+returnDiff)
+		c.Render(http.StatusOK, jsonPatchRender{ops: patch})
+		return
+	}
+
+	respondResource(c, http.StatusOK, c.Request.URL.Path, user.Render(h.fieldPolicy))
+}
+
+// DeleteUser godoc
+// @Summary Delete a user
+// @Description Soft-deletes the user: it disappears from lookups and listings and its email can be reused.
+// @Description With hard=true the user is removed permanently, including one that was already soft-deleted.
+// @Description Either way the user's tokens and API keys are revoked.
+// @Tags users
+// @Param id path int true "User ID"
+// @Param hard query bool false "Remove the user permanently; admins only"
+// @Success 204
+// @Failure 400 {object} apierror.Problem
+// @Failure 403 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Router /users/{id} [delete]
+func (h *UserHandler) DeleteUser(c *gin.Context) {
+	id, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+	hard, ok := parseFlag(c, "hard")
+	if !ok || (hard && !requireAdmin(c, "hard")) {
+		return
+	}
+
+	remove, action := h.users.Delete, "user.delete"
+	if hard {
+		remove, action = h.users.HardDelete, "user.hard_delete"
+	}
+	if err := remove(c.Request.Context(), id); err != nil {
+		respondServiceError(c, err)
+		return
+	}
+	h.revokeTokens(c, id, "deletion")
+	revokeAPIKeys(c, h.keys, h.logger, id, "deletion")
+
+	middleware.RequestLogger(c, h.logger).Info("User deleted", zap.Int("user_id", id), zap.Bool("hard", hard))
+	h.recordAudit(c, action, id)
+	invalidateCache(c, h.cache, h.logger)
+	c.Status(http.StatusNoContent)
+}
+
+// revokeTokens revokes the tokens of a user whose access changed, since
+// tokens carry the role they were issued with. A failure is logged rather
+// than failing a change that has already been made.
+func (h *UserHandler) revokeTokens(c *gin.Context, userID int, reason string) {
+	if err := h.tokens.RevokeUserTokens(c.Request.Context(), userID); err != nil {
+		middleware.RequestLogger(c, h.logger).Error("Failed to revoke tokens after "+reason,
+			zap.Int("user_id", userID), zap.Error(err))
+	}
+}
+
+// requireAdmin answers 403 unless the caller is an admin, naming param as the
+// option they are not allowed to use
+func requireAdmin(c *gin.Context, param string) bool {
+	if middleware.GetRole(c) == models.RoleAdmin {
+		return true
+	}
+	middleware.AbortWithError(c, models.NewError(http.StatusForbidden, models.CodeForbidden, "Only admins may use "+param).
+		WithDetails(map[string]interface{}{"parameter": param}))
+	return false
+}
+
+// RoleAssignment assigns a role to a user
+type RoleAssignment struct {
+	UserID int    `json:"user_id" binding:"required,gt=0"`
+	Role   string `json:"role" binding:"required"`
+}
+
+// AssignRolesRequest is the payload accepted by AssignRoles
+type AssignRolesRequest struct {
+	Assignments []RoleAssignment `json:"assignments" binding:"required,min=1,dive"`
+}
+
+// RoleAssignmentResult reports the outcome of one assignment
+type RoleAssignmentResult struct {
+	UserID int              `json:"user_id"`
+	Role   string           `json:"role"`
+	Status string           `json:"status"`
+	Error  *models.APIError `json:"error,omitempty"`
+}
+
+// AssignRoles godoc
+// @Summary Assign roles to several users
+// @Description Applies each assignment independently and revokes the tokens of every user whose role changed.
+// @Description Individual failures are reported per item and do not fail the request.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param assignments body AssignRolesRequest true "Assignments"
+// @Success 200 {object} BatchResponse{results=[]RoleAssignmentResult}
+// @Failure 400 {object} apierror.Problem
+// @Failure 413 {object} apierror.Problem
+// @Failure 422 {object} apierror.Problem
+// @Router /users/roles [post]
+func (h *UserHandler) AssignRoles(c *gin.Context) {
+	var req AssignRolesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	if len(req.Assignments) > MaxRoleAssignments {
+		respondError(c, http.StatusRequestEntityTooLarge, models.CodeBatchTooLarge,
+			fmt.Sprintf("At most %d assignments are allowed per request", MaxRoleAssignments))
+		return
+	}
+
+	results := make([]RoleAssignmentResult, 0, len(req.Assignments))
+	updated := false
+	for _, assignment := range req.Assignments {
+		result := h.assignRole(c, assignment)
+		updated = updated || result.Status == "updated"
+		results = append(results, result)
+	}
+
+	if updated {
+		invalidateCache(c, h.cache, h.logger)
+	}
+	respondBatch(c, results, nil)
+}
+
+func (h *UserHandler) assignRole(c *gin.Context, assignment RoleAssignment) RoleAssignmentResult {
+	result := RoleAssignmentResult{UserID: assignment.UserID, Role: assignment.Role}
+
+	fail := func(err error) RoleAssignmentResult {
+		result.Status = "failed"
+		result.Error = itemError(err)
+		return result
+	}
+
+	ctx := c.Request.Context()
+	current, err := h.users.Get(ctx, assignment.UserID)
+	if err != nil {
+		return fail(err)
+	}
+	if !models.ValidRole(assignment.Role) {
+		return fail(models.ErrInvalidRole)
+	}
+	if current.Role == assignment.Role {
+		result.Status = "unchanged"
+		return result
+	}
+
+	role := assignment.Role
+	if _, err := h.users.Update(ctx, assignment.UserID, models.UpdateUserRequest{Role: &role}); err != nil {
+		return fail(err)
+	}
+
+	h.revokeTokens(c, assignment.UserID, "role change")
+
+	middleware.RequestLogger(c, h.logger).Info("Role assigned", zap.Int("user_id", assignment.UserID), zap.String("role", role))
+	h.recordAudit(c, "user.assign_role", assignment.UserID, zap.String("role", role))
+	result.Status = "updated"
+	return result
+}
+
+// RevokeTokens godoc
+// @Summary Force-expire a user's tokens
+// @Description Immediately invalidates every access token issued to the user. Tokens carry the user's token version, and revocation bumps that version, so all earlier tokens fail validation without tracking them individually. The user must log in again, and their API keys are deleted.
+// @Tags admin
+// @Param id path int true "User ID"
+// @Success 204
+// @Failure 401 {object} apierror.Problem
+// @Failure 403 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Security ApiKeyAuth
+// @Router /users/{id}/revoke-tokens [post]
+func (h *UserHandler) RevokeTokens(c *gin.Context) {
+	id, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+
+	if _, err := h.users.Get(c.Request.Context(), id); err != nil {
+		respondServiceError(c, err)
+		return
+	}
+	if err := h.tokens.RevokeUserTokens(c.Request.Context(), id); err != nil {
+		respondServiceError(c, err)
+		return
+	}
+	if h.keys != nil {
+		if err := h.keys.RevokeAll(c.Request.Context(), id); err != nil {
+			respondServiceError(c, err)
+			return
+		}
+	}
+
+	middleware.RequestLogger(c, h.logger).Info("User tokens revoked", zap.Int("user_id", id))
+	h.recordAudit(c, "user.revoke_tokens", id)
+	c.Status(http.StatusNoContent)
+}
+
+// MergeHooks returns the merge hooks for the credentials of a user. They
+// hand the source's sessions to the target, which they now sign in as, and
+// retire the source's own tokens and API keys. Moving comes first so that
+// revoking the source's tokens leaves the moved sessions alone. The hooks
+// run once the users are merged, so a rejected merge keeps the source
+// signed in, and each can run again for a merge retried after a failure.
+func MergeHooks(tokens *auth.AuthService, keys *apikey.Service) []models.MergeHook {
+	return []models.MergeHook{
+		func(ctx context.Context, source, target models.User) error {
+			return tokens.MoveSessions(ctx, source.ID, target.ID, target.Email, target.Role)
+		},
+		func(ctx context.Context, source, _ models.User) error {
+			return tokens.RevokeUserTokens(ctx, source.ID)
+		},
+		func(ctx context.Context, source, _ models.User) error {
+			return keys.RevokeAll(ctx, source.ID)
+		},
+	}
+}
+
+// AuditMergeHook returns the merge hook attributing the source's audit
+// records, those it made and those about it, to the target
+func AuditMergeHook(records audit.Store) models.MergeHook {
+	return func(ctx context.Context, source, target models.User) error {
+		_, err := records.Reassign(ctx, source.ID, target.ID)
+		return err
+	}
+}
+
+// MergeUsersRequest is the payload accepted by MergeUser
+type MergeUsersRequest struct {
+	SourceID int `json:"source_id" binding:"required,gt=0"`
+}
+
+// MergeUser godoc
+// @Summary Merge a duplicate user into another
+// @Description Reassigns the source user's owned data to the target and soft-deletes the source. The source's sessions move to the target; its other tokens and its API keys stop working.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param id path int true "Target user ID"
+// @Param merge body MergeUsersRequest true "Source user"
+// @Success 200 {object} models.User
+// @Failure 400 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 422 {object} apierror.Problem
+// @Router /users/{id}/merge [post]
+func (h *UserHandler) MergeUser(c *gin.Context) {
+	targetID, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+
+	var req MergeUsersRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	user, err := h.users.Merge(c.Request.Context(), targetID, req.SourceID)
+	switch {
+	case errors.Is(err, models.ErrIncompleteMerge):
+		// The users are merged all the same, which the client must learn
+		middleware.RequestLogger(c, h.logger).Error("Merge left data with the source user",
+			zap.Int("target_id", targetID), zap.Int("source_id", req.SourceID), zap.Error(err))
+	case err != nil:
+		respondServiceError(c, err)
+		return
+	}
+
+	middleware.RequestLogger(c, h.logger).Info("Users merged", zap.Int("target_id", targetID), zap.Int("source_id", req.SourceID))
+	h.recordAudit(c, "user.merge", targetID, zap.Int("source_id", req.SourceID))
+	invalidateCache(c, h.cache, h.logger)
+	c.JSON(http.StatusOK, user.Render(h.fieldPolicy))
+}
+
+// recordAudit writes an audit record of action applied to the user targetID
+func (h *UserHandler) recordAudit(c *gin.Context, action string, targetID int, extra ...zap.Field) {
+	writeAudit(c, h.audit, action, targetID, extra...)
+}
+
+// writeAudit writes an audit record of action applied to the user targetID
+// by the caller of c
+func writeAudit(c *gin.Context, auditLogger *zap.Logger, action string, targetID int, extra ...zap.Field) {
+	fields := append([]zap.Field{
+		zap.String("action", action),
+		zap.Int("target_id", targetID),
+		zap.String("ip", c.ClientIP()),
+		zap.String("request_id", middleware.GetRequestID(c)),
+	}, extra...)
+	if actorID, ok := middleware.GetUserID(c); ok {
+		fields = append(fields, zap.Int("actor_id", actorID))
+	}
+	auditLogger.Info("Audit", fields...)
+	middleware.MarkAudited(c)
+}
@@ -0,0 +1,751 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/cbwinslow/template2/examples/go/internal/logging"
+	"github.com/cbwinslow/template2/examples/go/internal/middleware"
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+	"github.com/cbwinslow/template2/examples/go/pkg/apierror"
+	"github.com/cbwinslow/template2/examples/go/pkg/auth"
+	"github.com/cbwinslow/template2/examples/go/pkg/auth/apikey"
+)
+
+type recordingRevoker struct {
+	revoked []int
+}
+
+func (r *recordingRevoker) RevokeUserTokens(ctx context.Context, userID int) error {
+	r.revoked = append(r.revoked, userID)
+	return nil
+}
+
+func newUserRouter(svc *models.UserService, revoker TokenRevoker) *gin.Engine {
+	h := NewUserHandler(svc, revoker, zap.NewNop())
+	router := gin.New()
+	router.GET("/users", h.GetUsers)
+	router.POST("/users", h.CreateUser)
+	router.GET("/users/:id", h.GetUser)
+	router.PUT("/users/:id", h.UpdateUser)
+	router.DELETE("/users/:id", h.DeleteUser)
+	router.POST("/users/roles", h.AssignRoles)
+	router.POST("/users/:id/merge", h.MergeUser)
+	return router
+}
+
+func TestAssignRolesReportsPerItemOutcomes(t *testing.T) {
+	svc := models.NewUserService()
+	revoker := &recordingRevoker{}
+	router := newUserRouter(svc, revoker)
+
+	body := `{"assignments":[
+		{"user_id":2,"role":"admin"},
+		{"user_id":1,"role":"superuser"},
+		{"user_id":999,"role":"user"},
+		{"user_id":1,"role":"admin"}
+	]}`
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/users/roles", strings.NewReader(body)))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		Results []RoleAssignmentResult `json:"results"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	want := []struct {
+		status string
+		code   models.ErrorCode
+	}{
+		{"updated", ""},
+		{"failed", models.CodeInvalidRole},
+		{"failed", models.CodeUserNotFound},
+		{"unchanged", ""},
+	}
+	if len(resp.Results) != len(want) {
+		t.Fatalf("got %d results, want %d", len(resp.Results), len(want))
+	}
+	for i, w := range want {
+		got := resp.Results[i]
+		var code models.ErrorCode
+		if got.Error != nil {
+			code = got.Error.Code
+		}
+		if got.Status != w.status || code != w.code {
+			t.Errorf("result %d = %s/%s, want %s/%s", i, got.Status, code, w.status, w.code)
+		}
+	}
+
+	if len(revoker.revoked) != 1 || revoker.revoked[0] != 2 {
+		t.Errorf("revoked tokens for %v, want only user 2", revoker.revoked)
+	}
+	bob, _ := svc.Get(context.Background(), 2)
+	if bob.Role != models.RoleAdmin {
+		t.Errorf("user 2 role = %q, want admin", bob.Role)
+	}
+}
+
+func TestAssignRolesCapsBatchSize(t *testing.T) {
+	var assignments []string
+	for i := 0; i <= MaxRoleAssignments; i++ {
+		assignments = append(assignments, fmt.Sprintf(`{"user_id":%d,"role":"user"}`, i+1))
+	}
+	body := bytes.NewBufferString(`{"assignments":[` + strings.Join(assignments, ",") + `]}`)
+
+	w := httptest.NewRecorder()
+	newUserRouter(models.NewUserService(), &recordingRevoker{}).
+		ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/users/roles", body))
+
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusRequestEntityTooLarge)
+	}
+}
+
+func TestUserAccessChangesRevokeTokens(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		want   []int
+	}{
+		{"role change", http.MethodPut, `{"role":"admin"}`, []int{2}},
+		{"other fields", http.MethodPut, `{"name":"Bobby"}`, nil},
+		{"delete", http.MethodDelete, "", []int{2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			revoker := &recordingRevoker{}
+			router := newUserRouter(models.NewUserService(), revoker)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(tt.method, "/users/2", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+			if w.Code >= 300 {
+				t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+			}
+			if fmt.Sprint(revoker.revoked) != fmt.Sprint(tt.want) {
+				t.Errorf("revoked tokens for %v, want %v", revoker.revoked, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeUserFoldsSourceIntoTarget(t *testing.T) {
+	ctx := context.Background()
+	var moved [][2]int
+	svc := models.NewUserService(models.WithMergeHooks(func(_ context.Context, source, target models.User) error {
+		moved = append(moved, [2]int{source.ID, target.ID})
+		return nil
+	}))
+	target, _ := svc.Create(ctx, models.CreateUserRequest{Name: "Bob S", Email: "bob.s@example.com"})
+
+	w := httptest.NewRecorder()
+	newUserRouter(svc, &recordingRevoker{}).ServeHTTP(w, httptest.NewRequest(http.MethodPost,
+		fmt.Sprintf("/users/%d/merge", target.ID), strings.NewReader(`{"source_id":2}`)))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+	var merged models.User
+	if err := json.Unmarshal(w.Body.Bytes(), &merged); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if merged.ID != target.ID || merged.Age != 25 {
+		t.Errorf("merged = %+v, want target with the source's age filled in", merged)
+	}
+	if len(moved) != 1 || moved[0] != [2]int{2, target.ID} {
+		t.Errorf("merge hooks called with %v, want [[2 %d]]", moved, target.ID)
+	}
+	if _, err := svc.Get(ctx, 2); err != models.ErrUserNotFound {
+		t.Errorf("source still visible after merge: err = %v", err)
+	}
+}
+
+func TestMergeUserMovesCredentials(t *testing.T) {
+	ctx := context.Background()
+	tokens := auth.NewAuthService()
+	keys := apikey.NewService(apikey.NewMemoryStore())
+	var svc *models.UserService
+	// A hook may call back into the service without deadlocking the merge
+	lookup := func(ctx context.Context, _, target models.User) error {
+		_, err := svc.Get(ctx, target.ID)
+		return err
+	}
+	svc = models.NewUserService(models.WithMergeHooks(append(MergeHooks(tokens, keys), lookup)...))
+	target, _ := svc.Create(ctx, models.CreateUserRequest{Name: "Bob S", Email: "bob.s@example.com"})
+
+	pair, _ := tokens.IssueTokenPair(ctx, 2, "bob@example.com", models.RoleUser)
+	_, plaintext, _ := keys.Create(ctx, 2, "ci")
+
+	w := httptest.NewRecorder()
+	newUserRouter(svc, tokens).ServeHTTP(w, httptest.NewRequest(http.MethodPost,
+		fmt.Sprintf("/users/%d/merge", target.ID), strings.NewReader(`{"source_id":2}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+
+	if _, err := tokens.ValidateToken(ctx, pair.AccessToken); !errors.Is(err, auth.ErrTokenRevoked) {
+		t.Errorf("source access token: err = %v, want ErrTokenRevoked", err)
+	}
+	if _, err := keys.Authenticate(ctx, plaintext); !errors.Is(err, apikey.ErrInvalidKey) {
+		t.Errorf("source API key: err = %v, want ErrInvalidKey", err)
+	}
+	if sessions, _ := tokens.Sessions(ctx, target.ID); len(sessions) != 1 {
+		t.Errorf("target sessions = %+v, want the source's one", sessions)
+	}
+	refreshed, err := tokens.Refresh(ctx, pair.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh of a moved session: %v", err)
+	}
+	claims, err := tokens.ValidateToken(ctx, refreshed.AccessToken)
+	if err != nil || claims.UserID != target.ID || claims.Email != target.Email {
+		t.Errorf("refreshed claims = %+v, %v, want the target", claims, err)
+	}
+}
+
+// conflictingMergeRepository fails every merge as if another write had
+// landed first
+type conflictingMergeRepository struct {
+	models.UserRepository
+}
+
+func (conflictingMergeRepository) Merge(context.Context, int, int, func(*models.User, models.User) error) (models.User, error) {
+	return models.User{}, models.ErrTxConflict
+}
+
+func TestMergeUserFailureKeepsCredentials(t *testing.T) {
+	ctx := context.Background()
+	tokens := auth.NewAuthService()
+	keys := apikey.NewService(apikey.NewMemoryStore())
+	repo := conflictingMergeRepository{models.NewMemoryUserRepository(0)}
+	svc := models.NewUserService(models.WithRepository(repo), models.WithMergeHooks(MergeHooks(tokens, keys)...))
+	target, _ := svc.Create(ctx, models.CreateUserRequest{Name: "Bob S", Email: "bob.s@example.com"})
+	source, err := svc.Get(ctx, 2)
+	if err != nil {
+		t.Fatalf("seeded source: %v", err)
+	}
+
+	pair, _ := tokens.IssueTokenPair(ctx, source.ID, source.Email, models.RoleUser)
+	_, plaintext, _ := keys.Create(ctx, source.ID, "ci")
+
+	w := httptest.NewRecorder()
+	newUserRouter(svc, tokens).ServeHTTP(w, httptest.NewRequest(http.MethodPost,
+		fmt.Sprintf("/users/%d/merge", target.ID), strings.NewReader(fmt.Sprintf(`{"source_id":%d}`, source.ID))))
+	if w.Code != http.StatusConflict {
+		t.Fatalf("status = %d, want 409: %s", w.Code, w.Body.String())
+	}
+
+	if claims, err := tokens.ValidateToken(ctx, pair.AccessToken); err != nil || claims.UserID != source.ID {
+		t.Errorf("source access token = %+v, %v; want it still valid", claims, err)
+	}
+	if _, err := keys.Authenticate(ctx, plaintext); err != nil {
+		t.Errorf("source API key: %v, want it still valid", err)
+	}
+	if sessions, _ := tokens.Sessions(ctx, source.ID); len(sessions) != 1 {
+		t.Errorf("source sessions = %+v, want them left with the source", sessions)
+	}
+	if sessions, _ := tokens.Sessions(ctx, target.ID); len(sessions) != 0 {
+		t.Errorf("target sessions = %+v, want none moved", sessions)
+	}
+}
+
+func TestMergeUserReassignsAuditRecords(t *testing.T) {
+	ctx := context.Background()
+	trail := logging.NewAuditTrail(10)
+	for _, r := range []logging.AuditRecord{
+		{Action: "user.update", ActorID: 2, TargetID: 2},
+		{Action: "user.lock", ActorID: 1, TargetID: 2},
+		{Action: "user.update", ActorID: 1, TargetID: 9},
+	} {
+		_ = trail.Append(ctx, r)
+	}
+	svc := models.NewUserService(models.WithMergeHooks(AuditMergeHook(trail)))
+	target, _ := svc.Create(ctx, models.CreateUserRequest{Name: "Bob S", Email: "bob.s@example.com"})
+
+	w := httptest.NewRecorder()
+	newUserRouter(svc, &recordingRevoker{}).ServeHTTP(w, httptest.NewRequest(http.MethodPost,
+		fmt.Sprintf("/users/%d/merge", target.ID), strings.NewReader(`{"source_id":2}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+
+	if records := trail.Records(logging.AuditQuery{TargetID: 2}); len(records) != 0 {
+		t.Errorf("records still about the source: %+v", records)
+	}
+	if records := trail.Records(logging.AuditQuery{TargetID: target.ID}); len(records) != 2 {
+		t.Errorf("records about the target = %+v, want the source's two", records)
+	}
+	if records := trail.Records(logging.AuditQuery{ActorID: target.ID}); len(records) != 1 || records[0].TargetID != target.ID {
+		t.Errorf("records by the target = %+v, want the source's own update", records)
+	}
+}
+
+func TestMergeUserHookFailureCanBeRetried(t *testing.T) {
+	ctx := context.Background()
+	trail := logging.NewAuditTrail(10)
+	_ = trail.Append(ctx, logging.AuditRecord{Action: "user.update", ActorID: 2, TargetID: 2})
+	failing := true
+	flaky := func(context.Context, models.User, models.User) error {
+		if failing {
+			return errors.New("session store unavailable")
+		}
+		return nil
+	}
+	svc := models.NewUserService(models.WithMergeHooks(AuditMergeHook(trail), flaky))
+	target, _ := svc.Create(ctx, models.CreateUserRequest{Name: "Bob S", Email: "bob.s@example.com"})
+	router := newUserRouter(svc, &recordingRevoker{})
+	merge := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost,
+			fmt.Sprintf("/users/%d/merge", target.ID), strings.NewReader(`{"source_id":2}`)))
+		return w
+	}
+
+	if w := merge(); w.Code != http.StatusInternalServerError {
+		t.Fatalf("failing hook: status = %d, want 500: %s", w.Code, w.Body.String())
+	}
+	if _, err := svc.Get(ctx, 2); err != nil {
+		t.Fatalf("source after the failed merge: %v, want it kept", err)
+	}
+
+	failing = false
+	if w := merge(); w.Code != http.StatusOK {
+		t.Fatalf("retry: status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+	if _, err := svc.Get(ctx, 2); err != models.ErrUserNotFound {
+		t.Errorf("source still visible after the retried merge: err = %v", err)
+	}
+	if records := trail.Records(logging.AuditQuery{TargetID: target.ID}); len(records) != 1 {
+		t.Errorf("records about the target = %+v, want the source's one, reassigned once", records)
+	}
+}
+
+// nonTransactionalRepository hides the Transactor of the repository it wraps
+type nonTransactionalRepository struct {
+	models.UserRepository
+}
+
+func TestMergeUserReportsIncompleteMergeAsMerged(t *testing.T) {
+	ctx := context.Background()
+	failing := func(context.Context, models.User, models.User) error {
+		return errors.New("session store unavailable")
+	}
+	repo := nonTransactionalRepository{models.NewMemoryUserRepository(0)}
+	svc := models.NewUserService(models.WithRepository(repo), models.WithMergeHooks(failing))
+	target, _ := svc.Create(ctx, models.CreateUserRequest{Name: "Bob S", Email: "bob.s@example.com"})
+
+	w := httptest.NewRecorder()
+	newUserRouter(svc, &recordingRevoker{}).ServeHTTP(w, httptest.NewRequest(http.MethodPost,
+		fmt.Sprintf("/users/%d/merge", target.ID), strings.NewReader(`{"source_id":2}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 for the merge that took effect: %s", w.Code, w.Body.String())
+	}
+	if _, err := svc.Get(ctx, 2); err != models.ErrUserNotFound {
+		t.Errorf("source still visible after merge: err = %v", err)
+	}
+}
+
+func TestMergeUserRejectsSelfMerge(t *testing.T) {
+	w := httptest.NewRecorder()
+	newUserRouter(models.NewUserService(), &recordingRevoker{}).ServeHTTP(w,
+		httptest.NewRequest(http.MethodPost, "/users/1/merge", strings.NewReader(`{"source_id":1}`)))
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", w.Code)
+	}
+	var body apierror.Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Code != string(models.CodeInvalidMerge) {
+		t.Errorf("body = %s, want code %s", w.Body.String(), models.CodeInvalidMerge)
+	}
+}
+
+func TestGetUsersReturnsSummaries(t *testing.T) {
+	router := newUserRouter(models.NewUserService(), &recordingRevoker{})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users", nil))
+
+	var list []map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil || len(list) == 0 {
+		t.Fatalf("list body = %s", w.Body.String())
+	}
+	for _, key := range []string{"id", "name", "email"} {
+		if _, ok := list[0][key]; !ok {
+			t.Errorf("list item missing %q", key)
+		}
+	}
+	for _, key := range []string{"role", "active", "age", "created_at", "updated_at"} {
+		if _, ok := list[0][key]; ok {
+			t.Errorf("list item includes heavy field %q", key)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/1", nil))
+	var full map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &full); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if _, ok := full["created_at"]; !ok {
+		t.Error("GET /users/:id should return the full user")
+	}
+}
+
+func TestCreateUserFailsAtCapacity(t *testing.T) {
+	// The two seed users already fill the store.
+	router := newUserRouter(models.NewUserService(models.WithMaxUsers(2)), &recordingRevoker{})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/users",
+		strings.NewReader(`{"name":"Ivy","email":"ivy@example.com"}`)))
+
+	if w.Code != http.StatusInsufficientStorage {
+		t.Fatalf("status = %d, want 507", w.Code)
+	}
+	var body apierror.Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Code != string(models.CodeStorageFull) {
+		t.Errorf("body = %s, want code %s", w.Body.String(), models.CodeStorageFull)
+	}
+}
+
+func TestGetUserMapsDeadlineToGatewayTimeout(t *testing.T) {
+	svc := models.NewUserService()
+	h := NewUserHandler(svc, &recordingRevoker{}, zap.NewNop())
+	router := gin.New()
+	router.GET("/users/:id", func(c *gin.Context) {
+		// Simulate a slow store: the deadline passes before the query runs.
+		ctx, cancel := context.WithTimeout(c.Request.Context(), time.Millisecond)
+		defer cancel()
+		time.Sleep(5 * time.Millisecond)
+		c.Request = c.Request.WithContext(ctx)
+		h.GetUser(c)
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/1", nil))
+
+	if w.Code != http.StatusGatewayTimeout {
+		t.Fatalf("status = %d, want 504", w.Code)
+	}
+	var body apierror.Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Code != string(models.CodeRequestTimeout) {
+		t.Errorf("body = %s, want code %s", w.Body.String(), models.CodeRequestTimeout)
+	}
+}
+
+func TestCreateUserWritesAuditRecord(t *testing.T) {
+	core, records := observer.New(zap.InfoLevel)
+	h := NewUserHandler(models.NewUserService(), &recordingRevoker{}, zap.NewNop(), WithAuditLogger(zap.New(core)))
+	router := gin.New()
+	router.POST("/users", h.CreateUser)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(`{"name":"Ivy","email":"ivy@example.com"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	entries := records.FilterField(zap.String("action", "user.create")).All()
+	if len(entries) != 1 {
+		t.Fatalf("audit records = %d, want 1", records.Len())
+	}
+	if target := entries[0].ContextMap()["target_id"]; target != int64(3) {
+		t.Errorf("target_id = %v, want 3", target)
+	}
+}
+
+func TestUpdateUserAuditsChanges(t *testing.T) {
+	trail := logging.NewAuditTrail(10)
+	h := NewUserHandler(models.NewUserService(), &recordingRevoker{}, zap.NewNop(), WithAuditLogger(zap.New(trail.Core())))
+	router := gin.New()
+	router.PATCH("/users/:id", h.UpdateUser)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPatch, "/users/1", strings.NewReader(`{"name":"Alice Jones"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+
+	records := trail.Records(logging.AuditQuery{Action: "user.update"})
+	if len(records) != 1 {
+		t.Fatalf("audit records = %d, want 1", len(records))
+	}
+	if change := records[0].Changes["name"]; change.Before == change.After || change.After != "Alice Jones" {
+		t.Errorf("name change = %+v", change)
+	}
+	if _, ok := records[0].Changes["email"]; ok {
+		t.Error("unchanged email recorded as a change")
+	}
+}
+
+func TestGetUsersSortIsStableForEqualNames(t *testing.T) {
+	svc := models.NewUserService()
+	for _, email := range []string{"sam.a@example.com", "sam.b@example.com"} {
+		if _, err := svc.Create(context.Background(), models.CreateUserRequest{Name: "Sam", Email: email}); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+	router := newUserRouter(svc, &recordingRevoker{})
+
+	var first string
+	for i := 0; i < 10; i++ {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users?sort=-name", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+		}
+		if i == 0 {
+			first = w.Body.String()
+			var users []models.UserSummary
+			if err := json.Unmarshal(w.Body.Bytes(), &users); err != nil || users[0].ID != 4 || users[1].ID != 3 {
+				t.Fatalf("order = %s, want the two Sams as IDs 4 then 3", first)
+			}
+		} else if w.Body.String() != first {
+			t.Fatalf("request %d order differs: %s vs %s", i+1, w.Body.String(), first)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users?sort=password", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("unknown sort field: status = %d, want 400", w.Code)
+	}
+}
+
+func TestRevokeTokensRejectsEarlierTokens(t *testing.T) {
+	authService := auth.NewAuthService()
+	h := NewUserHandler(models.NewUserService(), authService, zap.NewNop())
+	router := gin.New()
+	router.POST("/users/:id/revoke-tokens", h.RevokeTokens)
+
+	token, err := authService.GenerateToken(context.Background(), 2, "bob@example.com", models.RoleUser)
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	if _, err := authService.ValidateToken(context.Background(), token); err != nil {
+		t.Fatalf("token invalid before revocation: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/users/2/revoke-tokens", nil))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	if _, err := authService.ValidateToken(context.Background(), token); !errors.Is(err, auth.ErrTokenRevoked) {
+		t.Errorf("ValidateToken after revocation = %v, want ErrTokenRevoked", err)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/users/999/revoke-tokens", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("unknown user: status = %d, want 404", w.Code)
+	}
+}
+
+func TestGetUsersPaginatesFilteredUsers(t *testing.T) {
+	svc := models.NewUserService()
+	for i := 0; i < 5; i++ {
+		req := models.CreateUserRequest{Name: fmt.Sprintf("Sam %d", i), Email: fmt.Sprintf("sam%d@example.com", i)}
+		if _, err := svc.Create(context.Background(), req); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+	h := NewUserHandler(svc, &recordingRevoker{}, zap.NewNop(), WithPageSize(2, 3))
+	router := gin.New()
+	router.GET("/users", h.GetUsers)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users?filter=name:sam&page=2", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	var users []models.UserSummary
+	if err := json.Unmarshal(w.Body.Bytes(), &users); err != nil || len(users) != 2 || users[0].ID != 5 {
+		t.Fatalf("page 2 = %s, want users 5 and 6", w.Body.String())
+	}
+	if got := w.Header().Get("X-Total-Count"); got != "5" {
+		t.Errorf("X-Total-Count = %q, want 5", got)
+	}
+	want := `</users?filter=name%3Asam&page=3>; rel="next", </users?filter=name%3Asam&page=1>; rel="prev"`
+	if got := w.Header().Get("Link"); got != want {
+		t.Errorf("Link = %q, want %q", got, want)
+	}
+
+	for _, query := range []string{"limit=4", "page=0", "filter=password:x"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users?"+query, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", query, w.Code)
+		}
+	}
+}
+
+func TestDeleteUserSoftDeletesUnlessHard(t *testing.T) {
+	svc := models.NewUserService()
+	authService := auth.NewAuthService()
+	adminToken, _ := authService.GenerateToken(context.Background(), 1, "alice@example.com", models.RoleAdmin)
+	userToken, _ := authService.GenerateToken(context.Background(), 2, "bob@example.com", models.RoleUser)
+	h := NewUserHandler(svc, &recordingRevoker{}, zap.NewNop())
+	router := gin.New()
+	router.Use(middleware.AuthRequired(authService))
+	router.GET("/users", h.GetUsers)
+	router.DELETE("/users/:id", h.DeleteUser)
+
+	send := func(method, path, token string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := send(http.MethodDelete, "/users/2", adminToken); w.Code != http.StatusNoContent {
+		t.Fatalf("soft delete: status = %d: %s", w.Code, w.Body.String())
+	}
+	if w := send(http.MethodGet, "/users", adminToken); strings.Contains(w.Body.String(), "bob@example.com") {
+		t.Errorf("listing includes soft-deleted user: %s", w.Body.String())
+	}
+	w := send(http.MethodGet, "/users?include_deleted", adminToken)
+	var list []models.UserSummary
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil || len(list) != 2 || list[1].DeletedAt == nil {
+		t.Errorf("include_deleted body = %s", w.Body.String())
+	}
+
+	cases := []struct {
+		method, path, token string
+		want                int
+	}{
+		{http.MethodGet, "/users?include_deleted=true", userToken, http.StatusForbidden},
+		{http.MethodDelete, "/users/2?hard=true", userToken, http.StatusForbidden},
+		{http.MethodDelete, "/users/2?hard=maybe", adminToken, http.StatusBadRequest},
+		{http.MethodDelete, "/users/2", adminToken, http.StatusNotFound},
+		{http.MethodDelete, "/users/2?hard=true", adminToken, http.StatusNoContent},
+		{http.MethodDelete, "/users/2?hard=true", adminToken, http.StatusNotFound},
+	}
+	for _, tc := range cases {
+		if w := send(tc.method, tc.path, tc.token); w.Code != tc.want {
+			t.Errorf("%s %s: status = %d, want %d", tc.method, tc.path, w.Code, tc.want)
+		}
+	}
+	if all, _ := svc.List(context.Background(), models.IncludeDeleted()); len(all) != 1 {
+		t.Errorf("%d users left after hard delete, want 1", len(all))
+	}
+}
+
+func TestCreateUserListsInvalidFields(t *testing.T) {
+	router := newUserRouter(models.NewUserService(), &recordingRevoker{})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/users",
+		strings.NewReader(`{"name":"Ivy","email":"not-an-email","age":200}`)))
+
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d, want 422", w.Code)
+	}
+	var body apierror.Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Code != string(models.CodeValidationFailed) {
+		t.Fatalf("body = %s, want code %s", w.Body.String(), models.CodeValidationFailed)
+	}
+	got := map[string]string{}
+	for _, field := range body.Errors {
+		got[field.Field] = field.Rule
+	}
+	if len(got) != 2 || got["email"] != "email" || got["age"] != "lte" {
+		t.Errorf("errors = %+v, want email/email and age/lte", body.Errors)
+	}
+}
+
+func TestUserConditionalRequests(t *testing.T) {
+	router := newUserRouter(models.NewUserService(), &recordingRevoker{})
+	send := func(method, header, etag, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, "/users/2", strings.NewReader(body))
+		if etag != "" {
+			req.Header.Set(header, etag)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send(http.MethodGet, "", "", "")
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || !strings.HasPrefix(etag, `"`) {
+		t.Fatalf("get: %d, ETag %q", w.Code, etag)
+	}
+	if w := send(http.MethodGet, "If-None-Match", `"other", W/`+etag, ""); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("If-None-Match with the current ETag: %d %s, want 304 and no body", w.Code, w.Body.String())
+	}
+
+	w = send(http.MethodPut, "If-Match", etag, `{"name":"Robert"}`)
+	updated := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || updated == "" || updated == etag {
+		t.Fatalf("update with the current ETag: %d, ETag %q", w.Code, updated)
+	}
+	w = send(http.MethodPut, "If-Match", etag, `{"name":"Bobby"}`)
+	if w.Code != http.StatusPreconditionFailed {
+		t.Fatalf("update with a stale ETag: status = %d, want 412", w.Code)
+	}
+	var body apierror.Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Code != string(models.CodePreconditionFailed) {
+		t.Errorf("body = %s, want code %s", w.Body.String(), models.CodePreconditionFailed)
+	}
+	if w := send(http.MethodGet, "If-None-Match", etag, ""); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Robert") {
+		t.Errorf("If-None-Match with a stale ETag: %d %s, want 200 with the update", w.Code, w.Body.String())
+	}
+}
+
+type countingCache struct{ purges int }
+
+func (c *countingCache) Purge(context.Context) error {
+	c.purges++
+	return nil
+}
+
+func TestUserWritesInvalidateCache(t *testing.T) {
+	cache := &countingCache{}
+	h := NewUserHandler(models.NewUserService(), &recordingRevoker{}, zap.NewNop(), WithCacheInvalidator(cache))
+	router := gin.New()
+	router.POST("/users", h.CreateUser)
+	router.PUT("/users/:id", h.UpdateUser)
+	router.DELETE("/users/:id", h.DeleteUser)
+
+	cases := []struct {
+		method, path, body string
+		want               int
+	}{
+		{http.MethodPost, "/users", `{"name":"Ivy","email":"ivy@example.com"}`, 1},
+		{http.MethodPost, "/users", `{"name":"Ivy","email":"ivy@example.com"}`, 1},
+		{http.MethodPut, "/users/2", `{"name":"Robert"}`, 2},
+		{http.MethodDelete, "/users/2", "", 3},
+		{http.MethodDelete, "/users/2", "", 3},
+	}
+	for _, tc := range cases {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body)))
+		if cache.purges != tc.want {
+			t.Errorf("%s %s: %d purges, want %d", tc.method, tc.path, cache.purges, tc.want)
+		}
+	}
+}
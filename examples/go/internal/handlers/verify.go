@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/cbwinslow/template2/examples/go/internal/middleware"
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+	"github.com/cbwinslow/template2/examples/go/pkg/auth"
+	"github.com/cbwinslow/template2/examples/go/pkg/mailer"
+)
+
+// EmailVerification describes the verification mail Register sends
+type EmailVerification struct {
+	Mailer mailer.Mailer
+	// URL is the page the mailed link points at; the token is added as its
+	// token query parameter
+	URL string
+	// Templates renders the verify_email mail; nil uses the built-in one
+	Templates *mailer.Templates
+}
+
+// defaultMailTemplates are the templates of mails whose Templates is nil
+var defaultMailTemplates = sync.OnceValue(mailer.DefaultTemplates)
+
+// mailLink is the data the link mail templates are rendered with
+type mailLink struct {
+	Name string
+	Link string
+}
+
+// WithEmailVerification makes Register create users unverified and mail
+// them a link to VerifyEmail
+func WithEmailVerification(verification EmailVerification) AuthHandlerOption {
+	return func(h *AuthHandler) {
+		h.verification = &verification
+	}
+}
+
+// VerifyEmail godoc
+// @Summary Verify an email address
+// @Description Marks the account's email as verified using the token from the link mailed at registration. Links stop working once they expire or the account's email changes.
+// @Tags auth
+// @Produce json
+// @Param token query string true "Verification token"
+// @Success 200 {object} models.User
+// @Failure 400 {object} apierror.Problem
+// @Router /auth/verify [get]
+func (h *AuthHandler) VerifyEmail(c *gin.Context) {
+	ctx := c.Request.Context()
+	var user models.User
+	userID, email, err := h.auth.ValidateVerificationToken(ctx, c.Query("token"))
+	if err == nil {
+		user, err = h.users.VerifyEmail(ctx, userID, email)
+	}
+	switch {
+	case errors.Is(err, auth.ErrInvalidToken), errors.Is(err, models.ErrEmailChanged), errors.Is(err, models.ErrUserNotFound):
+		respondError(c, http.StatusBadRequest, models.CodeTokenInvalid, "Invalid or expired verification link")
+		return
+	case err != nil:
+		respondServiceError(c, err)
+		return
+	}
+
+	middleware.RequestLogger(c, h.logger).Info("Email verified", zap.Int("user_id", user.ID))
+	invalidateCache(c, h.cache, h.logger)
+	c.JSON(http.StatusOK, user)
+}
+
+// sendVerification mails user a link to verify their email address
+func (h *AuthHandler) sendVerification(ctx context.Context, user models.User) error {
+	token, err := h.auth.GenerateVerificationToken(ctx, user.ID, user.Email)
+	if err != nil {
+		return err
+	}
+	link, err := tokenLink(h.verification.URL, token)
+	if err != nil {
+		return err
+	}
+
+	return sendLinkMail(ctx, h.verification.Mailer, h.verification.Templates, "verify_email", user, link)
+}
+
+// sendLinkMail renders the link mail template name for user and sends it
+// through m
+func sendLinkMail(ctx context.Context, m mailer.Mailer, templates *mailer.Templates, name string, user models.User, link string) error {
+	if templates == nil {
+		templates = defaultMailTemplates()
+	}
+	msg, err := templates.Render(name, user.Email, mailLink{Name: user.Name, Link: link})
+	if err != nil {
+		return err
+	}
+	return m.Send(ctx, msg)
+}
+
+// tokenLink returns base with token added as its token query parameter,
+// keeping any query base already has
+func tokenLink(base, token string) (string, error) {
+	link, err := url.Parse(base)
+	if err != nil {
+		return "", fmt.Errorf("mail link: %w", err)
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+	return link.String(), nil
+}
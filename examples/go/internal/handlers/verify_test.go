@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/cbwinslow/template2/examples/go/internal/middleware"
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+	"github.com/cbwinslow/template2/examples/go/pkg/apierror"
+	"github.com/cbwinslow/template2/examples/go/pkg/auth"
+	"github.com/cbwinslow/template2/examples/go/pkg/mailer"
+)
+
+type recordingMailer struct {
+	sent []mailer.Message
+	err  error
+}
+
+func (m *recordingMailer) Send(_ context.Context, msg mailer.Message) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func newVerificationRouter(authService *auth.AuthService, users *models.UserService, mail mailer.Mailer) *gin.Engine {
+	h := NewAuthHandler(authService, users, zap.NewNop(), WithEmailVerification(EmailVerification{
+		Mailer: mail,
+		URL:    "https://app.example.com/verify?lang=en",
+	}))
+	requireVerified := middleware.WithVerifiedEmail(func(ctx context.Context, userID int) (bool, error) {
+		user, err := users.Get(ctx, userID)
+		return err == nil && user.EmailVerified, nil
+	})
+
+	router := gin.New()
+	router.POST("/auth/register", h.Register)
+	router.POST("/auth/login", h.Login)
+	router.GET("/auth/verify", h.VerifyEmail)
+	router.GET("/protected/profile", middleware.AuthRequired(authService, requireVerified), h.GetProfile)
+	return router
+}
+
+func TestRegisterRequiresEmailVerification(t *testing.T) {
+	authService := auth.NewAuthService()
+	mail := &recordingMailer{}
+	router := newVerificationRouter(authService, models.NewUserService(), mail)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/auth/register",
+		strings.NewReader(`{"name":"Ivy","email":"ivy@example.com","password":"s3cret-pass"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	var registered models.User
+	if err := json.Unmarshal(w.Body.Bytes(), &registered); err != nil || w.Code != http.StatusCreated || registered.EmailVerified {
+		t.Fatalf("register: %d %s", w.Code, w.Body.String())
+	}
+	if len(mail.sent) != 1 || mail.sent[0].To != "ivy@example.com" {
+		t.Fatalf("sent %+v, want one mail to ivy@example.com", mail.sent)
+	}
+
+	var tokens TokenResponse
+	json.Unmarshal(login(router, `{"email":"ivy@example.com","password":"s3cret-pass"}`).Body.Bytes(), &tokens)
+	profile := func() int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/protected/profile", nil)
+		req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	if status := profile(); status != http.StatusForbidden {
+		t.Errorf("profile before verifying: status = %d, want 403", status)
+	}
+
+	link := mail.sent[0].Body[strings.Index(mail.sent[0].Body, "https://"):]
+	link = link[:strings.IndexByte(link, '\n')]
+	parsed, err := url.Parse(link)
+	if err != nil || parsed.Query().Get("lang") != "en" {
+		t.Fatalf("link %q does not keep the configured URL", link)
+	}
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/auth/verify?"+parsed.RawQuery, nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"email_verified":true`) {
+		t.Fatalf("verify: %d %s", w.Code, w.Body.String())
+	}
+	if status := profile(); status != http.StatusOK {
+		t.Errorf("profile after verifying: status = %d, want 200", status)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/auth/verify?token="+tokens.AccessToken, nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("verify with an access token: status = %d, want 400", w.Code)
+	}
+}
+
+func TestRegisterUndoesAccountWhenMailFails(t *testing.T) {
+	users := models.NewUserService()
+	router := newVerificationRouter(auth.NewAuthService(), users, &recordingMailer{err: errors.New("relay down")})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/auth/register",
+		strings.NewReader(`{"name":"Ivy","email":"ivy@example.com","password":"s3cret-pass"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500", w.Code)
+	}
+	if _, err := users.GetByEmail(context.Background(), "ivy@example.com"); !errors.Is(err, models.ErrUserNotFound) {
+		t.Errorf("account kept after failed mail: err = %v", err)
+	}
+}
+
+func TestRegisterListsEveryInvalidField(t *testing.T) {
+	router := newVerificationRouter(auth.NewAuthService(), models.NewUserService(), &recordingMailer{})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/auth/register",
+		strings.NewReader(`{"name":"<Ivy>","email":"ivy@example.com","password":"password"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d, want 422", w.Code)
+	}
+	var body apierror.Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("body = %s", w.Body.String())
+	}
+	got := map[string]string{}
+	for _, field := range body.Errors {
+		got[field.Field] = field.Rule
+	}
+	if len(got) != 2 || got["name"] != "username" || got["password"] != "password" {
+		t.Errorf("errors = %+v, want name/username and password/password", body.Errors)
+	}
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPost, "/auth/register", strings.NewReader(`{"name":`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("malformed body: status = %d, want 400", w.Code)
+	}
+}
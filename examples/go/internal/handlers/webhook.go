@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/cbwinslow/template2/examples/go/internal/middleware"
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+	"github.com/cbwinslow/template2/examples/go/pkg/webhooks"
+)
+
+// Deliveries returned by ListWebhookDeliveries when no limit is requested,
+// and the most that can be requested
+const (
+	defaultDeliveryLimit = 50
+	maxDeliveryLimit     = 200
+)
+
+// WebhookManager is the part of the webhook service the handlers use
+type WebhookManager interface {
+	Subscribe(ctx context.Context, userID int, url string, events []string) (webhooks.Subscription, error)
+	Subscriptions(ctx context.Context, userID int) ([]webhooks.Subscription, error)
+	Unsubscribe(ctx context.Context, userID int, id string) error
+	Deliveries(ctx context.Context, userID, limit int) ([]webhooks.Delivery, error)
+}
+
+// CreateWebhookRequest subscribes a URL to events
+type CreateWebhookRequest struct {
+	URL    string   `json:"url" binding:"required,url,max=2048"`
+	Events []string `json:"events" binding:"required,min=1"`
+}
+
+// CreateWebhookResponse returns a new subscription together with its
+// signing secret, which is not shown again
+type CreateWebhookResponse struct {
+	webhooks.Subscription
+	Secret string `json:"secret"`
+}
+
+// WebhookHandler serves the webhook endpoints for the authenticated user
+type WebhookHandler struct {
+	webhooks WebhookManager
+	logger   *zap.Logger
+}
+
+// NewWebhookHandler creates a webhook handler
+func NewWebhookHandler(webhooks WebhookManager, logger *zap.Logger) *WebhookHandler {
+	return &WebhookHandler{webhooks: webhooks, logger: logger}
+}
+
+// CreateWebhook godoc
+// @Summary Subscribe a URL to events
+// @Description Events are user.created and user.deleted. Each delivery is a JSON POST signed in the X-Webhook-Signature header as t=<unix time>,v1=<hex HMAC-SHA256 of "<t>.<body>"> with the secret, which is returned once.
+// @Description Deliveries the receiver does not answer with 2xx are retried with backoff.
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param webhook body CreateWebhookRequest true "Webhook"
+// @Success 201 {object} CreateWebhookResponse
+// @Failure 400 {object} apierror.Problem
+// @Failure 422 {object} apierror.Problem
+// @Router /protected/webhooks [post]
+func (h *WebhookHandler) CreateWebhook(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		respondError(c, http.StatusUnauthorized, models.CodeUnauthorized, "Authentication required")
+		return
+	}
+	var req CreateWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	sub, err := h.webhooks.Subscribe(c.Request.Context(), userID, req.URL, req.Events)
+	if errors.Is(err, webhooks.ErrInvalidURL) || errors.Is(err, webhooks.ErrUnknownEvent) {
+		respondError(c, http.StatusUnprocessableEntity, models.CodeValidationFailed, err.Error())
+		return
+	}
+	if err != nil {
+		respondServiceError(c, err)
+		return
+	}
+
+	middleware.RequestLogger(c, h.logger).Info("Webhook created", zap.Int("user_id", userID), zap.String("webhook_id", sub.ID))
+	c.JSON(http.StatusCreated, CreateWebhookResponse{Subscription: sub, Secret: sub.Secret})
+}
+
+// ListWebhooks godoc
+// @Summary List webhooks
+// @Tags webhooks
+// @Produce json
+// @Success 200 {array} webhooks.Subscription
+// @Router /protected/webhooks [get]
+func (h *WebhookHandler) ListWebhooks(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		respondError(c, http.StatusUnauthorized, models.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	subs, err := h.webhooks.Subscriptions(c.Request.Context(), userID)
+	if err != nil {
+		respondServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, subs)
+}
+
+// DeleteWebhook godoc
+// @Summary Delete a webhook
+// @Description Deliveries still being retried for it are marked failed.
+// @Tags webhooks
+// @Param webhook_id path string true "Webhook ID"
+// @Success 204
+// @Failure 404 {object} apierror.Problem
+// @Router /protected/webhooks/{webhook_id} [delete]
+func (h *WebhookHandler) DeleteWebhook(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		respondError(c, http.StatusUnauthorized, models.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	err := h.webhooks.Unsubscribe(c.Request.Context(), userID, c.Param("webhook_id"))
+	if errors.Is(err, webhooks.ErrSubscriptionNotFound) {
+		respondError(c, http.StatusNotFound, models.CodeNotFound, "Webhook not found")
+		return
+	}
+	if err != nil {
+		respondServiceError(c, err)
+		return
+	}
+
+	middleware.RequestLogger(c, h.logger).Info("Webhook deleted", zap.Int("user_id", userID), zap.String("webhook_id", c.Param("webhook_id")))
+	c.Status(http.StatusNoContent)
+}
+
+// ListWebhookDeliveries godoc
+// @Summary List webhook deliveries
+// @Description Returns the most recent deliveries to the user's webhooks, newest first, with their status and the outcome of the last attempt.
+// @Tags webhooks
+// @Produce json
+// @Param limit query int false "Maximum deliveries to return" default(50) maximum(200)
+// @Success 200 {array} webhooks.Delivery
+// @Failure 400 {object} apierror.Problem
+// @Router /protected/webhooks/deliveries [get]
+func (h *WebhookHandler) ListWebhookDeliveries(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		respondError(c, http.StatusUnauthorized, models.CodeUnauthorized, "Authentication required")
+		return
+	}
+	limit := defaultDeliveryLimit
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxDeliveryLimit {
+			middleware.AbortWithError(c, models.NewError(http.StatusBadRequest, models.CodeValidationFailed, "Invalid limit").
+				WithDetails(map[string]interface{}{"parameter": "limit", "max_limit": maxDeliveryLimit}))
+			return
+		}
+		limit = n
+	}
+
+	deliveries, err := h.webhooks.Deliveries(c.Request.Context(), userID, limit)
+	if err != nil {
+		respondServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, deliveries)
+}
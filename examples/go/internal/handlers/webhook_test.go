@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/cbwinslow/template2/examples/go/internal/middleware"
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+	"github.com/cbwinslow/template2/examples/go/internal/outbound"
+	"github.com/cbwinslow/template2/examples/go/pkg/auth"
+	"github.com/cbwinslow/template2/examples/go/pkg/events"
+	"github.com/cbwinslow/template2/examples/go/pkg/jobs"
+	"github.com/cbwinslow/template2/examples/go/pkg/webhooks"
+)
+
+func TestWebhooksReceiveUserEvents(t *testing.T) {
+	var mu sync.Mutex
+	var received []string
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		received = append(received, r.Header.Get(webhooks.HeaderEvent))
+		mu.Unlock()
+	}))
+	defer receiver.Close()
+
+	queue := jobs.New(jobs.NewMemoryStore(), zap.NewNop(), jobs.WithPollInterval(5*time.Millisecond))
+	service := webhooks.NewService(webhooks.NewMemoryStore(), queue, &outbound.Client{HTTP: receiver.Client(), Logger: zap.NewNop(), MaxAttempts: 1})
+	_ = queue.Start(context.Background())
+	defer func() { _ = queue.Stop(context.Background()) }()
+
+	authService := auth.NewAuthService()
+	token, _ := authService.GenerateToken(context.Background(), 1, "alice@example.com", models.RoleAdmin)
+	h := NewWebhookHandler(service, zap.NewNop())
+	bus := events.NewBus(zap.NewNop())
+	for _, name := range webhooks.Events {
+		bus.Subscribe(name, service.Forward)
+	}
+	users := NewUserHandler(models.NewUserService(models.WithEvents(bus)), authService, zap.NewNop())
+	router := gin.New()
+	router.Use(middleware.AuthRequired(authService))
+	router.POST("/users", users.CreateUser)
+	router.DELETE("/users/:id", users.DeleteUser)
+	router.POST("/webhooks", h.CreateWebhook)
+	router.GET("/webhooks", h.ListWebhooks)
+	router.GET("/webhooks/deliveries", h.ListWebhookDeliveries)
+	router.DELETE("/webhooks/:webhook_id", h.DeleteWebhook)
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do(http.MethodPost, "/webhooks", `{"url":"`+receiver.URL+`","events":["user.updated"]}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("unknown event: status = %d, want 422", w.Code)
+	}
+	w := do(http.MethodPost, "/webhooks", `{"url":"`+receiver.URL+`","events":["user.created","user.deleted"]}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: status = %d: %s", w.Code, w.Body.String())
+	}
+	var created CreateWebhookResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil || created.Secret == "" {
+		t.Fatalf("create body = %s", w.Body.String())
+	}
+	if w := do(http.MethodGet, "/webhooks", ""); strings.Contains(w.Body.String(), created.Secret) {
+		t.Error("listing exposes the signing secret")
+	}
+
+	w = do(http.MethodPost, "/users", `{"name":"Ivy","email":"ivy@example.com"}`)
+	var user models.User
+	if err := json.Unmarshal(w.Body.Bytes(), &user); err != nil || w.Code != http.StatusCreated {
+		t.Fatalf("create user: status = %d: %s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodDelete, fmt.Sprintf("/users/%d", user.ID), ""); w.Code != http.StatusNoContent {
+		t.Fatalf("delete user: status = %d: %s", w.Code, w.Body.String())
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	var deliveries []webhooks.Delivery
+	for {
+		w = do(http.MethodGet, "/webhooks/deliveries?limit=10", "")
+		deliveries = nil
+		if err := json.Unmarshal(w.Body.Bytes(), &deliveries); err != nil {
+			t.Fatalf("deliveries body = %s", w.Body.String())
+		}
+		if len(deliveries) == 2 && deliveries[0].Status == webhooks.StatusSucceeded && deliveries[1].Status == webhooks.StatusSucceeded {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("deliveries = %s, want two succeeded", w.Body.String())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if deliveries[0].Event != webhooks.EventUserDeleted || deliveries[1].Event != webhooks.EventUserCreated {
+		t.Errorf("deliveries = %+v, want user.deleted then user.created", deliveries)
+	}
+	mu.Lock()
+	if len(received) != 2 {
+		t.Errorf("receiver got %v, want two events", received)
+	}
+	mu.Unlock()
+
+	if w := do(http.MethodGet, "/webhooks/deliveries?limit=500", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("limit=500: status = %d, want 400", w.Code)
+	}
+	for _, want := range []int{http.StatusNoContent, http.StatusNotFound} {
+		if w := do(http.MethodDelete, "/webhooks/"+created.ID, ""); w.Code != want {
+			t.Errorf("delete: status = %d, want %d", w.Code, want)
+		}
+	}
+}
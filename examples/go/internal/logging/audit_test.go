@@ -0,0 +1,51 @@
+package logging
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestAuditRotatesAfterSizeThreshold(t *testing.T) {
+	dir := t.TempDir()
+	logger := NewAudit(AuditFile{Path: filepath.Join(dir, "audit.log"), MaxSizeMB: 1, MaxBackups: 5})
+
+	// Write well over 1MB from several goroutines at once so rotation runs
+	// while other writes are in flight.
+	payload := strings.Repeat("x", 1024)
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 400; i++ {
+				logger.Info("User updated", zap.String("payload", payload))
+			}
+		}()
+	}
+	wg.Wait()
+	if err := logger.Sync(); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("read dir: %v", err)
+	}
+	if len(entries) < 2 {
+		t.Fatalf("found %d files, want the active log plus at least one rotated file", len(entries))
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() > 1<<20 {
+			t.Errorf("%s is %d bytes, over the 1MB threshold", entry.Name(), info.Size())
+		}
+	}
+}
@@ -0,0 +1,26 @@
+// Package logging provides the zap loggers used by the API
+package logging
+
+import (
+	"os"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Bootstrap returns a JSON logger writing to stderr. It is used before the
+// configured application logger has been built so that failures during
+// startup (config loading, logger construction) are still structured.
+func Bootstrap() *zap.Logger {
+	return newBootstrap(zapcore.Lock(os.Stderr))
+}
+
+func newBootstrap(out zapcore.WriteSyncer) *zap.Logger {
+	encoderConfig := zap.NewProductionEncoderConfig()
+	encoderConfig.TimeKey = "timestamp"
+	encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+
+	core := zapcore.NewCore(zapcore.NewJSONEncoder(encoderConfig), out, zap.InfoLevel)
+
+	return zap.New(core).With(zap.String("phase", "bootstrap"))
+}
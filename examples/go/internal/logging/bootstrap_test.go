@@ -0,0 +1,41 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestBootstrapLoggerWritesStructuredJSON(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newBootstrap(zapcore.AddSync(&buf))
+
+	logger.Error("Failed to initialize logger", zap.Error(errors.New("bad level")))
+	if err := logger.Sync(); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(bytes.TrimSpace(buf.Bytes()), &entry); err != nil {
+		t.Fatalf("bootstrap output is not JSON: %v (%q)", err, buf.String())
+	}
+
+	want := map[string]string{
+		"level": "error",
+		"msg":   "Failed to initialize logger",
+		"error": "bad level",
+		"phase": "bootstrap",
+	}
+	for key, value := range want {
+		if entry[key] != value {
+			t.Errorf("%s = %v, want %q", key, entry[key], value)
+		}
+	}
+	if _, ok := entry["timestamp"]; !ok {
+		t.Error("expected timestamp field")
+	}
+}
@@ -0,0 +1,27 @@
+package logging
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+
+	"github.com/cbwinslow/template2/examples/go/pkg/events"
+)
+
+// AuditEvents returns an events.Handler writing an audit record to audit for
+// each login, failed login and password reset, with the event name as the
+// action. User changes are audited by the handlers making them, which know
+// the actor, so other events are ignored.
+func AuditEvents(audit *zap.Logger) events.Handler {
+	return func(_ context.Context, e events.Event) error {
+		switch e := e.(type) {
+		case events.LoginSucceeded:
+			audit.Info("Audit", zap.String("action", e.EventName()), zap.Int("target_id", e.UserID), zap.String("session_id", e.SessionID))
+		case events.LoginFailed:
+			audit.Info("Audit", zap.String("action", e.EventName()), zap.Int("target_id", e.UserID))
+		case events.PasswordReset:
+			audit.Info("Audit", zap.String("action", e.EventName()), zap.Int("target_id", e.UserID))
+		}
+		return nil
+	}
+}
@@ -0,0 +1,36 @@
+package logging
+
+import (
+	"context"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/cbwinslow/template2/examples/go/pkg/events"
+)
+
+func TestAuditEventsRecordsAuthEvents(t *testing.T) {
+	trail := NewAuditTrail(10)
+	audit := AuditEvents(zap.New(trail.Core()))
+	ctx := context.Background()
+	for _, e := range []events.Event{
+		events.LoginFailed{UserID: 3},
+		events.UserCreated{UserID: 4},
+		events.LoginSucceeded{UserID: 3, SessionID: "s1"},
+	} {
+		if err := audit(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	records := trail.Records(AuditQuery{})
+	if len(records) != 2 {
+		t.Fatalf("records = %+v, want the two auth events", records)
+	}
+	if records[0].Action != events.NameLoginSucceeded || records[0].TargetID != 3 || records[0].Fields["session_id"] != "s1" {
+		t.Errorf("newest record = %+v", records[0])
+	}
+	if records[1].Action != events.NameLoginFailed {
+		t.Errorf("oldest record = %+v, want a failed login", records[1])
+	}
+}
@@ -0,0 +1,72 @@
+package logging
+
+import (
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// Config describes the application logger
+type Config struct {
+	// Level is the initial minimum level; it can be changed at runtime
+	// through the returned AtomicLevel
+	Level string
+	// Development writes colored console lines with stack traces from
+	// warnings on, instead of JSON
+	Development bool
+	// SamplingInitial entries with the same level and message are written
+	// each second, then only every SamplingThereafter-th. Zero
+	// SamplingInitial writes every entry.
+	SamplingInitial    int
+	SamplingThereafter int
+	// File, if set, receives every entry as well as stderr, rotated by size
+	// and pruned by count and age as the audit file is
+	File AuditFile
+}
+
+// New builds the application logger from cfg. The returned level controls
+// it, so operators may turn on debug logging without a restart.
+func New(cfg Config) (*zap.Logger, zap.AtomicLevel, error) {
+	lvl, err := zapcore.ParseLevel(cfg.Level)
+	if err != nil {
+		return nil, zap.AtomicLevel{}, err
+	}
+	level := zap.NewAtomicLevelAt(lvl)
+
+	out := zapcore.Lock(os.Stderr)
+	if cfg.File.Path != "" {
+		out = zapcore.NewMultiWriteSyncer(out, zapcore.AddSync(&lumberjack.Logger{
+			Filename:   cfg.File.Path,
+			MaxSize:    cfg.File.MaxSizeMB,
+			MaxBackups: cfg.File.MaxBackups,
+			MaxAge:     cfg.File.MaxAgeDays,
+		}))
+	}
+	return newLogger(cfg, level, out), level, nil
+}
+
+func newLogger(cfg Config, level zap.AtomicLevel, out zapcore.WriteSyncer) *zap.Logger {
+	opts := []zap.Option{zap.AddCaller(), zap.ErrorOutput(zapcore.Lock(os.Stderr))}
+	var encoder zapcore.Encoder
+	if cfg.Development {
+		encoderConfig := zap.NewDevelopmentEncoderConfig()
+		encoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
+		encoder = zapcore.NewConsoleEncoder(encoderConfig)
+		opts = append(opts, zap.Development(), zap.AddStacktrace(zap.WarnLevel))
+	} else {
+		encoderConfig := zap.NewProductionEncoderConfig()
+		encoderConfig.TimeKey = "timestamp"
+		encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+		encoderConfig.StacktraceKey = ""
+		encoder = zapcore.NewJSONEncoder(encoderConfig)
+	}
+
+	core := zapcore.NewCore(encoder, out, level)
+	if cfg.SamplingInitial > 0 {
+		core = zapcore.NewSamplerWithOptions(core, time.Second, cfg.SamplingInitial, cfg.SamplingThereafter)
+	}
+	return zap.New(core, opts...)
+}
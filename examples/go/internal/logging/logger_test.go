@@ -0,0 +1,37 @@
+package logging
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestLoggerSamplesAndFollowsLevel(t *testing.T) {
+	var buf bytes.Buffer
+	level := zap.NewAtomicLevelAt(zap.InfoLevel)
+	logger := newLogger(Config{SamplingInitial: 2, SamplingThereafter: 3}, level, zapcore.AddSync(&buf))
+
+	for i := 0; i < 8; i++ {
+		logger.Info("Request served")
+	}
+	// The first two, then the fifth and the eighth
+	if n := strings.Count(buf.String(), "Request served"); n != 4 {
+		t.Errorf("sampled entries = %d, want 4", n)
+	}
+
+	logger.Debug("Cache miss")
+	level.SetLevel(zap.DebugLevel)
+	logger.Debug("Cache hit")
+	if strings.Contains(buf.String(), "Cache miss") || !strings.Contains(buf.String(), "Cache hit") {
+		t.Errorf("debug entries before and after lowering the level: %s", buf.String())
+	}
+}
+
+func TestNewRejectsUnknownLevel(t *testing.T) {
+	if _, _, err := New(Config{Level: "verbose"}); err == nil {
+		t.Error("want an error for an unknown level")
+	}
+}
@@ -0,0 +1,129 @@
+package logging
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+
+	"github.com/cbwinslow/template2/examples/go/pkg/audit"
+)
+
+// AuditRecord is one entry of an AuditTrail
+type AuditRecord = audit.Record
+
+// AuditQuery selects records from an AuditTrail; zero fields match any
+// record
+type AuditQuery = audit.Query
+
+// AuditTrail keeps the most recent audit records in memory so they can be
+// served back to admins. Log to it through a logger built on Core, teed with
+// the audit file if there is one; older records remain only in the file.
+// It is the audit.Store used when records are not kept in the database.
+type AuditTrail struct {
+	mu      sync.Mutex
+	records []AuditRecord
+	// next is where the following record goes once records is full
+	next int
+	size int
+}
+
+// NewAuditTrail creates a trail holding the last size records
+func NewAuditTrail(size int) *AuditTrail {
+	return &AuditTrail{records: make([]AuditRecord, 0, size), size: size}
+}
+
+// Core returns a zap core appending every entry it is given to the trail
+func (t *AuditTrail) Core() zapcore.Core {
+	return audit.Core(t)
+}
+
+// Records returns the records matching q, newest first
+func (t *AuditTrail) Records(q AuditQuery) []AuditRecord {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	matched := []AuditRecord{}
+	for i := range t.records {
+		// Walk back from the newest record, which sits just before next
+		record := t.records[(t.next-1-i+2*len(t.records))%len(t.records)]
+		if q.Matches(record) {
+			matched = append(matched, record)
+			if q.Limit > 0 && len(matched) == q.Limit {
+				break
+			}
+		}
+	}
+	return matched
+}
+
+// Query implements audit.Store
+func (t *AuditTrail) Query(_ context.Context, q AuditQuery) ([]AuditRecord, error) {
+	return t.Records(q), nil
+}
+
+// Append implements audit.Store
+func (t *AuditTrail) Append(_ context.Context, record AuditRecord) error {
+	t.add(record)
+	return nil
+}
+
+// Prune implements audit.Store
+func (t *AuditTrail) Prune(_ context.Context, before time.Time) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// Rebuild oldest first, so next is back at the end of the kept records
+	kept := make([]AuditRecord, 0, t.size)
+	for i := range t.records {
+		record := t.records[(t.next+i)%len(t.records)]
+		if !record.Time.Before(before) {
+			kept = append(kept, record)
+		}
+	}
+	removed := len(t.records) - len(kept)
+	t.records = kept
+	t.next = 0
+	if t.size > 0 {
+		t.next = len(kept) % t.size
+	}
+	return removed, nil
+}
+
+// Reassign implements audit.Store
+func (t *AuditTrail) Reassign(_ context.Context, from, to int) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	changed := 0
+	for i := range t.records {
+		record := &t.records[i]
+		if record.ActorID != from && record.TargetID != from {
+			continue
+		}
+		if record.ActorID == from {
+			record.ActorID = to
+		}
+		if record.TargetID == from {
+			record.TargetID = to
+		}
+		changed++
+	}
+	return changed, nil
+}
+
+func (t *AuditTrail) add(record AuditRecord) {
+	if t.size <= 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.records) < t.size {
+		t.records = append(t.records, record)
+		t.next = len(t.records) % t.size
+		return
+	}
+	t.records[t.next] = record
+	t.next = (t.next + 1) % t.size
+}
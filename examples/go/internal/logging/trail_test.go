@@ -0,0 +1,59 @@
+package logging
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestAuditTrailKeepsNewestRecords(t *testing.T) {
+	trail := NewAuditTrail(3)
+	logger := zap.New(trail.Core()).With(zap.String("log", "audit"))
+	for i := 1; i <= 5; i++ {
+		logger.Info("Audit", zap.String("action", "user.update"), zap.Int("target_id", i), zap.Int("actor_id", 1))
+	}
+	logger.Info("Audit", zap.String("action", "user.lock"), zap.Int("target_id", 4), zap.Int("actor_id", 2))
+
+	records := trail.Records(AuditQuery{})
+	var targets []int
+	for _, record := range records {
+		targets = append(targets, record.TargetID)
+	}
+	if len(targets) != 3 || targets[0] != 4 || targets[1] != 5 || targets[2] != 4 {
+		t.Fatalf("targets = %v, want the newest three [4 5 4]", targets)
+	}
+	if records[0].Action != "user.lock" || records[0].ActorID != 2 || records[0].Fields["log"] != "audit" {
+		t.Errorf("newest record = %+v", records[0])
+	}
+
+	if got := trail.Records(AuditQuery{TargetID: 4}); len(got) != 2 {
+		t.Errorf("target 4: %d records, want 2", len(got))
+	}
+	if got := trail.Records(AuditQuery{Action: "user.update", Limit: 1}); len(got) != 1 || got[0].TargetID != 5 {
+		t.Errorf("latest update = %+v, want target 5", got)
+	}
+}
+
+func TestAuditTrailPrune(t *testing.T) {
+	trail := NewAuditTrail(3)
+	now := time.Now()
+	for i := 1; i <= 4; i++ {
+		trail.Append(context.Background(), AuditRecord{Time: now.Add(time.Duration(i) * time.Hour), Action: "user.update", TargetID: i})
+	}
+
+	removed, err := trail.Prune(context.Background(), now.Add(3*time.Hour))
+	if err != nil || removed != 1 {
+		t.Fatalf("Prune = %d, %v; want the record of target 2 removed", removed, err)
+	}
+	trail.Append(context.Background(), AuditRecord{Time: now.Add(5 * time.Hour), Action: "user.lock", TargetID: 5})
+
+	var targets []int
+	for _, record := range trail.Records(AuditQuery{}) {
+		targets = append(targets, record.TargetID)
+	}
+	if len(targets) != 3 || targets[0] != 5 || targets[1] != 4 || targets[2] != 3 {
+		t.Errorf("targets = %v, want [5 4 3]", targets)
+	}
+}
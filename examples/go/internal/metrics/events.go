@@ -0,0 +1,24 @@
+package metrics
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/cbwinslow/template2/examples/go/pkg/events"
+)
+
+// CountEvents registers a counter of domain events by name with registerer
+// and returns the events.Handler incrementing it
+func CountEvents(registerer prometheus.Registerer) events.Handler {
+	published := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "domain_events_total",
+		Help: "Domain events published, by event.",
+	}, []string{"event"})
+	registerer.MustRegister(published)
+
+	return func(_ context.Context, e events.Event) error {
+		published.WithLabelValues(e.EventName()).Inc()
+		return nil
+	}
+}
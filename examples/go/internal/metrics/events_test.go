@@ -0,0 +1,31 @@
+package metrics
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/cbwinslow/template2/examples/go/pkg/events"
+)
+
+func TestCountEvents(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	count := CountEvents(registry)
+	ctx := context.Background()
+	_ = count(ctx, events.LoginFailed{UserID: 3})
+	_ = count(ctx, events.LoginFailed{UserID: 3})
+	_ = count(ctx, events.UserCreated{UserID: 4})
+
+	want := `
+# HELP domain_events_total Domain events published, by event.
+# TYPE domain_events_total counter
+domain_events_total{event="auth.login_failed"} 2
+domain_events_total{event="user.created"} 1
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(want), "domain_events_total"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,47 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandlerNegotiatesExpositionFormat(t *testing.T) {
+	handler := Handler(NewRegistry())
+
+	cases := []struct {
+		accept      string
+		contentType string
+	}{
+		{"", "text/plain; version=0.0.4"},
+		{"application/openmetrics-text; version=1.0.0", "application/openmetrics-text; version=1.0.0"},
+	}
+
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		if tc.accept != "" {
+			req.Header.Set("Accept", tc.accept)
+		}
+		handler.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Accept %q: status = %d", tc.accept, w.Code)
+		}
+		if got := w.Header().Get("Content-Type"); !strings.HasPrefix(got, tc.contentType) {
+			t.Errorf("Accept %q: Content-Type = %q, want prefix %q", tc.accept, got, tc.contentType)
+		}
+	}
+}
+
+func TestHandlerOpenMetricsEndsWithEOF(t *testing.T) {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text")
+	Handler(NewRegistry()).ServeHTTP(w, req)
+
+	if !strings.HasSuffix(w.Body.String(), "# EOF\n") {
+		t.Error("OpenMetrics exposition should end with # EOF")
+	}
+}
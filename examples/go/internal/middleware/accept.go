@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+)
+
+const negotiatedTypeKey = "negotiated_type"
+
+// Accept rejects requests whose Accept header cannot be satisfied by any of
+// the supported media types with 406 Not Acceptable. A missing header is
+// treated as */*. The first supported type is used as the default when the
+// client accepts anything.
+func Accept(supported ...string) gin.HandlerFunc {
+	return AcceptRoutes(supported, nil)
+}
+
+// AcceptRoutes is Accept with the media types of some routes, such as those
+// serving images, looked up in routes by "METHOD /route/pattern" and then by
+// "/route/pattern" in place of supported
+func AcceptRoutes(supported []string, routes map[string][]string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		supported := supported
+		if types, ok := routeOverride(c, routes); ok {
+			supported = types
+		}
+		mediaType, ok := negotiate(c.GetHeader("Accept"), supported)
+		if !ok {
+			AbortWithError(c, models.NewError(http.StatusNotAcceptable, models.CodeNotAcceptable, "None of the requested media types can be produced").
+				WithDetails(map[string]interface{}{"supported": supported}))
+			return
+		}
+
+		c.Set(negotiatedTypeKey, mediaType)
+		c.Next()
+	}
+}
+
+// NegotiatedType returns the media type selected by the Accept middleware,
+// or an empty string if the middleware did not run
+func NegotiatedType(c *gin.Context) string {
+	return c.GetString(negotiatedTypeKey)
+}
+
+// negotiate picks the supported type with the highest client preference
+func negotiate(header string, supported []string) (string, bool) {
+	if strings.TrimSpace(header) == "" {
+		return supported[0], true
+	}
+
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(header, ",") {
+		mediaRange, q := parseMediaRange(part)
+		if q <= 0 {
+			continue
+		}
+		for _, candidate := range supported {
+			if q > bestQ && mediaMatches(mediaRange, candidate) {
+				best, bestQ = candidate, q
+			}
+		}
+	}
+
+	return best, best != ""
+}
+
+func parseMediaRange(part string) (string, float64) {
+	params := strings.Split(part, ";")
+	mediaRange := strings.ToLower(strings.TrimSpace(params[0]))
+	q := 1.0
+	for _, param := range params[1:] {
+		key, value, found := strings.Cut(strings.TrimSpace(param), "=")
+		if found && strings.EqualFold(key, "q") {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+	}
+	return mediaRange, q
+}
+
+func mediaMatches(mediaRange, candidate string) bool {
+	if mediaRange == "*/*" || mediaRange == candidate {
+		return true
+	}
+	if prefix, ok := strings.CutSuffix(mediaRange, "/*"); ok {
+		return strings.HasPrefix(candidate, prefix+"/")
+	}
+	return false
+}
@@ -0,0 +1,109 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+	"github.com/cbwinslow/template2/examples/go/pkg/apierror"
+)
+
+func newAcceptRouter() *gin.Engine {
+	router := gin.New()
+	router.Use(Accept("application/json", "text/csv", "application/x-ndjson"))
+	router.GET("/users", func(c *gin.Context) {
+		c.String(http.StatusOK, NegotiatedType(c))
+	})
+	return router
+}
+
+func TestAcceptRejectsUnsupportedType(t *testing.T) {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/users", nil)
+	req.Header.Set("Accept", "application/xml")
+	newAcceptRouter().ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotAcceptable {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusNotAcceptable)
+	}
+
+	var body apierror.Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	if body.Code != string(models.CodeNotAcceptable) {
+		t.Errorf("code = %q, want %q", body.Code, models.CodeNotAcceptable)
+	}
+	supported, _ := body.Details["supported"].([]interface{})
+	if len(supported) != 3 {
+		t.Errorf("supported = %v, want the 3 supported types", body.Details["supported"])
+	}
+}
+
+func TestAcceptNegotiatesSupportedTypes(t *testing.T) {
+	cases := map[string]string{
+		"":                                   "application/json",
+		"*/*":                                "application/json",
+		"text/*":                             "text/csv",
+		"application/x-ndjson":               "application/x-ndjson",
+		"application/xml, text/csv;q=0.5":    "text/csv",
+		"application/json;q=0.2, text/csv":   "text/csv",
+		"text/csv;q=0, application/json;q=1": "application/json",
+	}
+
+	router := newAcceptRouter()
+	for accept, want := range cases {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/users", nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK || w.Body.String() != want {
+			t.Errorf("Accept %q: got %d %q, want 200 %q", accept, w.Code, w.Body.String(), want)
+		}
+	}
+}
+
+func TestAcceptRoutesNegotiatePerRoute(t *testing.T) {
+	router := gin.New()
+	router.Use(AcceptRoutes([]string{"application/json"}, map[string][]string{
+		"GET /users/:id/avatar": {"image/png", "image/jpeg"},
+	}))
+	handler := func(c *gin.Context) {
+		c.String(http.StatusOK, NegotiatedType(c))
+	}
+	router.GET("/users/:id", handler)
+	router.GET("/users/:id/avatar", handler)
+
+	tests := []struct {
+		path, accept string
+		want         int
+		wantType     string
+	}{
+		{"/users/1/avatar", "image/png", http.StatusOK, "image/png"},
+		{"/users/1/avatar", "image/*", http.StatusOK, "image/png"},
+		{"/users/1/avatar", "image/webp, image/jpeg;q=0.8", http.StatusOK, "image/jpeg"},
+		{"/users/1/avatar", "application/json", http.StatusNotAcceptable, ""},
+		{"/users/1", "image/png", http.StatusNotAcceptable, ""},
+		{"/users/1", "", http.StatusOK, "application/json"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		req.Header.Set("Accept", tt.accept)
+		router.ServeHTTP(w, req)
+
+		if w.Code != tt.want {
+			t.Errorf("%s with %q: status = %d, want %d", tt.path, tt.accept, w.Code, tt.want)
+		}
+		if tt.want == http.StatusOK && w.Body.String() != tt.wantType {
+			t.Errorf("%s with %q: negotiated %q, want %q", tt.path, tt.accept, w.Body.String(), tt.wantType)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/cbwinslow/template2/examples/go/pkg/auth"
+)
+
+func TestAuthRequiredAcceptsAPIKeys(t *testing.T) {
+	resolve := func(ctx context.Context, key string) (*auth.Claims, error) {
+		if key != "tk_good" {
+			return nil, errors.New("unknown key")
+		}
+		return &auth.Claims{UserID: 9, Role: "user"}, nil
+	}
+
+	cases := []struct {
+		name string
+		opts []AuthOption
+		key  string
+		want int
+	}{
+		{"valid key", []AuthOption{WithAPIKeys(resolve)}, "tk_good", http.StatusOK},
+		{"invalid key", []AuthOption{WithAPIKeys(resolve)}, "tk_bad", http.StatusUnauthorized},
+		{"keys not enabled", nil, "tk_good", http.StatusUnauthorized},
+	}
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/profile", nil)
+		req.Header.Set(APIKeyHeader, tc.key)
+		newAuthRouter(auth.NewAuthService(), tc.opts...).ServeHTTP(w, req)
+
+		if w.Code != tc.want {
+			t.Errorf("%s: status = %d, want %d", tc.name, w.Code, tc.want)
+		}
+		if tc.want == http.StatusOK && w.Body.String() != "9" {
+			t.Errorf("%s: user ID = %s, want 9", tc.name, w.Body.String())
+		}
+	}
+}
+
+func TestDenyAPIKeysAllowsOnlyTokens(t *testing.T) {
+	svc := auth.NewAuthService()
+	token, _ := svc.GenerateToken(context.Background(), 9, "kim@example.com", "user")
+	resolve := func(ctx context.Context, key string) (*auth.Claims, error) {
+		return &auth.Claims{UserID: 9, Role: "user"}, nil
+	}
+	router := gin.New()
+	router.Use(AuthRequired(svc, WithAPIKeys(resolve)), DenyAPIKeys())
+	router.POST("/api-keys", func(c *gin.Context) { c.Status(http.StatusCreated) })
+
+	cases := []struct {
+		name   string
+		header string
+		value  string
+		want   int
+	}{
+		{"bearer token", "Authorization", "Bearer " + token, http.StatusCreated},
+		{"api key", APIKeyHeader, "tk_good", http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api-keys", nil)
+		req.Header.Set(tc.header, tc.value)
+		router.ServeHTTP(w, req)
+		if w.Code != tc.want {
+			t.Errorf("%s: status = %d, want %d", tc.name, w.Code, tc.want)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// auditedKey marks a request whose handler wrote its own audit record
+const auditedKey = "audited"
+
+// MarkAudited tells AuditWrites that the handler has audited the request
+// itself, usually with a more specific action and the changes it made
+func MarkAudited(c *gin.Context) {
+	c.Set(auditedKey, true)
+}
+
+// AuditWrites writes an audit record to audit for each successful POST,
+// PUT, PATCH and DELETE of an authenticated caller that the handler did not
+// audit itself, so every write is accounted for. The action is the method
+// and route, such as "DELETE /api/v1/protected/webhooks/:webhook_id", and
+// the target the path requested.
+func AuditWrites(audit *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		switch c.Request.Method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		default:
+			return
+		}
+		actorID, ok := GetUserID(c)
+		if !ok || c.Writer.Status() >= http.StatusBadRequest || c.GetBool(auditedKey) {
+			return
+		}
+		audit.Info("Audit",
+			zap.String("action", c.Request.Method+" "+c.FullPath()),
+			zap.Int("actor_id", actorID),
+			zap.String("target", c.Request.URL.Path),
+			zap.String("ip", c.ClientIP()),
+			zap.String("request_id", GetRequestID(c)),
+			zap.Int("status", c.Writer.Status()))
+	}
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestAuditWritesRecordsUnauditedWrites(t *testing.T) {
+	core, records := observer.New(zap.InfoLevel)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		if c.GetHeader("X-User") != "" {
+			c.Set(userIDKey, 7)
+		}
+	}, AuditWrites(zap.New(core)))
+	router.GET("/hooks", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.DELETE("/hooks/:id", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	router.POST("/hooks", func(c *gin.Context) { c.Status(http.StatusBadRequest) })
+	router.PUT("/users/:id", func(c *gin.Context) {
+		MarkAudited(c)
+		c.Status(http.StatusOK)
+	})
+
+	for _, tt := range []struct {
+		method, path string
+		user         bool
+	}{
+		{http.MethodDelete, "/hooks/3", true},
+		{http.MethodDelete, "/hooks/4", false},
+		{http.MethodGet, "/hooks", true},
+		{http.MethodPost, "/hooks", true},
+		{http.MethodPut, "/users/3", true},
+	} {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		if tt.user {
+			req.Header.Set("X-User", "7")
+		}
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	entries := records.All()
+	if len(entries) != 1 {
+		t.Fatalf("audit records = %d, want only the authenticated, unaudited, successful DELETE", len(entries))
+	}
+	fields := entries[0].ContextMap()
+	if fields["action"] != "DELETE /hooks/:id" || fields["target"] != "/hooks/3" || fields["actor_id"] != int64(7) {
+		t.Errorf("record fields = %v", fields)
+	}
+}
@@ -0,0 +1,282 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+	"github.com/cbwinslow/template2/examples/go/pkg/auth"
+)
+
+const (
+	emailKey  = "email"
+	roleKey   = "role"
+	claimsKey = "claims"
+)
+
+// WebSocketTokenProtocol prefixes the access token when a browser passes it
+// as a Sec-WebSocket-Protocol entry ("bearer.<token>"), since browsers cannot
+// set Authorization on a WebSocket handshake. Handlers that accept the
+// upgrade must not echo this entry back as the selected subprotocol.
+const WebSocketTokenProtocol = "bearer."
+
+// webSocketTokenParam is the query parameter read on WebSocket handshakes
+const webSocketTokenParam = "access_token"
+
+// TokenValidator verifies access tokens
+type TokenValidator interface {
+	ValidateToken(ctx context.Context, token string) (*auth.Claims, error)
+}
+
+// AuthOption configures AuthRequired
+type AuthOption func(*authOptions)
+
+type authOptions struct {
+	cookieName   string
+	session      *sessionCookie
+	verifiedCert CertPrincipalResolver
+	clientCert   *clientCertOptions
+	apiKeys      APIKeyResolver
+	verified     EmailVerifiedFunc
+	denied       SessionDeniedFunc
+	anonymous    bool
+}
+
+// WithTokenCookie makes AuthRequired fall back to the token stored in the
+// named cookie when the Authorization header is absent
+func WithTokenCookie(name string) AuthOption {
+	return func(o *authOptions) {
+		o.cookieName = name
+	}
+}
+
+// SessionTokenFunc returns the access token of the server-side session a
+// session cookie names
+type SessionTokenFunc func(c *gin.Context, sessionID string) (string, error)
+
+type sessionCookie struct {
+	name  string
+	token SessionTokenFunc
+}
+
+// WithSessionCookie makes AuthRequired accept the session cookie called
+// name when the request has no Authorization header. The session's access
+// token is then checked like a bearer token, so revoked sessions and tokens
+// are rejected the same way.
+func WithSessionCookie(name string, token SessionTokenFunc) AuthOption {
+	return func(o *authOptions) {
+		o.session = &sessionCookie{name: name, token: token}
+	}
+}
+
+// AllowAnonymous lets requests presenting no credentials at all through
+// without claims, for endpoints that decide per operation what needs a
+// user. Credentials that are presented are still checked, and invalid ones
+// rejected with 401.
+func AllowAnonymous() AuthOption {
+	return func(o *authOptions) {
+		o.anonymous = true
+	}
+}
+
+// AuthRequired rejects requests without a valid bearer token with 401 and
+// stores the token's user ID, email, role and claims in the context. For
+// WebSocket handshakes the token may also come from a "bearer.<token>"
+// Sec-WebSocket-Protocol entry or the access_token query parameter; an
+// unauthenticated handshake is rejected before it is upgraded.
+func AuthRequired(tokens TokenValidator, opts ...AuthOption) gin.HandlerFunc {
+	var options authOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	return func(c *gin.Context) {
+		if options.verifiedCert != nil {
+			if cert, ok := verifiedClientCert(c); ok {
+				claims, err := options.verifiedCert(c.Request.Context(), cert.Subject.CommonName)
+				if err != nil {
+					AbortWithError(c, certError(err))
+					return
+				}
+				c.Set(clientCertKey, cert)
+				authenticate(c, options, claims)
+				return
+			}
+		}
+		if options.clientCert != nil {
+			if cn, ok := clientCertCommonName(c, options.clientCert); ok {
+				claims, err := options.clientCert.resolve(c.Request.Context(), cn)
+				if err != nil {
+					AbortWithError(c, certError(err))
+					return
+				}
+				authenticate(c, options, claims)
+				return
+			}
+		}
+
+		if key := c.GetHeader(APIKeyHeader); key != "" && options.apiKeys != nil {
+			claims, err := options.apiKeys(c.Request.Context(), key)
+			if err != nil {
+				AbortWithError(c, models.NewError(http.StatusUnauthorized, models.CodeTokenInvalid, "Invalid API key"))
+				return
+			}
+			c.Set(apiKeyAuthKey, true)
+			authenticate(c, options, claims)
+			return
+		}
+
+		token, ok := bearerToken(c, options)
+		if !ok && options.session != nil && c.GetHeader("Authorization") == "" {
+			if id, err := c.Cookie(options.session.name); err == nil && id != "" {
+				if token, err = options.session.token(c, id); err != nil {
+					AbortWithError(c, models.NewError(http.StatusUnauthorized, models.CodeTokenInvalid, "Session expired or signed out"))
+					return
+				}
+				ok = true
+			}
+		}
+		if !ok && options.anonymous && c.GetHeader("Authorization") == "" {
+			c.Next()
+			return
+		}
+		if !ok {
+			c.Header("WWW-Authenticate", `Bearer realm="api"`)
+			AbortWithError(c, models.NewError(http.StatusUnauthorized, models.CodeUnauthorized, "Authentication required"))
+			return
+		}
+
+		claims, err := tokens.ValidateToken(c.Request.Context(), token)
+		if err != nil {
+			c.Header("WWW-Authenticate", `Bearer realm="api", error="invalid_token"`)
+			AbortWithError(c, models.NewError(http.StatusUnauthorized, models.CodeTokenInvalid, "Invalid or expired token"))
+			return
+		}
+		if options.denied != nil && claims.SessionID != "" {
+			denied, err := options.denied(c.Request.Context(), claims.SessionID)
+			if err != nil {
+				AbortWithError(c, models.NewError(http.StatusInternalServerError, models.CodeInternal, "Could not check token revocation"))
+				return
+			}
+			if denied {
+				c.Header("WWW-Authenticate", `Bearer realm="api", error="invalid_token"`)
+				AbortWithError(c, models.NewError(http.StatusUnauthorized, models.CodeTokenInvalid, "Session has been signed out"))
+				return
+			}
+		}
+
+		authenticate(c, options, claims)
+	}
+}
+
+// authenticate stores claims in the context and continues the chain,
+// unless WithVerifiedEmail is set and the user has not verified their email
+func authenticate(c *gin.Context, options authOptions, claims *auth.Claims) {
+	if options.verified != nil {
+		verified, err := options.verified(c.Request.Context(), claims.UserID)
+		if err != nil {
+			AbortWithError(c, models.NewError(http.StatusInternalServerError, models.CodeInternal, "Could not check email verification"))
+			return
+		}
+		if !verified {
+			AbortWithError(c, models.NewError(http.StatusForbidden, models.CodeEmailUnverified, "Verify your email address to use this resource"))
+			return
+		}
+	}
+
+	setClaims(c, claims)
+	c.Next()
+}
+
+func setClaims(c *gin.Context, claims *auth.Claims) {
+	c.Set(userIDKey, claims.UserID)
+	c.Set(emailKey, claims.Email)
+	c.Set(roleKey, claims.Role)
+	c.Set(claimsKey, claims)
+}
+
+// RequireRole rejects authenticated requests whose token role is not one of
+// roles with 403. It must run after AuthRequired.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := c.GetString(roleKey)
+		for _, allowed := range roles {
+			if role == allowed {
+				c.Next()
+				return
+			}
+		}
+
+		AbortWithError(c, models.NewError(http.StatusForbidden, models.CodeForbidden, "Insufficient role for this resource"))
+	}
+}
+
+// RequirePermission rejects authenticated requests whose token role does not
+// grant permission with 403. It must run after AuthRequired.
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if models.RoleHasPermission(c.GetString(roleKey), permission) {
+			c.Next()
+			return
+		}
+
+		AbortWithError(c, models.NewError(http.StatusForbidden, models.CodeForbidden, "Insufficient permissions for this resource").
+			WithDetails(map[string]interface{}{"required_permission": permission}))
+	}
+}
+
+// GetClaims returns the claims of the authenticated request's token
+func GetClaims(c *gin.Context) (*auth.Claims, bool) {
+	value, ok := c.Get(claimsKey)
+	if !ok {
+		return nil, false
+	}
+	claims, ok := value.(*auth.Claims)
+	return claims, ok
+}
+
+func bearerToken(c *gin.Context, options authOptions) (string, bool) {
+	if header := c.GetHeader("Authorization"); header != "" {
+		scheme, token, found := strings.Cut(header, " ")
+		if !found || !strings.EqualFold(scheme, "Bearer") || token == "" {
+			return "", false
+		}
+		return strings.TrimSpace(token), true
+	}
+
+	if isWebSocketUpgrade(c) {
+		if token, ok := webSocketToken(c); ok {
+			return token, true
+		}
+	}
+
+	if options.cookieName != "" {
+		if token, err := c.Cookie(options.cookieName); err == nil && token != "" {
+			return token, true
+		}
+	}
+
+	return "", false
+}
+
+func isWebSocketUpgrade(c *gin.Context) bool {
+	return strings.EqualFold(c.GetHeader("Upgrade"), "websocket")
+}
+
+func webSocketToken(c *gin.Context) (string, bool) {
+	for _, header := range c.Request.Header.Values("Sec-WebSocket-Protocol") {
+		for _, protocol := range strings.Split(header, ",") {
+			if token, ok := strings.CutPrefix(strings.TrimSpace(protocol), WebSocketTokenProtocol); ok && token != "" {
+				return token, true
+			}
+		}
+	}
+
+	if token := c.Query(webSocketTokenParam); token != "" {
+		return token, true
+	}
+	return "", false
+}
@@ -0,0 +1,174 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+	"github.com/cbwinslow/template2/examples/go/pkg/auth"
+)
+
+func newAuthRouter(svc *auth.AuthService, opts ...AuthOption) *gin.Engine {
+	router := gin.New()
+	router.Use(AuthRequired(svc, opts...))
+	router.GET("/profile", func(c *gin.Context) {
+		id, _ := GetUserID(c)
+		c.String(http.StatusOK, strconv.Itoa(id))
+	})
+	return router
+}
+
+func TestAuthRequiredAcceptsHeaderAndCookie(t *testing.T) {
+	svc := auth.NewAuthService()
+	token, _ := svc.GenerateToken(context.Background(), 5, "gina@example.com", "user")
+	router := newAuthRouter(svc, WithTokenCookie("access_token"))
+
+	requests := map[string]func(*http.Request){
+		"header": func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+token) },
+		"cookie": func(r *http.Request) { r.AddCookie(&http.Cookie{Name: "access_token", Value: token}) },
+	}
+	for name, authenticate := range requests {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/profile", nil)
+		authenticate(req)
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK || w.Body.String() != "5" {
+			t.Errorf("%s auth: got %d %q, want 200 for user 5", name, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestAuthRequiredIgnoresCookieUnlessEnabled(t *testing.T) {
+	svc := auth.NewAuthService()
+	token, _ := svc.GenerateToken(context.Background(), 5, "gina@example.com", "user")
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/profile", nil)
+	req.AddCookie(&http.Cookie{Name: "access_token", Value: token})
+	newAuthRouter(svc).ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want 401 when cookie auth is disabled", w.Code)
+	}
+}
+
+func TestAuthRequiredSessionCookie(t *testing.T) {
+	svc := auth.NewAuthService()
+	token, _ := svc.GenerateToken(context.Background(), 5, "gina@example.com", "user")
+	router := newAuthRouter(svc, WithSessionCookie("session", func(_ *gin.Context, id string) (string, error) {
+		if id != "s1" {
+			return "", errors.New("unknown session")
+		}
+		return token, nil
+	}))
+
+	for id, status := range map[string]int{"s1": http.StatusOK, "s2": http.StatusUnauthorized} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/profile", nil)
+		req.AddCookie(&http.Cookie{Name: "session", Value: id})
+		router.ServeHTTP(w, req)
+		if w.Code != status {
+			t.Errorf("session %s: status = %d, want %d", id, w.Code, status)
+		}
+	}
+}
+
+func TestAuthRequiredRejectsInvalidToken(t *testing.T) {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/profile", nil)
+	req.Header.Set("Authorization", "Bearer not-a-jwt")
+	newAuthRouter(auth.NewAuthService()).ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want 401", w.Code)
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	svc := auth.NewAuthService()
+	router := gin.New()
+	router.GET("/admin", AuthRequired(svc), RequireRole("admin"), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	for role, want := range map[string]int{"admin": http.StatusNoContent, "user": http.StatusForbidden} {
+		token, _ := svc.GenerateToken(context.Background(), 1, "alice@example.com", role)
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		router.ServeHTTP(w, req)
+
+		if w.Code != want {
+			t.Errorf("role %s: status = %d, want %d", role, w.Code, want)
+		}
+	}
+}
+
+func TestRequirePermission(t *testing.T) {
+	svc := auth.NewAuthService()
+	router := gin.New()
+	router.DELETE("/users/1", AuthRequired(svc), RequirePermission(models.PermUsersDelete), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	for role, want := range map[string]int{"admin": http.StatusNoContent, "user": http.StatusForbidden} {
+		token, _ := svc.GenerateToken(context.Background(), 1, "alice@example.com", role)
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodDelete, "/users/1", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		router.ServeHTTP(w, req)
+
+		if w.Code != want {
+			t.Errorf("role %s: status = %d, want %d", role, w.Code, want)
+		}
+	}
+}
+
+func TestAuthRequiredWebSocketHandshake(t *testing.T) {
+	svc := auth.NewAuthService()
+	token, _ := svc.GenerateToken(context.Background(), 7, "ivy@example.com", "user")
+	router := newAuthRouter(svc)
+
+	handshake := func(target string, protocols ...string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("Connection", "Upgrade")
+		req.Header.Set("Upgrade", "websocket")
+		req.Header.Set("Sec-WebSocket-Version", "13")
+		req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+		for _, p := range protocols {
+			req.Header.Add("Sec-WebSocket-Protocol", p)
+		}
+		return req
+	}
+
+	cases := map[string]struct {
+		req  *http.Request
+		want int
+	}{
+		"subprotocol":     {handshake("/profile", "chat, "+WebSocketTokenProtocol+token), http.StatusOK},
+		"query":           {handshake("/profile?access_token=" + token), http.StatusOK},
+		"unauthenticated": {handshake("/profile", "chat"), http.StatusUnauthorized},
+		"invalid":         {handshake("/profile", WebSocketTokenProtocol+"not-a-jwt"), http.StatusUnauthorized},
+	}
+	for name, tc := range cases {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, tc.req)
+		if w.Code != tc.want {
+			t.Errorf("%s: status = %d, want %d", name, w.Code, tc.want)
+		}
+	}
+
+	// The query parameter is only honored on handshakes
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/profile?access_token="+token, nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("plain request with query token: status = %d, want 401", w.Code)
+	}
+}
@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+)
+
+// bodyLimitKey holds the cap BodyLimit applied to the request
+const bodyLimitKey = "body_limit"
+
+// BodyLimitOption configures BodyLimit
+type BodyLimitOption func(*bodyLimitOptions)
+
+type bodyLimitOptions struct {
+	routes map[string]int64
+}
+
+// WithRouteBodyLimits overrides the cap for the routes in routes, keyed by
+// "METHOD /route/pattern" or "/route/pattern" as in Timeout. Limits may be
+// raised as well as lowered, e.g. for uploads.
+func WithRouteBodyLimits(routes map[string]int64) BodyLimitOption {
+	return func(o *bodyLimitOptions) {
+		o.routes = routes
+	}
+}
+
+// BodyLimit caps request bodies at maxBytes. A declared Content-Length over
+// the cap is rejected with 413 before anything is read, so a client waiting
+// on Expect: 100-continue never gets the go-ahead and does not send the
+// body; net/http only sends "100 Continue" once a handler starts reading,
+// and answers any other Expect value with 417 itself.
+// Bodies without a length are cut off at the cap and surface an
+// *http.MaxBytesError to whoever reads them.
+func BodyLimit(maxBytes int64, opts ...BodyLimitOption) gin.HandlerFunc {
+	var options bodyLimitOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	return func(c *gin.Context) {
+		maxBytes := maxBytes
+		if limit, ok := routeOverride(c, options.routes); ok {
+			maxBytes = limit
+		}
+		if c.Request.ContentLength > maxBytes {
+			// The unread body makes net/http close the connection afterwards
+			AbortWithError(c, models.NewError(http.StatusRequestEntityTooLarge, models.CodePayloadTooLarge, fmt.Sprintf("Request body exceeds %d bytes", maxBytes)).
+				WithDetails(map[string]interface{}{"max_bytes": maxBytes}))
+			return
+		}
+
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes)
+		c.Set(bodyLimitKey, maxBytes)
+		c.Next()
+	}
+}
@@ -0,0 +1,137 @@
+package middleware
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newBodyLimitServer(t *testing.T, maxBytes int64) *httptest.Server {
+	t.Helper()
+	router := gin.New()
+	router.Use(BodyLimit(maxBytes))
+	router.POST("/upload", func(c *gin.Context) {
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.Status(http.StatusRequestEntityTooLarge)
+			return
+		}
+		c.String(http.StatusOK, "%d", len(body))
+	})
+	srv := httptest.NewServer(router)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// sendExpectContinue writes the request headers with Expect: 100-continue
+// and returns the first status line the server answers with
+func sendExpectContinue(t *testing.T, srv *httptest.Server, length int) (net.Conn, *bufio.Reader, string) {
+	t.Helper()
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	fmt.Fprintf(conn, "POST /upload HTTP/1.1\r\nHost: test\r\nContent-Length: %d\r\nExpect: 100-continue\r\n\r\n", length)
+	r := bufio.NewReader(conn)
+	line, err := r.ReadString('\n')
+	if err != nil {
+		t.Fatalf("read status: %v", err)
+	}
+	return conn, r, strings.TrimSpace(line)
+}
+
+func TestBodyLimitRejectsOversizedUploadBeforeContinue(t *testing.T) {
+	srv := newBodyLimitServer(t, 1024)
+
+	_, _, status := sendExpectContinue(t, srv, 4096)
+	if status != "HTTP/1.1 413 Request Entity Too Large" {
+		t.Fatalf("first response = %q, want 413 without 100 Continue", status)
+	}
+}
+
+func TestBodyLimitContinuesAcceptedUpload(t *testing.T) {
+	srv := newBodyLimitServer(t, 1024)
+
+	conn, r, status := sendExpectContinue(t, srv, 512)
+	if status != "HTTP/1.1 100 Continue" {
+		t.Fatalf("first response = %q, want 100 Continue", status)
+	}
+	if _, err := r.ReadString('\n'); err != nil {
+		t.Fatalf("read blank line: %v", err)
+	}
+
+	if _, err := conn.Write([]byte(strings.Repeat("x", 512))); err != nil {
+		t.Fatalf("write body: %v", err)
+	}
+	resp, err := http.ReadResponse(r, nil)
+	if err != nil {
+		t.Fatalf("read response: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "512" {
+		t.Errorf("response = %d %q, want 200 \"512\"", resp.StatusCode, body)
+	}
+}
+
+func TestBodyLimitCapsChunkedBody(t *testing.T) {
+	srv := newBodyLimitServer(t, 1024)
+
+	// A reader without a known length makes the client send it chunked
+	body := io.MultiReader(strings.NewReader(strings.Repeat("x", 4096)))
+	resp, err := http.Post(srv.URL+"/upload", "application/octet-stream", body)
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusRequestEntityTooLarge)
+	}
+}
+
+func TestBodyLimitUsesRouteSpecificLimit(t *testing.T) {
+	router := gin.New()
+	router.Use(BodyLimit(16, WithRouteBodyLimits(map[string]int64{
+		"POST /upload": 64,
+		"/notes":       8,
+	})))
+	read := func(c *gin.Context) {
+		if _, err := io.ReadAll(c.Request.Body); err != nil {
+			c.Status(http.StatusRequestEntityTooLarge)
+			return
+		}
+		c.Status(http.StatusOK)
+	}
+	router.POST("/upload", read)
+	router.PUT("/upload", read)
+	router.POST("/notes", read)
+
+	tests := []struct {
+		method, path string
+		size         int
+		want         int
+	}{
+		{http.MethodPost, "/upload", 32, http.StatusOK},
+		{http.MethodPost, "/upload", 65, http.StatusRequestEntityTooLarge},
+		{http.MethodPut, "/upload", 32, http.StatusRequestEntityTooLarge},
+		{http.MethodPost, "/notes", 12, http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, strings.NewReader(strings.Repeat("x", tt.size))))
+		if w.Code != tt.want {
+			t.Errorf("%s %s with %d bytes: %d, want %d", tt.method, tt.path, tt.size, w.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,301 @@
+// Package middleware provides the Gin middleware stack used by the API
+package middleware
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// defaultCacheEntries bounds the memory store Cache uses without
+// WithCacheStore
+const defaultCacheEntries = 1000
+
+// CachedResponse is a response kept by a CacheStore. Header holds the
+// headers the handler set, such as ETag and pagination links, but not those
+// of the middleware before it, such as the request ID.
+type CachedResponse struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	Body   []byte      `json:"body"`
+}
+
+// CacheStore keeps the responses served by Cache. Entries expire after the
+// TTL they were set with. Purge is also how writes invalidate the cache, so
+// a store shared by several replicas makes a write on one visible to all.
+//
+// Every Purge starts a new generation. Cache reads the generation before
+// running the handler and passes it to Set, which must drop the response if
+// a purge has happened since: the body may predate the write that purged.
+type CacheStore interface {
+	Get(ctx context.Context, key string) (CachedResponse, bool, error)
+	// Generation returns the current generation
+	Generation(ctx context.Context) (int64, error)
+	// Set stores response under key unless generation is no longer current
+	Set(ctx context.Context, key string, generation int64, response CachedResponse, ttl time.Duration) error
+	// Purge drops every entry and starts a new generation
+	Purge(ctx context.Context) error
+}
+
+// MemoryCacheStore is a per-replica CacheStore that evicts the least
+// recently used entry once it is full
+type MemoryCacheStore struct {
+	mu         sync.Mutex
+	maxEntries int
+	order      *list.List
+	entries    map[string]*list.Element
+	generation int64
+}
+
+type memoryCacheEntry struct {
+	key      string
+	response CachedResponse
+	expires  time.Time
+}
+
+// NewMemoryCacheStore creates an empty store holding up to maxEntries
+// responses; zero means unlimited
+func NewMemoryCacheStore(maxEntries int) *MemoryCacheStore {
+	return &MemoryCacheStore{maxEntries: maxEntries, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// Get returns the live entry for key, marking it as recently used
+func (s *MemoryCacheStore) Get(_ context.Context, key string) (CachedResponse, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	element, ok := s.entries[key]
+	if !ok {
+		return CachedResponse{}, false, nil
+	}
+	entry := element.Value.(*memoryCacheEntry)
+	if time.Now().After(entry.expires) {
+		s.order.Remove(element)
+		delete(s.entries, key)
+		return CachedResponse{}, false, nil
+	}
+	s.order.MoveToFront(element)
+	return entry.response, true, nil
+}
+
+// Generation returns the number of purges so far
+func (s *MemoryCacheStore) Generation(context.Context) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.generation, nil
+}
+
+// Set stores response under key, evicting the least recently used entry
+// when the store is full. It does nothing if the store was purged after
+// generation.
+func (s *MemoryCacheStore) Set(_ context.Context, key string, generation int64, response CachedResponse, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if generation != s.generation {
+		return nil
+	}
+
+	entry := &memoryCacheEntry{key: key, response: response, expires: time.Now().Add(ttl)}
+	if element, ok := s.entries[key]; ok {
+		element.Value = entry
+		s.order.MoveToFront(element)
+		return nil
+	}
+	s.entries[key] = s.order.PushFront(entry)
+	if s.maxEntries > 0 && s.order.Len() > s.maxEntries {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.entries, oldest.Value.(*memoryCacheEntry).key)
+	}
+	return nil
+}
+
+// Purge drops every entry and starts a new generation
+func (s *MemoryCacheStore) Purge(context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.order.Init()
+	s.entries = make(map[string]*list.Element)
+	s.generation++
+	return nil
+}
+
+// CacheOption configures Cache
+type CacheOption func(*cacheOptions)
+
+type cacheOptions struct {
+	store      CacheStore
+	registerer prometheus.Registerer
+	logger     *zap.Logger
+}
+
+// WithCacheStore keeps responses in store instead of a per-replica memory
+// store of 1000 entries
+func WithCacheStore(store CacheStore) CacheOption {
+	return func(o *cacheOptions) {
+		o.store = store
+	}
+}
+
+// WithCacheMetrics counts cache lookups by result, "hit", "miss" or
+// "error", and registers the counter with registerer
+func WithCacheMetrics(registerer prometheus.Registerer) CacheOption {
+	return func(o *cacheOptions) {
+		o.registerer = registerer
+	}
+}
+
+// WithCacheLogger logs store failures to logger. They never fail the
+// request: a lookup that errors is served as a miss.
+func WithCacheLogger(logger *zap.Logger) CacheOption {
+	return func(o *cacheOptions) {
+		o.logger = logger
+	}
+}
+
+// bodyRecorder captures the response body while still writing it to the client
+type bodyRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *bodyRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *bodyRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// recordedHeader returns the headers the handlers beneath a recording
+// middleware set or changed, compared with before. A recorded response is
+// replayed through Compress again, which encodes it for the client asking,
+// so the Content-Encoding and dropped Content-Length of the encoding
+// Compress applied are left out: the recorded body is the plain one. Vary
+// keeps the Accept-Encoding Compress added, which holds for the replay too.
+func recordedHeader(c *gin.Context, before, after http.Header) http.Header {
+	header := make(http.Header)
+	for name, values := range after {
+		if previous, set := before[name]; !set || !slices.Equal(previous, values) {
+			header[name] = values
+		}
+	}
+	if compressed(c) {
+		header.Del("Content-Encoding")
+		header.Del("Content-Length")
+	}
+	return header
+}
+
+// Cache serves repeated successful GET responses from the store for ttl.
+// Entries are keyed on path, query and the caller's auth scope, so a
+// response is never shared between principals. Writes do not pass through
+// the cache; the handlers making them purge the store instead, which also
+// covers writes on routes the cache is not installed on.
+func Cache(ttl time.Duration, opts ...CacheOption) gin.HandlerFunc {
+	options := cacheOptions{logger: zap.NewNop()}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.store == nil {
+		options.store = NewMemoryCacheStore(defaultCacheEntries)
+	}
+	lookups := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_response_cache_lookups_total",
+		Help: "Response cache lookups, by result: hit, miss or error.",
+	}, []string{"result"})
+	if options.registerer != nil {
+		options.registerer.MustRegister(lookups)
+	}
+
+	return func(c *gin.Context) {
+		// Conditional requests are left to the handler, which answers them
+		// with 304 itself
+		if c.Request.Method != http.MethodGet || c.GetHeader("If-None-Match") != "" {
+			c.Next()
+			return
+		}
+
+		ctx := c.Request.Context()
+		key := cacheKey(c)
+		entry, ok, err := options.store.Get(ctx, key)
+		switch {
+		case err != nil:
+			lookups.WithLabelValues("error").Inc()
+			options.logger.Warn("Response cache unavailable; serving uncached",
+				zap.String("request_id", GetRequestID(c)), zap.Error(err))
+		case ok:
+			lookups.WithLabelValues("hit").Inc()
+			header := c.Writer.Header()
+			for name, values := range entry.Header {
+				header[name] = values
+			}
+			header.Set("X-Cache", "HIT")
+			c.Status(entry.Status)
+			_, _ = c.Writer.Write(entry.Body)
+			c.Abort()
+			return
+		default:
+			lookups.WithLabelValues("miss").Inc()
+		}
+
+		// Taken before the handler reads, so a write purging while it runs
+		// keeps its possibly stale response out of the cache
+		generation, err := options.store.Generation(ctx)
+		if err != nil {
+			options.logger.Warn("Response cache unavailable; not caching",
+				zap.String("request_id", GetRequestID(c)), zap.Error(err))
+		}
+
+		before := c.Writer.Header().Clone()
+		recorder := &bodyRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Header("X-Cache", "MISS")
+		c.Next()
+
+		if err == nil && recorder.Status() == http.StatusOK {
+			response := CachedResponse{
+				Status: recorder.Status(),
+				Header: recordedHeader(c, before, recorder.Header()),
+				Body:   recorder.body.Bytes(),
+			}
+			response.Header.Del("X-Cache")
+			if err := options.store.Set(ctx, key, generation, response, ttl); err != nil {
+				options.logger.Warn("Failed to cache response",
+					zap.String("request_id", GetRequestID(c)), zap.Error(err))
+			}
+		}
+	}
+}
+
+// cacheKey builds the cache key for the request. Authenticated callers are
+// scoped by user and role, which every credential for the user shares;
+// anyone else by their Authorization header, hashed so tokens are not kept
+// in plain form.
+func cacheKey(c *gin.Context) string {
+	r := c.Request
+	scope := ""
+	if userID, ok := GetUserID(c); ok {
+		scope = "user:" + strconv.Itoa(userID) + ":" + GetRole(c)
+	} else {
+		principal := sha256.Sum256([]byte(r.Header.Get("Authorization")))
+		scope = "anon:" + hex.EncodeToString(principal[:])
+	}
+	return r.URL.Path + "?" + r.URL.Query().Encode() + " " + scope
+}
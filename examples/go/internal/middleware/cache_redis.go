@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisCacheStore is a CacheStore shared by every replica connected to the
+// same Redis. Keys carry a generation number; Purge bumps it, which orphans
+// every entry at once without scanning for them, and the orphans expire
+// with their TTL.
+type RedisCacheStore struct {
+	client redis.Cmdable
+	prefix string
+}
+
+// NewRedisCacheStore creates a store keeping its entries in client under
+// keys starting with prefix
+func NewRedisCacheStore(client redis.Cmdable, prefix string) *RedisCacheStore {
+	return &RedisCacheStore{client: client, prefix: prefix}
+}
+
+// Get returns the entry for key in the current generation
+func (s *RedisCacheStore) Get(ctx context.Context, key string) (CachedResponse, bool, error) {
+	generation, err := s.Generation(ctx)
+	if err != nil {
+		return CachedResponse{}, false, err
+	}
+	data, err := s.client.Get(ctx, s.entryKey(generation, key)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return CachedResponse{}, false, nil
+	}
+	if err != nil {
+		return CachedResponse{}, false, fmt.Errorf("cache: redis: %w", err)
+	}
+
+	var response CachedResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		return CachedResponse{}, false, fmt.Errorf("cache: decode entry: %w", err)
+	}
+	return response, true, nil
+}
+
+// Set stores response under key in generation. After a purge that key is
+// never read again, so a stale response simply expires unseen.
+func (s *RedisCacheStore) Set(ctx context.Context, key string, generation int64, response CachedResponse, ttl time.Duration) error {
+	data, err := json.Marshal(response)
+	if err != nil {
+		return fmt.Errorf("cache: encode entry: %w", err)
+	}
+	if err := s.client.Set(ctx, s.entryKey(generation, key), data, ttl).Err(); err != nil {
+		return fmt.Errorf("cache: redis: %w", err)
+	}
+	return nil
+}
+
+// Purge starts a new generation, dropping every entry for all replicas
+func (s *RedisCacheStore) Purge(ctx context.Context) error {
+	if err := s.client.Incr(ctx, s.prefix+"generation").Err(); err != nil {
+		return fmt.Errorf("cache: redis: %w", err)
+	}
+	return nil
+}
+
+// Generation returns the current generation, shared by every replica
+func (s *RedisCacheStore) Generation(ctx context.Context) (int64, error) {
+	generation, err := s.client.Get(ctx, s.prefix+"generation").Int64()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return 0, fmt.Errorf("cache: redis: %w", err)
+	}
+	return generation, nil
+}
+
+// entryKey returns the Redis key of key in generation
+func (s *RedisCacheStore) entryKey(generation int64, key string) string {
+	return s.prefix + strconv.FormatInt(generation, 10) + ":" + key
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestRedisCacheStorePurgeReachesEveryReplica(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	newStore := func() *RedisCacheStore {
+		client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+		t.Cleanup(func() { client.Close() })
+		return NewRedisCacheStore(client, "cache:")
+	}
+	first, second := newStore(), newStore()
+
+	response := CachedResponse{Status: http.StatusOK, Header: http.Header{"Etag": {`"v1"`}}, Body: []byte(`{"id":1}`)}
+	if err := first.Set(ctx, "/users/1", 0, response, time.Minute); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	got, ok, err := second.Get(ctx, "/users/1")
+	if err != nil || !ok || string(got.Body) != `{"id":1}` || got.Header.Get("ETag") != `"v1"` {
+		t.Fatalf("Get from the other replica = %+v, %v, %v", got, ok, err)
+	}
+
+	if err := second.Purge(ctx); err != nil {
+		t.Fatalf("Purge: %v", err)
+	}
+	if _, ok, err := first.Get(ctx, "/users/1"); ok || err != nil {
+		t.Errorf("Get after purge = %v, %v; want a miss", ok, err)
+	}
+
+	// A response read before the purge is set under the old generation
+	if err := first.Set(ctx, "/users/1", 0, response, time.Minute); err != nil {
+		t.Fatalf("stale Set: %v", err)
+	}
+	if _, ok, err := second.Get(ctx, "/users/1"); ok || err != nil {
+		t.Errorf("Get after a stale Set = %v, %v; want a miss", ok, err)
+	}
+
+	server.Close()
+	if _, _, err := first.Get(ctx, "/users/1"); err == nil {
+		t.Error("Get with Redis down: want an error")
+	}
+}
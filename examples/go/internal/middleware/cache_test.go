@@ -0,0 +1,237 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+func TestCacheServesRepeatedGET(t *testing.T) {
+	calls := 0
+	router := gin.New()
+	router.Use(Cache(time.Minute))
+	router.GET("/users", func(c *gin.Context) {
+		calls++
+		c.JSON(http.StatusOK, gin.H{"calls": calls})
+	})
+
+	var bodies []string
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/users?page=1", nil)
+		req.Header.Set("Authorization", "Bearer alice")
+		router.ServeHTTP(w, req)
+		bodies = append(bodies, w.Body.String())
+
+		if i == 1 && w.Header().Get("X-Cache") != "HIT" {
+			t.Errorf("second request X-Cache = %q, want HIT", w.Header().Get("X-Cache"))
+		}
+	}
+
+	if calls != 1 {
+		t.Errorf("backing handler called %d times, want 1", calls)
+	}
+	if bodies[0] != bodies[1] {
+		t.Errorf("cached body %q differs from original %q", bodies[1], bodies[0])
+	}
+}
+
+func TestCacheIsolatesPrincipals(t *testing.T) {
+	calls := 0
+	router := gin.New()
+	router.Use(Cache(time.Minute))
+	router.GET("/users", func(c *gin.Context) {
+		calls++
+		c.String(http.StatusOK, c.GetHeader("Authorization"))
+	})
+
+	for _, token := range []string{"Bearer alice", "Bearer bob"} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/users", nil)
+		req.Header.Set("Authorization", token)
+		router.ServeHTTP(w, req)
+
+		if w.Body.String() != token {
+			t.Errorf("principal %q received %q", token, w.Body.String())
+		}
+	}
+
+	if calls != 2 {
+		t.Errorf("backing handler called %d times, want 2", calls)
+	}
+}
+
+func TestCacheBeneathCompressStoresThePlainBody(t *testing.T) {
+	want := strings.Repeat(`{"name":"alice"},`, 250)
+	calls := 0
+	router := gin.New()
+	router.Use(Compress(), Cache(time.Minute))
+	router.GET("/users", func(c *gin.Context) {
+		calls++
+		c.Writer.Header().Add("Vary", "Origin")
+		c.String(http.StatusOK, want)
+	})
+
+	for _, accept := range []string{"br", "", "gzip"} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/users", nil)
+		req.Header.Set("Accept-Encoding", accept)
+		router.ServeHTTP(w, req)
+
+		if got := w.Header().Get("Content-Encoding"); got != accept {
+			t.Errorf("Accept-Encoding %q: Content-Encoding = %q", accept, got)
+			continue
+		}
+		if decodeBody(t, w) != want {
+			t.Errorf("Accept-Encoding %q: decoded body differs", accept)
+		}
+		if vary := w.Header().Values("Vary"); len(vary) != 2 {
+			t.Errorf("Accept-Encoding %q: Vary = %q, want Accept-Encoding and Origin once each", accept, vary)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("backing handler called %d times, want 1", calls)
+	}
+}
+
+func TestCacheServesStaleUntilPurged(t *testing.T) {
+	calls := 0
+	store := NewMemoryCacheStore(10)
+	router := gin.New()
+	router.Use(Cache(time.Minute, WithCacheStore(store)))
+	router.GET("/users", func(c *gin.Context) {
+		calls++
+		c.Header("X-Total-Count", strconv.Itoa(calls))
+		c.Status(http.StatusOK)
+	})
+	router.POST("/users", func(c *gin.Context) {
+		c.Status(http.StatusCreated)
+	})
+
+	get := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users", nil))
+		return w
+	}
+	get()
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/users", nil))
+	if w := get(); calls != 1 || w.Header().Get("X-Total-Count") != "1" {
+		t.Errorf("after a write without a purge: %d calls, X-Total-Count %q; want the cached response",
+			calls, w.Header().Get("X-Total-Count"))
+	}
+
+	if err := store.Purge(context.Background()); err != nil {
+		t.Fatalf("Purge: %v", err)
+	}
+	if w := get(); calls != 2 || w.Header().Get("X-Cache") != "MISS" {
+		t.Errorf("after a purge: %d calls, X-Cache %q; want 2 and MISS", calls, w.Header().Get("X-Cache"))
+	}
+}
+
+func TestCacheDropsResponsesRacingAPurge(t *testing.T) {
+	calls := 0
+	store := NewMemoryCacheStore(10)
+	router := gin.New()
+	router.Use(Cache(time.Minute, WithCacheStore(store)))
+	router.GET("/users", func(c *gin.Context) {
+		calls++
+		if calls == 1 {
+			// A write lands after this handler read but before it responds
+			_ = store.Purge(c.Request.Context())
+		}
+		c.String(http.StatusOK, "v%d", calls)
+	})
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users", nil))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users", nil))
+	if w.Header().Get("X-Cache") != "MISS" || w.Body.String() != "v2" {
+		t.Errorf("after a purge during the first GET: X-Cache %q, body %q; want a fresh MISS", w.Header().Get("X-Cache"), w.Body.String())
+	}
+}
+
+func TestCacheLeavesConditionalRequestsToHandler(t *testing.T) {
+	calls := 0
+	router := gin.New()
+	router.Use(Cache(time.Minute))
+	router.GET("/users/1", func(c *gin.Context) {
+		calls++
+		c.Header("ETag", `"v1"`)
+		if c.GetHeader("If-None-Match") == `"v1"` {
+			c.Status(http.StatusNotModified)
+			return
+		}
+		c.String(http.StatusOK, "user")
+	})
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/1", nil))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/1", nil))
+	if w.Header().Get("X-Cache") != "HIT" || w.Header().Get("ETag") != `"v1"` {
+		t.Errorf("hit: X-Cache %q, ETag %q; want HIT with the handler's ETag", w.Header().Get("X-Cache"), w.Header().Get("ETag"))
+	}
+
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+	req.Header.Set("If-None-Match", `"v1"`)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusNotModified || calls != 2 {
+		t.Errorf("conditional request: status %d after %d calls, want 304 from the handler", w.Code, calls)
+	}
+}
+
+func TestMemoryCacheStoreEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryCacheStore(2)
+	for _, key := range []string{"a", "b"} {
+		_ = store.Set(ctx, key, 0, CachedResponse{Status: http.StatusOK}, time.Minute)
+	}
+	if _, ok, _ := store.Get(ctx, "a"); !ok {
+		t.Fatal("a missing before eviction")
+	}
+	_ = store.Set(ctx, "c", 0, CachedResponse{Status: http.StatusOK}, time.Minute)
+
+	for key, want := range map[string]bool{"a": true, "b": false, "c": true} {
+		if _, ok, _ := store.Get(ctx, key); ok != want {
+			t.Errorf("%s cached = %v, want %v", key, ok, want)
+		}
+	}
+
+	_ = store.Set(ctx, "d", 0, CachedResponse{Status: http.StatusOK}, -time.Second)
+	if _, ok, _ := store.Get(ctx, "d"); ok {
+		t.Error("expired entry served")
+	}
+}
+
+func TestCacheCountsLookups(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	router := gin.New()
+	router.Use(Cache(time.Minute, WithCacheMetrics(registry)))
+	router.GET("/users", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for i := 0; i < 3; i++ {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users", nil))
+	}
+
+	expected := `
+# HELP http_response_cache_lookups_total Response cache lookups, by result: hit, miss or error.
+# TYPE http_response_cache_lookups_total counter
+http_response_cache_lookups_total{result="hit"} 2
+http_response_cache_lookups_total{result="miss"} 1
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected), "http_response_cache_lookups_total"); err != nil {
+		t.Error(err)
+	}
+}
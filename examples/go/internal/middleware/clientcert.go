@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"net/netip"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+	"github.com/cbwinslow/template2/examples/go/pkg/apierror"
+	"github.com/cbwinslow/template2/examples/go/pkg/auth"
+)
+
+// CertPrincipalResolver maps the subject common name of a client certificate
+// to the claims of the principal it identifies. An *apierror.Error it
+// returns, such as for a locked account, is sent as is; any other error
+// rejects the certificate with 401.
+type CertPrincipalResolver func(ctx context.Context, commonName string) (*auth.Claims, error)
+
+// clientCertKey holds the verified client certificate a request was
+// authenticated with
+const clientCertKey = "client_cert"
+
+type clientCertOptions struct {
+	header  string
+	trusted []netip.Prefix
+	resolve CertPrincipalResolver
+}
+
+// WithClientCert makes AuthRequired accept the client certificate common
+// name that an mTLS-terminating proxy forwards in header. The header is only
+// honored when the connecting peer's address is in trustedProxies; from any
+// other peer it is ignored, so a client cannot authenticate by setting it
+// itself. Requests without the header fall back to bearer tokens.
+func WithClientCert(header string, trustedProxies []netip.Prefix, resolve CertPrincipalResolver) AuthOption {
+	return func(o *authOptions) {
+		o.clientCert = &clientCertOptions{header: header, trusted: trustedProxies, resolve: resolve}
+	}
+}
+
+// WithVerifiedClientCert makes AuthRequired accept the client certificate
+// presented in the TLS handshake, for service callers on an mTLS listener.
+// Only certificates the server verified against its client CAs count, and
+// they are mapped to a principal by subject common name; without one the
+// request falls back to the other credentials.
+func WithVerifiedClientCert(resolve CertPrincipalResolver) AuthOption {
+	return func(o *authOptions) {
+		o.verifiedCert = resolve
+	}
+}
+
+// GetClientCert returns the verified client certificate the request was
+// authenticated with, if any
+func GetClientCert(c *gin.Context) (*x509.Certificate, bool) {
+	cert, ok := c.Get(clientCertKey)
+	if !ok {
+		return nil, false
+	}
+	leaf, ok := cert.(*x509.Certificate)
+	return leaf, ok
+}
+
+// certError is the response to a certificate the resolver refused with err
+func certError(err error) *apierror.Error {
+	var apiErr *apierror.Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	return models.NewError(http.StatusUnauthorized, models.CodeUnauthorized, "Client certificate is not linked to an account")
+}
+
+// verifiedClientCert returns the leaf of the certificate chain the TLS
+// handshake verified
+func verifiedClientCert(c *gin.Context) (*x509.Certificate, bool) {
+	state := c.Request.TLS
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil, false
+	}
+	return state.VerifiedChains[0][0], true
+}
+
+// clientCertCommonName returns the forwarded common name when the request
+// came through a trusted proxy
+func clientCertCommonName(c *gin.Context, options *clientCertOptions) (string, bool) {
+	cn := c.GetHeader(options.header)
+	if cn == "" {
+		return "", false
+	}
+
+	peer, err := netip.ParseAddr(c.RemoteIP())
+	if err != nil {
+		return "", false
+	}
+	peer = peer.Unmap()
+	for _, prefix := range options.trusted {
+		if prefix.Contains(peer) {
+			return cn, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/cbwinslow/template2/examples/go/pkg/auth"
+)
+
+func TestAuthRequiredClientCertFromTrustedProxy(t *testing.T) {
+	resolve := func(ctx context.Context, cn string) (*auth.Claims, error) {
+		if cn != "svc-billing" {
+			return nil, errors.New("unknown principal")
+		}
+		return &auth.Claims{UserID: 9, Role: "user"}, nil
+	}
+	router := newAuthRouter(auth.NewAuthService(),
+		WithClientCert("X-Client-Cert-CN", []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}, resolve))
+
+	cases := map[string]struct {
+		remote, cn string
+		want       int
+		body       string
+	}{
+		"trusted proxy":   {"10.1.2.3:4000", "svc-billing", http.StatusOK, "9"},
+		"unknown subject": {"10.1.2.3:4000", "svc-unknown", http.StatusUnauthorized, ""},
+		"spoofed header":  {"203.0.113.9:4000", "svc-billing", http.StatusUnauthorized, ""},
+	}
+	for name, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/profile", nil)
+		req.RemoteAddr = tc.remote
+		req.Header.Set("X-Client-Cert-CN", tc.cn)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != tc.want || (tc.body != "" && w.Body.String() != tc.body) {
+			t.Errorf("%s: got %d %q, want %d %q", name, w.Code, w.Body.String(), tc.want, tc.body)
+		}
+	}
+}
+
+func TestAuthRequiredVerifiedClientCert(t *testing.T) {
+	resolve := func(ctx context.Context, cn string) (*auth.Claims, error) {
+		if cn != "svc-billing" {
+			return nil, errors.New("unknown principal")
+		}
+		return &auth.Claims{UserID: 9, Role: "user"}, nil
+	}
+	router := gin.New()
+	router.Use(AuthRequired(auth.NewAuthService(), WithVerifiedClientCert(resolve)))
+	router.GET("/profile", func(c *gin.Context) {
+		cert, _ := GetClientCert(c)
+		id, _ := GetUserID(c)
+		c.String(http.StatusOK, "%d %s", id, cert.Subject.CommonName)
+	})
+
+	leaf := func(cn string) []*x509.Certificate {
+		return []*x509.Certificate{{Subject: pkix.Name{CommonName: cn}}}
+	}
+	cases := map[string]struct {
+		state *tls.ConnectionState
+		want  int
+		body  string
+	}{
+		"verified":        {&tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{leaf("svc-billing")}}, http.StatusOK, "9 svc-billing"},
+		"unknown subject": {&tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{leaf("svc-unknown")}}, http.StatusUnauthorized, ""},
+		"unverified":      {&tls.ConnectionState{PeerCertificates: leaf("svc-billing")}, http.StatusUnauthorized, ""},
+		"plain HTTP":      {nil, http.StatusUnauthorized, ""},
+	}
+	for name, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/profile", nil)
+		req.TLS = tc.state
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != tc.want || (tc.body != "" && w.Body.String() != tc.body) {
+			t.Errorf("%s: got %d %q, want %d %q", name, w.Code, w.Body.String(), tc.want, tc.body)
+		}
+	}
+}
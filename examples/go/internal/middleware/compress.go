@@ -0,0 +1,287 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// defaultCompressMinSize is the smallest body worth compressing; below
+	// it the encoding overhead outweighs the saving
+	defaultCompressMinSize = 1024
+	// brotliLevel trades some ratio for the speed a response path needs;
+	// brotli's own default is tuned for static assets
+	brotliLevel = 4
+)
+
+// compressWriterKey holds the request's compressWriter, so middleware
+// recording responses beneath Compress can tell the encoding it applied
+// from one a handler set
+const compressWriterKey = "compress_writer"
+
+// defaultIncompressibleTypes are media types already compressed by their
+// format. Entries ending in "/" match a whole top-level type.
+var defaultIncompressibleTypes = []string{
+	"image/", "video/", "audio/", "font/woff", "font/woff2",
+	"application/zip", "application/gzip", "application/x-gzip", "application/zstd",
+	"application/x-7z-compressed", "application/x-rar-compressed", "application/pdf",
+}
+
+var (
+	gzipWriters   = sync.Pool{New: func() interface{} { return gzip.NewWriter(io.Discard) }}
+	brotliWriters = sync.Pool{New: func() interface{} { return brotli.NewWriterLevel(io.Discard, brotliLevel) }}
+)
+
+// CompressOption configures Compress
+type CompressOption func(*compressOptions)
+
+type compressOptions struct {
+	minSize  int
+	excluded []string
+}
+
+// WithCompressMinSize sets the smallest response body compressed, in bytes;
+// the default is 1 KiB
+func WithCompressMinSize(n int) CompressOption {
+	return func(o *compressOptions) {
+		o.minSize = n
+	}
+}
+
+// WithCompressExcludedTypes adds media types never compressed, on top of
+// the image, audio, video and archive formats excluded by default. A type
+// ending in "/", such as "model/", excludes the whole top-level type.
+func WithCompressExcludedTypes(types ...string) CompressOption {
+	return func(o *compressOptions) {
+		o.excluded = append(o.excluded, types...)
+	}
+}
+
+// Compress encodes responses with brotli or gzip, whichever the client's
+// Accept-Encoding prefers, favoring brotli on a tie. Bodies are buffered
+// until they reach the minimum size, so small responses go out unchanged
+// with their Content-Length; a handler flushing earlier, such as the event
+// stream, starts the encoding straight away and each flush reaches the
+// client. Responses already carrying a Content-Encoding, partial content,
+// excluded types and protocol upgrades are passed through.
+//
+// ETags are left as the handlers set them, so If-Match keeps working for
+// clients that read compressed representations.
+func Compress(opts ...CompressOption) gin.HandlerFunc {
+	options := compressOptions{minSize: defaultCompressMinSize, excluded: append([]string(nil), defaultIncompressibleTypes...)}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	return func(c *gin.Context) {
+		if c.Request.Method == http.MethodHead || c.GetHeader("Upgrade") != "" {
+			c.Next()
+			return
+		}
+		c.Writer.Header().Add("Vary", "Accept-Encoding")
+		encoding := negotiateEncoding(c.GetHeader("Accept-Encoding"))
+		if encoding == "" {
+			c.Next()
+			return
+		}
+
+		w := &compressWriter{ResponseWriter: c.Writer, options: &options, encoding: encoding}
+		c.Writer = w
+		c.Set(compressWriterKey, w)
+		defer w.close()
+		c.Next()
+	}
+}
+
+// compressed reports whether Compress has started encoding the response
+func compressed(c *gin.Context) bool {
+	w, ok := c.Value(compressWriterKey).(*compressWriter)
+	return ok && w.encoder != nil
+}
+
+// negotiateEncoding picks "br" or "gzip" from an Accept-Encoding header, or
+// "" when the client accepts neither. A coding the header does not name
+// takes the weight of "*", if any.
+func negotiateEncoding(accept string) string {
+	weights := make(map[string]float64)
+	for _, entry := range strings.Split(accept, ",") {
+		coding, params, _ := strings.Cut(entry, ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		q := 1.0
+		if name, value, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(name) == "q" {
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		weights[coding] = q
+	}
+
+	var best string
+	var bestQ float64
+	for _, coding := range []string{"br", "gzip"} {
+		q, ok := weights[coding]
+		if !ok {
+			q = weights["*"]
+		}
+		if q > bestQ {
+			best, bestQ = coding, q
+		}
+	}
+	return best
+}
+
+// compressWriter holds the body back until it is known whether it is worth
+// compressing, then either encodes it or writes it through unchanged
+type compressWriter struct {
+	gin.ResponseWriter
+	options  *compressOptions
+	encoding string
+
+	buf     []byte
+	decided bool
+	encoder io.WriteCloser
+	size    int
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	w.size += len(b)
+	if !w.decided {
+		w.buf = append(w.buf, b...)
+		if len(w.buf) < w.options.minSize {
+			return len(b), nil
+		}
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	if w.encoder != nil {
+		return w.encoder.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// WriteHeaderNow sends a response that has no body, such as a 304,
+// unencoded
+func (w *compressWriter) WriteHeaderNow() {
+	if !w.decided {
+		_ = w.decide(false)
+	}
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		_ = w.decide(true)
+	}
+	if flusher, ok := w.encoder.(interface{ Flush() error }); ok {
+		_ = flusher.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// Written and Size count body bytes the handler wrote, including those
+// still held back
+func (w *compressWriter) Written() bool {
+	return w.size > 0 || w.ResponseWriter.Written()
+}
+
+func (w *compressWriter) Size() int {
+	if w.size > 0 {
+		return w.size
+	}
+	return w.ResponseWriter.Size()
+}
+
+// decide starts the encoder if compress is still wanted and the response
+// turns out eligible, then writes out whatever was held back
+func (w *compressWriter) decide(compress bool) error {
+	w.decided = true
+	header := w.Header()
+	if compress && w.compressible(header) {
+		header.Set("Content-Encoding", w.encoding)
+		header.Del("Content-Length")
+		switch w.encoding {
+		case "br":
+			bw := brotliWriters.Get().(*brotli.Writer)
+			bw.Reset(w.ResponseWriter)
+			w.encoder = bw
+		default:
+			gw := gzipWriters.Get().(*gzip.Writer)
+			gw.Reset(w.ResponseWriter)
+			w.encoder = gw
+		}
+	}
+
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	if w.encoder != nil {
+		_, err := w.encoder.Write(buf)
+		return err
+	}
+	_, err := w.ResponseWriter.Write(buf)
+	return err
+}
+
+// compressible reports whether the response may be encoded
+func (w *compressWriter) compressible(header http.Header) bool {
+	status := w.Status()
+	if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusPartialContent || status == http.StatusNotModified {
+		return false
+	}
+	if header.Get("Content-Encoding") != "" || header.Get("Content-Range") != "" {
+		return false
+	}
+	contentType := header.Get("Content-Type")
+	if contentType == "" && len(w.buf) > 0 {
+		// Set it now, as net/http would have sniffed the plain body
+		contentType = http.DetectContentType(w.buf)
+		header.Set("Content-Type", contentType)
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	for _, excluded := range w.options.excluded {
+		if mediaType == excluded || strings.HasSuffix(excluded, "/") && strings.HasPrefix(mediaType, excluded) {
+			return false
+		}
+	}
+	return true
+}
+
+// close writes out a body that never reached the minimum size, or ends the
+// encoded stream and returns the encoder to its pool
+func (w *compressWriter) close() {
+	if !w.decided {
+		_ = w.decide(false)
+		return
+	}
+	if w.encoder == nil {
+		return
+	}
+	_ = w.encoder.Close()
+	switch encoder := w.encoder.(type) {
+	case *brotli.Writer:
+		encoder.Reset(io.Discard)
+		brotliWriters.Put(encoder)
+	case *gzip.Writer:
+		encoder.Reset(io.Discard)
+		gzipWriters.Put(encoder)
+	}
+	w.encoder = nil
+}
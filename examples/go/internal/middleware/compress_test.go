@@ -0,0 +1,142 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+)
+
+func newCompressRouter(opts ...CompressOption) *gin.Engine {
+	router := gin.New()
+	router.Use(Compress(opts...))
+	router.GET("/users", func(c *gin.Context) {
+		c.String(http.StatusOK, strings.Repeat(`{"name":"alice"},`, 200))
+	})
+	router.GET("/small", func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+	router.GET("/image", func(c *gin.Context) {
+		c.Data(http.StatusOK, "image/png", make([]byte, 4096))
+	})
+	return router
+}
+
+func getEncoded(router *gin.Engine, path, accept string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("Accept-Encoding", accept)
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// decodeBody returns the response body decoded as its Content-Encoding says
+func decodeBody(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	var body io.Reader = bytes.NewReader(w.Body.Bytes())
+	switch encoding := w.Header().Get("Content-Encoding"); encoding {
+	case "":
+	case "br":
+		body = brotli.NewReader(body)
+	case "gzip":
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			t.Fatalf("gzip: %v", err)
+		}
+		body = gz
+	default:
+		t.Fatalf("unexpected Content-Encoding %q", encoding)
+	}
+	decoded, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatalf("decode %s body: %v", w.Header().Get("Content-Encoding"), err)
+	}
+	return string(decoded)
+}
+
+func TestCompressNegotiatesEncoding(t *testing.T) {
+	router := newCompressRouter()
+	want := strings.Repeat(`{"name":"alice"},`, 200)
+
+	tests := []struct {
+		accept   string
+		encoding string
+	}{
+		{"gzip, deflate, br", "br"},
+		{"gzip", "gzip"},
+		{"br;q=0.5, gzip", "gzip"},
+		{"br;q=0, *", "gzip"},
+		{"deflate", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		w := getEncoded(router, "/users", tt.accept)
+		if got := w.Header().Get("Content-Encoding"); got != tt.encoding {
+			t.Errorf("Accept-Encoding %q: Content-Encoding = %q, want %q", tt.accept, got, tt.encoding)
+			continue
+		}
+		if decodeBody(t, w) != want {
+			t.Errorf("Accept-Encoding %q: decoded body differs", tt.accept)
+		}
+		if w.Header().Get("Vary") != "Accept-Encoding" {
+			t.Errorf("Accept-Encoding %q: Vary = %q", tt.accept, w.Header().Get("Vary"))
+		}
+	}
+}
+
+func TestCompressSkipsSmallAndExcludedResponses(t *testing.T) {
+	router := newCompressRouter(WithCompressExcludedTypes("text/plain"))
+
+	for _, path := range []string{"/small", "/image", "/users"} {
+		w := getEncoded(router, path, "br, gzip")
+		if encoding := w.Header().Get("Content-Encoding"); encoding != "" {
+			t.Errorf("%s: Content-Encoding = %q, want the body sent as is", path, encoding)
+		}
+	}
+	if w := getEncoded(router, "/small", "gzip"); w.Body.String() != "ok" {
+		t.Errorf("small body = %q", w.Body.String())
+	}
+}
+
+func TestCompressStreamsFlushedWrites(t *testing.T) {
+	release := make(chan struct{})
+	router := gin.New()
+	router.Use(Compress())
+	router.GET("/events", func(c *gin.Context) {
+		c.Header("Content-Type", "text/event-stream")
+		c.String(http.StatusOK, "data: first\n\n")
+		c.Writer.Flush()
+		<-release
+		c.String(http.StatusOK, "data: second\n\n")
+	})
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+	defer close(release)
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/events", nil)
+	// Set explicitly, so the transport leaves the body encoded
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Content-Encoding = %q", resp.Header.Get("Content-Encoding"))
+	}
+	gz, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatalf("gzip: %v", err)
+	}
+	line, err := bufio.NewReader(gz).ReadString('\n')
+	if err != nil || line != "data: first\n" {
+		t.Errorf("first event = %q, %v; want it before the handler returns", line, err)
+	}
+}
@@ -0,0 +1,23 @@
+package middleware
+
+import "github.com/gin-gonic/gin"
+
+// Context keys set by the authentication middleware
+const (
+	userIDKey = "user_id"
+)
+
+// GetUserID returns the authenticated user's ID, if any
+func GetUserID(c *gin.Context) (int, bool) {
+	id, ok := c.Get(userIDKey)
+	if !ok {
+		return 0, false
+	}
+	userID, ok := id.(int)
+	return userID, ok
+}
+
+// GetRole returns the authenticated user's role, or "" if unauthenticated
+func GetRole(c *gin.Context) string {
+	return c.GetString(roleKey)
+}
@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+)
+
+// corsAllowedHeaders are the request headers browsers may send cross-origin
+const corsAllowedHeaders = "Authorization, Content-Type, Accept, If-Match, If-None-Match, " + RequestIDHeader + ", " + CSRFHeader
+
+// CORSOption configures CORS
+type CORSOption func(*corsOptions)
+
+type corsOptions struct {
+	credentials bool
+	maxAge      time.Duration
+}
+
+// WithCORSCredentials lets browsers send cookies and auth headers
+// cross-origin. The allowed origin is then always echoed, never "*".
+func WithCORSCredentials() CORSOption {
+	return func(o *corsOptions) {
+		o.credentials = true
+	}
+}
+
+// WithCORSMaxAge sets how long browsers may cache a preflight response
+func WithCORSMaxAge(maxAge time.Duration) CORSOption {
+	return func(o *corsOptions) {
+		o.maxAge = maxAge
+	}
+}
+
+// CORS allows browsers on the listed origins, or any origin for "*", to call
+// the API. Preflight requests are answered with 204 without reaching the
+// handlers, or 403 when the origin is not allowed. With no origins it does
+// nothing.
+func CORS(origins []string, opts ...CORSOption) gin.HandlerFunc {
+	var options corsOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	allowed := make(map[string]bool, len(origins))
+	anyOrigin := false
+	for _, origin := range origins {
+		if origin == "*" {
+			anyOrigin = true
+		}
+		allowed[strings.TrimSuffix(origin, "/")] = true
+	}
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if len(origins) == 0 || origin == "" {
+			c.Next()
+			return
+		}
+
+		header := c.Writer.Header()
+		header.Add("Vary", "Origin")
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+
+		if !anyOrigin && !allowed[origin] {
+			if preflight {
+				AbortWithError(c, models.NewError(http.StatusForbidden, models.CodeForbidden, fmt.Sprintf("Origin %q is not allowed", origin)))
+				return
+			}
+			c.Next()
+			return
+		}
+
+		if anyOrigin && !options.credentials {
+			header.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			header.Set("Access-Control-Allow-Origin", origin)
+		}
+		if options.credentials {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if preflight {
+			header.Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+			header.Set("Access-Control-Allow-Headers", corsAllowedHeaders)
+			if options.maxAge > 0 {
+				header.Set("Access-Control-Max-Age", fmt.Sprint(int(options.maxAge.Seconds())))
+			}
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		header.Set("Access-Control-Expose-Headers", RequestIDHeader+", Retry-After, ETag")
+		c.Next()
+	}
+}
@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+)
+
+const (
+	// CSRFHeader carries the CSRF cookie's value back on state-changing
+	// requests
+	CSRFHeader = "X-CSRF-Token"
+	// defaultCSRFCookie is the cookie scripts read the token from
+	defaultCSRFCookie = "csrf_token"
+)
+
+// CSRFOption configures CSRF
+type CSRFOption func(*csrfOptions)
+
+type csrfOptions struct {
+	cookie string
+	domain string
+	secure bool
+}
+
+// WithCSRFCookie sets the name and domain of the CSRF cookie and whether
+// it is sent over HTTPS only. The default is "csrf_token", Secure.
+func WithCSRFCookie(name, domain string, secure bool) CSRFOption {
+	return func(o *csrfOptions) {
+		o.cookie = name
+		o.domain = domain
+		o.secure = secure
+	}
+}
+
+// CSRF protects requests authenticated by the session cookie called
+// sessionCookie with the double-submit pattern: every response to a client
+// without one sets a random token in a cookie scripts can read, and POST,
+// PUT, PATCH and DELETE requests carrying the session cookie must echo that
+// token in X-CSRF-Token. Another site can make the browser send both
+// cookies, but cannot read the token to set the header. Requests without
+// the session cookie, such as bearer token and API key callers, are not
+// checked, as browsers never attach those credentials on their own.
+func CSRF(sessionCookie string, opts ...CSRFOption) gin.HandlerFunc {
+	options := csrfOptions{cookie: defaultCSRFCookie, secure: true}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	return func(c *gin.Context) {
+		token, err := c.Cookie(options.cookie)
+		if err != nil || token == "" {
+			token = newCSRFToken()
+			c.SetSameSite(http.SameSiteLaxMode)
+			// Scripts must read it, so it cannot be HttpOnly
+			c.SetCookie(options.cookie, token, 0, "/", options.domain, options.secure, false)
+		}
+
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+			c.Next()
+			return
+		}
+		if session, err := c.Cookie(sessionCookie); err != nil || session == "" {
+			c.Next()
+			return
+		}
+		// A token freshly set above never matches, as the client could not
+		// have read it yet
+		header := c.GetHeader(CSRFHeader)
+		if header == "" || subtle.ConstantTimeCompare([]byte(header), []byte(token)) != 1 {
+			AbortWithError(c, models.NewError(http.StatusForbidden, models.CodeCSRFInvalid,
+				"Send the "+options.cookie+" cookie's value in the "+CSRFHeader+" header"))
+			return
+		}
+		c.Next()
+	}
+}
+
+func newCSRFToken() string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
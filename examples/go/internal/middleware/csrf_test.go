@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCSRF(t *testing.T) {
+	router := gin.New()
+	router.Use(CSRF("session"))
+	router.GET("/users", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.POST("/users", func(c *gin.Context) { c.Status(http.StatusCreated) })
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users", nil))
+	var token string
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == "csrf_token" && !cookie.HttpOnly && cookie.Secure {
+			token = cookie.Value
+		}
+	}
+	if w.Code != http.StatusOK || token == "" {
+		t.Fatalf("GET: status %d, cookies %v; want a readable csrf_token cookie", w.Code, w.Result().Cookies())
+	}
+
+	tests := []struct {
+		name    string
+		session bool
+		header  string
+		status  int
+	}{
+		{"matching header", true, token, http.StatusCreated},
+		{"missing header", true, "", http.StatusForbidden},
+		{"wrong header", true, "forged", http.StatusForbidden},
+		{"no session cookie", false, "", http.StatusCreated},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/users", nil)
+		req.AddCookie(&http.Cookie{Name: "csrf_token", Value: token})
+		if tt.session {
+			req.AddCookie(&http.Cookie{Name: "session", Value: "s1"})
+		}
+		if tt.header != "" {
+			req.Header.Set(CSRFHeader, tt.header)
+		}
+		router.ServeHTTP(w, req)
+		if w.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.status)
+		}
+	}
+}
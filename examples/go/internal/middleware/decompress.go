@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+)
+
+// DecompressBody inflates request bodies sent with Content-Encoding: gzip
+// so handlers read plain bytes. At most maxBytes are inflated, or the
+// route's cap from BodyLimit when that is lower; a body that expands beyond
+// that is rejected with 413 before the handler runs, which stops small
+// compressed payloads from exhausting memory or slipping past a route's
+// limit. Bodies in other encodings are rejected with 415.
+func DecompressBody(maxBytes int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		encoding := strings.ToLower(strings.TrimSpace(c.GetHeader("Content-Encoding")))
+		switch encoding {
+		case "", "identity":
+			c.Next()
+			return
+		case "gzip", "x-gzip":
+		default:
+			AbortWithError(c, models.NewError(http.StatusUnsupportedMediaType, models.CodeUnsupportedMedia, fmt.Sprintf("Content-Encoding %q is not supported", encoding)))
+			return
+		}
+
+		maxBytes := maxBytes
+		if limit, ok := c.Get(bodyLimitKey); ok && limit.(int64) < maxBytes {
+			maxBytes = limit.(int64)
+		}
+
+		gz, err := gzip.NewReader(c.Request.Body)
+		if err != nil {
+			AbortWithError(c, models.NewError(http.StatusBadRequest, models.CodeValidationFailed, "Malformed gzip body"))
+			return
+		}
+		defer gz.Close()
+
+		// Read one byte past the limit to tell "exactly maxBytes" from "more"
+		body, err := io.ReadAll(io.LimitReader(gz, maxBytes+1))
+		if err != nil {
+			AbortWithError(c, models.NewError(http.StatusBadRequest, models.CodeValidationFailed, "Malformed gzip body"))
+			return
+		}
+		if int64(len(body)) > maxBytes {
+			AbortWithError(c, models.NewError(http.StatusRequestEntityTooLarge, models.CodePayloadTooLarge, fmt.Sprintf("Decompressed body exceeds %d bytes", maxBytes)).
+				WithDetails(map[string]interface{}{"max_bytes": maxBytes}))
+			return
+		}
+
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		c.Request.ContentLength = int64(len(body))
+		c.Request.Header.Del("Content-Encoding")
+		c.Request.Header.Set("Content-Length", fmt.Sprint(len(body)))
+		c.Next()
+	}
+}
@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func gzipped(t *testing.T, data []byte) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	gz.Close()
+	return &buf
+}
+
+func newDecompressRouter(maxBytes int64) *gin.Engine {
+	router := gin.New()
+	router.Use(DecompressBody(maxBytes))
+	router.POST("/echo", func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		c.Data(http.StatusOK, "application/octet-stream", body)
+	})
+	return router
+}
+
+func TestDecompressBodyInflatesGzip(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/echo", gzipped(t, []byte(`{"name":"Kai"}`)))
+	req.Header.Set("Content-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	newDecompressRouter(1024).ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK || w.Body.String() != `{"name":"Kai"}` {
+		t.Errorf("got %d %q, want the inflated body", w.Code, w.Body.String())
+	}
+}
+
+func TestDecompressBodyRejectsZipBomb(t *testing.T) {
+	// 1MB of zeros compresses to about a kilobyte
+	compressed := gzipped(t, make([]byte, 1<<20))
+	req := httptest.NewRequest(http.MethodPost, "/echo", compressed)
+	req.Header.Set("Content-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	newDecompressRouter(64<<10).ServeHTTP(w, req)
+
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d, want 413", w.Code)
+	}
+}
+
+func TestDecompressBodyHonorsRouteBodyLimit(t *testing.T) {
+	router := gin.New()
+	router.Use(BodyLimit(1<<20, WithRouteBodyLimits(map[string]int64{"/small": 1 << 10})), DecompressBody(64<<10))
+	echo := func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		c.Data(http.StatusOK, "application/octet-stream", body)
+	}
+	router.POST("/small", echo)
+	router.POST("/echo", echo)
+
+	// 4KB of zeros compresses well under either cap
+	for path, want := range map[string]int{"/small": http.StatusRequestEntityTooLarge, "/echo": http.StatusOK} {
+		req := httptest.NewRequest(http.MethodPost, path, gzipped(t, make([]byte, 4<<10)))
+		req.Header.Set("Content-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != want {
+			t.Errorf("%s: status = %d, want %d", path, w.Code, want)
+		}
+	}
+}
+
+func TestDecompressBodyRejectsUnknownEncoding(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/echo", bytes.NewReader([]byte("x")))
+	req.Header.Set("Content-Encoding", "br")
+	w := httptest.NewRecorder()
+	newDecompressRouter(1024).ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("status = %d, want 415", w.Code)
+	}
+}
@@ -0,0 +1,16 @@
+package middleware
+
+import "context"
+
+// SessionDeniedFunc reports whether access tokens issued in the session
+// with the given ID have been revoked
+type SessionDeniedFunc func(ctx context.Context, sessionID string) (bool, error)
+
+// WithSessionDenylist makes AuthRequired reject bearer tokens whose session
+// has been revoked with 401, so signing a device out takes effect before its
+// access token expires. Tokens issued outside a session are not checked.
+func WithSessionDenylist(denied SessionDeniedFunc) AuthOption {
+	return func(o *authOptions) {
+		o.denied = denied
+	}
+}
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cbwinslow/template2/examples/go/pkg/auth"
+)
+
+func TestWithSessionDenylistRejectsSignedOutSessions(t *testing.T) {
+	ctx := context.Background()
+	svc := auth.NewAuthService()
+	router := newAuthRouter(svc, WithSessionDenylist(svc.SessionRevoked))
+	get := func(token string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/profile", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	kept, _ := svc.IssueTokenPair(ctx, 4, "ivo@example.com", "user")
+	ended, _ := svc.IssueTokenPair(ctx, 4, "ivo@example.com", "user")
+	if err := svc.RevokeRefreshToken(ctx, ended.RefreshToken); err != nil {
+		t.Fatalf("RevokeRefreshToken: %v", err)
+	}
+	plain, _ := svc.GenerateToken(ctx, 4, "ivo@example.com", "user")
+
+	if status := get(ended.AccessToken); status != http.StatusUnauthorized {
+		t.Errorf("signed-out session: status = %d, want 401", status)
+	}
+	if status := get(kept.AccessToken); status != http.StatusOK {
+		t.Errorf("other session: status = %d, want 200", status)
+	}
+	if status := get(plain); status != http.StatusOK {
+		t.Errorf("token without a session: status = %d, want 200", status)
+	}
+}
@@ -0,0 +1,153 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// ExperimentsHeader echoes the variants assigned to a request
+	ExperimentsHeader = "X-Experiments"
+	// ExperimentCookie identifies anonymous clients for stable assignment
+	ExperimentCookie = "exp_id"
+
+	experimentsKey = "experiments"
+)
+
+// Variant is one arm of an experiment receiving Percent of traffic
+type Variant struct {
+	Name    string
+	Percent int
+}
+
+// Experiment is a set of variants whose percentages add up to at most 100.
+// Traffic not covered by a variant gets no assignment.
+type Experiment struct {
+	Name     string
+	Variants []Variant
+}
+
+// Experiments assigns every request to a variant of each experiment. The
+// assignment is a hash of the experiment name and the authenticated user
+// ID, or the exp_id cookie for anonymous clients (issued on first visit), so
+// the same client always lands in the same variant. It is made when a
+// handler first asks for a variant, or else when the response is written,
+// so the middleware may run ahead of authentication, and echoed in the
+// X-Experiments header.
+func Experiments(experiments []Experiment) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if len(experiments) == 0 {
+			c.Next()
+			return
+		}
+
+		w := &experimentWriter{ResponseWriter: c.Writer, c: c, experiments: experiments}
+		c.Writer = w
+		c.Set(experimentsKey, w)
+		c.Next()
+		// A response without a body is sent after the middleware returns
+		if !c.Writer.Written() {
+			w.assign()
+		}
+	}
+}
+
+// ExperimentVariant returns the variant of the named experiment assigned to
+// the request, or an empty string if none was assigned
+func ExperimentVariant(c *gin.Context, experiment string) string {
+	value, _ := c.Get(experimentsKey)
+	w, ok := value.(*experimentWriter)
+	if !ok {
+		return ""
+	}
+	return w.assign()[experiment]
+}
+
+// experimentWriter assigns the request's variants, by then knowing its user,
+// before the response headers are sent
+type experimentWriter struct {
+	gin.ResponseWriter
+	c           *gin.Context
+	experiments []Experiment
+	assigned    map[string]string
+}
+
+// assign makes the assignments once and returns them
+func (w *experimentWriter) assign() map[string]string {
+	if w.assigned != nil {
+		return w.assigned
+	}
+	key := experimentKey(w.c)
+	w.assigned = make(map[string]string, len(w.experiments))
+	header := make([]string, 0, len(w.experiments))
+	for _, exp := range w.experiments {
+		if variant := exp.assign(key); variant != "" {
+			w.assigned[exp.Name] = variant
+			header = append(header, exp.Name+"="+variant)
+		}
+	}
+	if len(header) > 0 {
+		w.Header().Set(ExperimentsHeader, strings.Join(header, ", "))
+	}
+	return w.assigned
+}
+
+func (w *experimentWriter) Write(b []byte) (int, error) {
+	w.assign()
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *experimentWriter) WriteString(s string) (int, error) {
+	w.assign()
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *experimentWriter) WriteHeaderNow() {
+	w.assign()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *experimentWriter) Flush() {
+	w.assign()
+	w.ResponseWriter.Flush()
+}
+
+func experimentKey(c *gin.Context) string {
+	if userID, ok := GetUserID(c); ok {
+		return "user:" + strconv.Itoa(userID)
+	}
+	if cookie, err := c.Cookie(ExperimentCookie); err == nil && cookie != "" {
+		return "anon:" + cookie
+	}
+
+	id := newRequestID()
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     ExperimentCookie,
+		Value:    id,
+		Path:     "/",
+		MaxAge:   365 * 24 * 60 * 60,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return "anon:" + id
+}
+
+// assign maps key to a bucket in [0, 100) and returns the variant owning it
+func (e Experiment) assign(key string) string {
+	sum := sha256.Sum256([]byte(e.Name + "\x00" + key))
+	bucket := int(binary.BigEndian.Uint64(sum[:8]) % 100)
+
+	cumulative := 0
+	for _, variant := range e.Variants {
+		cumulative += variant.Percent
+		if bucket < cumulative {
+			return variant.Name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/cbwinslow/template2/examples/go/pkg/auth"
+)
+
+func newExperimentRouter(experiments []Experiment) *gin.Engine {
+	router := gin.New()
+	router.Use(Experiments(experiments))
+	router.GET("/", func(c *gin.Context) {
+		c.String(http.StatusOK, ExperimentVariant(c, "list-view"))
+	})
+	return router
+}
+
+func TestExperimentsAssignStablyForSameKey(t *testing.T) {
+	router := newExperimentRouter([]Experiment{{
+		Name:     "list-view",
+		Variants: []Variant{{Name: "control", Percent: 50}, {Name: "summary", Percent: 50}},
+	}})
+
+	var first string
+	for i := 0; i < 5; i++ {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.AddCookie(&http.Cookie{Name: ExperimentCookie, Value: "client-42"})
+		router.ServeHTTP(w, req)
+
+		variant := w.Body.String()
+		if variant != "control" && variant != "summary" {
+			t.Fatalf("variant = %q, want control or summary", variant)
+		}
+		if i == 0 {
+			first = variant
+		} else if variant != first {
+			t.Fatalf("request %d got %q, want stable %q", i+1, variant, first)
+		}
+		if got := w.Header().Get(ExperimentsHeader); got != "list-view="+first {
+			t.Errorf("%s = %q, want list-view=%s", ExperimentsHeader, got, first)
+		}
+	}
+}
+
+func TestExperimentsIssueCookieForNewClients(t *testing.T) {
+	router := newExperimentRouter([]Experiment{{
+		Name:     "list-view",
+		Variants: []Variant{{Name: "summary", Percent: 100}},
+	}})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if w.Body.String() != "summary" {
+		t.Errorf("variant = %q, want summary for a 100%% rollout", w.Body.String())
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != ExperimentCookie || cookies[0].Value == "" {
+		t.Errorf("cookies = %v, want a fresh %s cookie", cookies, ExperimentCookie)
+	}
+}
+
+func TestExperimentsPreferUserID(t *testing.T) {
+	exp := Experiment{Name: "list-view", Variants: []Variant{{Name: "a", Percent: 50}, {Name: "b", Percent: 50}}}
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Set(userIDKey, 7) }, Experiments([]Experiment{exp}))
+	router.GET("/", func(c *gin.Context) {
+		c.String(http.StatusOK, ExperimentVariant(c, "list-view"))
+	})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(&http.Cookie{Name: ExperimentCookie, Value: "ignored"})
+	router.ServeHTTP(w, req)
+
+	if want := exp.assign("user:7"); w.Body.String() != want {
+		t.Errorf("variant = %q, want user-keyed %q", w.Body.String(), want)
+	}
+	if len(w.Result().Cookies()) != 0 {
+		t.Error("authenticated requests should not be issued a cookie")
+	}
+}
+
+func TestExperimentsAssignAfterAuthentication(t *testing.T) {
+	// Mounted ahead of authentication, as on the API group
+	exp := Experiment{Name: "list-view", Variants: []Variant{{Name: "a", Percent: 50}, {Name: "b", Percent: 50}}}
+	svc := auth.NewAuthService()
+	router := gin.New()
+	router.Use(Experiments([]Experiment{exp}), AuthRequired(svc))
+	router.GET("/", func(c *gin.Context) {
+		c.String(http.StatusOK, ExperimentVariant(c, "list-view"))
+	})
+	router.DELETE("/", func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	token, _ := svc.GenerateToken(context.Background(), 7, "gina@example.com", "user")
+	want := exp.assign("user:7")
+
+	for _, method := range []string{http.MethodGet, http.MethodDelete} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		router.ServeHTTP(w, req)
+
+		if method == http.MethodGet && w.Body.String() != want {
+			t.Errorf("variant = %q, want user-keyed %q", w.Body.String(), want)
+		}
+		if got := w.Header().Get(ExperimentsHeader); got != "list-view="+want {
+			t.Errorf("%s: %s = %q, want list-view=%s", method, ExperimentsHeader, got, want)
+		}
+		if len(w.Result().Cookies()) != 0 {
+			t.Errorf("%s: authenticated request issued a cookie", method)
+		}
+	}
+}
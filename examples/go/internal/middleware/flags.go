@@ -0,0 +1,20 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/cbwinslow/template2/examples/go/pkg/flags"
+)
+
+// FeatureFlags lets handlers check flags with flags.Enabled on the request
+// context. Percentage rollouts are keyed on the authenticated user, looked
+// up at each check, so the middleware may run ahead of authentication. As
+// the context is pooled, checks must not outlive the request.
+func FeatureFlags(client *flags.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request = c.Request.WithContext(flags.NewContext(c.Request.Context(), client, func() (int, bool) {
+			return GetUserID(c)
+		}))
+		c.Next()
+	}
+}
@@ -0,0 +1,247 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+)
+
+const (
+	// IdempotencyKeyHeader carries the client's key for a retried write
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// maxIdempotencyKey bounds the keys accepted, which end up in store keys
+	maxIdempotencyKey = 255
+	// defaultIdempotencyLock is how long a claim is held when the request
+	// holding it never completes, such as when its replica dies
+	defaultIdempotencyLock = time.Minute
+)
+
+// IdempotencyRecord is what a store holds for a key: the fingerprint of
+// the request that claimed it and, once that request completed, its
+// response
+type IdempotencyRecord struct {
+	Fingerprint string          `json:"fingerprint"`
+	Response    *CachedResponse `json:"response,omitempty"`
+}
+
+// IdempotencyStore holds the records of requests made with an
+// Idempotency-Key
+type IdempotencyStore interface {
+	// Claim records fingerprint as in flight under key for lock, unless
+	// key is already held; then it returns the record held instead and
+	// claimed is false
+	Claim(ctx context.Context, key, fingerprint string, lock time.Duration) (record IdempotencyRecord, claimed bool, err error)
+	// Complete replaces the claim on key with record, kept for ttl
+	Complete(ctx context.Context, key string, record IdempotencyRecord, ttl time.Duration) error
+	// Release drops the claim on key so the request can be retried
+	Release(ctx context.Context, key string) error
+}
+
+// MemoryIdempotencyStore is a per-replica IdempotencyStore. Retries landing
+// on another replica are not recognized; share a RedisIdempotencyStore
+// between replicas instead.
+type MemoryIdempotencyStore struct {
+	mu        sync.Mutex
+	records   map[string]memoryIdempotencyRecord
+	lastSweep time.Time
+}
+
+type memoryIdempotencyRecord struct {
+	record  IdempotencyRecord
+	expires time.Time
+}
+
+// NewMemoryIdempotencyStore creates an empty in-memory store
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{records: make(map[string]memoryIdempotencyRecord), lastSweep: time.Now()}
+}
+
+// Claim implements IdempotencyStore
+func (s *MemoryIdempotencyStore) Claim(_ context.Context, key, fingerprint string, lock time.Duration) (IdempotencyRecord, bool, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(now, lock)
+	if entry, ok := s.records[key]; ok && now.Before(entry.expires) {
+		return entry.record, false, nil
+	}
+	record := IdempotencyRecord{Fingerprint: fingerprint}
+	s.records[key] = memoryIdempotencyRecord{record: record, expires: now.Add(lock)}
+	return record, true, nil
+}
+
+// Complete implements IdempotencyStore
+func (s *MemoryIdempotencyStore) Complete(_ context.Context, key string, record IdempotencyRecord, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[key] = memoryIdempotencyRecord{record: record, expires: time.Now().Add(ttl)}
+	return nil
+}
+
+// Release implements IdempotencyStore
+func (s *MemoryIdempotencyStore) Release(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, key)
+	return nil
+}
+
+// sweep drops expired records, at most once per every. Callers must hold
+// s.mu.
+func (s *MemoryIdempotencyStore) sweep(now time.Time, every time.Duration) {
+	if now.Sub(s.lastSweep) < every {
+		return
+	}
+	for key, entry := range s.records {
+		if !now.Before(entry.expires) {
+			delete(s.records, key)
+		}
+	}
+	s.lastSweep = now
+}
+
+// IdempotencyOption configures Idempotency
+type IdempotencyOption func(*idempotencyOptions)
+
+type idempotencyOptions struct {
+	lock   time.Duration
+	logger *zap.Logger
+}
+
+// WithIdempotencyLock sets how long a request holds its key before a
+// duplicate may run again when the request never completes. It should
+// exceed the longest request; the default is a minute.
+func WithIdempotencyLock(lock time.Duration) IdempotencyOption {
+	return func(o *idempotencyOptions) {
+		o.lock = lock
+	}
+}
+
+// WithIdempotencyLogger logs store failures to logger
+func WithIdempotencyLogger(logger *zap.Logger) IdempotencyOption {
+	return func(o *idempotencyOptions) {
+		o.logger = logger
+	}
+}
+
+// Idempotency makes POST, PUT and PATCH requests carrying an
+// Idempotency-Key safe to retry. The first request with a key runs and its
+// response is kept for ttl; repeats get that response replayed with
+// Idempotent-Replayed: true instead of running again. A repeat arriving
+// while the first is still running is answered with 409, and reusing a key
+// for a different body with 422. Keys are scoped to the user, method and
+// path, so it must run after the auth middleware; anonymous requests are
+// passed through, having no caller to scope them to. Responses of 5xx and
+// 429 are not kept, leaving the key free for a retry that may succeed.
+//
+// A store failure is answered with 503 rather than running the request
+// unguarded, since that is the duplicate the client sent the key to avoid.
+func Idempotency(store IdempotencyStore, ttl time.Duration, opts ...IdempotencyOption) gin.HandlerFunc {
+	options := idempotencyOptions{lock: defaultIdempotencyLock, logger: zap.NewNop()}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		unsafe := c.Request.Method == http.MethodPost || c.Request.Method == http.MethodPut || c.Request.Method == http.MethodPatch
+		userID, authenticated := GetUserID(c)
+		if key == "" || !unsafe || !authenticated {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKey {
+			AbortWithError(c, models.NewError(http.StatusBadRequest, models.CodeValidationFailed,
+				"Idempotency-Key must be at most "+strconv.Itoa(maxIdempotencyKey)+" characters"))
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			apiErr := models.NewError(http.StatusBadRequest, models.CodeValidationFailed, "Failed to read the request body")
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				apiErr = models.NewError(http.StatusRequestEntityTooLarge, models.CodePayloadTooLarge,
+					"Request body exceeds "+strconv.FormatInt(tooLarge.Limit, 10)+" bytes")
+			}
+			AbortWithError(c, apiErr)
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		sum := sha256.Sum256(body)
+		fingerprint := hex.EncodeToString(sum[:])
+
+		ctx := c.Request.Context()
+		storeKey := idempotencyKey(userID, c.Request.Method, c.Request.URL.Path, key)
+		record, claimed, err := store.Claim(ctx, storeKey, fingerprint, options.lock)
+		if err != nil {
+			options.logger.Error("Idempotency store unavailable",
+				zap.String("request_id", GetRequestID(c)), zap.Error(err))
+			AbortWithError(c, models.NewError(http.StatusServiceUnavailable, models.CodeUnavailable, "Idempotency keys cannot be checked right now; retry later"))
+			return
+		}
+		if !claimed {
+			switch {
+			case record.Fingerprint != fingerprint:
+				AbortWithError(c, models.NewError(http.StatusUnprocessableEntity, models.CodeIdempotencyKeyReused,
+					"Idempotency-Key was already used for a different request"))
+			case record.Response == nil:
+				c.Header("Retry-After", "1")
+				AbortWithError(c, models.NewError(http.StatusConflict, models.CodeIdempotencyKeyInUse,
+					"A request with this Idempotency-Key is still being processed"))
+			default:
+				header := c.Writer.Header()
+				for name, values := range record.Response.Header {
+					header[name] = values
+				}
+				header.Set("Idempotent-Replayed", "true")
+				c.Status(record.Response.Status)
+				_, _ = c.Writer.Write(record.Response.Body)
+				c.Abort()
+			}
+			return
+		}
+
+		before := c.Writer.Header().Clone()
+		recorder := &bodyRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		// The request may have been cancelled; the record must still land
+		ctx = context.WithoutCancel(ctx)
+		status := recorder.Status()
+		if status >= http.StatusInternalServerError || status == http.StatusTooManyRequests {
+			if err := store.Release(ctx, storeKey); err != nil {
+				options.logger.Warn("Failed to release idempotency key",
+					zap.String("request_id", GetRequestID(c)), zap.Error(err))
+			}
+			return
+		}
+		response := &CachedResponse{Status: status, Header: recordedHeader(c, before, recorder.Header()), Body: recorder.body.Bytes()}
+		if err := store.Complete(ctx, storeKey, IdempotencyRecord{Fingerprint: fingerprint, Response: response}, ttl); err != nil {
+			options.logger.Error("Failed to record idempotent response",
+				zap.String("request_id", GetRequestID(c)), zap.Error(err))
+		}
+	}
+}
+
+// idempotencyKey scopes key to the user and the method and path it was
+// sent to. Scoping by user rather than token lets a key survive a token
+// refresh.
+func idempotencyKey(userID int, method, path, key string) string {
+	return strconv.Itoa(userID) + " " + method + " " + path + " " + key
+}
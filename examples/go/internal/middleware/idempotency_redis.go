@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisIdempotencyStore is an IdempotencyStore shared by every replica
+// connected to the same Redis, so a retry is recognized wherever the load
+// balancer sends it
+type RedisIdempotencyStore struct {
+	client redis.Cmdable
+	prefix string
+}
+
+// NewRedisIdempotencyStore creates a store keeping its records in client
+// under keys starting with prefix
+func NewRedisIdempotencyStore(client redis.Cmdable, prefix string) *RedisIdempotencyStore {
+	return &RedisIdempotencyStore{client: client, prefix: prefix}
+}
+
+// Claim implements IdempotencyStore. SET NX makes the claim atomic across
+// replicas.
+func (s *RedisIdempotencyStore) Claim(ctx context.Context, key, fingerprint string, lock time.Duration) (IdempotencyRecord, bool, error) {
+	claim := IdempotencyRecord{Fingerprint: fingerprint}
+	data, err := json.Marshal(claim)
+	if err != nil {
+		return IdempotencyRecord{}, false, fmt.Errorf("idempotency: encode record: %w", err)
+	}
+
+	// A record expiring between the two calls is claimed on the next try
+	for attempt := 0; attempt < 2; attempt++ {
+		claimed, err := s.client.SetNX(ctx, s.prefix+key, data, lock).Result()
+		if err != nil {
+			return IdempotencyRecord{}, false, fmt.Errorf("idempotency: redis: %w", err)
+		}
+		if claimed {
+			return claim, true, nil
+		}
+
+		held, err := s.client.Get(ctx, s.prefix+key).Bytes()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			return IdempotencyRecord{}, false, fmt.Errorf("idempotency: redis: %w", err)
+		}
+		var record IdempotencyRecord
+		if err := json.Unmarshal(held, &record); err != nil {
+			return IdempotencyRecord{}, false, fmt.Errorf("idempotency: decode record: %w", err)
+		}
+		return record, false, nil
+	}
+	return IdempotencyRecord{}, false, errors.New("idempotency: key kept expiring while claimed")
+}
+
+// Complete implements IdempotencyStore
+func (s *RedisIdempotencyStore) Complete(ctx context.Context, key string, record IdempotencyRecord, ttl time.Duration) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("idempotency: encode record: %w", err)
+	}
+	if err := s.client.Set(ctx, s.prefix+key, data, ttl).Err(); err != nil {
+		return fmt.Errorf("idempotency: redis: %w", err)
+	}
+	return nil
+}
+
+// Release implements IdempotencyStore
+func (s *RedisIdempotencyStore) Release(ctx context.Context, key string) error {
+	if err := s.client.Del(ctx, s.prefix+key).Err(); err != nil {
+		return fmt.Errorf("idempotency: redis: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// newIdempotentRouter serves POST /orders as user 1 behind Idempotency
+func newIdempotentRouter(store IdempotencyStore, handler gin.HandlerFunc) *gin.Engine {
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Set(userIDKey, 1) })
+	router.Use(Idempotency(store, time.Hour))
+	router.POST("/orders", handler)
+	return router
+}
+
+func postOrder(router *gin.Engine, key, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body))
+	req.Header.Set(IdempotencyKeyHeader, key)
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestIdempotencyReplaysFirstResponse(t *testing.T) {
+	calls := 0
+	router := newIdempotentRouter(NewMemoryIdempotencyStore(), func(c *gin.Context) {
+		calls++
+		c.Header("Location", "/orders/"+strconv.Itoa(calls))
+		c.JSON(http.StatusCreated, gin.H{"id": calls})
+	})
+
+	first := postOrder(router, "k1", `{"item":"lamp"}`)
+	second := postOrder(router, "k1", `{"item":"lamp"}`)
+	if calls != 1 {
+		t.Fatalf("handler ran %d times, want 1", calls)
+	}
+	if second.Code != http.StatusCreated || second.Body.String() != first.Body.String() ||
+		second.Header().Get("Location") != "/orders/1" || second.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("replay = %d %v %s, want the first response", second.Code, second.Header(), second.Body.String())
+	}
+
+	if w := postOrder(router, "k2", `{"item":"lamp"}`); w.Code != http.StatusCreated || calls != 2 {
+		t.Errorf("new key: %d after %d calls, want the handler run again", w.Code, calls)
+	}
+}
+
+func TestIdempotencyBeneathCompressRecordsThePlainBody(t *testing.T) {
+	want := strings.Repeat(`{"item":"lamp"},`, 250)
+	calls := 0
+	router := gin.New()
+	router.Use(Compress())
+	router.Use(func(c *gin.Context) { c.Set(userIDKey, 1) })
+	router.Use(Idempotency(NewMemoryIdempotencyStore(), time.Hour))
+	router.POST("/orders", func(c *gin.Context) {
+		calls++
+		c.String(http.StatusCreated, want)
+	})
+
+	for _, accept := range []string{"br", "", "gzip"} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{"item":"lamp"}`))
+		req.Header.Set(IdempotencyKeyHeader, "k1")
+		req.Header.Set("Accept-Encoding", accept)
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusCreated || w.Header().Get("Content-Encoding") != accept {
+			t.Errorf("Accept-Encoding %q: %d with Content-Encoding %q", accept, w.Code, w.Header().Get("Content-Encoding"))
+			continue
+		}
+		if decodeBody(t, w) != want {
+			t.Errorf("Accept-Encoding %q: decoded body differs", accept)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("handler ran %d times, want 1", calls)
+	}
+}
+
+func TestIdempotencyRejectsReusedKeyAndInFlightDuplicate(t *testing.T) {
+	started, finish := make(chan struct{}), make(chan struct{})
+	router := newIdempotentRouter(NewMemoryIdempotencyStore(), func(c *gin.Context) {
+		close(started)
+		<-finish
+		c.Status(http.StatusNoContent)
+	})
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- postOrder(router, "k1", `{"item":"lamp"}`) }()
+	<-started
+
+	w := postOrder(router, "k1", `{"item":"lamp"}`)
+	if w.Code != http.StatusConflict || w.Header().Get("Retry-After") == "" {
+		t.Errorf("in-flight duplicate: %d, want 409 with Retry-After", w.Code)
+	}
+	if w := postOrder(router, "k1", `{"item":"desk"}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("different body: %d, want 422", w.Code)
+	}
+
+	close(finish)
+	if w := <-done; w.Code != http.StatusNoContent {
+		t.Errorf("first request: %d", w.Code)
+	}
+}
+
+func TestIdempotencyReleasesKeyAfterServerError(t *testing.T) {
+	calls := 0
+	router := newIdempotentRouter(NewMemoryIdempotencyStore(), func(c *gin.Context) {
+		calls++
+		if calls == 1 {
+			c.Status(http.StatusServiceUnavailable)
+			return
+		}
+		c.Status(http.StatusCreated)
+	})
+
+	postOrder(router, "k1", `{}`)
+	if w := postOrder(router, "k1", `{}`); w.Code != http.StatusCreated || calls != 2 {
+		t.Errorf("retry after 503: %d after %d calls, want the handler run again", w.Code, calls)
+	}
+}
+
+func TestIdempotencyPassesAnonymousRequests(t *testing.T) {
+	calls := 0
+	router := gin.New()
+	router.Use(Idempotency(NewMemoryIdempotencyStore(), time.Hour))
+	router.POST("/orders", func(c *gin.Context) {
+		calls++
+		c.Status(http.StatusCreated)
+	})
+
+	postOrder(router, "k1", `{}`)
+	postOrder(router, "k1", `{}`)
+	if calls != 2 {
+		t.Errorf("handler ran %d times, want anonymous callers never to share a key", calls)
+	}
+}
+
+func TestRedisIdempotencyStoreSharesClaims(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	newStore := func() *RedisIdempotencyStore {
+		client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+		t.Cleanup(func() { client.Close() })
+		return NewRedisIdempotencyStore(client, "idempotency:")
+	}
+	first, second := newStore(), newStore()
+
+	if _, claimed, err := first.Claim(ctx, "k1", "abc", time.Minute); !claimed || err != nil {
+		t.Fatalf("first Claim = %v, %v", claimed, err)
+	}
+	record, claimed, err := second.Claim(ctx, "k1", "abc", time.Minute)
+	if claimed || err != nil || record.Fingerprint != "abc" || record.Response != nil {
+		t.Fatalf("Claim on the other replica = %+v, %v, %v; want the in-flight claim", record, claimed, err)
+	}
+
+	response := &CachedResponse{Status: http.StatusCreated, Header: http.Header{"Location": {"/orders/1"}}, Body: []byte(`{"id":1}`)}
+	if err := first.Complete(ctx, "k1", IdempotencyRecord{Fingerprint: "abc", Response: response}, time.Hour); err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	record, _, err = second.Claim(ctx, "k1", "abc", time.Minute)
+	if err != nil || record.Response == nil || string(record.Response.Body) != `{"id":1}` {
+		t.Fatalf("Claim after Complete = %+v, %v", record, err)
+	}
+
+	if err := second.Release(ctx, "k1"); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	if _, claimed, err := first.Claim(ctx, "k1", "def", time.Minute); !claimed || err != nil {
+		t.Errorf("Claim after Release = %v, %v; want it claimed", claimed, err)
+	}
+
+	server.Close()
+	if _, _, err := first.Claim(ctx, "k2", "abc", time.Minute); err == nil {
+		t.Error("Claim with Redis down: want an error")
+	}
+}
@@ -0,0 +1,188 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultRedactFields are the field names whose values body capture always
+// masks. A field is masked when its name contains one of them, ignoring
+// case, so "password" also covers "new_password" and "key" covers
+// "api_key". provisioning_uri carries the TOTP secret.
+var DefaultRedactFields = []string{
+	"password", "token", "secret", "key", "email", "authorization",
+	"cookie", "recovery_codes", "provisioning_uri",
+}
+
+// redacted replaces the value of every masked field
+const redacted = "REDACTED"
+
+const (
+	// bodyCaptureKey holds the Logger's *bodyCapture while it captures
+	// bodies
+	bodyCaptureKey = "body_capture"
+	// responseCaptureKey holds the recorder CaptureResponseBody installed
+	responseCaptureKey = "response_capture"
+)
+
+// CaptureResponseBody records response bodies for the body capture of
+// Logger beneath middleware that encodes them, such as Compress, which
+// Logger runs ahead of and so only sees encoded bytes. Mount it right after
+// that middleware; it does nothing unless Logger captures bodies.
+func CaptureResponseBody() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, ok := c.Get(bodyCaptureKey)
+		if !ok {
+			c.Next()
+			return
+		}
+		recorder := &cappedRecorder{ResponseWriter: c.Writer, limit: value.(*bodyCapture).maxBytes + 1}
+		c.Writer = recorder
+		c.Set(responseCaptureKey, recorder)
+		c.Next()
+	}
+}
+
+// bodyCapture logs request and response bodies of up to maxBytes with the
+// values of redacted fields masked
+type bodyCapture struct {
+	maxBytes int
+	redact   []string
+}
+
+// capturedBody is a request body whose captured head is put back in front
+// of the unread rest
+type capturedBody struct {
+	io.Reader
+	io.Closer
+}
+
+// captureRequest reads up to maxBytes+1 bytes of a JSON or form request
+// body, putting them back in front of the rest for the handler. Other
+// bodies, such as uploads, are not read.
+func (b *bodyCapture) captureRequest(r *http.Request) []byte {
+	if r.Body == nil || r.Body == http.NoBody || r.Header.Get("Content-Encoding") != "" || !loggableBody(r.Header.Get("Content-Type")) {
+		return nil
+	}
+	head, err := io.ReadAll(io.LimitReader(r.Body, int64(b.maxBytes)+1))
+	r.Body = capturedBody{Reader: io.MultiReader(bytes.NewReader(head), r.Body), Closer: r.Body}
+	if err != nil {
+		return nil
+	}
+	return head
+}
+
+// format returns the body as it is logged: JSON and form bodies with
+// redacted fields masked, or a note saying why the body was left out. It
+// returns "" when there is nothing to log.
+func (b *bodyCapture) format(header http.Header, body []byte) string {
+	if len(body) == 0 || !loggableBody(header.Get("Content-Type")) {
+		return ""
+	}
+	if header.Get("Content-Encoding") != "" {
+		return "(omitted: compressed)"
+	}
+	if len(body) > b.maxBytes {
+		return "(omitted: larger than " + strconv.Itoa(b.maxBytes) + " bytes)"
+	}
+	mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	if mediaType == "application/x-www-form-urlencoded" {
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return "(omitted: invalid form)"
+		}
+		for name := range values {
+			if b.redacts(name) {
+				values[name] = []string{redacted}
+			}
+		}
+		return values.Encode()
+	}
+
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return "(omitted: invalid JSON)"
+	}
+	masked, err := json.Marshal(b.redactJSON(value))
+	if err != nil {
+		return "(omitted: invalid JSON)"
+	}
+	return string(masked)
+}
+
+// redactJSON masks the values of redacted fields at any depth
+func (b *bodyCapture) redactJSON(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for name, field := range v {
+			if b.redacts(name) {
+				v[name] = redacted
+			} else {
+				v[name] = b.redactJSON(field)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = b.redactJSON(item)
+		}
+	}
+	return value
+}
+
+func (b *bodyCapture) redacts(name string) bool {
+	name = strings.ToLower(name)
+	for _, field := range b.redact {
+		if strings.Contains(name, field) {
+			return true
+		}
+	}
+	return false
+}
+
+// loggableBody reports whether bodies of contentType are JSON or URL-encoded
+// forms, the only ones redaction understands
+func loggableBody(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") ||
+		mediaType == "application/x-www-form-urlencoded"
+}
+
+// cappedRecorder keeps up to limit bytes of the response body while still
+// writing all of it to the client
+type cappedRecorder struct {
+	gin.ResponseWriter
+	limit int
+	body  bytes.Buffer
+}
+
+func (w *cappedRecorder) Write(b []byte) (int, error) {
+	w.keep(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *cappedRecorder) WriteString(s string) (int, error) {
+	w.keep([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *cappedRecorder) keep(b []byte) {
+	if room := w.limit - w.body.Len(); room > 0 {
+		if len(b) > room {
+			b = b[:room]
+		}
+		w.body.Write(b)
+	}
+}
@@ -0,0 +1,224 @@
+package middleware
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// logFieldsKey holds the fields added with AddLogField
+const logFieldsKey = "log_fields"
+
+// AddLogField attaches key=value to the access log entry written when the
+// request completes, so handlers can enrich it without logging themselves.
+// It is not safe to call from goroutines spawned by the handler.
+func AddLogField(c *gin.Context, key string, value interface{}) {
+	fields, _ := c.Get(logFieldsKey)
+	existing, _ := fields.([]zap.Field)
+	c.Set(logFieldsKey, append(existing, zap.Any(key, value)))
+}
+
+// LoggerOption configures the Logger middleware
+type LoggerOption func(*loggerOptions)
+
+type loggerOptions struct {
+	accessLog *lockedWriter
+	bodies    *bodyCapture
+}
+
+// WithCombinedLog additionally writes each request to w in Apache Combined
+// Log Format, for pipelines that expect classic access logs
+func WithCombinedLog(w io.Writer) LoggerOption {
+	return func(o *loggerOptions) {
+		o.accessLog = &lockedWriter{w: w}
+	}
+}
+
+// WithBodyCapture adds JSON and form request and response bodies of up to
+// maxBytes to each entry as request_body and response_body. Values of
+// fields named in DefaultRedactFields or redactFields are masked, matching
+// names containing them in any case; larger bodies and other content types
+// are left out. Compressed responses are noted as omitted unless
+// CaptureResponseBody runs beneath the compression. Bodies are rarely
+// needed outside debugging, and even redacted they are worth keeping out of
+// production logs.
+func WithBodyCapture(maxBytes int, redactFields ...string) LoggerOption {
+	return func(o *loggerOptions) {
+		redact := make([]string, 0, len(DefaultRedactFields)+len(redactFields))
+		for _, field := range append(DefaultRedactFields[:len(DefaultRedactFields):len(DefaultRedactFields)], redactFields...) {
+			redact = append(redact, strings.ToLower(field))
+		}
+		o.bodies = &bodyCapture{maxBytes: maxBytes, redact: redact}
+	}
+}
+
+// lockedWriter serializes writes so concurrent requests don't interleave lines
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) WriteString(s string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, _ = io.WriteString(l.w, s)
+}
+
+// Logger writes one structured access log entry per request
+func Logger(logger *zap.Logger, opts ...LoggerOption) gin.HandlerFunc {
+	var options loggerOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	return func(c *gin.Context) {
+		start := time.Now()
+		path := c.Request.URL.Path
+		query := redactQuery(c.Request.URL.RawQuery)
+		var requestBody []byte
+		var response *cappedRecorder
+		if options.bodies != nil {
+			requestBody = options.bodies.captureRequest(c.Request)
+			response = &cappedRecorder{ResponseWriter: c.Writer, limit: options.bodies.maxBytes + 1}
+			c.Writer = response
+			c.Set(bodyCaptureKey, options.bodies)
+		}
+
+		c.Next()
+
+		if options.accessLog != nil {
+			options.accessLog.WriteString(combinedLogLine(c, start))
+		}
+
+		fields := []zap.Field{
+			zap.Int("status", c.Writer.Status()),
+			zap.String("method", c.Request.Method),
+			zap.String("path", path),
+			zap.String("query", query),
+			zap.String("ip", c.ClientIP()),
+			zap.String("user_agent", c.Request.UserAgent()),
+			zap.Duration("latency", time.Since(start)),
+			zap.Int("bytes", c.Writer.Size()),
+		}
+		if id := GetRequestID(c); id != "" {
+			fields = append(fields, zap.String("request_id", id))
+		}
+		if c.GetBool(requestIDReusedKey) {
+			fields = append(fields, zap.Bool("request_id_reused", true))
+		}
+		if extra, ok := c.Get(logFieldsKey); ok {
+			fields = append(fields, extra.([]zap.Field)...)
+		}
+		if options.bodies != nil {
+			if body := options.bodies.format(c.Request.Header, requestBody); body != "" {
+				fields = append(fields, zap.String("request_body", body))
+			}
+			header, body := c.Writer.Header(), response.body.Bytes()
+			if inner, ok := c.Get(responseCaptureKey); ok {
+				// Captured before encoding
+				header = header.Clone()
+				header.Del("Content-Encoding")
+				body = inner.(*cappedRecorder).body.Bytes()
+			}
+			if body := options.bodies.format(header, body); body != "" {
+				fields = append(fields, zap.String("response_body", body))
+			}
+		}
+		if len(c.Errors) > 0 {
+			fields = append(fields, zap.String("errors", c.Errors.ByType(gin.ErrorTypePrivate).String()))
+		}
+
+		switch status := c.Writer.Status(); {
+		case status >= 500:
+			logger.Error("Request completed", fields...)
+		case status >= 400:
+			logger.Warn("Request completed", fields...)
+		default:
+			logger.Info("Request completed", fields...)
+		}
+	}
+}
+
+// combinedLogLine formats the request in Combined Log Format:
+//
+//	host ident authuser [date] "request" status bytes "referer" "user-agent"
+func combinedLogLine(c *gin.Context, start time.Time) string {
+	user := "-"
+	if id, ok := GetUserID(c); ok {
+		user = strconv.Itoa(id)
+	}
+
+	size := "-"
+	if n := c.Writer.Size(); n > 0 {
+		size = strconv.Itoa(n)
+	}
+
+	referer := c.Request.Referer()
+	if referer == "" {
+		referer = "-"
+	}
+	userAgent := c.Request.UserAgent()
+	if userAgent == "" {
+		userAgent = "-"
+	}
+
+	return fmt.Sprintf("%s - %s [%s] \"%s %s %s\" %d %s \"%s\" \"%s\"\n",
+		c.ClientIP(),
+		user,
+		start.Format("02/Jan/2006:15:04:05 -0700"),
+		c.Request.Method,
+		escapeLogField(redactRequestURI(c.Request.RequestURI)),
+		c.Request.Proto,
+		c.Writer.Status(),
+		size,
+		escapeLogField(referer),
+		escapeLogField(userAgent),
+	)
+}
+
+// escapeLogField escapes quotes, backslashes and control characters so a
+// client cannot break the line structure
+func escapeLogField(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&b, "\\x%02x", r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// redactQuery masks the access_token parameter accepted on WebSocket
+// handshakes so tokens never reach the access logs
+func redactQuery(raw string) string {
+	if !strings.Contains(raw, webSocketTokenParam+"=") {
+		return raw
+	}
+	params := strings.Split(raw, "&")
+	for i, param := range params {
+		if strings.HasPrefix(param, webSocketTokenParam+"=") {
+			params[i] = webSocketTokenParam + "=REDACTED"
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+func redactRequestURI(uri string) string {
+	path, query, found := strings.Cut(uri, "?")
+	if !found {
+		return uri
+	}
+	return path + "?" + redactQuery(query)
+}
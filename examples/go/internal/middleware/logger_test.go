@@ -0,0 +1,181 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestLoggerWritesCombinedLogFormat(t *testing.T) {
+	var buf bytes.Buffer
+	router := gin.New()
+	router.Use(Logger(zap.NewNop(), WithCombinedLog(&buf)))
+	router.GET("/users", func(c *gin.Context) { c.String(http.StatusOK, "hello") })
+
+	req := httptest.NewRequest(http.MethodGet, "/users?page=2", nil)
+	req.RemoteAddr = "203.0.113.7:5555"
+	req.Header.Set("Referer", "https://example.com/")
+	req.Header.Set("User-Agent", `curl/8.0 "quoted"`)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	line := buf.String()
+	pattern := regexp.MustCompile(`^203\.0\.113\.7 - - \[\d{2}/[A-Z][a-z]{2}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] ` +
+		`"GET /users\?page=2 HTTP/1\.1" 200 5 "https://example\.com/" "curl/8\.0 \\"quoted\\""\n$`)
+	if !pattern.MatchString(line) {
+		t.Errorf("combined log line = %q", line)
+	}
+}
+
+func TestLoggerCombinedLogUsesDashForEmptyFields(t *testing.T) {
+	var buf bytes.Buffer
+	router := gin.New()
+	router.Use(Logger(zap.NewNop(), WithCombinedLog(&buf)))
+	router.GET("/empty", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	req := httptest.NewRequest(http.MethodGet, "/empty", nil)
+	req.Header.Del("User-Agent")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	if !regexp.MustCompile(`" 204 - "-" "-"\n$`).MatchString(buf.String()) {
+		t.Errorf("combined log line = %q, want dashes for bytes, referer and user agent", buf.String())
+	}
+}
+
+func TestLoggerRedactsQueryToken(t *testing.T) {
+	var buf bytes.Buffer
+	core, logs := observer.New(zap.InfoLevel)
+	router := gin.New()
+	router.Use(Logger(zap.New(core), WithCombinedLog(&buf)))
+	router.GET("/events", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/events?room=1&access_token=secret", nil))
+
+	if strings.Contains(buf.String(), "secret") {
+		t.Errorf("combined log leaks token: %q", buf.String())
+	}
+	if query := logs.All()[0].ContextMap()["query"]; query != "room=1&access_token=REDACTED" {
+		t.Errorf("query = %v, want the token redacted", query)
+	}
+}
+
+func TestLoggerIncludesHandlerFields(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	router := gin.New()
+	router.Use(Logger(zap.New(core)))
+	router.GET("/users/:id", func(c *gin.Context) {
+		AddLogField(c, "resolved_user_id", 42)
+		AddLogField(c, "cache", "miss")
+		c.Status(http.StatusOK)
+	})
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/42", nil))
+
+	fields := logs.All()[0].ContextMap()
+	if fields["resolved_user_id"] != int64(42) || fields["cache"] != "miss" {
+		t.Errorf("access log fields = %v, want handler-added fields", fields)
+	}
+}
+
+func TestLoggerCapturesRedactedBodies(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	router := gin.New()
+	router.Use(Logger(zap.New(core), WithBodyCapture(1024, "ssn")))
+	router.POST("/auth/login", func(c *gin.Context) {
+		var body map[string]interface{}
+		if err := c.ShouldBindJSON(&body); err != nil || body["email"] != "alice@example.com" {
+			t.Errorf("handler body = %v, %v; want the original", body, err)
+		}
+		c.JSON(http.StatusOK, gin.H{"access_token": "jwt", "user": gin.H{"name": "Alice", "SSN": "123"}, "expires_in": 900})
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/auth/login",
+		strings.NewReader(`{"email":"alice@example.com","password":"hunter2","remember":true}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	fields := logs.All()[0].ContextMap()
+	if want := `{"email":"REDACTED","password":"REDACTED","remember":true}`; fields["request_body"] != want {
+		t.Errorf("request_body = %v, want %s", fields["request_body"], want)
+	}
+	if want := `{"access_token":"REDACTED","expires_in":900,"user":{"SSN":"REDACTED","name":"Alice"}}`; fields["response_body"] != want {
+		t.Errorf("response_body = %v, want %s", fields["response_body"], want)
+	}
+}
+
+func TestLoggerBodyCaptureOmitsUnsafeBodies(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	router := gin.New()
+	router.Use(Logger(zap.New(core), WithBodyCapture(32)))
+	router.POST("/form", func(c *gin.Context) {
+		if c.PostForm("refresh_token") != "abc" {
+			t.Errorf("refresh_token = %q, want the original", c.PostForm("refresh_token"))
+		}
+		c.String(http.StatusOK, "plain text token")
+	})
+	router.POST("/large", func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		c.Data(http.StatusOK, "application/json", body)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/form", strings.NewReader("refresh_token=abc&a=1"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	fields := logs.All()[0].ContextMap()
+	if fields["request_body"] != "a=1&refresh_token=REDACTED" {
+		t.Errorf("request_body = %v, want the form redacted", fields["request_body"])
+	}
+	if _, ok := fields["response_body"]; ok {
+		t.Errorf("response_body = %v, want plain text left out", fields["response_body"])
+	}
+
+	large := `{"password":"hunter2","padding":"xxxxxxxx"}`
+	req = httptest.NewRequest(http.MethodPost, "/large", strings.NewReader(large))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Body.String() != large {
+		t.Errorf("response = %q, want the whole body echoed", w.Body.String())
+	}
+	fields = logs.All()[1].ContextMap()
+	if fields["request_body"] != "(omitted: larger than 32 bytes)" || fields["response_body"] != "(omitted: larger than 32 bytes)" {
+		t.Errorf("bodies = %v, %v; want both omitted", fields["request_body"], fields["response_body"])
+	}
+}
+
+func TestLoggerBodyCaptureOfCompressedResponses(t *testing.T) {
+	for _, capture := range []bool{false, true} {
+		core, logs := observer.New(zap.InfoLevel)
+		router := gin.New()
+		router.Use(Logger(zap.New(core), WithBodyCapture(1024)), Compress(WithCompressMinSize(0)))
+		if capture {
+			router.Use(CaptureResponseBody())
+		}
+		router.GET("/token", func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{"access_token": "jwt", "expires_in": 900})
+		})
+
+		req := httptest.NewRequest(http.MethodGet, "/token", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Header().Get("Content-Encoding") != "gzip" {
+			t.Fatalf("Content-Encoding = %q, want gzip", w.Header().Get("Content-Encoding"))
+		}
+
+		want := "(omitted: compressed)"
+		if capture {
+			want = `{"access_token":"REDACTED","expires_in":900}`
+		}
+		if got := logs.All()[0].ContextMap()["response_body"]; got != want {
+			t.Errorf("capture beneath compression %v: response_body = %v, want %s", capture, got, want)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// unmatchedRoute labels requests that matched no route, so probes for
+// arbitrary paths do not create a series per path
+const unmatchedRoute = "unmatched"
+
+// Metrics records the request count, duration and response size of every
+// request labeled by method, route pattern and status, plus a gauge of the
+// requests in flight, and registers the collectors with registerer. It
+// should run before any middleware that may abort so rejected requests are
+// counted too.
+func Metrics(registerer prometheus.Registerer) gin.HandlerFunc {
+	labels := []string{"method", "route", "status"}
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests processed, by method, route and status.",
+	}, labels)
+	duration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency, by method, route and status.",
+		Buckets: prometheus.DefBuckets,
+	}, labels)
+	size := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_response_size_bytes",
+		Help:    "HTTP response body size, by method, route and status.",
+		Buckets: prometheus.ExponentialBuckets(100, 10, 6),
+	}, labels)
+	inFlight := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "http_requests_in_flight",
+		Help: "HTTP requests currently being served.",
+	})
+	registerer.MustRegister(requests, duration, size, inFlight)
+
+	return func(c *gin.Context) {
+		start := time.Now()
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		values := []string{c.Request.Method, route, strconv.Itoa(c.Writer.Status())}
+		requests.WithLabelValues(values...).Inc()
+		duration.WithLabelValues(values...).Observe(time.Since(start).Seconds())
+		size.WithLabelValues(values...).Observe(float64(max(c.Writer.Size(), 0)))
+	}
+}
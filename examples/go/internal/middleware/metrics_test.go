@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetricsLabelsByRouteAndStatus(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	router := gin.New()
+	router.Use(Metrics(registry))
+	router.GET("/users/:id", func(c *gin.Context) { c.String(http.StatusOK, "hello") })
+
+	for _, path := range []string{"/users/1", "/users/2", "/nope"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	expected := `
+# HELP http_requests_total HTTP requests processed, by method, route and status.
+# TYPE http_requests_total counter
+http_requests_total{method="GET",route="/users/:id",status="200"} 2
+http_requests_total{method="GET",route="unmatched",status="404"} 1
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected), "http_requests_total"); err != nil {
+		t.Error(err)
+	}
+	if n := testutil.CollectAndCount(registry, "http_request_duration_seconds", "http_response_size_bytes"); n != 4 {
+		t.Errorf("got %d histogram series, want 4", n)
+	}
+}
+
+func TestMetricsTracksRequestsInFlight(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	router := gin.New()
+	router.Use(Metrics(registry))
+
+	var during float64
+	router.GET("/", func(c *gin.Context) {
+		during = gaugeValue(t, registry, "http_requests_in_flight")
+		c.Status(http.StatusNoContent)
+	})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if during != 1 {
+		t.Errorf("in flight during request = %v, want 1", during)
+	}
+	if after := gaugeValue(t, registry, "http_requests_in_flight"); after != 0 {
+		t.Errorf("in flight after request = %v, want 0", after)
+	}
+}
+
+func gaugeValue(t *testing.T, registry *prometheus.Registry, name string) float64 {
+	t.Helper()
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() == name {
+			return family.GetMetric()[0].GetGauge().GetValue()
+		}
+	}
+	t.Fatalf("metric %s not registered", name)
+	return 0
+}
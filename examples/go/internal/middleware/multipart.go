@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+)
+
+// MultipartMemory parses multipart/form-data bodies before the handler runs,
+// keeping at most maxMemory bytes of file parts in memory and spilling the
+// rest to temporary files, which net/http removes once the request ends.
+// Handlers then read the already-parsed form through c.FormFile or
+// c.MultipartForm. Malformed bodies are rejected with 400. Mount it on the
+// routes taking uploads, after authentication, so no other request gets
+// its body spooled to disk.
+func MultipartMemory(maxMemory int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+			c.Next()
+			return
+		}
+
+		if err := c.Request.ParseMultipartForm(maxMemory); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				AbortWithError(c, models.NewError(http.StatusRequestEntityTooLarge, models.CodePayloadTooLarge, "Request body is too large"))
+				return
+			}
+			AbortWithError(c, models.NewError(http.StatusBadRequest, models.CodeValidationFailed, "Malformed multipart body"))
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func multipartUpload(t *testing.T, size int) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", "upload.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(bytes.Repeat([]byte("a"), size))
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/upload", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	return req
+}
+
+func TestMultipartMemorySpillsLargeUploadsToDisk(t *testing.T) {
+	cases := map[string]struct {
+		size   int
+		onDisk bool
+	}{
+		"small": {512, false},
+		"large": {64 << 10, true},
+	}
+	for name, tc := range cases {
+		var spilled bool
+		router := gin.New()
+		router.Use(MultipartMemory(4 << 10))
+		router.POST("/upload", func(c *gin.Context) {
+			header, err := c.FormFile("file")
+			if err != nil {
+				t.Fatalf("%s: FormFile: %v", name, err)
+			}
+			file, err := header.Open()
+			if err != nil {
+				t.Fatalf("%s: open: %v", name, err)
+			}
+			defer file.Close()
+			_, spilled = file.(*os.File)
+			c.Status(http.StatusNoContent)
+		})
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, multipartUpload(t, tc.size))
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("%s: status = %d", name, w.Code)
+		}
+		if spilled != tc.onDisk {
+			t.Errorf("%s upload: on disk = %v, want %v", name, spilled, tc.onDisk)
+		}
+	}
+}
+
+func TestMultipartMemoryRejectsMalformedBody(t *testing.T) {
+	router := gin.New()
+	router.Use(MultipartMemory(4 << 10))
+	router.POST("/upload", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	req := httptest.NewRequest(http.MethodPost, "/upload", bytes.NewReader([]byte("not multipart")))
+	req.Header.Set("Content-Type", "multipart/form-data; boundary=xyz")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", w.Code)
+	}
+}
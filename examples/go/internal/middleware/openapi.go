@@ -0,0 +1,217 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi2"
+	"github.com/getkin/kin-openapi/openapi2conv"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+	"github.com/cbwinslow/template2/examples/go/pkg/apierror"
+)
+
+// OpenAPIOption configures OpenAPI
+type OpenAPIOption func(*openAPIOptions)
+
+type openAPIOptions struct {
+	responses *zap.Logger
+}
+
+// WithResponseValidation also checks JSON responses against the spec,
+// logging those that do not match to logger. The response has been sent
+// by then and is never changed; this is for debug mode, where it surfaces
+// handlers drifting from their annotations.
+func WithResponseValidation(logger *zap.Logger) OpenAPIOption {
+	return func(o *openAPIOptions) {
+		o.responses = logger
+	}
+}
+
+// OpenAPI validates requests against spec, a Swagger 2.0 document such as
+// the one generated into the docs package, answering those that do not
+// match with 400 listing every violation. Requests are matched to
+// operations by their gin route, so routes the spec does not describe pass
+// unchecked. Security requirements are left to the auth middleware, and
+// defaults in the spec are not filled into the request.
+func OpenAPI(spec []byte, opts ...OpenAPIOption) (gin.HandlerFunc, error) {
+	var options openAPIOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	var doc2 openapi2.T
+	if err := json.Unmarshal(spec, &doc2); err != nil {
+		return nil, fmt.Errorf("openapi: parse spec: %w", err)
+	}
+	doc, err := openapi2conv.ToV3(&doc2)
+	if err != nil {
+		return nil, fmt.Errorf("openapi: convert spec: %w", err)
+	}
+	if err := doc.Validate(context.Background()); err != nil {
+		return nil, fmt.Errorf("openapi: invalid spec: %w", err)
+	}
+
+	// Keyed by method and gin route, e.g. "GET /api/v1/users/:id"
+	routes := make(map[string]*routers.Route)
+	for path, item := range doc.Paths.Map() {
+		for method, operation := range item.Operations() {
+			routes[method+" "+ginRoute(doc2.BasePath, path)] = &routers.Route{
+				Spec: doc, Path: path, PathItem: item, Method: method, Operation: operation,
+			}
+		}
+	}
+	filterOptions := &openapi3filter.Options{
+		MultiError:          true,
+		AuthenticationFunc:  openapi3filter.NoopAuthenticationFunc,
+		SkipSettingDefaults: true,
+	}
+
+	return func(c *gin.Context) {
+		route, ok := routes[c.Request.Method+" "+c.FullPath()]
+		if !ok {
+			c.Next()
+			return
+		}
+
+		params := make(map[string]string, len(c.Params))
+		for _, param := range c.Params {
+			params[param.Key] = param.Value
+		}
+		input := &openapi3filter.RequestValidationInput{
+			Request:    c.Request,
+			PathParams: params,
+			Route:      route,
+			Options:    filterOptions,
+		}
+		if err := openapi3filter.ValidateRequest(c.Request.Context(), input); err != nil {
+			apiErr := models.NewError(http.StatusBadRequest, models.CodeValidationFailed, "The request does not match the API spec")
+			apiErr.Fields = specViolations(err)
+			AbortWithError(c, apiErr)
+			return
+		}
+
+		if options.responses == nil || !producesJSON(route.Operation) {
+			c.Next()
+			return
+		}
+		recorder := &bodyRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		header := recorder.Header().Clone()
+		// Problem documents are described by their schema under the
+		// operation's JSON content
+		if mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type")); mediaType == apierror.ContentType {
+			header.Set("Content-Type", "application/json")
+		}
+		response := &openapi3filter.ResponseValidationInput{
+			RequestValidationInput: input,
+			Status:                 recorder.Status(),
+			Header:                 header,
+			Options:                filterOptions,
+		}
+		if err := openapi3filter.ValidateResponse(c.Request.Context(), response.SetBodyBytes(recorder.body.Bytes())); err != nil {
+			options.responses.Error("Response does not match the API spec",
+				zap.String("request_id", GetRequestID(c)),
+				zap.String("route", route.Method+" "+route.Path),
+				zap.Int("status", recorder.Status()),
+				zap.Error(err))
+		}
+	}, nil
+}
+
+// ginRoute converts an OpenAPI path template under basePath to the gin
+// route serving it
+func ginRoute(basePath, path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			segments[i] = ":" + segment[1:len(segment)-1]
+		}
+	}
+	return strings.TrimSuffix(basePath, "/") + strings.Join(segments, "/")
+}
+
+// producesJSON reports whether operation documents a JSON response, which
+// leaves out streams such as server-sent events that are never recorded
+func producesJSON(operation *openapi3.Operation) bool {
+	for _, response := range operation.Responses.Map() {
+		if response.Value != nil && response.Value.Content.Get("application/json") != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// specViolations lists the violations ValidateRequest found, one for
+// each parameter or body field that failed
+func specViolations(err error) []apierror.FieldError {
+	var errs openapi3.MultiError
+	if !errors.As(err, &errs) {
+		errs = openapi3.MultiError{err}
+	}
+
+	var fields []apierror.FieldError
+	for _, err := range errs {
+		var reqErr *openapi3filter.RequestError
+		if !errors.As(err, &reqErr) {
+			fields = append(fields, apierror.FieldError{Rule: "spec", Message: err.Error()})
+			continue
+		}
+
+		var schemaErrs openapi3.MultiError
+		if !errors.As(reqErr.Err, &schemaErrs) {
+			schemaErrs = openapi3.MultiError{reqErr.Err}
+		}
+		for _, cause := range schemaErrs {
+			field := apierror.FieldError{Rule: "spec", Message: reqErr.Error()}
+			if reqErr.Parameter != nil {
+				field.Field = reqErr.Parameter.Name
+			}
+			var schemaErr *openapi3.SchemaError
+			if errors.As(cause, &schemaErr) {
+				if pointer := schemaErr.JSONPointer(); len(pointer) > 0 {
+					field.Field = joinPointer(field.Field, pointer)
+				}
+				field.Rule = schemaErr.SchemaField
+				field.Message = schemaErr.Reason
+				if field.Field != "" {
+					field.Message = field.Field + ": " + field.Message
+				}
+			} else if reqErr.Parameter != nil && errors.Is(cause, openapi3filter.ErrInvalidRequired) {
+				field.Rule = "required"
+			}
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// joinPointer appends a JSON pointer to the field path prefix in the
+// notation validation errors use, e.g. "assignments[0].role"
+func joinPointer(prefix string, pointer []string) string {
+	var b strings.Builder
+	b.WriteString(prefix)
+	for _, segment := range pointer {
+		if segment != "" && strings.Trim(segment, "0123456789") == "" {
+			b.WriteString("[" + segment + "]")
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteByte('.')
+		}
+		b.WriteString(segment)
+	}
+	return b.String()
+}
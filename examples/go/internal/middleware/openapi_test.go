@@ -0,0 +1,135 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/cbwinslow/template2/examples/go/docs"
+	"github.com/cbwinslow/template2/examples/go/pkg/apierror"
+)
+
+const testSpec = `{
+	"swagger": "2.0",
+	"info": {"title": "test", "version": "1"},
+	"basePath": "/api/v1",
+	"paths": {
+		"/things/{id}": {
+			"put": {
+				"consumes": ["application/json"],
+				"produces": ["application/json"],
+				"parameters": [
+					{"name": "id", "in": "path", "required": true, "type": "integer"},
+					{"name": "dry_run", "in": "query", "type": "boolean"},
+					{"name": "thing", "in": "body", "required": true, "schema": {"$ref": "#/definitions/Thing"}}
+				],
+				"responses": {"200": {"description": "OK", "schema": {"$ref": "#/definitions/Thing"}}}
+			}
+		}
+	},
+	"definitions": {
+		"Thing": {
+			"type": "object",
+			"required": ["name"],
+			"properties": {
+				"name": {"type": "string", "minLength": 1},
+				"tags": {"type": "array", "items": {"type": "string", "enum": ["red", "blue"]}}
+			}
+		}
+	}
+}`
+
+func newOpenAPIRouter(t *testing.T, respond func(c *gin.Context), opts ...OpenAPIOption) *gin.Engine {
+	t.Helper()
+	validate, err := OpenAPI([]byte(testSpec), opts...)
+	if err != nil {
+		t.Fatalf("OpenAPI: %v", err)
+	}
+	router := gin.New()
+	api := router.Group("/api/v1", validate)
+	api.PUT("/things/:id", respond)
+	api.GET("/unlisted", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	return router
+}
+
+func echoThing(c *gin.Context) {
+	var thing map[string]interface{}
+	if err := c.ShouldBindJSON(&thing); err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, thing)
+}
+
+func putThing(router *gin.Engine, path, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPut, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestOpenAPIPassesMatchingRequests(t *testing.T) {
+	router := newOpenAPIRouter(t, echoThing)
+
+	w := putThing(router, "/api/v1/things/7?dry_run=true", `{"name":"lamp","tags":["red"]}`)
+	if w.Code != http.StatusOK || w.Body.String() != `{"name":"lamp","tags":["red"]}` {
+		t.Errorf("got %d %s; the handler should see the body unchanged", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/unlisted?anything=1", nil))
+	if w.Code != http.StatusNoContent {
+		t.Errorf("route missing from the spec: %d, want it passed through", w.Code)
+	}
+}
+
+func TestOpenAPIRejectsViolationsWithEachField(t *testing.T) {
+	router := newOpenAPIRouter(t, echoThing)
+
+	w := putThing(router, "/api/v1/things/abc?dry_run=maybe", `{"tags":["red","green"]}`)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400: %s", w.Code, w.Body.String())
+	}
+	var problem apierror.Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("body: %v", err)
+	}
+	got := map[string]string{}
+	for _, field := range problem.Errors {
+		got[field.Field] = field.Rule
+	}
+	want := map[string]string{"id": "spec", "dry_run": "spec", "name": "required", "tags[1]": "enum"}
+	for field, rule := range want {
+		if got[field] != rule {
+			t.Errorf("errors = %+v, want %s failing %s", problem.Errors, field, rule)
+		}
+	}
+}
+
+func TestOpenAPILogsMismatchedResponses(t *testing.T) {
+	core, logs := observer.New(zap.ErrorLevel)
+	router := newOpenAPIRouter(t, func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"name": 42})
+	}, WithResponseValidation(zap.New(core)))
+
+	w := putThing(router, "/api/v1/things/7", `{"name":"lamp"}`)
+	if w.Code != http.StatusOK || w.Body.String() != `{"name":42}` {
+		t.Errorf("response = %d %s, want it sent unchanged", w.Code, w.Body.String())
+	}
+	if logs.FilterMessage("Response does not match the API spec").Len() != 1 {
+		t.Errorf("logs = %v, want the mismatch logged", logs.All())
+	}
+}
+
+func TestOpenAPILoadsGeneratedSpec(t *testing.T) {
+	if _, err := OpenAPI([]byte(docs.SwaggerInfo.ReadDoc())); err != nil {
+		t.Fatalf("OpenAPI(docs): %v", err)
+	}
+}
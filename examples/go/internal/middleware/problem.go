@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+	"github.com/cbwinslow/template2/examples/go/pkg/apierror"
+)
+
+// AbortWithError aborts the request with err written as an RFC 7807 problem
+// details document naming the request path, request ID and trace ID. Errors
+// that are not an *apierror.Error are answered with a bare 500, since their
+// text may reveal internals.
+func AbortWithError(c *gin.Context, err error) {
+	var apiErr *apierror.Error
+	if !errors.As(err, &apiErr) {
+		apiErr = models.NewError(http.StatusInternalServerError, models.CodeInternal, "Internal server error")
+	}
+
+	problem := apiErr.Problem()
+	problem.Instance = c.Request.URL.Path
+	problem.RequestID = GetRequestID(c)
+	if span := trace.SpanContextFromContext(c.Request.Context()); span.HasTraceID() {
+		problem.TraceID = span.TraceID().String()
+	}
+
+	c.Header("Content-Type", apierror.ContentType)
+	c.AbortWithStatusJSON(apiErr.Status, problem)
+}
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+	"github.com/cbwinslow/template2/examples/go/pkg/apierror"
+)
+
+func TestAbortWithErrorWritesProblemDocument(t *testing.T) {
+	router := gin.New()
+	router.Use(RequestID(time.Minute))
+	router.GET("/typed", func(c *gin.Context) {
+		AbortWithError(c, models.NewError(http.StatusConflict, models.CodeEmailTaken, "Email is already in use"))
+	})
+	router.GET("/untyped", func(c *gin.Context) {
+		AbortWithError(c, errors.New("dial tcp 10.0.0.5:5432: connection refused"))
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/typed", nil))
+	if got := w.Header().Get("Content-Type"); got != apierror.ContentType {
+		t.Errorf("Content-Type = %q, want %q", got, apierror.ContentType)
+	}
+	var body apierror.Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if body.Status != http.StatusConflict || body.Code != string(models.CodeEmailTaken) || body.Instance != "/typed" {
+		t.Errorf("problem = %+v", body)
+	}
+	if body.RequestID == "" || body.RequestID != w.Header().Get(RequestIDHeader) {
+		t.Errorf("request_id = %q, want the %s header %q", body.RequestID, RequestIDHeader, w.Header().Get(RequestIDHeader))
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/untyped", nil))
+	body = apierror.Problem{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || w.Code != http.StatusInternalServerError || body.Code != string(models.CodeInternal) {
+		t.Errorf("untyped error: %d %s", w.Code, w.Body.String())
+	}
+	if body.Detail != "Internal server error" {
+		t.Errorf("detail = %q, want the cause kept out of the response", body.Detail)
+	}
+}
@@ -0,0 +1,20 @@
+package middleware
+
+import (
+	"net/netip"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TrustProxies has c.ClientIP take the client address from X-Forwarded-For
+// or X-Real-IP only on requests from a peer in proxies, and be the peer's
+// own address otherwise. Gin trusts every peer until told otherwise, which
+// would let any client choose the address rate limits and login throttling
+// key on; nil trusts none.
+func TrustProxies(router *gin.Engine, proxies []netip.Prefix) error {
+	trusted := make([]string, len(proxies))
+	for i, prefix := range proxies {
+		trusted[i] = prefix.String()
+	}
+	return router.SetTrustedProxies(trusted)
+}
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+)
+
+// QueryLimits rejects requests whose raw query string is longer than
+// maxLength bytes or that carry more than maxParams query values in total
+// (repeated keys count once per value) with 400, bounding the work filter
+// parsing can be made to do. A zero limit disables that check.
+func QueryLimits(maxParams, maxLength int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		raw := c.Request.URL.RawQuery
+		if maxLength > 0 && len(raw) > maxLength {
+			rejectQuery(c, fmt.Sprintf("Query string exceeds %d bytes", maxLength), maxParams, maxLength)
+			return
+		}
+
+		if maxParams > 0 {
+			count := 0
+			for _, values := range c.Request.URL.Query() {
+				count += len(values)
+			}
+			if count > maxParams {
+				rejectQuery(c, fmt.Sprintf("At most %d query parameters are allowed", maxParams), maxParams, maxLength)
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+func rejectQuery(c *gin.Context, message string, maxParams, maxLength int) {
+	AbortWithError(c, models.NewError(http.StatusBadRequest, models.CodeQueryTooLarge, message).WithDetails(map[string]interface{}{
+		"max_params": maxParams,
+		"max_length": maxLength,
+	}))
+}
@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newQueryRouter() *gin.Engine {
+	router := gin.New()
+	router.Use(QueryLimits(5, 100))
+	router.GET("/users", func(c *gin.Context) { c.Status(http.StatusOK) })
+	return router
+}
+
+func TestQueryLimitsRejectsTooManyFilters(t *testing.T) {
+	var params []string
+	for i := 0; i < 6; i++ {
+		params = append(params, fmt.Sprintf("f%d=x", i))
+	}
+
+	w := httptest.NewRecorder()
+	newQueryRouter().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users?"+strings.Join(params, "&"), nil))
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", w.Code)
+	}
+}
+
+func TestQueryLimitsCountsRepeatedKeys(t *testing.T) {
+	w := httptest.NewRecorder()
+	newQueryRouter().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users?role=a&role=b&role=c&role=d&role=e&role=f", nil))
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400 for six values of one key", w.Code)
+	}
+}
+
+func TestQueryLimitsRejectsLongQueryString(t *testing.T) {
+	w := httptest.NewRecorder()
+	newQueryRouter().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users?name="+strings.Repeat("a", 100), nil))
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", w.Code)
+	}
+}
+
+func TestQueryLimitsAllowsQueriesWithinLimits(t *testing.T) {
+	w := httptest.NewRecorder()
+	newQueryRouter().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users?role=admin&page=2", nil))
+
+	if w.Code != http.StatusOK {
+		t.Errorf("status = %d, want 200", w.Code)
+	}
+}
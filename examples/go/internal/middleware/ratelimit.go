@@ -0,0 +1,164 @@
+package middleware
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+)
+
+// RateLimitDecision is the outcome of a rate limit check
+type RateLimitDecision struct {
+	Allowed    bool
+	Remaining  int
+	RetryAfter time.Duration
+}
+
+// RateLimitStore tracks request budgets per client key
+type RateLimitStore interface {
+	Allow(ctx context.Context, key string, limit int, window time.Duration) (RateLimitDecision, error)
+}
+
+// RateLimitOption configures RateLimit
+type RateLimitOption func(*rateLimitOptions)
+
+type rateLimitOptions struct {
+	failOpenLogger *zap.Logger
+	scope          string
+}
+
+// WithRateLimitScope gives the limiter its own budgets, so a route group
+// limited on top of the global limit does not share buckets with it or
+// with other groups
+func WithRateLimitScope(scope string) RateLimitOption {
+	return func(o *rateLimitOptions) {
+		o.scope = scope
+	}
+}
+
+// WithFailOpen lets requests through, logging a warning to logger, when the
+// store cannot be reached. Without it a store error fails the request with
+// 500 so that an outage never silently disables limiting.
+func WithFailOpen(logger *zap.Logger) RateLimitOption {
+	return func(o *rateLimitOptions) {
+		o.failOpenLogger = logger
+	}
+}
+
+// RateLimit allows each client IP limit requests per window. Rejected
+// requests receive 429 with Retry-After and X-RateLimit-* headers and a
+// problem details body whose details repeat the values for clients that do
+// not read headers. The client IP is the forwarded one only for requests
+// from a proxy the router trusts; see TrustProxies.
+func RateLimit(store RateLimitStore, limit int, window time.Duration, opts ...RateLimitOption) gin.HandlerFunc {
+	var options rateLimitOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	return func(c *gin.Context) {
+		key := c.ClientIP()
+		if options.scope != "" {
+			key = options.scope + ":" + key
+		}
+		decision, err := store.Allow(c.Request.Context(), key, limit, window)
+		if err != nil {
+			if options.failOpenLogger != nil {
+				options.failOpenLogger.Warn("Rate limit store unavailable; allowing request",
+					zap.String("ip", c.ClientIP()),
+					zap.String("request_id", GetRequestID(c)),
+					zap.Error(err))
+				c.Next()
+				return
+			}
+			AbortWithError(c, models.NewError(http.StatusInternalServerError, models.CodeInternal, "Internal server error"))
+			return
+		}
+
+		c.Header("X-RateLimit-Limit", strconv.Itoa(limit))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(decision.Remaining))
+
+		if !decision.Allowed {
+			retryAfter := int(math.Ceil(decision.RetryAfter.Seconds()))
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			AbortWithError(c, models.NewError(http.StatusTooManyRequests, models.CodeRateLimited, "Too many requests").WithDetails(map[string]interface{}{
+				"retry_after_seconds": retryAfter,
+				"limit":               limit,
+				"window":              window.String(),
+			}))
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// MemoryRateLimitStore is a process-local token bucket store
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	limiters  map[string]*memoryLimiter
+	lastSweep time.Time
+}
+
+type memoryLimiter struct {
+	limiter *rate.Limiter
+	// window is the one the bucket was created with; a bucket idle for
+	// that long is full again and can be dropped
+	window   time.Duration
+	lastSeen time.Time
+}
+
+// NewMemoryRateLimitStore creates an empty in-memory store
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{limiters: make(map[string]*memoryLimiter), lastSweep: time.Now()}
+}
+
+// Allow consumes one token from key's bucket, which refills limit tokens
+// per window
+func (s *MemoryRateLimitStore) Allow(ctx context.Context, key string, limit int, window time.Duration) (RateLimitDecision, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(now, window)
+
+	entry, ok := s.limiters[key]
+	if !ok {
+		entry = &memoryLimiter{limiter: rate.NewLimiter(rate.Limit(float64(limit)/window.Seconds()), limit), window: window}
+		s.limiters[key] = entry
+	}
+	entry.lastSeen = now
+
+	reservation := entry.limiter.ReserveN(now, 1)
+	if delay := reservation.DelayFrom(now); delay > 0 {
+		reservation.CancelAt(now)
+		return RateLimitDecision{Allowed: false, RetryAfter: delay}, nil
+	}
+
+	return RateLimitDecision{Allowed: true, Remaining: int(entry.limiter.TokensAt(now))}, nil
+}
+
+// sweep drops buckets idle for longer than their own window, at most once
+// per the calling limiter's window. Limiters with different windows share
+// a store, so the caller's window only paces the sweep. Callers must hold
+// s.mu.
+func (s *MemoryRateLimitStore) sweep(now time.Time, window time.Duration) {
+	if now.Sub(s.lastSweep) < window {
+		return
+	}
+	for key, entry := range s.limiters {
+		if now.Sub(entry.lastSeen) > entry.window {
+			delete(s.limiters, key)
+		}
+	}
+	s.lastSweep = now
+}
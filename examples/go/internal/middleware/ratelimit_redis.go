@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// slidingWindowScript counts the requests a key made within the window in a
+// sorted set scored by arrival time and admits a new one while the count is
+// below the limit. Time comes from the Redis server so replicas with skewed
+// clocks still share one window. It returns {allowed, remaining, retry_ms}.
+var slidingWindowScript = redis.NewScript(`
+local key = KEYS[1]
+local window = tonumber(ARGV[1])
+local limit = tonumber(ARGV[2])
+local member = ARGV[3]
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+redis.call('ZREMRANGEBYSCORE', key, '-inf', now - window)
+local count = redis.call('ZCARD', key)
+if count < limit then
+	redis.call('ZADD', key, now, member)
+	redis.call('PEXPIRE', key, window)
+	return {1, limit - count - 1, 0}
+end
+
+local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+return {0, 0, tonumber(oldest[2]) + window - now}
+`)
+
+// RedisRateLimitStore is a sliding window store shared by every replica
+// connected to the same Redis
+type RedisRateLimitStore struct {
+	client redis.Scripter
+	prefix string
+}
+
+// NewRedisRateLimitStore creates a store keeping its windows in client under
+// keys starting with prefix
+func NewRedisRateLimitStore(client redis.Scripter, prefix string) *RedisRateLimitStore {
+	return &RedisRateLimitStore{client: client, prefix: prefix}
+}
+
+// Allow records one request for key unless limit requests were already made
+// within the trailing window
+func (s *RedisRateLimitStore) Allow(ctx context.Context, key string, limit int, window time.Duration) (RateLimitDecision, error) {
+	member := make([]byte, 8)
+	_, _ = rand.Read(member)
+
+	result, err := slidingWindowScript.Run(ctx, s.client, []string{s.prefix + key},
+		window.Milliseconds(), limit, hex.EncodeToString(member)).Int64Slice()
+	if err != nil {
+		return RateLimitDecision{}, fmt.Errorf("ratelimit: redis: %w", err)
+	}
+
+	return RateLimitDecision{
+		Allowed:    result[0] == 1,
+		Remaining:  int(result[1]),
+		RetryAfter: time.Duration(result[2]) * time.Millisecond,
+	}, nil
+}
+
+// FallbackRateLimitStore answers from primary and switches to fallback for
+// as long as primary fails, so a Redis outage degrades limiting to
+// per-replica budgets instead of disabling it
+type FallbackRateLimitStore struct {
+	primary  RateLimitStore
+	fallback RateLimitStore
+	logger   *zap.Logger
+
+	mu       sync.Mutex
+	degraded bool
+}
+
+// NewFallbackRateLimitStore creates a store that prefers primary. Switching
+// to and from fallback is logged once per transition.
+func NewFallbackRateLimitStore(primary, fallback RateLimitStore, logger *zap.Logger) *FallbackRateLimitStore {
+	return &FallbackRateLimitStore{primary: primary, fallback: fallback, logger: logger}
+}
+
+// Allow checks key against primary, or against fallback if primary fails
+func (s *FallbackRateLimitStore) Allow(ctx context.Context, key string, limit int, window time.Duration) (RateLimitDecision, error) {
+	decision, err := s.primary.Allow(ctx, key, limit, window)
+	s.setDegraded(err)
+	if err != nil {
+		return s.fallback.Allow(ctx, key, limit, window)
+	}
+	return decision, nil
+}
+
+func (s *FallbackRateLimitStore) setDegraded(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch degraded := err != nil; {
+	case degraded && !s.degraded:
+		s.logger.Warn("Rate limit store unavailable; using the fallback store", zap.Error(err))
+	case !degraded && s.degraded:
+		s.logger.Info("Rate limit store recovered")
+	}
+	s.degraded = err != nil
+}
@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func newRedisStore(t *testing.T) (*RedisRateLimitStore, *miniredis.Miniredis) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewRedisRateLimitStore(client, "ratelimit:"), server
+}
+
+func TestRedisRateLimitStoreSharesWindowAcrossReplicas(t *testing.T) {
+	ctx := context.Background()
+	first, server := newRedisStore(t)
+	second := NewRedisRateLimitStore(redis.NewClient(&redis.Options{Addr: server.Addr()}), "ratelimit:")
+
+	for i, store := range []*RedisRateLimitStore{first, second} {
+		decision, err := store.Allow(ctx, "10.0.0.1", 2, time.Minute)
+		if err != nil || !decision.Allowed {
+			t.Fatalf("request %d: %+v, %v; want allowed", i+1, decision, err)
+		}
+	}
+
+	decision, err := first.Allow(ctx, "10.0.0.1", 2, time.Minute)
+	if err != nil || decision.Allowed {
+		t.Fatalf("third request: %+v, %v; want rejected", decision, err)
+	}
+	if decision.RetryAfter <= 0 || decision.RetryAfter > time.Minute {
+		t.Errorf("RetryAfter = %v, want within the window", decision.RetryAfter)
+	}
+
+	if decision, _ := first.Allow(ctx, "10.0.0.2", 2, time.Minute); !decision.Allowed || decision.Remaining != 1 {
+		t.Errorf("other client: %+v, want allowed with 1 remaining", decision)
+	}
+}
+
+func TestFallbackRateLimitStoreSwitchesWhileRedisIsDown(t *testing.T) {
+	ctx := context.Background()
+	core, logs := observer.New(zap.InfoLevel)
+	redisStore, server := newRedisStore(t)
+	store := NewFallbackRateLimitStore(redisStore, NewMemoryRateLimitStore(), zap.New(core))
+
+	server.Close()
+	for i := 0; i < 2; i++ {
+		if decision, err := store.Allow(ctx, "10.0.0.1", 1, time.Minute); err != nil || decision.Allowed != (i == 0) {
+			t.Fatalf("request %d while down: %+v, %v", i+1, decision, err)
+		}
+	}
+	if n := logs.FilterMessage("Rate limit store unavailable; using the fallback store").Len(); n != 1 {
+		t.Errorf("logged the outage %d times, want once", n)
+	}
+
+	if err := server.Restart(); err != nil {
+		t.Fatalf("restart: %v", err)
+	}
+	if decision, err := store.Allow(ctx, "10.0.0.1", 1, time.Minute); err != nil || !decision.Allowed {
+		t.Fatalf("after recovery: %+v, %v; want Redis to answer with a fresh window", decision, err)
+	}
+	if logs.FilterMessage("Rate limit store recovered").Len() != 1 {
+		t.Error("recovery was not logged")
+	}
+}
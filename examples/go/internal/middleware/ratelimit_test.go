@@ -0,0 +1,165 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+	"github.com/cbwinslow/template2/examples/go/pkg/apierror"
+)
+
+func TestRateLimitReturnsStructuredBodyOn429(t *testing.T) {
+	router := gin.New()
+	router.Use(RateLimit(NewMemoryRateLimitStore(), 2, time.Minute))
+	router.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	var w *httptest.ResponseRecorder
+	for i := 0; i < 3; i++ {
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		if i < 2 && w.Code != http.StatusOK {
+			t.Fatalf("request %d status = %d, want 200", i+1, w.Code)
+		}
+	}
+
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want 429", w.Code)
+	}
+
+	var body apierror.Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if body.Code != string(models.CodeRateLimited) {
+		t.Errorf("code = %q, want %q", body.Code, models.CodeRateLimited)
+	}
+	if body.Details["limit"] != float64(2) {
+		t.Errorf("limit = %v, want 2", body.Details["limit"])
+	}
+	if body.Details["window"] != "1m0s" {
+		t.Errorf("window = %v, want 1m0s", body.Details["window"])
+	}
+	// Two tokens refill per minute, so the next one is ~30s away.
+	retry, _ := body.Details["retry_after_seconds"].(float64)
+	if retry < 1 || retry > 30 {
+		t.Errorf("retry_after_seconds = %v, want within (0, 30]", body.Details["retry_after_seconds"])
+	}
+	if got := w.Header().Get("Retry-After"); got == "" {
+		t.Error("missing Retry-After header")
+	}
+}
+
+type unavailableStore struct{}
+
+func (unavailableStore) Allow(context.Context, string, int, time.Duration) (RateLimitDecision, error) {
+	return RateLimitDecision{}, errors.New("connection refused")
+}
+
+func TestRateLimitStoreFailure(t *testing.T) {
+	core, logs := observer.New(zap.WarnLevel)
+	cases := map[string]struct {
+		opts []RateLimitOption
+		want int
+	}{
+		"fail closed": {nil, http.StatusInternalServerError},
+		"fail open":   {[]RateLimitOption{WithFailOpen(zap.New(core))}, http.StatusOK},
+	}
+	for name, tc := range cases {
+		router := gin.New()
+		router.Use(RateLimit(unavailableStore{}, 2, time.Minute, tc.opts...))
+		router.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		if w.Code != tc.want {
+			t.Errorf("%s: status = %d, want %d", name, w.Code, tc.want)
+		}
+	}
+	if logs.FilterMessage("Rate limit store unavailable; allowing request").Len() != 1 {
+		t.Errorf("logged %d warnings, want 1 for the fail-open request", logs.Len())
+	}
+}
+
+func TestRateLimitScopesHaveSeparateBudgets(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	router := gin.New()
+	router.Use(RateLimit(store, 2, time.Minute))
+	auth := router.Group("/auth", RateLimit(store, 1, time.Minute, WithRateLimitScope("auth")))
+	auth.POST("/login", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	want := []int{http.StatusOK, http.StatusTooManyRequests}
+	for i, status := range want {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/auth/login", nil))
+		if w.Code != status {
+			t.Errorf("request %d: status = %d, want %d", i+1, w.Code, status)
+		}
+	}
+}
+
+func TestRateLimitKeysOnForwardedAddressOnlyFromTrustedProxies(t *testing.T) {
+	tests := []struct {
+		name    string
+		proxies []netip.Prefix
+		want    []int
+	}{
+		// A client rotating X-Forwarded-For still spends its own budget
+		{"untrusted peer", nil, []int{http.StatusOK, http.StatusTooManyRequests, http.StatusTooManyRequests}},
+		// Behind a trusted proxy each forwarded client has a budget
+		{"trusted proxy", []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")}, []int{http.StatusOK, http.StatusOK, http.StatusOK}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			if err := TrustProxies(router, tt.proxies); err != nil {
+				t.Fatal(err)
+			}
+			router.Use(RateLimit(NewMemoryRateLimitStore(), 1, time.Minute))
+			router.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			for i, status := range tt.want {
+				w := httptest.NewRecorder()
+				req := httptest.NewRequest(http.MethodGet, "/", nil)
+				req.Header.Set("X-Forwarded-For", fmt.Sprintf("203.0.113.%d", i+1))
+				router.ServeHTTP(w, req)
+				if w.Code != status {
+					t.Errorf("request %d: status = %d, want %d", i+1, w.Code, status)
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryRateLimitStoreSweepKeepsLongerWindows(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	ctx := context.Background()
+	if d, _ := store.Allow(ctx, "forgot-password:1.2.3.4", 1, time.Hour); !d.Allowed {
+		t.Fatal("first hourly request denied")
+	}
+
+	// Two minutes later a request under the per-minute limit sweeps the store
+	store.mu.Lock()
+	for _, entry := range store.limiters {
+		entry.lastSeen = entry.lastSeen.Add(-2 * time.Minute)
+	}
+	store.lastSweep = store.lastSweep.Add(-2 * time.Minute)
+	store.mu.Unlock()
+	if d, _ := store.Allow(ctx, "1.2.3.4", 100, time.Minute); !d.Allowed {
+		t.Fatal("global request denied")
+	}
+
+	if d, _ := store.Allow(ctx, "forgot-password:1.2.3.4", 1, time.Hour); d.Allowed {
+		t.Error("hourly bucket was swept by the per-minute limiter and refilled")
+	}
+}
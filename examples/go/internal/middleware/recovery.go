@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"strings"
+	"syscall"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+)
+
+// Recovery turns handler panics into a logged 500 response.
+//
+// http.ErrAbortHandler is re-panicked so net/http can abort the connection
+// quietly as documented, and panics caused by a client that went away
+// (broken pipe, connection reset) are logged as warnings without a body
+// since nothing can be written anymore.
+func Recovery(logger *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+
+			if err, ok := rec.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				panic(rec)
+			}
+
+			fields := []zap.Field{
+				zap.Any("error", rec),
+				zap.String("method", c.Request.Method),
+				zap.String("path", c.Request.URL.Path),
+				zap.String("request_id", GetRequestID(c)),
+			}
+
+			if brokenPipe(rec) {
+				logger.Warn("Client connection lost", fields...)
+				c.Abort()
+				return
+			}
+
+			logger.Error("Panic recovered", append(fields, zap.ByteString("stack", debug.Stack()))...)
+			AbortWithError(c, models.NewError(http.StatusInternalServerError, models.CodeInternal, "Internal server error"))
+		}()
+
+		c.Next()
+	}
+}
+
+func brokenPipe(rec interface{}) bool {
+	err, ok := rec.(error)
+	if !ok {
+		return false
+	}
+	var opErr *net.OpError
+	if !errors.As(err, &opErr) {
+		return false
+	}
+	var sysErr *os.SyscallError
+	if errors.As(opErr, &sysErr) && (errors.Is(sysErr.Err, syscall.EPIPE) || errors.Is(sysErr.Err, syscall.ECONNRESET)) {
+		return true
+	}
+	msg := strings.ToLower(opErr.Error())
+	return strings.Contains(msg, "broken pipe") || strings.Contains(msg, "connection reset by peer")
+}
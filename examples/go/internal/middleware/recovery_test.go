@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+	"github.com/cbwinslow/template2/examples/go/pkg/apierror"
+)
+
+func TestRecoveryLetsAbortHandlerThrough(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	router := gin.New()
+	router.Use(Recovery(zap.New(core)))
+	router.GET("/abort", func(c *gin.Context) {
+		panic(http.ErrAbortHandler)
+	})
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/abort")
+	if err == nil {
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusInternalServerError || len(body) > 0 {
+			t.Errorf("aborted handler produced %d %q, want the connection aborted", resp.StatusCode, body)
+		}
+	}
+
+	if n := logs.Len(); n != 0 {
+		t.Errorf("got %d log entries for an aborted handler, want none", n)
+	}
+}
+
+func TestRecoveryRespondsWithInternalError(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	router := gin.New()
+	router.Use(Recovery(zap.New(core)))
+	router.GET("/boom", func(c *gin.Context) {
+		panic("boom")
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/boom", nil))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500", w.Code)
+	}
+	var body apierror.Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Code != string(models.CodeInternal) {
+		t.Errorf("body = %s, want code %s", w.Body.String(), models.CodeInternal)
+	}
+	if logs.FilterMessage("Panic recovered").Len() != 1 {
+		t.Error("expected the panic to be logged")
+	}
+}
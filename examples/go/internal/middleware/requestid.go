@@ -0,0 +1,130 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// RequestIDHeader carries the request ID on requests and responses
+const RequestIDHeader = "X-Request-ID"
+
+const (
+	requestIDKey       = "request_id"
+	requestIDReusedKey = "request_id_reused"
+
+	maxRequestIDLength = 128
+	maxRecentIDs       = 10000
+)
+
+// requestIDContextKey stores the request ID in the request context
+type requestIDContextKey struct{}
+
+// RequestID assigns every request an ID, reusing a well-formed client
+// supplied X-Request-ID. The ID is echoed in the response, kept in the gin
+// context and the request context, and attached to every log line written
+// through RequestLogger. IDs seen again within window are still accepted
+// but flagged so the access log can surface clients that reuse IDs.
+func RequestID(window time.Duration) gin.HandlerFunc {
+	recent := &recentIDs{ttl: window, seen: make(map[string]time.Time)}
+
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		} else if recent.seenBefore(id, time.Now()) {
+			c.Set(requestIDReusedKey, true)
+		}
+
+		c.Set(requestIDKey, id)
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), requestIDContextKey{}, id))
+		c.Header(RequestIDHeader, id)
+		c.Next()
+	}
+}
+
+// GetRequestID returns the ID assigned by the RequestID middleware
+func GetRequestID(c *gin.Context) string {
+	return c.GetString(requestIDKey)
+}
+
+// RequestIDFromContext returns the request ID stored in a request context,
+// for code below the handlers that only sees the context
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey{}).(string)
+	return id
+}
+
+// ContextWithRequestID stores a request ID in ctx for requests that do not
+// pass through RequestID, such as gRPC calls: supplied when it is
+// well-formed, a new ID otherwise. It returns the ID chosen.
+func ContextWithRequestID(ctx context.Context, supplied string) (context.Context, string) {
+	id := supplied
+	if !validRequestID(id) {
+		id = newRequestID()
+	}
+	return context.WithValue(ctx, requestIDContextKey{}, id), id
+}
+
+// RequestLogger returns logger annotated with the request's ID, so handler
+// log lines can be correlated with the access log entry
+func RequestLogger(c *gin.Context, logger *zap.Logger) *zap.Logger {
+	if id := GetRequestID(c); id != "" {
+		return logger.With(zap.String("request_id", id))
+	}
+	return logger
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		if r < 0x21 || r > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// recentIDs remembers request IDs for ttl
+type recentIDs struct {
+	mu   sync.Mutex
+	ttl  time.Duration
+	seen map[string]time.Time
+}
+
+// seenBefore records id and reports whether it was already seen within ttl
+func (r *recentIDs) seenBefore(id string, now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	last, ok := r.seen[id]
+	reused := ok && now.Sub(last) <= r.ttl
+
+	if len(r.seen) >= maxRecentIDs {
+		for key, at := range r.seen {
+			if now.Sub(at) > r.ttl {
+				delete(r.seen, key)
+			}
+		}
+		// Still full of live IDs: forget everything rather than grow.
+		if len(r.seen) >= maxRecentIDs {
+			r.seen = make(map[string]time.Time)
+		}
+	}
+	r.seen[id] = now
+
+	return reused
+}
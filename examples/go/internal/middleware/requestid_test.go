@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestRequestIDFlagsReusedIDs(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	router := gin.New()
+	router.Use(RequestID(time.Minute), Logger(zap.New(core)))
+	router.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(RequestIDHeader, "client-id-1")
+		router.ServeHTTP(w, req)
+
+		if got := w.Header().Get(RequestIDHeader); got != "client-id-1" {
+			t.Errorf("request %d: response ID = %q, want the client ID", i+1, got)
+		}
+	}
+
+	entries := logs.All()
+	if len(entries) != 2 {
+		t.Fatalf("got %d log entries, want 2", len(entries))
+	}
+	if _, ok := entries[0].ContextMap()["request_id_reused"]; ok {
+		t.Error("first use of the ID was flagged as reused")
+	}
+	if entries[1].ContextMap()["request_id_reused"] != true {
+		t.Error("second use of the ID was not flagged as reused")
+	}
+	if entries[1].ContextMap()["request_id"] != "client-id-1" {
+		t.Errorf("request_id = %v, want client-id-1", entries[1].ContextMap()["request_id"])
+	}
+}
+
+func TestRequestIDGeneratesIDForMissingOrInvalidHeader(t *testing.T) {
+	router := gin.New()
+	router.Use(RequestID(time.Minute))
+	router.GET("/", func(c *gin.Context) { c.String(http.StatusOK, GetRequestID(c)) })
+
+	for _, header := range []string{"", "has space", string(make([]byte, maxRequestIDLength+1))} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if header != "" {
+			req.Header.Set(RequestIDHeader, header)
+		}
+		router.ServeHTTP(w, req)
+
+		if id := w.Body.String(); len(id) != 32 || id == header {
+			t.Errorf("header %q: got ID %q, want a generated 32 char ID", header, id)
+		}
+	}
+}
+
+func TestRecentIDsExpireAfterTTL(t *testing.T) {
+	recent := &recentIDs{ttl: time.Minute, seen: make(map[string]time.Time)}
+	now := time.Now()
+
+	recent.seenBefore("a", now)
+	if recent.seenBefore("a", now.Add(2*time.Minute)) {
+		t.Error("ID reported as reused after its TTL")
+	}
+}
+
+func TestRequestIDCorrelatesHandlerLogs(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	logger := zap.New(core)
+	router := gin.New()
+	router.Use(RequestID(time.Minute), Logger(logger))
+	router.GET("/", func(c *gin.Context) {
+		if got := RequestIDFromContext(c.Request.Context()); got != "client-id-2" {
+			t.Errorf("request context ID = %q, want the client ID", got)
+		}
+		RequestLogger(c, logger).Info("Handling request")
+		c.Status(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(RequestIDHeader, "client-id-2")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	entries := logs.All()
+	if len(entries) != 2 {
+		t.Fatalf("got %d log entries, want 2", len(entries))
+	}
+	for _, entry := range entries {
+		if got := entry.ContextMap()["request_id"]; got != "client-id-2" {
+			t.Errorf("%q: request_id = %v, want client-id-2", entry.Message, got)
+		}
+	}
+}
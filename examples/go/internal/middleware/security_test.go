@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	router := gin.New()
+	router.Use(SecurityHeaders())
+	router.GET("/", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if got := w.Header().Get("X-Content-Type-Options"); got != "nosniff" {
+		t.Errorf("X-Content-Type-Options = %q, want nosniff", got)
+	}
+	if got := w.Header().Get("Content-Security-Policy"); got != DefaultContentSecurityPolicy {
+		t.Errorf("Content-Security-Policy = %q, want the default", got)
+	}
+	if got := w.Header().Get("Strict-Transport-Security"); got != "" {
+		t.Errorf("HSTS sent over plain HTTP: %q", got)
+	}
+}
+
+func TestSecurityHeadersOptions(t *testing.T) {
+	router := gin.New()
+	router.Use(SecurityHeaders(
+		WithContentSecurityPolicy("default-src 'self'"),
+		WithHSTSMaxAge(24*time.Hour),
+		WithFrameOptions("SAMEORIGIN"),
+		WithReferrerPolicy("")))
+	router.GET("/", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "https://api.example.com/", nil)
+	req.TLS = &tls.ConnectionState{}
+	router.ServeHTTP(w, req)
+
+	want := map[string]string{
+		"Content-Security-Policy":   "default-src 'self'",
+		"Strict-Transport-Security": "max-age=86400; includeSubDomains",
+		"X-Frame-Options":           "SAMEORIGIN",
+		"Referrer-Policy":           "",
+	}
+	for name, value := range want {
+		if got := w.Header().Get(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+}
+
+func TestPrettyJSONIndentsOnlyJSON(t *testing.T) {
+	router := gin.New()
+	router.Use(PrettyJSON())
+	router.GET("/json", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"id": 1}) })
+	router.GET("/text", func(c *gin.Context) { c.String(http.StatusOK, `{"id":1}`) })
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/json", nil))
+	if want := "{\n  \"id\": 1\n}"; w.Body.String() != want {
+		t.Errorf("json body = %q, want %q", w.Body.String(), want)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/text", nil))
+	if want := `{"id":1}`; w.Body.String() != want {
+		t.Errorf("text body = %q, want %q", w.Body.String(), want)
+	}
+}
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+)
+
+// Timeout sets a deadline on the request context. The deadline is looked up
+// in routes by "METHOD /route/pattern" and then by "/route/pattern", falling
+// back to global when the route is not listed. Handlers are expected to
+// honor context cancellation; if the deadline passes before anything was
+// written the client receives 504 Gateway Timeout.
+func Timeout(global time.Duration, routes map[string]time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		timeout := routeTimeout(c, global, routes)
+		if timeout <= 0 {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) && !c.Writer.Written() {
+			AbortWithError(c, models.NewError(http.StatusGatewayTimeout, models.CodeRequestTimeout, "The request did not complete in time"))
+		}
+	}
+}
+
+func routeTimeout(c *gin.Context, global time.Duration, routes map[string]time.Duration) time.Duration {
+	if timeout, ok := routeOverride(c, routes); ok {
+		return timeout
+	}
+	return global
+}
+
+// routeOverride looks the request up in routes by "METHOD /route/pattern"
+// and then by "/route/pattern"
+func routeOverride[V any](c *gin.Context, routes map[string]V) (V, bool) {
+	route := c.FullPath()
+	if v, ok := routes[c.Request.Method+" "+route]; ok {
+		return v, true
+	}
+	v, ok := routes[route]
+	return v, ok
+}
@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestTimeoutUsesRouteSpecificDeadline(t *testing.T) {
+	deadlines := map[string]time.Duration{}
+	record := func(c *gin.Context) {
+		deadline, ok := c.Request.Context().Deadline()
+		if !ok {
+			t.Errorf("%s: no deadline set", c.FullPath())
+		}
+		deadlines[c.FullPath()] = time.Until(deadline)
+		c.Status(http.StatusOK)
+	}
+
+	router := gin.New()
+	router.Use(Timeout(5*time.Second, map[string]time.Duration{
+		"/users/export":  2 * time.Minute,
+		"GET /users/:id": time.Second,
+	}))
+	router.GET("/users/export", record)
+	router.GET("/users/:id", record)
+	router.GET("/users", record)
+
+	for _, path := range []string{"/users/export", "/users/1", "/users"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	want := map[string]time.Duration{
+		"/users/export": 2 * time.Minute,
+		"/users/:id":    time.Second,
+		"/users":        5 * time.Second,
+	}
+	for route, timeout := range want {
+		got := deadlines[route]
+		if got > timeout || got < timeout-time.Second {
+			t.Errorf("%s: deadline in %v, want about %v", route, got, timeout)
+		}
+	}
+}
+
+func TestTimeoutRespondsWhenDeadlineExceeded(t *testing.T) {
+	router := gin.New()
+	router.Use(Timeout(10*time.Millisecond, nil))
+	router.GET("/slow", func(c *gin.Context) {
+		<-c.Request.Context().Done()
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow", nil))
+
+	if w.Code != http.StatusGatewayTimeout {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusGatewayTimeout)
+	}
+}
@@ -0,0 +1,17 @@
+package middleware
+
+import "context"
+
+// EmailVerifiedFunc reports whether the user with the given ID has verified
+// their email address
+type EmailVerifiedFunc func(ctx context.Context, userID int) (bool, error)
+
+// WithVerifiedEmail makes AuthRequired reject authenticated users whose email
+// is not verified with 403, whichever credential they presented. The check
+// runs on every request, so a user is let in as soon as they verify rather
+// than when their token is next refreshed.
+func WithVerifiedEmail(verified EmailVerifiedFunc) AuthOption {
+	return func(o *authOptions) {
+		o.verified = verified
+	}
+}
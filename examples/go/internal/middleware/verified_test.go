@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+	"github.com/cbwinslow/template2/examples/go/pkg/apierror"
+	"github.com/cbwinslow/template2/examples/go/pkg/auth"
+)
+
+func TestWithVerifiedEmailBlocksUnverifiedUsers(t *testing.T) {
+	svc := auth.NewAuthService()
+	verified := map[int]bool{5: true}
+	router := newAuthRouter(svc, WithVerifiedEmail(func(_ context.Context, userID int) (bool, error) {
+		if userID == 9 {
+			return false, errors.New("store down")
+		}
+		return verified[userID], nil
+	}))
+
+	cases := []struct {
+		userID int
+		status int
+		code   models.ErrorCode
+	}{
+		{5, http.StatusOK, ""},
+		{6, http.StatusForbidden, models.CodeEmailUnverified},
+		{9, http.StatusInternalServerError, models.CodeInternal},
+	}
+	for _, tc := range cases {
+		token, _ := svc.GenerateToken(context.Background(), tc.userID, "gina@example.com", "user")
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/profile", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		router.ServeHTTP(w, req)
+
+		if w.Code != tc.status {
+			t.Errorf("user %d: status = %d, want %d", tc.userID, w.Code, tc.status)
+			continue
+		}
+		if tc.code != "" {
+			var body apierror.Problem
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Code != string(tc.code) {
+				t.Errorf("user %d: body = %s, want code %s", tc.userID, w.Body.String(), tc.code)
+			}
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package models
+
+import (
+	"fmt"
+
+	"github.com/cbwinslow/template2/examples/go/pkg/apierror"
+)
+
+// ErrorCode identifies the kind of failure a request or item reports. Clients
+// may switch on it, so the set of codes is closed: every code the API returns
+// is declared below and registered in the catalog.
+type ErrorCode string
+
+// Error codes returned in problem documents and APIError.Code
+const (
+	CodeNotAcceptable        ErrorCode = "NOT_ACCEPTABLE"
+	CodeUnsupportedMedia     ErrorCode = "UNSUPPORTED_MEDIA_TYPE"
+	CodeValidationFailed     ErrorCode = "VALIDATION_FAILED"
+	CodeInvalidID            ErrorCode = "INVALID_ID"
+	CodeNotFound             ErrorCode = "NOT_FOUND"
+	CodeUserNotFound         ErrorCode = "USER_NOT_FOUND"
+	CodeEmailTaken           ErrorCode = "EMAIL_TAKEN"
+	CodeInvalidRole          ErrorCode = "INVALID_ROLE"
+	CodeInvariantViolation   ErrorCode = "INVARIANT_VIOLATION"
+	CodePreconditionFailed   ErrorCode = "PRECONDITION_FAILED"
+	CodeTxConflict           ErrorCode = "TRANSACTION_CONFLICT"
+	CodeBatchTooLarge        ErrorCode = "BATCH_TOO_LARGE"
+	CodeQueryTooLarge        ErrorCode = "QUERY_TOO_LARGE"
+	CodePayloadTooLarge      ErrorCode = "PAYLOAD_TOO_LARGE"
+	CodeInvalidMerge         ErrorCode = "INVALID_MERGE"
+	CodeInvalidSort          ErrorCode = "INVALID_SORT"
+	CodeInvalidFilter        ErrorCode = "INVALID_FILTER"
+	CodeInvalidPage          ErrorCode = "INVALID_PAGE"
+	CodeUnauthorized         ErrorCode = "UNAUTHORIZED"
+	CodeTokenInvalid         ErrorCode = "TOKEN_INVALID"
+	CodeInvalidCredentials   ErrorCode = "INVALID_CREDENTIALS"
+	CodeTwoFactorInvalid     ErrorCode = "INVALID_TWO_FACTOR_CODE"
+	CodeTwoFactorEnabled     ErrorCode = "TWO_FACTOR_ENABLED"
+	CodeForbidden            ErrorCode = "FORBIDDEN"
+	CodeCSRFInvalid          ErrorCode = "CSRF_TOKEN_INVALID"
+	CodeEmailUnverified      ErrorCode = "EMAIL_UNVERIFIED"
+	CodeAccountLocked        ErrorCode = "ACCOUNT_LOCKED"
+	CodeRequestTimeout       ErrorCode = "REQUEST_TIMEOUT"
+	CodeStorageFull          ErrorCode = "STORAGE_FULL"
+	CodeRateLimited          ErrorCode = "RATE_LIMITED"
+	CodeIdempotencyKeyInUse  ErrorCode = "IDEMPOTENCY_KEY_IN_USE"
+	CodeIdempotencyKeyReused ErrorCode = "IDEMPOTENCY_KEY_REUSED"
+	CodeUnavailable          ErrorCode = "SERVICE_UNAVAILABLE"
+	CodeInternal             ErrorCode = "INTERNAL_ERROR"
+)
+
+// errorCatalog holds every code the API may return
+var errorCatalog = map[ErrorCode]struct{}{}
+
+func init() {
+	for _, code := range []ErrorCode{
+		CodeNotAcceptable,
+		CodeUnsupportedMedia,
+		CodeValidationFailed,
+		CodeInvalidID,
+		CodeNotFound,
+		CodeUserNotFound,
+		CodeEmailTaken,
+		CodeInvalidRole,
+		CodeInvariantViolation,
+		CodePreconditionFailed,
+		CodeTxConflict,
+		CodeBatchTooLarge,
+		CodeQueryTooLarge,
+		CodePayloadTooLarge,
+		CodeInvalidMerge,
+		CodeInvalidSort,
+		CodeInvalidFilter,
+		CodeInvalidPage,
+		CodeUnauthorized,
+		CodeTokenInvalid,
+		CodeInvalidCredentials,
+		CodeTwoFactorInvalid,
+		CodeTwoFactorEnabled,
+		CodeForbidden,
+		CodeCSRFInvalid,
+		CodeEmailUnverified,
+		CodeAccountLocked,
+		CodeRequestTimeout,
+		CodeStorageFull,
+		CodeRateLimited,
+		CodeIdempotencyKeyInUse,
+		CodeIdempotencyKeyReused,
+		CodeUnavailable,
+		CodeInternal,
+	} {
+		errorCatalog[code] = struct{}{}
+	}
+}
+
+// KnownErrorCode reports whether code is part of the catalog
+func KnownErrorCode(code ErrorCode) bool {
+	_, ok := errorCatalog[code]
+	return ok
+}
+
+// APIError reports the failure of one item inside an otherwise successful
+// response, such as an entry of a batch. Failed requests are answered with a
+// problem details document instead; see NewError.
+type APIError struct {
+	Code    ErrorCode              `json:"code"`
+	Message string                 `json:"message"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// NewError returns the error a request fails with. It panics if code is not
+// in the catalog, so an unregistered code fails in tests rather than
+// reaching clients.
+func NewError(status int, code ErrorCode, detail string) *apierror.Error {
+	if !KnownErrorCode(code) {
+		panic(fmt.Sprintf("models: error code %q is not in the catalog", code))
+	}
+	return apierror.New(status, string(code), detail)
+}
@@ -0,0 +1,181 @@
+package models
+
+import (
+	"go/ast"
+	"go/constant"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// catalogConstants parses this package's error.go and returns the declared
+// error code constants by name
+func catalogConstants(t *testing.T) map[string]ErrorCode {
+	t.Helper()
+	file, err := parser.ParseFile(token.NewFileSet(), "error.go", nil, 0)
+	if err != nil {
+		t.Fatalf("parse error.go: %v", err)
+	}
+
+	codes := make(map[string]ErrorCode)
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.CONST {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			value := spec.(*ast.ValueSpec)
+			for i, name := range value.Names {
+				lit := value.Values[i].(*ast.BasicLit)
+				codes[name.Name] = ErrorCode(constant.StringVal(constant.MakeFromLiteral(lit.Value, lit.Kind, 0)))
+			}
+		}
+	}
+	return codes
+}
+
+func TestErrorCatalogRegistersEveryCode(t *testing.T) {
+	codes := catalogConstants(t)
+	seen := make(map[ErrorCode]string)
+	for name, code := range codes {
+		if !KnownErrorCode(code) {
+			t.Errorf("%s (%s) is declared but not registered", name, code)
+		}
+		if other, dup := seen[code]; dup {
+			t.Errorf("%s and %s share the code %s", name, other, code)
+		}
+		seen[code] = name
+	}
+	if len(errorCatalog) != len(codes) {
+		t.Errorf("catalog has %d codes, error.go declares %d", len(errorCatalog), len(codes))
+	}
+}
+
+func TestNewErrorRejectsUnknownCode(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic for an unregistered code")
+		}
+	}()
+	NewError(http.StatusTeapot, "SOMETHING_NEW", "not in the catalog")
+}
+
+// TestAPIErrorsUseCatalogCodes checks every APIError literal and every
+// respondError/NewError call in the module names a catalog constant, and
+// that nothing but NewError builds an apierror.Error, so no ad-hoc code
+// string can reach clients.
+func TestAPIErrorsUseCatalogCodes(t *testing.T) {
+	codes := catalogConstants(t)
+	root := filepath.Join("..", "..")
+
+	// Functions that forward a code they received as a parameter
+	forwarders := map[string]bool{"NewError": true, "respondError": true, "itemError": true}
+
+	fset := token.NewFileSet()
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && path != root && (d.Name() == "docs" || strings.HasPrefix(d.Name(), ".")) {
+			return filepath.SkipDir
+		}
+		if d.IsDir() || !strings.HasSuffix(path, ".go") || strings.HasSuffix(path, "_test.go") {
+			return nil
+		}
+
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		file, err := parser.ParseFile(fset, path, src, 0)
+		if err != nil {
+			return err
+		}
+
+		check := func(expr ast.Expr, enclosing string) {
+			var name string
+			switch e := expr.(type) {
+			case *ast.SelectorExpr:
+				name = e.Sel.Name
+			case *ast.Ident:
+				if forwarders[enclosing] && e.Name == "code" {
+					return
+				}
+				name = e.Name
+			}
+			if _, ok := codes[name]; !ok {
+				start, end := fset.Position(expr.Pos()), fset.Position(expr.End())
+				t.Errorf("%s: error code %s is not a catalog constant", start, src[start.Offset:end.Offset])
+			}
+		}
+
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok {
+				continue
+			}
+			ast.Inspect(fn, func(n ast.Node) bool {
+				switch n := n.(type) {
+				case *ast.CompositeLit:
+					if !isAPIErrorType(n.Type) {
+						return true
+					}
+					for _, elt := range n.Elts {
+						if kv, ok := elt.(*ast.KeyValueExpr); ok {
+							if key, ok := kv.Key.(*ast.Ident); ok && key.Name == "Code" {
+								check(kv.Value, fn.Name.Name)
+							}
+						}
+					}
+				case *ast.CallExpr:
+					switch callName(n.Fun) {
+					case "respondError":
+						if len(n.Args) >= 3 {
+							check(n.Args[2], fn.Name.Name)
+						}
+					case "NewError":
+						if len(n.Args) >= 2 {
+							check(n.Args[1], fn.Name.Name)
+						}
+					}
+					if sel, ok := n.Fun.(*ast.SelectorExpr); ok && fn.Name.Name != "NewError" {
+						if pkg, ok := sel.X.(*ast.Ident); ok && pkg.Name == "apierror" && sel.Sel.Name == "New" {
+							start := fset.Position(n.Pos())
+							t.Errorf("%s: build API errors with models.NewError, which checks the catalog", start)
+						}
+					}
+				}
+				return true
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("walk: %v", err)
+	}
+}
+
+func isAPIErrorType(expr ast.Expr) bool {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		return e.Name == "APIError"
+	case *ast.SelectorExpr:
+		return e.Sel.Name == "APIError"
+	}
+	return false
+}
+
+func callName(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		return e.Name
+	case *ast.SelectorExpr:
+		return e.Sel.Name
+	}
+	return ""
+}
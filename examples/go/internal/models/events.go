@@ -0,0 +1,94 @@
+package models
+
+import (
+	"context"
+	"sync"
+
+	"github.com/cbwinslow/template2/examples/go/pkg/events"
+)
+
+// WithEvents publishes an event to publisher after every change to a user:
+// events.UserCreated, events.UserUpdated and events.UserDeleted. Changes
+// made in InTx are published once the transaction commits.
+func WithEvents(publisher events.Publisher) UserServiceOption {
+	return func(s *UserService) {
+		s.events = publisher
+	}
+}
+
+// publish publishes e if the service has a publisher
+func (s *UserService) publish(ctx context.Context, e events.Event) {
+	if s.events != nil {
+		s.events.Publish(ctx, e)
+	}
+}
+
+// userUpdated returns the UserUpdated event of user as updated
+func userUpdated(user User) events.UserUpdated {
+	return events.UserUpdated{
+		UserID:        user.ID,
+		Name:          user.Name,
+		Email:         user.Email,
+		Role:          user.Role,
+		Active:        user.Active,
+		Locked:        user.LockedAt != nil,
+		EmailVerified: user.EmailVerified,
+	}
+}
+
+// txEvents holds the events of a transaction until it commits
+type txEvents struct {
+	mu      sync.Mutex
+	pending []events.Event
+}
+
+// Publish implements events.Publisher
+func (t *txEvents) Publish(_ context.Context, e events.Event) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pending = append(t.pending, e)
+}
+
+// flush publishes the held events to publisher in order
+func (t *txEvents) flush(ctx context.Context, publisher events.Publisher) {
+	t.mu.Lock()
+	pending := t.pending
+	t.pending = nil
+	t.mu.Unlock()
+	for _, e := range pending {
+		publisher.Publish(ctx, e)
+	}
+}
+
+// CanSeeEvent reports whether the user with userID and role may be sent e.
+// User changes may be seen by anyone who may read users; sign-ins, password
+// resets and token revocations only by the user concerned and by those who
+// may read the audit log.
+func CanSeeEvent(role string, userID int, e events.Event) bool {
+	var subject int
+	switch e := e.(type) {
+	case events.UserCreated, events.UserUpdated, events.UserDeleted:
+		return RoleHasPermission(role, PermUsersRead)
+	case events.LoginSucceeded:
+		subject = e.UserID
+	case events.LoginFailed:
+		subject = e.UserID
+	case events.PasswordReset:
+		subject = e.UserID
+	case events.TokensRevoked:
+		subject = e.UserID
+	}
+	return (subject != 0 && subject == userID) || RoleHasPermission(role, PermAuditRead)
+}
+
+// EndsAccess reports whether e invalidates the credentials of the user with
+// userID, so connections they opened should be closed
+func EndsAccess(userID int, e events.Event) bool {
+	switch e := e.(type) {
+	case events.TokensRevoked:
+		return e.UserID == userID
+	case events.UserDeleted:
+		return e.UserID == userID
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/cbwinslow/template2/examples/go/pkg/events"
+)
+
+// recordingPublisher collects the events published to it
+type recordingPublisher struct {
+	events []events.Event
+}
+
+func (p *recordingPublisher) Publish(_ context.Context, e events.Event) {
+	p.events = append(p.events, e)
+}
+
+func TestUserServicePublishesChanges(t *testing.T) {
+	published := &recordingPublisher{}
+	svc := NewUserService(WithEvents(published))
+	ctx := context.Background()
+
+	user, err := svc.Create(ctx, CreateUserRequest{Name: "Carol", Email: "carol@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.SetLocked(ctx, user.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	// Already locked: nothing changes, so nothing is published
+	if _, err := svc.SetLocked(ctx, user.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Delete(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Delete(ctx, user.ID); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("second delete: err = %v", err)
+	}
+
+	want := []events.Event{
+		events.UserCreated{UserID: user.ID, Name: "Carol", Email: "carol@example.com", Role: RoleUser},
+		events.UserUpdated{UserID: user.ID, Name: "Carol", Email: "carol@example.com", Role: RoleUser, Active: true, Locked: true, EmailVerified: true},
+		events.UserDeleted{UserID: user.ID},
+	}
+	if len(published.events) != len(want) {
+		t.Fatalf("published %+v, want %+v", published.events, want)
+	}
+	for i := range want {
+		if published.events[i] != want[i] {
+			t.Errorf("event %d = %+v, want %+v", i, published.events[i], want[i])
+		}
+	}
+}
+
+func TestInTxPublishesOnCommit(t *testing.T) {
+	published := &recordingPublisher{}
+	svc := NewUserService(WithEvents(published))
+	ctx := context.Background()
+
+	_ = svc.InTx(ctx, func(tx *UserService) error {
+		if _, err := tx.Create(ctx, CreateUserRequest{Name: "Carol", Email: "carol@example.com"}); err != nil {
+			return err
+		}
+		return errors.New("abort")
+	})
+	if len(published.events) != 0 {
+		t.Fatalf("rolled back transaction published %+v", published.events)
+	}
+
+	err := svc.InTx(ctx, func(tx *UserService) error {
+		if err := tx.Delete(ctx, 2); err != nil {
+			return err
+		}
+		if len(published.events) != 0 {
+			t.Error("event published before the transaction committed")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(published.events) != 1 || published.events[0] != (events.UserDeleted{UserID: 2}) {
+		t.Errorf("published %+v, want the deletion", published.events)
+	}
+}
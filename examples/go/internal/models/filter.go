@@ -0,0 +1,113 @@
+package models
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidFilter is returned when a filter names an unknown field or has
+// a malformed value
+var ErrInvalidFilter = errors.New("invalid filter")
+
+// userFilterFields builds a predicate for each filterable field from the
+// filter value. Text fields match case-insensitive substrings.
+var userFilterFields = map[string]func(value string) (func(User) bool, error){
+	"name": func(value string) (func(User) bool, error) {
+		value = strings.ToLower(value)
+		return func(u User) bool { return strings.Contains(strings.ToLower(u.Name), value) }, nil
+	},
+	"email": func(value string) (func(User) bool, error) {
+		value = strings.ToLower(value)
+		return func(u User) bool { return strings.Contains(strings.ToLower(u.Email), value) }, nil
+	},
+	"role": func(value string) (func(User) bool, error) {
+		if !ValidRole(value) {
+			return nil, ErrInvalidFilter
+		}
+		return func(u User) bool { return u.Role == value }, nil
+	},
+	"active": func(value string) (func(User) bool, error) {
+		active, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, ErrInvalidFilter
+		}
+		return func(u User) bool { return u.Active == active }, nil
+	},
+}
+
+// FilterableUserFields returns the fields accepted by ParseUserFilter
+func FilterableUserFields() []string {
+	fields := make([]string, 0, len(userFilterFields))
+	for field := range userFilterFields {
+		fields = append(fields, field)
+	}
+	slices.Sort(fields)
+	return fields
+}
+
+// UserCondition is one "field:value" condition of a UserFilter. Value has
+// been validated for the field, so repositories translating it into their
+// own query language need not check it again.
+type UserCondition struct {
+	Field string
+	Value string
+	match func(User) bool
+}
+
+// UserFilter keeps the users matching every one of its conditions
+type UserFilter struct {
+	Conditions []UserCondition
+}
+
+// ParseUserFilter parses "field:value" specs, e.g. "role:admin" or
+// "name:sam"; a user must match all of them
+func ParseUserFilter(specs []string) (UserFilter, error) {
+	var filter UserFilter
+	for _, spec := range specs {
+		field, value, ok := strings.Cut(spec, ":")
+		build, known := userFilterFields[field]
+		if !ok || !known || value == "" {
+			return UserFilter{}, ErrInvalidFilter
+		}
+		match, err := build(value)
+		if err != nil {
+			return UserFilter{}, err
+		}
+		filter.Conditions = append(filter.Conditions, UserCondition{Field: field, Value: value, match: match})
+	}
+	return filter, nil
+}
+
+// Apply returns the users matching the filter, keeping their order
+func (f UserFilter) Apply(users []User) []User {
+	if len(f.Conditions) == 0 {
+		return users
+	}
+	matched := users[:0:0]
+	for _, user := range users {
+		if f.matches(user) {
+			matched = append(matched, user)
+		}
+	}
+	return matched
+}
+
+func (f UserFilter) matches(user User) bool {
+	for _, condition := range f.Conditions {
+		if !condition.match(user) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesSearch reports whether user's name or email contains q.Search
+func (q UserQuery) matchesSearch(user User) bool {
+	if q.Search == "" {
+		return true
+	}
+	search := strings.ToLower(q.Search)
+	return strings.Contains(strings.ToLower(user.Name), search) || strings.Contains(strings.ToLower(user.Email), search)
+}
@@ -0,0 +1,86 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestUserFilterMatchesEveryCondition(t *testing.T) {
+	users := []User{
+		{ID: 1, Name: "Alice Admin", Role: RoleAdmin, Active: true},
+		{ID: 2, Name: "Bob", Role: RoleUser, Active: true},
+		{ID: 3, Name: "Alicia", Role: RoleUser, Active: false},
+	}
+
+	filter, err := ParseUserFilter([]string{"name:ALI", "active:true"})
+	if err != nil {
+		t.Fatalf("ParseUserFilter: %v", err)
+	}
+	got := filter.Apply(users)
+	if len(got) != 1 || got[0].ID != 1 {
+		t.Errorf("matched %+v, want only user 1", got)
+	}
+
+	for _, spec := range []string{"password:x", "role:superuser", "active:maybe", "name", "name:"} {
+		if _, err := ParseUserFilter([]string{spec}); !errors.Is(err, ErrInvalidFilter) {
+			t.Errorf("ParseUserFilter(%q) err = %v, want ErrInvalidFilter", spec, err)
+		}
+	}
+}
+
+func TestUserServiceQueryPagesMatches(t *testing.T) {
+	svc := NewUserService()
+	ctx := context.Background()
+	for _, email := range []string{"sam1@example.com", "sam2@example.com", "sam3@example.com"} {
+		if _, err := svc.Create(ctx, CreateUserRequest{Name: "Sam", Email: email}); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+	filter, err := ParseUserFilter([]string{"email:SAM"})
+	if err != nil {
+		t.Fatalf("ParseUserFilter: %v", err)
+	}
+
+	for _, tc := range []struct {
+		offset, limit int
+		want          []int
+	}{
+		{0, 0, []int{5, 4, 3}},
+		{1, 1, []int{4}},
+		{2, 5, []int{3}},
+		{3, 5, []int{}},
+	} {
+		users, total, err := svc.Query(ctx, UserQuery{Filter: filter, Sort: UserSort{Field: "id", Desc: true}, Offset: tc.offset, Limit: tc.limit})
+		if err != nil {
+			t.Fatalf("Query: %v", err)
+		}
+		if total != 3 || !slices.Equal(ids(users), tc.want) {
+			t.Errorf("offset %d limit %d: got %v of %d, want %v of 3", tc.offset, tc.limit, ids(users), total, tc.want)
+		}
+	}
+
+	if _, _, err := svc.Query(ctx, UserQuery{Sort: UserSort{Field: "password"}}); !errors.Is(err, ErrInvalidSort) {
+		t.Errorf("Query by password: err = %v, want ErrInvalidSort", err)
+	}
+}
+
+func TestUserServiceQuerySearchesNameAndEmail(t *testing.T) {
+	svc := NewUserService()
+	ctx := context.Background()
+	if _, err := svc.Create(ctx, CreateUserRequest{Name: "Sam", Email: "sam@example.com"}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := svc.Create(ctx, CreateUserRequest{Name: "Dana", Email: "dana@sample.org"}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	users, total, err := svc.Query(ctx, UserQuery{Search: "SAM"})
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if total != 2 || !slices.Equal(ids(users), []int{3, 4}) {
+		t.Errorf("search sam = %v of %d, want [3 4] of 2", ids(users), total)
+	}
+}
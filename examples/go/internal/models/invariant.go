@@ -0,0 +1,53 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Invariant is a cross-field rule that must hold for a user after an update
+// has been merged. Check returns false when the rule is violated.
+type Invariant struct {
+	Name    string
+	Message string
+	Check   func(User) bool
+}
+
+// InvariantError reports the invariant violated by an update
+type InvariantError struct {
+	Rule    string
+	Message string
+}
+
+func (e *InvariantError) Error() string {
+	return fmt.Sprintf("invariant %s violated: %s", e.Rule, e.Message)
+}
+
+// WithInvariants adds rules checked by Update before changes are stored
+func WithInvariants(invariants ...Invariant) UserServiceOption {
+	return func(s *UserService) {
+		s.invariants = append(s.invariants, invariants...)
+	}
+}
+
+// AdminEmailDomain requires users with the admin role to have an email
+// address in domain
+func AdminEmailDomain(domain string) Invariant {
+	suffix := "@" + strings.ToLower(domain)
+	return Invariant{
+		Name:    "admin_email_domain",
+		Message: fmt.Sprintf("admins must use an email address in %s", domain),
+		Check: func(u User) bool {
+			return u.Role != RoleAdmin || strings.HasSuffix(strings.ToLower(u.Email), suffix)
+		},
+	}
+}
+
+func (s *UserService) checkInvariants(user User) error {
+	for _, invariant := range s.invariants {
+		if !invariant.Check(user) {
+			return &InvariantError{Rule: invariant.Name, Message: invariant.Message}
+		}
+	}
+	return nil
+}
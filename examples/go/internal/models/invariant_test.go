@@ -0,0 +1,42 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestUpdateRejectsInvariantViolation(t *testing.T) {
+	svc := NewUserService(WithInvariants(AdminEmailDomain("corp.example")))
+	ctx := context.Background()
+
+	// Bob (ID 2) is a regular user with an external address.
+	admin := RoleAdmin
+	_, err := svc.Update(ctx, 2, UpdateUserRequest{Role: &admin})
+
+	var invErr *InvariantError
+	if !errors.As(err, &invErr) {
+		t.Fatalf("err = %v, want *InvariantError", err)
+	}
+	if invErr.Rule != "admin_email_domain" {
+		t.Errorf("rule = %q, want admin_email_domain", invErr.Rule)
+	}
+
+	bob, _ := svc.Get(ctx, 2)
+	if bob.Role != RoleUser {
+		t.Errorf("role = %q after rejected update, want unchanged %q", bob.Role, RoleUser)
+	}
+}
+
+func TestUpdateAllowsPatchSatisfyingInvariant(t *testing.T) {
+	svc := NewUserService(WithInvariants(AdminEmailDomain("corp.example")))
+
+	admin, email := RoleAdmin, "bob@corp.example"
+	user, err := svc.Update(context.Background(), 2, UpdateUserRequest{Role: &admin, Email: &email})
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if user.Role != RoleAdmin || user.Email != email {
+		t.Errorf("got %+v, want admin with %s", user, email)
+	}
+}
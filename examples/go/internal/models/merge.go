@@ -0,0 +1,102 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/cbwinslow/template2/examples/go/pkg/events"
+)
+
+// MergeHook moves data owned by source to target during a merge. Hooks run
+// in registration order once the repository has merged the users, so a merge
+// the repository rejects leaves the source's data untouched. With a
+// transactional repository they run before the merge commits and a failing
+// hook undoes it, but not the work of the hooks before it: hooks must
+// therefore be safe to run again when the merge is retried. They run
+// outside the repository's locks and may call back into the UserService.
+type MergeHook func(ctx context.Context, source, target User) error
+
+// WithMergeHooks registers hooks that reassign owned data on Merge
+func WithMergeHooks(hooks ...MergeHook) UserServiceOption {
+	return func(s *UserService) {
+		s.mergeHooks = append(s.mergeHooks, hooks...)
+	}
+}
+
+// Merge folds the user sourceID into targetID. Fields missing on the target
+// are filled from the source and the source is soft-deleted; then the
+// registered hooks reassign its owned data. If the repository is
+// transactional this all happens in one transaction, and a hook failing
+// leaves the users unmerged so the merge can be retried. Otherwise the merge
+// stands and the hooks' failures are returned with ErrIncompleteMerge and
+// the merged target. Every hook runs even if an earlier one fails.
+func (s *UserService) Merge(ctx context.Context, targetID, sourceID int) (_ User, err error) {
+	ctx, span := tracer.Start(ctx, "UserService.Merge")
+	defer func() { endSpan(span, err) }()
+
+	if targetID == sourceID {
+		return User{}, ErrSelfMerge
+	}
+
+	if !s.Transactional() {
+		source, merged, err := s.mergeUsers(ctx, targetID, sourceID)
+		if err != nil {
+			return User{}, err
+		}
+		if err := s.reassign(ctx, source, merged); err != nil {
+			return merged, fmt.Errorf("%w: %w", ErrIncompleteMerge, err)
+		}
+		return merged, nil
+	}
+
+	var merged User
+	err = s.InTx(ctx, func(tx *UserService) error {
+		source, target, err := tx.mergeUsers(ctx, targetID, sourceID)
+		if err != nil {
+			return err
+		}
+		merged = target
+		return tx.reassign(ctx, source, target)
+	})
+	if err != nil {
+		return User{}, err
+	}
+	return merged, nil
+}
+
+// mergeUsers has the repository merge sourceID into targetID, returning the
+// source as it was and the merged target
+func (s *UserService) mergeUsers(ctx context.Context, targetID, sourceID int) (source, merged User, err error) {
+	stmtCtx, cancel := s.statementContext(ctx)
+	defer cancel()
+
+	merged, err = s.repo.Merge(stmtCtx, targetID, sourceID, func(target *User, src User) error {
+		source = src
+		if target.Age == 0 {
+			target.Age = src.Age
+		}
+		target.UpdatedAt = timestamp()
+		return nil
+	})
+	if err != nil {
+		return User{}, User{}, err
+	}
+	s.publish(ctx, userUpdated(merged))
+	s.publish(ctx, events.UserDeleted{UserID: sourceID})
+	return source, merged, nil
+}
+
+// reassign runs the merge hooks, returning their failures together
+func (s *UserService) reassign(ctx context.Context, source, target User) error {
+	var hookErrs []error
+	for _, hook := range s.mergeHooks {
+		if err := hook(ctx, source, target); err != nil {
+			hookErrs = append(hookErrs, err)
+		}
+	}
+	if err := errors.Join(hookErrs...); err != nil {
+		return fmt.Errorf("reassign data of user %d: %w", source.ID, err)
+	}
+	return nil
+}
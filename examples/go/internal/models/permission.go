@@ -0,0 +1,42 @@
+package models
+
+// Permissions granted by roles
+const (
+	PermUsersRead    = "users:read"
+	PermUsersWrite   = "users:write"
+	PermUsersDelete  = "users:delete"
+	PermUsersExport  = "users:export"
+	PermTokensRevoke = "tokens:revoke"
+	PermUsersLock    = "users:lock"
+	PermAuditRead    = "audit:read"
+	PermWebhooks     = "webhooks:manage"
+	PermLogsManage   = "logs:manage"
+	PermFlagsManage  = "flags:manage"
+)
+
+// rolePermissions lists what each role may do. Admins hold every permission.
+var rolePermissions = map[string][]string{
+	RoleUser:  {PermUsersRead},
+	RoleAdmin: {PermUsersRead, PermUsersWrite, PermUsersDelete, PermUsersExport, PermTokensRevoke, PermUsersLock, PermAuditRead, PermWebhooks, PermLogsManage, PermFlagsManage},
+}
+
+// RolePermissions returns the permissions granted to role; unknown roles
+// have none
+func RolePermissions(role string) []string {
+	return append([]string(nil), rolePermissions[role]...)
+}
+
+// RoleHasPermission reports whether role grants permission
+func RoleHasPermission(role, permission string) bool {
+	for _, granted := range rolePermissions[role] {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// Permissions returns the permissions the user's role grants
+func (u User) Permissions() []string {
+	return RolePermissions(u.Role)
+}
@@ -0,0 +1,26 @@
+package models
+
+import "testing"
+
+func TestRoleHasPermission(t *testing.T) {
+	tests := []struct {
+		role, permission string
+		want             bool
+	}{
+		{RoleUser, PermUsersRead, true},
+		{RoleUser, PermUsersWrite, false},
+		{RoleAdmin, PermUsersDelete, true},
+		{"guest", PermUsersRead, false},
+	}
+	for _, tt := range tests {
+		if got := RoleHasPermission(tt.role, tt.permission); got != tt.want {
+			t.Errorf("RoleHasPermission(%q, %q) = %v, want %v", tt.role, tt.permission, got, tt.want)
+		}
+	}
+
+	perms := RolePermissions(RoleUser)
+	perms[0] = PermUsersDelete
+	if RoleHasPermission(RoleUser, PermUsersDelete) {
+		t.Error("RolePermissions returned the shared slice")
+	}
+}
@@ -0,0 +1,20 @@
+-- Email uniqueness only applies to live users so a soft-deleted account
+-- does not block its address. IF NOT EXISTS lets databases created before
+-- migrations were versioned adopt this as their baseline.
+
+-- +goose Up
+CREATE TABLE IF NOT EXISTS users (
+	id         BIGSERIAL PRIMARY KEY,
+	name       TEXT        NOT NULL,
+	email      TEXT        NOT NULL,
+	age        INTEGER     NOT NULL DEFAULT 0,
+	role       TEXT        NOT NULL,
+	active     BOOLEAN     NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL,
+	deleted_at TIMESTAMPTZ
+);
+CREATE UNIQUE INDEX IF NOT EXISTS users_live_email ON users (lower(email)) WHERE deleted_at IS NULL;
+
+-- +goose Down
+DROP TABLE users;
@@ -0,0 +1,8 @@
+-- Accounts that existed before verification was introduced are treated as
+-- verified so they keep their access; new rows set the column explicitly.
+
+-- +goose Up
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified BOOLEAN NOT NULL DEFAULT TRUE;
+
+-- +goose Down
+ALTER TABLE users DROP COLUMN email_verified;
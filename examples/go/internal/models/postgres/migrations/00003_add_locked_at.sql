@@ -0,0 +1,8 @@
+-- Accounts an admin has locked carry the time of the lock; NULL means the
+-- account may log in.
+
+-- +goose Up
+ALTER TABLE users ADD COLUMN IF NOT EXISTS locked_at TIMESTAMPTZ;
+
+-- +goose Down
+ALTER TABLE users DROP COLUMN locked_at;
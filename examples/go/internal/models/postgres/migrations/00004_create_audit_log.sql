@@ -0,0 +1,23 @@
+-- Audit records written by pkg/audit. actor_id is 0 for actions without an
+-- authenticated caller, such as failed logins. Records are deleted once
+-- older than the configured retention, which the occurred_at index serves.
+
+-- +goose Up
+CREATE TABLE IF NOT EXISTS audit_log (
+	id          BIGSERIAL PRIMARY KEY,
+	occurred_at TIMESTAMPTZ NOT NULL,
+	action      TEXT        NOT NULL,
+	actor_id    INTEGER     NOT NULL DEFAULT 0,
+	target      TEXT        NOT NULL DEFAULT '',
+	target_id   INTEGER     NOT NULL DEFAULT 0,
+	ip          TEXT        NOT NULL DEFAULT '',
+	request_id  TEXT        NOT NULL DEFAULT '',
+	changes     JSONB,
+	fields      JSONB
+);
+CREATE INDEX IF NOT EXISTS audit_log_occurred_at ON audit_log (occurred_at);
+CREATE INDEX IF NOT EXISTS audit_log_actor ON audit_log (actor_id, occurred_at);
+CREATE INDEX IF NOT EXISTS audit_log_target ON audit_log (target_id, occurred_at);
+
+-- +goose Down
+DROP TABLE audit_log;
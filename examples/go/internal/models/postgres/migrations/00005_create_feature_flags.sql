@@ -0,0 +1,14 @@
+-- Feature flags changed at runtime through the admin API, written by
+-- pkg/flags. They override the flags file shipped with the release.
+
+-- +goose Up
+CREATE TABLE IF NOT EXISTS feature_flags (
+	name        TEXT        PRIMARY KEY,
+	description TEXT        NOT NULL DEFAULT '',
+	enabled     BOOLEAN     NOT NULL DEFAULT FALSE,
+	percent     INTEGER     NOT NULL DEFAULT 100 CHECK (percent BETWEEN 0 AND 100),
+	updated_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- +goose Down
+DROP TABLE feature_flags;
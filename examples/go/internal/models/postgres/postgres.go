@@ -0,0 +1,438 @@
+// Package postgres stores users in PostgreSQL through database/sql and the
+// pgx driver
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	_ "github.com/jackc/pgx/v5/stdlib" // registers the "pgx" driver
+
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+)
+
+const userColumns = `id, name, email, age, role, active, email_verified, created_at, updated_at, deleted_at, locked_at`
+
+// sortColumns maps models.UserSort fields to the expressions ordering them.
+// The C collation compares bytes like the in-memory sort does.
+var sortColumns = map[string]string{
+	"id":         "id",
+	"name":       `lower(name) COLLATE "C"`,
+	"email":      `lower(email) COLLATE "C"`,
+	"created_at": "created_at",
+}
+
+// uniqueViolation is the SQLSTATE for a unique index conflict
+const uniqueViolation = "23505"
+
+// PoolConfig bounds the connection pool; zero values keep the database/sql
+// defaults
+type PoolConfig struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
+
+// Open connects to the database at url, applies the pool limits and checks
+// that the database is reachable
+func Open(ctx context.Context, url string, pool PoolConfig) (*sql.DB, error) {
+	db, err := sql.Open("pgx", url)
+	if err != nil {
+		return nil, fmt.Errorf("postgres: open: %w", err)
+	}
+	db.SetMaxOpenConns(pool.MaxOpenConns)
+	db.SetMaxIdleConns(pool.MaxIdleConns)
+	db.SetConnMaxLifetime(pool.ConnMaxLifetime)
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("postgres: ping: %w", err)
+	}
+	return db, nil
+}
+
+// UserRepository is a models.UserRepository backed by a users table
+type UserRepository struct {
+	// db runs the statements: conn, or tx within InTx
+	db   dbtx
+	conn *sql.DB
+	tx   *sql.Tx
+}
+
+// dbtx is what *sql.DB and *sql.Tx have in common
+type dbtx interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// NewUserRepository creates a repository on db. Call Migrate before first use
+// on a fresh database.
+func NewUserRepository(db *sql.DB) *UserRepository {
+	return &UserRepository{db: db, conn: db}
+}
+
+// Migrate applies any pending migrations. It is a shorthand for
+// NewMigrator(db).Up for callers that only need the schema current.
+func (r *UserRepository) Migrate(ctx context.Context) error {
+	migrator, err := NewMigrator(r.conn)
+	if err != nil {
+		return err
+	}
+	_, err = migrator.Up(ctx)
+	return err
+}
+
+// List implements models.UserRepository
+func (r *UserRepository) List(ctx context.Context, includeDeleted bool) ([]models.User, error) {
+	if includeDeleted {
+		return r.query(ctx, `SELECT `+userColumns+` FROM users ORDER BY id`)
+	}
+	return r.query(ctx, `SELECT `+userColumns+` FROM users WHERE deleted_at IS NULL ORDER BY id`)
+}
+
+// Page implements models.UserRepository
+func (r *UserRepository) Page(ctx context.Context, afterID, limit int) ([]models.User, error) {
+	return r.query(ctx, `SELECT `+userColumns+` FROM users WHERE deleted_at IS NULL AND id > $1 ORDER BY id LIMIT $2`, afterID, limit)
+}
+
+// Query implements models.UserRepository. Filtering, ordering and paging run
+// in the database, and the total is a window count over the same WHERE.
+func (r *UserRepository) Query(ctx context.Context, q models.UserQuery) ([]models.User, int, error) {
+	where, args, err := userWhere(q)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	field := q.Sort.Field
+	if field == "" {
+		field = "id"
+	}
+	column, ok := sortColumns[field]
+	if !ok {
+		return nil, 0, models.ErrInvalidSort
+	}
+	dir := ""
+	if q.Sort.Desc {
+		dir = " DESC"
+	}
+	order := " ORDER BY " + column + dir
+	if field != "id" {
+		order += ", id" + dir
+	}
+
+	page := order
+	pageArgs := args
+	if q.Limit > 0 {
+		pageArgs = append(pageArgs, q.Limit)
+		page += " LIMIT $" + strconv.Itoa(len(pageArgs))
+	}
+	if q.Offset > 0 {
+		pageArgs = append(pageArgs, q.Offset)
+		page += " OFFSET $" + strconv.Itoa(len(pageArgs))
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT `+userColumns+`, count(*) OVER () FROM users`+where+page, pageArgs...)
+	if err != nil {
+		return nil, 0, mapError(err)
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	total := 0
+	for rows.Next() {
+		user, err := scanUser(rows, &total)
+		if err != nil {
+			return nil, 0, err
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, mapError(err)
+	}
+
+	// Past the last page there is no row to carry the window count
+	if len(users) == 0 && q.Offset > 0 {
+		if err := r.db.QueryRowContext(ctx, `SELECT count(*) FROM users`+where, args...).Scan(&total); err != nil {
+			return nil, 0, mapError(err)
+		}
+	}
+	return users, total, nil
+}
+
+// userWhere translates the filter of q into a WHERE clause and its arguments
+func userWhere(q models.UserQuery) (string, []interface{}, error) {
+	var (
+		conds []string
+		args  []interface{}
+	)
+	param := func(v interface{}) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if !q.IncludeDeleted {
+		conds = append(conds, "deleted_at IS NULL")
+	}
+	if q.Search != "" {
+		search := param(q.Search)
+		conds = append(conds, "(strpos(lower(name), lower("+search+")) > 0 OR strpos(lower(email), lower("+search+")) > 0)")
+	}
+	for _, c := range q.Filter.Conditions {
+		switch c.Field {
+		case "name", "email":
+			conds = append(conds, "strpos(lower("+c.Field+"), lower("+param(c.Value)+")) > 0")
+		case "role":
+			conds = append(conds, "role = "+param(c.Value))
+		case "active":
+			active, err := strconv.ParseBool(c.Value)
+			if err != nil {
+				return "", nil, models.ErrInvalidFilter
+			}
+			conds = append(conds, "active = "+param(active))
+		default:
+			return "", nil, models.ErrInvalidFilter
+		}
+	}
+
+	if len(conds) == 0 {
+		return "", nil, nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args, nil
+}
+
+// Get implements models.UserRepository
+func (r *UserRepository) Get(ctx context.Context, id int) (models.User, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE id = $1 AND deleted_at IS NULL`, id)
+	return scanUser(row)
+}
+
+// GetMany implements models.UserRepository
+func (r *UserRepository) GetMany(ctx context.Context, ids []int) ([]models.User, error) {
+	keys := make([]int64, len(ids))
+	for i, id := range ids {
+		keys[i] = int64(id)
+	}
+	return r.query(ctx, `SELECT `+userColumns+` FROM users WHERE id = ANY($1) AND deleted_at IS NULL ORDER BY id`, keys)
+}
+
+// GetByEmail implements models.UserRepository
+func (r *UserRepository) GetByEmail(ctx context.Context, email string) (models.User, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE lower(email) = lower($1) AND deleted_at IS NULL`, email)
+	return scanUser(row)
+}
+
+// Create implements models.UserRepository
+func (r *UserRepository) Create(ctx context.Context, user models.User) (models.User, error) {
+	err := r.db.QueryRowContext(ctx,
+		`INSERT INTO users (name, email, age, role, active, email_verified, created_at, updated_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`,
+		user.Name, user.Email, user.Age, user.Role, user.Active, user.EmailVerified, user.CreatedAt, user.UpdatedAt,
+	).Scan(&user.ID)
+	if err != nil {
+		return models.User{}, mapError(err)
+	}
+	return user, nil
+}
+
+// Update implements models.UserRepository. The row is locked for the
+// duration of apply so concurrent updates are serialized.
+func (r *UserRepository) Update(ctx context.Context, id int, apply func(*models.User) error) (previous, updated models.User, err error) {
+	err = r.inTx(ctx, func(tx *sql.Tx) error {
+		previous, err = scanUser(tx.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`, id))
+		if err != nil {
+			return err
+		}
+
+		updated = previous
+		if err := apply(&updated); err != nil {
+			return err
+		}
+		return save(ctx, tx, updated)
+	})
+	if err != nil {
+		return models.User{}, models.User{}, err
+	}
+	return previous, updated, nil
+}
+
+// SoftDelete implements models.UserRepository
+func (r *UserRepository) SoftDelete(ctx context.Context, id int) error {
+	return r.exec(ctx, `UPDATE users SET deleted_at = $2, updated_at = $2 WHERE id = $1 AND deleted_at IS NULL`, id, time.Now().UTC())
+}
+
+// Delete implements models.UserRepository
+func (r *UserRepository) Delete(ctx context.Context, id int) error {
+	return r.exec(ctx, `DELETE FROM users WHERE id = $1`, id)
+}
+
+// exec runs a statement affecting the row of one user, reporting
+// models.ErrUserNotFound when it matched none
+func (r *UserRepository) exec(ctx context.Context, query string, args ...interface{}) error {
+	result, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return mapError(err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return mapError(err)
+	}
+	if n == 0 {
+		return models.ErrUserNotFound
+	}
+	return nil
+}
+
+// Merge implements models.UserRepository. Both rows are locked in ID order
+// so that two merges of the same pair cannot deadlock.
+func (r *UserRepository) Merge(ctx context.Context, targetID, sourceID int, apply func(target *models.User, source models.User) error) (merged models.User, err error) {
+	err = r.inTx(ctx, func(tx *sql.Tx) error {
+		locked, err := queryUsers(ctx, tx,
+			`SELECT `+userColumns+` FROM users WHERE id IN ($1, $2) AND deleted_at IS NULL ORDER BY id FOR UPDATE`,
+			targetID, sourceID)
+		if err != nil {
+			return err
+		}
+
+		var target, source *models.User
+		for i := range locked {
+			switch locked[i].ID {
+			case targetID:
+				target = &locked[i]
+			case sourceID:
+				source = &locked[i]
+			}
+		}
+		if target == nil || source == nil {
+			return models.ErrUserNotFound
+		}
+
+		merged = *target
+		if err := apply(&merged, *source); err != nil {
+			return err
+		}
+		if err := save(ctx, tx, merged); err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+		_, err = tx.ExecContext(ctx, `UPDATE users SET deleted_at = $2, updated_at = $2 WHERE id = $1`, sourceID, now)
+		return mapError(err)
+	})
+	if err != nil {
+		return models.User{}, err
+	}
+	return merged, nil
+}
+
+func (r *UserRepository) query(ctx context.Context, query string, args ...interface{}) ([]models.User, error) {
+	return queryUsers(ctx, r.db, query, args...)
+}
+
+// InTx implements models.Transactor. Within a transaction it joins it rather
+// than nesting another.
+func (r *UserRepository) InTx(ctx context.Context, fn func(models.UserRepository) error) error {
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		return fn(&UserRepository{db: tx, conn: r.conn, tx: tx})
+	})
+}
+
+// inTx runs fn in a transaction, committing if it returns nil. On a
+// repository returned by InTx, fn joins that transaction instead, which InTx
+// commits.
+func (r *UserRepository) inTx(ctx context.Context, fn func(*sql.Tx) error) error {
+	if r.tx != nil {
+		return fn(r.tx)
+	}
+	tx, err := r.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return mapError(err)
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return mapError(tx.Commit())
+}
+
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func queryUsers(ctx context.Context, q queryer, query string, args ...interface{}) ([]models.User, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, mapError(err)
+	}
+	return users, nil
+}
+
+func save(ctx context.Context, tx *sql.Tx, user models.User) error {
+	_, err := tx.ExecContext(ctx,
+		`UPDATE users SET name = $2, email = $3, age = $4, role = $5, active = $6, email_verified = $7, updated_at = $8, locked_at = $9 WHERE id = $1`,
+		user.ID, user.Name, user.Email, user.Age, user.Role, user.Active, user.EmailVerified, user.UpdatedAt, user.LockedAt)
+	return mapError(err)
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanUser reads the userColumns of row, followed by any extra columns into
+// extra
+func scanUser(row scanner, extra ...interface{}) (models.User, error) {
+	var user models.User
+	dest := []interface{}{&user.ID, &user.Name, &user.Email, &user.Age, &user.Role, &user.Active, &user.EmailVerified,
+		&user.CreatedAt, &user.UpdatedAt, &user.DeletedAt, &user.LockedAt}
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return models.User{}, mapError(err)
+	}
+
+	user.CreatedAt = user.CreatedAt.UTC()
+	user.UpdatedAt = user.UpdatedAt.UTC()
+	if user.DeletedAt != nil {
+		deleted := user.DeletedAt.UTC()
+		user.DeletedAt = &deleted
+	}
+	if user.LockedAt != nil {
+		locked := user.LockedAt.UTC()
+		user.LockedAt = &locked
+	}
+	return user, nil
+}
+
+// mapError translates driver errors into the models errors the service and
+// handlers understand
+func mapError(err error) error {
+	var pgErr *pgconn.PgError
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, sql.ErrNoRows):
+		return models.ErrUserNotFound
+	case errors.As(err, &pgErr) && pgErr.Code == uniqueViolation:
+		return models.ErrEmailTaken
+	default:
+		return err
+	}
+}
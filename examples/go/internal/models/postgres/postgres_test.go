@@ -0,0 +1,146 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+)
+
+// newTestService connects to POSTGRES_TEST_DSN, which should point at a
+// disposable database; the schema is dropped first
+func newTestService(t *testing.T) *models.UserService {
+	t.Helper()
+	dsn := os.Getenv("POSTGRES_TEST_DSN")
+	if dsn == "" {
+		t.Skip("POSTGRES_TEST_DSN not set")
+	}
+
+	ctx := context.Background()
+	db, err := Open(ctx, dsn, PoolConfig{MaxOpenConns: 4})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := db.ExecContext(ctx, `DROP TABLE IF EXISTS users, audit_log, feature_flags, goose_db_version`); err != nil {
+		t.Fatalf("drop table: %v", err)
+	}
+	repo := NewUserRepository(db)
+	if err := repo.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	return models.NewUserService(models.WithRepository(repo))
+}
+
+func TestUserRepositoryRoundTrip(t *testing.T) {
+	svc := newTestService(t)
+	ctx := context.Background()
+
+	alice, err := svc.Create(ctx, models.CreateUserRequest{Name: "Alice", Email: "alice@example.com"})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := svc.Create(ctx, models.CreateUserRequest{Name: "Alias", Email: "ALICE@example.com"}); !errors.Is(err, models.ErrEmailTaken) {
+		t.Fatalf("duplicate email: err = %v, want ErrEmailTaken", err)
+	}
+
+	got, err := svc.GetByEmail(ctx, "Alice@Example.com")
+	if err != nil || got.ID != alice.ID {
+		t.Fatalf("GetByEmail = %+v, %v", got, err)
+	}
+
+	name := "Alice Johnson"
+	previous, updated, err := svc.UpdateWithPrevious(ctx, alice.ID, models.UpdateUserRequest{Name: &name})
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if previous.Name != "Alice" || updated.Name != name {
+		t.Errorf("update previous=%q updated=%q", previous.Name, updated.Name)
+	}
+
+	if err := svc.Delete(ctx, alice.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := svc.Get(ctx, alice.ID); !errors.Is(err, models.ErrUserNotFound) {
+		t.Errorf("Get after delete: err = %v, want ErrUserNotFound", err)
+	}
+}
+
+func TestUserRepositoryMergeAndPage(t *testing.T) {
+	svc := newTestService(t)
+	ctx := context.Background()
+
+	var ids []int
+	for i := 0; i < 3; i++ {
+		user, err := svc.Create(ctx, models.CreateUserRequest{
+			Name:  fmt.Sprintf("User %d", i),
+			Email: fmt.Sprintf("user%d@example.com", i),
+			Age:   20 + i,
+		})
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		ids = append(ids, user.ID)
+	}
+
+	if _, err := svc.Merge(ctx, ids[0], ids[1]); err != nil {
+		t.Fatalf("Merge: %v", err)
+	}
+	page, err := svc.Page(ctx, 0, 10)
+	if err != nil {
+		t.Fatalf("Page: %v", err)
+	}
+	if len(page) != 2 || page[0].ID != ids[0] || page[1].ID != ids[2] {
+		t.Errorf("page after merge = %+v", page)
+	}
+	many, err := svc.GetMany(ctx, []int{ids[2], ids[1], ids[0], 999999})
+	if err != nil {
+		t.Fatalf("GetMany: %v", err)
+	}
+	if len(many) != 2 || many[0].ID != ids[0] || many[1].ID != ids[2] {
+		t.Errorf("GetMany after merge = %+v", many)
+	}
+
+	// The merged-away address is free again
+	if _, err := svc.Create(ctx, models.CreateUserRequest{Name: "Again", Email: "user1@example.com"}); err != nil {
+		t.Errorf("reuse merged email: %v", err)
+	}
+}
+
+func TestUserRepositoryQuery(t *testing.T) {
+	svc := newTestService(t)
+	ctx := context.Background()
+
+	var ids []int
+	for i, name := range []string{"bravo", "Alpha", "charlie"} {
+		user, err := svc.Create(ctx, models.CreateUserRequest{Name: name, Email: fmt.Sprintf("query%d@example.com", i)})
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		ids = append(ids, user.ID)
+	}
+	filter, err := models.ParseUserFilter([]string{"email:QUERY"})
+	if err != nil {
+		t.Fatalf("ParseUserFilter: %v", err)
+	}
+
+	users, total, err := svc.Query(ctx, models.UserQuery{Filter: filter, Sort: models.UserSort{Field: "name"}, Offset: 1, Limit: 1})
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if total != 3 || len(users) != 1 || users[0].ID != ids[0] {
+		t.Errorf("second page by name = %+v of %d, want user %d of 3", users, total, ids[0])
+	}
+
+	users, total, err = svc.Query(ctx, models.UserQuery{Filter: filter, Offset: 10, Limit: 5})
+	if err != nil {
+		t.Fatalf("Query past the end: %v", err)
+	}
+	if total != 3 || len(users) != 0 {
+		t.Errorf("past the end = %+v of %d, want none of 3", users, total)
+	}
+}
@@ -0,0 +1,397 @@
+package models
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// UserRepository persists users for a UserService. The service applies
+// defaults, role checks and invariants; the repository owns IDs, email
+// uniqueness among live users and atomicity. Implementations must be safe for
+// concurrent use, stop when ctx is done and report a missing user as
+// ErrUserNotFound and a duplicate email as ErrEmailTaken.
+type UserRepository interface {
+	// List returns all live users ordered by ID, and the soft-deleted ones
+	// among them when includeDeleted is set
+	List(ctx context.Context, includeDeleted bool) ([]User, error)
+	// Page returns up to limit live users with IDs greater than afterID,
+	// ordered by ID
+	Page(ctx context.Context, afterID, limit int) ([]User, error)
+	// Query returns the slice of the users matching q.Filter that q selects,
+	// in q.Sort order, together with how many users match in all
+	Query(ctx context.Context, q UserQuery) ([]User, int, error)
+	// Get returns the live user with the given ID
+	Get(ctx context.Context, id int) (User, error)
+	// GetMany returns the live users among ids, ordered by ID; IDs of no
+	// live user are skipped rather than failing the call
+	GetMany(ctx context.Context, ids []int) ([]User, error)
+	// GetByEmail returns the live user owning email, compared
+	// case-insensitively
+	GetByEmail(ctx context.Context, email string) (User, error)
+	// Create stores user under a newly assigned ID and returns it
+	Create(ctx context.Context, user User) (User, error)
+	// Update loads the user, lets apply modify it and stores the result as
+	// one atomic step, returning the user before and after. An error from
+	// apply aborts the update.
+	Update(ctx context.Context, id int, apply func(*User) error) (User, User, error)
+	// SoftDelete marks the live user with the given ID as deleted, hiding it
+	// from every other method and freeing its email
+	SoftDelete(ctx context.Context, id int) error
+	// Delete permanently removes the user with the given ID, live or
+	// soft-deleted
+	Delete(ctx context.Context, id int) error
+	// Merge loads both users, lets apply modify the target and then stores
+	// the target and soft-deletes the source as one atomic step. An error
+	// from apply aborts the merge.
+	Merge(ctx context.Context, targetID, sourceID int, apply func(target *User, source User) error) (User, error)
+}
+
+// Transactor is implemented by repositories that can run several operations
+// as one transaction
+type Transactor interface {
+	// InTx calls fn with a repository whose operations all belong to one
+	// transaction, committed if fn returns nil and rolled back otherwise
+	InTx(ctx context.Context, fn func(UserRepository) error) error
+}
+
+// MemoryUserRepository is the default in-process UserRepository
+type MemoryUserRepository struct {
+	mu       sync.RWMutex
+	users    map[int]*User
+	nextID   int
+	maxUsers int
+	// version counts committed writes so InTx can detect ones made while
+	// its transaction ran
+	version uint64
+}
+
+// NewMemoryUserRepository creates an in-memory repository seeded with sample
+// users. maxUsers caps how many users it holds; zero means unlimited.
+// Soft-deleted users still occupy memory and count toward the cap.
+func NewMemoryUserRepository(maxUsers int) *MemoryUserRepository {
+	r := &MemoryUserRepository{
+		users:    make(map[int]*User),
+		nextID:   1,
+		maxUsers: maxUsers,
+	}
+
+	now := time.Now().UTC()
+	for _, seed := range []User{
+		{Name: "Alice Johnson", Email: "alice@example.com", Age: 30, Role: RoleAdmin, Active: true, EmailVerified: true},
+		{Name: "Bob Smith", Email: "bob@example.com", Age: 25, Role: RoleUser, Active: true, EmailVerified: true},
+	} {
+		user := seed
+		user.ID = r.nextID
+		user.CreatedAt = now
+		user.UpdatedAt = now
+		r.users[user.ID] = &user
+		r.nextID++
+	}
+
+	return r
+}
+
+// List implements UserRepository
+func (r *MemoryUserRepository) List(ctx context.Context, includeDeleted bool) ([]User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	users := make([]User, 0, len(r.users))
+	for _, user := range r.users {
+		if includeDeleted || user.DeletedAt == nil {
+			users = append(users, *user)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+
+	return users, nil
+}
+
+// Page implements UserRepository
+func (r *MemoryUserRepository) Page(ctx context.Context, afterID, limit int) ([]User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// IDs are assigned in increasing order, so scanning the ID range avoids
+	// sorting the whole map for every page.
+	users := make([]User, 0, limit)
+	for id := afterID + 1; id < r.nextID && len(users) < limit; id++ {
+		if user, ok := r.lookup(id); ok {
+			users = append(users, *user)
+		}
+	}
+
+	return users, nil
+}
+
+// Query implements UserRepository
+func (r *MemoryUserRepository) Query(ctx context.Context, q UserQuery) ([]User, int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	users := make([]User, 0, len(r.users))
+	for _, user := range r.users {
+		if (q.IncludeDeleted || user.DeletedAt == nil) && q.Filter.matches(*user) && q.matchesSearch(*user) {
+			users = append(users, *user)
+		}
+	}
+	if q.Sort.Field == "" {
+		q.Sort.Field = "id"
+	}
+	q.Sort.Apply(users)
+
+	start := min(q.Offset, len(users))
+	end := len(users)
+	if q.Limit > 0 {
+		end = min(start+q.Limit, end)
+	}
+	return users[start:end], len(users), nil
+}
+
+// Get implements UserRepository
+func (r *MemoryUserRepository) Get(ctx context.Context, id int) (User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if err := ctx.Err(); err != nil {
+		return User{}, err
+	}
+
+	user, ok := r.lookup(id)
+	if !ok {
+		return User{}, ErrUserNotFound
+	}
+
+	return *user, nil
+}
+
+// GetMany implements UserRepository
+func (r *MemoryUserRepository) GetMany(ctx context.Context, ids []int) ([]User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[int]bool, len(ids))
+	users := make([]User, 0, len(ids))
+	for _, id := range ids {
+		if user, ok := r.lookup(id); ok && !seen[id] {
+			seen[id] = true
+			users = append(users, *user)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users, nil
+}
+
+// GetByEmail implements UserRepository
+func (r *MemoryUserRepository) GetByEmail(ctx context.Context, email string) (User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if err := ctx.Err(); err != nil {
+		return User{}, err
+	}
+
+	for _, user := range r.users {
+		if user.DeletedAt == nil && strings.EqualFold(user.Email, email) {
+			return *user, nil
+		}
+	}
+
+	return User{}, ErrUserNotFound
+}
+
+// Create implements UserRepository. It fails with ErrStoreFull once the
+// repository holds maxUsers users.
+func (r *MemoryUserRepository) Create(ctx context.Context, user User) (User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return User{}, err
+	}
+
+	if r.maxUsers > 0 && len(r.users) >= r.maxUsers {
+		return User{}, ErrStoreFull
+	}
+	if r.emailTaken(user.Email, 0) {
+		return User{}, ErrEmailTaken
+	}
+
+	user.ID = r.nextID
+	r.users[user.ID] = &user
+	r.nextID++
+	r.version++
+
+	return user, nil
+}
+
+// Update implements UserRepository
+func (r *MemoryUserRepository) Update(ctx context.Context, id int, apply func(*User) error) (User, User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return User{}, User{}, err
+	}
+
+	user, ok := r.lookup(id)
+	if !ok {
+		return User{}, User{}, ErrUserNotFound
+	}
+
+	previous := *user
+	updated := *user
+	if err := apply(&updated); err != nil {
+		return User{}, User{}, err
+	}
+	if r.emailTaken(updated.Email, id) {
+		return User{}, User{}, ErrEmailTaken
+	}
+	*user = updated
+	r.version++
+
+	return previous, updated, nil
+}
+
+// SoftDelete implements UserRepository
+func (r *MemoryUserRepository) SoftDelete(ctx context.Context, id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	user, ok := r.lookup(id)
+	if !ok {
+		return ErrUserNotFound
+	}
+	now := time.Now().UTC()
+	user.DeletedAt = &now
+	user.UpdatedAt = now
+	r.version++
+
+	return nil
+}
+
+// Delete implements UserRepository
+func (r *MemoryUserRepository) Delete(ctx context.Context, id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if _, ok := r.users[id]; !ok {
+		return ErrUserNotFound
+	}
+	delete(r.users, id)
+	r.version++
+
+	return nil
+}
+
+// Merge implements UserRepository
+func (r *MemoryUserRepository) Merge(ctx context.Context, targetID, sourceID int, apply func(target *User, source User) error) (User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return User{}, err
+	}
+
+	target, ok := r.lookup(targetID)
+	if !ok {
+		return User{}, ErrUserNotFound
+	}
+	source, ok := r.lookup(sourceID)
+	if !ok {
+		return User{}, ErrUserNotFound
+	}
+
+	merged := *target
+	if err := apply(&merged, *source); err != nil {
+		return User{}, err
+	}
+
+	now := time.Now().UTC()
+	*target = merged
+	source.DeletedAt = &now
+	source.UpdatedAt = now
+	r.version++
+
+	return merged, nil
+}
+
+// InTx implements Transactor. fn works on a snapshot of the users that
+// replaces them once it succeeds. The repository is not locked while fn
+// runs, so the commit fails with ErrTxConflict if another write landed in
+// the meantime rather than overwriting it.
+func (r *MemoryUserRepository) InTx(ctx context.Context, fn func(UserRepository) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.RLock()
+	version := r.version
+	tx := &MemoryUserRepository{users: make(map[int]*User, len(r.users)), nextID: r.nextID, maxUsers: r.maxUsers}
+	for id, user := range r.users {
+		copied := *user
+		tx.users[id] = &copied
+	}
+	r.mu.RUnlock()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.version != version {
+		return ErrTxConflict
+	}
+	r.users, r.nextID = tx.users, tx.nextID
+	r.version++
+
+	return nil
+}
+
+// lookup returns the live user with the given ID. Callers must hold r.mu.
+func (r *MemoryUserRepository) lookup(id int) (*User, bool) {
+	user, ok := r.users[id]
+	if !ok || user.DeletedAt != nil {
+		return nil, false
+	}
+	return user, true
+}
+
+// emailTaken reports whether a live user other than exceptID owns email.
+// Callers must hold r.mu.
+func (r *MemoryUserRepository) emailTaken(email string, exceptID int) bool {
+	for id, user := range r.users {
+		if id != exceptID && user.DeletedAt == nil && strings.EqualFold(user.Email, email) {
+			return true
+		}
+	}
+	return false
+}
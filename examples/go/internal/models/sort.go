@@ -0,0 +1,64 @@
+package models
+
+import (
+	"cmp"
+	"errors"
+	"slices"
+	"strings"
+)
+
+// ErrInvalidSort is returned when a sort names an unknown field
+var ErrInvalidSort = errors.New("invalid sort")
+
+// userSortFields compares users by each sortable field
+var userSortFields = map[string]func(a, b User) int{
+	"id":         func(a, b User) int { return cmp.Compare(a.ID, b.ID) },
+	"name":       func(a, b User) int { return strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name)) },
+	"email":      func(a, b User) int { return strings.Compare(strings.ToLower(a.Email), strings.ToLower(b.Email)) },
+	"created_at": func(a, b User) int { return a.CreatedAt.Compare(b.CreatedAt) },
+}
+
+// SortableUserFields returns the fields accepted by ParseUserSort
+func SortableUserFields() []string {
+	fields := make([]string, 0, len(userSortFields))
+	for field := range userSortFields {
+		fields = append(fields, field)
+	}
+	slices.Sort(fields)
+	return fields
+}
+
+// UserSort orders a user listing by one field
+type UserSort struct {
+	Field string
+	Desc  bool
+}
+
+// ParseUserSort parses "field" or "-field" (descending)
+func ParseUserSort(spec string) (UserSort, error) {
+	sort := UserSort{Field: spec}
+	if field, ok := strings.CutPrefix(spec, "-"); ok {
+		sort = UserSort{Field: field, Desc: true}
+	}
+	if _, ok := userSortFields[sort.Field]; !ok {
+		return UserSort{}, ErrInvalidSort
+	}
+	return sort, nil
+}
+
+// Apply sorts users in place. Users with equal values are ordered by ID in
+// the same direction, so the order is total and identical on every request,
+// which keeps pages of a sorted listing from overlapping or skipping users.
+func (s UserSort) Apply(users []User) {
+	compare := userSortFields[s.Field]
+	slices.SortFunc(users, func(a, b User) int {
+		c := compare(a, b)
+		if c == 0 {
+			c = cmp.Compare(a.ID, b.ID)
+		}
+		if s.Desc {
+			return -c
+		}
+		return c
+	})
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"context"
+	"testing"
+)
+
+func TestUserSortBreaksTiesByID(t *testing.T) {
+	svc := NewUserService()
+	for _, email := range []string{"sam1@example.com", "sam2@example.com", "sam3@example.com"} {
+		if _, err := svc.Create(context.Background(), CreateUserRequest{Name: "Sam", Email: email}); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+
+	for _, tc := range []struct {
+		spec string
+		want []int
+	}{
+		{"name", []int{1, 2, 3, 4, 5}},
+		{"-name", []int{5, 4, 3, 2, 1}},
+	} {
+		sort, err := ParseUserSort(tc.spec)
+		if err != nil {
+			t.Fatalf("ParseUserSort(%q): %v", tc.spec, err)
+		}
+		// Repeat to catch any order that depends on the input permutation
+		for run := 0; run < 5; run++ {
+			users, _ := svc.List(context.Background())
+			if run%2 == 1 {
+				users[0], users[len(users)-1] = users[len(users)-1], users[0]
+			}
+			sort.Apply(users)
+			for i, id := range tc.want {
+				if users[i].ID != id {
+					t.Fatalf("%s run %d: order = %v, want IDs %v", tc.spec, run, ids(users), tc.want)
+				}
+			}
+		}
+	}
+}
+
+func TestParseUserSortRejectsUnknownField(t *testing.T) {
+	if _, err := ParseUserSort("password"); err != ErrInvalidSort {
+		t.Errorf("err = %v, want ErrInvalidSort", err)
+	}
+}
+
+func ids(users []User) []int {
+	out := make([]int, len(users))
+	for i, u := range users {
+		out[i] = u.ID
+	}
+	return out
+}
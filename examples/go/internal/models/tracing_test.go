@@ -0,0 +1,42 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestUserServiceSpansJoinTheCallersTrace(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(previous)
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "request")
+	_, err := NewUserService().Get(ctx, 999)
+	parent.End()
+	if !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("Get: err = %v, want ErrUserNotFound", err)
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(spans))
+	}
+	get := spans[0]
+	if get.Name() != "UserService.Get" {
+		t.Fatalf("first span = %q, want UserService.Get", get.Name())
+	}
+	if get.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Error("UserService.Get is not a child of the caller's span")
+	}
+	if get.Status().Code != codes.Error {
+		t.Errorf("status = %v, want Error for a missing user", get.Status().Code)
+	}
+}
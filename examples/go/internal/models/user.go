@@ -0,0 +1,558 @@
+// Package models contains the domain types and services backing the API
+package models
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cbwinslow/template2/examples/go/pkg/events"
+)
+
+// Roles that can be assigned to a user
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+var (
+	// ErrUserNotFound is returned when no user matches the requested ID
+	ErrUserNotFound = errors.New("user not found")
+	// ErrEmailTaken is returned when another user already owns the email
+	ErrEmailTaken = errors.New("email already in use")
+	// ErrInvalidRole is returned when a role is not one of the known roles
+	ErrInvalidRole = errors.New("invalid role")
+	// ErrSelfMerge is returned when a user is merged into itself
+	ErrSelfMerge = errors.New("cannot merge a user into itself")
+	// ErrStoreFull is returned when the store has reached its capacity
+	ErrStoreFull = errors.New("user store is full")
+	// ErrEmailChanged is returned when an email verification is for an
+	// address the user no longer has
+	ErrEmailChanged = errors.New("email changed since verification was requested")
+	// ErrPreconditionFailed is returned when a conditional update finds the
+	// user changed since the client read it
+	ErrPreconditionFailed = errors.New("user changed since it was read")
+	// ErrNoTransactions is returned by InTx when the repository does not
+	// implement Transactor
+	ErrNoTransactions = errors.New("user repository does not support transactions")
+	// ErrTxConflict is returned when a transaction cannot commit because of
+	// a concurrent write; retrying it may succeed
+	ErrTxConflict = errors.New("transaction conflicts with a concurrent write")
+	// ErrIncompleteMerge is returned, together with the failures of its
+	// hooks, by a Merge that took effect without a transaction to undo it
+	ErrIncompleteMerge = errors.New("users merged but not all data was reassigned")
+)
+
+// User represents an account in the system. EmailVerified stays false from
+// registration until the user opens the verification link mailed to them.
+// LockedAt is set while an admin has locked the account, which refuses its
+// logins.
+type User struct {
+	ID            int        `json:"id"`
+	Name          string     `json:"name"`
+	Email         string     `json:"email"`
+	Age           int        `json:"age,omitempty"`
+	Role          string     `json:"role"`
+	Active        bool       `json:"active"`
+	EmailVerified bool       `json:"email_verified"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	DeletedAt     *time.Time `json:"deleted_at,omitempty"`
+	LockedAt      *time.Time `json:"locked_at,omitempty"`
+}
+
+// ETag returns the strong entity tag of the stored user, a hash of its ID and
+// UpdatedAt. Every change moves UpdatedAt, which makes it the record version.
+func (u User) ETag() string {
+	sum := sha256.Sum256([]byte(strconv.Itoa(u.ID) + ":" + strconv.FormatInt(u.UpdatedAt.UnixNano(), 10)))
+	return `"` + hex.EncodeToString(sum[:12]) + `"`
+}
+
+// UserSummary is the lightweight representation of a user used in lists
+type UserSummary struct {
+	ID        int        `json:"id"`
+	Name      string     `json:"name"`
+	Email     string     `json:"email"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// Summary returns the list representation of u
+func (u User) Summary() UserSummary {
+	return UserSummary{ID: u.ID, Name: u.Name, Email: u.Email, DeletedAt: u.DeletedAt}
+}
+
+// CreateUserRequest is the payload accepted when creating a user. Role and
+// Active are optional; omitted values fall back to the service defaults.
+// EmailVerified defaults to true, since users created by an admin or linked
+// from an identity provider need no verification.
+type CreateUserRequest struct {
+	Name          string `json:"name" binding:"required,max=100,username"`
+	Email         string `json:"email" binding:"required,email"`
+	Age           int    `json:"age" binding:"omitempty,gt=0,lte=150"`
+	Role          string `json:"role" binding:"omitempty"`
+	Active        *bool  `json:"active"`
+	EmailVerified *bool  `json:"email_verified"`
+}
+
+// UpdateUserRequest is the payload accepted when updating a user. Only the
+// fields that are set are applied.
+type UpdateUserRequest struct {
+	Name   *string `json:"name" binding:"omitempty,max=100,username"`
+	Email  *string `json:"email" binding:"omitempty,email"`
+	Age    *int    `json:"age" binding:"omitempty,gt=0,lte=150"`
+	Role   *string `json:"role"`
+	Active *bool   `json:"active"`
+}
+
+// UserDefaults are applied by Create when the client omits a field
+type UserDefaults struct {
+	Role   string
+	Active bool
+}
+
+// ValidRole reports whether role is one of the known roles
+func ValidRole(role string) bool {
+	return role == RoleUser || role == RoleAdmin
+}
+
+// UserServiceOption configures a UserService
+type UserServiceOption func(*UserService)
+
+// WithDefaults sets the values applied to omitted fields on Create
+func WithDefaults(defaults UserDefaults) UserServiceOption {
+	return func(s *UserService) {
+		s.defaults = defaults
+	}
+}
+
+// WithMaxUsers caps the number of users in the default in-memory
+// repository; zero means unlimited. It has no effect with WithRepository.
+// Soft-deleted users still occupy memory and count toward the cap.
+func WithMaxUsers(max int) UserServiceOption {
+	return func(s *UserService) {
+		s.maxUsers = max
+	}
+}
+
+// WithRepository sets where users are stored instead of the seeded
+// in-memory repository
+func WithRepository(repo UserRepository) UserServiceOption {
+	return func(s *UserService) {
+		s.repo = repo
+	}
+}
+
+// WithStatementTimeout bounds how long a single store operation may take,
+// including time spent waiting for the store lock; zero means no bound beyond
+// the caller's context. Operations that overrun fail with
+// context.DeadlineExceeded.
+func WithStatementTimeout(timeout time.Duration) UserServiceOption {
+	return func(s *UserService) {
+		s.statementTimeout = timeout
+	}
+}
+
+// UserService manages users on top of a UserRepository
+type UserService struct {
+	repo             UserRepository
+	maxUsers         int
+	statementTimeout time.Duration
+	defaults         UserDefaults
+	invariants       []Invariant
+	mergeHooks       []MergeHook
+	// events receives an event after every change when set
+	events events.Publisher
+}
+
+// NewUserService creates a user service. Without WithRepository users are
+// kept in memory, seeded with sample users.
+func NewUserService(opts ...UserServiceOption) *UserService {
+	s := &UserService{
+		defaults: UserDefaults{Role: RoleUser, Active: true},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.repo == nil {
+		s.repo = NewMemoryUserRepository(s.maxUsers)
+	}
+
+	return s
+}
+
+// ListOption configures List
+type ListOption func(*listOptions)
+
+type listOptions struct {
+	includeDeleted bool
+}
+
+// IncludeDeleted makes List return soft-deleted users alongside the live ones
+func IncludeDeleted() ListOption {
+	return func(o *listOptions) {
+		o.includeDeleted = true
+	}
+}
+
+// List returns all live users ordered by ID
+func (s *UserService) List(ctx context.Context, opts ...ListOption) (_ []User, err error) {
+	ctx, span := tracer.Start(ctx, "UserService.List")
+	defer func() { endSpan(span, err) }()
+
+	var o listOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	ctx, cancel := s.statementContext(ctx)
+	defer cancel()
+	return s.repo.List(ctx, o.includeDeleted)
+}
+
+// UserQuery selects a sorted slice of the users matching a filter, for
+// listings that must not load the whole store
+type UserQuery struct {
+	Filter UserFilter
+	Sort   UserSort
+	// Offset skips that many matching users; Limit caps how many are
+	// returned, zero meaning all
+	Offset int
+	Limit  int
+	// IncludeDeleted also matches soft-deleted users
+	IncludeDeleted bool
+	// Search, when set, keeps only users whose name or email contains it,
+	// compared case-insensitively
+	Search string
+}
+
+// Query returns the users q selects and how many match q.Filter in all. An
+// empty Sort orders by ID.
+func (s *UserService) Query(ctx context.Context, q UserQuery) (_ []User, _ int, err error) {
+	ctx, span := tracer.Start(ctx, "UserService.Query")
+	defer func() { endSpan(span, err) }()
+
+	if q.Sort.Field == "" {
+		q.Sort.Field = "id"
+	}
+	if _, ok := userSortFields[q.Sort.Field]; !ok {
+		return nil, 0, ErrInvalidSort
+	}
+
+	ctx, cancel := s.statementContext(ctx)
+	defer cancel()
+	return s.repo.Query(ctx, q)
+}
+
+// Page returns up to limit live users with IDs greater than afterID, ordered
+// by ID. Callers walk the whole store by passing the last ID of each page as
+// the next afterID until an empty page is returned.
+func (s *UserService) Page(ctx context.Context, afterID, limit int) (_ []User, err error) {
+	ctx, span := tracer.Start(ctx, "UserService.Page")
+	defer func() { endSpan(span, err) }()
+
+	ctx, cancel := s.statementContext(ctx)
+	defer cancel()
+	return s.repo.Page(ctx, afterID, limit)
+}
+
+// Get returns the user with the given ID
+func (s *UserService) Get(ctx context.Context, id int) (_ User, err error) {
+	ctx, span := tracer.Start(ctx, "UserService.Get")
+	defer func() { endSpan(span, err) }()
+
+	ctx, cancel := s.statementContext(ctx)
+	defer cancel()
+	return s.repo.Get(ctx, id)
+}
+
+// GetMany returns the users among ids in one lookup, ordered by ID. IDs of
+// no user are skipped, so callers batching lookups, such as the GraphQL
+// endpoint, can tell which were found.
+func (s *UserService) GetMany(ctx context.Context, ids []int) (_ []User, err error) {
+	ctx, span := tracer.Start(ctx, "UserService.GetMany")
+	defer func() { endSpan(span, err) }()
+
+	ctx, cancel := s.statementContext(ctx)
+	defer cancel()
+	return s.repo.GetMany(ctx, ids)
+}
+
+// GetByEmail returns the user owning email, compared case-insensitively
+func (s *UserService) GetByEmail(ctx context.Context, email string) (_ User, err error) {
+	ctx, span := tracer.Start(ctx, "UserService.GetByEmail")
+	defer func() { endSpan(span, err) }()
+
+	ctx, cancel := s.statementContext(ctx)
+	defer cancel()
+	return s.repo.GetByEmail(ctx, email)
+}
+
+// Create adds a new user, applying the configured defaults to omitted fields
+func (s *UserService) Create(ctx context.Context, req CreateUserRequest) (_ User, err error) {
+	ctx, span := tracer.Start(ctx, "UserService.Create")
+	defer func() { endSpan(span, err) }()
+
+	role := req.Role
+	if role == "" {
+		role = s.defaults.Role
+	}
+	if !ValidRole(role) {
+		return User{}, ErrInvalidRole
+	}
+
+	active := s.defaults.Active
+	if req.Active != nil {
+		active = *req.Active
+	}
+	verified := req.EmailVerified == nil || *req.EmailVerified
+
+	ctx, cancel := s.statementContext(ctx)
+	defer cancel()
+
+	now := timestamp()
+	user, err := s.repo.Create(ctx, User{
+		Name:          req.Name,
+		Email:         req.Email,
+		Age:           req.Age,
+		Role:          role,
+		Active:        active,
+		EmailVerified: verified,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	})
+	if err != nil {
+		return User{}, err
+	}
+	s.publish(ctx, events.UserCreated{UserID: user.ID, Name: user.Name, Email: user.Email, Role: user.Role})
+	return user, nil
+}
+
+// UpdateOption configures Update
+type UpdateOption func(*updateOptions)
+
+type updateOptions struct {
+	ifMatch []string
+}
+
+// IfMatch makes Update fail with ErrPreconditionFailed unless the user's
+// current ETag is one of etags. "*" matches any existing user.
+func IfMatch(etags ...string) UpdateOption {
+	return func(o *updateOptions) {
+		o.ifMatch = etags
+	}
+}
+
+// Update applies the set fields of req to the user with the given ID. The
+// merged user must satisfy the configured invariants; otherwise an
+// *InvariantError is returned and nothing is changed.
+func (s *UserService) Update(ctx context.Context, id int, req UpdateUserRequest, opts ...UpdateOption) (User, error) {
+	_, updated, err := s.UpdateWithPrevious(ctx, id, req, opts...)
+	return updated, err
+}
+
+// UpdateWithPrevious behaves like Update and also returns the user as it was
+// immediately before the change was applied
+func (s *UserService) UpdateWithPrevious(ctx context.Context, id int, req UpdateUserRequest, opts ...UpdateOption) (_, _ User, err error) {
+	ctx, span := tracer.Start(ctx, "UserService.Update")
+	defer func() { endSpan(span, err) }()
+
+	if req.Role != nil && !ValidRole(*req.Role) {
+		return User{}, User{}, ErrInvalidRole
+	}
+
+	var o updateOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	ctx, cancel := s.statementContext(ctx)
+	defer cancel()
+
+	previous, updated, err := s.repo.Update(ctx, id, func(user *User) error {
+		// Checked inside the repository's atomic step, so no other update
+		// can land between the comparison and the write
+		if o.ifMatch != nil && !matchesETag(*user, o.ifMatch) {
+			return ErrPreconditionFailed
+		}
+
+		merged := *user
+		if req.Name != nil {
+			merged.Name = *req.Name
+		}
+		if req.Email != nil {
+			merged.Email = *req.Email
+		}
+		if req.Age != nil {
+			merged.Age = *req.Age
+		}
+		if req.Role != nil {
+			merged.Role = *req.Role
+		}
+		if req.Active != nil {
+			merged.Active = *req.Active
+		}
+		if err := s.checkInvariants(merged); err != nil {
+			return err
+		}
+
+		merged.UpdatedAt = timestamp()
+		*user = merged
+		return nil
+	})
+	if err != nil {
+		return User{}, User{}, err
+	}
+	s.publish(ctx, userUpdated(updated))
+	return previous, updated, nil
+}
+
+// SetLocked locks or unlocks the user's account. Locking an already locked
+// account keeps its original LockedAt and leaves the user unchanged.
+func (s *UserService) SetLocked(ctx context.Context, id int, locked bool) (_ User, err error) {
+	ctx, span := tracer.Start(ctx, "UserService.SetLocked")
+	defer func() { endSpan(span, err) }()
+
+	ctx, cancel := s.statementContext(ctx)
+	defer cancel()
+
+	previous, updated, err := s.repo.Update(ctx, id, func(user *User) error {
+		if locked == (user.LockedAt != nil) {
+			return nil
+		}
+		now := timestamp()
+		user.LockedAt = nil
+		if locked {
+			user.LockedAt = &now
+		}
+		user.UpdatedAt = now
+		return nil
+	})
+	s.publishIfChanged(ctx, previous, updated, err)
+	return updated, err
+}
+
+// VerifyEmail marks the user's email as verified, provided it is still
+// email. A verification for an address the user has since changed fails
+// with ErrEmailChanged.
+func (s *UserService) VerifyEmail(ctx context.Context, id int, email string) (_ User, err error) {
+	ctx, span := tracer.Start(ctx, "UserService.VerifyEmail")
+	defer func() { endSpan(span, err) }()
+
+	ctx, cancel := s.statementContext(ctx)
+	defer cancel()
+
+	previous, updated, err := s.repo.Update(ctx, id, func(user *User) error {
+		if !strings.EqualFold(user.Email, email) {
+			return ErrEmailChanged
+		}
+		if !user.EmailVerified {
+			user.EmailVerified = true
+			user.UpdatedAt = timestamp()
+		}
+		return nil
+	})
+	s.publishIfChanged(ctx, previous, updated, err)
+	return updated, err
+}
+
+// Delete soft-deletes the user with the given ID. The user disappears from
+// every lookup and its email can be reused, but the record is kept and
+// still listed with IncludeDeleted.
+func (s *UserService) Delete(ctx context.Context, id int) (err error) {
+	ctx, span := tracer.Start(ctx, "UserService.Delete")
+	defer func() { endSpan(span, err) }()
+
+	ctx, cancel := s.statementContext(ctx)
+	defer cancel()
+	if err := s.repo.SoftDelete(ctx, id); err != nil {
+		return err
+	}
+	s.publish(ctx, events.UserDeleted{UserID: id})
+	return nil
+}
+
+// HardDelete permanently removes the user with the given ID, whether it is
+// live or was soft-deleted
+func (s *UserService) HardDelete(ctx context.Context, id int) (err error) {
+	ctx, span := tracer.Start(ctx, "UserService.HardDelete")
+	defer func() { endSpan(span, err) }()
+
+	ctx, cancel := s.statementContext(ctx)
+	defer cancel()
+	if err := s.repo.Delete(ctx, id); err != nil {
+		return err
+	}
+	s.publish(ctx, events.UserDeleted{UserID: id, Hard: true})
+	return nil
+}
+
+// Transactional reports whether the repository supports InTx
+func (s *UserService) Transactional() bool {
+	_, ok := s.repo.(Transactor)
+	return ok
+}
+
+// InTx calls fn with a service whose operations all run in one repository
+// transaction: they take effect together if fn returns nil and not at all
+// otherwise. It fails with ErrNoTransactions unless Transactional.
+func (s *UserService) InTx(ctx context.Context, fn func(tx *UserService) error) (err error) {
+	ctx, span := tracer.Start(ctx, "UserService.InTx")
+	defer func() { endSpan(span, err) }()
+
+	transactor, ok := s.repo.(Transactor)
+	if !ok {
+		return ErrNoTransactions
+	}
+	pending := &txEvents{}
+	err = transactor.InTx(ctx, func(repo UserRepository) error {
+		tx := *s
+		tx.repo = repo
+		tx.events = pending
+		return fn(&tx)
+	})
+	if err != nil {
+		return err
+	}
+	if s.events != nil {
+		pending.flush(ctx, s.events)
+	}
+	return nil
+}
+
+// publishIfChanged publishes UserUpdated for an update that changed the
+// user
+func (s *UserService) publishIfChanged(ctx context.Context, previous, updated User, err error) {
+	if err == nil && !updated.UpdatedAt.Equal(previous.UpdatedAt) {
+		s.publish(ctx, userUpdated(updated))
+	}
+}
+
+// matchesETag reports whether one of etags is "*" or the user's ETag
+func matchesETag(user User, etags []string) bool {
+	current := user.ETag()
+	for _, etag := range etags {
+		if etag == "*" || etag == current {
+			return true
+		}
+	}
+	return false
+}
+
+// timestamp returns the current time for CreatedAt and UpdatedAt, cut to the
+// microsecond precision of the Postgres repository so a stored user keeps
+// the ETag it was returned with
+func timestamp() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+// statementContext derives the context a single store operation runs under
+func (s *UserService) statementContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.statementTimeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, s.statementTimeout)
+}
@@ -0,0 +1,232 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCreateAppliesConfiguredDefaults(t *testing.T) {
+	svc := NewUserService(WithDefaults(UserDefaults{Role: RoleAdmin, Active: false}))
+
+	user, err := svc.Create(context.Background(), CreateUserRequest{
+		Name:  "Carol",
+		Email: "carol@example.com",
+	})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	if user.Role != RoleAdmin {
+		t.Errorf("role = %q, want configured default %q", user.Role, RoleAdmin)
+	}
+	if user.Active {
+		t.Error("active = true, want configured default false")
+	}
+}
+
+func TestCreateKeepsExplicitValues(t *testing.T) {
+	svc := NewUserService(WithDefaults(UserDefaults{Role: RoleAdmin, Active: false}))
+	active := true
+
+	user, err := svc.Create(context.Background(), CreateUserRequest{
+		Name:   "Dave",
+		Email:  "dave@example.com",
+		Role:   RoleUser,
+		Active: &active,
+	})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	if user.Role != RoleUser || !user.Active {
+		t.Errorf("got role=%q active=%v, want explicit role=%q active=true", user.Role, user.Active, RoleUser)
+	}
+}
+
+func TestStatementTimeoutBoundsLockWait(t *testing.T) {
+	repo := NewMemoryUserRepository(0)
+	svc := NewUserService(WithRepository(repo), WithStatementTimeout(5*time.Millisecond))
+
+	// Hold the write lock to simulate a slow query ahead of this one.
+	repo.mu.Lock()
+	done := make(chan error, 1)
+	go func() {
+		_, err := svc.Get(context.Background(), 1)
+		done <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	repo.mu.Unlock()
+
+	if err := <-done; !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Get error = %v, want context.DeadlineExceeded", err)
+	}
+	if _, err := svc.Get(context.Background(), 1); err != nil {
+		t.Errorf("uncontended Get: %v", err)
+	}
+}
+
+func TestDeleteKeepsRecordAndFreesEmail(t *testing.T) {
+	ctx := context.Background()
+	svc := NewUserService()
+
+	if err := svc.Delete(ctx, 2); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := svc.Get(ctx, 2); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Get after delete: err = %v, want ErrUserNotFound", err)
+	}
+	if _, err := svc.Create(ctx, CreateUserRequest{Name: "Bob", Email: "bob@example.com"}); err != nil {
+		t.Errorf("reusing a deleted user's email: %v", err)
+	}
+
+	all, _ := svc.List(ctx, IncludeDeleted())
+	if len(all) != 3 || all[1].DeletedAt == nil || !all[1].UpdatedAt.Equal(*all[1].DeletedAt) {
+		t.Fatalf("List(IncludeDeleted) = %+v, want the deleted user stamped", all)
+	}
+	if err := svc.HardDelete(ctx, 2); err != nil {
+		t.Fatalf("HardDelete of a soft-deleted user: %v", err)
+	}
+	if all, _ := svc.List(ctx, IncludeDeleted()); len(all) != 2 {
+		t.Errorf("%d users after hard delete, want 2", len(all))
+	}
+}
+
+func TestVerifyEmailRequiresCurrentAddress(t *testing.T) {
+	ctx := context.Background()
+	svc := NewUserService()
+	unverified := false
+	user, _ := svc.Create(ctx, CreateUserRequest{Name: "Ivy", Email: "ivy@example.com", EmailVerified: &unverified})
+
+	newEmail := "ivy@work.example.com"
+	if _, err := svc.Update(ctx, user.ID, UpdateUserRequest{Email: &newEmail}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if _, err := svc.VerifyEmail(ctx, user.ID, "ivy@example.com"); !errors.Is(err, ErrEmailChanged) {
+		t.Errorf("verifying the old address: err = %v, want ErrEmailChanged", err)
+	}
+	verified, err := svc.VerifyEmail(ctx, user.ID, "IVY@work.example.com")
+	if err != nil || !verified.EmailVerified {
+		t.Errorf("VerifyEmail = %+v, %v", verified, err)
+	}
+}
+
+func TestUpdateIfMatchRejectsStaleETag(t *testing.T) {
+	svc := NewUserService()
+	ctx := context.Background()
+	user, _ := svc.Get(ctx, 1)
+	name := "Alicia"
+
+	updated, err := svc.Update(ctx, 1, UpdateUserRequest{Name: &name}, IfMatch(user.ETag()))
+	if err != nil {
+		t.Fatalf("Update with the current ETag: %v", err)
+	}
+	if updated.ETag() == user.ETag() {
+		t.Errorf("ETag unchanged after update: %s", updated.ETag())
+	}
+	if _, err := svc.Update(ctx, 1, UpdateUserRequest{Name: &name}, IfMatch(user.ETag())); !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("Update with a stale ETag: err = %v, want ErrPreconditionFailed", err)
+	}
+	if _, err := svc.Update(ctx, 1, UpdateUserRequest{Name: &name}, IfMatch("*")); err != nil {
+		t.Errorf("Update with If-Match *: %v", err)
+	}
+}
+
+func TestInTxRollsBackOnError(t *testing.T) {
+	svc := NewUserService()
+	ctx := context.Background()
+	abort := errors.New("abort")
+
+	err := svc.InTx(ctx, func(tx *UserService) error {
+		if _, err := tx.Create(ctx, CreateUserRequest{Name: "Carol", Email: "carol@example.com"}); err != nil {
+			return err
+		}
+		if err := tx.Delete(ctx, 2); err != nil {
+			return err
+		}
+		if _, err := svc.GetByEmail(ctx, "carol@example.com"); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("uncommitted create visible outside the transaction: err = %v", err)
+		}
+		return abort
+	})
+	if !errors.Is(err, abort) {
+		t.Fatalf("InTx = %v, want the error fn returned", err)
+	}
+	if _, err := svc.GetByEmail(ctx, "carol@example.com"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("rolled back create: err = %v, want ErrUserNotFound", err)
+	}
+	if _, err := svc.Get(ctx, 2); err != nil {
+		t.Errorf("rolled back delete: %v", err)
+	}
+
+	if err := svc.InTx(ctx, func(tx *UserService) error {
+		_, err := tx.Create(ctx, CreateUserRequest{Name: "Carol", Email: "carol@example.com"})
+		return err
+	}); err != nil {
+		t.Fatalf("InTx: %v", err)
+	}
+	if _, err := svc.GetByEmail(ctx, "carol@example.com"); err != nil {
+		t.Errorf("committed create: %v", err)
+	}
+}
+
+func TestInTxFailsOnConcurrentWrite(t *testing.T) {
+	svc := NewUserService()
+	ctx := context.Background()
+	name := "Alicia"
+
+	err := svc.InTx(ctx, func(tx *UserService) error {
+		if err := tx.Delete(ctx, 2); err != nil {
+			return err
+		}
+		_, err := svc.Update(ctx, 1, UpdateUserRequest{Name: &name})
+		return err
+	})
+	if !errors.Is(err, ErrTxConflict) {
+		t.Fatalf("InTx = %v, want ErrTxConflict", err)
+	}
+	if user, _ := svc.Get(ctx, 1); user.Name != name {
+		t.Errorf("concurrent update lost: name = %q", user.Name)
+	}
+	if _, err := svc.Get(ctx, 2); err != nil {
+		t.Errorf("conflicting delete committed: %v", err)
+	}
+}
+
+func TestSetLockedKeepsFirstLockTime(t *testing.T) {
+	svc := NewUserService()
+	ctx := context.Background()
+
+	locked, err := svc.SetLocked(ctx, 1, true)
+	if err != nil || locked.LockedAt == nil {
+		t.Fatalf("SetLocked(true) = %+v, %v", locked, err)
+	}
+	again, err := svc.SetLocked(ctx, 1, true)
+	if err != nil || !again.LockedAt.Equal(*locked.LockedAt) || !again.UpdatedAt.Equal(locked.UpdatedAt) {
+		t.Errorf("relock changed the user: %+v, want %+v", again, locked)
+	}
+	unlocked, err := svc.SetLocked(ctx, 1, false)
+	if err != nil || unlocked.LockedAt != nil {
+		t.Errorf("SetLocked(false) = %+v, %v", unlocked, err)
+	}
+	if _, err := svc.SetLocked(ctx, 99, true); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("unknown user: err = %v, want ErrUserNotFound", err)
+	}
+}
+
+func TestGetManySkipsMissingAndDeletedUsers(t *testing.T) {
+	svc := NewUserService()
+	ctx := context.Background()
+	if err := svc.Delete(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	users, err := svc.GetMany(ctx, []int{2, 1, 99, 1})
+	if err != nil {
+		t.Fatalf("GetMany: %v", err)
+	}
+	if len(users) != 1 || users[0].ID != 1 {
+		t.Errorf("GetMany = %+v, want only user 1", users)
+	}
+}
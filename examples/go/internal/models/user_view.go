@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// FieldPolicy controls how empty optional fields are rendered in responses
+type FieldPolicy string
+
+// Supported field policies
+const (
+	// FieldsOmitEmpty drops empty optional fields from the response
+	FieldsOmitEmpty FieldPolicy = "omitempty"
+	// FieldsAlways includes every field, rendering empty optional fields
+	// as their zero value or null
+	FieldsAlways FieldPolicy = "always"
+)
+
+// ValidFieldPolicy reports whether p is a supported policy
+func ValidFieldPolicy(p FieldPolicy) bool {
+	return p == FieldsOmitEmpty || p == FieldsAlways
+}
+
+// userAlways mirrors User without omitempty. The fields must stay identical
+// to User so the two types remain convertible.
+type userAlways struct {
+	ID            int        `json:"id"`
+	Name          string     `json:"name"`
+	Email         string     `json:"email"`
+	Age           int        `json:"age"`
+	Role          string     `json:"role"`
+	Active        bool       `json:"active"`
+	EmailVerified bool       `json:"email_verified"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	DeletedAt     *time.Time `json:"deleted_at"`
+	LockedAt      *time.Time `json:"locked_at"`
+}
+
+// Render returns the value to encode for u under policy
+func (u User) Render(policy FieldPolicy) interface{} {
+	if policy == FieldsAlways {
+		return userAlways(u)
+	}
+	return u
+}
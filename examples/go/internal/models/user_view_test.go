@@ -0,0 +1,38 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestRenderHonorsFieldPolicy(t *testing.T) {
+	user := User{ID: 1, Name: "Ann", Email: "ann@example.com", Role: RoleUser}
+
+	cases := []struct {
+		policy  FieldPolicy
+		present bool
+	}{
+		{FieldsOmitEmpty, false},
+		{FieldsAlways, true},
+	}
+
+	for _, tc := range cases {
+		data, err := json.Marshal(user.Render(tc.policy))
+		if err != nil {
+			t.Fatalf("%s: marshal: %v", tc.policy, err)
+		}
+		var fields map[string]interface{}
+		if err := json.Unmarshal(data, &fields); err != nil {
+			t.Fatalf("%s: unmarshal: %v", tc.policy, err)
+		}
+
+		for _, key := range []string{"age", "deleted_at"} {
+			if _, ok := fields[key]; ok != tc.present {
+				t.Errorf("%s: %s present = %v, want %v", tc.policy, key, ok, tc.present)
+			}
+		}
+		if _, ok := fields["name"]; !ok {
+			t.Errorf("%s: required field name missing", tc.policy)
+		}
+	}
+}
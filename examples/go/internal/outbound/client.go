@@ -0,0 +1,145 @@
+// Package outbound wraps the HTTP calls the API makes to external systems
+package outbound
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// RequestFunc builds a fresh request for each attempt so bodies can be resent
+type RequestFunc func(ctx context.Context) (*http.Request, error)
+
+// attemptsKey is the context key of the caller's own attempt at a call
+type attemptsKey struct{}
+
+// callerAttempt is an attempt of a caller retrying calls itself, such as a
+// job the queue runs again
+type callerAttempt struct {
+	attempt, maxAttempts int
+}
+
+// WithAttempt tells Do that its caller retries the call too and this is
+// its attempt of maxAttempts, counted from 1. Do numbers the attempts it
+// logs across both, and only logs giving up as an error on the caller's
+// last attempt; before that each failed attempt is a warning.
+func WithAttempt(ctx context.Context, attempt, maxAttempts int) context.Context {
+	return context.WithValue(ctx, attemptsKey{}, callerAttempt{attempt: attempt, maxAttempts: maxAttempts})
+}
+
+// Client performs outbound HTTP calls with bounded retries, logging the
+// target, status, attempt number and latency of every attempt
+type Client struct {
+	HTTP        *http.Client
+	Logger      *zap.Logger
+	MaxAttempts int
+	// Backoff returns the delay before the given retry attempt (2, 3, ...)
+	Backoff func(attempt int) time.Duration
+}
+
+// NewClient creates a client that retries up to maxAttempts times with
+// linearly increasing delays of backoff
+func NewClient(logger *zap.Logger, maxAttempts int, backoff time.Duration) *Client {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	return &Client{
+		HTTP:        &http.Client{Timeout: 10 * time.Second},
+		Logger:      logger,
+		MaxAttempts: maxAttempts,
+		Backoff: func(attempt int) time.Duration {
+			return time.Duration(attempt-1) * backoff
+		},
+	}
+}
+
+// Do sends the request built by newRequest, retrying transport errors,
+// 429 and 5xx responses. The response of a successful attempt is returned
+// and must be closed by the caller.
+func (c *Client) Do(ctx context.Context, target string, newRequest RequestFunc) (*http.Response, error) {
+	var lastErr error
+	// Attempts made before this call, and the most there will be in all
+	earlier, total := 0, c.MaxAttempts
+	if caller, ok := ctx.Value(attemptsKey{}).(callerAttempt); ok {
+		earlier, total = (caller.attempt-1)*c.MaxAttempts, caller.maxAttempts*c.MaxAttempts
+	}
+
+	for attempt := 1; attempt <= c.MaxAttempts; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-ctx.Done():
+				lastErr = ctx.Err()
+				c.Logger.Warn("Outbound call gave up",
+					zap.String("target", target),
+					zap.Int("attempts", earlier+attempt-1),
+					zap.Error(lastErr),
+				)
+				return nil, lastErr
+			case <-time.After(c.Backoff(attempt)):
+			}
+		}
+
+		req, err := newRequest(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("outbound: build request for %s: %w", target, err)
+		}
+
+		start := time.Now()
+		resp, err := c.HTTP.Do(req)
+		latency := time.Since(start)
+
+		fields := []zap.Field{
+			zap.String("target", target),
+			zap.Int("attempt", earlier+attempt),
+			zap.Duration("latency", latency),
+		}
+		if err != nil {
+			c.Logger.Warn("Outbound call failed", append(fields, zap.Error(err))...)
+			lastErr = err
+			continue
+		}
+
+		fields = append(fields, zap.Int("status", resp.StatusCode))
+		if retryable(resp.StatusCode) {
+			c.Logger.Warn("Outbound call failed", fields...)
+			resp.Body.Close()
+			lastErr = &StatusError{StatusCode: resp.StatusCode}
+			continue
+		}
+
+		c.Logger.Info("Outbound call completed", fields...)
+		return resp, nil
+	}
+
+	if earlier+c.MaxAttempts >= total {
+		c.Logger.Error("Outbound call gave up",
+			zap.String("target", target),
+			zap.Int("attempts", total),
+			zap.Error(lastErr),
+		)
+	}
+	return nil, lastErr
+}
+
+// StatusError is returned when the final attempt received a retryable status
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("outbound: unexpected status %d", e.StatusCode)
+}
+
+// IsStatus reports whether err is a StatusError with the given code
+func IsStatus(err error, code int) bool {
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode == code
+}
+
+func retryable(status int) bool {
+	return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
@@ -0,0 +1,113 @@
+package outbound
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func newTestClient(maxAttempts int) (*Client, *observer.ObservedLogs) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	return NewClient(zap.New(core), maxAttempts, 0), logs
+}
+
+func TestDoLogsEachAttemptOfRetriedCall(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client, logs := newTestClient(3)
+	resp, err := client.Do(context.Background(), "webhook", func(ctx context.Context) (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodPost, server.URL, nil)
+	})
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	resp.Body.Close()
+
+	entries := logs.All()
+	if len(entries) != 2 {
+		t.Fatalf("got %d log entries, want 2", len(entries))
+	}
+	for i, want := range []int64{http.StatusServiceUnavailable, http.StatusOK} {
+		fields := entries[i].ContextMap()
+		if fields["target"] != "webhook" {
+			t.Errorf("entry %d target = %v", i, fields["target"])
+		}
+		if fields["attempt"] != int64(i+1) {
+			t.Errorf("entry %d attempt = %v, want %d", i, fields["attempt"], i+1)
+		}
+		if fields["status"] != want {
+			t.Errorf("entry %d status = %v, want %d", i, fields["status"], want)
+		}
+		if _, ok := fields["latency"]; !ok {
+			t.Errorf("entry %d missing latency", i)
+		}
+	}
+}
+
+func TestDoLogsSummaryOnGiveUp(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	client, logs := newTestClient(2)
+	_, err := client.Do(context.Background(), "notifier", func(ctx context.Context) (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodPost, server.URL, nil)
+	})
+	if !IsStatus(err, http.StatusBadGateway) {
+		t.Fatalf("err = %v, want status error 502", err)
+	}
+
+	summary := logs.FilterMessage("Outbound call gave up").All()
+	if len(summary) != 1 {
+		t.Fatalf("got %d give-up entries, want 1", len(summary))
+	}
+	if got := summary[0].ContextMap()["attempts"]; got != int64(2) {
+		t.Errorf("attempts = %v, want 2", got)
+	}
+}
+
+func TestDoNumbersAttemptsOfRetryingCaller(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client, logs := newTestClient(1)
+	for attempt := 1; attempt <= 3; attempt++ {
+		ctx := WithAttempt(context.Background(), attempt, 3)
+		if _, err := client.Do(ctx, "webhook", func(ctx context.Context) (*http.Request, error) {
+			return http.NewRequestWithContext(ctx, http.MethodPost, server.URL, nil)
+		}); !IsStatus(err, http.StatusServiceUnavailable) {
+			t.Fatalf("attempt %d: err = %v, want status error 503", attempt, err)
+		}
+	}
+
+	failed := logs.FilterMessage("Outbound call failed").All()
+	if len(failed) != 3 {
+		t.Fatalf("got %d failed attempts logged, want 3", len(failed))
+	}
+	for i, entry := range failed {
+		if got := entry.ContextMap()["attempt"]; got != int64(i+1) || entry.Level != zapcore.WarnLevel {
+			t.Errorf("entry %d: attempt %v at %s, want %d at warn", i, got, entry.Level, i+1)
+		}
+	}
+	summary := logs.FilterMessage("Outbound call gave up").All()
+	if len(summary) != 1 || summary[0].Level != zapcore.ErrorLevel || summary[0].ContextMap()["attempts"] != int64(3) {
+		t.Errorf("give-up entries = %+v, want one error after the caller's 3 attempts", summary)
+	}
+}
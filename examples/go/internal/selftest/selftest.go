@@ -0,0 +1,80 @@
+// Package selftest exercises the critical request paths at startup so that
+// misconfiguration fails the process instead of the first real request
+package selftest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+	"github.com/cbwinslow/template2/examples/go/pkg/auth"
+)
+
+// Users is the part of the user store the self-test round-trips through
+type Users interface {
+	Create(ctx context.Context, req models.CreateUserRequest) (models.User, error)
+	Get(ctx context.Context, id int) (models.User, error)
+	HardDelete(ctx context.Context, id int) error
+}
+
+// Auth is the part of the auth service the self-test exercises
+type Auth interface {
+	SetPassword(ctx context.Context, userID int, password string) error
+	CheckPassword(ctx context.Context, userID int, password string) error
+	GenerateToken(ctx context.Context, userID int, email, role string) (string, error)
+	ValidateToken(ctx context.Context, token string) (*auth.Claims, error)
+}
+
+// Run creates a throwaway user, sets and checks its password, signs and
+// verifies a token for it and deletes it again, returning the first step
+// that fails. The throwaway user consumes an ID from the store.
+func Run(ctx context.Context, users Users, tokens Auth) (err error) {
+	user, err := users.Create(ctx, models.CreateUserRequest{
+		Name:  "Startup self-test",
+		Email: fmt.Sprintf("selftest-%d@selftest.invalid", time.Now().UnixNano()),
+		Role:  models.RoleUser,
+	})
+	if err != nil {
+		return fmt.Errorf("selftest: create user: %w", err)
+	}
+	defer func() {
+		if deleteErr := users.HardDelete(ctx, user.ID); deleteErr != nil && err == nil {
+			err = fmt.Errorf("selftest: delete user: %w", deleteErr)
+		}
+	}()
+
+	stored, err := users.Get(ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("selftest: read user back: %w", err)
+	}
+	if stored.Email != user.Email {
+		return fmt.Errorf("selftest: read user back: got email %q, want %q", stored.Email, user.Email)
+	}
+
+	const password = "selftest-password"
+	if err := tokens.SetPassword(ctx, user.ID, password); err != nil {
+		return fmt.Errorf("selftest: hash password: %w", err)
+	}
+	if err := tokens.CheckPassword(ctx, user.ID, password); err != nil {
+		return fmt.Errorf("selftest: compare password: %w", err)
+	}
+	if err := tokens.CheckPassword(ctx, user.ID, password+"-wrong"); !errors.Is(err, auth.ErrInvalidCredentials) {
+		return fmt.Errorf("selftest: wrong password was not rejected: %v", err)
+	}
+
+	token, err := tokens.GenerateToken(ctx, user.ID, user.Email, user.Role)
+	if err != nil {
+		return fmt.Errorf("selftest: sign token: %w", err)
+	}
+	claims, err := tokens.ValidateToken(ctx, token)
+	if err != nil {
+		return fmt.Errorf("selftest: verify token: %w", err)
+	}
+	if claims.UserID != user.ID {
+		return fmt.Errorf("selftest: verify token: got user %d, want %d", claims.UserID, user.ID)
+	}
+
+	return nil
+}
@@ -0,0 +1,60 @@
+package selftest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+	"github.com/cbwinslow/template2/examples/go/pkg/auth"
+)
+
+// mismatchedSecret signs with one key and verifies with another, as when
+// instances are deployed with different JWT secrets
+type mismatchedSecret struct {
+	*auth.AuthService
+	verifier *auth.AuthService
+}
+
+func (m mismatchedSecret) ValidateToken(ctx context.Context, token string) (*auth.Claims, error) {
+	return m.verifier.ValidateToken(ctx, token)
+}
+
+func userCount(t *testing.T, users *models.UserService) int {
+	t.Helper()
+	list, err := users.List(context.Background())
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	return len(list)
+}
+
+func TestRunPassesWithValidConfig(t *testing.T) {
+	users := models.NewUserService()
+	before := userCount(t, users)
+	tokens := auth.NewAuthService(auth.WithSecret([]byte("test-secret")))
+
+	if err := Run(context.Background(), users, tokens); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	if after := userCount(t, users); after != before {
+		t.Errorf("self-test left %d users behind", after-before)
+	}
+}
+
+func TestRunFailsWithBrokenSecret(t *testing.T) {
+	users := models.NewUserService()
+	before := userCount(t, users)
+	tokens := mismatchedSecret{
+		AuthService: auth.NewAuthService(auth.WithSecret([]byte("test-secret"))),
+		verifier:    auth.NewAuthService(auth.WithSecret([]byte("other-secret"))),
+	}
+
+	if err := Run(context.Background(), users, tokens); err == nil {
+		t.Fatal("expected the self-test to fail")
+	}
+
+	if after := userCount(t, users); after != before {
+		t.Errorf("failed self-test left %d users behind", after-before)
+	}
+}
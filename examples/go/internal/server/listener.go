@@ -0,0 +1,57 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	minAcceptBackoff = 5 * time.Millisecond
+	maxAcceptBackoff = time.Second
+)
+
+// Listener wraps a net.Listener so that accept failures caused by running out
+// of file descriptors (EMFILE, ENFILE) are logged and retried with backoff
+// instead of being returned to http.Server.Serve. Backoff starts at 5ms,
+// doubles on every consecutive failure up to 1s, and resets after a
+// successful accept, mirroring the standard library's own accept loop.
+type Listener struct {
+	net.Listener
+	logger *zap.Logger
+	sleep  func(time.Duration)
+}
+
+// NewListener wraps ln, logging descriptor exhaustion to logger
+func NewListener(ln net.Listener, logger *zap.Logger) *Listener {
+	return &Listener{Listener: ln, logger: logger, sleep: time.Sleep}
+}
+
+// Accept waits for the next connection, riding out descriptor exhaustion
+func (l *Listener) Accept() (net.Conn, error) {
+	var backoff time.Duration
+	for {
+		conn, err := l.Listener.Accept()
+		if err == nil || !isDescriptorExhaustion(err) {
+			return conn, err
+		}
+
+		if backoff == 0 {
+			backoff = minAcceptBackoff
+		} else {
+			backoff = min(2*backoff, maxAcceptBackoff)
+		}
+		l.logger.Error("Accept failed: file descriptors exhausted",
+			zap.String("event", "accept_fd_exhausted"),
+			zap.Duration("retry_in", backoff),
+			zap.Error(err))
+		l.sleep(backoff)
+	}
+}
+
+func isDescriptorExhaustion(err error) bool {
+	return errors.Is(err, syscall.EMFILE) || errors.Is(err, syscall.ENFILE)
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// scriptedListener returns the queued errors before yielding a connection
+type scriptedListener struct {
+	net.Listener
+	errs []error
+}
+
+func (s *scriptedListener) Accept() (net.Conn, error) {
+	if len(s.errs) > 0 {
+		err := s.errs[0]
+		s.errs = s.errs[1:]
+		return nil, err
+	}
+	client, server := net.Pipe()
+	client.Close()
+	return server, nil
+}
+
+func TestListenerBacksOffOnDescriptorExhaustion(t *testing.T) {
+	emfile := &net.OpError{Op: "accept", Err: os.NewSyscallError("accept", syscall.EMFILE)}
+	inner := &scriptedListener{errs: make([]error, 0, 10)}
+	for i := 0; i < 10; i++ {
+		inner.errs = append(inner.errs, emfile)
+	}
+
+	core, logs := observer.New(zap.ErrorLevel)
+	ln := NewListener(inner, zap.New(core))
+	var waits []time.Duration
+	ln.sleep = func(d time.Duration) { waits = append(waits, d) }
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("Accept: %v", err)
+	}
+	conn.Close()
+
+	want := []time.Duration{5, 10, 20, 40, 80, 160, 320, 640, 1000, 1000}
+	if len(waits) != len(want) {
+		t.Fatalf("waits = %v, want %d backoffs", waits, len(want))
+	}
+	for i, ms := range want {
+		if waits[i] != ms*time.Millisecond {
+			t.Errorf("wait %d = %v, want %v", i, waits[i], ms*time.Millisecond)
+		}
+	}
+	if logs.FilterField(zap.String("event", "accept_fd_exhausted")).Len() != len(want) {
+		t.Errorf("logged %d exhaustion events, want %d", logs.Len(), len(want))
+	}
+}
+
+func TestListenerReturnsOtherErrors(t *testing.T) {
+	inner := &scriptedListener{errs: []error{net.ErrClosed}}
+	ln := NewListener(inner, zap.NewNop())
+	ln.sleep = func(time.Duration) { t.Error("unexpected backoff") }
+
+	if _, err := ln.Accept(); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("err = %v, want net.ErrClosed", err)
+	}
+}
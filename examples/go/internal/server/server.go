@@ -0,0 +1,21 @@
+// Package server contains the HTTP server lifecycle helpers
+package server
+
+import (
+	"context"
+)
+
+// Drainer is the part of *http.Server used during graceful shutdown
+type Drainer interface {
+	SetKeepAlivesEnabled(enabled bool)
+	Shutdown(ctx context.Context) error
+}
+
+// Drain gracefully stops srv. Keep-alives are disabled first so that
+// responses to in-flight requests carry "Connection: close" and clients
+// reconnect elsewhere instead of reusing a connection to a draining
+// instance; then Shutdown waits for active requests until ctx is done.
+func Drain(ctx context.Context, srv Drainer) error {
+	srv.SetKeepAlivesEnabled(false)
+	return srv.Shutdown(ctx)
+}
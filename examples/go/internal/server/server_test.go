@@ -0,0 +1,89 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type recordingServer struct {
+	calls []string
+}
+
+func (r *recordingServer) SetKeepAlivesEnabled(enabled bool) {
+	if enabled {
+		r.calls = append(r.calls, "keepalives:on")
+	} else {
+		r.calls = append(r.calls, "keepalives:off")
+	}
+}
+
+func (r *recordingServer) Shutdown(ctx context.Context) error {
+	r.calls = append(r.calls, "shutdown")
+	return nil
+}
+
+func TestDrainDisablesKeepAlivesBeforeShutdown(t *testing.T) {
+	srv := &recordingServer{}
+	if err := Drain(context.Background(), srv); err != nil {
+		t.Fatalf("Drain: %v", err)
+	}
+
+	if len(srv.calls) != 2 || srv.calls[0] != "keepalives:off" || srv.calls[1] != "shutdown" {
+		t.Errorf("calls = %v, want [keepalives:off shutdown]", srv.calls)
+	}
+}
+
+// signalingServer reports when keep-alives have been disabled
+type signalingServer struct {
+	*http.Server
+	disabled chan struct{}
+}
+
+func (s *signalingServer) SetKeepAlivesEnabled(enabled bool) {
+	s.Server.SetKeepAlivesEnabled(enabled)
+	if !enabled {
+		close(s.disabled)
+	}
+}
+
+func TestDrainClosesInFlightConnections(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	respc := make(chan *http.Response, 1)
+	go func() {
+		resp, err := http.Get(ts.URL)
+		if err != nil {
+			t.Errorf("GET: %v", err)
+			respc <- nil
+			return
+		}
+		resp.Body.Close()
+		respc <- resp
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	done := make(chan error, 1)
+	srv := &signalingServer{Server: ts.Config, disabled: make(chan struct{})}
+	go func() { done <- Drain(ctx, srv) }()
+
+	<-srv.disabled
+	close(release)
+	if resp := <-respc; resp != nil && !resp.Close {
+		t.Error("in-flight response did not ask the client to close the connection")
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Drain: %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// TLSConfig returns the TLS settings for the HTTPS listener, taking
+// certificates from manager when it is not nil. Certificate files are
+// passed to ServeTLS instead.
+func TLSConfig(manager *autocert.Manager) *tls.Config {
+	if manager != nil {
+		// Adds the acme-tls/1 protocol the TLS-ALPN challenge is answered on
+		config := manager.TLSConfig()
+		config.MinVersion = tls.VersionTLS12
+		return config
+	}
+	return &tls.Config{MinVersion: tls.VersionTLS12}
+}
+
+// RequireClientCerts makes config verify client certificates against the
+// PEM bundle in caFile. With optional, clients may still connect without
+// one; a certificate that is presented must verify either way.
+func RequireClientCerts(config *tls.Config, caFile string, optional bool) error {
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return fmt.Errorf("server: read client CAs: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return errors.New("server: no certificates in " + caFile)
+	}
+	config.ClientCAs = pool
+	config.ClientAuth = tls.RequireAndVerifyClientCert
+	if optional {
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return nil
+}
+
+// NewAutocert returns a manager obtaining certificates from Let's Encrypt
+// for domains, keeping them in cacheDir so restarts do not run into the
+// issuance rate limits. email, if set, is where expiry notices go.
+func NewAutocert(domains []string, cacheDir, email string) *autocert.Manager {
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(domains...),
+		Cache:      autocert.DirCache(cacheDir),
+		Email:      email,
+	}
+}
+
+// RedirectHTTPS answers plain HTTP requests with a permanent redirect to
+// the same URL over HTTPS on the port of httpsAddr. GET and HEAD get 301
+// and other methods 308, so clients resend the body.
+func RedirectHTTPS(httpsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(httpsAddr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		} else if strings.Contains(host, ":") && !strings.HasPrefix(host, "[") {
+			host = "[" + host + "]"
+		}
+		target := "https://" + host + r.URL.RequestURI()
+
+		status := http.StatusPermanentRedirect
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			status = http.StatusMovedPermanently
+		}
+		http.Redirect(w, r, target, status)
+	})
+}
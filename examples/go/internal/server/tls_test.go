@@ -0,0 +1,150 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRedirectHTTPS(t *testing.T) {
+	tests := []struct {
+		httpsAddr, method, url string
+		status                 int
+		location               string
+	}{
+		{":443", http.MethodGet, "http://api.example.com/users?page=2", http.StatusMovedPermanently, "https://api.example.com/users?page=2"},
+		{":443", http.MethodGet, "http://api.example.com:80/", http.StatusMovedPermanently, "https://api.example.com/"},
+		{":8443", http.MethodHead, "http://localhost:8080/health", http.StatusMovedPermanently, "https://localhost:8443/health"},
+		{":443", http.MethodPost, "http://[::1]:80/users", http.StatusPermanentRedirect, "https://[::1]/users"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		RedirectHTTPS(tt.httpsAddr).ServeHTTP(w, httptest.NewRequest(tt.method, tt.url, nil))
+		if w.Code != tt.status || w.Header().Get("Location") != tt.location {
+			t.Errorf("%s %s: %d %q, want %d %q", tt.method, tt.url, w.Code, w.Header().Get("Location"), tt.status, tt.location)
+		}
+	}
+}
+
+func TestTLSConfigAnswersACMEChallenges(t *testing.T) {
+	if config := TLSConfig(nil); config.MinVersion != tls.VersionTLS12 || config.GetCertificate != nil {
+		t.Errorf("file config = %+v", config)
+	}
+
+	config := TLSConfig(NewAutocert([]string{"api.example.com"}, t.TempDir(), ""))
+	if config.MinVersion != tls.VersionTLS12 || config.GetCertificate == nil {
+		t.Fatalf("autocert config = %+v", config)
+	}
+	var alpn bool
+	for _, proto := range config.NextProtos {
+		alpn = alpn || proto == "acme-tls/1"
+	}
+	if !alpn {
+		t.Errorf("NextProtos = %v, want acme-tls/1 for the TLS-ALPN challenge", config.NextProtos)
+	}
+}
+
+// issue creates a certificate for cn signed by parent, or self-signed as a
+// CA when parent is nil
+func issue(t *testing.T, cn string, parent *tls.Certificate) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := template, interface{}(key)
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, _ := x509.ParseCertificate(der)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func TestRequireClientCerts(t *testing.T) {
+	ca := issue(t, "internal CA", nil)
+	caFile := filepath.Join(t.TempDir(), "clients.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Certificate[0]}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, optional := range []bool{false, true} {
+		srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if len(r.TLS.VerifiedChains) == 0 {
+				w.Write([]byte("anonymous"))
+				return
+			}
+			w.Write([]byte(r.TLS.VerifiedChains[0][0].Subject.CommonName))
+		}))
+		srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+		srv.TLS = TLSConfig(nil)
+		if err := RequireClientCerts(srv.TLS, caFile, optional); err != nil {
+			t.Fatalf("RequireClientCerts: %v", err)
+		}
+		srv.StartTLS()
+
+		get := func(certs ...tls.Certificate) (string, error) {
+			transport := srv.Client().Transport.(*http.Transport).Clone()
+			// Sent even when its issuer is not one the server asked for
+			transport.TLSClientConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+				if len(certs) == 0 {
+					return &tls.Certificate{}, nil
+				}
+				return &certs[0], nil
+			}
+			resp, err := (&http.Client{Transport: transport}).Get(srv.URL)
+			if err != nil {
+				return "", err
+			}
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			return string(body), err
+		}
+
+		if body, err := get(issue(t, "svc-billing", &ca)); err != nil || body != "svc-billing" {
+			t.Errorf("optional=%v, signed certificate: %q, %v", optional, body, err)
+		}
+		if _, err := get(issue(t, "svc-rogue", nil)); err == nil {
+			t.Errorf("optional=%v, self-signed certificate: want the handshake refused", optional)
+		}
+		body, err := get()
+		if optional && (err != nil || body != "anonymous") {
+			t.Errorf("optional, no certificate: %q, %v", body, err)
+		}
+		if !optional && err == nil {
+			t.Error("required, no certificate: want the handshake refused")
+		}
+		srv.Close()
+	}
+
+	if err := RequireClientCerts(TLSConfig(nil), filepath.Join(t.TempDir(), "missing.pem"), false); err == nil {
+		t.Error("missing CA file: want an error")
+	}
+}
@@ -0,0 +1,13 @@
+//go:build tools
+
+// Package tools pins the code generators go generate runs, so they build
+// at the versions go.mod records
+package tools
+
+import (
+	_ "github.com/99designs/gqlgen"
+	_ "github.com/grpc-ecosystem/grpc-gateway/v2/protoc-gen-grpc-gateway"
+	_ "github.com/swaggo/swag/cmd/swag"
+	_ "google.golang.org/grpc/cmd/protoc-gen-go-grpc"
+	_ "google.golang.org/protobuf/cmd/protoc-gen-go"
+)
@@ -0,0 +1,377 @@
+// Package ws serves WebSocket connections to authenticated users and sends
+// them messages, addressed to one user or to everyone, through a Hub
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+
+	"github.com/cbwinslow/template2/examples/go/internal/middleware"
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+	"github.com/cbwinslow/template2/examples/go/pkg/events"
+)
+
+// Protocol is the subprotocol the hub speaks: JSON Message text frames from
+// the server. It is selected when the client offers it, which browsers
+// passing their token as a Sec-WebSocket-Protocol entry must do.
+const Protocol = "template2.v1"
+
+// Defaults for a Hub
+const (
+	defaultPingInterval = 30 * time.Second
+	// defaultSendBuffer is how many messages a connection may fall behind
+	// by before it is closed
+	defaultSendBuffer = 64
+	// defaultMaxMessage bounds what clients may send
+	defaultMaxMessage = 4 << 10
+	writeTimeout      = 10 * time.Second
+	// closeTimeout is how long the client has to answer a close frame
+	closeTimeout = 5 * time.Second
+)
+
+// Message is sent to clients as a JSON text frame
+type Message struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data,omitempty"`
+}
+
+// Hub keeps the open connections of each user and sends messages to them
+type Hub struct {
+	logger       *zap.Logger
+	pingInterval time.Duration
+	origins      []string
+
+	mu       sync.Mutex
+	clients  map[int]map[*client]struct{}
+	draining bool
+	// running counts the connections still open
+	running sync.WaitGroup
+}
+
+// HubOption configures a Hub
+type HubOption func(*Hub)
+
+// WithPingInterval sets how often connections are pinged. A connection
+// that sends nothing, not even a pong, for two intervals is closed.
+func WithPingInterval(interval time.Duration) HubOption {
+	return func(h *Hub) {
+		h.pingInterval = interval
+	}
+}
+
+// WithAllowedOrigins admits handshakes from origins, or from any origin
+// with "*", in addition to the API's own. Browsers send their token with a
+// cross-origin handshake too, so only origins trusted with it belong here.
+func WithAllowedOrigins(origins []string) HubOption {
+	return func(h *Hub) {
+		h.origins = origins
+	}
+}
+
+// NewHub creates a hub without connections
+func NewHub(logger *zap.Logger, opts ...HubOption) *Hub {
+	h := &Hub{logger: logger, pingInterval: defaultPingInterval, clients: make(map[int]map[*client]struct{})}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// closeFrame is the close frame the server ends a connection with
+type closeFrame struct {
+	code   int
+	reason string
+}
+
+// client is one open connection
+type client struct {
+	hub    *Hub
+	conn   *websocket.Conn
+	userID int
+	role   string
+	logger *zap.Logger
+
+	send chan []byte
+	// closing carries the close frame the server ends the connection with
+	closing   chan closeFrame
+	closeOnce sync.Once
+	// readDone is closed when the client stops reading
+	readDone chan struct{}
+}
+
+// Handle upgrades the request to a WebSocket connection of the
+// authenticated user. It must run after middleware.AuthRequired, which
+// reads the token of a handshake from its Sec-WebSocket-Protocol or
+// access_token parameter.
+//
+// @Summary Open a WebSocket
+// @Description Upgrades to a WebSocket receiving JSON messages {"type": ..., "data": ...}, such as the domain events the user may see, typed by event name. Offer the template2.v1 subprotocol; browsers may pass their token as a "bearer.<token>" entry beside it.
+// @Description The connection is closed with 1008 when the user's tokens are revoked, 1013 when it falls behind and 1001 when the server shuts down.
+// @Tags events
+// @Param access_token query string false "Access token, for clients that cannot set headers"
+// @Success 101 {string} string "Switching Protocols"
+// @Failure 400 {object} apierror.Problem
+// @Failure 401 {object} apierror.Problem
+// @Failure 403 {object} apierror.Problem
+// @Failure 503 {object} apierror.Problem
+// @Router /ws [get]
+func (h *Hub) Handle(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		middleware.AbortWithError(c, models.NewError(http.StatusUnauthorized, models.CodeUnauthorized, "Authentication required"))
+		return
+	}
+	logger := middleware.RequestLogger(c, h.logger).With(zap.Int("user_id", userID))
+	h.mu.Lock()
+	if h.draining {
+		h.mu.Unlock()
+		c.Header("Retry-After", "5")
+		middleware.AbortWithError(c, models.NewError(http.StatusServiceUnavailable, models.CodeUnavailable, "The server is shutting down"))
+		return
+	}
+	// Counted before the upgrade so Drain waits for a connection being
+	// accepted
+	h.running.Add(1)
+	h.mu.Unlock()
+
+	upgrader := websocket.Upgrader{
+		Subprotocols: []string{Protocol},
+		CheckOrigin:  h.originAllowed,
+		Error: func(_ http.ResponseWriter, _ *http.Request, status int, _ error) {
+			if status == http.StatusForbidden {
+				middleware.AbortWithError(c, models.NewError(status, models.CodeForbidden, "Origin not allowed"))
+				return
+			}
+			c.Header("Sec-WebSocket-Version", "13")
+			middleware.AbortWithError(c, models.NewError(status, models.CodeValidationFailed, "Invalid WebSocket handshake"))
+		},
+	}
+	// Recorded for the access log; a refused handshake replaces it
+	c.Writer.WriteHeader(http.StatusSwitchingProtocols)
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		h.running.Done()
+		var handshakeErr websocket.HandshakeError
+		if !errors.As(err, &handshakeErr) {
+			logger.Warn("WebSocket upgrade failed", zap.Error(err))
+		}
+		return
+	}
+	conn.SetReadLimit(defaultMaxMessage)
+
+	cl := &client{
+		hub:      h,
+		conn:     conn,
+		userID:   userID,
+		role:     middleware.GetRole(c),
+		logger:   logger,
+		send:     make(chan []byte, defaultSendBuffer),
+		closing:  make(chan closeFrame, 1),
+		readDone: make(chan struct{}),
+	}
+	if !h.add(cl) {
+		// Drain began during the upgrade
+		cl.close(websocket.CloseGoingAway, "server shutting down")
+	}
+	go cl.readLoop()
+	go cl.writeLoop()
+}
+
+// originAllowed reports whether a handshake may come from its origin.
+// Clients other than browsers send no Origin and are admitted.
+func (h *Hub) originAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || slices.Contains(h.origins, "*") || slices.Contains(h.origins, origin) {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host
+}
+
+func (h *Hub) add(c *client) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.draining {
+		return false
+	}
+	if h.clients[c.userID] == nil {
+		h.clients[c.userID] = make(map[*client]struct{})
+	}
+	h.clients[c.userID][c] = struct{}{}
+	return true
+}
+
+func (h *Hub) remove(c *client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if conns := h.clients[c.userID]; conns != nil {
+		delete(conns, c)
+		if len(conns) == 0 {
+			delete(h.clients, c.userID)
+		}
+	}
+}
+
+// each calls fn for every open connection
+func (h *Hub) each(fn func(c *client)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, conns := range h.clients {
+		for c := range conns {
+			fn(c)
+		}
+	}
+}
+
+// SendToUser sends msg to every connection of the user
+func (h *Hub) SendToUser(userID int, msg Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for c := range h.clients[userID] {
+		c.enqueue(data)
+	}
+	return nil
+}
+
+// Broadcast sends msg to every connection
+func (h *Hub) Broadcast(msg Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	h.each(func(c *client) { c.enqueue(data) })
+	return nil
+}
+
+// Connections returns the number of open connections
+func (h *Hub) Connections() int {
+	n := 0
+	h.each(func(*client) { n++ })
+	return n
+}
+
+// Forward is an events.Handler sending e, typed by its name, to the
+// connections of users who may see it, and closing those of users whose
+// access it ends
+func (h *Hub) Forward(_ context.Context, e events.Event) error {
+	data, err := json.Marshal(Message{Type: e.EventName(), Data: e})
+	if err != nil {
+		return err
+	}
+	h.each(func(c *client) {
+		switch {
+		case models.EndsAccess(c.userID, e):
+			c.close(websocket.ClosePolicyViolation, "access revoked")
+		case models.CanSeeEvent(c.role, c.userID, e):
+			c.enqueue(data)
+		}
+	})
+	return nil
+}
+
+// Drain refuses new connections and closes the open ones with 1001 Going
+// Away, waiting until ctx is done for the clients to answer. Connections
+// still open then are dropped.
+func (h *Hub) Drain(ctx context.Context) error {
+	h.mu.Lock()
+	h.draining = true
+	h.mu.Unlock()
+	h.each(func(c *client) { c.close(websocket.CloseGoingAway, "server shutting down") })
+
+	done := make(chan struct{})
+	go func() {
+		h.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		h.each(func(c *client) { _ = c.conn.Close() })
+		return ctx.Err()
+	}
+}
+
+// enqueue queues data for the writer, closing a connection that fell behind
+func (c *client) enqueue(data []byte) {
+	select {
+	case c.send <- data:
+	default:
+		c.close(websocket.CloseTryAgainLater, "connection fell behind")
+	}
+}
+
+// close asks the writer to end the connection with a close frame
+func (c *client) close(code int, reason string) {
+	c.closeOnce.Do(func() { c.closing <- closeFrame{code: code, reason: reason} })
+}
+
+// readLoop reads until the connection fails or the client closes it,
+// dropping the client's messages: the hub only sends. The connection
+// answers pings and close frames itself, and closes with 1002 or 1009 a
+// client breaking the protocol or sending too much.
+func (c *client) readLoop() {
+	defer close(c.readDone)
+	alive := func() error { return c.conn.SetReadDeadline(time.Now().Add(2 * c.hub.pingInterval)) }
+	_ = alive()
+	c.conn.SetPongHandler(func(string) error { return alive() })
+	for {
+		if _, _, err := c.conn.ReadMessage(); err != nil {
+			c.logger.Debug("WebSocket read ended", zap.Error(err))
+			return
+		}
+		_ = alive()
+	}
+}
+
+// writeLoop sends queued messages and pings until the connection is closed
+func (c *client) writeLoop() {
+	defer c.hub.running.Done()
+	defer c.hub.remove(c)
+	defer c.conn.Close()
+
+	ping := time.NewTicker(c.hub.pingInterval)
+	defer ping.Stop()
+	for {
+		var err error
+		select {
+		case data := <-c.send:
+			_ = c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			err = c.conn.WriteMessage(websocket.TextMessage, data)
+		case <-ping.C:
+			err = c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeTimeout))
+		case frame := <-c.closing:
+			// Start the closing handshake, then wait for the client's close
+			// frame before dropping the connection
+			_ = c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(frame.code, frame.reason), time.Now().Add(writeTimeout))
+			select {
+			case <-c.readDone:
+			case <-time.After(closeTimeout):
+			}
+			c.logger.Debug("WebSocket closed", zap.Int("code", frame.code), zap.String("reason", frame.reason))
+			return
+		case <-c.readDone:
+			// The client closed the connection or broke the protocol, and
+			// was answered while reading
+			return
+		}
+		if err != nil {
+			c.logger.Debug("WebSocket write failed", zap.Error(err))
+			return
+		}
+	}
+}
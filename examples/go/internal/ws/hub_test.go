@@ -0,0 +1,285 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+
+	"github.com/cbwinslow/template2/examples/go/internal/middleware"
+	"github.com/cbwinslow/template2/examples/go/internal/models"
+	"github.com/cbwinslow/template2/examples/go/pkg/auth"
+	"github.com/cbwinslow/template2/examples/go/pkg/events"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+func newHubServer(t *testing.T, hub *Hub) (*httptest.Server, *auth.AuthService) {
+	t.Helper()
+	authService := auth.NewAuthService()
+	router := gin.New()
+	router.GET("/ws", middleware.AuthRequired(authService), hub.Handle)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return server, authService
+}
+
+// handshake opens a connection with headers and returns the response, and
+// the connection if the request was upgraded
+func handshake(t *testing.T, server *httptest.Server, headers http.Header) (*http.Response, *websocket.Conn) {
+	t.Helper()
+	conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", headers)
+	if errors.Is(err, websocket.ErrBadHandshake) {
+		return resp, nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return resp, conn
+}
+
+// rawHandshake sends an opening handshake with headers the dialer would
+// not, returning the response
+func rawHandshake(t *testing.T, server *httptest.Server, headers map[string]string) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/ws", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func dial(t *testing.T, server *httptest.Server, token string) *websocket.Conn {
+	t.Helper()
+	resp, conn := handshake(t, server, http.Header{"Authorization": {"Bearer " + token}})
+	if conn == nil {
+		t.Fatalf("handshake: status = %d", resp.StatusCode)
+	}
+	return conn
+}
+
+// readMessage reads the next message, which must be a Message
+func readMessage(t *testing.T, conn *websocket.Conn) Message {
+	t.Helper()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	op, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	var msg Message
+	if op != websocket.TextMessage || json.Unmarshal(data, &msg) != nil {
+		t.Fatalf("message %d %q is not a Message", op, data)
+	}
+	return msg
+}
+
+// closeCode reads until the server closes the connection, which the
+// connection answers, and returns the code it closed with
+func closeCode(t *testing.T, conn *websocket.Conn) int {
+	t.Helper()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, data, err := conn.ReadMessage()
+		var closeErr *websocket.CloseError
+		if errors.As(err, &closeErr) {
+			return closeErr.Code
+		}
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		t.Fatalf("message %q, want a close frame", data)
+	}
+}
+
+// waitForConnections waits for the hub to hold n connections
+func waitForConnections(t *testing.T, hub *Hub, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for hub.Connections() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("hub holds %d connections, want %d", hub.Connections(), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestHubDeliversToUsers(t *testing.T) {
+	hub := NewHub(zap.NewNop())
+	server, authService := newHubServer(t, hub)
+	ctx := context.Background()
+	adminToken, _ := authService.GenerateToken(ctx, 1, "alice@example.com", models.RoleAdmin)
+	userToken, _ := authService.GenerateToken(ctx, 3, "hana@example.com", models.RoleUser)
+	alice := dial(t, server, adminToken)
+	hana := dial(t, server, userToken)
+	waitForConnections(t, hub, 2)
+
+	_ = hub.SendToUser(3, Message{Type: "hello"})
+	_ = hub.Broadcast(Message{Type: "notice", Data: "maintenance at 5"})
+	if msg := readMessage(t, hana); msg.Type != "hello" {
+		t.Errorf("hana's first message = %+v", msg)
+	}
+	for _, conn := range []*websocket.Conn{alice, hana} {
+		if msg := readMessage(t, conn); msg.Type != "notice" || msg.Data != "maintenance at 5" {
+			t.Errorf("broadcast = %+v", msg)
+		}
+	}
+
+	// Alice's sign-in is hidden from Hana, whose own goes to both
+	_ = hub.Forward(ctx, events.LoginSucceeded{UserID: 1})
+	_ = hub.Forward(ctx, events.LoginSucceeded{UserID: 3, SessionID: "s-3"})
+	if msg := readMessage(t, alice); msg.Type != events.NameLoginSucceeded {
+		t.Errorf("alice's event = %+v", msg)
+	}
+	if msg := readMessage(t, hana); msg.Type != events.NameLoginSucceeded || msg.Data.(map[string]interface{})["user_id"] != float64(3) {
+		t.Errorf("hana's event = %+v", msg)
+	}
+
+	// Client pings are answered, while the client reads
+	pong := make(chan string, 1)
+	hana.SetPongHandler(func(data string) error {
+		pong <- data
+		return nil
+	})
+	closed := make(chan int, 1)
+	go func() {
+		_, _, err := hana.ReadMessage()
+		var closeErr *websocket.CloseError
+		if errors.As(err, &closeErr) {
+			closed <- closeErr.Code
+		}
+		close(closed)
+	}()
+	if err := hana.WriteControl(websocket.PingMessage, []byte("are you there"), time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case data := <-pong:
+		if data != "are you there" {
+			t.Errorf("ping answered with %q", data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ping not answered")
+	}
+
+	_ = hub.Forward(ctx, events.TokensRevoked{UserID: 3})
+	if code := <-closed; code != websocket.ClosePolicyViolation {
+		t.Errorf("revoked: close code = %d, want %d", code, websocket.ClosePolicyViolation)
+	}
+	waitForConnections(t, hub, 1)
+}
+
+func TestHubPingsAndDrains(t *testing.T) {
+	hub := NewHub(zap.NewNop(), WithPingInterval(20*time.Millisecond))
+	server, authService := newHubServer(t, hub)
+	token, _ := authService.GenerateToken(context.Background(), 3, "hana@example.com", models.RoleUser)
+	conn := dial(t, server, token)
+
+	// Answering pings keeps the connection open past two intervals
+	pings := 0
+	conn.SetPingHandler(func(data string) error {
+		pings++
+		return conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+	})
+	drained := make(chan error, 1)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		drained <- hub.Drain(ctx)
+	}()
+	if code := closeCode(t, conn); code != websocket.CloseGoingAway {
+		t.Errorf("drain: close code = %d, want %d", code, websocket.CloseGoingAway)
+	}
+	if pings < 3 {
+		t.Errorf("%d pings before the drain, want at least 3", pings)
+	}
+	if err := <-drained; err != nil {
+		t.Errorf("Drain: %v", err)
+	}
+	if n := hub.Connections(); n != 0 {
+		t.Errorf("%d connections left after drain", n)
+	}
+
+	if resp := rawHandshake(t, server, map[string]string{"Authorization": "Bearer " + token}); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("handshake while draining: status = %d, want 503", resp.StatusCode)
+	}
+}
+
+func TestHubClosesSilentConnections(t *testing.T) {
+	hub := NewHub(zap.NewNop(), WithPingInterval(10*time.Millisecond))
+	server, authService := newHubServer(t, hub)
+	token, _ := authService.GenerateToken(context.Background(), 3, "hana@example.com", models.RoleUser)
+	dial(t, server, token)
+	waitForConnections(t, hub, 1)
+	// The client never reads, so never answers a ping
+	waitForConnections(t, hub, 0)
+}
+
+func TestHubHandshake(t *testing.T) {
+	hub := NewHub(zap.NewNop(), WithAllowedOrigins([]string{"https://app.example.com"}))
+	server, authService := newHubServer(t, hub)
+	token, _ := authService.GenerateToken(context.Background(), 3, "hana@example.com", models.RoleUser)
+
+	// A browser passes its token beside the subprotocol, which alone is
+	// echoed
+	resp, conn := handshake(t, server, http.Header{
+		"Sec-WebSocket-Protocol": {Protocol + ", " + middleware.WebSocketTokenProtocol + token},
+		"Origin":                 {"https://app.example.com"},
+	})
+	if conn == nil {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+	if got := conn.Subprotocol(); got != Protocol {
+		t.Errorf("selected protocol %q", got)
+	}
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    int
+	}{
+		{"no token", map[string]string{}, http.StatusUnauthorized},
+		{"foreign origin", map[string]string{"Authorization": "Bearer " + token, "Origin": "https://evil.example.com"}, http.StatusForbidden},
+		{"old version", map[string]string{"Authorization": "Bearer " + token, "Sec-WebSocket-Version": "8"}, http.StatusBadRequest},
+		{"bad key", map[string]string{"Authorization": "Bearer " + token, "Sec-WebSocket-Key": "short"}, http.StatusBadRequest},
+		{"not an upgrade", map[string]string{"Authorization": "Bearer " + token, "Upgrade": "h2c"}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		resp := rawHandshake(t, server, tt.headers)
+		if resp.StatusCode != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, resp.StatusCode, tt.want)
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != "application/problem+json" {
+			t.Errorf("%s: Content-Type = %q, want a problem", tt.name, ct)
+		}
+	}
+
+	// A message over the limit closes the connection
+	if err := conn.WriteMessage(websocket.TextMessage, make([]byte, defaultMaxMessage+1)); err != nil {
+		t.Fatal(err)
+	}
+	if code := closeCode(t, conn); code != websocket.CloseMessageTooBig {
+		t.Errorf("oversized message: close code = %d, want %d", code, websocket.CloseMessageTooBig)
+	}
+	waitForConnections(t, hub, 0)
+}
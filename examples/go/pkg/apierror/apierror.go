@@ -0,0 +1,176 @@
+// Package apierror describes failed API requests and renders them as RFC 7807
+// problem details
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+
+	"github.com/cbwinslow/template2/examples/go/pkg/validation"
+)
+
+// ContentType is the media type of a problem details document
+const ContentType = "application/problem+json"
+
+// typePrefix turns a code into the problem type URI. A URN names the type
+// without promising a page that documents it.
+const typePrefix = "urn:problem-type:"
+
+// Error is a failed request: the status to answer with, a machine-readable
+// code and a detail for people. Details carries extra values clients may act
+// on, such as a retry delay, and Fields the individual validation failures.
+// Err is the cause, which is unwrapped but never rendered.
+type Error struct {
+	Status  int
+	Code    string
+	Detail  string
+	Details map[string]interface{}
+	Fields  []FieldError
+	Err     error
+}
+
+// FieldError is one field of the request that failed validation
+type FieldError struct {
+	// Field is the JSON path of the field, e.g. "assignments[0].role"
+	Field string `json:"field"`
+	// Rule is the validation rule that failed, e.g. "required"
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Problem is the problem details document written for an Error. Code,
+// Details, Errors, RequestID and TraceID are extension members.
+type Problem struct {
+	Type      string                 `json:"type"`
+	Title     string                 `json:"title"`
+	Status    int                    `json:"status"`
+	Detail    string                 `json:"detail,omitempty"`
+	Instance  string                 `json:"instance,omitempty"`
+	Code      string                 `json:"code"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+	Errors    []FieldError           `json:"errors,omitempty"`
+	RequestID string                 `json:"request_id,omitempty"`
+	TraceID   string                 `json:"trace_id,omitempty"`
+}
+
+// New returns an Error with the given status, code and detail
+func New(status int, code, detail string) *Error {
+	return &Error{Status: status, Code: code, Detail: detail}
+}
+
+// Error implements error
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %s: %v", e.Code, e.Detail, e.Err)
+	}
+	return e.Code + ": " + e.Detail
+}
+
+// Unwrap returns the cause
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// WithDetails sets the extra values clients may act on and returns e
+func (e *Error) WithDetails(details map[string]interface{}) *Error {
+	e.Details = details
+	return e
+}
+
+// Wrap records err as the cause and returns e
+func (e *Error) Wrap(err error) *Error {
+	e.Err = err
+	return e
+}
+
+// Problem returns the document describing e. The caller fills in Instance,
+// RequestID and TraceID, which depend on the request.
+func (e *Error) Problem() Problem {
+	return Problem{
+		Type:    TypeURI(e.Code),
+		Title:   http.StatusText(e.Status),
+		Status:  e.Status,
+		Detail:  e.Detail,
+		Code:    e.Code,
+		Details: e.Details,
+		Errors:  e.Fields,
+	}
+}
+
+// TypeURI returns the problem type URI for a code, e.g.
+// "urn:problem-type:validation-failed" for VALIDATION_FAILED
+func TypeURI(code string) string {
+	return typePrefix + strings.ReplaceAll(strings.ToLower(code), "_", "-")
+}
+
+// Write writes problem to w as application/problem+json
+func Write(w http.ResponseWriter, problem Problem) error {
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(problem.Status)
+	return json.NewEncoder(w).Encode(problem)
+}
+
+// ValidationFields lists the field failures in a validation error returned by
+// a struct validator, or nil if err is some other error, such as malformed
+// JSON. Field paths leave out the name of the validated struct.
+func ValidationFields(err error) []FieldError {
+	var invalid validator.ValidationErrors
+	if !errors.As(err, &invalid) {
+		return nil
+	}
+
+	fields := make([]FieldError, len(invalid))
+	for i, fe := range invalid {
+		path := fe.Namespace()
+		if _, rest, found := strings.Cut(path, "."); found {
+			path = rest
+		}
+		fields[i] = FieldError{Field: path, Rule: fe.Tag(), Message: fieldMessage(path, fe)}
+	}
+	return fields
+}
+
+func fieldMessage(path string, fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return path + " is required"
+	case "email":
+		return path + " must be an email address"
+	case "min", "gte":
+		return fmt.Sprintf("%s must be at least %s%s", path, fe.Param(), lengthUnit(fe))
+	case "max", "lte":
+		return fmt.Sprintf("%s must be at most %s%s", path, fe.Param(), lengthUnit(fe))
+	case "gt":
+		return fmt.Sprintf("%s must be greater than %s", path, fe.Param())
+	case "lt":
+		return fmt.Sprintf("%s must be less than %s", path, fe.Param())
+	case "oneof":
+		return fmt.Sprintf("%s must be one of %s", path, fe.Param())
+	case validation.TagPassword:
+		return fmt.Sprintf("%s must be %d to %d characters long and mix letters with digits or symbols",
+			path, validation.MinPasswordLength, validation.MaxPasswordLength)
+	case validation.TagUsername:
+		return path + " may only contain letters, digits, spaces and . ' - _, and must start and end with a letter or digit"
+	default:
+		return fmt.Sprintf("%s failed the %s rule", path, fe.Tag())
+	}
+}
+
+// lengthUnit says what a min or max bound counts, since for strings and
+// lists it limits the length rather than the value
+func lengthUnit(fe validator.FieldError) string {
+	switch fe.Kind() {
+	case reflect.String:
+		return " characters long"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return " items long"
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,73 @@
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+)
+
+func TestProblemDescribesError(t *testing.T) {
+	cause := errors.New("pool exhausted")
+	err := New(http.StatusServiceUnavailable, "STORE_UNAVAILABLE", "Try again shortly").
+		WithDetails(map[string]interface{}{"retry_after_seconds": 5}).Wrap(cause)
+	if !errors.Is(err, cause) {
+		t.Error("the cause is not unwrapped")
+	}
+
+	w := httptest.NewRecorder()
+	if err := Write(w, err.Problem()); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if got := w.Header().Get("Content-Type"); got != ContentType {
+		t.Errorf("Content-Type = %q, want %q", got, ContentType)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	want := map[string]interface{}{
+		"type":   "urn:problem-type:store-unavailable",
+		"title":  "Service Unavailable",
+		"status": float64(503),
+		"detail": "Try again shortly",
+		"code":   "STORE_UNAVAILABLE",
+	}
+	for key, value := range want {
+		if doc[key] != value {
+			t.Errorf("%s = %v, want %v", key, doc[key], value)
+		}
+	}
+	if _, ok := doc["errors"]; ok {
+		t.Errorf("errors member without field failures: %s", w.Body.String())
+	}
+}
+
+func TestValidationFieldsNamesEachFailure(t *testing.T) {
+	type item struct {
+		Role string `validate:"required"`
+	}
+	type request struct {
+		Password string `validate:"min=8"`
+		Items    []item `validate:"dive"`
+	}
+	err := validator.New().Struct(request{Password: "short", Items: []item{{}}})
+
+	fields := ValidationFields(err)
+	if len(fields) != 2 {
+		t.Fatalf("fields = %+v, want 2", fields)
+	}
+	if fields[0] != (FieldError{Field: "Password", Rule: "min", Message: "Password must be at least 8 characters long"}) {
+		t.Errorf("fields[0] = %+v", fields[0])
+	}
+	if fields[1].Field != "Items[0].Role" || fields[1].Rule != "required" {
+		t.Errorf("fields[1] = %+v", fields[1])
+	}
+
+	if fields := ValidationFields(errors.New("unexpected EOF")); fields != nil {
+		t.Errorf("fields of a non-validation error = %+v, want nil", fields)
+	}
+}
@@ -0,0 +1,208 @@
+// Package audit records who did what to which resource. Callers write
+// records through a zap logger whose fields name the action, actor, target,
+// client IP, request ID and the changes made; Core turns each entry into a
+// Record and appends it to a Store, so the audit log file, the in-memory
+// trail and the database all receive the same records.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Record is one audited action. Action, ActorID, Target, TargetID, IP,
+// RequestID and Changes are lifted out of the logged fields; the others
+// stay in Fields.
+type Record struct {
+	ID       int64     `json:"id,omitempty"`
+	Time     time.Time `json:"time"`
+	Action   string    `json:"action"`
+	ActorID  int       `json:"actor_id,omitempty"`
+	Target   string    `json:"target,omitempty"`
+	TargetID int       `json:"target_id"`
+	IP       string    `json:"ip,omitempty"`
+	// RequestID ties the record to the request's log lines
+	RequestID string                 `json:"request_id,omitempty"`
+	Changes   map[string]Change      `json:"changes,omitempty"`
+	Fields    map[string]interface{} `json:"fields,omitempty"`
+}
+
+// Change is the value of one field before and after an update
+type Change struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// Diff returns the top-level JSON fields whose values differ between before
+// and after, which must both encode to JSON objects
+func Diff(before, after interface{}) (map[string]Change, error) {
+	old, err := jsonObject(before)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := jsonObject(after)
+	if err != nil {
+		return nil, err
+	}
+	changes := map[string]Change{}
+	for name, value := range updated {
+		if previous, ok := old[name]; !ok || !reflect.DeepEqual(previous, value) {
+			changes[name] = Change{Before: previous, After: value}
+		}
+	}
+	for name, previous := range old {
+		if _, ok := updated[name]; !ok {
+			changes[name] = Change{Before: previous}
+		}
+	}
+	return changes, nil
+}
+
+func jsonObject(v interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("audit: diff: %w", err)
+	}
+	var object map[string]interface{}
+	if err := json.Unmarshal(data, &object); err != nil {
+		return nil, fmt.Errorf("audit: diff: %w", err)
+	}
+	return object, nil
+}
+
+// Changes returns the field recording what an update changed, the Diff of
+// before and after. A value that cannot be diffed records the error instead,
+// so the action itself is still audited.
+func Changes(before, after interface{}) zap.Field {
+	changes, err := Diff(before, after)
+	if err != nil {
+		return zap.NamedError("changes_error", err)
+	}
+	return zap.Any("changes", changes)
+}
+
+// Query selects records; zero fields match any record
+type Query struct {
+	Action   string
+	ActorID  int
+	TargetID int
+	// Since and Until bound the record time, Until exclusively
+	Since time.Time
+	Until time.Time
+	// Limit caps how many records are returned, zero meaning all
+	Limit int
+}
+
+// Matches reports whether r is selected by q, ignoring Limit
+func (q Query) Matches(r Record) bool {
+	return (q.Action == "" || r.Action == q.Action) &&
+		(q.ActorID == 0 || r.ActorID == q.ActorID) &&
+		(q.TargetID == 0 || r.TargetID == q.TargetID) &&
+		(q.Since.IsZero() || !r.Time.Before(q.Since)) &&
+		(q.Until.IsZero() || r.Time.Before(q.Until))
+}
+
+// Store persists records
+type Store interface {
+	// Append adds r to the store
+	Append(ctx context.Context, r Record) error
+	// Query returns the records matching q, newest first
+	Query(ctx context.Context, q Query) ([]Record, error)
+	// Prune deletes the records older than before and returns how many
+	// it removed
+	Prune(ctx context.Context, before time.Time) (int, error)
+	// Reassign attributes the records whose actor or target is the user
+	// from to the user to instead, as when from is merged into to, and
+	// returns how many it changed
+	Reassign(ctx context.Context, from, to int) (int, error)
+}
+
+// appendTimeout bounds how long a logged record may wait on the store
+const appendTimeout = 5 * time.Second
+
+// Core returns a zap core appending every entry it is given to store. An
+// append that fails is returned to zap, which reports it on the logger's
+// error output.
+func Core(store Store) zapcore.Core {
+	return &core{store: store}
+}
+
+// FromEntry converts a logged entry and its fields into a record
+func FromEntry(entry zapcore.Entry, fields []zapcore.Field) Record {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, field := range fields {
+		field.AddTo(enc)
+	}
+
+	record := Record{Time: entry.Time.UTC(), Fields: enc.Fields}
+	liftString(enc.Fields, "action", &record.Action)
+	liftInt(enc.Fields, "actor_id", &record.ActorID)
+	liftString(enc.Fields, "target", &record.Target)
+	liftInt(enc.Fields, "target_id", &record.TargetID)
+	liftString(enc.Fields, "ip", &record.IP)
+	liftString(enc.Fields, "request_id", &record.RequestID)
+	if changes, ok := enc.Fields["changes"].(map[string]Change); ok {
+		record.Changes = changes
+		delete(enc.Fields, "changes")
+	}
+	if len(record.Fields) == 0 {
+		record.Fields = nil
+	}
+	return record
+}
+
+func liftString(fields map[string]interface{}, key string, dest *string) {
+	if v, ok := fields[key].(string); ok {
+		*dest = v
+		delete(fields, key)
+	}
+}
+
+func liftInt(fields map[string]interface{}, key string, dest *int) {
+	if v, ok := fields[key].(int64); ok {
+		*dest = int(v)
+		delete(fields, key)
+	}
+}
+
+// core is the zapcore.Core behind Core. fields holds those added through
+// With.
+type core struct {
+	store  Store
+	fields []zapcore.Field
+}
+
+func (c *core) Enabled(level zapcore.Level) bool {
+	return level >= zapcore.InfoLevel
+}
+
+func (c *core) With(fields []zapcore.Field) zapcore.Core {
+	return &core{store: c.store, fields: append(c.fields[:len(c.fields):len(c.fields)], fields...)}
+}
+
+func (c *core) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+func (c *core) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	ctx, cancel := context.WithTimeout(context.Background(), appendTimeout)
+	defer cancel()
+	record := FromEntry(entry, append(c.fields[:len(c.fields):len(c.fields)], fields...))
+	if err := c.store.Append(ctx, record); err != nil {
+		return fmt.Errorf("audit: append %s: %w", record.Action, err)
+	}
+	return nil
+}
+
+func (c *core) Sync() error {
+	return nil
+}
@@ -0,0 +1,163 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/cbwinslow/template2/examples/go/internal/models/postgres"
+)
+
+type user struct {
+	Name  string `json:"name"`
+	Role  string `json:"role"`
+	Email string `json:"email,omitempty"`
+}
+
+func TestDiff(t *testing.T) {
+	changes, err := Diff(user{Name: "Ana", Role: "user", Email: "ana@example.com"}, user{Name: "Ana", Role: "admin"})
+	if err != nil {
+		t.Fatalf("Diff: %v", err)
+	}
+	if len(changes) != 2 || changes["role"] != (Change{Before: "user", After: "admin"}) ||
+		changes["email"] != (Change{Before: "ana@example.com"}) {
+		t.Errorf("changes = %+v", changes)
+	}
+
+	if _, err := Diff([]int{1}, user{}); err == nil {
+		t.Error("Diff of a non-object: want an error")
+	}
+}
+
+// recordingStore keeps appended records, failing once err is set
+type recordingStore struct {
+	records []Record
+	err     error
+}
+
+func (s *recordingStore) Append(_ context.Context, r Record) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.records = append(s.records, r)
+	return nil
+}
+
+func (s *recordingStore) Query(context.Context, Query) ([]Record, error) { return s.records, nil }
+
+func (s *recordingStore) Prune(context.Context, time.Time) (int, error) { return 0, nil }
+
+func (s *recordingStore) Reassign(context.Context, int, int) (int, error) { return 0, nil }
+
+func TestCoreLiftsRecordFields(t *testing.T) {
+	store := &recordingStore{}
+	logger := zap.New(Core(store)).With(zap.String("log", "audit"))
+	logger.Info("Audit",
+		zap.String("action", "user.update"),
+		zap.Int("actor_id", 1),
+		zap.Int("target_id", 7),
+		zap.String("ip", "203.0.113.9"),
+		zap.String("request_id", "req-1"),
+		Changes(user{Role: "user"}, user{Role: "admin"}))
+
+	if len(store.records) != 1 {
+		t.Fatalf("records = %d, want 1", len(store.records))
+	}
+	r := store.records[0]
+	if r.Action != "user.update" || r.ActorID != 1 || r.TargetID != 7 || r.IP != "203.0.113.9" || r.RequestID != "req-1" {
+		t.Errorf("record = %+v", r)
+	}
+	if r.Changes["role"] != (Change{Before: "user", After: "admin"}) || len(r.Fields) != 1 || r.Fields["log"] != "audit" {
+		t.Errorf("changes %+v, fields %+v", r.Changes, r.Fields)
+	}
+
+	store.err = errors.New("disk full")
+	if err := Core(store).Write(zapcore.Entry{Time: time.Now()}, nil); err == nil {
+		t.Error("Write with a failing store: want the error")
+	}
+}
+
+func TestQueryMatches(t *testing.T) {
+	at := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	r := Record{Time: at, Action: "user.lock", ActorID: 1, TargetID: 2}
+	tests := []struct {
+		q    Query
+		want bool
+	}{
+		{Query{}, true},
+		{Query{Action: "user.lock", ActorID: 1, TargetID: 2}, true},
+		{Query{Action: "user.unlock"}, false},
+		{Query{Since: at, Until: at.Add(time.Second)}, true},
+		{Query{Until: at}, false},
+		{Query{Since: at.Add(time.Second)}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.q.Matches(r); got != tt.want {
+			t.Errorf("%+v.Matches = %v, want %v", tt.q, got, tt.want)
+		}
+	}
+}
+
+// TestPostgresStore runs against POSTGRES_TEST_DSN, which should point at a
+// disposable database
+func TestPostgresStore(t *testing.T) {
+	dsn := os.Getenv("POSTGRES_TEST_DSN")
+	if dsn == "" {
+		t.Skip("POSTGRES_TEST_DSN not set")
+	}
+	ctx := context.Background()
+	db, err := postgres.Open(ctx, dsn, postgres.PoolConfig{MaxOpenConns: 4})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.ExecContext(ctx, `DROP TABLE IF EXISTS users, audit_log, feature_flags, goose_db_version`); err != nil {
+		t.Fatalf("drop tables: %v", err)
+	}
+	migrator, err := postgres.NewMigrator(db)
+	if err != nil {
+		t.Fatalf("NewMigrator: %v", err)
+	}
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+
+	store := NewPostgresStore(db)
+	now := time.Now().UTC().Truncate(time.Second)
+	old := Record{Time: now.Add(-48 * time.Hour), Action: "user.lock", ActorID: 1, TargetID: 2}
+	recent := Record{Time: now, Action: "user.update", ActorID: 1, TargetID: 2, IP: "203.0.113.9", RequestID: "req-1",
+		Changes: map[string]Change{"role": {Before: "user", After: "admin"}}, Fields: map[string]interface{}{"log": "audit"}}
+	for _, r := range []Record{old, recent} {
+		if err := store.Append(ctx, r); err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+	}
+
+	records, err := store.Query(ctx, Query{TargetID: 2})
+	if err != nil || len(records) != 2 {
+		t.Fatalf("Query = %d records, %v", len(records), err)
+	}
+	if got := records[0]; got.Action != "user.update" || got.RequestID != "req-1" || got.Changes["role"].After != "admin" || got.Fields["log"] != "audit" {
+		t.Errorf("newest record = %+v", got)
+	}
+	if records, _ := store.Query(ctx, Query{Since: now.Add(-time.Hour)}); len(records) != 1 {
+		t.Errorf("records of the last hour = %d, want 1", len(records))
+	}
+
+	if changed, err := store.Reassign(ctx, 2, 7); err != nil || changed != 2 {
+		t.Errorf("Reassign = %d, %v; want both records moved", changed, err)
+	}
+	if records, _ := store.Query(ctx, Query{TargetID: 7, ActorID: 1}); len(records) != 2 {
+		t.Errorf("records about user 7 = %d, want 2", len(records))
+	}
+
+	removed, err := store.Prune(ctx, now.Add(-24*time.Hour))
+	if err != nil || removed != 1 {
+		t.Errorf("Prune = %d, %v; want the old record removed", removed, err)
+	}
+}
@@ -0,0 +1,159 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const recordColumns = `id, occurred_at, action, actor_id, target, target_id, ip, request_id, changes, fields`
+
+// PostgresStore keeps records in the audit_log table, which the migrations
+// in internal/models/postgres create
+type PostgresStore struct {
+	db *sql.DB
+}
+
+// NewPostgresStore creates a store on db
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+// Append implements Store
+func (s *PostgresStore) Append(ctx context.Context, r Record) error {
+	changes, err := nullJSON(r.Changes, len(r.Changes) > 0)
+	if err != nil {
+		return err
+	}
+	fields, err := nullJSON(r.Fields, len(r.Fields) > 0)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `INSERT INTO audit_log (occurred_at, action, actor_id, target, target_id, ip, request_id, changes, fields)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		r.Time, r.Action, r.ActorID, r.Target, r.TargetID, r.IP, r.RequestID, changes, fields)
+	if err != nil {
+		return fmt.Errorf("postgres: %w", err)
+	}
+	return nil
+}
+
+// Query implements Store
+func (s *PostgresStore) Query(ctx context.Context, q Query) ([]Record, error) {
+	var (
+		conds []string
+		args  []interface{}
+	)
+	where := func(cond string, v interface{}) {
+		args = append(args, v)
+		conds = append(conds, cond+" $"+strconv.Itoa(len(args)))
+	}
+	if q.Action != "" {
+		where("action =", q.Action)
+	}
+	if q.ActorID != 0 {
+		where("actor_id =", q.ActorID)
+	}
+	if q.TargetID != 0 {
+		where("target_id =", q.TargetID)
+	}
+	if !q.Since.IsZero() {
+		where("occurred_at >=", q.Since)
+	}
+	if !q.Until.IsZero() {
+		where("occurred_at <", q.Until)
+	}
+	query := `SELECT ` + recordColumns + ` FROM audit_log`
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	query += " ORDER BY occurred_at DESC, id DESC"
+	if q.Limit > 0 {
+		args = append(args, q.Limit)
+		query += " LIMIT $" + strconv.Itoa(len(args))
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("postgres: %w", err)
+	}
+	defer rows.Close()
+
+	records := []Record{}
+	for rows.Next() {
+		var (
+			r               Record
+			changes, fields []byte
+		)
+		if err := rows.Scan(&r.ID, &r.Time, &r.Action, &r.ActorID, &r.Target, &r.TargetID, &r.IP, &r.RequestID, &changes, &fields); err != nil {
+			return nil, fmt.Errorf("postgres: %w", err)
+		}
+		r.Time = r.Time.UTC()
+		if err := unmarshalJSON(changes, &r.Changes); err != nil {
+			return nil, err
+		}
+		if err := unmarshalJSON(fields, &r.Fields); err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("postgres: %w", err)
+	}
+	return records, nil
+}
+
+// Prune implements Store
+func (s *PostgresStore) Prune(ctx context.Context, before time.Time) (int, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM audit_log WHERE occurred_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("postgres: %w", err)
+	}
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("postgres: %w", err)
+	}
+	return int(removed), nil
+}
+
+// Reassign implements Store
+func (s *PostgresStore) Reassign(ctx context.Context, from, to int) (int, error) {
+	result, err := s.db.ExecContext(ctx, `UPDATE audit_log SET
+		actor_id = CASE WHEN actor_id = $1 THEN $2 ELSE actor_id END,
+		target_id = CASE WHEN target_id = $1 THEN $2 ELSE target_id END
+		WHERE actor_id = $1 OR target_id = $1`, from, to)
+	if err != nil {
+		return 0, fmt.Errorf("postgres: %w", err)
+	}
+	changed, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("postgres: %w", err)
+	}
+	return int(changed), nil
+}
+
+// nullJSON encodes v for a JSONB column, or NULL unless set
+func nullJSON(v interface{}, set bool) (interface{}, error) {
+	if !set {
+		return nil, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("audit: encode record: %w", err)
+	}
+	return string(data), nil
+}
+
+func unmarshalJSON(data []byte, v interface{}) error {
+	if data == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("audit: decode record: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,229 @@
+// Package apikey issues and verifies long-lived API keys for machine-to-machine
+// callers. Only a SHA-256 hash of each key is stored; the plaintext is shown
+// to the user once, when the key is created.
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrInvalidKey is returned when a key is malformed, unknown or revoked
+	ErrInvalidKey = errors.New("invalid API key")
+	// ErrKeyNotFound is returned when the user owns no key with the given ID
+	ErrKeyNotFound = errors.New("API key not found")
+)
+
+// keyPrefix starts every key so leaked keys are easy to recognize in code
+// and logs
+const keyPrefix = "tk_"
+
+// Key describes an API key without its secret
+type Key struct {
+	ID         string     `json:"id"`
+	UserID     int        `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// Store persists API keys by the hash of their plaintext
+type Store interface {
+	// Save stores a new key under hash
+	Save(ctx context.Context, hash string, key Key) error
+	// ByHash returns the key stored under hash
+	ByHash(ctx context.Context, hash string) (Key, bool, error)
+	// List returns the user's keys, oldest first
+	List(ctx context.Context, userID int) ([]Key, error)
+	// Delete removes the user's key with the given ID, reporting whether
+	// it existed
+	Delete(ctx context.Context, userID int, id string) (bool, error)
+	// Touch records that the key stored under hash was used at
+	Touch(ctx context.Context, hash string, at time.Time) error
+}
+
+// Service creates, verifies and revokes API keys
+type Service struct {
+	store Store
+	now   func() time.Time
+}
+
+// NewService creates a service keeping keys in store
+func NewService(store Store) *Service {
+	return &Service{store: store, now: time.Now}
+}
+
+// Create issues a key for the user and returns it with its plaintext, which
+// cannot be recovered later
+func (s *Service) Create(ctx context.Context, userID int, name string) (Key, string, error) {
+	id, err := randomBytes(4)
+	if err != nil {
+		return Key{}, "", err
+	}
+	secret, err := randomBytes(32)
+	if err != nil {
+		return Key{}, "", err
+	}
+
+	key := Key{
+		ID:        hex.EncodeToString(id),
+		UserID:    userID,
+		Name:      name,
+		Prefix:    keyPrefix + hex.EncodeToString(id),
+		CreatedAt: s.now().UTC(),
+	}
+	plaintext := key.Prefix + "_" + base64.RawURLEncoding.EncodeToString(secret)
+	if err := s.store.Save(ctx, hashKey(plaintext), key); err != nil {
+		return Key{}, "", fmt.Errorf("apikey: save key: %w", err)
+	}
+	return key, plaintext, nil
+}
+
+// Authenticate returns the key matching plaintext and records its use
+func (s *Service) Authenticate(ctx context.Context, plaintext string) (Key, error) {
+	if !strings.HasPrefix(plaintext, keyPrefix) {
+		return Key{}, ErrInvalidKey
+	}
+
+	hash := hashKey(plaintext)
+	key, ok, err := s.store.ByHash(ctx, hash)
+	if err != nil {
+		return Key{}, fmt.Errorf("apikey: load key: %w", err)
+	}
+	if !ok {
+		return Key{}, ErrInvalidKey
+	}
+
+	if err := s.store.Touch(ctx, hash, s.now().UTC()); err != nil {
+		return Key{}, fmt.Errorf("apikey: record use: %w", err)
+	}
+	return key, nil
+}
+
+// List returns the user's keys
+func (s *Service) List(ctx context.Context, userID int) ([]Key, error) {
+	keys, err := s.store.List(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("apikey: list keys: %w", err)
+	}
+	return keys, nil
+}
+
+// Revoke deletes the user's key, so it fails authentication immediately
+func (s *Service) Revoke(ctx context.Context, userID int, id string) error {
+	ok, err := s.store.Delete(ctx, userID, id)
+	if err != nil {
+		return fmt.Errorf("apikey: delete key: %w", err)
+	}
+	if !ok {
+		return ErrKeyNotFound
+	}
+	return nil
+}
+
+// RevokeAll deletes every key of the user, as when their credentials are
+// revoked or the account goes away
+func (s *Service) RevokeAll(ctx context.Context, userID int) error {
+	keys, err := s.List(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if _, err := s.store.Delete(ctx, userID, key.ID); err != nil {
+			return fmt.Errorf("apikey: delete key: %w", err)
+		}
+	}
+	return nil
+}
+
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("apikey: generate key: %w", err)
+	}
+	return b, nil
+}
+
+func hashKey(plaintext string) string {
+	sum := sha256.Sum256([]byte(plaintext))
+	return hex.EncodeToString(sum[:])
+}
+
+// MemoryStore is the default in-process Store
+type MemoryStore struct {
+	mu   sync.RWMutex
+	keys map[string]Key
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{keys: make(map[string]Key)}
+}
+
+// Save implements Store
+func (m *MemoryStore) Save(ctx context.Context, hash string, key Key) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.keys[hash] = key
+	return nil
+}
+
+// ByHash implements Store
+func (m *MemoryStore) ByHash(ctx context.Context, hash string) (Key, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	key, ok := m.keys[hash]
+	return key, ok, nil
+}
+
+// List implements Store
+func (m *MemoryStore) List(ctx context.Context, userID int) ([]Key, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	keys := []Key{}
+	for _, key := range m.keys {
+		if key.UserID == userID {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.Before(keys[j].CreatedAt) })
+	return keys, nil
+}
+
+// Delete implements Store
+func (m *MemoryStore) Delete(ctx context.Context, userID int, id string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for hash, key := range m.keys {
+		if key.UserID == userID && key.ID == id {
+			delete(m.keys, hash)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Touch implements Store
+func (m *MemoryStore) Touch(ctx context.Context, hash string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if key, ok := m.keys[hash]; ok {
+		key.LastUsedAt = &at
+		m.keys[hash] = key
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package apikey
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestServiceKeyLifecycle(t *testing.T) {
+	ctx := context.Background()
+	svc := NewService(NewMemoryStore())
+
+	key, plaintext, err := svc.Create(ctx, 7, "ci")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if !strings.HasPrefix(plaintext, key.Prefix+"_") {
+		t.Errorf("plaintext %q does not start with prefix %q", plaintext, key.Prefix)
+	}
+
+	got, err := svc.Authenticate(ctx, plaintext)
+	if err != nil || got.ID != key.ID || got.UserID != 7 {
+		t.Fatalf("Authenticate = %+v, %v", got, err)
+	}
+	keys, _ := svc.List(ctx, 7)
+	if len(keys) != 1 || keys[0].LastUsedAt == nil {
+		t.Errorf("List = %+v, want one key with its last use recorded", keys)
+	}
+
+	if _, err := svc.Authenticate(ctx, plaintext+"x"); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("tampered key: err = %v, want ErrInvalidKey", err)
+	}
+	if err := svc.Revoke(ctx, 8, key.ID); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("revoke by another user: err = %v, want ErrKeyNotFound", err)
+	}
+	if err := svc.Revoke(ctx, 7, key.ID); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if _, err := svc.Authenticate(ctx, plaintext); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("revoked key: err = %v, want ErrInvalidKey", err)
+	}
+}
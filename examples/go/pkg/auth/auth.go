@@ -0,0 +1,308 @@
+// Package auth issues and validates the JWTs used to authenticate API clients
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/cbwinslow/template2/examples/go/pkg/events"
+)
+
+var (
+	// ErrInvalidToken is returned when a token is malformed, expired or
+	// signed with a different key
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrTokenRevoked is returned when a token predates a revocation of the
+	// user's tokens
+	ErrTokenRevoked = errors.New("token revoked")
+	// ErrInvalidCredentials is returned when a password does not match
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// dummyHash is what passwords are compared against when there is no stored
+// hash, so that a login for an unknown account takes as long as one with a
+// wrong password
+var dummyHash = sync.OnceValue(func() []byte {
+	hash, err := bcrypt.GenerateFromPassword([]byte("template2"), bcrypt.DefaultCost)
+	if err != nil {
+		panic(fmt.Sprintf("auth: hash dummy password: %v", err))
+	}
+	return hash
+})
+
+// Claims are the JWT claims issued by the service.
+//
+// Version carries the user's token version at issue time. Revoking a user's
+// tokens bumps their version, so every token issued before the revocation
+// fails validation without having to track individual token IDs.
+//
+// SessionID names the session the token was issued in, if any, so revoking
+// one session can deny its tokens without touching the user's others.
+type Claims struct {
+	UserID    int    `json:"user_id"`
+	Email     string `json:"email"`
+	Role      string `json:"role"`
+	Version   int    `json:"ver"`
+	SessionID string `json:"sid,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Option configures an AuthService
+type Option func(*AuthService)
+
+// WithSecret sets the HMAC key used to sign tokens
+func WithSecret(secret []byte) Option {
+	return func(s *AuthService) {
+		s.secret = secret
+	}
+}
+
+// WithTokenTTL sets how long issued access tokens are valid
+func WithTokenTTL(ttl time.Duration) Option {
+	return func(s *AuthService) {
+		s.tokenTTL = ttl
+	}
+}
+
+// WithStore sets where token versions and password hashes are kept
+func WithStore(store Store) Option {
+	return func(s *AuthService) {
+		s.store = store
+	}
+}
+
+// WithStoreRetry makes store operations try up to attempts times, waiting
+// backoff, 2*backoff, ... between tries, so a transient store failure does
+// not fail the request. The default is two attempts 50ms apart.
+func WithStoreRetry(attempts int, backoff time.Duration) Option {
+	return func(s *AuthService) {
+		s.storeAttempts = attempts
+		s.storeBackoff = backoff
+	}
+}
+
+// WithEvents publishes an event to publisher after logins, failed password
+// checks, password resets and token revocations
+func WithEvents(publisher events.Publisher) Option {
+	return func(s *AuthService) {
+		s.events = publisher
+	}
+}
+
+// AuthService issues and validates access tokens
+type AuthService struct {
+	secret   []byte
+	tokenTTL time.Duration
+
+	store         Store
+	storeAttempts int
+	storeBackoff  time.Duration
+
+	refreshTTL   time.Duration
+	refreshGrace time.Duration
+	// refreshMu serializes rotation within this process, not across
+	// replicas sharing the store
+	refreshMu sync.Mutex
+
+	verificationTTL time.Duration
+	resetTTL        time.Duration
+
+	totpIssuer   string
+	challengeTTL time.Duration
+	twoFactorMu  sync.Mutex
+	// challengeFailures is keyed by the hash of a challenge token
+	challengeFailures map[string]challengeFailure
+
+	// events receives an event after security-relevant changes when set
+	events events.Publisher
+}
+
+// NewAuthService creates an auth service. Without WithSecret a random key is
+// generated, so tokens do not survive a restart.
+func NewAuthService(opts ...Option) *AuthService {
+	s := &AuthService{
+		tokenTTL:        15 * time.Minute,
+		store:           NewMemoryStore(),
+		storeAttempts:   2,
+		storeBackoff:    50 * time.Millisecond,
+		refreshTTL:      7 * 24 * time.Hour,
+		refreshGrace:    10 * time.Second,
+		verificationTTL: 24 * time.Hour,
+		resetTTL:        time.Hour,
+		totpIssuer:      "template2",
+		challengeTTL:    5 * time.Minute,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.storeAttempts < 1 {
+		s.storeAttempts = 1
+	}
+
+	if len(s.secret) == 0 {
+		s.secret = make([]byte, 32)
+		if _, err := rand.Read(s.secret); err != nil {
+			panic(fmt.Sprintf("auth: generate signing key: %v", err))
+		}
+	}
+
+	return s
+}
+
+// TokenTTL returns how long issued access tokens are valid
+func (s *AuthService) TokenTTL() time.Duration {
+	return s.tokenTTL
+}
+
+// SetPassword stores a bcrypt hash of password for the user
+func (s *AuthService) SetPassword(ctx context.Context, userID int, password string) (err error) {
+	_, span := tracer.Start(ctx, "AuthService.SetPassword")
+	defer func() { endSpan(span, err) }()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("auth: hash password: %w", err)
+	}
+
+	if err := s.retry(func() error { return s.store.SetPasswordHash(userID, hash) }); err != nil {
+		return fmt.Errorf("auth: store password: %w", err)
+	}
+	return nil
+}
+
+// CheckPassword verifies password against the user's stored hash
+func (s *AuthService) CheckPassword(ctx context.Context, userID int, password string) (err error) {
+	_, span := tracer.Start(ctx, "AuthService.CheckPassword")
+	defer func() { endSpan(span, err) }()
+
+	var (
+		hash []byte
+		ok   bool
+	)
+	err = s.retry(func() (err error) {
+		hash, ok, err = s.store.PasswordHash(userID)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("auth: load password: %w", err)
+	}
+
+	if !ok {
+		hash = dummyHash()
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil || !ok {
+		s.publish(ctx, events.LoginFailed{UserID: userID})
+		return ErrInvalidCredentials
+	}
+	return nil
+}
+
+// RejectPassword compares password against a dummy hash and returns
+// ErrInvalidCredentials. Logins for an email no user has go through it, so
+// they cannot be told apart from wrong passwords by how long they take.
+func (s *AuthService) RejectPassword(ctx context.Context, password string) error {
+	_, span := tracer.Start(ctx, "AuthService.RejectPassword")
+	defer span.End()
+
+	_ = bcrypt.CompareHashAndPassword(dummyHash(), []byte(password))
+	return ErrInvalidCredentials
+}
+
+// GenerateToken issues a signed access token for the user outside of any
+// session
+func (s *AuthService) GenerateToken(ctx context.Context, userID int, email, role string) (string, error) {
+	return s.generateToken(ctx, userID, email, role, "")
+}
+
+func (s *AuthService) generateToken(ctx context.Context, userID int, email, role, sessionID string) (_ string, err error) {
+	_, span := tracer.Start(ctx, "AuthService.GenerateToken")
+	defer func() { endSpan(span, err) }()
+
+	version, err := s.tokenVersion(userID)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims := Claims{
+		UserID:    userID,
+		Email:     email,
+		Role:      role,
+		Version:   version,
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   fmt.Sprint(userID),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.tokenTTL)),
+		},
+	}
+
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.secret)
+}
+
+// ValidateToken parses and verifies a token, returning its claims
+func (s *AuthService) ValidateToken(ctx context.Context, tokenString string) (_ *Claims, err error) {
+	_, span := tracer.Start(ctx, "AuthService.ValidateToken")
+	defer func() { endSpan(span, err) }()
+
+	claims := &Claims{}
+	_, err = jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
+		return s.secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	// Access tokens carry no audience; any token that does was issued for
+	// another purpose, such as email verification
+	if len(claims.Audience) > 0 {
+		return nil, fmt.Errorf("%w: not an access token", ErrInvalidToken)
+	}
+
+	version, err := s.tokenVersion(claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Version != version {
+		return nil, ErrTokenRevoked
+	}
+
+	return claims, nil
+}
+
+// RevokeUserTokens invalidates every token previously issued to the user
+func (s *AuthService) RevokeUserTokens(ctx context.Context, userID int) (err error) {
+	_, span := tracer.Start(ctx, "AuthService.RevokeUserTokens")
+	defer func() { endSpan(span, err) }()
+
+	if err := s.retry(func() error { return s.store.BumpTokenVersion(userID) }); err != nil {
+		return fmt.Errorf("auth: revoke tokens: %w", err)
+	}
+	s.publish(ctx, events.TokensRevoked{UserID: userID})
+	return nil
+}
+
+// publish publishes e if the service has a publisher
+func (s *AuthService) publish(ctx context.Context, e events.Event) {
+	if s.events != nil {
+		s.events.Publish(ctx, e)
+	}
+}
+
+func (s *AuthService) tokenVersion(userID int) (int, error) {
+	var version int
+	err := s.retry(func() (err error) {
+		version, err = s.store.TokenVersion(userID)
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("auth: load token version: %w", err)
+	}
+	return version, nil
+}
@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/cbwinslow/template2/examples/go/pkg/events"
+)
+
+func TestValidateTokenRoundTrip(t *testing.T) {
+	svc := NewAuthService(WithSecret([]byte("test-secret")))
+
+	token, err := svc.GenerateToken(context.Background(), 7, "eve@example.com", "user")
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+
+	claims, err := svc.ValidateToken(context.Background(), token)
+	if err != nil {
+		t.Fatalf("ValidateToken: %v", err)
+	}
+	if claims.UserID != 7 || claims.Email != "eve@example.com" || claims.Role != "user" {
+		t.Errorf("unexpected claims %+v", claims)
+	}
+}
+
+func TestRevokeUserTokensRejectsEarlierTokens(t *testing.T) {
+	svc := NewAuthService(WithSecret([]byte("test-secret")))
+
+	token, _ := svc.GenerateToken(context.Background(), 7, "eve@example.com", "user")
+	other, _ := svc.GenerateToken(context.Background(), 8, "frank@example.com", "user")
+	if err := svc.RevokeUserTokens(context.Background(), 7); err != nil {
+		t.Fatalf("RevokeUserTokens: %v", err)
+	}
+
+	if _, err := svc.ValidateToken(context.Background(), token); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("revoked token err = %v, want ErrTokenRevoked", err)
+	}
+	if _, err := svc.ValidateToken(context.Background(), other); err != nil {
+		t.Errorf("other user's token rejected: %v", err)
+	}
+
+	fresh, _ := svc.GenerateToken(context.Background(), 7, "eve@example.com", "user")
+	if _, err := svc.ValidateToken(context.Background(), fresh); err != nil {
+		t.Errorf("token issued after revocation rejected: %v", err)
+	}
+}
+
+func TestValidateTokenRejectsForeignSignature(t *testing.T) {
+	token, _ := NewAuthService(WithSecret([]byte("one"))).GenerateToken(context.Background(), 1, "a@example.com", "user")
+
+	if _, err := NewAuthService(WithSecret([]byte("two"))).ValidateToken(context.Background(), token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("err = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestCheckPassword(t *testing.T) {
+	svc := NewAuthService()
+	if err := svc.SetPassword(context.Background(), 3, "correct horse"); err != nil {
+		t.Fatalf("SetPassword: %v", err)
+	}
+
+	if err := svc.CheckPassword(context.Background(), 3, "correct horse"); err != nil {
+		t.Errorf("correct password rejected: %v", err)
+	}
+	if err := svc.CheckPassword(context.Background(), 3, "battery staple"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("wrong password err = %v, want ErrInvalidCredentials", err)
+	}
+	if err := svc.CheckPassword(context.Background(), 4, "correct horse"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("unknown user err = %v, want ErrInvalidCredentials", err)
+	}
+	// The dummy hash compared against for users without one must not let
+	// its password in
+	if err := svc.CheckPassword(context.Background(), 4, "template2"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("unknown user with the dummy password err = %v, want ErrInvalidCredentials", err)
+	}
+}
+
+func TestRejectPassword(t *testing.T) {
+	svc := NewAuthService()
+	for _, password := range []string{"correct horse", "template2"} {
+		if err := svc.RejectPassword(context.Background(), password); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("RejectPassword(%q) = %v, want ErrInvalidCredentials", password, err)
+		}
+	}
+}
+
+func TestAuthServicePublishesEvents(t *testing.T) {
+	bus := events.NewBus(zap.NewNop())
+	var got []events.Event
+	bus.Subscribe(events.All, func(_ context.Context, e events.Event) error {
+		got = append(got, e)
+		return nil
+	})
+	svc := NewAuthService(WithEvents(bus))
+	ctx := context.Background()
+
+	if err := svc.SetPassword(ctx, 7, "s3cret-pass"); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.CheckPassword(ctx, 7, "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("CheckPassword = %v, want ErrInvalidCredentials", err)
+	}
+	if _, err := svc.IssueTokenPair(ctx, 7, "eve@example.com", "user"); err != nil {
+		t.Fatal(err)
+	}
+	sessions, err := svc.Sessions(ctx, 7)
+	if err != nil || len(sessions) != 1 {
+		t.Fatalf("sessions = %+v, %v", sessions, err)
+	}
+	if err := svc.RevokeUserTokens(ctx, 7); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []events.Event{
+		events.LoginFailed{UserID: 7},
+		events.LoginSucceeded{UserID: 7, SessionID: sessions[0].ID},
+		events.TokensRevoked{UserID: 7},
+	}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+		t.Errorf("published %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,40 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// DeleteExpiredTokens removes refresh and reset tokens and session denials
+// that can no longer be used, returning how many were removed. Expired
+// entries are already refused; this only keeps the store from growing.
+func (s *AuthService) DeleteExpiredTokens(ctx context.Context) (removed int, err error) {
+	_, span := tracer.Start(ctx, "AuthService.DeleteExpiredTokens")
+	defer func() { endSpan(span, err) }()
+
+	err = s.retry(func() (err error) {
+		removed, err = s.store.DeleteExpiredTokens(time.Now())
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("auth: delete expired tokens: %w", err)
+	}
+	return removed, nil
+}
+
+// DeleteExpiredSessions removes sessions whose refresh tokens have expired,
+// returning how many were removed
+func (s *AuthService) DeleteExpiredSessions(ctx context.Context) (removed int, err error) {
+	_, span := tracer.Start(ctx, "AuthService.DeleteExpiredSessions")
+	defer func() { endSpan(span, err) }()
+
+	err = s.retry(func() (err error) {
+		removed, err = s.store.DeleteExpiredSessions(time.Now())
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("auth: delete expired sessions: %w", err)
+	}
+	return removed, nil
+}
@@ -0,0 +1,265 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/github"
+)
+
+var (
+	// ErrUnknownProvider is returned when a login names a provider that is
+	// not configured
+	ErrUnknownProvider = errors.New("unknown identity provider")
+	// ErrInvalidState is returned when a callback's state is unknown,
+	// expired or already used
+	ErrInvalidState = errors.New("invalid or expired login state")
+	// ErrEmailUnverified is returned when the provider does not vouch for
+	// the user's email address
+	ErrEmailUnverified = errors.New("email address not verified by provider")
+)
+
+// GoogleIssuer is the OIDC issuer for Google accounts
+const GoogleIssuer = "https://accounts.google.com"
+
+// ProviderConfig describes an OAuth2 client registered with a provider
+type ProviderConfig struct {
+	// Name identifies the provider in login requests, e.g. "google"
+	Name string
+	// Issuer is the OIDC issuer URL; discovery runs against it
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	// Scopes are requested in addition to the provider's defaults
+	Scopes []string
+}
+
+// ExternalIdentity is the user as described by an identity provider
+type ExternalIdentity struct {
+	Provider string
+	Subject  string
+	Email    string
+	Name     string
+}
+
+// Provider runs the authorization code flow against one identity provider
+type Provider struct {
+	name     string
+	oauth    oauth2.Config
+	identify func(ctx context.Context, token *oauth2.Token, nonce string) (ExternalIdentity, error)
+}
+
+// NewOIDCProvider discovers an OpenID Connect issuer, such as GoogleIssuer,
+// and verifies the ID tokens it returns
+func NewOIDCProvider(ctx context.Context, cfg ProviderConfig) (*Provider, error) {
+	discovered, err := oidc.NewProvider(ctx, cfg.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("auth: discover %s: %w", cfg.Name, err)
+	}
+	verifier := discovered.Verifier(&oidc.Config{ClientID: cfg.ClientID})
+
+	p := &Provider{
+		name: cfg.Name,
+		oauth: oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+			Endpoint:     discovered.Endpoint(),
+			Scopes:       append([]string{oidc.ScopeOpenID, "email", "profile"}, cfg.Scopes...),
+		},
+	}
+	p.identify = func(ctx context.Context, token *oauth2.Token, nonce string) (ExternalIdentity, error) {
+		raw, ok := token.Extra("id_token").(string)
+		if !ok {
+			return ExternalIdentity{}, fmt.Errorf("auth: %s returned no ID token", p.name)
+		}
+		idToken, err := verifier.Verify(ctx, raw)
+		if err != nil {
+			return ExternalIdentity{}, fmt.Errorf("auth: verify %s ID token: %w", p.name, err)
+		}
+		if idToken.Nonce != nonce {
+			return ExternalIdentity{}, fmt.Errorf("auth: %s ID token nonce mismatch", p.name)
+		}
+
+		var claims struct {
+			Email         string `json:"email"`
+			EmailVerified *bool  `json:"email_verified"`
+			Name          string `json:"name"`
+		}
+		if err := idToken.Claims(&claims); err != nil {
+			return ExternalIdentity{}, fmt.Errorf("auth: decode %s claims: %w", p.name, err)
+		}
+		if claims.Email == "" || claims.EmailVerified == nil || !*claims.EmailVerified {
+			return ExternalIdentity{}, ErrEmailUnverified
+		}
+		return ExternalIdentity{Provider: p.name, Subject: idToken.Subject, Email: claims.Email, Name: claims.Name}, nil
+	}
+	return p, nil
+}
+
+// NewGitHubProvider signs users in with GitHub, which speaks plain OAuth2
+// rather than OIDC; the identity comes from the user and email APIs.
+// apiURL is normally "https://api.github.com".
+func NewGitHubProvider(cfg ProviderConfig, apiURL string) *Provider {
+	p := &Provider{
+		name: cfg.Name,
+		oauth: oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+			Endpoint:     github.Endpoint,
+			Scopes:       append([]string{"read:user", "user:email"}, cfg.Scopes...),
+		},
+	}
+	p.identify = func(ctx context.Context, token *oauth2.Token, _ string) (ExternalIdentity, error) {
+		client := p.oauth.Client(ctx, token)
+
+		var user struct {
+			ID    int64  `json:"id"`
+			Login string `json:"login"`
+			Name  string `json:"name"`
+		}
+		if err := getJSON(ctx, client, apiURL+"/user", &user); err != nil {
+			return ExternalIdentity{}, fmt.Errorf("auth: github user: %w", err)
+		}
+
+		var emails []struct {
+			Email    string `json:"email"`
+			Primary  bool   `json:"primary"`
+			Verified bool   `json:"verified"`
+		}
+		if err := getJSON(ctx, client, apiURL+"/user/emails", &emails); err != nil {
+			return ExternalIdentity{}, fmt.Errorf("auth: github emails: %w", err)
+		}
+
+		identity := ExternalIdentity{Provider: p.name, Subject: strconv.FormatInt(user.ID, 10), Name: user.Name}
+		if identity.Name == "" {
+			identity.Name = user.Login
+		}
+		for _, email := range emails {
+			if email.Primary && email.Verified {
+				identity.Email = email.Email
+			}
+		}
+		if identity.Email == "" {
+			return ExternalIdentity{}, ErrEmailUnverified
+		}
+		return identity, nil
+	}
+	return p
+}
+
+// Name returns the name the provider is selected by
+func (p *Provider) Name() string {
+	return p.name
+}
+
+func getJSON(ctx context.Context, client *http.Client, url string, dst interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: status %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(dst)
+}
+
+// pendingLogin is a login started by Begin and not yet completed
+type pendingLogin struct {
+	provider *Provider
+	nonce    string
+	verifier string
+	expires  time.Time
+}
+
+// OIDCClient tracks authorization code logins across a set of providers.
+// Each login's state, nonce and PKCE verifier are kept in memory until its
+// callback arrives or it expires, so a callback must reach the instance that
+// started the login.
+type OIDCClient struct {
+	providers map[string]*Provider
+	ttl       time.Duration
+	now       func() time.Time
+
+	mu      sync.Mutex
+	pending map[string]pendingLogin
+}
+
+// NewOIDCClient creates a client for providers; logins not completed within
+// ten minutes expire
+func NewOIDCClient(providers ...*Provider) *OIDCClient {
+	c := &OIDCClient{
+		providers: make(map[string]*Provider, len(providers)),
+		ttl:       10 * time.Minute,
+		now:       time.Now,
+		pending:   make(map[string]pendingLogin),
+	}
+	for _, p := range providers {
+		c.providers[p.name] = p
+	}
+	return c
+}
+
+// Begin starts a login with the named provider and returns the state to
+// bind to the browser and the URL to redirect it to
+func (c *OIDCClient) Begin(provider string) (state, redirectURL string, err error) {
+	p, ok := c.providers[provider]
+	if !ok {
+		return "", "", ErrUnknownProvider
+	}
+
+	if state, err = randomToken(); err != nil {
+		return "", "", err
+	}
+	nonce, err := randomToken()
+	if err != nil {
+		return "", "", err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	now := c.now()
+	c.mu.Lock()
+	for key, login := range c.pending {
+		if now.After(login.expires) {
+			delete(c.pending, key)
+		}
+	}
+	c.pending[state] = pendingLogin{provider: p, nonce: nonce, verifier: verifier, expires: now.Add(c.ttl)}
+	c.mu.Unlock()
+
+	return state, p.oauth.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)), nil
+}
+
+// Complete finishes the login identified by state by exchanging code for
+// the user's identity. Each state can be completed once.
+func (c *OIDCClient) Complete(ctx context.Context, state, code string) (ExternalIdentity, error) {
+	c.mu.Lock()
+	login, ok := c.pending[state]
+	delete(c.pending, state)
+	c.mu.Unlock()
+	if !ok || c.now().After(login.expires) {
+		return ExternalIdentity{}, ErrInvalidState
+	}
+
+	token, err := login.provider.oauth.Exchange(ctx, code, oauth2.VerifierOption(login.verifier))
+	if err != nil {
+		return ExternalIdentity{}, fmt.Errorf("auth: %s code exchange: %w", login.provider.name, err)
+	}
+	return login.provider.identify(ctx, token, login.nonce)
+}
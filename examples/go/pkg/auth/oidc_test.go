@@ -0,0 +1,157 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// fakeIssuer is a minimal OIDC provider issuing ID tokens for one user
+type fakeIssuer struct {
+	*httptest.Server
+	key       *rsa.PrivateKey
+	nonce     string
+	challenge string
+	verified  bool
+}
+
+func newFakeIssuer(t *testing.T) *fakeIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	f := &fakeIssuer{key: key, verified: true}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                f.URL,
+			"authorization_endpoint":                f.URL + "/authorize",
+			"token_endpoint":                        f.URL + "/token",
+			"jwks_uri":                              f.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA", "kid": "test", "alg": "RS256", "use": "sig",
+			"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		sum := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+		if r.FormValue("code") != "good-code" || base64.RawURLEncoding.EncodeToString(sum[:]) != f.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+
+		idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"iss": f.URL, "aud": "client-id", "sub": "user-42",
+			"exp": time.Now().Add(time.Minute).Unix(), "iat": time.Now().Unix(),
+			"nonce": f.nonce, "email": "zoe@example.com", "email_verified": f.verified, "name": "Zoe",
+		})
+		idToken.Header["kid"] = "test"
+		signed, err := idToken.SignedString(key)
+		if err != nil {
+			t.Errorf("sign ID token: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "provider-token", "token_type": "Bearer", "expires_in": 60, "id_token": signed,
+		})
+	})
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+	return f
+}
+
+// authorize plays the browser: it follows the redirect URL and records the
+// nonce and PKCE challenge the provider would remember
+func (f *fakeIssuer) authorize(t *testing.T, redirectURL string) {
+	t.Helper()
+	u, err := url.Parse(redirectURL)
+	if err != nil {
+		t.Fatalf("parse redirect: %v", err)
+	}
+	f.nonce = u.Query().Get("nonce")
+	f.challenge = u.Query().Get("code_challenge")
+	if u.Query().Get("code_challenge_method") != "S256" {
+		t.Errorf("redirect %s does not use PKCE S256", redirectURL)
+	}
+}
+
+func newTestOIDCClient(t *testing.T, issuer *fakeIssuer) *OIDCClient {
+	t.Helper()
+	provider, err := NewOIDCProvider(context.Background(), ProviderConfig{
+		Name: "corp", Issuer: issuer.URL, ClientID: "client-id", ClientSecret: "secret",
+		RedirectURL: "https://api.example.com/auth/oidc/callback",
+	})
+	if err != nil {
+		t.Fatalf("NewOIDCProvider: %v", err)
+	}
+	return NewOIDCClient(provider)
+}
+
+func TestOIDCClientCompletesLogin(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	client := newTestOIDCClient(t, issuer)
+
+	state, redirect, err := client.Begin("corp")
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	issuer.authorize(t, redirect)
+
+	identity, err := client.Complete(context.Background(), state, "good-code")
+	if err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	want := ExternalIdentity{Provider: "corp", Subject: "user-42", Email: "zoe@example.com", Name: "Zoe"}
+	if identity != want {
+		t.Errorf("identity = %+v, want %+v", identity, want)
+	}
+
+	if _, err := client.Complete(context.Background(), state, "good-code"); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("replayed state: err = %v, want ErrInvalidState", err)
+	}
+}
+
+func TestOIDCClientRejectsBadLogins(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	client := newTestOIDCClient(t, issuer)
+
+	if _, _, err := client.Begin("nope"); !errors.Is(err, ErrUnknownProvider) {
+		t.Errorf("unknown provider: err = %v, want ErrUnknownProvider", err)
+	}
+	if _, err := client.Complete(context.Background(), "forged", "good-code"); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("forged state: err = %v, want ErrInvalidState", err)
+	}
+
+	state, redirect, _ := client.Begin("corp")
+	issuer.authorize(t, redirect)
+	issuer.verified = false
+	if _, err := client.Complete(context.Background(), state, "good-code"); !errors.Is(err, ErrEmailUnverified) {
+		t.Errorf("unverified email: err = %v, want ErrEmailUnverified", err)
+	}
+
+	state, _, _ = client.Begin("corp")
+	client.now = func() time.Time { return time.Now().Add(11 * time.Minute) }
+	if _, err := client.Complete(context.Background(), state, "good-code"); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("expired login: err = %v, want ErrInvalidState", err)
+	}
+}
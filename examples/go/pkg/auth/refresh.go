@@ -0,0 +1,245 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cbwinslow/template2/examples/go/pkg/events"
+)
+
+// ErrRefreshReused is returned when a refresh token that was already rotated
+// is presented again after the grace window. The whole rotation family is
+// revoked, since a replayed token usually means it leaked.
+var ErrRefreshReused = errors.New("refresh token reused")
+
+// TokenPair is an access token together with the refresh token that replaces
+// it once it expires
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    time.Duration
+}
+
+// RefreshRecord is the stored state of a refresh token, keyed by the token's
+// SHA-256 hash.
+//
+// Family links every token descended from the same login, so reuse of any of
+// them can revoke the rest. Successor is set on rotation to the hash of the
+// token that replaced this one; like the key, it never holds a usable token.
+type RefreshRecord struct {
+	UserID    int
+	Email     string
+	Role      string
+	Version   int
+	Family    string
+	ExpiresAt time.Time
+	RotatedAt time.Time
+	Successor string
+}
+
+// WithRefreshTTL sets how long issued refresh tokens are valid
+func WithRefreshTTL(ttl time.Duration) Option {
+	return func(s *AuthService) {
+		s.refreshTTL = ttl
+	}
+}
+
+// WithRefreshGrace sets how long after rotation a refresh token may be
+// presented again and still receive a new pair in its family. This lets a
+// client that fires two refreshes at once with the same token end up with
+// valid pairs instead of tripping reuse detection. The default is 10
+// seconds.
+func WithRefreshGrace(grace time.Duration) Option {
+	return func(s *AuthService) {
+		s.refreshGrace = grace
+	}
+}
+
+// IssueTokenPair issues an access token and a refresh token starting a new
+// rotation family, which is recorded as a new session
+func (s *AuthService) IssueTokenPair(ctx context.Context, userID int, email, role string, opts ...SessionOption) (_ TokenPair, err error) {
+	ctx, span := tracer.Start(ctx, "AuthService.IssueTokenPair")
+	defer func() { endSpan(span, err) }()
+
+	family, err := randomToken()
+	if err != nil {
+		return TokenPair{}, err
+	}
+	version, err := s.tokenVersion(userID)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	if err := s.touchSession(RefreshRecord{UserID: userID, Version: version, Family: family}, opts...); err != nil {
+		return TokenPair{}, err
+	}
+
+	pair, err := s.issuePair(ctx, RefreshRecord{
+		UserID:  userID,
+		Email:   email,
+		Role:    role,
+		Version: version,
+		Family:  family,
+	})
+	if err != nil {
+		return TokenPair{}, err
+	}
+	s.publish(ctx, events.LoginSucceeded{UserID: userID, SessionID: family})
+	return pair, nil
+}
+
+// Refresh exchanges a refresh token for a new pair and retires the presented
+// token. A retired token presented again while the grace window lasts
+// receives another pair in the same family, as the successor cannot be
+// recovered from its stored hash. The token's session is marked as seen.
+//
+// Rotation is serialized by a lock held in this process only. Replicas
+// sharing a store may rotate the same token at once, each issuing a
+// successor; both belong to the family, so reuse detection and logout still
+// reach them.
+func (s *AuthService) Refresh(ctx context.Context, refreshToken string, opts ...SessionOption) (_ TokenPair, err error) {
+	ctx, span := tracer.Start(ctx, "AuthService.Refresh")
+	defer func() { endSpan(span, err) }()
+
+	s.refreshMu.Lock()
+	defer s.refreshMu.Unlock()
+
+	key := hashToken(refreshToken)
+	var (
+		record RefreshRecord
+		ok     bool
+	)
+	err = s.retry(func() (err error) {
+		record, ok, err = s.store.RefreshToken(key)
+		return err
+	})
+	if err != nil {
+		return TokenPair{}, fmt.Errorf("auth: load refresh token: %w", err)
+	}
+	if !ok || !time.Now().Before(record.ExpiresAt) {
+		return TokenPair{}, ErrInvalidToken
+	}
+
+	version, err := s.tokenVersion(record.UserID)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	if record.Version != version {
+		return TokenPair{}, ErrTokenRevoked
+	}
+
+	if !record.RotatedAt.IsZero() {
+		if record.Successor == "" || time.Since(record.RotatedAt) > s.refreshGrace {
+			if err := s.retry(func() error { return s.store.DeleteRefreshFamily(record.Family) }); err != nil {
+				return TokenPair{}, fmt.Errorf("auth: revoke refresh family: %w", err)
+			}
+			if err := s.endSession(record.Family); err != nil {
+				return TokenPair{}, err
+			}
+			return TokenPair{}, ErrRefreshReused
+		}
+
+		return s.issuePair(ctx, RefreshRecord{
+			UserID:  record.UserID,
+			Email:   record.Email,
+			Role:    record.Role,
+			Version: record.Version,
+			Family:  record.Family,
+		})
+	}
+
+	if err := s.touchSession(record, opts...); err != nil {
+		return TokenPair{}, err
+	}
+	pair, err := s.issuePair(ctx, RefreshRecord{
+		UserID:  record.UserID,
+		Email:   record.Email,
+		Role:    record.Role,
+		Version: record.Version,
+		Family:  record.Family,
+	})
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	record.RotatedAt = time.Now()
+	record.Successor = hashToken(pair.RefreshToken)
+	if err := s.retry(func() error { return s.store.SaveRefreshToken(key, record) }); err != nil {
+		return TokenPair{}, fmt.Errorf("auth: retire refresh token: %w", err)
+	}
+	return pair, nil
+}
+
+// RevokeRefreshToken ends the session a refresh token belongs to by deleting
+// its whole rotation family and denying its access tokens. Unknown tokens are
+// ignored, so logging out twice succeeds.
+func (s *AuthService) RevokeRefreshToken(ctx context.Context, refreshToken string) (err error) {
+	_, span := tracer.Start(ctx, "AuthService.RevokeRefreshToken")
+	defer func() { endSpan(span, err) }()
+
+	s.refreshMu.Lock()
+	defer s.refreshMu.Unlock()
+
+	key := hashToken(refreshToken)
+	var (
+		record RefreshRecord
+		ok     bool
+	)
+	err = s.retry(func() (err error) {
+		record, ok, err = s.store.RefreshToken(key)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("auth: load refresh token: %w", err)
+	}
+	if !ok {
+		return nil
+	}
+
+	if err := s.retry(func() error { return s.store.DeleteRefreshFamily(record.Family) }); err != nil {
+		return fmt.Errorf("auth: revoke refresh family: %w", err)
+	}
+	return s.endSession(record.Family)
+}
+
+// RefreshTTL returns how long issued refresh tokens are valid
+func (s *AuthService) RefreshTTL() time.Duration {
+	return s.refreshTTL
+}
+
+func (s *AuthService) issuePair(ctx context.Context, record RefreshRecord) (TokenPair, error) {
+	access, err := s.generateToken(ctx, record.UserID, record.Email, record.Role, record.Family)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	refresh, err := randomToken()
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	record.ExpiresAt = time.Now().Add(s.refreshTTL)
+	key := hashToken(refresh)
+	if err := s.retry(func() error { return s.store.SaveRefreshToken(key, record) }); err != nil {
+		return TokenPair{}, fmt.Errorf("auth: store refresh token: %w", err)
+	}
+
+	return TokenPair{AccessToken: access, RefreshToken: refresh, ExpiresIn: s.tokenTTL}, nil
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("auth: generate random token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConcurrentRefreshReturnsUsablePair(t *testing.T) {
+	s := NewAuthService(WithSecret([]byte("test-secret")))
+	pair, err := s.IssueTokenPair(context.Background(), 1, "a@example.com", "user")
+	if err != nil {
+		t.Fatalf("IssueTokenPair: %v", err)
+	}
+
+	const clients = 2
+	var (
+		wg      sync.WaitGroup
+		results [clients]TokenPair
+		errs    [clients]error
+	)
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = s.Refresh(context.Background(), pair.RefreshToken)
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < clients; i++ {
+		if errs[i] != nil {
+			t.Fatalf("refresh %d: %v", i, errs[i])
+		}
+		if _, err := s.ValidateToken(context.Background(), results[i].AccessToken); err != nil {
+			t.Errorf("refresh %d access token: %v", i, err)
+		}
+	}
+	if results[0].RefreshToken == results[1].RefreshToken {
+		t.Fatal("concurrent refreshes received the same refresh token")
+	}
+
+	for i := 0; i < clients; i++ {
+		if _, err := s.Refresh(context.Background(), results[i].RefreshToken); err != nil {
+			t.Fatalf("refresh token %d rejected: %v", i, err)
+		}
+	}
+}
+
+func TestRefreshStoresSuccessorHash(t *testing.T) {
+	s := NewAuthService(WithSecret([]byte("test-secret")))
+	pair, err := s.IssueTokenPair(context.Background(), 1, "a@example.com", "user")
+	if err != nil {
+		t.Fatalf("IssueTokenPair: %v", err)
+	}
+	next, err := s.Refresh(context.Background(), pair.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+
+	record, ok, err := s.store.RefreshToken(hashToken(pair.RefreshToken))
+	if err != nil || !ok {
+		t.Fatalf("retired record: ok = %v, err = %v", ok, err)
+	}
+	if record.Successor != hashToken(next.RefreshToken) {
+		t.Errorf("Successor = %q, want the successor's hash", record.Successor)
+	}
+}
+
+func TestRefreshReuseAfterGraceRevokesFamily(t *testing.T) {
+	s := NewAuthService(WithSecret([]byte("test-secret")), WithRefreshGrace(0))
+	pair, err := s.IssueTokenPair(context.Background(), 1, "a@example.com", "user")
+	if err != nil {
+		t.Fatalf("IssueTokenPair: %v", err)
+	}
+	next, err := s.Refresh(context.Background(), pair.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+
+	time.Sleep(time.Millisecond)
+	if _, err := s.Refresh(context.Background(), pair.RefreshToken); !errors.Is(err, ErrRefreshReused) {
+		t.Fatalf("reused token: err = %v, want ErrRefreshReused", err)
+	}
+	if _, err := s.Refresh(context.Background(), next.RefreshToken); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("successor after reuse: err = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestRefreshRejectedAfterRevocation(t *testing.T) {
+	s := NewAuthService(WithSecret([]byte("test-secret")))
+	pair, err := s.IssueTokenPair(context.Background(), 1, "a@example.com", "user")
+	if err != nil {
+		t.Fatalf("IssueTokenPair: %v", err)
+	}
+	if err := s.RevokeUserTokens(context.Background(), 1); err != nil {
+		t.Fatalf("RevokeUserTokens: %v", err)
+	}
+
+	if _, err := s.Refresh(context.Background(), pair.RefreshToken); !errors.Is(err, ErrTokenRevoked) {
+		t.Fatalf("err = %v, want ErrTokenRevoked", err)
+	}
+}
+
+func TestRevokeRefreshTokenEndsSession(t *testing.T) {
+	s := NewAuthService(WithSecret([]byte("test-secret")))
+	pair, err := s.IssueTokenPair(context.Background(), 1, "a@example.com", "user")
+	if err != nil {
+		t.Fatalf("IssueTokenPair: %v", err)
+	}
+	next, err := s.Refresh(context.Background(), pair.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+
+	if err := s.RevokeRefreshToken(context.Background(), pair.RefreshToken); err != nil {
+		t.Fatalf("RevokeRefreshToken: %v", err)
+	}
+	if _, err := s.Refresh(context.Background(), next.RefreshToken); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("successor after revocation: err = %v, want ErrInvalidToken", err)
+	}
+	if err := s.RevokeRefreshToken(context.Background(), pair.RefreshToken); err != nil {
+		t.Errorf("second revocation: %v", err)
+	}
+}
@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/cbwinslow/template2/examples/go/pkg/events"
+)
+
+// ResetRecord is the stored state of a password reset token, keyed by the
+// token's SHA-256 hash. Version is the user's token version at issue time,
+// so a completed reset, which bumps the version, also voids every other
+// reset token the user requested.
+type ResetRecord struct {
+	UserID    int
+	Version   int
+	ExpiresAt time.Time
+}
+
+// WithResetTTL sets how long password reset tokens are valid
+func WithResetTTL(ttl time.Duration) Option {
+	return func(s *AuthService) {
+		s.resetTTL = ttl
+	}
+}
+
+// IssueResetToken creates a single-use token that lets whoever holds it set
+// a new password for the user
+func (s *AuthService) IssueResetToken(ctx context.Context, userID int) (_ string, err error) {
+	_, span := tracer.Start(ctx, "AuthService.IssueResetToken")
+	defer func() { endSpan(span, err) }()
+
+	version, err := s.tokenVersion(userID)
+	if err != nil {
+		return "", err
+	}
+	token, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	record := ResetRecord{UserID: userID, Version: version, ExpiresAt: time.Now().Add(s.resetTTL)}
+	if err := s.retry(func() error { return s.store.SaveResetToken(hashToken(token), record) }); err != nil {
+		return "", fmt.Errorf("auth: store reset token: %w", err)
+	}
+	return token, nil
+}
+
+// ForcePasswordReset replaces the user's password with a random one nobody
+// knows and revokes every token issued to the user, including earlier reset
+// tokens. It returns a fresh reset token, the only way back into the
+// account.
+func (s *AuthService) ForcePasswordReset(ctx context.Context, userID int) (_ string, err error) {
+	ctx, span := tracer.Start(ctx, "AuthService.ForcePasswordReset")
+	defer func() { endSpan(span, err) }()
+
+	password, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	if err := s.SetPassword(ctx, userID, password); err != nil {
+		return "", err
+	}
+	if err := s.RevokeUserTokens(ctx, userID); err != nil {
+		return "", err
+	}
+	return s.IssueResetToken(ctx, userID)
+}
+
+// ResetPassword consumes a token from IssueResetToken and sets password as
+// the user's new password. Every access and refresh token issued to the user
+// before the reset stops working. It returns the user whose password changed.
+func (s *AuthService) ResetPassword(ctx context.Context, token, password string) (_ int, err error) {
+	ctx, span := tracer.Start(ctx, "AuthService.ResetPassword")
+	defer func() { endSpan(span, err) }()
+
+	var (
+		record ResetRecord
+		ok     bool
+	)
+	err = s.retry(func() (err error) {
+		record, ok, err = s.store.TakeResetToken(hashToken(token))
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("auth: load reset token: %w", err)
+	}
+	if !ok || !time.Now().Before(record.ExpiresAt) {
+		return 0, ErrInvalidToken
+	}
+	version, err := s.tokenVersion(record.UserID)
+	if err != nil {
+		return 0, err
+	}
+	if record.Version != version {
+		return 0, ErrTokenRevoked
+	}
+
+	if err := s.SetPassword(ctx, record.UserID, password); err != nil {
+		return 0, err
+	}
+	if err := s.RevokeUserTokens(ctx, record.UserID); err != nil {
+		return 0, err
+	}
+	s.publish(ctx, events.PasswordReset{UserID: record.UserID})
+	return record.UserID, nil
+}
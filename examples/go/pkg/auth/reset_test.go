@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestResetPasswordIsSingleUseAndEndsSessions(t *testing.T) {
+	ctx := context.Background()
+	svc := NewAuthService()
+	svc.SetPassword(ctx, 7, "old-password")
+	pair, _ := svc.IssueTokenPair(ctx, 7, "eve@example.com", "user")
+	token, err := svc.IssueResetToken(ctx, 7)
+	if err != nil {
+		t.Fatalf("IssueResetToken: %v", err)
+	}
+	other, _ := svc.IssueResetToken(ctx, 7)
+
+	userID, err := svc.ResetPassword(ctx, token, "new-password")
+	if err != nil || userID != 7 {
+		t.Fatalf("ResetPassword = %d, %v", userID, err)
+	}
+	if err := svc.CheckPassword(ctx, 7, "new-password"); err != nil {
+		t.Errorf("new password rejected: %v", err)
+	}
+
+	if _, err := svc.ResetPassword(ctx, token, "again-password"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("reused token: err = %v, want ErrInvalidToken", err)
+	}
+	if _, err := svc.ResetPassword(ctx, other, "again-password"); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("token requested before the reset: err = %v, want ErrTokenRevoked", err)
+	}
+	if _, err := svc.ValidateToken(ctx, pair.AccessToken); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("access token after reset: err = %v, want ErrTokenRevoked", err)
+	}
+	if _, err := svc.Refresh(ctx, pair.RefreshToken); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("refresh token after reset: err = %v, want ErrTokenRevoked", err)
+	}
+}
+
+func TestResetTokenExpires(t *testing.T) {
+	ctx := context.Background()
+	svc := NewAuthService(WithResetTTL(-time.Second))
+
+	token, _ := svc.IssueResetToken(ctx, 7)
+	if _, err := svc.ResetPassword(ctx, token, "new-password"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("err = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestForcePasswordResetLocksOutUntilReset(t *testing.T) {
+	ctx := context.Background()
+	svc := NewAuthService()
+	svc.SetPassword(ctx, 7, "old-password")
+	pair, _ := svc.IssueTokenPair(ctx, 7, "eve@example.com", "user")
+	earlier, _ := svc.IssueResetToken(ctx, 7)
+
+	token, err := svc.ForcePasswordReset(ctx, 7)
+	if err != nil {
+		t.Fatalf("ForcePasswordReset: %v", err)
+	}
+	if err := svc.CheckPassword(ctx, 7, "old-password"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("old password: err = %v, want ErrInvalidCredentials", err)
+	}
+	if _, err := svc.ValidateToken(ctx, pair.AccessToken); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("access token: err = %v, want ErrTokenRevoked", err)
+	}
+	if _, err := svc.ResetPassword(ctx, earlier, "new-password"); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("earlier reset token: err = %v, want ErrTokenRevoked", err)
+	}
+	if _, err := svc.ResetPassword(ctx, token, "new-password"); err != nil {
+		t.Errorf("forced reset token: %v", err)
+	}
+}
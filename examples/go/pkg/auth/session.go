@@ -0,0 +1,189 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ErrSessionNotFound is returned when a session does not exist or belongs to
+// another user
+var ErrSessionNotFound = errors.New("session not found")
+
+// Session is one signed-in device: a refresh token rotation family together
+// with where it was last used from. Its ID is the family, and access tokens
+// issued within it carry the ID as their sid claim.
+type Session struct {
+	ID        string
+	UserID    int
+	Version   int
+	UserAgent string
+	IP        string
+	CreatedAt time.Time
+	// LastSeen is when the session last logged in or refreshed its tokens
+	LastSeen  time.Time
+	ExpiresAt time.Time
+}
+
+// SessionOption adds details about the client to a session
+type SessionOption func(*Session)
+
+// WithSessionClient records the address and user agent of the client
+// logging in or refreshing
+func WithSessionClient(ip, userAgent string) SessionOption {
+	return func(session *Session) {
+		session.IP = ip
+		session.UserAgent = userAgent
+	}
+}
+
+// Sessions returns the user's active sessions, most recently seen first
+func (s *AuthService) Sessions(ctx context.Context, userID int) (_ []Session, err error) {
+	_, span := tracer.Start(ctx, "AuthService.Sessions")
+	defer func() { endSpan(span, err) }()
+
+	var sessions []Session
+	err = s.retry(func() (err error) {
+		sessions, err = s.store.Sessions(userID)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("auth: load sessions: %w", err)
+	}
+	version, err := s.tokenVersion(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Sessions outlived by their refresh tokens, or predating a revocation
+	// of the user's tokens, can no longer be used
+	now := time.Now()
+	active := sessions[:0]
+	for _, session := range sessions {
+		if session.Version == version && now.Before(session.ExpiresAt) {
+			active = append(active, session)
+		}
+	}
+	sort.Slice(active, func(i, j int) bool { return active[i].LastSeen.After(active[j].LastSeen) })
+	return active, nil
+}
+
+// RevokeSession signs the user's session out: its refresh tokens stop
+// working at once and its access tokens are denied until they expire
+func (s *AuthService) RevokeSession(ctx context.Context, userID int, sessionID string) (err error) {
+	_, span := tracer.Start(ctx, "AuthService.RevokeSession")
+	defer func() { endSpan(span, err) }()
+
+	s.refreshMu.Lock()
+	defer s.refreshMu.Unlock()
+
+	var (
+		session Session
+		ok      bool
+	)
+	err = s.retry(func() (err error) {
+		session, ok, err = s.store.Session(sessionID)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("auth: load session: %w", err)
+	}
+	if !ok || session.UserID != userID {
+		return ErrSessionNotFound
+	}
+
+	if err := s.retry(func() error { return s.store.DeleteRefreshFamily(sessionID) }); err != nil {
+		return fmt.Errorf("auth: revoke refresh family: %w", err)
+	}
+	return s.endSession(sessionID)
+}
+
+// MoveSessions hands the active sessions of fromUserID to toUserID, as when
+// two accounts are merged: their refresh tokens keep working but now issue
+// tokens for toUserID with the given email and role. Access tokens already
+// issued still name fromUserID; call RevokeUserTokens for it afterwards to
+// retire them.
+func (s *AuthService) MoveSessions(ctx context.Context, fromUserID, toUserID int, email, role string) (err error) {
+	_, span := tracer.Start(ctx, "AuthService.MoveSessions")
+	defer func() { endSpan(span, err) }()
+
+	s.refreshMu.Lock()
+	defer s.refreshMu.Unlock()
+
+	fromVersion, err := s.tokenVersion(fromUserID)
+	if err != nil {
+		return err
+	}
+	toVersion, err := s.tokenVersion(toUserID)
+	if err != nil {
+		return err
+	}
+	err = s.retry(func() error {
+		return s.store.MoveSessions(fromUserID, fromVersion, RefreshRecord{UserID: toUserID, Email: email, Role: role, Version: toVersion})
+	})
+	if err != nil {
+		return fmt.Errorf("auth: move sessions: %w", err)
+	}
+	return nil
+}
+
+// SessionRevoked reports whether access tokens of the session are denied
+func (s *AuthService) SessionRevoked(ctx context.Context, sessionID string) (_ bool, err error) {
+	_, span := tracer.Start(ctx, "AuthService.SessionRevoked")
+	defer func() { endSpan(span, err) }()
+
+	var denied bool
+	err = s.retry(func() (err error) {
+		denied, err = s.store.SessionDenied(sessionID)
+		return err
+	})
+	if err != nil {
+		return false, fmt.Errorf("auth: check session denylist: %w", err)
+	}
+	return denied, nil
+}
+
+// touchSession marks the session of a refresh token's family as seen now,
+// creating it for families issued before sessions were tracked
+func (s *AuthService) touchSession(record RefreshRecord, opts ...SessionOption) error {
+	var (
+		session Session
+		ok      bool
+	)
+	err := s.retry(func() (err error) {
+		session, ok, err = s.store.Session(record.Family)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("auth: load session: %w", err)
+	}
+
+	now := time.Now()
+	if !ok {
+		session = Session{ID: record.Family, UserID: record.UserID, Version: record.Version, CreatedAt: now}
+	}
+	session.LastSeen = now
+	session.ExpiresAt = now.Add(s.refreshTTL)
+	for _, opt := range opts {
+		opt(&session)
+	}
+	if err := s.retry(func() error { return s.store.SaveSession(session) }); err != nil {
+		return fmt.Errorf("auth: store session: %w", err)
+	}
+	return nil
+}
+
+// endSession forgets a session and denies its access tokens for as long as
+// any of them can still be valid
+func (s *AuthService) endSession(sessionID string) error {
+	until := time.Now().Add(s.tokenTTL)
+	if err := s.retry(func() error { return s.store.DenySession(sessionID, until) }); err != nil {
+		return fmt.Errorf("auth: deny session: %w", err)
+	}
+	if err := s.retry(func() error { return s.store.DeleteSession(sessionID) }); err != nil {
+		return fmt.Errorf("auth: delete session: %w", err)
+	}
+	return nil
+}
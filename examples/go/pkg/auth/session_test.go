@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestSessionsFollowRefreshAndRevocation(t *testing.T) {
+	ctx := context.Background()
+	s := NewAuthService()
+	pair, _ := s.IssueTokenPair(ctx, 2, "lin@example.com", "user", WithSessionClient("192.0.2.1", "laptop"))
+	if _, err := s.Refresh(ctx, pair.RefreshToken, WithSessionClient("192.0.2.9", "laptop")); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+
+	sessions, err := s.Sessions(ctx, 2)
+	if err != nil {
+		t.Fatalf("Sessions: %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].IP != "192.0.2.9" {
+		t.Fatalf("sessions after refresh = %+v, want one seen from 192.0.2.9", sessions)
+	}
+	if err := s.RevokeSession(ctx, 3, sessions[0].ID); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("revoking another user's session: err = %v, want ErrSessionNotFound", err)
+	}
+
+	s.RevokeUserTokens(ctx, 2)
+	if sessions, _ := s.Sessions(ctx, 2); len(sessions) != 0 {
+		t.Errorf("sessions after revoking the user's tokens = %+v, want none", sessions)
+	}
+}
@@ -0,0 +1,320 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// Store persists the per-user state behind token revocation, refresh and
+// password reset tokens, sessions, password checks and two-factor
+// authentication.
+// Implementations backed by an external system should return an error only
+// for failures of the system itself; AuthService retries those.
+type Store interface {
+	// TokenVersion returns the user's current token version
+	TokenVersion(userID int) (int, error)
+	// BumpTokenVersion increments the user's token version
+	BumpTokenVersion(userID int) error
+	// PasswordHash returns the user's bcrypt hash and whether one is set
+	PasswordHash(userID int) ([]byte, bool, error)
+	// SetPasswordHash stores the user's bcrypt hash
+	SetPasswordHash(userID int, hash []byte) error
+	// RefreshToken returns the record stored under a refresh token hash
+	RefreshToken(hash string) (RefreshRecord, bool, error)
+	// SaveRefreshToken creates or replaces the record for a refresh token hash
+	SaveRefreshToken(hash string, record RefreshRecord) error
+	// DeleteRefreshFamily removes every refresh token in a rotation family
+	DeleteRefreshFamily(family string) error
+	// SaveResetToken stores the record for a password reset token hash
+	SaveResetToken(hash string, record ResetRecord) error
+	// TakeResetToken returns and removes the record stored under a reset
+	// token hash as one atomic step, so a token can be used only once
+	TakeResetToken(hash string) (ResetRecord, bool, error)
+	// TwoFactor returns the user's two-factor state and whether any is set
+	TwoFactor(userID int) (TwoFactorRecord, bool, error)
+	// SaveTwoFactor creates or replaces the user's two-factor state
+	SaveTwoFactor(userID int, record TwoFactorRecord) error
+	// Session returns the session stored under an ID
+	Session(id string) (Session, bool, error)
+	// Sessions returns every session stored for the user, in any order
+	Sessions(userID int) ([]Session, error)
+	// SaveSession creates or replaces a session
+	SaveSession(session Session) error
+	// DeleteSession removes a session; unknown IDs are ignored
+	DeleteSession(id string) error
+	// DenySession denies access tokens of a session until the given time
+	DenySession(id string, until time.Time) error
+	// SessionDenied reports whether access tokens of a session are denied
+	SessionDenied(id string) (bool, error)
+	// MoveSessions reassigns the sessions and refresh tokens of userID
+	// issued at version to the user, email, role and version of to
+	MoveSessions(userID, version int, to RefreshRecord) error
+	// DeleteExpiredTokens removes the refresh and reset tokens and session
+	// denials that lapsed by now, returning how many were removed
+	DeleteExpiredTokens(now time.Time) (int, error)
+	// DeleteExpiredSessions removes the sessions that expired by now,
+	// returning how many were removed
+	DeleteExpiredSessions(now time.Time) (int, error)
+}
+
+// MemoryStore is the default in-process Store
+type MemoryStore struct {
+	mu        sync.RWMutex
+	versions  map[int]int
+	passwords map[int][]byte
+	refresh   map[string]RefreshRecord
+	resets    map[string]ResetRecord
+	twoFactor map[int]TwoFactorRecord
+	sessions  map[string]Session
+	denied    map[string]time.Time
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		versions:  make(map[int]int),
+		passwords: make(map[int][]byte),
+		refresh:   make(map[string]RefreshRecord),
+		resets:    make(map[string]ResetRecord),
+		twoFactor: make(map[int]TwoFactorRecord),
+		sessions:  make(map[string]Session),
+		denied:    make(map[string]time.Time),
+	}
+}
+
+// TokenVersion implements Store
+func (m *MemoryStore) TokenVersion(userID int) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.versions[userID], nil
+}
+
+// BumpTokenVersion implements Store
+func (m *MemoryStore) BumpTokenVersion(userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.versions[userID]++
+	return nil
+}
+
+// PasswordHash implements Store
+func (m *MemoryStore) PasswordHash(userID int) ([]byte, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	hash, ok := m.passwords[userID]
+	return hash, ok, nil
+}
+
+// SetPasswordHash implements Store
+func (m *MemoryStore) SetPasswordHash(userID int, hash []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.passwords[userID] = hash
+	return nil
+}
+
+// RefreshToken implements Store
+func (m *MemoryStore) RefreshToken(hash string) (RefreshRecord, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	record, ok := m.refresh[hash]
+	return record, ok, nil
+}
+
+// SaveRefreshToken implements Store
+func (m *MemoryStore) SaveRefreshToken(hash string, record RefreshRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.refresh[hash] = record
+	return nil
+}
+
+// DeleteRefreshFamily implements Store
+func (m *MemoryStore) DeleteRefreshFamily(family string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for hash, record := range m.refresh {
+		if record.Family == family {
+			delete(m.refresh, hash)
+		}
+	}
+	return nil
+}
+
+// retry runs op up to s.storeAttempts times, sleeping a linearly growing
+// backoff between attempts, and returns the last error
+func (s *AuthService) retry(op func() error) error {
+	var err error
+	for attempt := 1; attempt <= s.storeAttempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(time.Duration(attempt-1) * s.storeBackoff)
+		}
+		if err = op(); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// SaveResetToken implements Store. Expired reset tokens are dropped on the
+// way, since unused ones are otherwise never removed.
+func (m *MemoryStore) SaveResetToken(hash string, record ResetRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for key, existing := range m.resets {
+		if !now.Before(existing.ExpiresAt) {
+			delete(m.resets, key)
+		}
+	}
+	m.resets[hash] = record
+	return nil
+}
+
+// TakeResetToken implements Store
+func (m *MemoryStore) TakeResetToken(hash string) (ResetRecord, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	record, ok := m.resets[hash]
+	delete(m.resets, hash)
+	return record, ok, nil
+}
+
+// TwoFactor implements Store
+func (m *MemoryStore) TwoFactor(userID int) (TwoFactorRecord, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	record, ok := m.twoFactor[userID]
+	return record, ok, nil
+}
+
+// SaveTwoFactor implements Store
+func (m *MemoryStore) SaveTwoFactor(userID int, record TwoFactorRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.twoFactor[userID] = record
+	return nil
+}
+
+// Session implements Store
+func (m *MemoryStore) Session(id string) (Session, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	session, ok := m.sessions[id]
+	return session, ok, nil
+}
+
+// Sessions implements Store. Expired sessions are dropped on the way, since
+// sessions that are never logged out are otherwise never removed.
+func (m *MemoryStore) Sessions(userID int) ([]Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	var sessions []Session
+	for id, session := range m.sessions {
+		switch {
+		case !now.Before(session.ExpiresAt):
+			delete(m.sessions, id)
+		case session.UserID == userID:
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions, nil
+}
+
+// SaveSession implements Store
+func (m *MemoryStore) SaveSession(session Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sessions[session.ID] = session
+	return nil
+}
+
+// DeleteSession implements Store
+func (m *MemoryStore) DeleteSession(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, id)
+	return nil
+}
+
+// DenySession implements Store. Lapsed entries are dropped on the way.
+func (m *MemoryStore) DenySession(id string, until time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for key, expiry := range m.denied {
+		if !now.Before(expiry) {
+			delete(m.denied, key)
+		}
+	}
+	m.denied[id] = until
+	return nil
+}
+
+// SessionDenied implements Store
+func (m *MemoryStore) SessionDenied(id string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	until, ok := m.denied[id]
+	return ok && time.Now().Before(until), nil
+}
+
+// MoveSessions implements Store
+func (m *MemoryStore) MoveSessions(userID, version int, to RefreshRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for hash, record := range m.refresh {
+		if record.UserID == userID && record.Version == version {
+			record.UserID, record.Email, record.Role, record.Version = to.UserID, to.Email, to.Role, to.Version
+			m.refresh[hash] = record
+		}
+	}
+	for id, session := range m.sessions {
+		if session.UserID == userID && session.Version == version {
+			session.UserID, session.Version = to.UserID, to.Version
+			m.sessions[id] = session
+		}
+	}
+	return nil
+}
+
+// DeleteExpiredTokens implements Store
+func (m *MemoryStore) DeleteExpiredTokens(now time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	removed := 0
+	for hash, record := range m.refresh {
+		if !now.Before(record.ExpiresAt) {
+			delete(m.refresh, hash)
+			removed++
+		}
+	}
+	for hash, record := range m.resets {
+		if !now.Before(record.ExpiresAt) {
+			delete(m.resets, hash)
+			removed++
+		}
+	}
+	for id, until := range m.denied {
+		if !now.Before(until) {
+			delete(m.denied, id)
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// DeleteExpiredSessions implements Store
+func (m *MemoryStore) DeleteExpiredSessions(now time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	removed := 0
+	for id, session := range m.sessions {
+		if !now.Before(session.ExpiresAt) {
+			delete(m.sessions, id)
+			removed++
+		}
+	}
+	return removed, nil
+}
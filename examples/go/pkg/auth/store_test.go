@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+var errUnavailable = errors.New("store unavailable")
+
+// flakyStore fails the first failures calls to every operation
+type flakyStore struct {
+	*MemoryStore
+	failures int
+	calls    int
+}
+
+func (f *flakyStore) fail() error {
+	f.calls++
+	if f.calls <= f.failures {
+		return errUnavailable
+	}
+	return nil
+}
+
+func (f *flakyStore) PasswordHash(userID int) ([]byte, bool, error) {
+	if err := f.fail(); err != nil {
+		return nil, false, err
+	}
+	return f.MemoryStore.PasswordHash(userID)
+}
+
+func (f *flakyStore) TokenVersion(userID int) (int, error) {
+	if err := f.fail(); err != nil {
+		return 0, err
+	}
+	return f.MemoryStore.TokenVersion(userID)
+}
+
+func TestStoreRetryRecoversFromTransientFailures(t *testing.T) {
+	store := &flakyStore{MemoryStore: NewMemoryStore()}
+	svc := NewAuthService(WithStore(store), WithStoreRetry(3, time.Millisecond))
+	if err := svc.SetPassword(context.Background(), 1, "correct horse"); err != nil {
+		t.Fatalf("SetPassword: %v", err)
+	}
+
+	store.calls, store.failures = 0, 2
+	if err := svc.CheckPassword(context.Background(), 1, "correct horse"); err != nil {
+		t.Fatalf("CheckPassword after two blips: %v", err)
+	}
+	if store.calls != 3 {
+		t.Errorf("store calls = %d, want 3", store.calls)
+	}
+
+	store.calls, store.failures = 0, 2
+	if _, err := svc.GenerateToken(context.Background(), 1, "alice@example.com", "admin"); err != nil {
+		t.Errorf("GenerateToken after two blips: %v", err)
+	}
+}
+
+func TestStoreRetryGivesUpAfterAttempts(t *testing.T) {
+	store := &flakyStore{MemoryStore: NewMemoryStore(), failures: 5}
+	svc := NewAuthService(WithStore(store), WithStoreRetry(2, time.Millisecond))
+
+	err := svc.CheckPassword(context.Background(), 1, "correct horse")
+	if !errors.Is(err, errUnavailable) {
+		t.Fatalf("err = %v, want the store error", err)
+	}
+	if errors.Is(err, ErrInvalidCredentials) {
+		t.Error("store failure reported as invalid credentials")
+	}
+	if store.calls != 2 {
+		t.Errorf("store calls = %d, want 2", store.calls)
+	}
+}
+
+func TestMemoryStoreDeletesExpiredEntries(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Now()
+	_ = store.SaveRefreshToken("old", RefreshRecord{UserID: 1, ExpiresAt: now.Add(-time.Minute)})
+	_ = store.SaveRefreshToken("live", RefreshRecord{UserID: 1, ExpiresAt: now.Add(time.Hour)})
+	_ = store.SaveResetToken("reset", ResetRecord{UserID: 1, ExpiresAt: now.Add(time.Minute)})
+	_ = store.DenySession("denied", now.Add(time.Minute))
+	_ = store.SaveSession(Session{ID: "old", UserID: 1, ExpiresAt: now.Add(-time.Second)})
+	_ = store.SaveSession(Session{ID: "live", UserID: 1, ExpiresAt: now.Add(time.Hour)})
+
+	if removed, err := store.DeleteExpiredTokens(now.Add(2 * time.Minute)); err != nil || removed != 3 {
+		t.Errorf("DeleteExpiredTokens = %d, %v; want the old refresh token, the reset token and the denial", removed, err)
+	}
+	if _, ok, _ := store.RefreshToken("live"); !ok {
+		t.Error("a live refresh token was deleted")
+	}
+	if removed, err := store.DeleteExpiredSessions(now); err != nil || removed != 1 {
+		t.Errorf("DeleteExpiredSessions = %d, %v; want 1", removed, err)
+	}
+	if _, ok, _ := store.Session("live"); !ok {
+		t.Error("a live session was deleted")
+	}
+}
@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// StuffingDetector spots credential stuffing: one client IP failing logins
+// for many different accounts. Once an IP fails for maxAccounts distinct
+// accounts within window it is blocked for the block duration. This
+// complements per-account protections, which a distributed attack trying
+// each account only a few times would never trip.
+type StuffingDetector struct {
+	maxAccounts int
+	window      time.Duration
+	block       time.Duration
+	now         func() time.Time
+
+	mu        sync.Mutex
+	ips       map[string]*ipFailures
+	lastSweep time.Time
+}
+
+type ipFailures struct {
+	// accounts maps each failed account to its latest failure
+	accounts     map[string]time.Time
+	blockedUntil time.Time
+}
+
+// NewStuffingDetector creates a detector blocking an IP for block once it
+// has failed logins for maxAccounts distinct accounts within window
+func NewStuffingDetector(maxAccounts int, window, block time.Duration) *StuffingDetector {
+	return &StuffingDetector{
+		maxAccounts: maxAccounts,
+		window:      window,
+		block:       block,
+		now:         time.Now,
+		ips:         make(map[string]*ipFailures),
+		lastSweep:   time.Now(),
+	}
+}
+
+// Blocked reports whether ip is currently blocked and for how much longer
+func (d *StuffingDetector) Blocked(ip string) (time.Duration, bool) {
+	now := d.now()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	entry, ok := d.ips[ip]
+	if !ok || !now.Before(entry.blockedUntil) {
+		return 0, false
+	}
+	return entry.blockedUntil.Sub(now), true
+}
+
+// RecordFailure notes a failed login for account from ip. It returns the
+// number of distinct accounts the IP has failed for within the window and
+// whether this failure blocked the IP.
+func (d *StuffingDetector) RecordFailure(ip, account string) (int, bool) {
+	now := d.now()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.sweep(now)
+
+	entry, ok := d.ips[ip]
+	if !ok {
+		entry = &ipFailures{accounts: make(map[string]time.Time)}
+		d.ips[ip] = entry
+	}
+	for name, at := range entry.accounts {
+		if now.Sub(at) > d.window {
+			delete(entry.accounts, name)
+		}
+	}
+	entry.accounts[strings.ToLower(account)] = now
+
+	distinct := len(entry.accounts)
+	if distinct < d.maxAccounts || now.Before(entry.blockedUntil) {
+		return distinct, false
+	}
+
+	entry.blockedUntil = now.Add(d.block)
+	entry.accounts = make(map[string]time.Time)
+	return distinct, true
+}
+
+// sweep drops IPs with no recent failures and no active block, at most once
+// per window. Callers must hold d.mu.
+func (d *StuffingDetector) sweep(now time.Time) {
+	if now.Sub(d.lastSweep) < d.window {
+		return
+	}
+	for ip, entry := range d.ips {
+		if now.Before(entry.blockedUntil) {
+			continue
+		}
+		recent := false
+		for _, at := range entry.accounts {
+			if now.Sub(at) <= d.window {
+				recent = true
+				break
+			}
+		}
+		if !recent {
+			delete(d.ips, ip)
+		}
+	}
+	d.lastSweep = now
+}
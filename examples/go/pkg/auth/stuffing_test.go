@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestStuffingDetectorBlocksIPFailingManyAccounts(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	d := NewStuffingDetector(5, 10*time.Minute, 15*time.Minute)
+	d.now = func() time.Time { return now }
+
+	// Repeated failures for one account do not count as stuffing
+	for i := 0; i < 10; i++ {
+		if _, blocked := d.RecordFailure("198.51.100.9", "alice@example.com"); blocked {
+			t.Fatal("single-account failures blocked the IP")
+		}
+	}
+
+	var tripped bool
+	for i := 0; i < 5; i++ {
+		_, tripped = d.RecordFailure("203.0.113.5", fmt.Sprintf("user%d@example.com", i))
+	}
+	if !tripped {
+		t.Fatal("fifth distinct account did not block the IP")
+	}
+	if retry, blocked := d.Blocked("203.0.113.5"); !blocked || retry != 15*time.Minute {
+		t.Errorf("Blocked = %v, %v; want blocked for 15m", retry, blocked)
+	}
+	if _, blocked := d.Blocked("198.51.100.9"); blocked {
+		t.Error("other IP is blocked")
+	}
+
+	now = now.Add(16 * time.Minute)
+	if _, blocked := d.Blocked("203.0.113.5"); blocked {
+		t.Error("block did not expire")
+	}
+}
+
+func TestStuffingDetectorForgetsOldFailures(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	d := NewStuffingDetector(3, time.Minute, time.Hour)
+	d.now = func() time.Time { return now }
+
+	d.RecordFailure("203.0.113.5", "a@example.com")
+	d.RecordFailure("203.0.113.5", "b@example.com")
+	now = now.Add(2 * time.Minute)
+	if distinct, blocked := d.RecordFailure("203.0.113.5", "c@example.com"); blocked || distinct != 1 {
+		t.Errorf("RecordFailure = %d, %v; want 1 recent account and no block", distinct, blocked)
+	}
+}
@@ -0,0 +1,420 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	// ErrInvalidCode is returned when a two-factor code matches neither the
+	// user's authenticator nor an unused recovery code
+	ErrInvalidCode = errors.New("invalid two-factor code")
+	// ErrTwoFactorEnabled is returned when setting up two-factor
+	// authentication for a user who already has it
+	ErrTwoFactorEnabled = errors.New("two-factor authentication already enabled")
+	// ErrTwoFactorNotSetUp is returned when enabling two-factor
+	// authentication before SetupTwoFactor
+	ErrTwoFactorNotSetUp = errors.New("two-factor authentication not set up")
+	// ErrTooManyAttempts is returned by VerifyChallenge once the challenge
+	// or the user has used up their failed codes
+	ErrTooManyAttempts = errors.New("too many invalid two-factor codes")
+)
+
+const (
+	// twoFactorChallengeAudience marks the tokens Login hands out in place of
+	// an access token while the second factor is outstanding
+	twoFactorChallengeAudience = "two-factor-challenge"
+
+	totpPeriod = 30
+	totpDigits = 6
+	// totpSkew is how many periods either side of now a code is accepted,
+	// to allow for clock drift on the user's device
+	totpSkew = 1
+
+	recoveryCodeCount = 10
+
+	// maxChallengeAttempts is how many wrong codes one challenge token
+	// takes before it is void
+	maxChallengeAttempts = 5
+	// maxTwoFactorFailures is how many wrong codes in a row, across
+	// challenges, lock the user's second factor for twoFactorLockout.
+	// Together they keep guessing well short of the million codes a
+	// challenge would otherwise allow.
+	maxTwoFactorFailures = 10
+	twoFactorLockout     = 15 * time.Minute
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// TwoFactorRecord is the stored two-factor state of a user.
+//
+// Secret is the TOTP key itself, since codes cannot be checked against a
+// hash of it. RecoveryCodes holds the SHA-256 hashes of the recovery codes
+// not yet used. LastStep is the TOTP period of the last accepted code, so a
+// code cannot be replayed within its window. FailedAttempts counts wrong
+// codes since the last accepted one, and LockedUntil is set once there are
+// too many.
+type TwoFactorRecord struct {
+	Secret         []byte
+	Enabled        bool
+	RecoveryCodes  []string
+	LastStep       int64
+	FailedAttempts int
+	LockedUntil    time.Time
+}
+
+// TwoFactorSetup is what an authenticator app needs to enroll a user
+type TwoFactorSetup struct {
+	// Secret is the base32 key for manual entry
+	Secret string
+	// URI is the otpauth:// provisioning URI, usually shown as a QR code
+	URI string
+}
+
+// challengeClaims are the claims of a two-factor challenge token. Version
+// pins the user's token version, so revoking their tokens also voids a
+// challenge in flight.
+type challengeClaims struct {
+	UserID  int `json:"user_id"`
+	Version int `json:"ver"`
+	jwt.RegisteredClaims
+}
+
+// WithTOTPIssuer sets the issuer shown next to the account in authenticator
+// apps. The default is "template2".
+func WithTOTPIssuer(issuer string) Option {
+	return func(s *AuthService) {
+		s.totpIssuer = issuer
+	}
+}
+
+// WithChallengeTTL sets how long a two-factor challenge token is valid
+func WithChallengeTTL(ttl time.Duration) Option {
+	return func(s *AuthService) {
+		s.challengeTTL = ttl
+	}
+}
+
+// ChallengeTTL returns how long issued two-factor challenge tokens are valid
+func (s *AuthService) ChallengeTTL() time.Duration {
+	return s.challengeTTL
+}
+
+// SetupTwoFactor generates a new TOTP secret for the user. It takes effect
+// only once EnableTwoFactor confirms a code from it, so running setup again
+// before then simply replaces the secret.
+func (s *AuthService) SetupTwoFactor(ctx context.Context, userID int, account string) (_ TwoFactorSetup, err error) {
+	_, span := tracer.Start(ctx, "AuthService.SetupTwoFactor")
+	defer func() { endSpan(span, err) }()
+
+	s.twoFactorMu.Lock()
+	defer s.twoFactorMu.Unlock()
+
+	record, _, err := s.twoFactor(userID)
+	if err != nil {
+		return TwoFactorSetup{}, err
+	}
+	if record.Enabled {
+		return TwoFactorSetup{}, ErrTwoFactorEnabled
+	}
+
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return TwoFactorSetup{}, fmt.Errorf("auth: generate totp secret: %w", err)
+	}
+	if err := s.saveTwoFactor(userID, TwoFactorRecord{Secret: secret}); err != nil {
+		return TwoFactorSetup{}, err
+	}
+
+	encoded := totpEncoding.EncodeToString(secret)
+	query := url.Values{
+		"secret":    {encoded},
+		"issuer":    {s.totpIssuer},
+		"algorithm": {"SHA1"},
+		"digits":    {fmt.Sprint(totpDigits)},
+		"period":    {fmt.Sprint(totpPeriod)},
+	}
+	uri := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + s.totpIssuer + ":" + account,
+		RawQuery: query.Encode(),
+	}
+	return TwoFactorSetup{Secret: encoded, URI: uri.String()}, nil
+}
+
+// EnableTwoFactor turns on two-factor authentication once code proves the
+// user's authenticator holds the secret from SetupTwoFactor. It returns the
+// recovery codes, which are only stored hashed and cannot be shown again.
+func (s *AuthService) EnableTwoFactor(ctx context.Context, userID int, code string) (_ []string, err error) {
+	_, span := tracer.Start(ctx, "AuthService.EnableTwoFactor")
+	defer func() { endSpan(span, err) }()
+
+	s.twoFactorMu.Lock()
+	defer s.twoFactorMu.Unlock()
+
+	record, ok, err := s.twoFactor(userID)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case !ok:
+		return nil, ErrTwoFactorNotSetUp
+	case record.Enabled:
+		return nil, ErrTwoFactorEnabled
+	}
+	step, ok := matchTOTP(record.Secret, code, time.Now(), record.LastStep)
+	if !ok {
+		return nil, ErrInvalidCode
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, fmt.Errorf("auth: generate recovery code: %w", err)
+		}
+		code := strings.ToLower(totpEncoding.EncodeToString(b))
+		codes[i] = code[:4] + "-" + code[4:]
+		hashes[i] = hashToken(normalizeRecoveryCode(codes[i]))
+	}
+
+	record.Enabled = true
+	record.RecoveryCodes = hashes
+	record.LastStep = step
+	if err := s.saveTwoFactor(userID, record); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// TwoFactorEnabled reports whether logging in as the user needs a second
+// factor
+func (s *AuthService) TwoFactorEnabled(ctx context.Context, userID int) (_ bool, err error) {
+	_, span := tracer.Start(ctx, "AuthService.TwoFactorEnabled")
+	defer func() { endSpan(span, err) }()
+
+	record, _, err := s.twoFactor(userID)
+	if err != nil {
+		return false, err
+	}
+	return record.Enabled, nil
+}
+
+// IssueChallengeToken issues a short-lived token standing for a login that
+// passed the password check but still owes a second factor
+func (s *AuthService) IssueChallengeToken(ctx context.Context, userID int) (_ string, err error) {
+	_, span := tracer.Start(ctx, "AuthService.IssueChallengeToken")
+	defer func() { endSpan(span, err) }()
+
+	version, err := s.tokenVersion(userID)
+	if err != nil {
+		return "", err
+	}
+	// A random ID keeps every challenge distinct, so each has its own
+	// budget of wrong codes
+	id, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims := challengeClaims{
+		UserID:  userID,
+		Version: version,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        id,
+			Subject:   fmt.Sprint(userID),
+			Audience:  jwt.ClaimStrings{twoFactorChallengeAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.challengeTTL)),
+		},
+	}
+
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.secret)
+}
+
+// VerifyChallenge checks code against the user a challenge token from
+// IssueChallengeToken was issued for. The code is either a current TOTP code
+// or one of the user's recovery codes, which is used up. It returns the user
+// and whether a recovery code was spent.
+//
+// Wrong codes are capped per challenge and per user; past either cap it
+// fails with ErrTooManyAttempts, even for a right code.
+func (s *AuthService) VerifyChallenge(ctx context.Context, challenge, code string) (userID int, recovery bool, err error) {
+	_, span := tracer.Start(ctx, "AuthService.VerifyChallenge")
+	defer func() { endSpan(span, err) }()
+
+	claims := &challengeClaims{}
+	_, err = jwt.ParseWithClaims(challenge, claims, func(t *jwt.Token) (interface{}, error) {
+		return s.secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithAudience(twoFactorChallengeAudience))
+	if err != nil {
+		return 0, false, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	version, err := s.tokenVersion(claims.UserID)
+	if err != nil {
+		return 0, false, err
+	}
+	if claims.Version != version {
+		return 0, false, ErrTokenRevoked
+	}
+
+	s.twoFactorMu.Lock()
+	defer s.twoFactorMu.Unlock()
+
+	now := time.Now()
+	challengeKey := hashToken(challenge)
+	s.pruneChallengeFailures(now)
+	if s.challengeFailures[challengeKey].count >= maxChallengeAttempts {
+		return 0, false, ErrTooManyAttempts
+	}
+
+	record, _, err := s.twoFactor(claims.UserID)
+	if err != nil {
+		return 0, false, err
+	}
+	if !record.Enabled {
+		return 0, false, ErrInvalidCode
+	}
+	if now.Before(record.LockedUntil) {
+		return 0, false, ErrTooManyAttempts
+	}
+
+	if step, ok := matchTOTP(record.Secret, code, now, record.LastStep); ok {
+		record.LastStep = step
+	} else {
+		hash := hashToken(normalizeRecoveryCode(code))
+		index := -1
+		for i, stored := range record.RecoveryCodes {
+			if hmac.Equal([]byte(stored), []byte(hash)) {
+				index = i
+			}
+		}
+		if index < 0 {
+			failure := s.challengeFailures[challengeKey]
+			failure.count++
+			failure.expires = claims.ExpiresAt.Time
+			s.challengeFailures[challengeKey] = failure
+
+			record.FailedAttempts++
+			if record.FailedAttempts >= maxTwoFactorFailures {
+				record.FailedAttempts = 0
+				record.LockedUntil = now.Add(twoFactorLockout)
+			}
+			if err := s.saveTwoFactor(claims.UserID, record); err != nil {
+				return 0, false, err
+			}
+			return 0, false, ErrInvalidCode
+		}
+		remaining := make([]string, 0, len(record.RecoveryCodes)-1)
+		remaining = append(remaining, record.RecoveryCodes[:index]...)
+		record.RecoveryCodes = append(remaining, record.RecoveryCodes[index+1:]...)
+		recovery = true
+	}
+
+	record.FailedAttempts = 0
+	delete(s.challengeFailures, challengeKey)
+	if err := s.saveTwoFactor(claims.UserID, record); err != nil {
+		return 0, false, err
+	}
+	return claims.UserID, recovery, nil
+}
+
+// challengeFailure counts the wrong codes presented with one challenge
+// token until the token expires
+type challengeFailure struct {
+	count   int
+	expires time.Time
+}
+
+// pruneChallengeFailures forgets the failures of expired challenges.
+// Callers must hold s.twoFactorMu.
+func (s *AuthService) pruneChallengeFailures(now time.Time) {
+	if s.challengeFailures == nil {
+		s.challengeFailures = make(map[string]challengeFailure)
+	}
+	for key, failure := range s.challengeFailures {
+		if now.After(failure.expires) {
+			delete(s.challengeFailures, key)
+		}
+	}
+}
+
+// GenerateTOTPCode returns the code an authenticator holding the base32
+// secret shows at the given time
+func GenerateTOTPCode(secret string, at time.Time) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", fmt.Errorf("auth: decode totp secret: %w", err)
+	}
+	return totpCode(key, at.Unix()/totpPeriod), nil
+}
+
+func (s *AuthService) twoFactor(userID int) (TwoFactorRecord, bool, error) {
+	var (
+		record TwoFactorRecord
+		ok     bool
+	)
+	err := s.retry(func() (err error) {
+		record, ok, err = s.store.TwoFactor(userID)
+		return err
+	})
+	if err != nil {
+		return TwoFactorRecord{}, false, fmt.Errorf("auth: load two-factor state: %w", err)
+	}
+	return record, ok, nil
+}
+
+func (s *AuthService) saveTwoFactor(userID int, record TwoFactorRecord) error {
+	if err := s.retry(func() error { return s.store.SaveTwoFactor(userID, record) }); err != nil {
+		return fmt.Errorf("auth: store two-factor state: %w", err)
+	}
+	return nil
+}
+
+// matchTOTP looks for code among the periods around now that come after
+// lastStep and returns the period it matched
+func matchTOTP(secret []byte, code string, now time.Time, lastStep int64) (int64, bool) {
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= lastStep {
+			continue
+		}
+		if hmac.Equal([]byte(totpCode(secret, step)), []byte(code)) {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// totpCode computes the RFC 6238 code for one period
+func totpCode(secret []byte, step int64) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// normalizeRecoveryCode lets recovery codes be typed without the dash and in
+// any case
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
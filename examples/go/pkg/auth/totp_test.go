@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestTOTPCodeMatchesRFC6238(t *testing.T) {
+	// RFC 6238 appendix B, SHA-1, truncated to six digits
+	secret := []byte("12345678901234567890")
+	for at, want := range map[int64]string{59: "287082", 1111111109: "081804", 2000000000: "279037"} {
+		if got := totpCode(secret, at/totpPeriod); got != want {
+			t.Errorf("code at %d = %s, want %s", at, got, want)
+		}
+	}
+}
+
+func TestTwoFactorEnrollmentAndChallenge(t *testing.T) {
+	ctx := context.Background()
+	svc := NewAuthService(WithTOTPIssuer("Acme"))
+
+	setup, err := svc.SetupTwoFactor(ctx, 3, "kai@example.com")
+	if err != nil {
+		t.Fatalf("SetupTwoFactor: %v", err)
+	}
+	uri, _ := url.Parse(setup.URI)
+	if uri.Scheme != "otpauth" || uri.Path != "/Acme:kai@example.com" || uri.Query().Get("secret") != setup.Secret {
+		t.Errorf("provisioning URI = %s", setup.URI)
+	}
+	if enabled, _ := svc.TwoFactorEnabled(ctx, 3); enabled {
+		t.Fatal("two-factor enabled before a code was confirmed")
+	}
+
+	code, _ := GenerateTOTPCode(setup.Secret, time.Now())
+	if _, err := svc.EnableTwoFactor(ctx, 3, "000000"+code); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("EnableTwoFactor with a wrong code: err = %v, want ErrInvalidCode", err)
+	}
+	recovery, err := svc.EnableTwoFactor(ctx, 3, code)
+	if err != nil {
+		t.Fatalf("EnableTwoFactor: %v", err)
+	}
+	if len(recovery) != recoveryCodeCount {
+		t.Fatalf("got %d recovery codes, want %d", len(recovery), recoveryCodeCount)
+	}
+	if _, err := svc.SetupTwoFactor(ctx, 3, "kai@example.com"); !errors.Is(err, ErrTwoFactorEnabled) {
+		t.Errorf("SetupTwoFactor after enabling: err = %v, want ErrTwoFactorEnabled", err)
+	}
+
+	challenge, err := svc.IssueChallengeToken(ctx, 3)
+	if err != nil {
+		t.Fatalf("IssueChallengeToken: %v", err)
+	}
+	if _, err := svc.ValidateToken(ctx, challenge); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("ValidateToken(challenge): err = %v, want ErrInvalidToken", err)
+	}
+	// The code that enabled two-factor cannot be replayed to pass a challenge
+	if _, _, err := svc.VerifyChallenge(ctx, challenge, code); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("replayed code: err = %v, want ErrInvalidCode", err)
+	}
+
+	userID, used, err := svc.VerifyChallenge(ctx, challenge, recovery[0])
+	if err != nil || userID != 3 || !used {
+		t.Fatalf("VerifyChallenge(recovery) = %d, %v, %v", userID, used, err)
+	}
+	if _, _, err := svc.VerifyChallenge(ctx, challenge, recovery[0]); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("reused recovery code: err = %v, want ErrInvalidCode", err)
+	}
+
+	svc.RevokeUserTokens(ctx, 3)
+	if _, _, err := svc.VerifyChallenge(ctx, challenge, recovery[1]); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("challenge after revocation: err = %v, want ErrTokenRevoked", err)
+	}
+}
+
+func TestVerifyChallengeCapsWrongCodes(t *testing.T) {
+	ctx := context.Background()
+	svc := NewAuthService()
+	setup, _ := svc.SetupTwoFactor(ctx, 3, "kai@example.com")
+	code, _ := GenerateTOTPCode(setup.Secret, time.Now())
+	recovery, err := svc.EnableTwoFactor(ctx, 3, code)
+	if err != nil {
+		t.Fatalf("EnableTwoFactor: %v", err)
+	}
+
+	// One challenge is void after maxChallengeAttempts wrong codes, even
+	// for a right one
+	challenge, _ := svc.IssueChallengeToken(ctx, 3)
+	for i := 0; i < maxChallengeAttempts; i++ {
+		if _, _, err := svc.VerifyChallenge(ctx, challenge, "000000"); !errors.Is(err, ErrInvalidCode) {
+			t.Fatalf("wrong code %d: err = %v, want ErrInvalidCode", i+1, err)
+		}
+	}
+	if _, _, err := svc.VerifyChallenge(ctx, challenge, recovery[0]); !errors.Is(err, ErrTooManyAttempts) {
+		t.Errorf("exhausted challenge: err = %v, want ErrTooManyAttempts", err)
+	}
+
+	// Fresh challenges do not reset the user's count
+	challenge, _ = svc.IssueChallengeToken(ctx, 3)
+	for i := maxChallengeAttempts; i < maxTwoFactorFailures; i++ {
+		if _, _, err := svc.VerifyChallenge(ctx, challenge, "000000"); !errors.Is(err, ErrInvalidCode) {
+			t.Fatalf("wrong code %d: err = %v, want ErrInvalidCode", i+1, err)
+		}
+	}
+	challenge, _ = svc.IssueChallengeToken(ctx, 3)
+	if _, _, err := svc.VerifyChallenge(ctx, challenge, recovery[0]); !errors.Is(err, ErrTooManyAttempts) {
+		t.Errorf("locked user: err = %v, want ErrTooManyAttempts", err)
+	}
+}
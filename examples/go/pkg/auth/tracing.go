@@ -0,0 +1,20 @@
+package auth
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer starts the service's spans from the global tracer provider, so
+// they are dropped until the application installs one
+var tracer = otel.Tracer("github.com/cbwinslow/template2/examples/go/pkg/auth")
+
+// endSpan records err on span, if any, and ends it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestVerificationTokenRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	svc := NewAuthService(WithSecret([]byte("test-secret")))
+
+	token, err := svc.GenerateVerificationToken(ctx, 7, "eve@example.com")
+	if err != nil {
+		t.Fatalf("GenerateVerificationToken: %v", err)
+	}
+	userID, email, err := svc.ValidateVerificationToken(ctx, token)
+	if err != nil || userID != 7 || email != "eve@example.com" {
+		t.Errorf("ValidateVerificationToken = %d, %q, %v", userID, email, err)
+	}
+}
+
+func TestVerificationAndAccessTokensAreNotInterchangeable(t *testing.T) {
+	ctx := context.Background()
+	svc := NewAuthService(WithSecret([]byte("test-secret")))
+
+	verification, _ := svc.GenerateVerificationToken(ctx, 7, "eve@example.com")
+	if _, err := svc.ValidateToken(ctx, verification); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("verification token as access token: err = %v, want ErrInvalidToken", err)
+	}
+	access, _ := svc.GenerateToken(ctx, 7, "eve@example.com", "user")
+	if _, _, err := svc.ValidateVerificationToken(ctx, access); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("access token as verification token: err = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestVerificationTokenExpires(t *testing.T) {
+	ctx := context.Background()
+	svc := NewAuthService(WithVerificationTTL(-time.Second))
+
+	token, _ := svc.GenerateVerificationToken(ctx, 7, "eve@example.com")
+	if _, _, err := svc.ValidateVerificationToken(ctx, token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("err = %v, want ErrInvalidToken", err)
+	}
+}
@@ -0,0 +1,61 @@
+package websession
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStore is a store shared by every replica connected to the same
+// Redis, so sessions survive restarts and work behind any replica. Records
+// expire with their Redis keys.
+type RedisStore struct {
+	client redis.Cmdable
+	prefix string
+}
+
+// NewRedisStore creates a store keeping sessions in client under keys
+// starting with prefix
+func NewRedisStore(client redis.Cmdable, prefix string) *RedisStore {
+	return &RedisStore{client: client, prefix: prefix}
+}
+
+// Get implements Store
+func (s *RedisStore) Get(ctx context.Context, hash string) (Record, bool, error) {
+	data, err := s.client.Get(ctx, s.prefix+hash).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return Record{}, false, nil
+	}
+	if err != nil {
+		return Record{}, false, fmt.Errorf("redis: %w", err)
+	}
+	var record Record
+	if err := json.Unmarshal(data, &record); err != nil {
+		return Record{}, false, fmt.Errorf("decode session: %w", err)
+	}
+	return record, true, nil
+}
+
+// Save implements Store
+func (s *RedisStore) Save(ctx context.Context, hash string, record Record, ttl time.Duration) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("encode session: %w", err)
+	}
+	if err := s.client.Set(ctx, s.prefix+hash, data, ttl).Err(); err != nil {
+		return fmt.Errorf("redis: %w", err)
+	}
+	return nil
+}
+
+// Delete implements Store
+func (s *RedisStore) Delete(ctx context.Context, hash string) error {
+	if err := s.client.Del(ctx, s.prefix+hash).Err(); err != nil {
+		return fmt.Errorf("redis: %w", err)
+	}
+	return nil
+}
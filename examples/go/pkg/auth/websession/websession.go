@@ -0,0 +1,186 @@
+// Package websession keeps the tokens of browser sessions on the server, so
+// browser apps authenticate with an opaque HttpOnly cookie instead of
+// holding tokens in script-readable storage. Each session wraps a token pair
+// from auth.AuthService: the access token is refreshed behind the cookie as
+// it nears expiry, and signing out, revocation and the session list work as
+// they do for token clients. Only a SHA-256 hash of each session ID is
+// stored.
+package websession
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cbwinslow/template2/examples/go/pkg/auth"
+)
+
+// ErrInvalidSession is returned for session IDs that are unknown, expired
+// or whose tokens were revoked
+var ErrInvalidSession = errors.New("invalid session")
+
+// refreshMargin is how long before its access token expires a session
+// refreshes it, so a request never carries a token lapsing mid-flight
+const refreshMargin = 30 * time.Second
+
+// Record is the stored state of a session
+type Record struct {
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token"`
+	AccessExpiry time.Time `json:"access_expiry"`
+}
+
+// Store persists session records by the hash of their ID
+type Store interface {
+	// Get returns the record stored under hash
+	Get(ctx context.Context, hash string) (Record, bool, error)
+	// Save creates or replaces the record stored under hash for ttl
+	Save(ctx context.Context, hash string, record Record, ttl time.Duration) error
+	// Delete removes the record stored under hash; unknown hashes are
+	// ignored
+	Delete(ctx context.Context, hash string) error
+}
+
+// Tokens is the part of auth.AuthService sessions are built on
+type Tokens interface {
+	Refresh(ctx context.Context, refreshToken string, opts ...auth.SessionOption) (auth.TokenPair, error)
+	RevokeRefreshToken(ctx context.Context, refreshToken string) error
+}
+
+// Service starts, resolves and ends browser sessions
+type Service struct {
+	store  Store
+	tokens Tokens
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+// NewService creates a service keeping sessions in store for ttl, which
+// should match the refresh token lifetime
+func NewService(store Store, tokens Tokens, ttl time.Duration) *Service {
+	return &Service{store: store, tokens: tokens, ttl: ttl, now: time.Now}
+}
+
+// Start stores pair as a new session and returns its ID, the cookie value
+func (s *Service) Start(ctx context.Context, pair auth.TokenPair) (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("websession: generate ID: %w", err)
+	}
+	id := base64.RawURLEncoding.EncodeToString(secret)
+
+	record := Record{AccessToken: pair.AccessToken, RefreshToken: pair.RefreshToken, AccessExpiry: s.now().Add(pair.ExpiresIn)}
+	if err := s.store.Save(ctx, hashID(id), record, s.ttl); err != nil {
+		return "", fmt.Errorf("websession: save session: %w", err)
+	}
+	return id, nil
+}
+
+// AccessToken returns the current access token of the session, refreshing
+// it first when it is about to expire. opts describe the client for the
+// session list when a refresh happens.
+func (s *Service) AccessToken(ctx context.Context, id string, opts ...auth.SessionOption) (string, error) {
+	hash := hashID(id)
+	record, ok, err := s.store.Get(ctx, hash)
+	if err != nil {
+		return "", fmt.Errorf("websession: load session: %w", err)
+	}
+	if !ok {
+		return "", ErrInvalidSession
+	}
+	if s.now().Add(refreshMargin).Before(record.AccessExpiry) {
+		return record.AccessToken, nil
+	}
+
+	pair, err := s.tokens.Refresh(ctx, record.RefreshToken, opts...)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidToken) || errors.Is(err, auth.ErrTokenRevoked) || errors.Is(err, auth.ErrRefreshReused) {
+			if err := s.store.Delete(ctx, hash); err != nil {
+				return "", fmt.Errorf("websession: delete session: %w", err)
+			}
+			return "", ErrInvalidSession
+		}
+		return "", err
+	}
+	record = Record{AccessToken: pair.AccessToken, RefreshToken: pair.RefreshToken, AccessExpiry: s.now().Add(pair.ExpiresIn)}
+	if err := s.store.Save(ctx, hash, record, s.ttl); err != nil {
+		return "", fmt.Errorf("websession: save session: %w", err)
+	}
+	return record.AccessToken, nil
+}
+
+// End signs the session out, revoking its tokens. Unknown IDs are ignored.
+func (s *Service) End(ctx context.Context, id string) error {
+	hash := hashID(id)
+	record, ok, err := s.store.Get(ctx, hash)
+	if err != nil {
+		return fmt.Errorf("websession: load session: %w", err)
+	}
+	if !ok {
+		return nil
+	}
+	if err := s.tokens.RevokeRefreshToken(ctx, record.RefreshToken); err != nil {
+		return err
+	}
+	if err := s.store.Delete(ctx, hash); err != nil {
+		return fmt.Errorf("websession: delete session: %w", err)
+	}
+	return nil
+}
+
+func hashID(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:])
+}
+
+// MemoryStore is a per-replica Store for development and tests; sessions
+// are lost on restart and unknown to other replicas
+type MemoryStore struct {
+	mu      sync.Mutex
+	records map[string]memoryRecord
+	now     func() time.Time
+}
+
+type memoryRecord struct {
+	record  Record
+	expires time.Time
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: make(map[string]memoryRecord), now: time.Now}
+}
+
+// Get implements Store
+func (m *MemoryStore) Get(_ context.Context, hash string) (Record, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, ok := m.records[hash]
+	if !ok || !m.now().Before(entry.expires) {
+		delete(m.records, hash)
+		return Record{}, false, nil
+	}
+	return entry.record, true, nil
+}
+
+// Save implements Store
+func (m *MemoryStore) Save(_ context.Context, hash string, record Record, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.records[hash] = memoryRecord{record: record, expires: m.now().Add(ttl)}
+	return nil
+}
+
+// Delete implements Store
+func (m *MemoryStore) Delete(_ context.Context, hash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.records, hash)
+	return nil
+}
@@ -0,0 +1,98 @@
+package websession
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/cbwinslow/template2/examples/go/pkg/auth"
+)
+
+func TestServiceRefreshesAndEnds(t *testing.T) {
+	ctx := context.Background()
+	tokens := auth.NewAuthService()
+	pair, err := tokens.IssueTokenPair(ctx, 5, "gina@example.com", "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewMemoryStore()
+	sessions := NewService(store, tokens, time.Hour)
+	id, err := sessions.Start(ctx, pair)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	if token, err := sessions.AccessToken(ctx, id); err != nil || token != pair.AccessToken {
+		t.Fatalf("AccessToken = %q, %v; want the issued token", token, err)
+	}
+
+	// Near expiry the session rotates to a fresh pair
+	sessions.now = func() time.Time { return time.Now().Add(pair.ExpiresIn) }
+	if _, err := sessions.AccessToken(ctx, id); err != nil {
+		t.Fatalf("AccessToken near expiry: %v", err)
+	}
+	if record, _, _ := store.Get(ctx, hashID(id)); record.RefreshToken == pair.RefreshToken {
+		t.Error("the session kept its refresh token; want it rotated")
+	}
+
+	if err := sessions.End(ctx, id); err != nil {
+		t.Fatalf("End: %v", err)
+	}
+	if _, err := sessions.AccessToken(ctx, id); !errors.Is(err, ErrInvalidSession) {
+		t.Errorf("AccessToken after End: %v, want ErrInvalidSession", err)
+	}
+	if _, err := sessions.AccessToken(ctx, "unknown"); !errors.Is(err, ErrInvalidSession) {
+		t.Errorf("AccessToken of an unknown ID: %v, want ErrInvalidSession", err)
+	}
+}
+
+func TestServiceDropsRevokedSessions(t *testing.T) {
+	ctx := context.Background()
+	tokens := auth.NewAuthService()
+	pair, _ := tokens.IssueTokenPair(ctx, 5, "gina@example.com", "user")
+	store := NewMemoryStore()
+	sessions := NewService(store, tokens, time.Hour)
+	id, _ := sessions.Start(ctx, pair)
+
+	// Signed out elsewhere, e.g. from the session list
+	if err := tokens.RevokeRefreshToken(ctx, pair.RefreshToken); err != nil {
+		t.Fatal(err)
+	}
+	sessions.now = func() time.Time { return time.Now().Add(pair.ExpiresIn) }
+	if _, err := sessions.AccessToken(ctx, id); !errors.Is(err, ErrInvalidSession) {
+		t.Fatalf("AccessToken: %v, want ErrInvalidSession", err)
+	}
+	if _, ok, _ := store.Get(ctx, hashID(id)); ok {
+		t.Error("the revoked session is still stored")
+	}
+}
+
+func TestRedisStore(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	store := NewRedisStore(client, "session:")
+
+	record := Record{AccessToken: "a", RefreshToken: "r", AccessExpiry: time.Now().Add(time.Minute).UTC().Truncate(time.Second)}
+	if err := store.Save(ctx, "h", record, time.Hour); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if !server.Exists("session:h") || server.TTL("session:h") != time.Hour {
+		t.Errorf("key session:h missing or TTL %v", server.TTL("session:h"))
+	}
+	got, ok, err := store.Get(ctx, "h")
+	if err != nil || !ok || got != record {
+		t.Fatalf("Get = %+v, %v, %v", got, ok, err)
+	}
+	if err := store.Delete(ctx, "h"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, ok, err := store.Get(ctx, "h"); ok || err != nil {
+		t.Errorf("Get after Delete = %v, %v; want a miss", ok, err)
+	}
+}
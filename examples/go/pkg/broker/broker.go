@@ -0,0 +1,100 @@
+// Package broker publishes domain events to a message broker, NATS JetStream
+// or Kafka, so services outside the process can react to them
+package broker
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/cbwinslow/template2/examples/go/pkg/events"
+)
+
+// Encodings of published events
+const (
+	EncodingJSON     = "json"
+	EncodingProtobuf = "protobuf"
+)
+
+// Message is one encoded event
+type Message struct {
+	// ID identifies the event; brokers that deduplicate use it to drop a
+	// message published twice
+	ID          string
+	ContentType string
+	Data        []byte
+}
+
+// Publisher publishes messages to a broker
+type Publisher interface {
+	// Publish returns once the broker has stored msg under topic
+	Publish(ctx context.Context, topic string, msg Message) error
+	Close() error
+}
+
+// Envelope is the JSON encoding of a published event
+type Envelope struct {
+	ID         string       `json:"id"`
+	Event      string       `json:"event"`
+	OccurredAt time.Time    `json:"occurred_at"`
+	Data       events.Event `json:"data"`
+}
+
+// Forwarder publishes domain events to a broker, each to the topic named
+// after it: the prefix, a dot and the event name, such as
+// template2.events.user.created
+type Forwarder struct {
+	publisher Publisher
+	prefix    string
+	encoding  string
+	now       func() time.Time
+}
+
+// NewForwarder creates a forwarder publishing to publisher with encoding,
+// EncodingJSON or EncodingProtobuf
+func NewForwarder(publisher Publisher, prefix, encoding string) (*Forwarder, error) {
+	if encoding != EncodingJSON && encoding != EncodingProtobuf {
+		return nil, fmt.Errorf("broker: unknown encoding %q", encoding)
+	}
+	return &Forwarder{publisher: publisher, prefix: prefix, encoding: encoding, now: time.Now}, nil
+}
+
+// Forward is an events.Handler publishing e. Subscribe it asynchronously,
+// since it waits for the broker.
+func (f *Forwarder) Forward(ctx context.Context, e events.Event) error {
+	msg, err := f.encode(e)
+	if err != nil {
+		return err
+	}
+	topic := e.EventName()
+	if f.prefix != "" {
+		topic = f.prefix + "." + topic
+	}
+	return f.publisher.Publish(ctx, topic, msg)
+}
+
+func (f *Forwarder) encode(e events.Event) (Message, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return Message{}, fmt.Errorf("broker: generate id: %w", err)
+	}
+	envelope := Envelope{ID: hex.EncodeToString(id), Event: e.EventName(), OccurredAt: f.now().UTC(), Data: e}
+
+	msg := Message{ID: envelope.ID}
+	var err error
+	switch f.encoding {
+	case EncodingProtobuf:
+		msg.ContentType = "application/x-protobuf"
+		msg.Data, err = marshalProto(envelope)
+	default:
+		msg.ContentType = "application/json"
+		msg.Data, err = json.Marshal(envelope)
+	}
+	if err != nil {
+		return Message{}, fmt.Errorf("broker: encode %s: %w", e.EventName(), err)
+	}
+	return msg, nil
+}
@@ -0,0 +1,104 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/cbwinslow/template2/examples/go/pkg/events"
+)
+
+// recordingPublisher keeps what it is asked to publish
+type recordingPublisher struct {
+	topics   []string
+	messages []Message
+}
+
+func (p *recordingPublisher) Publish(_ context.Context, topic string, msg Message) error {
+	p.topics = append(p.topics, topic)
+	p.messages = append(p.messages, msg)
+	return nil
+}
+
+func (p *recordingPublisher) Close() error { return nil }
+
+func TestForwarderPublishesJSON(t *testing.T) {
+	pub := &recordingPublisher{}
+	f, err := NewForwarder(pub, "template2.events", EncodingJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Forward(context.Background(), events.UserCreated{UserID: 3, Email: "hana@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pub.topics) != 1 || pub.topics[0] != "template2.events.user.created" {
+		t.Fatalf("topics = %v", pub.topics)
+	}
+	msg := pub.messages[0]
+	var got struct {
+		ID    string `json:"id"`
+		Event string `json:"event"`
+		Data  struct {
+			UserID int    `json:"user_id"`
+			Email  string `json:"email"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(msg.Data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if msg.ContentType != "application/json" || got.ID != msg.ID || got.Event != events.NameUserCreated || got.Data.UserID != 3 || got.Data.Email != "hana@example.com" {
+		t.Errorf("message = %s (%s)", msg.Data, msg.ContentType)
+	}
+}
+
+func TestForwarderPublishesProtobuf(t *testing.T) {
+	pub := &recordingPublisher{}
+	f, err := NewForwarder(pub, "", EncodingProtobuf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.now = func() time.Time { return time.Unix(1700000000, 0) }
+	if err := f.Forward(context.Background(), events.LoginFailed{UserID: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if pub.topics[0] != events.NameLoginFailed {
+		t.Errorf("topic = %q, want the bare event name", pub.topics[0])
+	}
+
+	fields := map[protowire.Number][]byte{}
+	b := pub.messages[0].Data
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 || typ != protowire.BytesType {
+			t.Fatalf("malformed message at %d bytes left", len(b))
+		}
+		value, m := protowire.ConsumeBytes(b[n:])
+		if m < 0 {
+			t.Fatal("malformed field")
+		}
+		fields[num] = value
+		b = b[n+m:]
+	}
+	if string(fields[1]) != pub.messages[0].ID || string(fields[2]) != events.NameLoginFailed {
+		t.Errorf("id, event = %q, %q", fields[1], fields[2])
+	}
+	data := &structpb.Struct{}
+	if err := proto.Unmarshal(fields[4], data); err != nil {
+		t.Fatal(err)
+	}
+	if data.Fields["user_id"].GetNumberValue() != 3 {
+		t.Errorf("data = %v", data)
+	}
+}
+
+func TestNewForwarderRejectsUnknownEncoding(t *testing.T) {
+	if _, err := NewForwarder(&recordingPublisher{}, "", "avro"); err == nil {
+		t.Error("avro accepted")
+	}
+}
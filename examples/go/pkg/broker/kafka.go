@@ -0,0 +1,69 @@
+package broker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// kafkaProducer is the part of *kgo.Client the publisher uses
+type kafkaProducer interface {
+	ProduceSync(ctx context.Context, rs ...*kgo.Record) kgo.ProduceResults
+	Close()
+}
+
+// KafkaPublisher produces messages to Kafka topics with franz-go. The
+// producer is idempotent and waits for all in-sync replicas, so a record
+// retried after a lost acknowledgement is written once. Records are keyed
+// by message ID and carry it and the content type as headers. Topics are
+// not created on demand.
+type KafkaPublisher struct {
+	client kafkaProducer
+}
+
+// NewKafkaPublisher creates a publisher for the cluster reachable through
+// seeds, broker addresses such as kafka:9092. timeout bounds dialing a
+// broker and delivering each record.
+func NewKafkaPublisher(seeds []string, timeout time.Duration) (*KafkaPublisher, error) {
+	for _, seed := range seeds {
+		if seed == "" || strings.Contains(seed, "://") {
+			return nil, fmt.Errorf("broker: Kafka brokers must be host:port addresses")
+		}
+	}
+	client, err := kgo.NewClient(
+		kgo.SeedBrokers(seeds...),
+		kgo.ClientID("template2"),
+		kgo.DialTimeout(timeout),
+		kgo.RecordDeliveryTimeout(timeout),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("broker: kafka: %w", err)
+	}
+	return &KafkaPublisher{client: client}, nil
+}
+
+// Publish implements Publisher
+func (p *KafkaPublisher) Publish(ctx context.Context, topic string, msg Message) error {
+	record := &kgo.Record{
+		Topic: topic,
+		Key:   []byte(msg.ID),
+		Value: msg.Data,
+		Headers: []kgo.RecordHeader{
+			{Key: "id", Value: []byte(msg.ID)},
+			{Key: "content-type", Value: []byte(msg.ContentType)},
+		},
+	}
+	if err := p.client.ProduceSync(ctx, record).FirstErr(); err != nil {
+		return fmt.Errorf("broker: kafka: produce to %s: %w", topic, err)
+	}
+	return nil
+}
+
+// Close implements Publisher
+func (p *KafkaPublisher) Close() error {
+	p.client.Close()
+	return nil
+}
@@ -0,0 +1,81 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// recordingProducer stands in for the franz-go client, failing produces to
+// topics it does not know
+type recordingProducer struct {
+	topics   map[string]bool
+	produced []*kgo.Record
+	closed   bool
+}
+
+func (p *recordingProducer) ProduceSync(_ context.Context, rs ...*kgo.Record) kgo.ProduceResults {
+	results := make(kgo.ProduceResults, 0, len(rs))
+	for _, r := range rs {
+		if !p.topics[r.Topic] {
+			results = append(results, kgo.ProduceResult{Record: r, Err: kerr.UnknownTopicOrPartition})
+			continue
+		}
+		p.produced = append(p.produced, r)
+		results = append(results, kgo.ProduceResult{Record: r})
+	}
+	return results
+}
+
+func (p *recordingProducer) Close() {
+	p.closed = true
+}
+
+func TestKafkaPublisherProducesKeyedRecords(t *testing.T) {
+	producer := &recordingProducer{topics: map[string]bool{"template2.events.user.created": true}}
+	p := &KafkaPublisher{client: producer}
+
+	msg := Message{ID: "abc", ContentType: "application/x-protobuf", Data: []byte{0x0a, 0x01, 'x'}}
+	if err := p.Publish(context.Background(), "template2.events.user.created", msg); err != nil {
+		t.Fatal(err)
+	}
+	if len(producer.produced) != 1 {
+		t.Fatalf("produced %d records", len(producer.produced))
+	}
+	record := producer.produced[0]
+	if string(record.Key) != "abc" || string(record.Value) != "\x0a\x01x" {
+		t.Errorf("record key %q value %q", record.Key, record.Value)
+	}
+	headers := map[string]string{}
+	for _, h := range record.Headers {
+		headers[h.Key] = string(h.Value)
+	}
+	if headers["id"] != "abc" || headers["content-type"] != "application/x-protobuf" {
+		t.Errorf("headers = %v", headers)
+	}
+
+	err := p.Publish(context.Background(), "missing", Message{ID: "def", Data: []byte("{}")})
+	if !errors.Is(err, kerr.UnknownTopicOrPartition) || !strings.Contains(err.Error(), "missing") {
+		t.Errorf("missing topic: err = %v", err)
+	}
+
+	if err := p.Close(); err != nil || !producer.closed {
+		t.Errorf("Close = %v, closed %t", err, producer.closed)
+	}
+}
+
+func TestNewKafkaPublisherRequiresBrokerAddresses(t *testing.T) {
+	if _, err := NewKafkaPublisher([]string{"http://kafka-rest:8082"}, time.Second); err == nil {
+		t.Error("REST Proxy URL accepted as a broker address")
+	}
+	p, err := NewKafkaPublisher([]string{"kafka-1:9092", "kafka-2:9092"}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Close()
+}
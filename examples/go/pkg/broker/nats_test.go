@@ -0,0 +1,109 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// startNATS runs a JetStream-enabled server with a stream capturing the
+// subjects under "events.", returning the URL to publish to and the stream
+func startNATS(t *testing.T) (string, jetstream.Stream) {
+	t.Helper()
+	srv, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      server.RANDOM_PORT,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+		Username:  "app",
+		Password:  "secret",
+		NoLog:     true,
+		NoSigs:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Start()
+	t.Cleanup(srv.Shutdown)
+	if !srv.ReadyForConnections(5 * time.Second) {
+		t.Fatal("NATS server did not start")
+	}
+	url := "nats://app:secret@" + srv.Addr().String()
+
+	conn, err := nats.Connect(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(conn.Close)
+	js, err := jetstream.New(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream, err := js.CreateStream(context.Background(), jetstream.StreamConfig{Name: "EVENTS", Subjects: []string{"events.>"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return url, stream
+}
+
+func TestNATSPublisherWaitsForJetStreamAck(t *testing.T) {
+	url, stream := startNATS(t)
+	p, err := NewNATSPublisher(url, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	ctx := context.Background()
+	for i := 1; i <= 2; i++ {
+		msg := Message{ID: "id-" + strconv.Itoa(i), ContentType: "application/json", Data: []byte(`{"n":` + strconv.Itoa(i) + `}`)}
+		if err := p.Publish(ctx, "events.user.created", msg); err != nil {
+			t.Fatalf("publish %d: %v", i, err)
+		}
+	}
+	// Published again, as after a lost ack; the stream drops it
+	if err := p.Publish(ctx, "events.user.created", Message{ID: "id-2", Data: []byte(`{"n":2}`)}); err != nil {
+		t.Fatalf("republish: %v", err)
+	}
+	if err := p.Publish(ctx, "other.user.created", Message{ID: "id-3"}); !errors.Is(err, ErrNoStream) {
+		t.Errorf("uncaptured subject: err = %v, want ErrNoStream", err)
+	}
+
+	info, err := stream.Info(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.State.Msgs != 2 {
+		t.Errorf("stream holds %d messages, want 2", info.State.Msgs)
+	}
+	stored, err := stream.GetMsg(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(stored.Data) != `{"n":2}` || stored.Header.Get(nats.MsgIdHdr) != "id-2" || stored.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("stored %s with headers %v", stored.Data, stored.Header)
+	}
+}
+
+func TestNATSPublisherStartsWithoutTheServer(t *testing.T) {
+	p, err := NewNATSPublisher("nats://127.0.0.1:1", 100*time.Millisecond)
+	if err != nil {
+		t.Fatalf("NewNATSPublisher with the server down: %v", err)
+	}
+	defer p.Close()
+	if err := p.Publish(context.Background(), "events.a", Message{ID: "1"}); err == nil {
+		t.Error("publish without a server succeeded")
+	}
+}
+
+func TestNewNATSPublisherChecksURL(t *testing.T) {
+	if _, err := NewNATSPublisher("http://nats:4222", time.Second); err == nil {
+		t.Error("http URL accepted")
+	}
+}
@@ -0,0 +1,51 @@
+package broker
+
+import (
+	"encoding/json"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// marshalProto encodes envelope as the protobuf message
+//
+//	message Event {
+//	  string id = 1;
+//	  string event = 2;
+//	  google.protobuf.Timestamp occurred_at = 3;
+//	  google.protobuf.Struct data = 4;
+//	}
+//
+// The event's fields go into data under their JSON names, so consumers
+// need no schema per event.
+func marshalProto(envelope Envelope) ([]byte, error) {
+	raw, err := json.Marshal(envelope.Data)
+	if err != nil {
+		return nil, err
+	}
+	data := &structpb.Struct{}
+	if err := data.UnmarshalJSON(raw); err != nil {
+		return nil, err
+	}
+	occurredAt, err := proto.Marshal(timestamppb.New(envelope.OccurredAt))
+	if err != nil {
+		return nil, err
+	}
+	fields, err := proto.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendString(b, envelope.ID)
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	b = protowire.AppendString(b, envelope.Event)
+	b = protowire.AppendTag(b, 3, protowire.BytesType)
+	b = protowire.AppendBytes(b, occurredAt)
+	b = protowire.AppendTag(b, 4, protowire.BytesType)
+	b = protowire.AppendBytes(b, fields)
+	return b, nil
+}
@@ -0,0 +1,1957 @@
+// Package config provides the typed application configuration
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Environment profiles selected by APP_ENV
+const (
+	EnvDev     = "dev"
+	EnvStaging = "staging"
+	EnvProd    = "prod"
+)
+
+// Config holds the application configuration
+type Config struct {
+	// Env is the profile the defaults were taken from
+	Env         string
+	Server      ServerConfig
+	TLS         TLSConfig
+	GRPC        GRPCConfig
+	Auth        AuthConfig
+	Users       UsersConfig
+	Database    DatabaseConfig
+	Mail        MailConfig
+	Files       FilesConfig
+	Avatars     AvatarsConfig
+	Jobs        JobsConfig
+	Scheduler   SchedulerConfig
+	Broker      BrokerConfig
+	Cache       CacheConfig
+	Idempotency IdempotencyConfig
+	CORS        CORSConfig
+	RateLimit   RateLimitConfig
+	Health      HealthConfig
+	Logging     LoggingConfig
+	Tracing     TracingConfig
+	Flags       FlagsConfig
+	Experiments []ExperimentConfig
+}
+
+// ServerConfig controls the HTTP server
+type ServerConfig struct {
+	// Addr is the address the server listens on
+	Addr string
+	// ReadTimeout, WriteTimeout and IdleTimeout bound each connection
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	IdleTimeout  time.Duration
+	// ShutdownTimeout is how long in-flight requests get to finish on shutdown
+	ShutdownTimeout time.Duration
+	// RequestTimeout is the deadline applied to requests without a route override
+	RequestTimeout time.Duration
+	// RouteTimeouts overrides RequestTimeout for "METHOD /pattern" or "/pattern"
+	RouteTimeouts map[string]time.Duration
+	// KeepAlives enables HTTP keep-alives; they are always disabled while
+	// the server drains on shutdown
+	KeepAlives bool
+	// TrustedProxies are the peers whose X-Forwarded-For and X-Real-IP
+	// headers name the client, as rate limits and login throttling see it.
+	// Every other peer, and every peer when empty, is the client itself.
+	TrustedProxies []netip.Prefix
+	// RequestIDReuseWindow is how long client request IDs are remembered
+	// to flag reuse in the access log
+	RequestIDReuseWindow time.Duration
+	// MaxBody caps the request body as sent on the wire
+	MaxBody int
+	// RouteMaxBody overrides MaxBody for "METHOD /pattern" or "/pattern"
+	RouteMaxBody map[string]int
+	// MaxDecompressedBody caps the inflated size of gzip request bodies;
+	// a lower MaxBody or RouteMaxBody holds a request to that instead
+	MaxDecompressedBody int
+	// MultipartMemory is how many bytes of a multipart upload are buffered
+	// in memory before the rest spills to temporary files
+	MultipartMemory int
+	// Swagger serves the OpenAPI spec at /openapi.json and Swagger UI
+	// under /swagger
+	Swagger bool
+	// SwaggerAuth is the "user:password" the docs ask for in release mode;
+	// without it they are only served in debug mode
+	SwaggerAuth string
+	// OpenAPIValidation rejects API requests that do not match the
+	// generated OpenAPI spec with 400
+	OpenAPIValidation bool
+	// OpenAPIResponseValidation logs API responses that do not match the
+	// spec. It only takes effect in debug mode.
+	OpenAPIResponseValidation bool
+	// PrettyJSON indents JSON responses
+	PrettyJSON bool
+	// SecurityHeaders adds the browser hardening headers to every response.
+	// The Content-Security-Policy, Strict-Transport-Security max-age,
+	// X-Frame-Options and Referrer-Policy they send can be changed; an empty
+	// value or zero max-age leaves the header out.
+	SecurityHeaders       bool
+	ContentSecurityPolicy string
+	HSTSMaxAge            time.Duration
+	FrameOptions          string
+	ReferrerPolicy        string
+	// Compression encodes responses of at least CompressionMinSize bytes
+	// with brotli or gzip. CompressionExcludedTypes lists media types to
+	// leave alone on top of the already compressed formats.
+	Compression              bool
+	CompressionMinSize       int
+	CompressionExcludedTypes []string
+	// SelfTest exercises tokens, passwords and the user store at startup
+	// and refuses to start if any of them fail
+	SelfTest bool
+}
+
+// AuthConfig controls token issuance and how clients present tokens
+type AuthConfig struct {
+	// JWTSecret signs access tokens; a random key is used when empty
+	JWTSecret string
+	TokenTTL  time.Duration
+	// RefreshTTL is how long a refresh token is valid; RefreshGrace is how
+	// long a rotated one may still be exchanged for a pair in its family
+	RefreshTTL   time.Duration
+	RefreshGrace time.Duration
+	// StoreMaxAttempts and StoreRetryBackoff bound retries of transient
+	// auth store failures
+	StoreMaxAttempts  int
+	StoreRetryBackoff time.Duration
+	// Cookie enables reading and setting the access token via a cookie
+	Cookie CookieConfig
+	// Sessions replaces tokens with server-side sessions named by a cookie,
+	// for browser apps
+	Sessions SessionsConfig
+	// Stuffing throttles IPs failing logins for many accounts
+	Stuffing StuffingConfig
+	// ClientCert authenticates callers by the certificate CN an
+	// mTLS-terminating proxy forwards
+	ClientCert ClientCertConfig
+	// OIDC lists the external identity providers users may sign in with
+	OIDC []OIDCProviderConfig
+	// EmailVerification registers users unverified and keeps them out of
+	// protected routes until they open the link mailed to them
+	EmailVerification bool
+	// VerificationURL is where the mailed link points, normally the
+	// /api/v1/auth/verify route; VerificationTTL is how long it works
+	VerificationURL string
+	VerificationTTL time.Duration
+	// PasswordReset controls the forgot and reset password endpoints
+	PasswordReset PasswordResetConfig
+	// TwoFactor controls TOTP two-factor authentication
+	TwoFactor TwoFactorConfig
+}
+
+// TwoFactorConfig controls TOTP two-factor authentication
+type TwoFactorConfig struct {
+	// Enabled serves the /auth/2fa endpoints and makes logins of enrolled
+	// accounts answer with a challenge
+	Enabled bool
+	// Issuer labels the account in authenticator apps
+	Issuer string
+	// ChallengeTTL is how long a login has to supply the second factor
+	ChallengeTTL time.Duration
+}
+
+// PasswordResetConfig controls password resets by mailed link
+type PasswordResetConfig struct {
+	// Enabled serves /auth/forgot-password and /auth/reset-password
+	Enabled bool
+	// URL is where the mailed link points, the page that collects the new
+	// password; TTL is how long the link works
+	URL string
+	TTL time.Duration
+	// Limit bounds forgot-password requests per client IP, on top of the
+	// auth group's budget
+	Limit RateLimitRule
+}
+
+// OIDCProviderConfig describes an OAuth2 client registered with an identity
+// provider. "google" and "github" need no issuer; any other name is a
+// generic OIDC issuer.
+type OIDCProviderConfig struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+}
+
+// ClientCertConfig describes the trusted client certificate header
+type ClientCertConfig struct {
+	// Header carries the certificate subject CN; empty disables it
+	Header string
+	// TrustedProxies are the peers allowed to set Header
+	TrustedProxies []netip.Prefix
+}
+
+// StuffingConfig controls credential stuffing detection on login
+type StuffingConfig struct {
+	// MaxAccounts distinct failed accounts within Window block the IP for
+	// Block; zero disables detection
+	MaxAccounts int
+	Window      time.Duration
+	Block       time.Duration
+}
+
+// CookieConfig describes the opt-in access token cookie
+type CookieConfig struct {
+	Enabled bool
+	Name    string
+	Domain  string
+	Secure  bool
+}
+
+// SessionsConfig describes the opt-in cookie sessions. Logins then set
+// the session cookie, Name, instead of returning tokens, and requests
+// carrying it must echo the CSRFCookie in X-CSRF-Token to change state.
+// Backend is "memory" for a single replica or "redis" to share sessions
+// through RedisURL.
+type SessionsConfig struct {
+	Enabled    bool
+	Name       string
+	CSRFCookie string
+	Domain     string
+	Secure     bool
+	Backend    string
+	RedisURL   string
+}
+
+// UsersConfig controls user management behavior
+type UsersConfig struct {
+	// DefaultRole is assigned when a client creates a user without a role
+	DefaultRole string
+	// DefaultActive is applied when a client omits the active flag
+	DefaultActive bool
+	// AdminEmailDomain, when set, requires admins to use an address in it
+	AdminEmailDomain string
+	// MaxUsers caps the in-memory store; zero means unlimited
+	MaxUsers int
+	// StatementTimeout bounds a single store operation; zero means unbounded
+	StatementTimeout time.Duration
+	// MaxQueryParams caps the query values accepted by user listings
+	MaxQueryParams int
+	// MaxQueryLength caps the raw query string length of user listings
+	MaxQueryLength int
+	// DefaultSort orders user listings that request no sort, as "field" or
+	// "-field"; ties are always broken by ID
+	DefaultSort string
+	// DefaultPageSize is the listing page size when no limit is requested;
+	// MaxPageSize is the largest limit accepted
+	DefaultPageSize int
+	MaxPageSize     int
+	// OptionalFields is "omitempty" to drop empty optional fields from
+	// user responses or "always" to include them
+	OptionalFields string
+}
+
+// DatabaseConfig selects where users are stored
+type DatabaseConfig struct {
+	// Backend is "memory" for the seeded in-process store or "postgres"
+	Backend string
+	// URL is the PostgreSQL connection string
+	URL string
+	// MaxOpenConns, MaxIdleConns and ConnMaxLifetime bound the pool
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	// AutoMigrate applies pending migrations at startup; otherwise run
+	// "migrate up" before deploying
+	AutoMigrate bool
+}
+
+// MailConfig controls outgoing email
+type MailConfig struct {
+	// SMTPAddr is the relay's host:port. With neither it nor APIURL set
+	// messages are logged instead of sent.
+	SMTPAddr string
+	// Username and Password authenticate to the relay when set
+	Username string
+	Password string
+	// APIURL is the send URL of a SendGrid-style HTTP API, used instead of
+	// a relay; APIKey authenticates to it
+	APIURL string
+	APIKey string
+	// From is the sender address, required with SMTPAddr or APIURL
+	From string
+	// TemplatesDir overrides the built-in mail templates with the .txt and
+	// .html templates in the directory
+	TemplatesDir string
+}
+
+// FilesConfig controls file uploads
+type FilesConfig struct {
+	// Enabled serves the /protected/files upload endpoints and the signed
+	// /files download route
+	Enabled bool
+	// Backend is "local" to keep files below Dir or "s3" for an
+	// S3-compatible bucket
+	Backend string
+	Dir     string
+	S3      S3Config
+	// MaxSize caps the size of one file in bytes
+	MaxSize int
+	// AllowedTypes are the media types uploads may have, judged by their
+	// content rather than the type the client declares
+	AllowedTypes []string
+	// URLTTL is how long a signed download URL works
+	URLTTL time.Duration
+	// SigningSecret signs download URLs; a random key is used when empty,
+	// so URLs stop working on restart and differ between replicas
+	SigningSecret string
+}
+
+// AvatarsConfig controls user avatars. They are kept in the store Files
+// describes, whether or not file uploads are enabled.
+type AvatarsConfig struct {
+	// Enabled serves PUT and GET /users/{id}/avatar
+	Enabled bool
+	// MaxSize caps an uploaded image in bytes; MinSide and MaxSide bound
+	// its width and height in pixels
+	MaxSize int
+	MinSide int
+	MaxSide int
+	// Workers is how many avatars are resized at once
+	Workers int
+}
+
+// JobsConfig controls the background job queue, which sends the mail of
+// registrations and password resets
+type JobsConfig struct {
+	// Backend is "memory" to keep jobs in the process that enqueued them or
+	// "redis" to keep them across restarts and share them between replicas
+	// through RedisURL
+	Backend  string
+	RedisURL string
+	// Workers is how many jobs run at once
+	Workers int
+	// MaxAttempts is how many times a job runs before it is moved to the
+	// dead letter queue; RetryBackoff is the delay after its first failure,
+	// doubling after each further one up to MaxBackoff
+	MaxAttempts  int
+	RetryBackoff time.Duration
+	MaxBackoff   time.Duration
+	// Timeout bounds a single run of a job
+	Timeout time.Duration
+}
+
+// SchedulerConfig controls the periodic maintenance tasks
+type SchedulerConfig struct {
+	// TokenCleanupInterval is how often expired refresh and reset tokens
+	// are deleted; SessionCleanupInterval is how often expired sessions
+	// are. Zero disables the task.
+	TokenCleanupInterval   time.Duration
+	SessionCleanupInterval time.Duration
+	// AuditPruneInterval is how often audit records past
+	// Logging.AuditRetention are deleted
+	AuditPruneInterval time.Duration
+	// Jitter delays each run by a random duration up to Jitter, so
+	// replicas do not all run a task at once
+	Jitter time.Duration
+}
+
+// TLSConfig controls serving HTTPS on Server.Addr. Certificates come
+// either from CertFile and KeyFile or, for AutocertDomains, from Let's
+// Encrypt; with neither the server speaks plain HTTP.
+type TLSConfig struct {
+	CertFile string
+	KeyFile  string
+	// AutocertDomains are the host names certificates are requested for.
+	// AutocertCacheDir keeps them across restarts, and AutocertEmail
+	// receives expiry notices.
+	AutocertDomains  []string
+	AutocertCacheDir string
+	AutocertEmail    string
+	// RedirectAddr, if set, is where a plain HTTP listener redirects to
+	// HTTPS. Autocert answers HTTP challenges there, so it is usually ":80".
+	RedirectAddr string
+	// ClientCAFile is a PEM bundle of the CAs client certificates are
+	// verified against; callers presenting one are authenticated by its
+	// CN. ClientAuth is "require" to refuse handshakes without a valid
+	// certificate, for deployments only services call, or "optional" to
+	// keep accepting tokens from callers without one.
+	ClientCAFile string
+	ClientAuth   string
+}
+
+// Enabled reports whether the server serves HTTPS
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != "" || len(c.AutocertDomains) > 0
+}
+
+// GRPCConfig controls the gRPC server, which serves the users and auth
+// APIs on a second port
+type GRPCConfig struct {
+	Enabled bool
+	// Addr is the address the gRPC server listens on
+	Addr string
+	// Gateway serves the gRPC services as JSON over HTTP on GatewayAddr, at
+	// the HTTP bindings in proto/: the paths of the HTTP API without the
+	// /api prefix
+	Gateway     bool
+	GatewayAddr string
+	// GatewayCompat also serves the gateway's routes under /api, so that
+	// clients of the HTTP API can use it with the paths they already call
+	GatewayCompat bool
+}
+
+// BrokerConfig controls publishing the domain events to a message broker
+type BrokerConfig struct {
+	// Backend is "" to publish nowhere, "nats" to publish to NATS JetStream
+	// at URL (nats://host:4222 or tls://host:4222) or "kafka" to produce to
+	// the Kafka cluster whose brokers URL lists, such as kafka-1:9092. Either
+	// takes a comma-separated list.
+	Backend string
+	URL     string
+	// TopicPrefix is put before the event name, so user.created is
+	// published to "<TopicPrefix>.user.created"
+	TopicPrefix string
+	// Encoding is "json" or "protobuf"
+	Encoding string
+	// Timeout bounds connecting to the broker and each publish
+	Timeout time.Duration
+}
+
+// S3Config describes the bucket files are kept in with the s3 backend
+type S3Config struct {
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+}
+
+// CacheConfig controls the short-lived GET response cache
+type CacheConfig struct {
+	// TTL is how long a cached response is served; zero disables the cache
+	TTL time.Duration
+	// Backend is "memory" for a per-replica LRU of MaxEntries responses or
+	// "redis" to share the cache, and its invalidation, across replicas
+	// through RedisURL
+	Backend    string
+	MaxEntries int
+	RedisURL   string
+}
+
+// IdempotencyConfig controls replaying writes retried with an
+// Idempotency-Key
+type IdempotencyConfig struct {
+	// TTL is how long a response is kept for replay; zero disables
+	// Idempotency-Key handling
+	TTL time.Duration
+	// Backend is "memory" to recognize retries reaching the same replica or
+	// "redis" to recognize them on any replica through RedisURL
+	Backend  string
+	RedisURL string
+}
+
+// CORSConfig controls cross-origin browser access
+type CORSConfig struct {
+	// AllowedOrigins are the origins allowed to call the API, or "*" for
+	// any; empty disables CORS
+	AllowedOrigins []string
+	// AllowCredentials lets browsers send cookies and auth headers; it
+	// cannot be combined with "*"
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache a preflight response
+	MaxAge time.Duration
+}
+
+// RateLimitConfig controls the per-client request budget
+type RateLimitConfig struct {
+	// Requests is the number of requests allowed per Window
+	Requests int
+	Window   time.Duration
+	// FailOpen allows requests when the limit store is unavailable
+	FailOpen bool
+	// Backend is "memory" for per-replica budgets or "redis" to share them
+	// across replicas through RedisURL, falling back to memory while Redis
+	// is unreachable
+	Backend  string
+	RedisURL string
+	// Groups adds a stricter budget for a route group on top of the global
+	// one, keyed by group name: "auth", "users" or "admin"
+	Groups map[string]RateLimitRule
+}
+
+// RateLimitRule is a budget of Requests per Window
+type RateLimitRule struct {
+	Requests int
+	Window   time.Duration
+}
+
+// HealthConfig controls the optional health checks
+type HealthConfig struct {
+	// MaxGoroutines reports the service as degraded above this many
+	// goroutines; zero disables the check
+	MaxGoroutines int
+	// LivenessPaths and ReadinessPaths are the probe routes served in
+	// addition to /api/v1/health
+	LivenessPaths  []string
+	ReadinessPaths []string
+	// CheckTimeout bounds each dependency check readiness runs
+	CheckTimeout time.Duration
+}
+
+// LoggingConfig controls log output
+type LoggingConfig struct {
+	// Level is the minimum level written at startup, e.g. "debug" or
+	// "info"; admins may change it at runtime
+	Level string
+	// SamplingInitial entries with the same level and message are written
+	// each second, then only every SamplingThereafter-th; zero
+	// SamplingInitial writes them all
+	SamplingInitial    int
+	SamplingThereafter int
+	// File also writes the application log to this file, rotated at
+	// FileMaxSizeMB and pruned by FileMaxBackups and FileMaxAgeDays, where
+	// zero keeps rotated files
+	File           string
+	FileMaxSizeMB  int
+	FileMaxBackups int
+	FileMaxAgeDays int
+	// AccessLogFormat is empty for structured logs only, or "combined" to
+	// also write Combined Log Format lines to AccessLogFile
+	AccessLogFormat string
+	// AccessLogFile is the combined log destination; empty means stdout
+	AccessLogFile string
+	// Bodies adds JSON and form request and response bodies of up to
+	// BodyMaxBytes to the access log, masking the values of fields whose
+	// names contain one of RedactFields or of the built-in list of
+	// passwords, tokens, keys and emails
+	Bodies       bool
+	BodyMaxBytes int
+	RedactFields []string
+	// AuditLogFile enables the audit log; rotated files sit beside it
+	AuditLogFile string
+	// AuditLogMaxSizeMB, AuditLogMaxBackups and AuditLogMaxAgeDays bound
+	// audit log retention; zero backups or age keeps rotated files
+	AuditLogMaxSizeMB  int
+	AuditLogMaxBackups int
+	AuditLogMaxAgeDays int
+	// AuditTrailSize is how many recent audit records are kept in memory
+	// for the admin API; zero disables the trail
+	AuditTrailSize int
+	// AuditStore is "memory" to serve the admin API from the trail, or
+	// "postgres" to keep every audit record in the database instead
+	AuditStore string
+	// AuditRetention is how long stored audit records are kept; zero keeps
+	// them forever. Scheduler.AuditPruneInterval sets how often older
+	// records are deleted.
+	AuditRetention time.Duration
+}
+
+// TracingConfig controls OpenTelemetry tracing
+type TracingConfig struct {
+	// Endpoint is the OTLP/HTTP collector URL, e.g. http://collector:4318;
+	// empty disables tracing
+	Endpoint string
+	// ServiceName is reported as the service.name resource attribute
+	ServiceName string
+	// SampleRatio is the fraction of new traces recorded, from 0 to 1;
+	// requests continuing a caller's trace follow the caller's decision
+	SampleRatio float64
+}
+
+// FlagsConfig controls feature flags
+type FlagsConfig struct {
+	// File is a YAML or JSON list of the flags shipped with the release;
+	// empty starts with none
+	File string
+	// Store keeps the flags admins change at runtime, which override File:
+	// "memory" on this replica only, "redis" through RedisURL or
+	// "postgres" in the database
+	Store    string
+	RedisURL string
+}
+
+// ExperimentConfig describes an A/B experiment and its rollout
+type ExperimentConfig struct {
+	Name     string
+	Variants []VariantConfig
+}
+
+// VariantConfig is one experiment arm receiving Percent of traffic
+type VariantConfig struct {
+	Name    string
+	Percent int
+}
+
+// Default returns the configuration used when nothing is overridden, which
+// is the prod profile
+func Default() *Config {
+	return &Config{
+		Env: EnvProd,
+		Server: ServerConfig{
+			Addr:                  ":8080",
+			ReadTimeout:           15 * time.Second,
+			WriteTimeout:          15 * time.Second,
+			IdleTimeout:           60 * time.Second,
+			ShutdownTimeout:       5 * time.Second,
+			RequestTimeout:        10 * time.Second,
+			KeepAlives:            true,
+			RequestIDReuseWindow:  5 * time.Minute,
+			MaxBody:               32 << 20,
+			MaxDecompressedBody:   10 << 20,
+			MultipartMemory:       8 << 20,
+			SecurityHeaders:       true,
+			ContentSecurityPolicy: apiContentSecurityPolicy,
+			HSTSMaxAge:            2 * 365 * 24 * time.Hour,
+			FrameOptions:          "DENY",
+			ReferrerPolicy:        "no-referrer",
+			Compression:           true,
+			CompressionMinSize:    1024,
+		},
+		Auth: AuthConfig{
+			TokenTTL:          15 * time.Minute,
+			RefreshTTL:        7 * 24 * time.Hour,
+			RefreshGrace:      10 * time.Second,
+			StoreMaxAttempts:  2,
+			StoreRetryBackoff: 50 * time.Millisecond,
+			Cookie: CookieConfig{
+				Name:   "access_token",
+				Secure: true,
+			},
+			Sessions: SessionsConfig{
+				Name:       "session",
+				CSRFCookie: "csrf_token",
+				Secure:     true,
+				Backend:    "memory",
+			},
+			Stuffing: StuffingConfig{
+				MaxAccounts: 10,
+				Window:      10 * time.Minute,
+				Block:       15 * time.Minute,
+			},
+			VerificationTTL: 24 * time.Hour,
+			PasswordReset: PasswordResetConfig{
+				TTL:   time.Hour,
+				Limit: RateLimitRule{Requests: 5, Window: time.Hour},
+			},
+			TwoFactor: TwoFactorConfig{
+				Issuer:       "template2",
+				ChallengeTTL: 5 * time.Minute,
+			},
+		},
+		Users: UsersConfig{
+			DefaultRole:      "user",
+			DefaultActive:    true,
+			StatementTimeout: 5 * time.Second,
+			MaxQueryParams:   20,
+			MaxQueryLength:   2048,
+			DefaultSort:      "id",
+			DefaultPageSize:  20,
+			MaxPageSize:      100,
+			OptionalFields:   "omitempty",
+		},
+		Database: DatabaseConfig{
+			Backend:         "memory",
+			MaxOpenConns:    10,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: 30 * time.Minute,
+		},
+		Files: FilesConfig{
+			Backend: "local",
+			Dir:     "uploads",
+			MaxSize: 10 << 20,
+			AllowedTypes: []string{
+				"image/jpeg", "image/png", "image/gif", "image/webp", "application/pdf", "text/plain",
+			},
+			URLTTL: 15 * time.Minute,
+			S3: S3Config{
+				Region: "us-east-1",
+			},
+		},
+		Avatars: AvatarsConfig{
+			MaxSize: 5 << 20,
+			MinSide: 32,
+			MaxSide: 4096,
+			Workers: 2,
+		},
+		Jobs: JobsConfig{
+			Backend:      "memory",
+			Workers:      4,
+			MaxAttempts:  5,
+			RetryBackoff: 10 * time.Second,
+			MaxBackoff:   10 * time.Minute,
+			Timeout:      time.Minute,
+		},
+		Scheduler: SchedulerConfig{
+			TokenCleanupInterval:   time.Hour,
+			SessionCleanupInterval: 15 * time.Minute,
+			AuditPruneInterval:     time.Hour,
+			Jitter:                 time.Minute,
+		},
+		GRPC: GRPCConfig{
+			Addr:        ":9090",
+			GatewayAddr: ":8081",
+		},
+		Broker: BrokerConfig{
+			TopicPrefix: "template2.events",
+			Encoding:    "json",
+			Timeout:     5 * time.Second,
+		},
+		TLS: TLSConfig{
+			AutocertCacheDir: "autocert",
+			ClientAuth:       "require",
+		},
+		Cache: CacheConfig{
+			Backend:    "memory",
+			MaxEntries: 1000,
+		},
+		Idempotency: IdempotencyConfig{
+			TTL:     24 * time.Hour,
+			Backend: "memory",
+		},
+		CORS: CORSConfig{
+			MaxAge: 10 * time.Minute,
+		},
+		RateLimit: RateLimitConfig{
+			Requests: 100,
+			Window:   time.Minute,
+			FailOpen: true,
+			Backend:  "memory",
+		},
+		Health: HealthConfig{
+			LivenessPaths:  []string{"/livez", "/healthz"},
+			ReadinessPaths: []string{"/readyz"},
+			CheckTimeout:   2 * time.Second,
+		},
+		Logging: LoggingConfig{
+			Level:              "info",
+			SamplingInitial:    100,
+			SamplingThereafter: 100,
+			FileMaxSizeMB:      100,
+			FileMaxBackups:     10,
+			FileMaxAgeDays:     30,
+			BodyMaxBytes:       4096,
+			AuditLogMaxSizeMB:  100,
+			AuditLogMaxBackups: 10,
+			AuditLogMaxAgeDays: 30,
+			AuditTrailSize:     1000,
+			AuditStore:         "memory",
+			AuditRetention:     90 * 24 * time.Hour,
+		},
+		Flags: FlagsConfig{
+			Store: "memory",
+		},
+		Tracing: TracingConfig{
+			ServiceName: "template2-api",
+			SampleRatio: 1,
+		},
+	}
+}
+
+const (
+	// apiContentSecurityPolicy lets responses load nothing and be framed
+	// nowhere, which suits JSON
+	apiContentSecurityPolicy = "default-src 'none'; frame-ancestors 'none'"
+	// docsContentSecurityPolicy also allows the inline script and styles
+	// and the data: images of Swagger UI
+	docsContentSecurityPolicy = "default-src 'self'; script-src 'self' 'unsafe-inline'; " +
+		"style-src 'self' 'unsafe-inline'; img-src 'self' data:; frame-ancestors 'none'"
+)
+
+// Profile returns the defaults for an environment profile. dev serves the
+// API docs, indents JSON, logs at debug level without sampling, allows the
+// auth cookie over plain HTTP and CORS from any origin, migrates the
+// database at startup and requires email verification with links to
+// localhost; staging serves the docs, with a Content-Security-Policy
+// letting Swagger UI run, and pins browsers to HTTPS for a day only, but
+// otherwise matches prod.
+func Profile(env string) (*Config, error) {
+	cfg := Default()
+	cfg.Env = env
+
+	switch env {
+	case EnvDev:
+		cfg.Server.Swagger = true
+		cfg.Server.OpenAPIValidation = true
+		cfg.Server.OpenAPIResponseValidation = true
+		cfg.Server.PrettyJSON = true
+		cfg.CORS.AllowedOrigins = []string{"*"}
+		cfg.Server.SecurityHeaders = false
+		cfg.Logging.Level = "debug"
+		cfg.Logging.SamplingInitial = 0
+		cfg.Logging.Bodies = true
+		cfg.Auth.Cookie.Secure = false
+		cfg.Auth.Sessions.Secure = false
+		cfg.Database.AutoMigrate = true
+		cfg.Auth.EmailVerification = true
+		cfg.Auth.VerificationURL = "http://localhost:8080/api/v1/auth/verify"
+	case EnvStaging:
+		cfg.Server.Swagger = true
+		cfg.Server.ContentSecurityPolicy = docsContentSecurityPolicy
+		cfg.Server.HSTSMaxAge = 24 * time.Hour
+		cfg.Server.OpenAPIValidation = true
+	case EnvProd:
+	default:
+		return nil, fmt.Errorf("config: unknown APP_ENV %q", env)
+	}
+	return cfg, nil
+}
+
+// FromEnv returns the configuration from the environment and, when
+// CONFIG_FILE is set, that file; see Load
+func FromEnv() (*Config, error) {
+	return Load(nil)
+}
+
+// build returns the APP_ENV profile (prod by default) overridden by the
+// settings lookup finds
+func build(lookup lookupFunc) (*Config, error) {
+	env := EnvProd
+	if v, ok := lookup("APP_ENV"); ok && v != "" {
+		env = v
+	}
+	cfg, err := Profile(env)
+	if err != nil {
+		return nil, err
+	}
+
+	if v, ok := lookup("JWT_SECRET"); ok {
+		cfg.Auth.JWTSecret = v
+	}
+	if err := envDuration(lookup, "JWT_TTL", &cfg.Auth.TokenTTL); err != nil {
+		return nil, err
+	}
+	if err := envDuration(lookup, "REFRESH_TOKEN_TTL", &cfg.Auth.RefreshTTL); err != nil {
+		return nil, err
+	}
+	if err := envDuration(lookup, "REFRESH_TOKEN_GRACE", &cfg.Auth.RefreshGrace); err != nil {
+		return nil, err
+	}
+	if err := envInt(lookup, "AUTH_STORE_MAX_ATTEMPTS", &cfg.Auth.StoreMaxAttempts); err != nil {
+		return nil, err
+	}
+	if err := envDuration(lookup, "AUTH_STORE_RETRY_BACKOFF", &cfg.Auth.StoreRetryBackoff); err != nil {
+		return nil, err
+	}
+	if err := envInt(lookup, "LOGIN_STUFFING_MAX_ACCOUNTS", &cfg.Auth.Stuffing.MaxAccounts); err != nil {
+		return nil, err
+	}
+	if err := envDuration(lookup, "LOGIN_STUFFING_WINDOW", &cfg.Auth.Stuffing.Window); err != nil {
+		return nil, err
+	}
+	if err := envDuration(lookup, "LOGIN_STUFFING_BLOCK", &cfg.Auth.Stuffing.Block); err != nil {
+		return nil, err
+	}
+	if v, ok := lookup("CLIENT_CERT_HEADER"); ok {
+		cfg.Auth.ClientCert.Header = v
+	}
+	if err := envPrefixes(lookup, "CLIENT_CERT_TRUSTED_PROXIES", &cfg.Auth.ClientCert.TrustedProxies); err != nil {
+		return nil, err
+	}
+	var providers []string
+	envList(lookup, "OIDC_PROVIDERS", &providers)
+	for _, name := range providers {
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		provider := OIDCProviderConfig{Name: name}
+		provider.Issuer, _ = lookup(prefix + "ISSUER")
+		provider.ClientID, _ = lookup(prefix + "CLIENT_ID")
+		provider.ClientSecret, _ = lookup(prefix + "CLIENT_SECRET")
+		provider.RedirectURL, _ = lookup(prefix + "REDIRECT_URL")
+		cfg.Auth.OIDC = append(cfg.Auth.OIDC, provider)
+	}
+	if err := envBool(lookup, "AUTH_EMAIL_VERIFICATION", &cfg.Auth.EmailVerification); err != nil {
+		return nil, err
+	}
+	if v, ok := lookup("AUTH_VERIFICATION_URL"); ok {
+		cfg.Auth.VerificationURL = v
+	}
+	if err := envDuration(lookup, "AUTH_VERIFICATION_TTL", &cfg.Auth.VerificationTTL); err != nil {
+		return nil, err
+	}
+	if err := envBool(lookup, "AUTH_PASSWORD_RESET", &cfg.Auth.PasswordReset.Enabled); err != nil {
+		return nil, err
+	}
+	if v, ok := lookup("AUTH_PASSWORD_RESET_URL"); ok {
+		cfg.Auth.PasswordReset.URL = v
+	}
+	if err := envDuration(lookup, "AUTH_PASSWORD_RESET_TTL", &cfg.Auth.PasswordReset.TTL); err != nil {
+		return nil, err
+	}
+	if v, ok := lookup("AUTH_FORGOT_PASSWORD_LIMIT"); ok {
+		rule, err := parseRateLimitRule("AUTH_FORGOT_PASSWORD_LIMIT", v)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Auth.PasswordReset.Limit = rule
+	}
+	if err := envBool(lookup, "AUTH_TWO_FACTOR", &cfg.Auth.TwoFactor.Enabled); err != nil {
+		return nil, err
+	}
+	if v, ok := lookup("AUTH_TOTP_ISSUER"); ok {
+		cfg.Auth.TwoFactor.Issuer = v
+	}
+	if err := envDuration(lookup, "AUTH_TWO_FACTOR_CHALLENGE_TTL", &cfg.Auth.TwoFactor.ChallengeTTL); err != nil {
+		return nil, err
+	}
+	if err := envBool(lookup, "AUTH_COOKIE_ENABLED", &cfg.Auth.Cookie.Enabled); err != nil {
+		return nil, err
+	}
+	if v, ok := lookup("AUTH_COOKIE_NAME"); ok {
+		cfg.Auth.Cookie.Name = v
+	}
+	if v, ok := lookup("AUTH_COOKIE_DOMAIN"); ok {
+		cfg.Auth.Cookie.Domain = v
+	}
+	if err := envBool(lookup, "AUTH_COOKIE_SECURE", &cfg.Auth.Cookie.Secure); err != nil {
+		return nil, err
+	}
+	if err := envBool(lookup, "AUTH_SESSIONS_ENABLED", &cfg.Auth.Sessions.Enabled); err != nil {
+		return nil, err
+	}
+	if v, ok := lookup("AUTH_SESSION_COOKIE"); ok {
+		cfg.Auth.Sessions.Name = v
+	}
+	if v, ok := lookup("AUTH_CSRF_COOKIE"); ok {
+		cfg.Auth.Sessions.CSRFCookie = v
+	}
+	if v, ok := lookup("AUTH_SESSION_DOMAIN"); ok {
+		cfg.Auth.Sessions.Domain = v
+	}
+	if err := envBool(lookup, "AUTH_SESSION_SECURE", &cfg.Auth.Sessions.Secure); err != nil {
+		return nil, err
+	}
+	if v, ok := lookup("AUTH_SESSION_BACKEND"); ok {
+		cfg.Auth.Sessions.Backend = v
+	}
+	if v, ok := lookup("USER_DEFAULT_ROLE"); ok {
+		cfg.Users.DefaultRole = v
+	}
+	if err := envBool(lookup, "USER_DEFAULT_ACTIVE", &cfg.Users.DefaultActive); err != nil {
+		return nil, err
+	}
+	if v, ok := lookup("USER_ADMIN_EMAIL_DOMAIN"); ok {
+		cfg.Users.AdminEmailDomain = v
+	}
+	if err := envInt(lookup, "USER_STORE_MAX_USERS", &cfg.Users.MaxUsers); err != nil {
+		return nil, err
+	}
+	if err := envDuration(lookup, "DB_STATEMENT_TIMEOUT", &cfg.Users.StatementTimeout); err != nil {
+		return nil, err
+	}
+	if err := envInt(lookup, "QUERY_MAX_PARAMS", &cfg.Users.MaxQueryParams); err != nil {
+		return nil, err
+	}
+	if err := envInt(lookup, "QUERY_MAX_LENGTH", &cfg.Users.MaxQueryLength); err != nil {
+		return nil, err
+	}
+	if v, ok := lookup("USERS_DEFAULT_SORT"); ok {
+		cfg.Users.DefaultSort = v
+	}
+	if err := envInt(lookup, "USERS_DEFAULT_PAGE_SIZE", &cfg.Users.DefaultPageSize); err != nil {
+		return nil, err
+	}
+	if err := envInt(lookup, "USERS_MAX_PAGE_SIZE", &cfg.Users.MaxPageSize); err != nil {
+		return nil, err
+	}
+	if v, ok := lookup("JSON_OPTIONAL_FIELDS"); ok {
+		cfg.Users.OptionalFields = v
+	}
+	if v, ok := lookup("USER_STORE_BACKEND"); ok {
+		cfg.Database.Backend = v
+	}
+	if v, ok := lookup("DATABASE_URL"); ok {
+		cfg.Database.URL = v
+	}
+	if err := envInt(lookup, "DB_MAX_OPEN_CONNS", &cfg.Database.MaxOpenConns); err != nil {
+		return nil, err
+	}
+	if err := envInt(lookup, "DB_MAX_IDLE_CONNS", &cfg.Database.MaxIdleConns); err != nil {
+		return nil, err
+	}
+	if err := envDuration(lookup, "DB_CONN_MAX_LIFETIME", &cfg.Database.ConnMaxLifetime); err != nil {
+		return nil, err
+	}
+	if err := envBool(lookup, "DB_AUTO_MIGRATE", &cfg.Database.AutoMigrate); err != nil {
+		return nil, err
+	}
+	if v, ok := lookup("SMTP_ADDR"); ok {
+		cfg.Mail.SMTPAddr = v
+	}
+	if v, ok := lookup("SMTP_USERNAME"); ok {
+		cfg.Mail.Username = v
+	}
+	if v, ok := lookup("SMTP_PASSWORD"); ok {
+		cfg.Mail.Password = v
+	}
+	if v, ok := lookup("MAIL_API_URL"); ok {
+		cfg.Mail.APIURL = v
+	}
+	if v, ok := lookup("MAIL_API_KEY"); ok {
+		cfg.Mail.APIKey = v
+	}
+	if v, ok := lookup("MAIL_FROM"); ok {
+		cfg.Mail.From = v
+	}
+	if v, ok := lookup("MAIL_TEMPLATES_DIR"); ok {
+		cfg.Mail.TemplatesDir = v
+	}
+	if err := envBool(lookup, "FILES_ENABLED", &cfg.Files.Enabled); err != nil {
+		return nil, err
+	}
+	if v, ok := lookup("FILES_BACKEND"); ok {
+		cfg.Files.Backend = v
+	}
+	if v, ok := lookup("FILES_DIR"); ok {
+		cfg.Files.Dir = v
+	}
+	if err := envInt(lookup, "FILES_MAX_BYTES", &cfg.Files.MaxSize); err != nil {
+		return nil, err
+	}
+	envList(lookup, "FILES_ALLOWED_TYPES", &cfg.Files.AllowedTypes)
+	if err := envDuration(lookup, "FILES_URL_TTL", &cfg.Files.URLTTL); err != nil {
+		return nil, err
+	}
+	if v, ok := lookup("FILES_SIGNING_SECRET"); ok {
+		cfg.Files.SigningSecret = v
+	}
+	if err := envBool(lookup, "AVATARS_ENABLED", &cfg.Avatars.Enabled); err != nil {
+		return nil, err
+	}
+	if err := envInt(lookup, "AVATAR_MAX_BYTES", &cfg.Avatars.MaxSize); err != nil {
+		return nil, err
+	}
+	if err := envInt(lookup, "AVATAR_MIN_SIDE", &cfg.Avatars.MinSide); err != nil {
+		return nil, err
+	}
+	if err := envInt(lookup, "AVATAR_MAX_SIDE", &cfg.Avatars.MaxSide); err != nil {
+		return nil, err
+	}
+	if err := envInt(lookup, "AVATAR_WORKERS", &cfg.Avatars.Workers); err != nil {
+		return nil, err
+	}
+	if v, ok := lookup("JOBS_BACKEND"); ok {
+		cfg.Jobs.Backend = v
+	}
+	if err := envInt(lookup, "JOBS_WORKERS", &cfg.Jobs.Workers); err != nil {
+		return nil, err
+	}
+	if err := envInt(lookup, "JOBS_MAX_ATTEMPTS", &cfg.Jobs.MaxAttempts); err != nil {
+		return nil, err
+	}
+	if err := envDuration(lookup, "JOBS_RETRY_BACKOFF", &cfg.Jobs.RetryBackoff); err != nil {
+		return nil, err
+	}
+	if err := envDuration(lookup, "JOBS_MAX_BACKOFF", &cfg.Jobs.MaxBackoff); err != nil {
+		return nil, err
+	}
+	if err := envDuration(lookup, "JOBS_TIMEOUT", &cfg.Jobs.Timeout); err != nil {
+		return nil, err
+	}
+	if err := envDuration(lookup, "TOKEN_CLEANUP_INTERVAL", &cfg.Scheduler.TokenCleanupInterval); err != nil {
+		return nil, err
+	}
+	if err := envDuration(lookup, "SESSION_CLEANUP_INTERVAL", &cfg.Scheduler.SessionCleanupInterval); err != nil {
+		return nil, err
+	}
+	if err := envDuration(lookup, "AUDIT_PRUNE_INTERVAL", &cfg.Scheduler.AuditPruneInterval); err != nil {
+		return nil, err
+	}
+	if err := envDuration(lookup, "SCHEDULER_JITTER", &cfg.Scheduler.Jitter); err != nil {
+		return nil, err
+	}
+	if v, ok := lookup("BROKER_BACKEND"); ok {
+		cfg.Broker.Backend = v
+	}
+	if v, ok := lookup("BROKER_URL"); ok {
+		cfg.Broker.URL = v
+	}
+	if v, ok := lookup("BROKER_TOPIC_PREFIX"); ok {
+		cfg.Broker.TopicPrefix = v
+	}
+	if v, ok := lookup("BROKER_ENCODING"); ok {
+		cfg.Broker.Encoding = v
+	}
+	if err := envDuration(lookup, "BROKER_TIMEOUT", &cfg.Broker.Timeout); err != nil {
+		return nil, err
+	}
+	if v, ok := lookup("TLS_CERT_FILE"); ok {
+		cfg.TLS.CertFile = v
+	}
+	if v, ok := lookup("TLS_KEY_FILE"); ok {
+		cfg.TLS.KeyFile = v
+	}
+	envList(lookup, "TLS_AUTOCERT_DOMAINS", &cfg.TLS.AutocertDomains)
+	if v, ok := lookup("TLS_AUTOCERT_CACHE_DIR"); ok {
+		cfg.TLS.AutocertCacheDir = v
+	}
+	if v, ok := lookup("TLS_AUTOCERT_EMAIL"); ok {
+		cfg.TLS.AutocertEmail = v
+	}
+	if v, ok := lookup("TLS_REDIRECT_ADDR"); ok {
+		cfg.TLS.RedirectAddr = v
+	}
+	if v, ok := lookup("TLS_CLIENT_CA_FILE"); ok {
+		cfg.TLS.ClientCAFile = v
+	}
+	if v, ok := lookup("TLS_CLIENT_AUTH"); ok {
+		cfg.TLS.ClientAuth = v
+	}
+
+	if err := envBool(lookup, "GRPC_ENABLED", &cfg.GRPC.Enabled); err != nil {
+		return nil, err
+	}
+	if v, ok := lookup("GRPC_ADDR"); ok {
+		cfg.GRPC.Addr = v
+	}
+	if err := envBool(lookup, "GRPC_GATEWAY_ENABLED", &cfg.GRPC.Gateway); err != nil {
+		return nil, err
+	}
+	if v, ok := lookup("GRPC_GATEWAY_ADDR"); ok {
+		cfg.GRPC.GatewayAddr = v
+	}
+	if err := envBool(lookup, "GRPC_GATEWAY_COMPAT", &cfg.GRPC.GatewayCompat); err != nil {
+		return nil, err
+	}
+	if v, ok := lookup("S3_ENDPOINT"); ok {
+		cfg.Files.S3.Endpoint = v
+	}
+	if v, ok := lookup("S3_REGION"); ok {
+		cfg.Files.S3.Region = v
+	}
+	if v, ok := lookup("S3_BUCKET"); ok {
+		cfg.Files.S3.Bucket = v
+	}
+	if v, ok := lookup("S3_ACCESS_KEY_ID"); ok {
+		cfg.Files.S3.AccessKeyID = v
+	}
+	if v, ok := lookup("S3_SECRET_ACCESS_KEY"); ok {
+		cfg.Files.S3.SecretAccessKey = v
+	}
+
+	if v, ok := lookup("SERVER_ADDR"); ok {
+		cfg.Server.Addr = v
+	}
+	if err := envDuration(lookup, "SERVER_READ_TIMEOUT", &cfg.Server.ReadTimeout); err != nil {
+		return nil, err
+	}
+	if err := envDuration(lookup, "SERVER_WRITE_TIMEOUT", &cfg.Server.WriteTimeout); err != nil {
+		return nil, err
+	}
+	if err := envDuration(lookup, "SERVER_IDLE_TIMEOUT", &cfg.Server.IdleTimeout); err != nil {
+		return nil, err
+	}
+	if err := envDuration(lookup, "SHUTDOWN_TIMEOUT", &cfg.Server.ShutdownTimeout); err != nil {
+		return nil, err
+	}
+	if err := envDuration(lookup, "REQUEST_TIMEOUT", &cfg.Server.RequestTimeout); err != nil {
+		return nil, err
+	}
+	if err := envInt(lookup, "MULTIPART_MAX_MEMORY", &cfg.Server.MultipartMemory); err != nil {
+		return nil, err
+	}
+	if err := envInt(lookup, "REQUEST_MAX_BODY_BYTES", &cfg.Server.MaxBody); err != nil {
+		return nil, err
+	}
+	if err := envIntMap(lookup, "ROUTE_MAX_BODY_BYTES", &cfg.Server.RouteMaxBody); err != nil {
+		return nil, err
+	}
+	if err := envInt(lookup, "REQUEST_MAX_DECOMPRESSED_BYTES", &cfg.Server.MaxDecompressedBody); err != nil {
+		return nil, err
+	}
+	if err := envDurationMap(lookup, "ROUTE_TIMEOUTS", &cfg.Server.RouteTimeouts); err != nil {
+		return nil, err
+	}
+	if err := envPrefixes(lookup, "TRUSTED_PROXIES", &cfg.Server.TrustedProxies); err != nil {
+		return nil, err
+	}
+	if err := envBool(lookup, "SERVER_KEEPALIVES", &cfg.Server.KeepAlives); err != nil {
+		return nil, err
+	}
+	if err := envDuration(lookup, "REQUEST_ID_REUSE_WINDOW", &cfg.Server.RequestIDReuseWindow); err != nil {
+		return nil, err
+	}
+	if err := envBool(lookup, "STARTUP_SELFTEST", &cfg.Server.SelfTest); err != nil {
+		return nil, err
+	}
+	if err := envBool(lookup, "SWAGGER_ENABLED", &cfg.Server.Swagger); err != nil {
+		return nil, err
+	}
+	if v, ok := lookup("SWAGGER_AUTH"); ok {
+		cfg.Server.SwaggerAuth = v
+	}
+	if err := envBool(lookup, "OPENAPI_VALIDATION", &cfg.Server.OpenAPIValidation); err != nil {
+		return nil, err
+	}
+	if err := envBool(lookup, "OPENAPI_RESPONSE_VALIDATION", &cfg.Server.OpenAPIResponseValidation); err != nil {
+		return nil, err
+	}
+	if err := envBool(lookup, "PRETTY_JSON", &cfg.Server.PrettyJSON); err != nil {
+		return nil, err
+	}
+	if err := envBool(lookup, "SECURITY_HEADERS", &cfg.Server.SecurityHeaders); err != nil {
+		return nil, err
+	}
+	if v, ok := lookup("CONTENT_SECURITY_POLICY"); ok {
+		cfg.Server.ContentSecurityPolicy = v
+	}
+	if err := envDuration(lookup, "HSTS_MAX_AGE", &cfg.Server.HSTSMaxAge); err != nil {
+		return nil, err
+	}
+	if v, ok := lookup("FRAME_OPTIONS"); ok {
+		cfg.Server.FrameOptions = v
+	}
+	if v, ok := lookup("REFERRER_POLICY"); ok {
+		cfg.Server.ReferrerPolicy = v
+	}
+	if err := envBool(lookup, "COMPRESSION", &cfg.Server.Compression); err != nil {
+		return nil, err
+	}
+	if err := envInt(lookup, "COMPRESSION_MIN_BYTES", &cfg.Server.CompressionMinSize); err != nil {
+		return nil, err
+	}
+	envList(lookup, "COMPRESSION_EXCLUDED_TYPES", &cfg.Server.CompressionExcludedTypes)
+	if err := envDuration(lookup, "RESPONSE_CACHE_TTL", &cfg.Cache.TTL); err != nil {
+		return nil, err
+	}
+	if v, ok := lookup("RESPONSE_CACHE_BACKEND"); ok {
+		cfg.Cache.Backend = v
+	}
+	if err := envInt(lookup, "RESPONSE_CACHE_MAX_ENTRIES", &cfg.Cache.MaxEntries); err != nil {
+		return nil, err
+	}
+	if err := envDuration(lookup, "IDEMPOTENCY_TTL", &cfg.Idempotency.TTL); err != nil {
+		return nil, err
+	}
+	if v, ok := lookup("IDEMPOTENCY_BACKEND"); ok {
+		cfg.Idempotency.Backend = v
+	}
+
+	envList(lookup, "CORS_ALLOWED_ORIGINS", &cfg.CORS.AllowedOrigins)
+	if err := envBool(lookup, "CORS_ALLOW_CREDENTIALS", &cfg.CORS.AllowCredentials); err != nil {
+		return nil, err
+	}
+	if err := envDuration(lookup, "CORS_MAX_AGE", &cfg.CORS.MaxAge); err != nil {
+		return nil, err
+	}
+
+	if err := envInt(lookup, "RATE_LIMIT_REQUESTS", &cfg.RateLimit.Requests); err != nil {
+		return nil, err
+	}
+	if err := envDuration(lookup, "RATE_LIMIT_WINDOW", &cfg.RateLimit.Window); err != nil {
+		return nil, err
+	}
+	if err := envBool(lookup, "RATE_LIMIT_FAIL_OPEN", &cfg.RateLimit.FailOpen); err != nil {
+		return nil, err
+	}
+	if v, ok := lookup("RATE_LIMIT_BACKEND"); ok {
+		cfg.RateLimit.Backend = v
+	}
+	if v, ok := lookup("REDIS_URL"); ok {
+		cfg.RateLimit.RedisURL = v
+		cfg.Cache.RedisURL = v
+		cfg.Idempotency.RedisURL = v
+		cfg.Auth.Sessions.RedisURL = v
+		cfg.Jobs.RedisURL = v
+		cfg.Flags.RedisURL = v
+	}
+	if v, ok := lookup("RATE_LIMIT_GROUPS"); ok {
+		groups, err := parseRateLimitGroups(v)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RateLimit.Groups = groups
+	}
+	if err := envInt(lookup, "HEALTH_MAX_GOROUTINES", &cfg.Health.MaxGoroutines); err != nil {
+		return nil, err
+	}
+	envList(lookup, "HEALTH_LIVENESS_PATHS", &cfg.Health.LivenessPaths)
+	envList(lookup, "HEALTH_READINESS_PATHS", &cfg.Health.ReadinessPaths)
+	if err := envDuration(lookup, "HEALTH_CHECK_TIMEOUT", &cfg.Health.CheckTimeout); err != nil {
+		return nil, err
+	}
+	if v, ok := lookup("LOG_LEVEL"); ok {
+		cfg.Logging.Level = v
+	}
+	if err := envInt(lookup, "LOG_SAMPLING_INITIAL", &cfg.Logging.SamplingInitial); err != nil {
+		return nil, err
+	}
+	if err := envInt(lookup, "LOG_SAMPLING_THEREAFTER", &cfg.Logging.SamplingThereafter); err != nil {
+		return nil, err
+	}
+	if v, ok := lookup("LOG_FILE"); ok {
+		cfg.Logging.File = v
+	}
+	if err := envInt(lookup, "LOG_FILE_MAX_SIZE_MB", &cfg.Logging.FileMaxSizeMB); err != nil {
+		return nil, err
+	}
+	if err := envInt(lookup, "LOG_FILE_MAX_BACKUPS", &cfg.Logging.FileMaxBackups); err != nil {
+		return nil, err
+	}
+	if err := envInt(lookup, "LOG_FILE_MAX_AGE_DAYS", &cfg.Logging.FileMaxAgeDays); err != nil {
+		return nil, err
+	}
+	if v, ok := lookup("ACCESS_LOG_FORMAT"); ok {
+		cfg.Logging.AccessLogFormat = v
+	}
+	if v, ok := lookup("ACCESS_LOG_FILE"); ok {
+		cfg.Logging.AccessLogFile = v
+	}
+	if err := envBool(lookup, "LOG_BODIES", &cfg.Logging.Bodies); err != nil {
+		return nil, err
+	}
+	if err := envInt(lookup, "LOG_BODY_MAX_BYTES", &cfg.Logging.BodyMaxBytes); err != nil {
+		return nil, err
+	}
+	envList(lookup, "LOG_REDACT_FIELDS", &cfg.Logging.RedactFields)
+	if v, ok := lookup("AUDIT_LOG_FILE"); ok {
+		cfg.Logging.AuditLogFile = v
+	}
+	if err := envInt(lookup, "AUDIT_LOG_MAX_SIZE_MB", &cfg.Logging.AuditLogMaxSizeMB); err != nil {
+		return nil, err
+	}
+	if err := envInt(lookup, "AUDIT_LOG_MAX_BACKUPS", &cfg.Logging.AuditLogMaxBackups); err != nil {
+		return nil, err
+	}
+	if err := envInt(lookup, "AUDIT_LOG_MAX_AGE_DAYS", &cfg.Logging.AuditLogMaxAgeDays); err != nil {
+		return nil, err
+	}
+	if err := envInt(lookup, "AUDIT_TRAIL_SIZE", &cfg.Logging.AuditTrailSize); err != nil {
+		return nil, err
+	}
+	if v, ok := lookup("AUDIT_STORE"); ok {
+		cfg.Logging.AuditStore = v
+	}
+	if err := envDuration(lookup, "AUDIT_RETENTION", &cfg.Logging.AuditRetention); err != nil {
+		return nil, err
+	}
+	if v, ok := lookup("OTEL_EXPORTER_OTLP_ENDPOINT"); ok {
+		cfg.Tracing.Endpoint = v
+	}
+	if v, ok := lookup("OTEL_SERVICE_NAME"); ok {
+		cfg.Tracing.ServiceName = v
+	}
+	if err := envFloat(lookup, "TRACING_SAMPLE_RATIO", &cfg.Tracing.SampleRatio); err != nil {
+		return nil, err
+	}
+	if v, ok := lookup("FLAGS_FILE"); ok {
+		cfg.Flags.File = v
+	}
+	if v, ok := lookup("FLAGS_STORE"); ok {
+		cfg.Flags.Store = v
+	}
+	if v, ok := lookup("EXPERIMENTS"); ok {
+		experiments, err := parseExperiments(v)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Experiments = experiments
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// Validate checks that the configuration is usable
+func (c *Config) Validate() error {
+	if c.Auth.TokenTTL <= 0 {
+		return fmt.Errorf("config: token TTL must be positive")
+	}
+	if c.Auth.RefreshTTL <= 0 || c.Auth.RefreshGrace < 0 {
+		return fmt.Errorf("config: refresh token TTL must be positive and grace not negative")
+	}
+	if c.Auth.StoreMaxAttempts < 1 || c.Auth.StoreRetryBackoff < 0 {
+		return fmt.Errorf("config: auth store retries need at least one attempt and a non-negative backoff")
+	}
+	if c.Auth.Stuffing.MaxAccounts < 0 {
+		return fmt.Errorf("config: login stuffing max accounts must not be negative")
+	}
+	if c.Auth.Stuffing.MaxAccounts > 0 && (c.Auth.Stuffing.Window <= 0 || c.Auth.Stuffing.Block <= 0) {
+		return fmt.Errorf("config: login stuffing window and block must be positive")
+	}
+	if c.Auth.ClientCert.Header != "" && len(c.Auth.ClientCert.TrustedProxies) == 0 {
+		return fmt.Errorf("config: client cert header requires at least one trusted proxy")
+	}
+	for _, provider := range c.Auth.OIDC {
+		if provider.ClientID == "" || provider.RedirectURL == "" {
+			return fmt.Errorf("config: OIDC provider %s needs a client ID and redirect URL", provider.Name)
+		}
+		if provider.Issuer == "" && provider.Name != "google" && provider.Name != "github" {
+			return fmt.Errorf("config: OIDC provider %s needs an issuer", provider.Name)
+		}
+	}
+	if c.Auth.EmailVerification {
+		if u, err := url.Parse(c.Auth.VerificationURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("config: email verification needs an absolute http(s) verification URL")
+		}
+		if c.Auth.VerificationTTL <= 0 {
+			return fmt.Errorf("config: verification TTL must be positive")
+		}
+	}
+	if reset := c.Auth.PasswordReset; reset.Enabled {
+		if u, err := url.Parse(reset.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("config: password reset needs an absolute http(s) reset URL")
+		}
+		if reset.TTL <= 0 {
+			return fmt.Errorf("config: password reset TTL must be positive")
+		}
+		if reset.Limit.Requests <= 0 || reset.Limit.Window <= 0 {
+			return fmt.Errorf("config: forgot password limit requests and window must be positive")
+		}
+	}
+	if twoFactor := c.Auth.TwoFactor; twoFactor.Enabled {
+		// The issuer is the part of the otpauth label before the account
+		if twoFactor.Issuer == "" || strings.Contains(twoFactor.Issuer, ":") {
+			return fmt.Errorf("config: TOTP issuer must be set and must not contain a colon")
+		}
+		if twoFactor.ChallengeTTL <= 0 {
+			return fmt.Errorf("config: two-factor challenge TTL must be positive")
+		}
+	}
+	if c.Auth.Cookie.Enabled && c.Auth.Cookie.Name == "" {
+		return fmt.Errorf("config: auth cookie name must be set when cookie auth is enabled")
+	}
+	if sessions := c.Auth.Sessions; sessions.Enabled {
+		if c.Auth.Cookie.Enabled {
+			return fmt.Errorf("config: cookie sessions cannot be combined with the access token cookie")
+		}
+		if sessions.Name == "" || sessions.CSRFCookie == "" || sessions.Name == sessions.CSRFCookie {
+			return fmt.Errorf("config: cookie sessions need distinct session and CSRF cookie names")
+		}
+		switch sessions.Backend {
+		case "memory":
+		case "redis":
+			if sessions.RedisURL == "" {
+				return fmt.Errorf("config: REDIS_URL is required for the redis session backend")
+			}
+		default:
+			return fmt.Errorf("config: unknown session backend %q", sessions.Backend)
+		}
+	}
+	switch c.Users.DefaultRole {
+	case "user", "admin":
+	default:
+		return fmt.Errorf("config: invalid default user role %q", c.Users.DefaultRole)
+	}
+	switch c.Users.OptionalFields {
+	case "omitempty", "always":
+	default:
+		return fmt.Errorf("config: invalid optional field policy %q", c.Users.OptionalFields)
+	}
+	if c.Users.MaxUsers < 0 {
+		return fmt.Errorf("config: max users must not be negative")
+	}
+	if c.Users.StatementTimeout < 0 {
+		return fmt.Errorf("config: statement timeout must not be negative")
+	}
+	if c.Users.DefaultPageSize <= 0 || c.Users.DefaultPageSize > c.Users.MaxPageSize {
+		return fmt.Errorf("config: default page size must be positive and at most the max page size")
+	}
+	switch c.Database.Backend {
+	case "memory":
+	case "postgres":
+		if c.Database.URL == "" {
+			return fmt.Errorf("config: DATABASE_URL is required for the postgres backend")
+		}
+	default:
+		return fmt.Errorf("config: unknown user store backend %q", c.Database.Backend)
+	}
+	if c.Database.MaxOpenConns < 0 || c.Database.MaxIdleConns < 0 || c.Database.ConnMaxLifetime < 0 {
+		return fmt.Errorf("config: database pool limits must not be negative")
+	}
+	if c.Mail.SMTPAddr != "" {
+		if _, _, err := net.SplitHostPort(c.Mail.SMTPAddr); err != nil {
+			return fmt.Errorf("config: SMTP address must be host:port: %w", err)
+		}
+		if c.Mail.From == "" {
+			return fmt.Errorf("config: MAIL_FROM is required with an SMTP relay")
+		}
+	}
+	if c.Mail.APIURL != "" {
+		if c.Mail.SMTPAddr != "" {
+			return fmt.Errorf("config: set either an SMTP relay or a mail API, not both")
+		}
+		if u, err := url.Parse(c.Mail.APIURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("config: mail API URL must be an absolute http(s) URL")
+		}
+		if c.Mail.APIKey == "" || c.Mail.From == "" {
+			return fmt.Errorf("config: MAIL_API_KEY and MAIL_FROM are required with a mail API")
+		}
+	}
+	if files := c.Files; files.Enabled || c.Avatars.Enabled {
+		switch files.Backend {
+		case "local":
+			if files.Dir == "" {
+				return fmt.Errorf("config: FILES_DIR is required for the local file backend")
+			}
+		case "s3":
+			if u, err := url.Parse(files.S3.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("config: the s3 file backend needs an absolute http(s) S3_ENDPOINT")
+			}
+			if files.S3.Bucket == "" || files.S3.Region == "" {
+				return fmt.Errorf("config: the s3 file backend needs S3_BUCKET and S3_REGION")
+			}
+		default:
+			return fmt.Errorf("config: unknown file backend %q", files.Backend)
+		}
+	}
+	if files := c.Files; files.Enabled {
+		if files.MaxSize <= 0 {
+			return fmt.Errorf("config: max file size must be positive")
+		}
+		if len(files.AllowedTypes) == 0 {
+			return fmt.Errorf("config: at least one allowed file type is required")
+		}
+		if files.URLTTL <= 0 {
+			return fmt.Errorf("config: file URL TTL must be positive")
+		}
+	}
+	if avatars := c.Avatars; avatars.Enabled {
+		if avatars.MaxSize <= 0 || avatars.Workers <= 0 {
+			return fmt.Errorf("config: avatar max size and workers must be positive")
+		}
+		if avatars.MinSide <= 0 || avatars.MaxSide < avatars.MinSide {
+			return fmt.Errorf("config: avatar sides must be positive with the max at least the min")
+		}
+	}
+	if jobs := c.Jobs; jobs.Workers <= 0 || jobs.MaxAttempts <= 0 || jobs.Timeout <= 0 {
+		return fmt.Errorf("config: job workers, max attempts and timeout must be positive")
+	}
+	if c.Jobs.RetryBackoff <= 0 || c.Jobs.MaxBackoff < c.Jobs.RetryBackoff {
+		return fmt.Errorf("config: job retry backoff must be positive with the max at least the initial one")
+	}
+	switch c.Jobs.Backend {
+	case "memory":
+	case "redis":
+		if c.Jobs.RedisURL == "" {
+			return fmt.Errorf("config: REDIS_URL is required for the redis job backend")
+		}
+	default:
+		return fmt.Errorf("config: unknown job backend %q", c.Jobs.Backend)
+	}
+	if sched := c.Scheduler; sched.TokenCleanupInterval < 0 || sched.SessionCleanupInterval < 0 || sched.Jitter < 0 {
+		return fmt.Errorf("config: scheduler intervals and jitter must not be negative")
+	}
+	switch c.Broker.Backend {
+	case "":
+	case "nats", "kafka":
+		if c.Broker.URL == "" {
+			return fmt.Errorf("config: BROKER_URL is required for the %s broker", c.Broker.Backend)
+		}
+	default:
+		return fmt.Errorf("config: unknown broker backend %q", c.Broker.Backend)
+	}
+	if c.Broker.Encoding != "json" && c.Broker.Encoding != "protobuf" {
+		return fmt.Errorf("config: unknown broker encoding %q", c.Broker.Encoding)
+	}
+	if c.Broker.Timeout <= 0 {
+		return fmt.Errorf("config: broker timeout must be positive")
+	}
+	if c.Server.Addr == "" {
+		return fmt.Errorf("config: server address must be set")
+	}
+	if c.GRPC.Enabled && (c.GRPC.Addr == "" || c.GRPC.Addr == c.Server.Addr) {
+		return fmt.Errorf("config: gRPC address must be set and differ from the server address")
+	}
+	if c.GRPC.Gateway {
+		if !c.GRPC.Enabled {
+			return fmt.Errorf("config: the gRPC gateway needs the gRPC server enabled")
+		}
+		if c.GRPC.GatewayAddr == "" || c.GRPC.GatewayAddr == c.Server.Addr || c.GRPC.GatewayAddr == c.GRPC.Addr {
+			return fmt.Errorf("config: gRPC gateway address must be set and differ from the server and gRPC addresses")
+		}
+	}
+	if c.Server.ReadTimeout < 0 || c.Server.WriteTimeout < 0 || c.Server.IdleTimeout < 0 || c.Server.ShutdownTimeout < 0 {
+		return fmt.Errorf("config: server timeouts must not be negative")
+	}
+	if c.Server.RequestTimeout < 0 {
+		return fmt.Errorf("config: request timeout must not be negative")
+	}
+	if c.Server.MaxBody <= 0 {
+		return fmt.Errorf("config: max request body must be positive")
+	}
+	for route, maxBody := range c.Server.RouteMaxBody {
+		if maxBody <= 0 {
+			return fmt.Errorf("config: max request body for %s must be positive", route)
+		}
+	}
+	if c.Server.MaxDecompressedBody <= 0 {
+		return fmt.Errorf("config: max decompressed body must be positive")
+	}
+	if c.Server.MultipartMemory <= 0 {
+		return fmt.Errorf("config: multipart memory must be positive")
+	}
+	if c.Server.HSTSMaxAge < 0 {
+		return fmt.Errorf("config: HSTS max age must not be negative")
+	}
+	switch c.Server.FrameOptions {
+	case "", "DENY", "SAMEORIGIN":
+	default:
+		return fmt.Errorf("config: FRAME_OPTIONS must be DENY or SAMEORIGIN, got %q", c.Server.FrameOptions)
+	}
+	if c.Server.CompressionMinSize < 0 {
+		return fmt.Errorf("config: compression min size must not be negative")
+	}
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		return fmt.Errorf("config: TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	if c.TLS.CertFile != "" && len(c.TLS.AutocertDomains) > 0 {
+		return fmt.Errorf("config: TLS certificate files cannot be combined with autocert")
+	}
+	if len(c.TLS.AutocertDomains) > 0 && c.TLS.AutocertCacheDir == "" {
+		return fmt.Errorf("config: TLS_AUTOCERT_CACHE_DIR is required for autocert")
+	}
+	if c.TLS.RedirectAddr != "" && !c.TLS.Enabled() {
+		return fmt.Errorf("config: TLS_REDIRECT_ADDR needs TLS to be enabled")
+	}
+	if c.TLS.ClientCAFile != "" && !c.TLS.Enabled() {
+		return fmt.Errorf("config: TLS_CLIENT_CA_FILE needs TLS to be enabled")
+	}
+	if c.TLS.ClientAuth != "require" && c.TLS.ClientAuth != "optional" {
+		return fmt.Errorf("config: unknown TLS client auth %q", c.TLS.ClientAuth)
+	}
+	if c.Server.SwaggerAuth != "" {
+		if user, password, ok := strings.Cut(c.Server.SwaggerAuth, ":"); !ok || user == "" || password == "" {
+			return fmt.Errorf("config: swagger auth must be user:password")
+		}
+	}
+	if c.Cache.TTL < 0 {
+		return fmt.Errorf("config: response cache TTL must not be negative")
+	}
+	switch c.Cache.Backend {
+	case "memory":
+		if c.Cache.MaxEntries <= 0 {
+			return fmt.Errorf("config: response cache max entries must be positive")
+		}
+	case "redis":
+		if c.Cache.RedisURL == "" {
+			return fmt.Errorf("config: REDIS_URL is required for the redis response cache backend")
+		}
+	default:
+		return fmt.Errorf("config: unknown response cache backend %q", c.Cache.Backend)
+	}
+	if c.Idempotency.TTL < 0 {
+		return fmt.Errorf("config: idempotency TTL must not be negative")
+	}
+	switch c.Idempotency.Backend {
+	case "memory":
+	case "redis":
+		if c.Idempotency.RedisURL == "" {
+			return fmt.Errorf("config: REDIS_URL is required for the redis idempotency backend")
+		}
+	default:
+		return fmt.Errorf("config: unknown idempotency backend %q", c.Idempotency.Backend)
+	}
+	for _, origin := range c.CORS.AllowedOrigins {
+		if origin == "*" && c.CORS.AllowCredentials {
+			return fmt.Errorf("config: CORS credentials cannot be allowed for any origin")
+		}
+	}
+	if c.RateLimit.Requests <= 0 || c.RateLimit.Window <= 0 {
+		return fmt.Errorf("config: rate limit requests and window must be positive")
+	}
+	switch c.RateLimit.Backend {
+	case "memory":
+	case "redis":
+		if c.RateLimit.RedisURL == "" {
+			return fmt.Errorf("config: REDIS_URL is required for the redis rate limit backend")
+		}
+	default:
+		return fmt.Errorf("config: unknown rate limit backend %q", c.RateLimit.Backend)
+	}
+	for name, rule := range c.RateLimit.Groups {
+		switch name {
+		case "auth", "users", "admin":
+		default:
+			return fmt.Errorf("config: unknown rate limit group %q", name)
+		}
+		if rule.Requests <= 0 || rule.Window <= 0 {
+			return fmt.Errorf("config: rate limit group %s: requests and window must be positive", name)
+		}
+	}
+	switch c.Logging.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		return fmt.Errorf("config: unsupported log level %q", c.Logging.Level)
+	}
+	if c.Logging.SamplingInitial < 0 || (c.Logging.SamplingInitial > 0 && c.Logging.SamplingThereafter <= 0) {
+		return fmt.Errorf("config: log sampling needs a non-negative initial count and a positive thereafter")
+	}
+	if c.Logging.File != "" && c.Logging.FileMaxSizeMB <= 0 {
+		return fmt.Errorf("config: log file max size must be positive")
+	}
+	if c.Logging.FileMaxBackups < 0 || c.Logging.FileMaxAgeDays < 0 {
+		return fmt.Errorf("config: log file retention must not be negative")
+	}
+	switch c.Logging.AccessLogFormat {
+	case "", "combined":
+	default:
+		return fmt.Errorf("config: unsupported access log format %q", c.Logging.AccessLogFormat)
+	}
+	if c.Logging.Bodies && c.Logging.BodyMaxBytes <= 0 {
+		return fmt.Errorf("config: log body max bytes must be positive")
+	}
+	if c.Logging.AuditLogMaxSizeMB <= 0 {
+		return fmt.Errorf("config: audit log max size must be positive")
+	}
+	if c.Logging.AuditLogMaxBackups < 0 || c.Logging.AuditLogMaxAgeDays < 0 {
+		return fmt.Errorf("config: audit log retention must not be negative")
+	}
+	if c.Logging.AuditTrailSize < 0 {
+		return fmt.Errorf("config: audit trail size must not be negative")
+	}
+	switch c.Logging.AuditStore {
+	case "memory":
+	case "postgres":
+		if c.Database.Backend != "postgres" {
+			return fmt.Errorf("config: the postgres audit store needs USER_STORE_BACKEND=postgres")
+		}
+	default:
+		return fmt.Errorf("config: unknown audit store %q", c.Logging.AuditStore)
+	}
+	if c.Logging.AuditRetention < 0 {
+		return fmt.Errorf("config: audit retention must not be negative")
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		return fmt.Errorf("config: tracing sample ratio must be between 0 and 1")
+	}
+	for _, path := range append(append([]string{}, c.Health.LivenessPaths...), c.Health.ReadinessPaths...) {
+		if !strings.HasPrefix(path, "/") {
+			return fmt.Errorf("config: health path %q must start with /", path)
+		}
+	}
+	if c.Health.CheckTimeout <= 0 {
+		return fmt.Errorf("config: health check timeout must be positive")
+	}
+	switch c.Flags.Store {
+	case "memory":
+	case "redis":
+		if c.Flags.RedisURL == "" {
+			return fmt.Errorf("config: REDIS_URL is required for the redis flag store")
+		}
+	case "postgres":
+		if c.Database.Backend != "postgres" {
+			return fmt.Errorf("config: the postgres flag store needs USER_STORE_BACKEND=postgres")
+		}
+	default:
+		return fmt.Errorf("config: unknown flag store %q", c.Flags.Store)
+	}
+	for _, exp := range c.Experiments {
+		total := 0
+		for _, variant := range exp.Variants {
+			if variant.Percent < 0 {
+				return fmt.Errorf("config: experiment %s: negative rollout for %s", exp.Name, variant.Name)
+			}
+			total += variant.Percent
+		}
+		if total > 100 {
+			return fmt.Errorf("config: experiment %s: rollout adds up to %d%%", exp.Name, total)
+		}
+	}
+	return nil
+}
+
+func envBool(lookup lookupFunc, key string, dst *bool) error {
+	v, ok := lookup(key)
+	if !ok {
+		return nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return fmt.Errorf("config: %s: %w", key, err)
+	}
+	*dst = b
+	return nil
+}
+
+// envList parses a comma-separated list, dropping empty entries
+func envList(lookup lookupFunc, key string, dst *[]string) {
+	v, ok := lookup(key)
+	if !ok {
+		return
+	}
+	var list []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	*dst = list
+}
+
+// envPrefixes parses a comma-separated list of CIDRs; bare addresses are
+// taken as single-host prefixes
+func envPrefixes(lookup lookupFunc, key string, dst *[]netip.Prefix) error {
+	var items []string
+	envList(lookup, key, &items)
+	if items == nil {
+		return nil
+	}
+	prefixes := make([]netip.Prefix, 0, len(items))
+	for _, item := range items {
+		if addr, err := netip.ParseAddr(item); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(item)
+		if err != nil {
+			return fmt.Errorf("config: %s: invalid address or CIDR %q", key, item)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	*dst = prefixes
+	return nil
+}
+
+func envInt(lookup lookupFunc, key string, dst *int) error {
+	v, ok := lookup(key)
+	if !ok {
+		return nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return fmt.Errorf("config: %s: %w", key, err)
+	}
+	*dst = n
+	return nil
+}
+
+func envFloat(lookup lookupFunc, key string, dst *float64) error {
+	v, ok := lookup(key)
+	if !ok {
+		return nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return fmt.Errorf("config: %s: %w", key, err)
+	}
+	*dst = f
+	return nil
+}
+
+func envDuration(lookup lookupFunc, key string, dst *time.Duration) error {
+	v, ok := lookup(key)
+	if !ok {
+		return nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return fmt.Errorf("config: %s: %w", key, err)
+	}
+	*dst = d
+	return nil
+}
+
+// envDurationMap parses a comma-separated list of key=duration pairs
+func envDurationMap(lookup lookupFunc, key string, dst *map[string]time.Duration) error {
+	v, ok := lookup(key)
+	if !ok || strings.TrimSpace(v) == "" {
+		return nil
+	}
+	m := make(map[string]time.Duration)
+	for _, pair := range strings.Split(v, ",") {
+		name, value, found := strings.Cut(pair, "=")
+		if !found {
+			return fmt.Errorf("config: %s: expected key=duration, got %q", key, pair)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("config: %s: %w", key, err)
+		}
+		m[strings.TrimSpace(name)] = d
+	}
+	*dst = m
+	return nil
+}
+
+func envIntMap(lookup lookupFunc, key string, dst *map[string]int) error {
+	v, ok := lookup(key)
+	if !ok || strings.TrimSpace(v) == "" {
+		return nil
+	}
+	m := make(map[string]int)
+	for _, pair := range strings.Split(v, ",") {
+		name, value, found := strings.Cut(pair, "=")
+		if !found {
+			return fmt.Errorf("config: %s: expected key=integer, got %q", key, pair)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("config: %s: %w", key, err)
+		}
+		m[strings.TrimSpace(name)] = n
+	}
+	*dst = m
+	return nil
+}
+
+// parseRateLimitGroups parses "group=requests/window,..." such as
+// "auth=10/1m,admin=30/1m"
+func parseRateLimitGroups(v string) (map[string]RateLimitRule, error) {
+	groups := make(map[string]RateLimitRule)
+	for _, pair := range strings.Split(v, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		name, spec, found := strings.Cut(pair, "=")
+		if !found {
+			return nil, fmt.Errorf("config: RATE_LIMIT_GROUPS: expected group=requests/window, got %q", pair)
+		}
+		rule, err := parseRateLimitRule("RATE_LIMIT_GROUPS", spec)
+		if err != nil {
+			return nil, err
+		}
+		groups[strings.TrimSpace(name)] = rule
+	}
+	return groups, nil
+}
+
+// parseRateLimitRule parses "requests/window", e.g. "10/1m", for key
+func parseRateLimitRule(key, spec string) (RateLimitRule, error) {
+	requests, window, ok := strings.Cut(spec, "/")
+	if !ok {
+		return RateLimitRule{}, fmt.Errorf("config: %s: expected requests/window, got %q", key, spec)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(requests))
+	if err != nil {
+		return RateLimitRule{}, fmt.Errorf("config: %s: %w", key, err)
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(window))
+	if err != nil {
+		return RateLimitRule{}, fmt.Errorf("config: %s: %w", key, err)
+	}
+	return RateLimitRule{Requests: n, Window: d}, nil
+}
+
+// parseExperiments parses "name=variant:percent,variant:percent;name=..."
+func parseExperiments(v string) ([]ExperimentConfig, error) {
+	var experiments []ExperimentConfig
+	for _, spec := range strings.Split(v, ";") {
+		if strings.TrimSpace(spec) == "" {
+			continue
+		}
+		name, variants, found := strings.Cut(spec, "=")
+		if !found {
+			return nil, fmt.Errorf("config: EXPERIMENTS: expected name=variants, got %q", spec)
+		}
+		exp := ExperimentConfig{Name: strings.TrimSpace(name)}
+		for _, variant := range strings.Split(variants, ",") {
+			variantName, percent, found := strings.Cut(variant, ":")
+			if !found {
+				return nil, fmt.Errorf("config: EXPERIMENTS: expected variant:percent, got %q", variant)
+			}
+			p, err := strconv.Atoi(strings.TrimSpace(percent))
+			if err != nil {
+				return nil, fmt.Errorf("config: EXPERIMENTS: %w", err)
+			}
+			exp.Variants = append(exp.Variants, VariantConfig{Name: strings.TrimSpace(variantName), Percent: p})
+		}
+		experiments = append(experiments, exp)
+	}
+	return experiments, nil
+}
@@ -0,0 +1,808 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFromEnvParsesRouteTimeouts(t *testing.T) {
+	t.Setenv("REQUEST_TIMEOUT", "3s")
+	t.Setenv("ROUTE_TIMEOUTS", "/api/v1/users/export=2m, GET /api/v1/users=1s")
+
+	cfg, err := FromEnv()
+	if err != nil {
+		t.Fatalf("FromEnv: %v", err)
+	}
+
+	if cfg.Server.RequestTimeout != 3*time.Second {
+		t.Errorf("RequestTimeout = %v, want 3s", cfg.Server.RequestTimeout)
+	}
+	want := map[string]time.Duration{
+		"/api/v1/users/export": 2 * time.Minute,
+		"GET /api/v1/users":    time.Second,
+	}
+	for route, timeout := range want {
+		if cfg.Server.RouteTimeouts[route] != timeout {
+			t.Errorf("RouteTimeouts[%q] = %v, want %v", route, cfg.Server.RouteTimeouts[route], timeout)
+		}
+	}
+}
+
+func TestFromEnvRejectsMalformedRouteTimeouts(t *testing.T) {
+	t.Setenv("ROUTE_TIMEOUTS", "/api/v1/users")
+
+	if _, err := FromEnv(); err == nil {
+		t.Error("expected an error for a pair without a duration")
+	}
+}
+
+func TestFromEnvParsesRouteBodyLimits(t *testing.T) {
+	t.Setenv("ROUTE_MAX_BODY_BYTES", "POST /api/v1/protected/files=104857600, /api/v1/users/:id=4096")
+
+	cfg, err := FromEnv()
+	if err != nil {
+		t.Fatalf("FromEnv: %v", err)
+	}
+	if got := cfg.Server.RouteMaxBody; got["POST /api/v1/protected/files"] != 100<<20 || got["/api/v1/users/:id"] != 4096 {
+		t.Errorf("RouteMaxBody = %v", got)
+	}
+
+	t.Setenv("ROUTE_MAX_BODY_BYTES", "/api/v1/users=0")
+	if _, err := FromEnv(); err == nil {
+		t.Error("expected an error for a zero limit")
+	}
+	t.Setenv("ROUTE_MAX_BODY_BYTES", "/api/v1/users=1MB")
+	if _, err := FromEnv(); err == nil {
+		t.Error("expected an error for a limit that is not a byte count")
+	}
+}
+
+func TestFromEnvParsesExperiments(t *testing.T) {
+	t.Setenv("EXPERIMENTS", "list-view=control:50,summary:50;search=new:10")
+
+	cfg, err := FromEnv()
+	if err != nil {
+		t.Fatalf("FromEnv: %v", err)
+	}
+	if len(cfg.Experiments) != 2 || len(cfg.Experiments[0].Variants) != 2 {
+		t.Fatalf("experiments = %+v", cfg.Experiments)
+	}
+	if v := cfg.Experiments[1].Variants[0]; v.Name != "new" || v.Percent != 10 {
+		t.Errorf("search variant = %+v, want new:10", v)
+	}
+}
+
+func TestFromEnvRejectsOverallocatedExperiment(t *testing.T) {
+	t.Setenv("EXPERIMENTS", "list-view=control:60,summary:50")
+
+	if _, err := FromEnv(); err == nil {
+		t.Error("expected an error for a rollout above 100%")
+	}
+}
+
+func TestFromEnvHealthPaths(t *testing.T) {
+	cfg, err := FromEnv()
+	if err != nil {
+		t.Fatalf("FromEnv: %v", err)
+	}
+	if len(cfg.Health.LivenessPaths) != 2 || cfg.Health.ReadinessPaths[0] != "/readyz" {
+		t.Errorf("default paths = %+v", cfg.Health)
+	}
+
+	t.Setenv("HEALTH_READINESS_PATHS", "/ops/ready, /readyz")
+	cfg, err = FromEnv()
+	if err != nil {
+		t.Fatalf("FromEnv: %v", err)
+	}
+	if len(cfg.Health.ReadinessPaths) != 2 || cfg.Health.ReadinessPaths[0] != "/ops/ready" {
+		t.Errorf("readiness paths = %v, want [/ops/ready /readyz]", cfg.Health.ReadinessPaths)
+	}
+
+	t.Setenv("HEALTH_CHECK_TIMEOUT", "0s")
+	if _, err := FromEnv(); err == nil {
+		t.Error("FromEnv accepted a zero health check timeout")
+	}
+}
+
+func TestFromEnvParsesTrustedProxies(t *testing.T) {
+	t.Setenv("CLIENT_CERT_HEADER", "X-Client-Cert-CN")
+	t.Setenv("CLIENT_CERT_TRUSTED_PROXIES", "10.0.0.0/8, 192.0.2.7")
+	cfg, err := FromEnv()
+	if err != nil {
+		t.Fatalf("FromEnv: %v", err)
+	}
+	got := cfg.Auth.ClientCert.TrustedProxies
+	if len(got) != 2 || got[0].String() != "10.0.0.0/8" || got[1].String() != "192.0.2.7/32" {
+		t.Errorf("trusted proxies = %v", got)
+	}
+
+	t.Setenv("CLIENT_CERT_TRUSTED_PROXIES", "not-an-ip")
+	if _, err := FromEnv(); err == nil {
+		t.Error("expected an error for an invalid proxy address")
+	}
+}
+
+func TestFromEnvParsesServerTrustedProxies(t *testing.T) {
+	cfg, err := FromEnv()
+	if err != nil {
+		t.Fatalf("FromEnv: %v", err)
+	}
+	if cfg.Server.TrustedProxies != nil {
+		t.Errorf("default trusted proxies = %v, want none", cfg.Server.TrustedProxies)
+	}
+
+	t.Setenv("TRUSTED_PROXIES", "172.16.0.0/12")
+	cfg, err = FromEnv()
+	if err != nil {
+		t.Fatalf("FromEnv: %v", err)
+	}
+	if got := cfg.Server.TrustedProxies; len(got) != 1 || got[0].String() != "172.16.0.0/12" {
+		t.Errorf("trusted proxies = %v", got)
+	}
+}
+
+func TestFromEnvProfiles(t *testing.T) {
+	t.Setenv("APP_ENV", "dev")
+	cfg, err := FromEnv()
+	if err != nil {
+		t.Fatalf("FromEnv(dev): %v", err)
+	}
+	if !cfg.Server.Swagger || !cfg.Server.PrettyJSON || !cfg.Server.OpenAPIValidation || cfg.Logging.Level != "debug" {
+		t.Errorf("dev profile = %+v, logging %+v", cfg.Server, cfg.Logging)
+	}
+	if !cfg.Database.AutoMigrate {
+		t.Error("dev profile should migrate at startup")
+	}
+	if !cfg.Auth.EmailVerification || cfg.Auth.VerificationURL == "" {
+		t.Errorf("dev profile should require email verification, got %+v", cfg.Auth)
+	}
+
+	t.Setenv("APP_ENV", "prod")
+	cfg, err = FromEnv()
+	if err != nil {
+		t.Fatalf("FromEnv(prod): %v", err)
+	}
+	if cfg.Server.Swagger || cfg.Server.OpenAPIValidation || !cfg.Server.SecurityHeaders {
+		t.Errorf("prod profile: swagger %v, openapi validation %v, security headers %v",
+			cfg.Server.Swagger, cfg.Server.OpenAPIValidation, cfg.Server.SecurityHeaders)
+	}
+	if cfg.Database.AutoMigrate {
+		t.Error("prod profile should leave migrations to the migrate command")
+	}
+
+	t.Setenv("SWAGGER_ENABLED", "true")
+	cfg, err = FromEnv()
+	if err != nil {
+		t.Fatalf("FromEnv(prod, SWAGGER_ENABLED): %v", err)
+	}
+	if !cfg.Server.Swagger {
+		t.Error("SWAGGER_ENABLED did not override the prod profile")
+	}
+}
+
+func TestFromEnvSwaggerAuth(t *testing.T) {
+	t.Setenv("SWAGGER_AUTH", "docs:s3cret")
+	cfg, err := FromEnv()
+	if err != nil {
+		t.Fatalf("FromEnv: %v", err)
+	}
+	if cfg.Server.SwaggerAuth != "docs:s3cret" {
+		t.Errorf("SwaggerAuth = %q", cfg.Server.SwaggerAuth)
+	}
+
+	for _, auth := range []string{"docs", "docs:", ":s3cret"} {
+		t.Setenv("SWAGGER_AUTH", auth)
+		if _, err := FromEnv(); err == nil {
+			t.Errorf("expected an error for SWAGGER_AUTH=%q", auth)
+		}
+	}
+}
+
+func TestFromEnvCompression(t *testing.T) {
+	t.Setenv("COMPRESSION_MIN_BYTES", "256")
+	t.Setenv("COMPRESSION_EXCLUDED_TYPES", "application/x-ndjson, model/")
+
+	cfg, err := FromEnv()
+	if err != nil {
+		t.Fatalf("FromEnv: %v", err)
+	}
+	server := cfg.Server
+	if !server.Compression || server.CompressionMinSize != 256 || len(server.CompressionExcludedTypes) != 2 {
+		t.Errorf("compression = %v, %d, %v", server.Compression, server.CompressionMinSize, server.CompressionExcludedTypes)
+	}
+
+	t.Setenv("COMPRESSION_MIN_BYTES", "-1")
+	if _, err := FromEnv(); err == nil {
+		t.Error("expected an error for a negative min size")
+	}
+}
+
+func TestFromEnvTLS(t *testing.T) {
+	t.Setenv("TLS_AUTOCERT_DOMAINS", "api.example.com, www.example.com")
+	t.Setenv("TLS_REDIRECT_ADDR", ":80")
+
+	cfg, err := FromEnv()
+	if err != nil {
+		t.Fatalf("FromEnv: %v", err)
+	}
+	if !cfg.TLS.Enabled() || len(cfg.TLS.AutocertDomains) != 2 || cfg.TLS.AutocertCacheDir != "autocert" || cfg.TLS.RedirectAddr != ":80" {
+		t.Errorf("TLS = %+v", cfg.TLS)
+	}
+
+	t.Setenv("TLS_CERT_FILE", "/etc/tls/tls.crt")
+	t.Setenv("TLS_KEY_FILE", "/etc/tls/tls.key")
+	if _, err := FromEnv(); err == nil {
+		t.Error("expected an error for certificate files combined with autocert")
+	}
+	t.Setenv("TLS_AUTOCERT_DOMAINS", "")
+	t.Setenv("TLS_KEY_FILE", "")
+	if _, err := FromEnv(); err == nil {
+		t.Error("expected an error for a certificate without a key")
+	}
+	t.Setenv("TLS_CERT_FILE", "")
+	if _, err := FromEnv(); err == nil {
+		t.Error("expected an error for a redirect without TLS")
+	}
+}
+
+func TestFromEnvTLSClientAuth(t *testing.T) {
+	t.Setenv("TLS_CERT_FILE", "/etc/tls/tls.crt")
+	t.Setenv("TLS_KEY_FILE", "/etc/tls/tls.key")
+	t.Setenv("TLS_CLIENT_CA_FILE", "/etc/tls/clients.pem")
+
+	cfg, err := FromEnv()
+	if err != nil {
+		t.Fatalf("FromEnv: %v", err)
+	}
+	if cfg.TLS.ClientCAFile != "/etc/tls/clients.pem" || cfg.TLS.ClientAuth != "require" {
+		t.Errorf("TLS = %+v, want client certificates required", cfg.TLS)
+	}
+
+	t.Setenv("TLS_CLIENT_AUTH", "sometimes")
+	if _, err := FromEnv(); err == nil {
+		t.Error("expected an error for an unknown client auth mode")
+	}
+	t.Setenv("TLS_CLIENT_AUTH", "optional")
+	t.Setenv("TLS_CERT_FILE", "")
+	t.Setenv("TLS_KEY_FILE", "")
+	if _, err := FromEnv(); err == nil {
+		t.Error("expected an error for client CAs without TLS")
+	}
+}
+
+func TestFromEnvSecurityHeaders(t *testing.T) {
+	t.Setenv("APP_ENV", "staging")
+	cfg, err := FromEnv()
+	if err != nil {
+		t.Fatalf("FromEnv: %v", err)
+	}
+	if cfg.Server.ContentSecurityPolicy != docsContentSecurityPolicy || cfg.Server.HSTSMaxAge != 24*time.Hour {
+		t.Errorf("staging: CSP %q, HSTS max-age %v", cfg.Server.ContentSecurityPolicy, cfg.Server.HSTSMaxAge)
+	}
+
+	t.Setenv("APP_ENV", "prod")
+	t.Setenv("CONTENT_SECURITY_POLICY", "default-src 'self'")
+	t.Setenv("HSTS_MAX_AGE", "0s")
+	t.Setenv("FRAME_OPTIONS", "SAMEORIGIN")
+	cfg, err = FromEnv()
+	if err != nil {
+		t.Fatalf("FromEnv: %v", err)
+	}
+	if cfg.Server.ContentSecurityPolicy != "default-src 'self'" || cfg.Server.HSTSMaxAge != 0 ||
+		cfg.Server.FrameOptions != "SAMEORIGIN" || cfg.Server.ReferrerPolicy != "no-referrer" {
+		t.Errorf("Server = %+v", cfg.Server)
+	}
+
+	t.Setenv("FRAME_OPTIONS", "ALLOW-FROM https://example.com")
+	if _, err := FromEnv(); err == nil {
+		t.Error("expected an error for an obsolete X-Frame-Options value")
+	}
+}
+
+func TestFromEnvAuditStore(t *testing.T) {
+	t.Setenv("AUDIT_STORE", "postgres")
+	t.Setenv("AUDIT_RETENTION", "720h")
+	if _, err := FromEnv(); err == nil {
+		t.Fatal("expected an error for the postgres audit store without the database")
+	}
+
+	t.Setenv("USER_STORE_BACKEND", "postgres")
+	t.Setenv("DATABASE_URL", "postgres://app@localhost/app")
+	cfg, err := FromEnv()
+	if err != nil {
+		t.Fatalf("FromEnv: %v", err)
+	}
+	if cfg.Logging.AuditStore != "postgres" || cfg.Logging.AuditRetention != 30*24*time.Hour || cfg.Scheduler.AuditPruneInterval != time.Hour {
+		t.Errorf("audit store %q, retention %v, prune interval %v", cfg.Logging.AuditStore, cfg.Logging.AuditRetention, cfg.Scheduler.AuditPruneInterval)
+	}
+
+	t.Setenv("AUDIT_STORE", "s3")
+	if _, err := FromEnv(); err == nil {
+		t.Error("expected an error for an unknown audit store")
+	}
+}
+
+func TestFromEnvLogSamplingAndFile(t *testing.T) {
+	cfg, err := FromEnv()
+	if err != nil {
+		t.Fatalf("FromEnv: %v", err)
+	}
+	if cfg.Logging.SamplingInitial != 100 || cfg.Logging.SamplingThereafter != 100 {
+		t.Errorf("sampling = %d/%d, want zap's production 100/100", cfg.Logging.SamplingInitial, cfg.Logging.SamplingThereafter)
+	}
+
+	t.Setenv("APP_ENV", "dev")
+	t.Setenv("LOG_FILE", "/var/log/api/app.log")
+	t.Setenv("LOG_FILE_MAX_BACKUPS", "3")
+	cfg, err = FromEnv()
+	if err != nil {
+		t.Fatalf("FromEnv: %v", err)
+	}
+	if cfg.Logging.SamplingInitial != 0 || cfg.Logging.File != "/var/log/api/app.log" || cfg.Logging.FileMaxBackups != 3 {
+		t.Errorf("Logging = %+v", cfg.Logging)
+	}
+
+	t.Setenv("LOG_SAMPLING_INITIAL", "10")
+	t.Setenv("LOG_SAMPLING_THEREAFTER", "0")
+	if _, err := FromEnv(); err == nil {
+		t.Error("expected an error for sampling without a thereafter rate")
+	}
+}
+
+func TestFromEnvLogBodies(t *testing.T) {
+	cfg, err := FromEnv()
+	if err != nil {
+		t.Fatalf("FromEnv: %v", err)
+	}
+	if cfg.Logging.Bodies {
+		t.Error("bodies are logged by default in prod")
+	}
+
+	t.Setenv("APP_ENV", "dev")
+	t.Setenv("LOG_BODY_MAX_BYTES", "1024")
+	t.Setenv("LOG_REDACT_FIELDS", "ssn, phone")
+	cfg, err = FromEnv()
+	if err != nil {
+		t.Fatalf("FromEnv: %v", err)
+	}
+	if !cfg.Logging.Bodies || cfg.Logging.BodyMaxBytes != 1024 || len(cfg.Logging.RedactFields) != 2 || cfg.Logging.RedactFields[1] != "phone" {
+		t.Errorf("Logging = %+v", cfg.Logging)
+	}
+
+	t.Setenv("LOG_BODY_MAX_BYTES", "0")
+	if _, err := FromEnv(); err == nil {
+		t.Error("expected an error for logging bodies without a size cap")
+	}
+}
+
+func TestFromEnvFlags(t *testing.T) {
+	t.Setenv("FLAGS_FILE", "/etc/api/flags.yaml")
+	t.Setenv("FLAGS_STORE", "redis")
+	t.Setenv("REDIS_URL", "redis://localhost:6379/0")
+	cfg, err := FromEnv()
+	if err != nil {
+		t.Fatalf("FromEnv: %v", err)
+	}
+	if cfg.Flags.File != "/etc/api/flags.yaml" || cfg.Flags.Store != "redis" || cfg.Flags.RedisURL == "" {
+		t.Errorf("Flags = %+v", cfg.Flags)
+	}
+
+	t.Setenv("FLAGS_STORE", "postgres")
+	if _, err := FromEnv(); err == nil {
+		t.Error("expected an error for the postgres flag store without the postgres backend")
+	}
+	t.Setenv("FLAGS_STORE", "etcd")
+	if _, err := FromEnv(); err == nil {
+		t.Error("expected an error for an unknown flag store")
+	}
+}
+
+func TestFromEnvRejectsUnknownProfile(t *testing.T) {
+	t.Setenv("APP_ENV", "qa")
+
+	if _, err := FromEnv(); err == nil {
+		t.Error("expected an error for an unknown APP_ENV")
+	}
+}
+
+func TestFromEnvPostgresRequiresURL(t *testing.T) {
+	t.Setenv("USER_STORE_BACKEND", "postgres")
+	if _, err := FromEnv(); err == nil {
+		t.Fatal("expected an error without DATABASE_URL")
+	}
+
+	t.Setenv("DATABASE_URL", "postgres://app@localhost/app")
+	cfg, err := FromEnv()
+	if err != nil {
+		t.Fatalf("FromEnv: %v", err)
+	}
+	if cfg.Database.MaxOpenConns != 10 {
+		t.Errorf("MaxOpenConns = %d, want default 10", cfg.Database.MaxOpenConns)
+	}
+}
+
+func TestFromEnvParsesOIDCProviders(t *testing.T) {
+	t.Setenv("OIDC_PROVIDERS", "google,corp")
+	t.Setenv("OIDC_GOOGLE_CLIENT_ID", "google-client")
+	t.Setenv("OIDC_GOOGLE_REDIRECT_URL", "https://api.example.com/api/v1/auth/oidc/callback")
+	t.Setenv("OIDC_CORP_CLIENT_ID", "corp-client")
+	t.Setenv("OIDC_CORP_REDIRECT_URL", "https://api.example.com/api/v1/auth/oidc/callback")
+
+	if _, err := FromEnv(); err == nil {
+		t.Fatal("expected an error for a generic provider without an issuer")
+	}
+
+	t.Setenv("OIDC_CORP_ISSUER", "https://login.corp.example.com")
+	cfg, err := FromEnv()
+	if err != nil {
+		t.Fatalf("FromEnv: %v", err)
+	}
+	if len(cfg.Auth.OIDC) != 2 || cfg.Auth.OIDC[1].Issuer != "https://login.corp.example.com" {
+		t.Errorf("OIDC = %+v", cfg.Auth.OIDC)
+	}
+}
+
+func TestFromEnvTracing(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://collector:4318")
+	t.Setenv("TRACING_SAMPLE_RATIO", "0.25")
+
+	cfg, err := FromEnv()
+	if err != nil {
+		t.Fatalf("FromEnv: %v", err)
+	}
+	if cfg.Tracing.Endpoint != "http://collector:4318" || cfg.Tracing.SampleRatio != 0.25 {
+		t.Errorf("Tracing = %+v", cfg.Tracing)
+	}
+	if cfg.Tracing.ServiceName != "template2-api" {
+		t.Errorf("ServiceName = %q, want the default", cfg.Tracing.ServiceName)
+	}
+
+	t.Setenv("TRACING_SAMPLE_RATIO", "1.5")
+	if _, err := FromEnv(); err == nil {
+		t.Error("expected an error for a sample ratio above 1")
+	}
+}
+
+func TestFromEnvRateLimitGroups(t *testing.T) {
+	t.Setenv("RATE_LIMIT_BACKEND", "redis")
+	t.Setenv("REDIS_URL", "redis://localhost:6379/0")
+	t.Setenv("RATE_LIMIT_GROUPS", "auth=10/1m, admin=30/30s")
+
+	cfg, err := FromEnv()
+	if err != nil {
+		t.Fatalf("FromEnv: %v", err)
+	}
+	if got := cfg.RateLimit.Groups["auth"]; got != (RateLimitRule{Requests: 10, Window: time.Minute}) {
+		t.Errorf("auth group = %+v", got)
+	}
+	if got := cfg.RateLimit.Groups["admin"]; got != (RateLimitRule{Requests: 30, Window: 30 * time.Second}) {
+		t.Errorf("admin group = %+v", got)
+	}
+
+	for _, groups := range []string{"auth=10", "reports=10/1m", "auth=0/1m"} {
+		t.Setenv("RATE_LIMIT_GROUPS", groups)
+		if _, err := FromEnv(); err == nil {
+			t.Errorf("RATE_LIMIT_GROUPS=%q: expected an error", groups)
+		}
+	}
+}
+
+func TestFromEnvEmailVerification(t *testing.T) {
+	t.Setenv("AUTH_EMAIL_VERIFICATION", "true")
+	if _, err := FromEnv(); err == nil {
+		t.Fatal("expected an error without a verification URL")
+	}
+
+	t.Setenv("AUTH_VERIFICATION_URL", "https://app.example.com/verify")
+	t.Setenv("SMTP_ADDR", "smtp.example.com:587")
+	if _, err := FromEnv(); err == nil {
+		t.Fatal("expected an error for an SMTP relay without MAIL_FROM")
+	}
+
+	t.Setenv("MAIL_FROM", "noreply@example.com")
+	cfg, err := FromEnv()
+	if err != nil {
+		t.Fatalf("FromEnv: %v", err)
+	}
+	if !cfg.Auth.EmailVerification || cfg.Auth.VerificationTTL != 24*time.Hour {
+		t.Errorf("Auth = %+v", cfg.Auth)
+	}
+	if cfg.Mail.SMTPAddr != "smtp.example.com:587" || cfg.Mail.From != "noreply@example.com" {
+		t.Errorf("Mail = %+v", cfg.Mail)
+	}
+}
+
+func TestFromEnvPasswordReset(t *testing.T) {
+	t.Setenv("AUTH_PASSWORD_RESET", "true")
+	if _, err := FromEnv(); err == nil {
+		t.Fatal("expected an error without a reset URL")
+	}
+
+	t.Setenv("AUTH_PASSWORD_RESET_URL", "https://app.example.com/reset")
+	t.Setenv("AUTH_FORGOT_PASSWORD_LIMIT", "3/10m")
+	cfg, err := FromEnv()
+	if err != nil {
+		t.Fatalf("FromEnv: %v", err)
+	}
+	want := RateLimitRule{Requests: 3, Window: 10 * time.Minute}
+	if reset := cfg.Auth.PasswordReset; reset.Limit != want || reset.TTL != time.Hour {
+		t.Errorf("PasswordReset = %+v", reset)
+	}
+
+	t.Setenv("AUTH_FORGOT_PASSWORD_LIMIT", "3")
+	if _, err := FromEnv(); err == nil {
+		t.Error("expected an error for a limit without a window")
+	}
+}
+
+func TestFromEnvTwoFactor(t *testing.T) {
+	t.Setenv("AUTH_TWO_FACTOR", "true")
+	cfg, err := FromEnv()
+	if err != nil {
+		t.Fatalf("FromEnv: %v", err)
+	}
+	if tf := cfg.Auth.TwoFactor; !tf.Enabled || tf.Issuer != "template2" || tf.ChallengeTTL != 5*time.Minute {
+		t.Errorf("TwoFactor = %+v", tf)
+	}
+
+	t.Setenv("AUTH_TOTP_ISSUER", "Acme:API")
+	if _, err := FromEnv(); err == nil {
+		t.Error("expected an error for an issuer containing a colon")
+	}
+}
+
+func TestFromEnvResponseCache(t *testing.T) {
+	t.Setenv("RESPONSE_CACHE_TTL", "30s")
+	t.Setenv("RESPONSE_CACHE_BACKEND", "redis")
+	t.Setenv("REDIS_URL", "redis://localhost:6379/0")
+
+	cfg, err := FromEnv()
+	if err != nil {
+		t.Fatalf("FromEnv: %v", err)
+	}
+	if cfg.Cache.TTL != 30*time.Second || cfg.Cache.Backend != "redis" || cfg.Cache.RedisURL != "redis://localhost:6379/0" {
+		t.Errorf("cache = %+v", cfg.Cache)
+	}
+
+	t.Setenv("REDIS_URL", "")
+	if _, err := FromEnv(); err == nil {
+		t.Error("expected an error for the redis backend without REDIS_URL")
+	}
+	t.Setenv("RESPONSE_CACHE_BACKEND", "memcached")
+	if _, err := FromEnv(); err == nil {
+		t.Error("expected an error for an unknown backend")
+	}
+	t.Setenv("RESPONSE_CACHE_BACKEND", "memory")
+	t.Setenv("RESPONSE_CACHE_MAX_ENTRIES", "0")
+	if _, err := FromEnv(); err == nil {
+		t.Error("expected an error for zero max entries")
+	}
+}
+
+func TestFromEnvIdempotency(t *testing.T) {
+	cfg, err := FromEnv()
+	if err != nil {
+		t.Fatalf("FromEnv: %v", err)
+	}
+	if cfg.Idempotency.TTL != 24*time.Hour || cfg.Idempotency.Backend != "memory" {
+		t.Errorf("default idempotency = %+v", cfg.Idempotency)
+	}
+
+	t.Setenv("IDEMPOTENCY_TTL", "1h")
+	t.Setenv("IDEMPOTENCY_BACKEND", "redis")
+	t.Setenv("REDIS_URL", "redis://localhost:6379/0")
+	if cfg, err = FromEnv(); err != nil {
+		t.Fatalf("FromEnv: %v", err)
+	}
+	if cfg.Idempotency.TTL != time.Hour || cfg.Idempotency.RedisURL != "redis://localhost:6379/0" {
+		t.Errorf("idempotency = %+v", cfg.Idempotency)
+	}
+
+	t.Setenv("REDIS_URL", "")
+	if _, err := FromEnv(); err == nil {
+		t.Error("expected an error for the redis backend without REDIS_URL")
+	}
+	t.Setenv("IDEMPOTENCY_BACKEND", "etcd")
+	if _, err := FromEnv(); err == nil {
+		t.Error("expected an error for an unknown backend")
+	}
+}
+
+func TestFromEnvSessions(t *testing.T) {
+	t.Setenv("AUTH_SESSIONS_ENABLED", "true")
+	t.Setenv("AUTH_SESSION_BACKEND", "redis")
+	t.Setenv("REDIS_URL", "redis://localhost:6379/0")
+
+	cfg, err := FromEnv()
+	if err != nil {
+		t.Fatalf("FromEnv: %v", err)
+	}
+	sessions := cfg.Auth.Sessions
+	if sessions.Name != "session" || sessions.CSRFCookie != "csrf_token" || !sessions.Secure || sessions.RedisURL != "redis://localhost:6379/0" {
+		t.Errorf("Sessions = %+v", sessions)
+	}
+
+	t.Setenv("AUTH_COOKIE_ENABLED", "true")
+	if _, err := FromEnv(); err == nil {
+		t.Error("expected an error for sessions combined with the access token cookie")
+	}
+	t.Setenv("AUTH_COOKIE_ENABLED", "false")
+	t.Setenv("AUTH_CSRF_COOKIE", "session")
+	if _, err := FromEnv(); err == nil {
+		t.Error("expected an error for one cookie name used twice")
+	}
+	t.Setenv("AUTH_CSRF_COOKIE", "csrf_token")
+	t.Setenv("REDIS_URL", "")
+	if _, err := FromEnv(); err == nil {
+		t.Error("expected an error for the redis backend without REDIS_URL")
+	}
+}
+
+func TestFromEnvFiles(t *testing.T) {
+	t.Setenv("FILES_ENABLED", "true")
+	t.Setenv("FILES_BACKEND", "s3")
+	if _, err := FromEnv(); err == nil {
+		t.Fatal("expected an error for the s3 backend without an endpoint")
+	}
+
+	t.Setenv("S3_ENDPOINT", "http://minio:9000")
+	t.Setenv("S3_BUCKET", "uploads")
+	t.Setenv("FILES_ALLOWED_TYPES", "image/png, application/pdf")
+	cfg, err := FromEnv()
+	if err != nil {
+		t.Fatalf("FromEnv: %v", err)
+	}
+	if files := cfg.Files; files.S3.Bucket != "uploads" || files.S3.Region != "us-east-1" || len(files.AllowedTypes) != 2 {
+		t.Errorf("Files = %+v", files)
+	}
+
+	t.Setenv("FILES_BACKEND", "ftp")
+	if _, err := FromEnv(); err == nil {
+		t.Error("expected an error for an unknown backend")
+	}
+}
+
+func TestFromEnvAvatars(t *testing.T) {
+	t.Setenv("AVATARS_ENABLED", "true")
+	t.Setenv("AVATAR_MAX_SIDE", "1024")
+	cfg, err := FromEnv()
+	if err != nil {
+		t.Fatalf("FromEnv: %v", err)
+	}
+	if a := cfg.Avatars; a.MaxSide != 1024 || a.MinSide != 32 || a.Workers != 2 {
+		t.Errorf("Avatars = %+v", a)
+	}
+
+	t.Setenv("AVATAR_MIN_SIDE", "2048")
+	if _, err := FromEnv(); err == nil {
+		t.Error("expected an error for a min side above the max")
+	}
+	t.Setenv("AVATAR_MIN_SIDE", "32")
+	t.Setenv("FILES_BACKEND", "s3")
+	if _, err := FromEnv(); err == nil {
+		t.Error("expected the avatar store to need an S3 endpoint")
+	}
+}
+
+func TestFromEnvMailAPI(t *testing.T) {
+	t.Setenv("MAIL_API_URL", "https://api.sendgrid.com/v3/mail/send")
+	t.Setenv("MAIL_FROM", "noreply@example.com")
+	if _, err := FromEnv(); err == nil {
+		t.Error("expected the mail API to need a key")
+	}
+	t.Setenv("MAIL_API_KEY", "key")
+	cfg, err := FromEnv()
+	if err != nil {
+		t.Fatalf("FromEnv: %v", err)
+	}
+	if cfg.Mail.APIKey != "key" {
+		t.Errorf("Mail = %+v", cfg.Mail)
+	}
+	t.Setenv("SMTP_ADDR", "localhost:25")
+	if _, err := FromEnv(); err == nil {
+		t.Error("expected an error for both a relay and an API")
+	}
+}
+
+func TestFromEnvJobs(t *testing.T) {
+	t.Setenv("JOBS_WORKERS", "8")
+	t.Setenv("JOBS_RETRY_BACKOFF", "1s")
+	cfg, err := FromEnv()
+	if err != nil {
+		t.Fatalf("FromEnv: %v", err)
+	}
+	if j := cfg.Jobs; j.Backend != "memory" || j.Workers != 8 || j.RetryBackoff != time.Second || j.MaxAttempts != 5 {
+		t.Errorf("Jobs = %+v", j)
+	}
+
+	t.Setenv("JOBS_BACKEND", "redis")
+	if _, err := FromEnv(); err == nil {
+		t.Error("expected the redis job backend to need REDIS_URL")
+	}
+	t.Setenv("REDIS_URL", "redis://localhost:6379/0")
+	t.Setenv("JOBS_MAX_BACKOFF", "500ms")
+	if _, err := FromEnv(); err == nil {
+		t.Error("expected an error for a max backoff below the initial one")
+	}
+}
+
+func TestFromEnvScheduler(t *testing.T) {
+	t.Setenv("SESSION_CLEANUP_INTERVAL", "0")
+	cfg, err := FromEnv()
+	if err != nil {
+		t.Fatalf("FromEnv: %v", err)
+	}
+	if s := cfg.Scheduler; s.SessionCleanupInterval != 0 || s.TokenCleanupInterval != time.Hour || s.Jitter != time.Minute {
+		t.Errorf("Scheduler = %+v", s)
+	}
+
+	t.Setenv("SCHEDULER_JITTER", "-1s")
+	if _, err := FromEnv(); err == nil {
+		t.Error("expected an error for a negative jitter")
+	}
+}
+
+func TestFromEnvGRPC(t *testing.T) {
+	cfg, err := FromEnv()
+	if err != nil {
+		t.Fatalf("FromEnv: %v", err)
+	}
+	if g := cfg.GRPC; g.Enabled || g.Addr != ":9090" || g.Gateway || g.GatewayAddr != ":8081" {
+		t.Errorf("GRPC = %+v", g)
+	}
+	t.Setenv("GRPC_GATEWAY_ENABLED", "true")
+	if _, err := FromEnv(); err == nil {
+		t.Error("expected the gateway to need the gRPC server")
+	}
+
+	t.Setenv("GRPC_ENABLED", "true")
+	t.Setenv("GRPC_ADDR", ":9443")
+	t.Setenv("GRPC_GATEWAY_COMPAT", "true")
+	cfg, err = FromEnv()
+	if err != nil {
+		t.Fatalf("FromEnv: %v", err)
+	}
+	if g := cfg.GRPC; !g.Enabled || g.Addr != ":9443" || !g.Gateway || !g.GatewayCompat {
+		t.Errorf("GRPC = %+v", g)
+	}
+
+	t.Setenv("GRPC_GATEWAY_ADDR", ":9443")
+	if _, err := FromEnv(); err == nil {
+		t.Error("expected an error for a gateway address shared with the gRPC server")
+	}
+	t.Setenv("GRPC_GATEWAY_ADDR", ":8081")
+
+	t.Setenv("GRPC_ADDR", cfg.Server.Addr)
+	if _, err := FromEnv(); err == nil {
+		t.Error("expected an error for a gRPC address shared with the HTTP server")
+	}
+}
+
+func TestFromEnvBroker(t *testing.T) {
+	cfg, err := FromEnv()
+	if err != nil {
+		t.Fatalf("FromEnv: %v", err)
+	}
+	if b := cfg.Broker; b.Backend != "" || b.TopicPrefix != "template2.events" || b.Encoding != "json" {
+		t.Errorf("Broker = %+v", b)
+	}
+
+	t.Setenv("BROKER_BACKEND", "nats")
+	if _, err := FromEnv(); err == nil {
+		t.Error("expected the nats broker to need BROKER_URL")
+	}
+	t.Setenv("BROKER_URL", "nats://nats:4222")
+	t.Setenv("BROKER_ENCODING", "protobuf")
+	cfg, err = FromEnv()
+	if err != nil {
+		t.Fatalf("FromEnv: %v", err)
+	}
+	if b := cfg.Broker; b.Backend != "nats" || b.URL != "nats://nats:4222" || b.Encoding != "protobuf" {
+		t.Errorf("Broker = %+v", b)
+	}
+
+	t.Setenv("BROKER_ENCODING", "avro")
+	if _, err := FromEnv(); err == nil {
+		t.Error("expected an error for an unknown encoding")
+	}
+}
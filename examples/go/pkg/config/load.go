@@ -0,0 +1,149 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// lookupFunc returns the raw value of a setting and whether it is set
+type lookupFunc func(key string) (string, bool)
+
+// flagKeys maps the named command-line flags to the settings they set
+var flagKeys = []struct {
+	name, key, usage string
+}{
+	{"env", "APP_ENV", "environment profile: dev, staging or prod"},
+	{"addr", "SERVER_ADDR", "address to listen on"},
+	{"log-level", "LOG_LEVEL", "minimum log level"},
+	{"cors-origins", "CORS_ALLOWED_ORIGINS", "comma-separated origins allowed by CORS"},
+	{"request-timeout", "REQUEST_TIMEOUT", "default request deadline"},
+	{"rate-limit-requests", "RATE_LIMIT_REQUESTS", "requests allowed per rate limit window"},
+	{"rate-limit-window", "RATE_LIMIT_WINDOW", "rate limit window"},
+	{"user-store", "USER_STORE_BACKEND", "user store backend: memory or postgres"},
+}
+
+// Load builds the configuration from, in increasing precedence, the APP_ENV
+// profile defaults, the YAML file named by -config or CONFIG_FILE, environment
+// variables and command-line flags in args (without the program name).
+//
+// Every setting has one key, the environment variable name, and the file is
+// a flat mapping of those keys, e.g. "JWT_TTL: 30m"; lists may be written as
+// YAML sequences. Flags cover the common settings by name and any other
+// through a repeatable -set KEY=VALUE. -h prints the flags and returns an
+// error wrapping flag.ErrHelp.
+func Load(args []string) (*Config, error) {
+	flags, file, err := parseFlags(args)
+	if err != nil {
+		return nil, err
+	}
+
+	if file == "" {
+		file = os.Getenv("CONFIG_FILE")
+	}
+	values := map[string]string{}
+	if file != "" {
+		if values, err = readFile(file); err != nil {
+			return nil, err
+		}
+	}
+
+	return build(func(key string) (string, bool) {
+		if v, ok := flags[key]; ok {
+			return v, true
+		}
+		if v, ok := os.LookupEnv(key); ok {
+			return v, true
+		}
+		v, ok := values[key]
+		return v, ok
+	})
+}
+
+// setFlag collects -set KEY=VALUE pairs
+type setFlag map[string]string
+
+func (s setFlag) String() string {
+	pairs := make([]string, 0, len(s))
+	for key, value := range s {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (s setFlag) Set(pair string) error {
+	key, value, ok := strings.Cut(pair, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("want KEY=VALUE, got %q", pair)
+	}
+	s[key] = value
+	return nil
+}
+
+// parseFlags returns the settings given on the command line and the config
+// file path, if any
+func parseFlags(args []string) (map[string]string, string, error) {
+	fs := flag.NewFlagSet("api", flag.ContinueOnError)
+
+	file := fs.String("config", "", "YAML configuration file")
+	set := setFlag{}
+	fs.Var(set, "set", "set any setting as KEY=VALUE; may be repeated")
+	named := make(map[string]*string, len(flagKeys))
+	for _, f := range flagKeys {
+		named[f.name] = fs.String(f.name, "", f.usage)
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, "", fmt.Errorf("config: %w", err)
+	}
+	if fs.NArg() > 0 {
+		return nil, "", fmt.Errorf("config: unexpected argument %q", fs.Arg(0))
+	}
+
+	values := map[string]string(set)
+	fs.Visit(func(f *flag.Flag) {
+		for _, known := range flagKeys {
+			if known.name == f.Name {
+				values[known.key] = *named[f.Name]
+			}
+		}
+	})
+	return values, *file, nil
+}
+
+// readFile parses a flat YAML mapping of setting keys to scalars or lists
+func readFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("config: %w", err)
+	}
+
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("config: %s: %w", path, err)
+	}
+
+	values := make(map[string]string, len(raw))
+	for key, value := range raw {
+		switch v := value.(type) {
+		case nil:
+			values[key] = ""
+		case []interface{}:
+			items := make([]string, 0, len(v))
+			for _, item := range v {
+				items = append(items, fmt.Sprint(item))
+			}
+			values[key] = strings.Join(items, ",")
+		case map[string]interface{}:
+			return nil, fmt.Errorf("config: %s: %s must be a scalar or a list", path, key)
+		default:
+			values[key] = fmt.Sprint(v)
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeConfigFile(t, `
+APP_ENV: dev
+RATE_LIMIT_REQUESTS: 50
+RATE_LIMIT_WINDOW: 30s
+REQUEST_TIMEOUT: 4s
+CORS_ALLOWED_ORIGINS:
+  - https://app.example.com
+  - https://admin.example.com
+`)
+	t.Setenv("RATE_LIMIT_REQUESTS", "75")
+	t.Setenv("REQUEST_TIMEOUT", "6s")
+
+	cfg, err := Load([]string{"-config", path, "-request-timeout", "8s", "-set", "JWT_TTL=1h"})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	if cfg.Env != EnvDev || !cfg.Server.Swagger {
+		t.Errorf("profile from file not applied: env %q, swagger %v", cfg.Env, cfg.Server.Swagger)
+	}
+	if cfg.RateLimit.Window != 30*time.Second {
+		t.Errorf("file: RateLimit.Window = %v, want 30s", cfg.RateLimit.Window)
+	}
+	if cfg.RateLimit.Requests != 75 {
+		t.Errorf("env over file: RateLimit.Requests = %d, want 75", cfg.RateLimit.Requests)
+	}
+	if cfg.Server.RequestTimeout != 8*time.Second {
+		t.Errorf("flag over env: RequestTimeout = %v, want 8s", cfg.Server.RequestTimeout)
+	}
+	if cfg.Auth.TokenTTL != time.Hour {
+		t.Errorf("-set: TokenTTL = %v, want 1h", cfg.Auth.TokenTTL)
+	}
+	if len(cfg.CORS.AllowedOrigins) != 2 || cfg.CORS.AllowedOrigins[1] != "https://admin.example.com" {
+		t.Errorf("CORS.AllowedOrigins = %v", cfg.CORS.AllowedOrigins)
+	}
+}
+
+func TestLoadUsesConfigFileFromEnv(t *testing.T) {
+	t.Setenv("CONFIG_FILE", writeConfigFile(t, "SERVER_ADDR: \":9090\"\n"))
+
+	cfg, err := Load(nil)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.Server.Addr != ":9090" {
+		t.Errorf("Addr = %q, want :9090", cfg.Server.Addr)
+	}
+}
+
+func TestLoadValidatesAtStartup(t *testing.T) {
+	for name, args := range map[string][]string{
+		"invalid value":    {"-rate-limit-requests", "0"},
+		"unknown flag":     {"-no-such-flag"},
+		"malformed -set":   {"-set", "JWT_TTL"},
+		"stray argument":   {"serve"},
+		"missing file":     {"-config", filepath.Join(t.TempDir(), "missing.yaml")},
+		"wildcard + creds": {"-cors-origins", "*", "-set", "CORS_ALLOW_CREDENTIALS=true"},
+	} {
+		if _, err := Load(args); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
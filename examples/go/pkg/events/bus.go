@@ -0,0 +1,126 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// All subscribes a handler to every event
+const All = "*"
+
+// Publisher publishes events, such as a Bus. Services publish after a change
+// has been made; publishing never fails the change.
+type Publisher interface {
+	Publish(ctx context.Context, e Event)
+}
+
+// Handler reacts to an event. Errors are logged by the bus; they do not reach
+// the publisher or the other handlers.
+type Handler func(ctx context.Context, e Event) error
+
+type subscriber struct {
+	handler Handler
+	async   bool
+}
+
+// Bus is an in-process Publisher dispatching events to the handlers
+// subscribed to their name
+type Bus struct {
+	logger *zap.Logger
+
+	mu          sync.RWMutex
+	subscribers map[string][]subscriber
+	stopped     bool
+	// running counts the asynchronous handlers still running
+	running sync.WaitGroup
+}
+
+// NewBus creates a bus without subscribers
+func NewBus(logger *zap.Logger) *Bus {
+	return &Bus{logger: logger, subscribers: make(map[string][]subscriber)}
+}
+
+// Subscribe runs handler for every event named name, or for every event
+// with All, within Publish: the publisher waits for it, so it should be
+// quick
+func (b *Bus) Subscribe(name string, handler Handler) {
+	b.subscribe(name, subscriber{handler: handler})
+}
+
+// SubscribeAsync runs handler for every event named name, or for every
+// event with All, in a goroutine of its own. The handler's context keeps the
+// publisher's values but not its cancellation.
+func (b *Bus) SubscribeAsync(name string, handler Handler) {
+	b.subscribe(name, subscriber{handler: handler, async: true})
+}
+
+func (b *Bus) subscribe(name string, sub subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers[name] = append(b.subscribers[name], sub)
+}
+
+// Publish implements Publisher. Synchronous handlers run in subscription
+// order before it returns.
+func (b *Bus) Publish(ctx context.Context, e Event) {
+	b.mu.RLock()
+	subs := append(append([]subscriber(nil), b.subscribers[e.EventName()]...), b.subscribers[All]...)
+	stopped := b.stopped
+	if !stopped {
+		for _, sub := range subs {
+			if sub.async {
+				b.running.Add(1)
+			}
+		}
+	}
+	b.mu.RUnlock()
+
+	for _, sub := range subs {
+		switch {
+		case !sub.async:
+			b.call(ctx, sub.handler, e)
+		case stopped:
+			b.logger.Warn("Event dropped after shutdown", zap.String("event", e.EventName()))
+		default:
+			go func(handler Handler) {
+				defer b.running.Done()
+				b.call(context.WithoutCancel(ctx), handler, e)
+			}(sub.handler)
+		}
+	}
+}
+
+// call runs handler, logging its error or panic
+func (b *Bus) call(ctx context.Context, handler Handler, e Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			b.logger.Error("Event handler panicked", zap.String("event", e.EventName()), zap.Any("panic", r))
+		}
+	}()
+	if err := handler(ctx, e); err != nil {
+		b.logger.Error("Event handler failed", zap.String("event", e.EventName()), zap.Error(err))
+	}
+}
+
+// Stop waits for the asynchronous handlers still running. Asynchronous
+// handlers of events published afterwards are skipped.
+func (b *Bus) Stop(ctx context.Context) error {
+	b.mu.Lock()
+	b.stopped = true
+	b.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		b.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("events: stop: %w", ctx.Err())
+	}
+}
@@ -0,0 +1,85 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type ctxKey struct{}
+
+func TestBusDispatchesByName(t *testing.T) {
+	bus := NewBus(zap.NewNop())
+	var got []string
+	bus.Subscribe(NameUserCreated, func(ctx context.Context, e Event) error {
+		got = append(got, "created:"+ctx.Value(ctxKey{}).(string))
+		return errors.New("ignored")
+	})
+	bus.Subscribe(NameUserCreated, func(ctx context.Context, e Event) error {
+		panic("recovered")
+	})
+	bus.Subscribe(All, func(ctx context.Context, e Event) error {
+		got = append(got, "all:"+e.EventName())
+		return nil
+	})
+
+	ctx := context.WithValue(context.Background(), ctxKey{}, "req-1")
+	bus.Publish(ctx, UserCreated{UserID: 3})
+	bus.Publish(ctx, UserDeleted{UserID: 3})
+
+	want := []string{"created:req-1", "all:user.created", "all:user.deleted"}
+	if len(got) != len(want) {
+		t.Fatalf("handled %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("handled %v, want %v", got, want)
+			break
+		}
+	}
+}
+
+func TestBusRunsAsyncHandlersDetached(t *testing.T) {
+	bus := NewBus(zap.NewNop())
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var got []Event
+	bus.SubscribeAsync(NameLoginFailed, func(ctx context.Context, e Event) error {
+		<-release
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		mu.Lock()
+		got = append(got, e)
+		mu.Unlock()
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	bus.Publish(ctx, LoginFailed{UserID: 3})
+	cancel()
+
+	stopCtx, stopCancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer stopCancel()
+	if err := bus.Stop(stopCtx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("stop with a handler blocked: err = %v, want DeadlineExceeded", err)
+	}
+	close(release)
+	if err := bus.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	if len(got) != 1 || got[0] != (LoginFailed{UserID: 3}) {
+		t.Errorf("handled %v, want the failed login", got)
+	}
+	mu.Unlock()
+
+	bus.Publish(context.Background(), LoginFailed{UserID: 4})
+	if err := bus.Stop(context.Background()); err != nil || len(got) != 1 {
+		t.Errorf("handled %v after stop, want the event dropped", got)
+	}
+}
@@ -0,0 +1,93 @@
+// Package events carries domain events from the services that cause them to
+// the components reacting to them, so webhooks, audit logging and metrics
+// hook into user and auth changes without the handlers knowing about them
+package events
+
+// Event names
+const (
+	NameUserCreated    = "user.created"
+	NameUserUpdated    = "user.updated"
+	NameUserDeleted    = "user.deleted"
+	NameLoginSucceeded = "auth.login_succeeded"
+	NameLoginFailed    = "auth.login_failed"
+	NamePasswordReset  = "auth.password_reset"
+	NameTokensRevoked  = "auth.tokens_revoked"
+)
+
+// Event is something that happened in the domain. Events are values: they
+// are marshaled to JSON as is wherever they leave the process.
+type Event interface {
+	// EventName returns one of the Name constants
+	EventName() string
+}
+
+// UserCreated is published by UserService when a user is created
+type UserCreated struct {
+	UserID int    `json:"user_id"`
+	Name   string `json:"name"`
+	Email  string `json:"email"`
+	Role   string `json:"role"`
+}
+
+// EventName implements Event
+func (UserCreated) EventName() string { return NameUserCreated }
+
+// UserUpdated is published by UserService when a user's fields, role, lock
+// or email verification change. It carries the user as updated.
+type UserUpdated struct {
+	UserID        int    `json:"user_id"`
+	Name          string `json:"name"`
+	Email         string `json:"email"`
+	Role          string `json:"role"`
+	Active        bool   `json:"active"`
+	Locked        bool   `json:"locked"`
+	EmailVerified bool   `json:"email_verified"`
+}
+
+// EventName implements Event
+func (UserUpdated) EventName() string { return NameUserUpdated }
+
+// UserDeleted is published by UserService when a user is deleted, softly
+// or for good, including the source user of a merge
+type UserDeleted struct {
+	UserID int  `json:"user_id"`
+	Hard   bool `json:"hard"`
+}
+
+// EventName implements Event
+func (UserDeleted) EventName() string { return NameUserDeleted }
+
+// LoginSucceeded is published by AuthService when it starts a session
+type LoginSucceeded struct {
+	UserID    int    `json:"user_id"`
+	SessionID string `json:"session_id"`
+}
+
+// EventName implements Event
+func (LoginSucceeded) EventName() string { return NameLoginSucceeded }
+
+// LoginFailed is published by AuthService when a password does not match
+type LoginFailed struct {
+	UserID int `json:"user_id"`
+}
+
+// EventName implements Event
+func (LoginFailed) EventName() string { return NameLoginFailed }
+
+// PasswordReset is published by AuthService when a user resets their
+// password with a reset token
+type PasswordReset struct {
+	UserID int `json:"user_id"`
+}
+
+// EventName implements Event
+func (PasswordReset) EventName() string { return NamePasswordReset }
+
+// TokensRevoked is published by AuthService when every token of a user is
+// revoked
+type TokensRevoked struct {
+	UserID int `json:"user_id"`
+}
+
+// EventName implements Event
+func (TokensRevoked) EventName() string { return NameTokensRevoked }
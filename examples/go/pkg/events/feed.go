@@ -0,0 +1,107 @@
+package events
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Record is an event as kept by a Feed
+type Record struct {
+	// ID numbers the records of a feed from 1 in publish order
+	ID    uint64
+	Time  time.Time
+	Event Event
+}
+
+// Feed keeps the most recent events and passes new ones to its
+// subscriptions, so a client that reconnects can be sent what it missed.
+// Subscribe its Handle to a Bus synchronously so records are numbered in
+// publish order.
+type Feed struct {
+	mu      sync.Mutex
+	records []Record // ring of at most size records, oldest at start
+	start   int
+	size    int
+	lastID  uint64
+	subs    map[*Subscription]struct{}
+	now     func() time.Time
+}
+
+// Subscription receives the records published to a Feed after it was made
+type Subscription struct {
+	feed *Feed
+	c    chan Record
+}
+
+// NewFeed creates a feed keeping the last size events
+func NewFeed(size int) *Feed {
+	return &Feed{size: max(size, 1), subs: make(map[*Subscription]struct{}), now: time.Now}
+}
+
+// Handle is a Handler adding e to the feed. A subscription whose buffer is
+// full is closed rather than waited for.
+func (f *Feed) Handle(_ context.Context, e Event) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.lastID++
+	record := Record{ID: f.lastID, Time: f.now(), Event: e}
+	if len(f.records) < f.size {
+		f.records = append(f.records, record)
+	} else {
+		f.records[f.start] = record
+		f.start = (f.start + 1) % f.size
+	}
+
+	for sub := range f.subs {
+		select {
+		case sub.c <- record:
+		default:
+			delete(f.subs, sub)
+			close(sub.c)
+		}
+	}
+	return nil
+}
+
+// Subscribe returns the kept records after the one with ID after, oldest
+// first, and a subscription to the records that follow them. An after of 0,
+// or one the feed has not reached, as when a client kept an ID across a
+// restart, replays every kept record. buffer is how many records the
+// subscription holds before it falls behind and is closed.
+func (f *Feed) Subscribe(after uint64, buffer int) ([]Record, *Subscription) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if after > f.lastID {
+		after = 0
+	}
+	var missed []Record
+	for i := range f.records {
+		record := f.records[(f.start+i)%len(f.records)]
+		if record.ID > after {
+			missed = append(missed, record)
+		}
+	}
+
+	sub := &Subscription{feed: f, c: make(chan Record, buffer)}
+	f.subs[sub] = struct{}{}
+	return missed, sub
+}
+
+// C delivers the subscription's records. It is closed when the
+// subscription falls behind or is closed.
+func (s *Subscription) C() <-chan Record {
+	return s.c
+}
+
+// Close stops the subscription
+func (s *Subscription) Close() {
+	s.feed.mu.Lock()
+	defer s.feed.mu.Unlock()
+	if _, ok := s.feed.subs[s]; ok {
+		delete(s.feed.subs, s)
+		close(s.c)
+	}
+}
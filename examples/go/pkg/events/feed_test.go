@@ -0,0 +1,55 @@
+package events
+
+import (
+	"context"
+	"testing"
+)
+
+func TestFeedReplaysWhatWasMissed(t *testing.T) {
+	feed := NewFeed(3)
+	ctx := context.Background()
+	for id := 1; id <= 5; id++ {
+		_ = feed.Handle(ctx, UserCreated{UserID: id})
+	}
+
+	missed, sub := feed.Subscribe(3, 1)
+	defer sub.Close()
+	if len(missed) != 2 || missed[0].ID != 4 || missed[1].Event.(UserCreated).UserID != 5 {
+		t.Errorf("after 3: missed %+v", missed)
+	}
+	if all, s := feed.Subscribe(0, 1); len(all) != 3 || all[0].ID != 3 {
+		t.Errorf("after 0: missed %+v, want the 3 kept", all)
+	} else {
+		s.Close()
+	}
+	// An ID from before a restart replays everything kept
+	if all, s := feed.Subscribe(42, 1); len(all) != 3 {
+		t.Errorf("after 42: missed %+v, want the 3 kept", all)
+	} else {
+		s.Close()
+	}
+
+	_ = feed.Handle(ctx, UserDeleted{UserID: 1})
+	if record := <-sub.C(); record.ID != 6 || record.Event.EventName() != NameUserDeleted {
+		t.Errorf("received %+v", record)
+	}
+}
+
+func TestFeedClosesSubscriptionsThatFallBehind(t *testing.T) {
+	feed := NewFeed(10)
+	_, slow := feed.Subscribe(0, 1)
+	_, closed := feed.Subscribe(0, 1)
+	closed.Close()
+
+	ctx := context.Background()
+	_ = feed.Handle(ctx, UserCreated{UserID: 1})
+	_ = feed.Handle(ctx, UserCreated{UserID: 2})
+
+	if record, ok := <-slow.C(); !ok || record.ID != 1 {
+		t.Errorf("first record = %+v, %v", record, ok)
+	}
+	if _, ok := <-slow.C(); ok {
+		t.Error("subscription that fell behind is still open")
+	}
+	slow.Close()
+}
@@ -0,0 +1,298 @@
+// Package flags turns features on and off without a deploy. Flags come from
+// providers: a Static set loaded from a file ships defaults with the
+// release, and a Store in memory, Redis or the database holds the changes
+// admins make at runtime, which take precedence. A flag may be rolled out
+// to a percentage of users, chosen by a hash of the flag name and user ID
+// so each user keeps their answer as the percentage grows.
+//
+// Handlers ask through the request context:
+//
+//	if flags.Enabled(c.Request.Context(), "new_export") { ... }
+package flags
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"sync"
+
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// ErrUnknownFlag is returned when deleting a flag the store does not hold
+var ErrUnknownFlag = errors.New("flags: unknown flag")
+
+// Flag is a feature switch. An enabled flag is on for Percent of users;
+// at 100 it is on for every caller, including anonymous ones.
+type Flag struct {
+	Name        string `json:"name" yaml:"name"`
+	Description string `json:"description,omitempty" yaml:"description"`
+	Enabled     bool   `json:"enabled" yaml:"enabled"`
+	Percent     int    `json:"percent" yaml:"percent"`
+}
+
+// namePattern is what flag names look like, e.g. "new_export" or
+// "billing.v2"
+var namePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,63}$`)
+
+// ValidName reports whether name may name a flag: up to 64 lowercase
+// letters, digits, dots, dashes and underscores, starting with a letter or
+// digit
+func ValidName(name string) bool {
+	return namePattern.MatchString(name)
+}
+
+// Validate checks the flag's name and that its percentage is in range
+func (f Flag) Validate() error {
+	if !ValidName(f.Name) {
+		return fmt.Errorf("flags: invalid flag name %q", f.Name)
+	}
+	if f.Percent < 0 || f.Percent > 100 {
+		return fmt.Errorf("flags: %s: percent must be between 0 and 100", f.Name)
+	}
+	return nil
+}
+
+// EnabledFor reports whether the flag is on for userID, zero meaning an
+// anonymous caller
+func (f Flag) EnabledFor(userID int) bool {
+	switch {
+	case !f.Enabled:
+		return false
+	case f.Percent >= 100:
+		return true
+	case userID == 0:
+		return false
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%d", f.Name, userID)))
+	return int(binary.BigEndian.Uint64(sum[:8])%100) < f.Percent
+}
+
+// Provider supplies flags
+type Provider interface {
+	// Flag returns the named flag and whether the provider defines it
+	Flag(ctx context.Context, name string) (Flag, bool, error)
+	// Flags returns every flag the provider defines
+	Flags(ctx context.Context) ([]Flag, error)
+}
+
+// Store is a provider whose flags can be changed at runtime
+type Store interface {
+	Provider
+	// Set creates or replaces the flag of the same name
+	Set(ctx context.Context, f Flag) error
+	// Delete removes the named flag, returning ErrUnknownFlag if the store
+	// does not hold it
+	Delete(ctx context.Context, name string) error
+}
+
+// Static is a fixed set of flags, such as those shipped in a file
+type Static struct {
+	flags map[string]Flag
+}
+
+// NewStatic returns a provider of flags
+func NewStatic(flags ...Flag) *Static {
+	s := &Static{flags: make(map[string]Flag, len(flags))}
+	for _, f := range flags {
+		s.flags[f.Name] = f
+	}
+	return s
+}
+
+// LoadFile reads flags from a YAML or JSON file holding a list of flags.
+// Percent defaults to 100, so "enabled: true" alone turns a flag on for
+// everyone.
+func LoadFile(path string) (*Static, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("flags: %w", err)
+	}
+	var nodes []yaml.Node
+	if err := yaml.Unmarshal(data, &nodes); err != nil {
+		return nil, fmt.Errorf("flags: %s: %w", path, err)
+	}
+	flags := make([]Flag, 0, len(nodes))
+	seen := make(map[string]bool, len(nodes))
+	for _, node := range nodes {
+		f := Flag{Percent: 100}
+		if err := node.Decode(&f); err != nil {
+			return nil, fmt.Errorf("flags: %s: %w", path, err)
+		}
+		if err := f.Validate(); err != nil {
+			return nil, fmt.Errorf("%w in %s", err, path)
+		}
+		if seen[f.Name] {
+			return nil, fmt.Errorf("flags: %s: %s is defined twice", path, f.Name)
+		}
+		seen[f.Name] = true
+		flags = append(flags, f)
+	}
+	return NewStatic(flags...), nil
+}
+
+// Flag implements Provider
+func (s *Static) Flag(_ context.Context, name string) (Flag, bool, error) {
+	f, ok := s.flags[name]
+	return f, ok, nil
+}
+
+// Flags implements Provider
+func (s *Static) Flags(context.Context) ([]Flag, error) {
+	return sortedFlags(s.flags), nil
+}
+
+func sortedFlags(flags map[string]Flag) []Flag {
+	list := make([]Flag, 0, len(flags))
+	for _, f := range flags {
+		list = append(list, f)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Client evaluates flags across providers, later providers overriding
+// earlier ones for flags they both define
+type Client struct {
+	providers []Provider
+	logger    *zap.Logger
+}
+
+// ClientOption configures a Client
+type ClientOption func(*Client)
+
+// WithLogger reports provider errors to logger; they are dropped otherwise
+func WithLogger(logger *zap.Logger) ClientOption {
+	return func(c *Client) {
+		c.logger = logger
+	}
+}
+
+// New creates a client over providers, in increasing precedence
+func New(providers []Provider, opts ...ClientOption) *Client {
+	c := &Client{providers: providers, logger: zap.NewNop()}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Lookup returns the named flag from the last provider defining it
+func (c *Client) Lookup(ctx context.Context, name string) (Flag, bool, error) {
+	for i := len(c.providers) - 1; i >= 0; i-- {
+		f, ok, err := c.providers[i].Flag(ctx, name)
+		if err != nil {
+			return Flag{}, false, err
+		}
+		if ok {
+			return f, true, nil
+		}
+	}
+	return Flag{}, false, nil
+}
+
+// Flags returns every flag defined by any provider, as Lookup resolves it,
+// sorted by name
+func (c *Client) Flags(ctx context.Context) ([]Flag, error) {
+	merged := map[string]Flag{}
+	for _, p := range c.providers {
+		flags, err := p.Flags(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range flags {
+			merged[f.Name] = f
+		}
+	}
+	return sortedFlags(merged), nil
+}
+
+// EnabledFor reports whether the named flag is on for userID. Unknown flags
+// are off, and so is every flag while its provider fails, so an outage
+// falls back to the established behavior.
+func (c *Client) EnabledFor(ctx context.Context, name string, userID int) bool {
+	f, ok, err := c.Lookup(ctx, name)
+	if err != nil {
+		c.logger.Warn("Feature flag lookup failed", zap.String("flag", name), zap.Error(err))
+		return false
+	}
+	return ok && f.EnabledFor(userID)
+}
+
+// contextKey is the context key of the request's client and caller
+type contextKey struct{}
+
+type evaluation struct {
+	client *Client
+	user   func() (int, bool)
+}
+
+// NewContext returns a context in which Enabled asks client, for the
+// caller user returns. user is called on each check, so it may return a
+// caller authenticated after the context was made.
+func NewContext(ctx context.Context, client *Client, user func() (int, bool)) context.Context {
+	return context.WithValue(ctx, contextKey{}, evaluation{client: client, user: user})
+}
+
+// Enabled reports whether the named flag is on for the caller of ctx. It
+// is false when ctx does not come from NewContext.
+func Enabled(ctx context.Context, name string) bool {
+	e, ok := ctx.Value(contextKey{}).(evaluation)
+	if !ok {
+		return false
+	}
+	userID, _ := e.user()
+	return e.client.EnabledFor(ctx, name, userID)
+}
+
+// MemoryStore is a per-replica Store for development and tests; changes
+// are lost on restart and unknown to other replicas
+type MemoryStore struct {
+	mu    sync.RWMutex
+	flags map[string]Flag
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{flags: make(map[string]Flag)}
+}
+
+// Flag implements Provider
+func (m *MemoryStore) Flag(_ context.Context, name string) (Flag, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	f, ok := m.flags[name]
+	return f, ok, nil
+}
+
+// Flags implements Provider
+func (m *MemoryStore) Flags(context.Context) ([]Flag, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return sortedFlags(m.flags), nil
+}
+
+// Set implements Store
+func (m *MemoryStore) Set(_ context.Context, f Flag) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.flags[f.Name] = f
+	return nil
+}
+
+// Delete implements Store
+func (m *MemoryStore) Delete(_ context.Context, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.flags[name]; !ok {
+		return ErrUnknownFlag
+	}
+	delete(m.flags, name)
+	return nil
+}
@@ -0,0 +1,187 @@
+package flags
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/cbwinslow/template2/examples/go/internal/models/postgres"
+)
+
+func TestFlagEnabledFor(t *testing.T) {
+	if (Flag{Name: "off", Percent: 100}).EnabledFor(1) {
+		t.Error("a disabled flag is on")
+	}
+	everyone := Flag{Name: "all", Enabled: true, Percent: 100}
+	if !everyone.EnabledFor(0) || !everyone.EnabledFor(7) {
+		t.Error("a flag at 100% is off for someone")
+	}
+
+	rollout := Flag{Name: "new_export", Enabled: true, Percent: 30}
+	if rollout.EnabledFor(0) {
+		t.Error("a partial rollout is on for an anonymous caller")
+	}
+	on := 0
+	for userID := 1; userID <= 1000; userID++ {
+		if rollout.EnabledFor(userID) {
+			on++
+			wider := rollout
+			wider.Percent = 60
+			if !wider.EnabledFor(userID) {
+				t.Fatalf("user %d lost the flag when the rollout grew", userID)
+			}
+		}
+	}
+	if on < 250 || on > 350 {
+		t.Errorf("30%% rollout is on for %d of 1000 users", on)
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "flags.yaml")
+	data := "- name: new_export\n  enabled: true\n- name: billing.v2\n  enabled: true\n  percent: 10\n  description: New billing\n"
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	static, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	list, _ := static.Flags(context.Background())
+	want := []Flag{
+		{Name: "billing.v2", Description: "New billing", Enabled: true, Percent: 10},
+		{Name: "new_export", Enabled: true, Percent: 100},
+	}
+	if len(list) != 2 || list[0] != want[0] || list[1] != want[1] {
+		t.Errorf("flags = %+v, want %+v", list, want)
+	}
+
+	for _, bad := range []string{"- name: Bad Name\n", "- name: a\n  percent: 101\n", "- name: a\n- name: a\n"} {
+		if err := os.WriteFile(path, []byte(bad), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadFile(path); err == nil {
+			t.Errorf("LoadFile(%q) succeeded", bad)
+		}
+	}
+}
+
+type failingProvider struct{ *Static }
+
+func (failingProvider) Flag(context.Context, string) (Flag, bool, error) {
+	return Flag{}, false, errors.New("unreachable")
+}
+
+func TestClientPrecedenceAndContext(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	client := New([]Provider{NewStatic(Flag{Name: "a", Enabled: true, Percent: 100}, Flag{Name: "b", Enabled: true, Percent: 100}), store})
+	if err := store.Set(ctx, Flag{Name: "a", Percent: 100}); err != nil {
+		t.Fatal(err)
+	}
+
+	if client.EnabledFor(ctx, "a", 1) || !client.EnabledFor(ctx, "b", 1) || client.EnabledFor(ctx, "c", 1) {
+		t.Error("the store does not override the file, or an unknown flag is on")
+	}
+	list, err := client.Flags(ctx)
+	if err != nil || len(list) != 2 || list[0].Enabled {
+		t.Errorf("Flags = %+v, %v; want a overridden", list, err)
+	}
+
+	if Enabled(ctx, "b") {
+		t.Error("Enabled is true without a client in the context")
+	}
+	userID := 0
+	ctx = NewContext(ctx, New([]Provider{NewStatic(Flag{Name: "b", Enabled: true, Percent: 1})}), func() (int, bool) {
+		return userID, userID != 0
+	})
+	if Enabled(ctx, "b") {
+		t.Error("a partial rollout is on for an anonymous caller")
+	}
+	for userID = 1; !Enabled(ctx, "b"); userID++ {
+		if userID > 10000 {
+			t.Fatal("a 1% rollout is off for 10000 users")
+		}
+	}
+
+	failing := New([]Provider{failingProvider{NewStatic()}})
+	if failing.EnabledFor(context.Background(), "a", 1) {
+		t.Error("a flag is on while its provider fails")
+	}
+}
+
+func TestStores(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	stores := map[string]Store{"memory": NewMemoryStore(), "redis": NewRedisStore(client, "flags")}
+	if dsn := os.Getenv("POSTGRES_TEST_DSN"); dsn != "" {
+		stores["postgres"] = newPostgresStore(t, dsn)
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			testStore(t, store)
+		})
+	}
+}
+
+func testStore(t *testing.T, store Store) {
+	ctx := context.Background()
+	flag := Flag{Name: "new_export", Description: "CSV v2", Enabled: true, Percent: 25}
+	if err := store.Set(ctx, flag); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	flag.Percent = 50
+	if err := store.Set(ctx, flag); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if err := store.Set(ctx, Flag{Name: "billing", Percent: 100}); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	if got, ok, err := store.Flag(ctx, "new_export"); err != nil || !ok || got != flag {
+		t.Errorf("Flag = %+v, %t, %v; want %+v", got, ok, err, flag)
+	}
+	if _, ok, err := store.Flag(ctx, "missing"); err != nil || ok {
+		t.Errorf("Flag(missing) = %t, %v", ok, err)
+	}
+	if list, err := store.Flags(ctx); err != nil || len(list) != 2 || list[0].Name != "billing" {
+		t.Errorf("Flags = %+v, %v; want two sorted by name", list, err)
+	}
+
+	if err := store.Delete(ctx, "new_export"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := store.Delete(ctx, "new_export"); !errors.Is(err, ErrUnknownFlag) {
+		t.Errorf("second Delete = %v, want ErrUnknownFlag", err)
+	}
+}
+
+// newPostgresStore migrates the database at dsn, which should be
+// disposable, from scratch
+func newPostgresStore(t *testing.T, dsn string) *PostgresStore {
+	ctx := context.Background()
+	db, err := postgres.Open(ctx, dsn, postgres.PoolConfig{MaxOpenConns: 4})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.ExecContext(ctx, `DROP TABLE IF EXISTS users, audit_log, feature_flags, goose_db_version`); err != nil {
+		t.Fatalf("drop tables: %v", err)
+	}
+	migrator, err := postgres.NewMigrator(db)
+	if err != nil {
+		t.Fatalf("NewMigrator: %v", err)
+	}
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	return NewPostgresStore(db)
+}
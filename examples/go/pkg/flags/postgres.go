@@ -0,0 +1,84 @@
+package flags
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// PostgresStore keeps flags in the feature_flags table, which the
+// migrations in internal/models/postgres create
+type PostgresStore struct {
+	db *sql.DB
+}
+
+// NewPostgresStore creates a store on db
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+// Flag implements Provider
+func (s *PostgresStore) Flag(ctx context.Context, name string) (Flag, bool, error) {
+	var f Flag
+	err := s.db.QueryRowContext(ctx, `SELECT name, description, enabled, percent FROM feature_flags WHERE name = $1`, name).
+		Scan(&f.Name, &f.Description, &f.Enabled, &f.Percent)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Flag{}, false, nil
+	}
+	if err != nil {
+		return Flag{}, false, fmt.Errorf("postgres: %w", err)
+	}
+	return f, true, nil
+}
+
+// Flags implements Provider
+func (s *PostgresStore) Flags(ctx context.Context) ([]Flag, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT name, description, enabled, percent FROM feature_flags ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("postgres: %w", err)
+	}
+	defer rows.Close()
+
+	flags := []Flag{}
+	for rows.Next() {
+		var f Flag
+		if err := rows.Scan(&f.Name, &f.Description, &f.Enabled, &f.Percent); err != nil {
+			return nil, fmt.Errorf("postgres: %w", err)
+		}
+		flags = append(flags, f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("postgres: %w", err)
+	}
+	return flags, nil
+}
+
+// Set implements Store
+func (s *PostgresStore) Set(ctx context.Context, f Flag) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO feature_flags (name, description, enabled, percent, updated_at)
+		VALUES ($1, $2, $3, $4, now())
+		ON CONFLICT (name) DO UPDATE SET description = EXCLUDED.description, enabled = EXCLUDED.enabled,
+			percent = EXCLUDED.percent, updated_at = EXCLUDED.updated_at`,
+		f.Name, f.Description, f.Enabled, f.Percent)
+	if err != nil {
+		return fmt.Errorf("postgres: %w", err)
+	}
+	return nil
+}
+
+// Delete implements Store
+func (s *PostgresStore) Delete(ctx context.Context, name string) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM feature_flags WHERE name = $1`, name)
+	if err != nil {
+		return fmt.Errorf("postgres: %w", err)
+	}
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("postgres: %w", err)
+	}
+	if removed == 0 {
+		return ErrUnknownFlag
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package flags
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStore keeps flags in one Redis hash shared by every replica, so a
+// change takes effect everywhere on the next check
+type RedisStore struct {
+	client redis.Cmdable
+	key    string
+}
+
+// NewRedisStore creates a store keeping flags in client under the hash key
+func NewRedisStore(client redis.Cmdable, key string) *RedisStore {
+	return &RedisStore{client: client, key: key}
+}
+
+// Flag implements Provider
+func (s *RedisStore) Flag(ctx context.Context, name string) (Flag, bool, error) {
+	data, err := s.client.HGet(ctx, s.key, name).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return Flag{}, false, nil
+	}
+	if err != nil {
+		return Flag{}, false, fmt.Errorf("redis: %w", err)
+	}
+	var f Flag
+	if err := json.Unmarshal(data, &f); err != nil {
+		return Flag{}, false, fmt.Errorf("flags: decode %s: %w", name, err)
+	}
+	return f, true, nil
+}
+
+// Flags implements Provider
+func (s *RedisStore) Flags(ctx context.Context) ([]Flag, error) {
+	values, err := s.client.HGetAll(ctx, s.key).Result()
+	if err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	flags := make(map[string]Flag, len(values))
+	for name, data := range values {
+		var f Flag
+		if err := json.Unmarshal([]byte(data), &f); err != nil {
+			return nil, fmt.Errorf("flags: decode %s: %w", name, err)
+		}
+		flags[name] = f
+	}
+	return sortedFlags(flags), nil
+}
+
+// Set implements Store
+func (s *RedisStore) Set(ctx context.Context, f Flag) error {
+	data, err := json.Marshal(f)
+	if err != nil {
+		return fmt.Errorf("flags: encode %s: %w", f.Name, err)
+	}
+	if err := s.client.HSet(ctx, s.key, f.Name, data).Err(); err != nil {
+		return fmt.Errorf("redis: %w", err)
+	}
+	return nil
+}
+
+// Delete implements Store
+func (s *RedisStore) Delete(ctx context.Context, name string) error {
+	removed, err := s.client.HDel(ctx, s.key, name).Result()
+	if err != nil {
+		return fmt.Errorf("redis: %w", err)
+	}
+	if removed == 0 {
+		return ErrUnknownFlag
+	}
+	return nil
+}
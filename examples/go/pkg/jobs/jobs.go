@@ -0,0 +1,356 @@
+// Package jobs runs work outside the request that asked for it on a pool of
+// workers, retrying failed jobs with exponential backoff and setting aside
+// those that keep failing
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrUnknownType is returned when enqueuing or running a job whose type
+	// has no registered handler
+	ErrUnknownType = errors.New("jobs: no handler registered for job type")
+	// ErrClosed is returned when enqueuing on a queue that has been stopped
+	ErrClosed = errors.New("jobs: queue is stopped")
+)
+
+// Job is one unit of queued work
+type Job struct {
+	ID      string          `json:"id"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+	// Attempts counts the runs that have failed so far
+	Attempts    int `json:"attempts"`
+	MaxAttempts int `json:"max_attempts"`
+	// RunAt is when the job is next due
+	RunAt     time.Time `json:"run_at"`
+	CreatedAt time.Time `json:"created_at"`
+	// LastError is the error of the most recent failed run
+	LastError string `json:"last_error,omitempty"`
+}
+
+// jobKey is the context key of the job a handler is running
+type jobKey struct{}
+
+// FromContext returns the job whose handler was given ctx. Handlers can
+// use it to tell whether this is the job's last attempt.
+func FromContext(ctx context.Context) (Job, bool) {
+	job, ok := ctx.Value(jobKey{}).(Job)
+	return job, ok
+}
+
+// Handler runs a job of one type given its payload. Returning an error
+// schedules a retry unless it is wrapped with Permanent. Handlers may run
+// more than once for the same job, so they should be safe to repeat.
+type Handler func(ctx context.Context, payload json.RawMessage) error
+
+// permanentError marks a failure that retrying cannot fix
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps err so the job is moved to the dead letter queue at once
+// instead of being retried
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// Queue hands enqueued jobs to a pool of workers. Jobs live in a Store, so
+// with a shared store any replica may run a job another one enqueued.
+type Queue struct {
+	store       Store
+	logger      *zap.Logger
+	workers     int
+	maxAttempts int
+	backoff     time.Duration
+	maxBackoff  time.Duration
+	timeout     time.Duration
+	poll        time.Duration
+
+	mu       sync.RWMutex
+	handlers map[string]Handler
+	stopped  bool
+
+	// wake nudges an idle worker when a job is enqueued locally
+	wake chan struct{}
+	stop chan struct{}
+	// ctx is the parent of every run; it is cancelled when Stop gives up
+	// waiting for the workers
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// Option configures a Queue
+type Option func(*Queue)
+
+// WithWorkers sets how many jobs run at once. The default is four.
+func WithWorkers(n int) Option {
+	return func(q *Queue) {
+		q.workers = n
+	}
+}
+
+// WithRetry sets how many times a job runs before it is moved to the dead
+// letter queue, and the backoff between runs: base after the first failure,
+// doubling after each further one up to max. The default is five attempts
+// backing off from ten seconds up to ten minutes.
+func WithRetry(maxAttempts int, base, max time.Duration) Option {
+	return func(q *Queue) {
+		q.maxAttempts = maxAttempts
+		q.backoff = base
+		q.maxBackoff = max
+	}
+}
+
+// WithJobTimeout bounds a single run of a job. The default is one minute.
+func WithJobTimeout(timeout time.Duration) Option {
+	return func(q *Queue) {
+		q.timeout = timeout
+	}
+}
+
+// WithPollInterval sets how often idle workers check the store for jobs
+// that became due or were enqueued by other replicas. The default is one
+// second.
+func WithPollInterval(interval time.Duration) Option {
+	return func(q *Queue) {
+		q.poll = interval
+	}
+}
+
+// New creates a queue keeping its jobs in store. Register the handlers,
+// then call Start to run the workers.
+func New(store Store, logger *zap.Logger, opts ...Option) *Queue {
+	q := &Queue{
+		store:       store,
+		logger:      logger,
+		workers:     4,
+		maxAttempts: 5,
+		backoff:     10 * time.Second,
+		maxBackoff:  10 * time.Minute,
+		timeout:     time.Minute,
+		poll:        time.Second,
+		handlers:    make(map[string]Handler),
+		wake:        make(chan struct{}, 1),
+		stop:        make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(q)
+	}
+	q.ctx, q.cancel = context.WithCancel(context.Background())
+	return q
+}
+
+// Register sets the handler for jobs of jobType, replacing any earlier one
+func (q *Queue) Register(jobType string, handler Handler) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.handlers[jobType] = handler
+}
+
+// Enqueue stores a job of jobType with payload marshaled to JSON, due at
+// once. It returns once the job is stored, not when it has run.
+func (q *Queue) Enqueue(ctx context.Context, jobType string, payload interface{}) (Job, error) {
+	q.mu.RLock()
+	_, known := q.handlers[jobType]
+	stopped := q.stopped
+	q.mu.RUnlock()
+	if !known {
+		return Job{}, fmt.Errorf("%w %q", ErrUnknownType, jobType)
+	}
+	if stopped {
+		return Job{}, ErrClosed
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return Job{}, fmt.Errorf("jobs: marshal payload: %w", err)
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return Job{}, fmt.Errorf("jobs: generate id: %w", err)
+	}
+	now := time.Now().UTC()
+	job := Job{
+		ID:          hex.EncodeToString(id),
+		Type:        jobType,
+		Payload:     data,
+		MaxAttempts: q.maxAttempts,
+		RunAt:       now,
+		CreatedAt:   now,
+	}
+	if err := q.store.Push(ctx, job); err != nil {
+		return Job{}, err
+	}
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return job, nil
+}
+
+// Dead returns up to limit jobs from the dead letter queue, most recently
+// buried first
+func (q *Queue) Dead(ctx context.Context, limit int) ([]Job, error) {
+	return q.store.Dead(ctx, limit)
+}
+
+// Start runs the workers. They keep running after ctx is done; Stop ends
+// them.
+func (q *Queue) Start(ctx context.Context) error {
+	for i := 0; i < q.workers; i++ {
+		q.wg.Add(1)
+		go q.work()
+	}
+	return nil
+}
+
+// Stop refuses new jobs and waits for the running ones to finish. If ctx is
+// done first the runs are cancelled; their jobs stay claimed in the store
+// and run again once their lease expires.
+func (q *Queue) Stop(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.stopped {
+		q.stopped = true
+		close(q.stop)
+	}
+	q.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		q.cancel()
+		return nil
+	case <-ctx.Done():
+		q.cancel()
+		return fmt.Errorf("jobs: stop: %w", ctx.Err())
+	}
+}
+
+// lease is how long a claimed job is kept from other workers. It outlasts a
+// run, so only a job whose worker died is claimed again.
+func (q *Queue) lease() time.Duration {
+	return 2 * q.timeout
+}
+
+func (q *Queue) work() {
+	defer q.wg.Done()
+	for {
+		select {
+		case <-q.stop:
+			return
+		default:
+		}
+
+		job, ok, err := q.store.Claim(q.ctx, time.Now(), q.lease())
+		if err != nil {
+			q.logger.Error("Failed to claim a job", zap.Error(err))
+		}
+		if ok {
+			q.run(job)
+			continue
+		}
+
+		timer := time.NewTimer(q.poll)
+		select {
+		case <-q.stop:
+			timer.Stop()
+			return
+		case <-q.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// run runs job and records the outcome: done, due again after a backoff or
+// buried in the dead letter queue
+func (q *Queue) run(job Job) {
+	logger := q.logger.With(zap.String("job_id", job.ID), zap.String("job_type", job.Type), zap.Int("attempt", job.Attempts+1))
+	begin := time.Now()
+	err := q.call(job)
+	if q.ctx.Err() != nil {
+		// Stop gave up on the run; leave the job claimed for a later run
+		logger.Warn("Job interrupted by shutdown", zap.Error(err))
+		return
+	}
+
+	// Record the outcome even if it comes after shutdown began
+	ctx := context.WithoutCancel(q.ctx)
+	if err == nil {
+		if err := q.store.Ack(ctx, job.ID); err != nil {
+			logger.Error("Failed to mark job done", zap.Error(err))
+			return
+		}
+		logger.Debug("Job done", zap.Duration("duration", time.Since(begin)))
+		return
+	}
+
+	job.Attempts++
+	job.LastError = err.Error()
+	var permanent *permanentError
+	if errors.As(err, &permanent) || job.Attempts >= job.MaxAttempts {
+		if err := q.store.Bury(ctx, job); err != nil {
+			logger.Error("Failed to move job to the dead letter queue", zap.Error(err))
+			return
+		}
+		logger.Error("Job failed; moved to the dead letter queue", zap.Error(err))
+		return
+	}
+
+	delay := q.backoffFor(job.Attempts)
+	job.RunAt = time.Now().Add(delay).UTC()
+	if err := q.store.Push(ctx, job); err != nil {
+		logger.Error("Failed to reschedule job", zap.Error(err))
+		return
+	}
+	logger.Warn("Job failed; will retry", zap.Duration("retry_in", delay), zap.Error(err))
+}
+
+// call runs job's handler within the job timeout, turning a panic into an
+// error
+func (q *Queue) call(job Job) (err error) {
+	q.mu.RLock()
+	handler, ok := q.handlers[job.Type]
+	q.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("%w %q", ErrUnknownType, job.Type)
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithValue(q.ctx, jobKey{}, job), q.timeout)
+	defer cancel()
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("jobs: handler panicked: %v", r)
+		}
+	}()
+	return handler(ctx, job.Payload)
+}
+
+// backoffFor returns the delay after the given number of failed attempts
+func (q *Queue) backoffFor(failures int) time.Duration {
+	delay := q.backoff
+	for i := 1; i < failures && delay < q.maxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, q.maxBackoff)
+}
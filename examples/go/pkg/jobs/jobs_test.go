@@ -0,0 +1,137 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func startQueue(t *testing.T, store Store, opts ...Option) *Queue {
+	t.Helper()
+	opts = append([]Option{WithPollInterval(5 * time.Millisecond), WithRetry(3, time.Millisecond, 4*time.Millisecond)}, opts...)
+	q := New(store, zap.NewNop(), opts...)
+	t.Cleanup(func() { _ = q.Stop(context.Background()) })
+	return q
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+}
+
+func TestQueueRunsJobsAndRetriesFailures(t *testing.T) {
+	store := NewMemoryStore()
+	q := startQueue(t, store)
+
+	var runs atomic.Int32
+	var got atomic.Value
+	q.Register("mail", func(ctx context.Context, payload json.RawMessage) error {
+		if runs.Add(1) < 3 {
+			return errors.New("relay unavailable")
+		}
+		var body struct{ To string }
+		if err := json.Unmarshal(payload, &body); err != nil {
+			return err
+		}
+		got.Store(body.To)
+		return nil
+	})
+
+	if _, err := q.Enqueue(context.Background(), "unknown", nil); !errors.Is(err, ErrUnknownType) {
+		t.Errorf("enqueue unknown type: err = %v, want ErrUnknownType", err)
+	}
+	if _, err := q.Enqueue(context.Background(), "mail", map[string]string{"to": "hana@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	_ = q.Start(context.Background())
+
+	waitFor(t, "the third run", func() bool { return got.Load() != nil })
+	if got.Load() != "hana@example.com" || runs.Load() != 3 {
+		t.Errorf("to = %v after %d runs, want hana@example.com after 3", got.Load(), runs.Load())
+	}
+	waitFor(t, "the job to be acknowledged", func() bool {
+		_, ok, _ := store.Claim(context.Background(), time.Now().Add(time.Hour), time.Minute)
+		return !ok
+	})
+}
+
+func TestQueueBuriesJobsThatKeepFailing(t *testing.T) {
+	store := NewMemoryStore()
+	q := startQueue(t, store)
+	var runs atomic.Int32
+	q.Register("flaky", func(ctx context.Context, payload json.RawMessage) error {
+		runs.Add(1)
+		return errors.New("still broken")
+	})
+	q.Register("invalid", func(ctx context.Context, payload json.RawMessage) error {
+		return Permanent(errors.New("no such user"))
+	})
+	_ = q.Start(context.Background())
+
+	flaky, _ := q.Enqueue(context.Background(), "flaky", nil)
+	waitFor(t, "the flaky job to be buried", func() bool {
+		dead, _ := q.Dead(context.Background(), 10)
+		return len(dead) == 1
+	})
+	invalid, _ := q.Enqueue(context.Background(), "invalid", nil)
+	waitFor(t, "the invalid job to be buried", func() bool {
+		dead, _ := q.Dead(context.Background(), 10)
+		return len(dead) == 2
+	})
+
+	dead, _ := q.Dead(context.Background(), 10)
+	if dead[0].ID != invalid.ID || dead[0].Attempts != 1 || dead[0].LastError != "no such user" {
+		t.Errorf("newest dead job = %+v, want the invalid job after one attempt", dead[0])
+	}
+	if dead[1].ID != flaky.ID || dead[1].Attempts != 3 || runs.Load() != 3 {
+		t.Errorf("oldest dead job = %+v after %d runs, want the flaky job after 3", dead[1], runs.Load())
+	}
+}
+
+func TestQueueStopWaitsForRunningJobs(t *testing.T) {
+	q := startQueue(t, NewMemoryStore())
+	started := make(chan struct{})
+	var finished atomic.Bool
+	q.Register("slow", func(ctx context.Context, payload json.RawMessage) error {
+		close(started)
+		time.Sleep(20 * time.Millisecond)
+		finished.Store(true)
+		return nil
+	})
+	_ = q.Start(context.Background())
+	_, _ = q.Enqueue(context.Background(), "slow", nil)
+	<-started
+
+	if err := q.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !finished.Load() {
+		t.Error("Stop returned before the running job finished")
+	}
+	if _, err := q.Enqueue(context.Background(), "slow", nil); !errors.Is(err, ErrClosed) {
+		t.Errorf("enqueue after stop: err = %v, want ErrClosed", err)
+	}
+}
+
+func TestBackoffDoublesUpToMax(t *testing.T) {
+	q := New(NewMemoryStore(), zap.NewNop(), WithRetry(10, time.Second, 5*time.Second))
+	for _, tc := range []struct {
+		failures int
+		want     time.Duration
+	}{{1, time.Second}, {2, 2 * time.Second}, {3, 4 * time.Second}, {4, 5 * time.Second}, {9, 5 * time.Second}} {
+		if got := q.backoffFor(tc.failures); got != tc.want {
+			t.Errorf("backoff after %d failures = %v, want %v", tc.failures, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// The Redis store keeps job bodies in a hash keyed by ID and schedules them
+// in a sorted set scored by the Unix millisecond they are due. A claim moves
+// the score to the end of the lease instead of removing the job, so a job
+// whose worker dies is claimed again once the lease runs out.
+var (
+	pushScript = redis.NewScript(`
+redis.call('HSET', KEYS[2], ARGV[1], ARGV[3])
+redis.call('ZADD', KEYS[1], ARGV[2], ARGV[1])
+return 1
+`)
+
+	claimScript = redis.NewScript(`
+local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, 1)
+if #ids == 0 then
+	return false
+end
+local body = redis.call('HGET', KEYS[2], ids[1])
+if not body then
+	redis.call('ZREM', KEYS[1], ids[1])
+	return false
+end
+redis.call('ZADD', KEYS[1], ARGV[2], ids[1])
+return body
+`)
+
+	ackScript = redis.NewScript(`
+redis.call('ZREM', KEYS[1], ARGV[1])
+redis.call('HDEL', KEYS[2], ARGV[1])
+return 1
+`)
+
+	buryScript = redis.NewScript(`
+redis.call('ZREM', KEYS[1], ARGV[1])
+redis.call('HDEL', KEYS[2], ARGV[1])
+redis.call('LPUSH', KEYS[3], ARGV[2])
+redis.call('LTRIM', KEYS[3], 0, tonumber(ARGV[3]) - 1)
+return 1
+`)
+
+	deadScript = redis.NewScript(`
+return redis.call('LRANGE', KEYS[1], 0, tonumber(ARGV[1]) - 1)
+`)
+)
+
+// RedisStore is a store shared by every replica connected to the same
+// Redis, so jobs survive restarts and any replica may run them
+type RedisStore struct {
+	client redis.Scripter
+	prefix string
+}
+
+// NewRedisStore creates a store keeping its jobs in client under keys
+// starting with prefix
+func NewRedisStore(client redis.Scripter, prefix string) *RedisStore {
+	return &RedisStore{client: client, prefix: prefix}
+}
+
+func (s *RedisStore) keys() []string {
+	return []string{s.prefix + "schedule", s.prefix + "jobs", s.prefix + "dead"}
+}
+
+// Push implements Store
+func (s *RedisStore) Push(ctx context.Context, job Job) error {
+	body, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("jobs: marshal job: %w", err)
+	}
+	if err := pushScript.Run(ctx, s.client, s.keys()[:2], job.ID, job.RunAt.UnixMilli(), body).Err(); err != nil {
+		return fmt.Errorf("jobs: redis: %w", err)
+	}
+	return nil
+}
+
+// Claim implements Store
+func (s *RedisStore) Claim(ctx context.Context, now time.Time, lease time.Duration) (Job, bool, error) {
+	body, err := claimScript.Run(ctx, s.client, s.keys()[:2], now.UnixMilli(), now.Add(lease).UnixMilli()).Text()
+	if errors.Is(err, redis.Nil) {
+		return Job{}, false, nil
+	}
+	if err != nil {
+		return Job{}, false, fmt.Errorf("jobs: redis: %w", err)
+	}
+
+	var job Job
+	if err := json.Unmarshal([]byte(body), &job); err != nil {
+		return Job{}, false, fmt.Errorf("jobs: unmarshal job: %w", err)
+	}
+	return job, true, nil
+}
+
+// Ack implements Store
+func (s *RedisStore) Ack(ctx context.Context, id string) error {
+	if err := ackScript.Run(ctx, s.client, s.keys()[:2], id).Err(); err != nil {
+		return fmt.Errorf("jobs: redis: %w", err)
+	}
+	return nil
+}
+
+// Bury implements Store
+func (s *RedisStore) Bury(ctx context.Context, job Job) error {
+	body, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("jobs: marshal job: %w", err)
+	}
+	if err := buryScript.Run(ctx, s.client, s.keys(), job.ID, body, maxDead).Err(); err != nil {
+		return fmt.Errorf("jobs: redis: %w", err)
+	}
+	return nil
+}
+
+// Dead implements Store
+func (s *RedisStore) Dead(ctx context.Context, limit int) ([]Job, error) {
+	if limit <= 0 {
+		return []Job{}, nil
+	}
+	bodies, err := deadScript.Run(ctx, s.client, s.keys()[2:], limit).StringSlice()
+	if err != nil {
+		return nil, fmt.Errorf("jobs: redis: %w", err)
+	}
+
+	jobs := make([]Job, 0, len(bodies))
+	for _, body := range bodies {
+		var job Job
+		if err := json.Unmarshal([]byte(body), &job); err != nil {
+			return nil, fmt.Errorf("jobs: unmarshal job: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
@@ -0,0 +1,76 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newRedisStore(t *testing.T) *RedisStore {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewRedisStore(client, "jobs:")
+}
+
+func TestRedisStoreClaimsDueJobsUnderALease(t *testing.T) {
+	ctx := context.Background()
+	store := newRedisStore(t)
+	now := time.Now().Truncate(time.Millisecond)
+
+	later := Job{ID: "later", Type: "mail", RunAt: now.Add(2 * time.Minute)}
+	first := Job{ID: "first", Type: "mail", Payload: []byte(`{"user_id":3}`), RunAt: now.Add(-time.Second)}
+	for _, job := range []Job{later, first} {
+		if err := store.Push(ctx, job); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	job, ok, err := store.Claim(ctx, now, time.Minute)
+	if err != nil || !ok || job.ID != "first" || string(job.Payload) != `{"user_id":3}` {
+		t.Fatalf("claim = %+v, %v, %v; want the first job", job, ok, err)
+	}
+	if _, ok, _ := store.Claim(ctx, now, time.Minute); ok {
+		t.Error("claimed a job that is leased or not due yet")
+	}
+
+	// The lease runs out without an ack, as when a worker dies
+	job, ok, _ = store.Claim(ctx, now.Add(61*time.Second), time.Minute)
+	if !ok || job.ID != "first" {
+		t.Fatalf("claim after the lease = %+v, %v; want the first job again", job, ok)
+	}
+	if err := store.Ack(ctx, "first"); err != nil {
+		t.Fatal(err)
+	}
+	job, ok, _ = store.Claim(ctx, now.Add(time.Hour), time.Minute)
+	if !ok || job.ID != "later" {
+		t.Errorf("claim after the ack = %+v, %v; want the later job", job, ok)
+	}
+}
+
+func TestRedisStoreBuriesJobs(t *testing.T) {
+	ctx := context.Background()
+	store := newRedisStore(t)
+
+	for _, id := range []string{"a", "b"} {
+		job := Job{ID: id, Type: "mail", RunAt: time.Now(), Attempts: 5, LastError: "relay unavailable"}
+		if err := store.Push(ctx, job); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Bury(ctx, job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok, _ := store.Claim(ctx, time.Now().Add(time.Hour), time.Minute); ok {
+		t.Error("claimed a buried job")
+	}
+
+	dead, err := store.Dead(ctx, 1)
+	if err != nil || len(dead) != 1 || dead[0].ID != "b" || dead[0].LastError != "relay unavailable" {
+		t.Errorf("dead = %+v, %v; want only the most recent job b", dead, err)
+	}
+}
@@ -0,0 +1,106 @@
+package jobs
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// maxDead caps the jobs a store keeps in its dead letter queue; the oldest
+// are dropped first
+const maxDead = 1000
+
+// Store keeps the jobs of a Queue. Implementations must be safe for
+// concurrent use.
+type Store interface {
+	// Push stores job, replacing any job with the same ID, to be claimed
+	// once its RunAt has passed
+	Push(ctx context.Context, job Job) error
+	// Claim returns the job that has been due longest at now and hides it
+	// from other claims for lease. It reports false when no job is due.
+	Claim(ctx context.Context, now time.Time, lease time.Duration) (Job, bool, error)
+	// Ack removes a claimed job that has run
+	Ack(ctx context.Context, id string) error
+	// Bury moves a claimed job to the dead letter queue
+	Bury(ctx context.Context, job Job) error
+	// Dead returns up to limit buried jobs, most recent first
+	Dead(ctx context.Context, limit int) ([]Job, error)
+}
+
+// MemoryStore keeps jobs in process memory. They are lost on restart and
+// only run by the process that enqueued them.
+type MemoryStore struct {
+	mu   sync.Mutex
+	jobs map[string]memoryJob
+	// dead is ordered oldest first
+	dead []Job
+}
+
+type memoryJob struct {
+	job Job
+	// due is RunAt until the job is claimed, then the end of its lease
+	due time.Time
+}
+
+// NewMemoryStore creates an empty memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{jobs: make(map[string]memoryJob)}
+}
+
+// Push implements Store
+func (s *MemoryStore) Push(ctx context.Context, job Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[job.ID] = memoryJob{job: job, due: job.RunAt}
+	return nil
+}
+
+// Claim implements Store
+func (s *MemoryStore) Claim(ctx context.Context, now time.Time, lease time.Duration) (Job, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var next *memoryJob
+	for id := range s.jobs {
+		entry := s.jobs[id]
+		if !entry.due.After(now) && (next == nil || entry.due.Before(next.due)) {
+			next = &entry
+		}
+	}
+	if next == nil {
+		return Job{}, false, nil
+	}
+	s.jobs[next.job.ID] = memoryJob{job: next.job, due: now.Add(lease)}
+	return next.job, true, nil
+}
+
+// Ack implements Store
+func (s *MemoryStore) Ack(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.jobs, id)
+	return nil
+}
+
+// Bury implements Store
+func (s *MemoryStore) Bury(ctx context.Context, job Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.jobs, job.ID)
+	s.dead = append(s.dead, job)
+	if len(s.dead) > maxDead {
+		s.dead = s.dead[len(s.dead)-maxDead:]
+	}
+	return nil
+}
+
+// Dead implements Store
+func (s *MemoryStore) Dead(ctx context.Context, limit int) ([]Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	jobs := make([]Job, 0, max(0, min(limit, len(s.dead))))
+	for i := len(s.dead) - 1; i >= 0 && len(jobs) < limit; i-- {
+		jobs = append(jobs, s.dead[i])
+	}
+	return jobs, nil
+}
@@ -0,0 +1,145 @@
+// Package lifecycle starts and stops the long-lived components of a process
+// in a fixed order, so shutdown releases everything startup acquired
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ErrTimeout is returned, wrapped, for a hook that did not return within its
+// timeout
+var ErrTimeout = errors.New("hook timed out")
+
+// Hook is one component's part in the lifecycle. Start and Stop may each be
+// nil; a component acquired before the registry starts usually only needs
+// Stop.
+type Hook struct {
+	Name  string
+	Start func(ctx context.Context) error
+	Stop  func(ctx context.Context) error
+	// Timeout bounds Start and Stop separately; zero uses the registry's
+	// default
+	Timeout time.Duration
+}
+
+// Registry runs hooks' Start functions in the order the hooks were appended
+// and their Stop functions in reverse, so a component stops before the ones
+// it was built on
+type Registry struct {
+	logger  *zap.Logger
+	timeout time.Duration
+
+	mu    sync.Mutex
+	hooks []Hook
+	// started counts the leading hooks whose Start has succeeded and whose
+	// Stop is still due
+	started int
+}
+
+// Option configures a Registry
+type Option func(*Registry)
+
+// WithLogger logs each hook as it starts and stops
+func WithLogger(logger *zap.Logger) Option {
+	return func(r *Registry) {
+		r.logger = logger
+	}
+}
+
+// WithTimeout sets the timeout of hooks that do not set their own. The
+// default is five seconds.
+func WithTimeout(timeout time.Duration) Option {
+	return func(r *Registry) {
+		r.timeout = timeout
+	}
+}
+
+// New creates an empty registry
+func New(opts ...Option) *Registry {
+	r := &Registry{logger: zap.NewNop(), timeout: 5 * time.Second}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Append adds hook after every hook appended so far. Hooks must be
+// appended before Start.
+func (r *Registry) Append(hook Hook) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hooks = append(r.hooks, hook)
+}
+
+// Start runs the Start hooks in order. If one fails, the hooks before it are
+// stopped again and the failure is returned.
+func (r *Registry) Start(ctx context.Context) error {
+	r.mu.Lock()
+	hooks := r.hooks
+	r.mu.Unlock()
+
+	for _, hook := range hooks {
+		if hook.Start != nil {
+			if err := r.run(ctx, hook, "start", hook.Start); err != nil {
+				return errors.Join(err, r.Stop(ctx))
+			}
+		}
+		r.mu.Lock()
+		r.started++
+		r.mu.Unlock()
+	}
+	return nil
+}
+
+// Stop runs the Stop hooks of every hook Start reached, hooks without a
+// Start included, in reverse order. Every hook gets its own timeout and a
+// failing hook does not keep the rest from running; the failures are
+// returned together.
+func (r *Registry) Stop(ctx context.Context) error {
+	r.mu.Lock()
+	hooks := r.hooks[:r.started]
+	r.started = 0
+	r.mu.Unlock()
+
+	var errs []error
+	for i := len(hooks) - 1; i >= 0; i-- {
+		if hooks[i].Stop != nil {
+			errs = append(errs, r.run(ctx, hooks[i], "stop", hooks[i].Stop))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// run calls fn for hook within the hook's timeout. A hook that overruns it
+// is abandoned, so one stuck component cannot hold up the others.
+func (r *Registry) run(ctx context.Context, hook Hook, phase string, fn func(context.Context) error) error {
+	timeout := hook.Timeout
+	if timeout <= 0 {
+		timeout = r.timeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	begin := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- fn(ctx) }()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ErrTimeout
+	}
+	if err != nil {
+		r.logger.Error("Lifecycle hook failed", zap.String("hook", hook.Name), zap.String("phase", phase), zap.Error(err))
+		return fmt.Errorf("lifecycle: %s %s: %w", phase, hook.Name, err)
+	}
+	r.logger.Debug("Lifecycle hook finished", zap.String("hook", hook.Name), zap.String("phase", phase), zap.Duration("duration", time.Since(begin)))
+	return nil
+}
@@ -0,0 +1,75 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestStopRunsInReverseAndPastFailures(t *testing.T) {
+	var calls []string
+	hook := func(name string, stopErr error) Hook {
+		return Hook{
+			Name:  name,
+			Start: func(context.Context) error { calls = append(calls, "start "+name); return nil },
+			Stop:  func(context.Context) error { calls = append(calls, "stop "+name); return stopErr },
+		}
+	}
+	r := New()
+	r.Append(hook("db", nil))
+	r.Append(Hook{Name: "redis", Stop: func(context.Context) error { calls = append(calls, "stop redis"); return nil }})
+	r.Append(hook("workers", errors.New("queue stuck")))
+	r.Append(hook("http", nil))
+
+	if err := r.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	err := r.Stop(context.Background())
+	if err == nil || err.Error() != "lifecycle: stop workers: queue stuck" {
+		t.Errorf("Stop err = %v, want the workers failure", err)
+	}
+	want := []string{"start db", "start workers", "start http", "stop http", "stop workers", "stop redis", "stop db"}
+	if !slices.Equal(calls, want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+}
+
+func TestFailedStartStopsWhatStarted(t *testing.T) {
+	var stopped []string
+	r := New()
+	r.Append(Hook{Name: "db", Stop: func(context.Context) error { stopped = append(stopped, "db"); return nil }})
+	r.Append(Hook{Name: "http", Start: func(context.Context) error { return errors.New("address in use") },
+		Stop: func(context.Context) error { stopped = append(stopped, "http"); return nil }})
+	r.Append(Hook{Name: "late", Stop: func(context.Context) error { stopped = append(stopped, "late"); return nil }})
+
+	if err := r.Start(context.Background()); err == nil {
+		t.Fatal("Start succeeded")
+	}
+	if !slices.Equal(stopped, []string{"db"}) {
+		t.Errorf("stopped = %v, want only db", stopped)
+	}
+	if err := r.Stop(context.Background()); err != nil || len(stopped) != 1 {
+		t.Errorf("second Stop = %v, stopped %v; want nothing more stopped", err, stopped)
+	}
+}
+
+func TestHookTimeoutAbandonsStuckHook(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	var stopped bool
+	r := New(WithTimeout(time.Second))
+	r.Append(Hook{Name: "db", Stop: func(context.Context) error { stopped = true; return nil }})
+	r.Append(Hook{Name: "stuck", Timeout: 20 * time.Millisecond, Stop: func(context.Context) error { <-release; return nil }})
+	r.Start(context.Background())
+
+	start := time.Now()
+	err := r.Stop(context.Background())
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("Stop err = %v, want ErrTimeout", err)
+	}
+	if !stopped || time.Since(start) > 500*time.Millisecond {
+		t.Errorf("db stopped = %v after %v; the stuck hook held it up", stopped, time.Since(start))
+	}
+}
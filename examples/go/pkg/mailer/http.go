@@ -0,0 +1,95 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// HTTPMailer delivers messages through a SendGrid-style HTTP API: a JSON
+// POST authenticated with a bearer API key
+type HTTPMailer struct {
+	endpoint string
+	apiKey   string
+	from     string
+	client   *http.Client
+}
+
+// NewHTTPMailer creates a mailer sending from from by posting to endpoint,
+// the API's full send URL such as https://api.sendgrid.com/v3/mail/send
+func NewHTTPMailer(endpoint, apiKey, from string, client *http.Client) (*HTTPMailer, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("mailer: API endpoint must be an absolute http(s) URL")
+	}
+	return &HTTPMailer{endpoint: endpoint, apiKey: apiKey, from: from, client: client}, nil
+}
+
+type httpAddress struct {
+	Email string `json:"email"`
+}
+
+type httpContent struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type httpPersonalization struct {
+	To []httpAddress `json:"to"`
+}
+
+type httpMessage struct {
+	Personalizations []httpPersonalization `json:"personalizations"`
+	From             httpAddress           `json:"from"`
+	Subject          string                `json:"subject"`
+	Content          []httpContent         `json:"content"`
+}
+
+// Send implements Mailer. Responses other than 429 and 5xx mean the API
+// refused the message and are reported as ErrRejected.
+func (m *HTTPMailer) Send(ctx context.Context, msg Message) error {
+	if err := msg.validate(); err != nil {
+		return err
+	}
+
+	body := httpMessage{
+		Personalizations: []httpPersonalization{{To: []httpAddress{{Email: msg.To}}}},
+		From:             httpAddress{Email: m.from},
+		Subject:          msg.Subject,
+		Content:          []httpContent{{Type: "text/plain", Value: msg.Body}},
+	}
+	if msg.HTML != "" {
+		body.Content = append(body.Content, httpContent{Type: "text/html", Value: msg.HTML})
+	}
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("mailer: encode: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("mailer: request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+m.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("mailer: send: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("API answered %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return fmt.Errorf("mailer: send: %w", err)
+	}
+	return fmt.Errorf("mailer: send: %w: %w", ErrRejected, err)
+}
@@ -0,0 +1,53 @@
+package mailer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPMailerPostsMessage(t *testing.T) {
+	var got httpMessage
+	var auth string
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer api.Close()
+
+	m, err := NewHTTPMailer(api.URL+"/v3/mail/send", "key", "noreply@example.com", api.Client())
+	if err != nil {
+		t.Fatalf("NewHTTPMailer: %v", err)
+	}
+	if err := m.Send(context.Background(), Message{To: "eve@example.com", Subject: "hi", Body: "text", HTML: "<p>html</p>"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if auth != "Bearer key" || got.From.Email != "noreply@example.com" || got.Personalizations[0].To[0].Email != "eve@example.com" {
+		t.Errorf("auth %q, message %+v", auth, got)
+	}
+	if len(got.Content) != 2 || got.Content[0].Type != "text/plain" || got.Content[1].Value != "<p>html</p>" {
+		t.Errorf("content = %+v, want text then HTML", got.Content)
+	}
+}
+
+func TestHTTPMailerClassifiesFailures(t *testing.T) {
+	status := http.StatusBadRequest
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"errors":[{"message":"invalid"}]}`, status)
+	}))
+	defer api.Close()
+	m, _ := NewHTTPMailer(api.URL, "key", "noreply@example.com", api.Client())
+	msg := Message{To: "eve@example.com", Subject: "hi", Body: "text"}
+
+	if err := m.Send(context.Background(), msg); !errors.Is(err, ErrRejected) || !Permanent(err) {
+		t.Errorf("400: err = %v, want ErrRejected", err)
+	}
+	status = http.StatusServiceUnavailable
+	if err := m.Send(context.Background(), msg); err == nil || Permanent(err) {
+		t.Errorf("503: err = %v, want a temporary failure", err)
+	}
+}
@@ -0,0 +1,72 @@
+// Package mailer sends the transactional email the API needs, such as
+// verification links
+package mailer
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrInvalidHeader is returned when a recipient or subject contains a
+	// line break, which would let it inject extra headers
+	ErrInvalidHeader = errors.New("mailer: header contains a line break")
+	// ErrRejected is returned, wrapped, when the relay or API refuses the
+	// message itself; sending it again will not succeed
+	ErrRejected = errors.New("mailer: message rejected")
+)
+
+// Message is an email to a single recipient
+type Message struct {
+	To      string
+	Subject string
+	// Body is the plain text content
+	Body string
+	// HTML is an optional HTML rendering of Body, sent as an alternative
+	// for clients that display it
+	HTML string
+}
+
+// validate rejects messages whose header fields could inject headers
+func (m Message) validate() error {
+	if strings.ContainsAny(m.To+m.Subject, "\r\n") {
+		return ErrInvalidHeader
+	}
+	return nil
+}
+
+// Permanent reports whether err means msg can never be delivered as it is,
+// so retrying is pointless
+func Permanent(err error) bool {
+	return errors.Is(err, ErrRejected) || errors.Is(err, ErrInvalidHeader)
+}
+
+// Mailer delivers messages. Implementations must be safe for concurrent use
+// and stop when ctx is done.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// LogMailer writes messages to a logger instead of delivering them, for
+// development setups without a mail relay
+type LogMailer struct {
+	logger *zap.Logger
+}
+
+// NewLogMailer creates a mailer logging every message to logger
+func NewLogMailer(logger *zap.Logger) *LogMailer {
+	return &LogMailer{logger: logger}
+}
+
+// Send implements Mailer
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	if err := msg.validate(); err != nil {
+		return err
+	}
+	m.logger.Info("Email not sent; no mail relay configured",
+		zap.String("to", msg.To), zap.String("subject", msg.Subject), zap.String("body", msg.Body))
+	return nil
+}
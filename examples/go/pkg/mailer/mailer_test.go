@@ -0,0 +1,158 @@
+package mailer
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// fakeRelay accepts one SMTP session and records the commands and message
+// data it receives
+type fakeRelay struct {
+	addr     string
+	commands chan string
+	data     chan string
+}
+
+func startFakeRelay(t *testing.T) *fakeRelay {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	relay := &fakeRelay{addr: ln.Addr().String(), commands: make(chan string, 16), data: make(chan string, 1)}
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		tp := textproto.NewConn(conn)
+		tp.PrintfLine("220 fake ESMTP")
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				return
+			}
+			relay.commands <- line
+			switch verb := strings.ToUpper(strings.Fields(line)[0]); verb {
+			case "EHLO":
+				tp.PrintfLine("250-fake")
+				tp.PrintfLine("250 AUTH PLAIN")
+			case "AUTH":
+				tp.PrintfLine("235 ok")
+			case "DATA":
+				tp.PrintfLine("354 go ahead")
+				body, _ := tp.ReadDotBytes()
+				relay.data <- string(body)
+				tp.PrintfLine("250 queued")
+			case "QUIT":
+				tp.PrintfLine("221 bye")
+				return
+			default:
+				tp.PrintfLine("250 ok")
+			}
+		}
+	}()
+	return relay
+}
+
+func TestSMTPMailerDeliversMessage(t *testing.T) {
+	relay := startFakeRelay(t)
+	m, err := NewSMTPMailer(relay.addr, "noreply@example.com", WithSMTPAuth("api", "secret"))
+	if err != nil {
+		t.Fatalf("NewSMTPMailer: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = m.Send(ctx, Message{To: "eve@example.com", Subject: "Verify your email", Body: "line one\nline two"})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	var commands []string
+	for len(relay.commands) > 0 {
+		commands = append(commands, <-relay.commands)
+	}
+	joined := strings.Join(commands, "\n")
+	for _, want := range []string{"AUTH PLAIN", "MAIL FROM:<noreply@example.com>", "RCPT TO:<eve@example.com>"} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("relay did not receive %q; got:\n%s", want, joined)
+		}
+	}
+
+	msg, err := textproto.NewReader(bufio.NewReader(strings.NewReader(<-relay.data))).ReadMIMEHeader()
+	if err != nil {
+		t.Fatalf("parse headers: %v", err)
+	}
+	if msg.Get("To") != "eve@example.com" || msg.Get("Subject") != "Verify your email" {
+		t.Errorf("headers = %v", msg)
+	}
+}
+
+func TestSMTPMailerSendsHTMLAsAlternative(t *testing.T) {
+	relay := startFakeRelay(t)
+	m, _ := NewSMTPMailer(relay.addr, "noreply@example.com")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := m.Send(ctx, Message{To: "eve@example.com", Subject: "hi", Body: "plain", HTML: "<p>rich</p>"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(<-relay.data))
+	if err != nil {
+		t.Fatalf("parse message: %v", err)
+	}
+	mediaType, params, _ := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q", msg.Header.Get("Content-Type"))
+	}
+	parts := multipart.NewReader(msg.Body, params["boundary"])
+	for _, want := range []struct{ contentType, body string }{{"text/plain", "plain"}, {"text/html", "<p>rich</p>"}} {
+		part, err := parts.NextPart()
+		if err != nil {
+			t.Fatalf("next part: %v", err)
+		}
+		body, _ := io.ReadAll(part)
+		if !strings.HasPrefix(part.Header.Get("Content-Type"), want.contentType) || strings.TrimSpace(string(body)) != want.body {
+			t.Errorf("part %s = %q", part.Header.Get("Content-Type"), body)
+		}
+	}
+}
+
+func TestSendRejectsHeaderInjection(t *testing.T) {
+	m := NewLogMailer(zap.NewNop())
+	err := m.Send(context.Background(), Message{To: "eve@example.com\r\nBcc: mallory@example.com", Subject: "hi"})
+	if !errors.Is(err, ErrInvalidHeader) {
+		t.Errorf("err = %v, want ErrInvalidHeader", err)
+	}
+}
+
+func TestLogMailerLogsMessage(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	m := NewLogMailer(zap.New(core))
+
+	if err := m.Send(context.Background(), Message{To: "eve@example.com", Subject: "hi", Body: "link"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	entries := logs.FilterField(zap.String("to", "eve@example.com")).All()
+	if len(entries) != 1 || entries[0].ContextMap()["body"] != "link" {
+		t.Errorf("logged %v", logs.All())
+	}
+}
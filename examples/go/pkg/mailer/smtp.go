@@ -0,0 +1,167 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// SMTPOption configures an SMTPMailer
+type SMTPOption func(*SMTPMailer)
+
+// WithSMTPAuth authenticates to the relay with PLAIN auth. The credentials
+// are only sent once the connection is encrypted with STARTTLS, or to a
+// relay on localhost.
+func WithSMTPAuth(username, password string) SMTPOption {
+	return func(m *SMTPMailer) {
+		m.username = username
+		m.password = password
+	}
+}
+
+// SMTPMailer delivers messages through an SMTP relay, upgrading the
+// connection with STARTTLS whenever the relay offers it
+type SMTPMailer struct {
+	addr     string
+	host     string
+	from     string
+	username string
+	password string
+}
+
+// NewSMTPMailer creates a mailer sending from from through the relay at
+// addr ("host:port")
+func NewSMTPMailer(addr, from string, opts ...SMTPOption) (*SMTPMailer, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("mailer: relay address: %w", err)
+	}
+	m := &SMTPMailer{addr: addr, host: host, from: from}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m, nil
+}
+
+// Send implements Mailer. The whole exchange is bounded by ctx's deadline.
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	if err := msg.validate(); err != nil {
+		return err
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", m.addr)
+	if err != nil {
+		return fmt.Errorf("mailer: dial: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	client, err := smtp.NewClient(conn, m.host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("mailer: handshake: %w", err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: m.host}); err != nil {
+			return fmt.Errorf("mailer: starttls: %w", err)
+		}
+	}
+	if m.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", m.username, m.password, m.host)); err != nil {
+			return fmt.Errorf("mailer: auth: %w", err)
+		}
+	}
+	if err := client.Mail(m.from); err != nil {
+		return smtpError("sender", err)
+	}
+	if err := client.Rcpt(msg.To); err != nil {
+		return smtpError("recipient", err)
+	}
+	body, err := m.format(msg)
+	if err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return smtpError("data", err)
+	}
+	if _, err := w.Write(body); err != nil {
+		return fmt.Errorf("mailer: write: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return smtpError("data", err)
+	}
+	return client.Quit()
+}
+
+// smtpError wraps err from the given stage of the exchange, marking 5xx
+// replies, which the relay gives for failures that will recur, as rejected
+func smtpError(stage string, err error) error {
+	var reply *textproto.Error
+	if errors.As(err, &reply) && reply.Code >= 500 {
+		return fmt.Errorf("mailer: %s: %w: %w", stage, ErrRejected, err)
+	}
+	return fmt.Errorf("mailer: %s: %w", stage, err)
+}
+
+// format renders msg as an RFC 5322 message with CRLF line endings. A
+// message with HTML becomes a multipart/alternative one with the text part
+// first, so clients prefer the HTML.
+func (m *SMTPMailer) format(msg Message) ([]byte, error) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", m.from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	if msg.HTML == "" {
+		b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+		b.WriteString(crlf(msg.Body))
+		b.WriteString("\r\n")
+		return b.Bytes(), nil
+	}
+
+	parts := multipart.NewWriter(&b)
+	fmt.Fprintf(&b, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", parts.Boundary())
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=UTF-8", msg.Body},
+		{"text/html; charset=UTF-8", msg.HTML},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("mailer: format: %w", err)
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(crlf(part.content))); err != nil {
+			return nil, fmt.Errorf("mailer: format: %w", err)
+		}
+		if err := qp.Close(); err != nil {
+			return nil, fmt.Errorf("mailer: format: %w", err)
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, fmt.Errorf("mailer: format: %w", err)
+	}
+	return b.Bytes(), nil
+}
+
+// crlf normalizes the line endings of s to CRLF
+func crlf(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "\r\n", "\n"), "\n", "\r\n")
+}
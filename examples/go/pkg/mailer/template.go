@@ -0,0 +1,111 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"strings"
+	texttemplate "text/template"
+)
+
+// ErrUnknownTemplate is returned when rendering a template that was not
+// loaded
+var ErrUnknownTemplate = errors.New("mailer: unknown template")
+
+//go:embed templates
+var builtinTemplates embed.FS
+
+// Templates renders messages from named template pairs. A template NAME is
+// read from NAME.txt, a text/template that must also define a "subject"
+// template, and from an optional NAME.html, an html/template for the HTML
+// part. Both are executed with the same data.
+type Templates struct {
+	text map[string]*texttemplate.Template
+	html map[string]*htmltemplate.Template
+}
+
+// DefaultTemplates returns the templates of the mails the API sends:
+// verify_email, reset_password and admin_reset_password
+func DefaultTemplates() *Templates {
+	sub, err := fs.Sub(builtinTemplates, "templates")
+	if err != nil {
+		panic(err)
+	}
+	t, err := ParseTemplates(sub)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// ParseTemplates loads every template pair in the root of fsys
+func ParseTemplates(fsys fs.FS) (*Templates, error) {
+	t := &Templates{text: make(map[string]*texttemplate.Template), html: make(map[string]*htmltemplate.Template)}
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("mailer: templates: %w", err)
+	}
+	for _, entry := range entries {
+		file := entry.Name()
+		name := strings.TrimSuffix(file, path.Ext(file))
+		switch path.Ext(file) {
+		case ".txt":
+			tmpl, err := texttemplate.ParseFS(fsys, file)
+			if err != nil {
+				return nil, fmt.Errorf("mailer: templates: %w", err)
+			}
+			if tmpl.Lookup("subject") == nil {
+				return nil, fmt.Errorf("mailer: templates: %s does not define a subject", file)
+			}
+			t.text[name] = tmpl
+		case ".html":
+			tmpl, err := htmltemplate.ParseFS(fsys, file)
+			if err != nil {
+				return nil, fmt.Errorf("mailer: templates: %w", err)
+			}
+			t.html[name] = tmpl
+		}
+	}
+	for name := range t.html {
+		if _, ok := t.text[name]; !ok {
+			return nil, fmt.Errorf("mailer: templates: %s.html has no %s.txt", name, name)
+		}
+	}
+	return t, nil
+}
+
+// Has reports whether the template pair name was loaded
+func (t *Templates) Has(name string) bool {
+	_, ok := t.text[name]
+	return ok
+}
+
+// Render executes the template pair name with data into a message to to
+func (t *Templates) Render(name, to string, data interface{}) (Message, error) {
+	text, ok := t.text[name]
+	if !ok {
+		return Message{}, fmt.Errorf("%w %q", ErrUnknownTemplate, name)
+	}
+
+	var subject, body bytes.Buffer
+	if err := text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return Message{}, fmt.Errorf("mailer: render %s: %w", name, err)
+	}
+	if err := text.Execute(&body, data); err != nil {
+		return Message{}, fmt.Errorf("mailer: render %s: %w", name, err)
+	}
+	msg := Message{To: to, Subject: strings.TrimSpace(subject.String()), Body: strings.TrimLeft(body.String(), "\n")}
+
+	if html, ok := t.html[name]; ok {
+		var b bytes.Buffer
+		if err := html.Execute(&b, data); err != nil {
+			return Message{}, fmt.Errorf("mailer: render %s: %w", name, err)
+		}
+		msg.HTML = b.String()
+	}
+	return msg, nil
+}
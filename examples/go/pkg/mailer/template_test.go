@@ -0,0 +1,43 @@
+package mailer
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestDefaultTemplatesRenderTextAndHTML(t *testing.T) {
+	data := struct{ Name, Link string }{"Eve", "https://app.example.com/verify?token=a&b"}
+	msg, err := DefaultTemplates().Render("verify_email", "eve@example.com", data)
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if msg.To != "eve@example.com" || msg.Subject != "Verify your email address" || !strings.HasPrefix(msg.Body, "Hi Eve,") {
+		t.Errorf("message = %+v", msg)
+	}
+	if !strings.Contains(msg.Body, data.Link) || !strings.Contains(msg.HTML, `href="https://app.example.com/verify?token=a&amp;b"`) {
+		t.Errorf("link missing from body %q or HTML %q", msg.Body, msg.HTML)
+	}
+
+	if _, err := DefaultTemplates().Render("welcome", "eve@example.com", data); !errors.Is(err, ErrUnknownTemplate) {
+		t.Errorf("unknown template: err = %v", err)
+	}
+}
+
+func TestParseTemplatesRequiresSubject(t *testing.T) {
+	fsys := fstest.MapFS{"welcome.txt": {Data: []byte("Hi {{.Name}}")}}
+	if _, err := ParseTemplates(fsys); err == nil {
+		t.Error("expected an error for a template without a subject")
+	}
+
+	fsys["welcome.txt"] = &fstest.MapFile{Data: []byte(`{{define "subject"}}Welcome{{end}}Hi {{.Name}}`)}
+	templates, err := ParseTemplates(fsys)
+	if err != nil {
+		t.Fatalf("ParseTemplates: %v", err)
+	}
+	msg, err := templates.Render("welcome", "eve@example.com", map[string]string{"Name": "Eve"})
+	if err != nil || msg.Subject != "Welcome" || msg.Body != "Hi Eve" || msg.HTML != "" {
+		t.Errorf("Render = %+v, %v", msg, err)
+	}
+}
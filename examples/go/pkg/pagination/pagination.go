@@ -0,0 +1,125 @@
+// Package pagination parses page/limit query parameters and describes the
+// resulting page to clients
+package pagination
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrInvalidPage is returned when page or limit is not a positive integer
+	ErrInvalidPage = errors.New("invalid page")
+	// ErrLimitTooLarge is returned when limit exceeds the maximum page size
+	ErrLimitTooLarge = errors.New("limit too large")
+)
+
+// Query parameters read by Parse
+const (
+	PageParam  = "page"
+	LimitParam = "limit"
+)
+
+// TotalCountHeader carries the number of items across all pages
+const TotalCountHeader = "X-Total-Count"
+
+// Params selects one page of a listing. Pages are numbered from 1.
+type Params struct {
+	Page  int
+	Limit int
+}
+
+// Parse reads page and limit from query. An absent page is the first page
+// and an absent limit is defaultLimit; a limit above maxLimit is rejected
+// rather than silently reduced, so clients notice their pages are smaller.
+func Parse(query url.Values, defaultLimit, maxLimit int) (Params, error) {
+	params := Params{Page: 1, Limit: defaultLimit}
+	if v := query.Get(PageParam); v != "" {
+		page, err := strconv.Atoi(v)
+		if err != nil || page < 1 {
+			return Params{}, fmt.Errorf("%w: page must be a positive integer", ErrInvalidPage)
+		}
+		params.Page = page
+	}
+	if v := query.Get(LimitParam); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			return Params{}, fmt.Errorf("%w: limit must be a positive integer", ErrInvalidPage)
+		}
+		if limit > maxLimit {
+			return Params{}, fmt.Errorf("%w: at most %d items per page", ErrLimitTooLarge, maxLimit)
+		}
+		params.Limit = limit
+	}
+	return params, nil
+}
+
+// Offset returns the index of the page's first item
+func (p Params) Offset() int {
+	return (p.Page - 1) * p.Limit
+}
+
+// Slice returns the part of items on the page; pages past the end are empty
+func Slice[T any](items []T, p Params) []T {
+	start := min(p.Offset(), len(items))
+	end := min(start+p.Limit, len(items))
+	return items[start:end]
+}
+
+// Meta describes a page of a listing. Next and Prev are empty on the last
+// and first page.
+type Meta struct {
+	Page  int    `json:"page"`
+	Limit int    `json:"limit"`
+	Total int    `json:"total"`
+	Pages int    `json:"pages"`
+	Next  string `json:"next,omitempty"`
+	Prev  string `json:"prev,omitempty"`
+}
+
+// NewMeta describes page p of total items. The links repeat the request URL
+// u, keeping its other parameters such as sort and filter, with only the
+// page changed.
+func NewMeta(u *url.URL, p Params, total int) Meta {
+	meta := Meta{
+		Page:  p.Page,
+		Limit: p.Limit,
+		Total: total,
+		Pages: (total + p.Limit - 1) / p.Limit,
+	}
+	if p.Page < meta.Pages {
+		meta.Next = pageURL(u, p.Page+1)
+	}
+	if p.Page > 1 {
+		meta.Prev = pageURL(u, min(p.Page-1, max(meta.Pages, 1)))
+	}
+	return meta
+}
+
+// SetHeaders writes the total count and an RFC 8288 Link header with the
+// next and prev relations
+func (m Meta) SetHeaders(h http.Header) {
+	h.Set(TotalCountHeader, strconv.Itoa(m.Total))
+
+	var links []string
+	if m.Next != "" {
+		links = append(links, fmt.Sprintf(`<%s>; rel="next"`, m.Next))
+	}
+	if m.Prev != "" {
+		links = append(links, fmt.Sprintf(`<%s>; rel="prev"`, m.Prev))
+	}
+	if len(links) > 0 {
+		h.Set("Link", strings.Join(links, ", "))
+	}
+}
+
+func pageURL(u *url.URL, page int) string {
+	query := u.Query()
+	query.Set(PageParam, strconv.Itoa(page))
+	link := url.URL{Path: u.Path, RawQuery: query.Encode()}
+	return link.String()
+}
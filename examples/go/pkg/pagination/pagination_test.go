@@ -0,0 +1,81 @@
+package pagination
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		query string
+		want  Params
+		err   error
+	}{
+		{"", Params{Page: 1, Limit: 20}, nil},
+		{"page=3&limit=50", Params{Page: 3, Limit: 50}, nil},
+		{"page=0", Params{}, ErrInvalidPage},
+		{"limit=abc", Params{}, ErrInvalidPage},
+		{"limit=101", Params{}, ErrLimitTooLarge},
+	}
+
+	for _, tc := range cases {
+		query, _ := url.ParseQuery(tc.query)
+		got, err := Parse(query, 20, 100)
+		if !errors.Is(err, tc.err) || got != tc.want {
+			t.Errorf("Parse(%q) = %+v, %v; want %+v, %v", tc.query, got, err, tc.want, tc.err)
+		}
+	}
+}
+
+func TestSlice(t *testing.T) {
+	items := []int{1, 2, 3, 4, 5}
+
+	if got := Slice(items, Params{Page: 2, Limit: 2}); len(got) != 2 || got[0] != 3 {
+		t.Errorf("page 2 = %v, want [3 4]", got)
+	}
+	if got := Slice(items, Params{Page: 3, Limit: 2}); len(got) != 1 || got[0] != 5 {
+		t.Errorf("page 3 = %v, want [5]", got)
+	}
+	if got := Slice(items, Params{Page: 9, Limit: 2}); len(got) != 0 {
+		t.Errorf("page 9 = %v, want empty", got)
+	}
+}
+
+func TestMetaLinksKeepOtherParameters(t *testing.T) {
+	u, _ := url.Parse("/api/v1/users?sort=-name&page=2&limit=2")
+	meta := NewMeta(u, Params{Page: 2, Limit: 2}, 5)
+
+	if meta.Pages != 3 {
+		t.Errorf("Pages = %d, want 3", meta.Pages)
+	}
+	if meta.Next != "/api/v1/users?limit=2&page=3&sort=-name" {
+		t.Errorf("Next = %q", meta.Next)
+	}
+	if meta.Prev != "/api/v1/users?limit=2&page=1&sort=-name" {
+		t.Errorf("Prev = %q", meta.Prev)
+	}
+
+	h := http.Header{}
+	meta.SetHeaders(h)
+	if h.Get(TotalCountHeader) != "5" {
+		t.Errorf("%s = %q, want 5", TotalCountHeader, h.Get(TotalCountHeader))
+	}
+	want := `</api/v1/users?limit=2&page=3&sort=-name>; rel="next", </api/v1/users?limit=2&page=1&sort=-name>; rel="prev"`
+	if got := h.Get("Link"); got != want {
+		t.Errorf("Link = %q, want %q", got, want)
+	}
+}
+
+func TestMetaPastTheEndLinksBackToLastPage(t *testing.T) {
+	u, _ := url.Parse("/users?page=9")
+	meta := NewMeta(u, Params{Page: 9, Limit: 2}, 5)
+
+	if meta.Next != "" {
+		t.Errorf("Next = %q, want none", meta.Next)
+	}
+	if meta.Prev != "/users?page=3" {
+		t.Errorf("Prev = %q, want the last page", meta.Prev)
+	}
+}
@@ -0,0 +1,6 @@
+// Package pb holds the Go code buf generates from the protobuf definitions
+// in proto/: the messages and gRPC services of each API version, and their
+// REST gateway. Generating needs buf on the PATH.
+package pb
+
+//go:generate buf generate ../../proto --path ../../proto/template2
@@ -0,0 +1,187 @@
+// Package scheduler runs named maintenance tasks at fixed intervals, such as
+// deleting expired tokens
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Task is a function run every Interval
+type Task struct {
+	Name     string
+	Interval time.Duration
+	// Jitter delays each run by a random duration up to Jitter, so
+	// replicas started together do not all run the task at once
+	Jitter time.Duration
+	// Timeout bounds a single run; zero uses the scheduler's default
+	Timeout time.Duration
+	Run     func(ctx context.Context) error
+}
+
+// Scheduler runs its tasks until stopped. A run that is still going when
+// the task is next due makes the scheduler skip that turn, so runs of one
+// task never overlap.
+type Scheduler struct {
+	logger  *zap.Logger
+	timeout time.Duration
+	tasks   []*task
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	// ctx is the parent of every run; it is cancelled when Stop gives up
+	// waiting for them
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+type task struct {
+	Task
+	running atomic.Bool
+}
+
+// Option configures a Scheduler
+type Option func(*Scheduler)
+
+// WithTimeout sets the timeout of tasks that do not set their own. The
+// default is one minute.
+func WithTimeout(timeout time.Duration) Option {
+	return func(s *Scheduler) {
+		s.timeout = timeout
+	}
+}
+
+// New creates a scheduler without tasks
+func New(logger *zap.Logger, opts ...Option) *Scheduler {
+	s := &Scheduler{logger: logger, timeout: time.Minute, stop: make(chan struct{})}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	return s
+}
+
+// Add schedules t. Tasks must be added before Start.
+func (s *Scheduler) Add(t Task) {
+	s.tasks = append(s.tasks, &task{Task: t})
+}
+
+// Start schedules the first run of every task one interval, plus jitter,
+// from now. The tasks keep running after ctx is done; Stop ends them.
+func (s *Scheduler) Start(ctx context.Context) error {
+	for _, t := range s.tasks {
+		if t.Interval <= 0 {
+			return fmt.Errorf("scheduler: task %s: interval must be positive", t.Name)
+		}
+	}
+	for _, t := range s.tasks {
+		s.wg.Add(1)
+		go s.loop(t)
+	}
+	return nil
+}
+
+// Stop cancels upcoming runs and waits for the ones in progress. If ctx is
+// done first the runs are cancelled.
+func (s *Scheduler) Stop(ctx context.Context) error {
+	s.stopOnce.Do(func() { close(s.stop) })
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		s.cancel()
+		return nil
+	case <-ctx.Done():
+		s.cancel()
+		return fmt.Errorf("scheduler: stop: %w", ctx.Err())
+	}
+}
+
+// loop triggers t every interval until the scheduler stops
+func (s *Scheduler) loop(t *task) {
+	defer s.wg.Done()
+	ticker := time.NewTicker(t.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+
+		if !t.running.CompareAndSwap(false, true) {
+			s.logger.Warn("Scheduled task skipped; its previous run is still going", zap.String("task", t.Name))
+			continue
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer t.running.Store(false)
+			if !s.sleep(jitter(t.Jitter)) {
+				return
+			}
+			s.run(t)
+		}()
+	}
+}
+
+// sleep waits for d, reporting false if the scheduler stopped first
+func (s *Scheduler) sleep(d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-s.stop:
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// run runs t once within its timeout, turning a panic into a logged failure
+func (s *Scheduler) run(t *task) {
+	timeout := t.Timeout
+	if timeout <= 0 {
+		timeout = s.timeout
+	}
+	ctx, cancel := context.WithTimeout(s.ctx, timeout)
+	defer cancel()
+
+	logger := s.logger.With(zap.String("task", t.Name))
+	logger.Info("Scheduled task started")
+	begin := time.Now()
+	err := func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("scheduler: task panicked: %v", r)
+			}
+		}()
+		return t.Run(ctx)
+	}()
+	if err != nil {
+		logger.Error("Scheduled task failed", zap.Duration("duration", time.Since(begin)), zap.Error(err))
+		return
+	}
+	logger.Info("Scheduled task finished", zap.Duration("duration", time.Since(begin)))
+}
+
+// jitter returns a random duration in [0, max)
+func jitter(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(max)))
+}
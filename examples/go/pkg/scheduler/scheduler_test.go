@@ -0,0 +1,85 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestSchedulerRunsTasksWithoutOverlap(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	s := New(zap.New(core))
+
+	var runs, concurrent, overlapped atomic.Int32
+	s.Add(Task{Name: "slow", Interval: 5 * time.Millisecond, Run: func(ctx context.Context) error {
+		if concurrent.Add(1) > 1 {
+			overlapped.Store(1)
+		}
+		defer concurrent.Add(-1)
+		runs.Add(1)
+		time.Sleep(12 * time.Millisecond)
+		return nil
+	}})
+	s.Add(Task{Name: "broken", Interval: 5 * time.Millisecond, Run: func(ctx context.Context) error {
+		return errors.New("store unavailable")
+	}})
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if err := s.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if runs.Load() < 2 || overlapped.Load() != 0 {
+		t.Errorf("%d runs, overlapped = %v; want several runs that never overlap", runs.Load(), overlapped.Load() != 0)
+	}
+	if logs.FilterMessage("Scheduled task skipped; its previous run is still going").Len() == 0 {
+		t.Error("no skipped turns logged for a task slower than its interval")
+	}
+	if failed := logs.FilterMessage("Scheduled task failed").FilterField(zap.String("task", "broken")); failed.Len() == 0 {
+		t.Error("failures of the broken task were not logged")
+	}
+	after := runs.Load()
+	time.Sleep(20 * time.Millisecond)
+	if runs.Load() != after {
+		t.Error("the task ran after Stop")
+	}
+}
+
+func TestSchedulerTimesOutRuns(t *testing.T) {
+	s := New(zap.NewNop(), WithTimeout(5*time.Millisecond))
+	result := make(chan error, 1)
+	s.Add(Task{Name: "stuck", Interval: time.Millisecond, Run: func(ctx context.Context) error {
+		<-ctx.Done()
+		select {
+		case result <- ctx.Err():
+		default:
+		}
+		return ctx.Err()
+	}})
+	_ = s.Start(context.Background())
+	defer s.Stop(context.Background())
+
+	select {
+	case err := <-result:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("run ended with %v, want the deadline", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the run was never cancelled")
+	}
+}
+
+func TestSchedulerRejectsTasksWithoutInterval(t *testing.T) {
+	s := New(zap.NewNop())
+	s.Add(Task{Name: "never", Run: func(context.Context) error { return nil }})
+	if err := s.Start(context.Background()); err == nil {
+		t.Error("expected an error for a task without an interval")
+	}
+}
@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// metaDir holds the content type of every object, mirroring the object
+// layout. Keys cannot have a segment starting with a dot, so it never
+// collides with an object.
+const metaDir = ".meta"
+
+// LocalStore keeps objects as files below a root directory
+type LocalStore struct {
+	root string
+}
+
+// NewLocalStore creates a store under root, creating the directory if
+// needed
+func NewLocalStore(root string) (*LocalStore, error) {
+	if err := os.MkdirAll(filepath.Join(root, metaDir), 0o750); err != nil {
+		return nil, fmt.Errorf("storage: %w", err)
+	}
+	return &LocalStore{root: root}, nil
+}
+
+// Put implements Store. The object is written to a temporary file first and
+// renamed into place, so readers never see a partial object.
+func (s *LocalStore) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	path, meta, err := s.paths(key)
+	if err != nil {
+		return err
+	}
+	for _, dir := range []string{filepath.Dir(path), filepath.Dir(meta)} {
+		if err := os.MkdirAll(dir, 0o750); err != nil {
+			return fmt.Errorf("storage: %w", err)
+		}
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("storage: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	n, err := io.Copy(tmp, io.LimitReader(r, size))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("storage: write %s: %w", key, err)
+	}
+	if n != size {
+		return fmt.Errorf("storage: write %s: got %d of %d bytes", key, n, size)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(meta, []byte(contentType), 0o640); err != nil {
+		return fmt.Errorf("storage: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("storage: %w", err)
+	}
+	return nil
+}
+
+// Open implements Store
+func (s *LocalStore) Open(ctx context.Context, key string) (io.ReadSeekCloser, Object, error) {
+	obj, err := s.Stat(ctx, key)
+	if err != nil {
+		return nil, Object{}, err
+	}
+	path, _, _ := s.paths(key)
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, Object{}, ErrNotFound
+	}
+	if err != nil {
+		return nil, Object{}, fmt.Errorf("storage: %w", err)
+	}
+	return f, obj, nil
+}
+
+// Stat implements Store
+func (s *LocalStore) Stat(ctx context.Context, key string) (Object, error) {
+	path, meta, err := s.paths(key)
+	if err != nil {
+		return Object{}, err
+	}
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return Object{}, ErrNotFound
+	}
+	if err != nil {
+		return Object{}, fmt.Errorf("storage: %w", err)
+	}
+	if !info.Mode().IsRegular() {
+		return Object{}, ErrNotFound
+	}
+	contentType, err := os.ReadFile(meta)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return Object{}, fmt.Errorf("storage: %w", err)
+	}
+	return Object{Key: key, Size: info.Size(), ContentType: string(contentType), ModTime: info.ModTime()}, nil
+}
+
+// Delete implements Store
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	path, meta, err := s.paths(key)
+	if err != nil {
+		return err
+	}
+	for _, p := range []string{path, meta} {
+		if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("storage: %w", err)
+		}
+	}
+	return nil
+}
+
+// paths returns the files holding the content and content type of key
+func (s *LocalStore) paths(key string) (path, meta string, err error) {
+	if !ValidKey(key) {
+		return "", "", ErrInvalidKey
+	}
+	name := filepath.FromSlash(key)
+	return filepath.Join(s.root, name), filepath.Join(s.root, metaDir, name), nil
+}
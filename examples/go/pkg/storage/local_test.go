@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestLocalStoreRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocalStore: %v", err)
+	}
+
+	if err := store.Put(ctx, "7/report.txt", strings.NewReader("hello world"), 11, "text/plain"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	r, obj, err := store.Open(ctx, "7/report.txt")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer r.Close()
+	if obj.Size != 11 || obj.ContentType != "text/plain" {
+		t.Errorf("object = %+v", obj)
+	}
+	r.Seek(6, io.SeekStart)
+	if rest, _ := io.ReadAll(r); string(rest) != "world" {
+		t.Errorf("content after seek = %q, want world", rest)
+	}
+
+	if err := store.Delete(ctx, "7/report.txt"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := store.Stat(ctx, "7/report.txt"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("deleted object: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestLocalStoreRejectsShortWritesAndBadKeys(t *testing.T) {
+	ctx := context.Background()
+	store, _ := NewLocalStore(t.TempDir())
+
+	if err := store.Put(ctx, "short", strings.NewReader("abc"), 10, ""); err == nil {
+		t.Error("expected an error for a body shorter than its size")
+	}
+	if _, err := store.Stat(ctx, "short"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("partial upload is visible: err = %v", err)
+	}
+	for _, key := range []string{"../escape", "a//b", ".meta/x", "/abs", "sp ace"} {
+		if err := store.Put(ctx, key, strings.NewReader("x"), 1, ""); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Put(%q): err = %v, want ErrInvalidKey", key, err)
+		}
+	}
+}
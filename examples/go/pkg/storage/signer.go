@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+var (
+	// ErrInvalidSignature is returned for URLs that were not signed by the
+	// signer or were altered since
+	ErrInvalidSignature = errors.New("storage: invalid URL signature")
+	// ErrURLExpired is returned for signed URLs past their expiry
+	ErrURLExpired = errors.New("storage: signed URL expired")
+)
+
+// URLSigner issues download URLs that work without other credentials until
+// they expire. The path and expiry are signed with HMAC-SHA256.
+type URLSigner struct {
+	secret []byte
+	now    func() time.Time
+}
+
+// NewURLSigner creates a signer using secret as the HMAC key
+func NewURLSigner(secret []byte) *URLSigner {
+	return &URLSigner{secret: secret, now: time.Now}
+}
+
+// Sign returns path with expires and signature query parameters that make
+// it valid for ttl, and the time it expires
+func (s *URLSigner) Sign(path string, ttl time.Duration) (string, time.Time) {
+	expires := s.now().Add(ttl).Truncate(time.Second)
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	query.Set("signature", s.signature(path, expires.Unix()))
+	return path + "?" + query.Encode(), expires
+}
+
+// Verify checks the expires and signature parameters query carries for
+// path
+func (s *URLSigner) Verify(path string, query url.Values) error {
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	got, err := base64.RawURLEncoding.DecodeString(query.Get("signature"))
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	want, _ := base64.RawURLEncoding.DecodeString(s.signature(path, expires))
+	if !hmac.Equal(got, want) {
+		return ErrInvalidSignature
+	}
+	if !s.now().Before(time.Unix(expires, 0)) {
+		return ErrURLExpired
+	}
+	return nil
+}
+
+func (s *URLSigner) signature(path string, expires int64) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(path + "\n" + strconv.FormatInt(expires, 10)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestURLSigner(t *testing.T) {
+	signer := NewURLSigner([]byte("secret"))
+	signed, expires := signer.Sign("/files/7/abc", time.Minute)
+	if time.Until(expires) <= 0 {
+		t.Fatalf("expires = %v, want in the future", expires)
+	}
+
+	path, rawQuery, _ := strings.Cut(signed, "?")
+	query, _ := url.ParseQuery(rawQuery)
+	if err := signer.Verify(path, query); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+	if err := signer.Verify("/files/7/abd", query); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("other path: err = %v, want ErrInvalidSignature", err)
+	}
+	if err := NewURLSigner([]byte("other")).Verify(path, query); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("other secret: err = %v, want ErrInvalidSignature", err)
+	}
+
+	query.Set("expires", "4102444800")
+	if err := signer.Verify(path, query); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("extended expiry: err = %v, want ErrInvalidSignature", err)
+	}
+
+	signer.now = func() time.Time { return expires }
+	query, _ = url.ParseQuery(rawQuery)
+	if err := signer.Verify(path, query); !errors.Is(err, ErrURLExpired) {
+		t.Errorf("at expiry: err = %v, want ErrURLExpired", err)
+	}
+}
@@ -0,0 +1,67 @@
+// Package storage keeps uploaded files in an object store, such as a local
+// directory or an S3-compatible bucket, and signs the URLs they are
+// downloaded from
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when no object is stored under a key
+	ErrNotFound = errors.New("storage: object not found")
+	// ErrInvalidKey is returned for keys ValidKey rejects
+	ErrInvalidKey = errors.New("storage: invalid object key")
+)
+
+// Object describes a stored object
+type Object struct {
+	Key         string
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+}
+
+// Store keeps objects by key. Implementations must be safe for concurrent
+// use.
+type Store interface {
+	// Put stores size bytes read from r under key, replacing any object
+	// already there
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Open returns the object stored under key and a reader over its
+	// content, which the caller must close. The reader seeks, so downloads
+	// can be served in ranges.
+	Open(ctx context.Context, key string) (io.ReadSeekCloser, Object, error)
+	// Stat returns the object stored under key
+	Stat(ctx context.Context, key string) (Object, error)
+	// Delete removes the object stored under key; a missing object is not
+	// an error
+	Delete(ctx context.Context, key string) error
+}
+
+// ValidKey reports whether key can name an object: slash-separated
+// segments of letters, digits, '-', '_' and '.', none of them empty or
+// starting with a dot. Keys therefore never escape a local store's root.
+func ValidKey(key string) bool {
+	if key == "" || len(key) > 1024 {
+		return false
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment[0] == '.' {
+			return false
+		}
+		for _, r := range segment {
+			switch {
+			case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			case r == '-', r == '_', r == '.':
+			default:
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,104 @@
+// Package validation holds the declarative rules request payloads are checked
+// against, on top of those built into go-playground/validator
+package validation
+
+import (
+	"reflect"
+	"strings"
+	"unicode"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// Tags of the custom rules
+const (
+	// TagPassword requires a password bcrypt can hash in full that mixes
+	// letters with digits or symbols
+	TagPassword = "password"
+	// TagUsername requires a name of letters, digits, spaces and . ' - _
+	// that starts and ends with a letter or digit
+	TagUsername = "username"
+)
+
+// Password length bounds. bcrypt ignores everything past 72 bytes, so a
+// longer password would be accepted with any suffix.
+const (
+	MinPasswordLength = 8
+	MaxPasswordLength = 72
+)
+
+// Register adds the custom rules to v and makes it name fields by their JSON
+// name, the way clients send them
+func Register(v *validator.Validate) error {
+	v.RegisterTagNameFunc(jsonFieldName)
+	if err := v.RegisterValidation(TagPassword, password); err != nil {
+		return err
+	}
+	return v.RegisterValidation(TagUsername, username)
+}
+
+// New returns a validator with the custom rules registered
+func New() *validator.Validate {
+	v := validator.New()
+	if err := Register(v); err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// jsonFieldName returns the name a struct field has in JSON. Fields without
+// one keep their Go name; "-" would make the validator skip the field.
+func jsonFieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return field.Name
+	}
+	return name
+}
+
+func password(fl validator.FieldLevel) bool {
+	return ValidPassword(fl.Field().String())
+}
+
+func username(fl validator.FieldLevel) bool {
+	return ValidUsername(fl.Field().String())
+}
+
+// ValidPassword reports whether s satisfies the password rule
+func ValidPassword(s string) bool {
+	if len(s) < MinPasswordLength || len(s) > MaxPasswordLength {
+		return false
+	}
+	var letter, other bool
+	for _, r := range s {
+		switch {
+		case unicode.IsLetter(r):
+			letter = true
+		case unicode.IsSpace(r) || unicode.IsControl(r):
+		default:
+			other = true
+		}
+	}
+	return letter && other
+}
+
+// ValidUsername reports whether s satisfies the username rule
+func ValidUsername(s string) bool {
+	if s == "" {
+		return false
+	}
+	runes := []rune(s)
+	if !alphanumeric(runes[0]) || !alphanumeric(runes[len(runes)-1]) {
+		return false
+	}
+	for _, r := range runes {
+		if !alphanumeric(r) && !unicode.IsMark(r) && !strings.ContainsRune(" .'-_", r) {
+			return false
+		}
+	}
+	return true
+}
+
+func alphanumeric(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
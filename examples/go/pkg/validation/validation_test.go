@@ -0,0 +1,67 @@
+package validation
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidPassword(t *testing.T) {
+	cases := []struct {
+		password string
+		want     bool
+	}{
+		{"s3cret-pass", true},
+		{"brand-new-pass", true},
+		{"correct horse 9", true},
+		{"short1", false},
+		{"lettersonly", false},
+		{"12345678", false},
+		{"letters  and  spaces", false},
+		{strings.Repeat("a1", 36), true},
+		{strings.Repeat("a1", 36) + "x", false},
+	}
+
+	for _, tc := range cases {
+		if got := ValidPassword(tc.password); got != tc.want {
+			t.Errorf("ValidPassword(%q) = %v, want %v", tc.password, got, tc.want)
+		}
+	}
+}
+
+func TestValidUsername(t *testing.T) {
+	cases := []struct {
+		name string
+		want bool
+	}{
+		{"Ivy", true},
+		{"Alice Admin", true},
+		{"Zoë O'Neil-Smith", true},
+		{"j.doe_2", true},
+		{"", false},
+		{" Ivy", false},
+		{"Ivy.", false},
+		{"<script>", false},
+		{"tab\there", false},
+	}
+
+	for _, tc := range cases {
+		if got := ValidUsername(tc.name); got != tc.want {
+			t.Errorf("ValidUsername(%q) = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestNewRegistersRules(t *testing.T) {
+	type request struct {
+		Name     string `json:"name" validate:"required,username"`
+		Password string `json:"password" validate:"required,password"`
+	}
+
+	if err := New().Struct(request{Name: "Ivy", Password: "s3cret-pass"}); err != nil {
+		t.Fatalf("valid request: %v", err)
+	}
+	err := New().Struct(request{Name: "-Ivy", Password: "password"})
+	if err == nil || !strings.Contains(err.Error(), "'name'") || !strings.Contains(err.Error(), "'password'") {
+		t.Errorf("err = %v, want failures for name and password", err)
+	}
+}
@@ -0,0 +1,141 @@
+package webhooks
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"sync"
+)
+
+// maxDeliveries caps the deliveries a MemoryStore keeps; the oldest are
+// dropped first
+const maxDeliveries = 1000
+
+// Store persists subscriptions and deliveries
+type Store interface {
+	// SaveSubscription creates a subscription
+	SaveSubscription(ctx context.Context, sub Subscription) error
+	// Subscription returns the subscription with the given ID
+	Subscription(ctx context.Context, id string) (Subscription, bool, error)
+	// Subscriptions returns the user's subscriptions, oldest first
+	Subscriptions(ctx context.Context, userID int) ([]Subscription, error)
+	// SubscriptionsFor returns every subscription asking for event
+	SubscriptionsFor(ctx context.Context, event string) ([]Subscription, error)
+	// DeleteSubscription removes the user's subscription with the given
+	// ID, reporting whether it existed
+	DeleteSubscription(ctx context.Context, userID int, id string) (bool, error)
+	// SaveDelivery creates or replaces a delivery
+	SaveDelivery(ctx context.Context, delivery Delivery) error
+	// Delivery returns the delivery with the given ID
+	Delivery(ctx context.Context, id string) (Delivery, bool, error)
+	// Deliveries returns up to limit deliveries to the user's
+	// subscriptions, newest first
+	Deliveries(ctx context.Context, userID, limit int) ([]Delivery, error)
+}
+
+// MemoryStore is the default in-process Store. It keeps the most recent
+// deliveries only.
+type MemoryStore struct {
+	mu            sync.RWMutex
+	subscriptions map[string]Subscription
+	deliveries    map[string]Delivery
+	// order holds delivery IDs, oldest first
+	order []string
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{subscriptions: make(map[string]Subscription), deliveries: make(map[string]Delivery)}
+}
+
+// SaveSubscription implements Store
+func (m *MemoryStore) SaveSubscription(_ context.Context, sub Subscription) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.subscriptions[sub.ID] = sub
+	return nil
+}
+
+// Subscription implements Store
+func (m *MemoryStore) Subscription(_ context.Context, id string) (Subscription, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	sub, ok := m.subscriptions[id]
+	return sub, ok, nil
+}
+
+// Subscriptions implements Store
+func (m *MemoryStore) Subscriptions(_ context.Context, userID int) ([]Subscription, error) {
+	return m.filter(func(sub Subscription) bool { return sub.UserID == userID }), nil
+}
+
+// SubscriptionsFor implements Store
+func (m *MemoryStore) SubscriptionsFor(_ context.Context, event string) ([]Subscription, error) {
+	return m.filter(func(sub Subscription) bool { return slices.Contains(sub.Events, event) }), nil
+}
+
+func (m *MemoryStore) filter(match func(Subscription) bool) []Subscription {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	subs := []Subscription{}
+	for _, sub := range m.subscriptions {
+		if match(sub) {
+			subs = append(subs, sub)
+		}
+	}
+	sort.Slice(subs, func(i, j int) bool {
+		if !subs[i].CreatedAt.Equal(subs[j].CreatedAt) {
+			return subs[i].CreatedAt.Before(subs[j].CreatedAt)
+		}
+		return subs[i].ID < subs[j].ID
+	})
+	return subs
+}
+
+// DeleteSubscription implements Store
+func (m *MemoryStore) DeleteSubscription(_ context.Context, userID int, id string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sub, ok := m.subscriptions[id]
+	if !ok || sub.UserID != userID {
+		return false, nil
+	}
+	delete(m.subscriptions, id)
+	return true, nil
+}
+
+// SaveDelivery implements Store
+func (m *MemoryStore) SaveDelivery(_ context.Context, delivery Delivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.deliveries[delivery.ID]; !ok {
+		m.order = append(m.order, delivery.ID)
+		if len(m.order) > maxDeliveries {
+			delete(m.deliveries, m.order[0])
+			m.order = m.order[1:]
+		}
+	}
+	m.deliveries[delivery.ID] = delivery
+	return nil
+}
+
+// Delivery implements Store
+func (m *MemoryStore) Delivery(_ context.Context, id string) (Delivery, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	delivery, ok := m.deliveries[id]
+	return delivery, ok, nil
+}
+
+// Deliveries implements Store
+func (m *MemoryStore) Deliveries(_ context.Context, userID, limit int) ([]Delivery, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	deliveries := []Delivery{}
+	for i := len(m.order) - 1; i >= 0 && len(deliveries) < limit; i-- {
+		if delivery := m.deliveries[m.order[i]]; delivery.UserID == userID {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	return deliveries, nil
+}
@@ -0,0 +1,346 @@
+// Package webhooks notifies subscribed URLs of events. Every delivery is
+// signed with its subscription's secret and retried through the job queue
+// until the receiver accepts it.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/cbwinslow/template2/examples/go/internal/outbound"
+	"github.com/cbwinslow/template2/examples/go/pkg/events"
+	"github.com/cbwinslow/template2/examples/go/pkg/jobs"
+)
+
+// Events subscriptions may ask for, named as the domain events they
+// forward
+const (
+	EventUserCreated = events.NameUserCreated
+	EventUserDeleted = events.NameUserDeleted
+)
+
+// Events lists every event a subscription may ask for
+var Events = []string{EventUserCreated, EventUserDeleted}
+
+// JobDeliver is the job type that sends one delivery
+const JobDeliver = "webhook.deliver"
+
+// Delivery statuses
+const (
+	StatusPending   = "pending"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// Headers set on every delivery request
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+var (
+	// ErrSubscriptionNotFound is returned when the user owns no
+	// subscription with the given ID
+	ErrSubscriptionNotFound = errors.New("webhook subscription not found")
+	// ErrInvalidURL is returned for subscription URLs that are not
+	// absolute http(s) URLs
+	ErrInvalidURL = errors.New("webhook URL must be an absolute http(s) URL")
+	// ErrUnknownEvent is returned when subscribing to an event not in
+	// Events
+	ErrUnknownEvent = errors.New("unknown webhook event")
+)
+
+// Subscription asks for the listed events to be posted to URL
+type Subscription struct {
+	ID     string   `json:"id"`
+	UserID int      `json:"user_id"`
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	// Secret signs the deliveries; it is only shown when the subscription
+	// is created
+	Secret    string    `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Delivery is one event sent, or being sent, to one subscription
+type Delivery struct {
+	ID             string `json:"id"`
+	SubscriptionID string `json:"subscription_id"`
+	UserID         int    `json:"-"`
+	Event          string `json:"event"`
+	// Status is pending until the receiver accepts the delivery or the
+	// retries run out
+	Status   string `json:"status"`
+	Attempts int    `json:"attempts"`
+	// StatusCode and LastError describe the most recent attempt
+	StatusCode  int             `json:"status_code,omitempty"`
+	LastError   string          `json:"last_error,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	CompletedAt *time.Time      `json:"completed_at,omitempty"`
+	Body        json.RawMessage `json:"-"`
+}
+
+// Payload is the JSON body of a delivery
+type Payload struct {
+	ID        string      `json:"id"`
+	Event     string      `json:"event"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// deliverJob is the payload of a JobDeliver job
+type deliverJob struct {
+	DeliveryID string `json:"delivery_id"`
+}
+
+// Service manages subscriptions and sends their deliveries
+type Service struct {
+	store  Store
+	queue  *jobs.Queue
+	client *outbound.Client
+	now    func() time.Time
+}
+
+// NewService creates a service keeping subscriptions and deliveries in
+// store and sending deliveries through queue with client, which logs every
+// attempt. The queue retries failed deliveries, so client should make one
+// attempt per call; it logs them numbered by the job's attempts, and only
+// the last as giving up. It registers JobDeliver on queue.
+func NewService(store Store, queue *jobs.Queue, client *outbound.Client) *Service {
+	s := &Service{store: store, queue: queue, client: client, now: time.Now}
+	queue.Register(JobDeliver, s.deliver)
+	return s
+}
+
+// Subscribe creates a subscription of the user's and returns it with its
+// signing secret, which cannot be recovered later
+func (s *Service) Subscribe(ctx context.Context, userID int, rawURL string, events []string) (Subscription, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return Subscription{}, ErrInvalidURL
+	}
+	if len(events) == 0 {
+		return Subscription{}, fmt.Errorf("%w: none given", ErrUnknownEvent)
+	}
+	for _, event := range events {
+		if !slices.Contains(Events, event) {
+			return Subscription{}, fmt.Errorf("%w %q", ErrUnknownEvent, event)
+		}
+	}
+	id, err := randomHex(8)
+	if err != nil {
+		return Subscription{}, err
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return Subscription{}, fmt.Errorf("webhooks: generate secret: %w", err)
+	}
+
+	events = slices.Clone(events)
+	slices.Sort(events)
+	sub := Subscription{
+		ID:        id,
+		UserID:    userID,
+		URL:       u.String(),
+		Events:    slices.Compact(events),
+		Secret:    "whsec_" + base64.RawURLEncoding.EncodeToString(secret),
+		CreatedAt: s.now().UTC(),
+	}
+	if err := s.store.SaveSubscription(ctx, sub); err != nil {
+		return Subscription{}, err
+	}
+	return sub, nil
+}
+
+// Subscriptions returns the user's subscriptions, oldest first
+func (s *Service) Subscriptions(ctx context.Context, userID int) ([]Subscription, error) {
+	return s.store.Subscriptions(ctx, userID)
+}
+
+// Unsubscribe deletes the user's subscription. Deliveries already queued
+// for it fail.
+func (s *Service) Unsubscribe(ctx context.Context, userID int, id string) error {
+	found, err := s.store.DeleteSubscription(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrSubscriptionNotFound
+	}
+	return nil
+}
+
+// Deliveries returns up to limit of the deliveries to the user's
+// subscriptions, newest first
+func (s *Service) Deliveries(ctx context.Context, userID, limit int) ([]Delivery, error) {
+	return s.store.Deliveries(ctx, userID, limit)
+}
+
+// Publish queues a delivery of event with data to every subscription asking
+// for it
+func (s *Service) Publish(ctx context.Context, event string, data interface{}) error {
+	subs, err := s.store.SubscriptionsFor(ctx, event)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, sub := range subs {
+		errs = append(errs, s.queueDelivery(ctx, sub, event, data))
+	}
+	return errors.Join(errs...)
+}
+
+// Forward is an events.Handler publishing domain events to the
+// subscriptions asking for them, with the event as the payload data.
+// Subscribe it to each of Events.
+func (s *Service) Forward(ctx context.Context, e events.Event) error {
+	return s.Publish(ctx, e.EventName(), e)
+}
+
+func (s *Service) queueDelivery(ctx context.Context, sub Subscription, event string, data interface{}) error {
+	id, err := randomHex(16)
+	if err != nil {
+		return err
+	}
+	now := s.now().UTC()
+	body, err := json.Marshal(Payload{ID: id, Event: event, CreatedAt: now, Data: data})
+	if err != nil {
+		return fmt.Errorf("webhooks: marshal payload: %w", err)
+	}
+
+	delivery := Delivery{
+		ID:             id,
+		SubscriptionID: sub.ID,
+		UserID:         sub.UserID,
+		Event:          event,
+		Status:         StatusPending,
+		CreatedAt:      now,
+		Body:           body,
+	}
+	if err := s.store.SaveDelivery(ctx, delivery); err != nil {
+		return err
+	}
+	if _, err := s.queue.Enqueue(ctx, JobDeliver, deliverJob{DeliveryID: id}); err != nil {
+		return err
+	}
+	return nil
+}
+
+// deliver runs a JobDeliver job: it posts the delivery and records the
+// outcome. Failures are returned so the queue retries them; the last
+// attempt's failure marks the delivery failed.
+func (s *Service) deliver(ctx context.Context, payload json.RawMessage) error {
+	var job deliverJob
+	if err := json.Unmarshal(payload, &job); err != nil {
+		return jobs.Permanent(err)
+	}
+	delivery, ok, err := s.store.Delivery(ctx, job.DeliveryID)
+	if err != nil {
+		return err
+	}
+	if !ok || delivery.Status != StatusPending {
+		return nil
+	}
+	sub, ok, err := s.store.Subscription(ctx, delivery.SubscriptionID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return s.finish(ctx, delivery, StatusFailed, 0, ErrSubscriptionNotFound)
+	}
+
+	delivery.Attempts++
+	current, ok := jobs.FromContext(ctx)
+	sendCtx := ctx
+	if ok {
+		sendCtx = outbound.WithAttempt(ctx, current.Attempts+1, current.MaxAttempts)
+	}
+	status, sendErr := s.send(sendCtx, sub, delivery)
+	if sendErr == nil {
+		return s.finish(ctx, delivery, StatusSucceeded, status, nil)
+	}
+	// A receiver answering 410 Gone asks not to be sent this again
+	if status == http.StatusGone || current.Attempts+1 >= current.MaxAttempts {
+		if err := s.finish(ctx, delivery, StatusFailed, status, sendErr); err != nil {
+			return err
+		}
+		return jobs.Permanent(sendErr)
+	}
+
+	delivery.StatusCode, delivery.LastError = status, sendErr.Error()
+	if err := s.store.SaveDelivery(ctx, delivery); err != nil {
+		return errors.Join(sendErr, err)
+	}
+	return sendErr
+}
+
+// send posts delivery to sub, returning the status code if there was a
+// response and an error unless it was 2xx
+func (s *Service) send(ctx context.Context, sub Subscription, delivery Delivery) (int, error) {
+	resp, err := s.client.Do(ctx, target(sub.URL), func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(delivery.Body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", "template2-webhooks")
+		req.Header.Set(HeaderEvent, delivery.Event)
+		req.Header.Set(HeaderDelivery, delivery.ID)
+		req.Header.Set(HeaderSignature, Sign(sub.Secret, s.now(), delivery.Body))
+		return req, nil
+	})
+	var statusErr *outbound.StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode, fmt.Errorf("webhooks: receiver answered %d %s", statusErr.StatusCode, http.StatusText(statusErr.StatusCode))
+	}
+	if err != nil {
+		return 0, fmt.Errorf("webhooks: send: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhooks: receiver answered %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// target names a subscription URL in logs, leaving out credentials and the
+// query, which may carry them
+func target(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "webhook"
+	}
+	return "webhook " + (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: u.Path}).String()
+}
+
+// finish records the final outcome of delivery
+func (s *Service) finish(ctx context.Context, delivery Delivery, status string, code int, err error) error {
+	now := s.now().UTC()
+	delivery.Status, delivery.StatusCode, delivery.CompletedAt = status, code, &now
+	if err != nil {
+		delivery.LastError = err.Error()
+	}
+	return s.store.SaveDelivery(ctx, delivery)
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("webhooks: generate id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
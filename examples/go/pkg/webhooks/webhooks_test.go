@@ -0,0 +1,241 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/cbwinslow/template2/examples/go/internal/outbound"
+	"github.com/cbwinslow/template2/examples/go/pkg/jobs"
+)
+
+func newTestService(t *testing.T) *Service {
+	t.Helper()
+	return newLoggingTestService(t, zap.NewNop())
+}
+
+func newLoggingTestService(t *testing.T, logger *zap.Logger) *Service {
+	t.Helper()
+	queue := jobs.New(jobs.NewMemoryStore(), zap.NewNop(),
+		jobs.WithPollInterval(5*time.Millisecond), jobs.WithRetry(3, time.Millisecond, time.Millisecond))
+	s := NewService(NewMemoryStore(), queue, outbound.NewClient(logger, 1, 0))
+	_ = queue.Start(context.Background())
+	t.Cleanup(func() { _ = queue.Stop(context.Background()) })
+	return s
+}
+
+func waitForStatus(t *testing.T, s *Service, userID int, status string) Delivery {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		deliveries, err := s.Deliveries(context.Background(), userID, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(deliveries) == 1 && deliveries[0].Status == status {
+			return deliveries[0]
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for a %s delivery; have %+v", status, deliveries)
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+}
+
+func TestSignAndVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"event":"user.created"}`)
+	header := Sign("whsec_test", now, body)
+
+	if err := Verify("whsec_test", header, body, now.Add(time.Minute), 5*time.Minute); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+	for name, err := range map[string]error{
+		"wrong secret": Verify("whsec_other", header, body, now, 5*time.Minute),
+		"altered body": Verify("whsec_test", header, []byte(`{"event":"user.deleted"}`), now, 5*time.Minute),
+		"too old":      Verify("whsec_test", header, body, now.Add(10*time.Minute), 5*time.Minute),
+		"malformed":    Verify("whsec_test", "v1=abc", body, now, 5*time.Minute),
+	} {
+		if !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("%s: err = %v, want ErrInvalidSignature", name, err)
+		}
+	}
+}
+
+func TestSubscribeValidates(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	if _, err := s.Subscribe(ctx, 1, "ftp://example.com/hook", []string{EventUserCreated}); !errors.Is(err, ErrInvalidURL) {
+		t.Errorf("ftp URL: err = %v, want ErrInvalidURL", err)
+	}
+	if _, err := s.Subscribe(ctx, 1, "https://example.com/hook", []string{"user.updated"}); !errors.Is(err, ErrUnknownEvent) {
+		t.Errorf("unknown event: err = %v, want ErrUnknownEvent", err)
+	}
+	sub, err := s.Subscribe(ctx, 1, "https://example.com/hook", []string{EventUserDeleted, EventUserCreated, EventUserDeleted})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sub.Events) != 2 || sub.Events[0] != EventUserCreated || sub.Secret == "" {
+		t.Errorf("subscription = %+v, want both events once and a secret", sub)
+	}
+
+	if err := s.Unsubscribe(ctx, 2, sub.ID); !errors.Is(err, ErrSubscriptionNotFound) {
+		t.Errorf("unsubscribe another user's webhook: err = %v, want ErrSubscriptionNotFound", err)
+	}
+	if err := s.Unsubscribe(ctx, 1, sub.ID); err != nil {
+		t.Errorf("unsubscribe: %v", err)
+	}
+}
+
+func TestPublishDeliversSignedEvents(t *testing.T) {
+	s := newTestService(t)
+	var attempts atomic.Int32
+	var verified atomic.Bool
+	var secret atomic.Value
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if attempts.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		err := Verify(secret.Load().(string), r.Header.Get(HeaderSignature), body, time.Now(), time.Minute)
+		verified.Store(err == nil && r.Header.Get(HeaderEvent) == EventUserCreated)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	ctx := context.Background()
+	sub, err := s.Subscribe(ctx, 1, receiver.URL, []string{EventUserCreated})
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret.Store(sub.Secret)
+	if err := s.Publish(ctx, EventUserDeleted, map[string]int{"id": 7}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Publish(ctx, EventUserCreated, map[string]int{"id": 7}); err != nil {
+		t.Fatal(err)
+	}
+
+	delivery := waitForStatus(t, s, 1, StatusSucceeded)
+	if delivery.Attempts != 2 || delivery.StatusCode != http.StatusNoContent || delivery.CompletedAt == nil {
+		t.Errorf("delivery = %+v, want success on the second attempt", delivery)
+	}
+	if !verified.Load() {
+		t.Error("the receiver could not verify the delivery")
+	}
+}
+
+func TestDeliveryFailsWhenRetriesRunOut(t *testing.T) {
+	s := newTestService(t)
+	var attempts atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer receiver.Close()
+
+	ctx := context.Background()
+	if _, err := s.Subscribe(ctx, 1, receiver.URL, []string{EventUserDeleted}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Publish(ctx, EventUserDeleted, map[string]int{"id": 7}); err != nil {
+		t.Fatal(err)
+	}
+
+	delivery := waitForStatus(t, s, 1, StatusFailed)
+	if delivery.Attempts != 3 || attempts.Load() != 3 || delivery.StatusCode != http.StatusInternalServerError || delivery.LastError == "" {
+		t.Errorf("delivery = %+v after %d requests, want failure after 3", delivery, attempts.Load())
+	}
+}
+
+func TestDeliveryAttemptsAreLogged(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	s := newLoggingTestService(t, zap.New(core))
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer receiver.Close()
+
+	ctx := context.Background()
+	if _, err := s.Subscribe(ctx, 1, "http://user:pass@"+receiver.Listener.Addr().String()+"/hook?token=secret", []string{EventUserCreated}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Publish(ctx, EventUserCreated, map[string]int{"id": 7}); err != nil {
+		t.Fatal(err)
+	}
+	waitForStatus(t, s, 1, StatusSucceeded)
+
+	entries := logs.FilterMessage("Outbound call completed").All()
+	if len(entries) != 1 {
+		t.Fatalf("got %d completed calls logged, want 1", len(entries))
+	}
+	fields := entries[0].ContextMap()
+	if want := "webhook http://" + receiver.Listener.Addr().String() + "/hook"; fields["target"] != want {
+		t.Errorf("target = %v, want %s", fields["target"], want)
+	}
+	if fields["status"] != int64(http.StatusAccepted) || fields["attempt"] != int64(1) {
+		t.Errorf("logged %v", fields)
+	}
+	if _, ok := fields["latency"]; !ok {
+		t.Error("latency not logged")
+	}
+}
+
+func TestRetriedDeliveriesLogJobAttempts(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	s := newLoggingTestService(t, zap.New(core))
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer receiver.Close()
+
+	ctx := context.Background()
+	if _, err := s.Subscribe(ctx, 1, receiver.URL, []string{EventUserCreated}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Publish(ctx, EventUserCreated, map[string]int{"id": 7}); err != nil {
+		t.Fatal(err)
+	}
+	waitForStatus(t, s, 1, StatusFailed)
+
+	failed := logs.FilterMessage("Outbound call failed").All()
+	if len(failed) != 3 {
+		t.Fatalf("got %d failed calls logged, want one per job attempt", len(failed))
+	}
+	for i, entry := range failed {
+		if got := entry.ContextMap()["attempt"]; got != int64(i+1) {
+			t.Errorf("entry %d: attempt = %v, want %d", i, got, i+1)
+		}
+	}
+	summary := logs.FilterMessage("Outbound call gave up").All()
+	if len(summary) != 1 || summary[0].Level != zapcore.ErrorLevel || summary[0].ContextMap()["attempts"] != int64(3) {
+		t.Errorf("give-up entries = %+v, want one error once the queue stops retrying", summary)
+	}
+}
+
+func TestMemoryStoreKeepsRecentDeliveries(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+	for i := 0; i < maxDeliveries+5; i++ {
+		_ = store.SaveDelivery(ctx, Delivery{ID: fmt.Sprintf("d%d", i), UserID: i % 2})
+	}
+	if _, ok, _ := store.Delivery(ctx, "d0"); ok {
+		t.Error("the oldest delivery was kept")
+	}
+	deliveries, _ := store.Deliveries(ctx, 1, 2)
+	if len(deliveries) != 2 || deliveries[0].ID != fmt.Sprintf("d%d", maxDeliveries+3) || deliveries[1].ID != fmt.Sprintf("d%d", maxDeliveries+1) {
+		t.Errorf("deliveries = %+v, want the user's 2 newest, newest first", deliveries)
+	}
+}